@@ -8,6 +8,7 @@ import {
   CreateServerPage,
   InvitePage,
   LogoutPage,
+  OAuthCallbackPage,
   NotFoundPage,
   UserSettingsPage,
   ServerSettingsPage,
@@ -27,6 +28,7 @@ const App: React.FC = () => {
           <Route path="/create-server" element={<CreateServerPage />} />
           <Route path="/invite/:code" element={<InvitePage />} />
           <Route path="/logout" element={<LogoutPage />} />
+          <Route path="/oauth/callback" element={<OAuthCallbackPage />} />
           <Route path="*" element={<NotFoundPage />} />
         </Routes>
       </div>
@@ -42,7 +42,7 @@ const AttachmentPreviewDialog: React.FC<{ controller: ChatController }> = ({ con
           ) : (
             <img
               src={previewAttachment.url}
-              alt={previewAttachment.file_name}
+              alt={previewAttachment.alt_text || previewAttachment.file_name}
               className="max-h-[80vh] w-full object-contain"
             />
           )}
@@ -117,7 +117,7 @@ const ChatMainArea: React.FC<ChatMainAreaProps> = ({ controller, onOpenNavigatio
             <div className="flex max-h-[70vh] w-full items-center justify-center bg-slate-900/80">
               <img
                 src={previewSource}
-                alt={attachment.file_name}
+                alt={attachment.alt_text || attachment.file_name}
                 loading="lazy"
                 className="h-auto max-h-[70vh] w-auto max-w-full object-contain"
               />
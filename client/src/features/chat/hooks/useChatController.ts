@@ -11,6 +11,7 @@ import {
   authAPI,
   buildWebSocketURL,
   channelsAPI,
+  getApiErrorMessage,
   serversAPI,
   uploadsAPI,
   usersAPI,
@@ -1848,12 +1849,7 @@ export const useChatController = (options: UseChatControllerOptions = {}) => {
 
       authenticateWebRTCSession(session);
     } catch (joinError) {
-      const apiMessage =
-        typeof joinError === "object" &&
-        joinError !== null &&
-        "response" in joinError &&
-        (joinError as { response?: { data?: { error?: string } } }).response
-          ?.data?.error;
+      const apiMessage = getApiErrorMessage(joinError);
 
       const fallback =
         "We couldn’t connect you to this audio channel. Please try again.";
@@ -2583,7 +2579,7 @@ export const useChatController = (options: UseChatControllerOptions = {}) => {
               // Get channel and server names for the notification
               const channel = channels.find((c) => c.id === channelId);
               const server = selectedServer;
-              const username = message.user?.username || "Someone";
+              const username = message.user?.display_name || message.user?.username || "Someone";
               const messageContent = message.content.length > 100
                 ? message.content.substring(0, 100) + "..."
                 : message.content;
@@ -2755,6 +2751,35 @@ export const useChatController = (options: UseChatControllerOptions = {}) => {
             });
             return;
           }
+          if (payload.type === "channel.settings_updated") {
+            const updatedChannel = payload.data?.channel;
+            const serverId = payload.data?.server_id;
+
+            if (!updatedChannel) {
+              return;
+            }
+
+            if (
+              selectedServerIdRef.current &&
+              typeof serverId === "number" &&
+              selectedServerIdRef.current !== serverId
+            ) {
+              return;
+            }
+
+            setChannels((previous) => {
+              if (!previous || !previous.some((channel) => channel.id === updatedChannel.id)) {
+                return previous;
+              }
+
+              return normalizeChannelList(
+                previous.map((channel) =>
+                  channel.id === updatedChannel.id ? { ...channel, ...updatedChannel } : channel,
+                ),
+              );
+            });
+            return;
+          }
           if (payload.type === "webrtc.offer") {
             const data = (payload.data ?? {}) as Record<string, unknown>;
             void handleIncomingOffer(data);
@@ -3550,17 +3575,9 @@ export const useChatController = (options: UseChatControllerOptions = {}) => {
         setCreateChannelForm({ name: "", description: "", type: "text" });
       } catch (submitError) {
         let message = "Failed to create channel";
-        if (
-          typeof submitError === "object" &&
-          submitError !== null &&
-          "response" in submitError
-        ) {
-          const responseData = (
-            submitError as {
-              response?: { data?: { error?: string; message?: string } };
-            }
-          ).response?.data;
-          message = responseData?.error || responseData?.message || message;
+        const apiMessage = getApiErrorMessage(submitError);
+        if (apiMessage) {
+          message = apiMessage;
         } else if (submitError instanceof Error) {
           message = submitError.message;
         }
@@ -3767,7 +3784,7 @@ export const useChatController = (options: UseChatControllerOptions = {}) => {
     }> = [];
 
     filteredMessages.forEach((msg) => {
-      const username = msg.user?.username?.trim() || "Member";
+      const username = (msg.user?.display_name || msg.user?.username)?.trim() || "Member";
       const avatar = msg.user?.avatar ?? null;
       const userId = msg.user_id ?? null;
       const initials =
@@ -1,7 +1,6 @@
 import React, { useEffect, useState } from 'react';
 import { Link, useNavigate, useParams } from 'react-router-dom';
-import { AxiosError } from 'axios';
-import { invitesAPI } from '../services/api';
+import { invitesAPI, getApiErrorMessage } from '../services/api';
 import { Server, ServerInvite } from '../types/index';
 
 const InvitePage: React.FC = () => {
@@ -46,8 +45,7 @@ const InvitePage: React.FC = () => {
         if (!isMounted) {
           return;
         }
-        const axiosError = err as AxiosError<{ error?: string }>;
-        const serverMessage = axiosError?.response?.data?.error;
+        const serverMessage = getApiErrorMessage(err);
         setError(serverMessage || 'Invite not found or no longer valid.');
         setServer(null);
         setInvite(null);
@@ -82,8 +80,7 @@ const InvitePage: React.FC = () => {
       await invitesAPI.acceptInvite(code);
       navigate('/chat', { replace: true });
     } catch (err) {
-      const axiosError = err as AxiosError<{ error?: string }>;
-      const serverMessage = axiosError?.response?.data?.error;
+      const serverMessage = getApiErrorMessage(err);
       setError(serverMessage || 'Failed to accept invite.');
     } finally {
       setIsAccepting(false);
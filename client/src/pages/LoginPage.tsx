@@ -1,15 +1,45 @@
 import React, { useState, ChangeEvent, FormEvent } from 'react';
-import { AxiosError } from 'axios';
-import { Link, useNavigate } from 'react-router-dom';
-import { authAPI } from '../services/api';
+import { Link, useLocation, useNavigate } from 'react-router-dom';
+import { authAPI, getApiErrorMessage } from '../services/api';
+
+const oauthErrorMessages: Record<string, string> = {
+  oauth_provider_unknown: 'That sign-in provider is not enabled.',
+  oauth_state_mismatch: 'Your sign-in link expired. Please try again.',
+  oauth_email_unverified: 'Your account with that provider has no verified email address.',
+};
 
 const LoginPage: React.FC = () => {
+  const location = useLocation();
   const [identifier, setIdentifier] = useState('');
   const [password, setPassword] = useState('');
   const [isLoading, setIsLoading] = useState(false);
-  const [error, setError] = useState('');
+  const [error, setError] = useState(() => {
+    const oauthError = new URLSearchParams(location.search).get('oauth_error');
+    if (!oauthError) {
+      return '';
+    }
+    return oauthErrorMessages[oauthError] || 'Signing in with that provider failed. Please try again.';
+  });
+  // An OAuth sign-in for a user with 2FA arrives here with its challenge.
+  const [challengeToken, setChallengeToken] = useState(
+    () => (location.state as { challengeToken?: string } | null)?.challengeToken || '',
+  );
+  const [twoFactorCode, setTwoFactorCode] = useState('');
   const navigate = useNavigate();
 
+  const completeLogin = (token: string, expiresAt: string) => {
+    localStorage.setItem('authToken', token);
+    localStorage.setItem('authTokenExpiresAt', expiresAt);
+
+    const pendingInviteCode = sessionStorage.getItem('pendingInviteCode');
+    if (pendingInviteCode) {
+      sessionStorage.removeItem('pendingInviteCode');
+      navigate(`/invite/${pendingInviteCode}`);
+    } else {
+      navigate('/chat');
+    }
+  };
+
   const handleLogin = async (event: FormEvent<HTMLFormElement>) => {
     event.preventDefault();
     setIsLoading(true);
@@ -17,26 +47,47 @@ const LoginPage: React.FC = () => {
 
     try {
       const response = await authAPI.login({ identifier, password });
-      localStorage.setItem('authToken', response.data.token);
-      localStorage.setItem('authTokenExpiresAt', response.data.expires_at);
-
-      const pendingInviteCode = sessionStorage.getItem('pendingInviteCode');
-      if (pendingInviteCode) {
-        sessionStorage.removeItem('pendingInviteCode');
-        navigate(`/invite/${pendingInviteCode}`);
-      } else {
-        navigate('/chat');
+      if ('two_factor_required' in response.data) {
+        setChallengeToken(response.data.challenge_token);
+        setTwoFactorCode('');
+        return;
       }
+      completeLogin(response.data.token, response.data.expires_at);
     } catch (err) {
       console.error('Login error:', err);
-      const axiosError = err as AxiosError<{ error?: string }>;
-      const serverMessage = axiosError?.response?.data?.error;
+      const serverMessage = getApiErrorMessage(err);
       setError(serverMessage || 'Login failed. Please check your credentials, verify your email, and try again.');
     } finally {
       setIsLoading(false);
     }
   };
 
+  const handleTwoFactor = async (event: FormEvent<HTMLFormElement>) => {
+    event.preventDefault();
+    setIsLoading(true);
+    setError('');
+
+    try {
+      const response = await authAPI.completeTwoFactorLogin({
+        challenge_token: challengeToken,
+        code: twoFactorCode.trim(),
+      });
+      completeLogin(response.data.token, response.data.expires_at);
+    } catch (err) {
+      console.error('Two-factor login error:', err);
+      const serverMessage = getApiErrorMessage(err);
+      setError(serverMessage || 'That code did not work. Please try again.');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const handleCancelTwoFactor = () => {
+    setChallengeToken('');
+    setTwoFactorCode('');
+    setError('');
+  };
+
   const handleIdentifierChange = (event: ChangeEvent<HTMLInputElement>) => {
     setIdentifier(event.target.value);
   };
@@ -112,65 +163,110 @@ const LoginPage: React.FC = () => {
               <p className="mt-2 text-slate-400">Sign in to your workspace</p>
             </div>
 
-            <form onSubmit={handleLogin} className="space-y-6">
-              <div className="space-y-2">
-                <label htmlFor="identifier" className="text-sm font-medium text-slate-300">
-                  Email or Username
-                </label>
-                <input
-                  id="identifier"
-                  type="text"
-                  autoComplete="username"
-                  required
-                  value={identifier}
-                  onChange={handleIdentifierChange}
-                  className="w-full rounded-lg border border-slate-700 bg-slate-900/50 px-4 py-3 text-slate-100 placeholder-slate-500 focus:border-violet-500 focus:outline-none focus:ring-2 focus:ring-violet-500/40 transition"
-                  placeholder="you@example.com or username"
-                />
-              </div>
-
-              <div className="space-y-2">
-                <div className="flex items-center justify-between">
-                  <label htmlFor="password" className="text-sm font-medium text-slate-300">
-                    Password
+            {challengeToken ? (
+              <form onSubmit={handleTwoFactor} className="space-y-6">
+                <div className="space-y-2">
+                  <label htmlFor="two-factor-code" className="text-sm font-medium text-slate-300">
+                    Authentication code
                   </label>
-                  <button type="button" className="text-sm text-violet-400 hover:text-violet-300 transition">
-                    Forgot password?
+                  <p className="text-sm text-slate-400">
+                    Enter the code from your authenticator app, or one of your backup codes.
+                  </p>
+                  <input
+                    id="two-factor-code"
+                    type="text"
+                    inputMode="numeric"
+                    autoComplete="one-time-code"
+                    required
+                    autoFocus
+                    value={twoFactorCode}
+                    onChange={(event: ChangeEvent<HTMLInputElement>) => setTwoFactorCode(event.target.value)}
+                    className="w-full rounded-lg border border-slate-700 bg-slate-900/50 px-4 py-3 text-slate-100 placeholder-slate-500 focus:border-violet-500 focus:outline-none focus:ring-2 focus:ring-violet-500/40 transition"
+                    placeholder="123456"
+                  />
+                </div>
+
+                {error && (
+                  <div className="rounded-lg border border-red-500/50 bg-red-500/10 px-4 py-3 text-sm text-red-200">
+                    {error}
+                  </div>
+                )}
+
+                <button
+                  type="submit"
+                  disabled={isLoading}
+                  className="w-full rounded-lg bg-gradient-to-r from-violet-600 to-indigo-600 px-4 py-3 font-semibold text-white shadow-lg shadow-violet-500/30 transition hover:from-violet-500 hover:to-indigo-500 focus:outline-none focus:ring-2 focus:ring-violet-500 focus:ring-offset-2 focus:ring-offset-slate-950 disabled:cursor-not-allowed disabled:opacity-60"
+                >
+                  {isLoading ? 'Verifying...' : 'Verify'}
+                </button>
+
+                <div className="text-center text-sm text-slate-400">
+                  <button type="button" onClick={handleCancelTwoFactor} className="font-semibold text-violet-400 hover:text-violet-300 transition">
+                    Back to sign in
                   </button>
                 </div>
-                <input
-                  id="password"
-                  type="password"
-                  autoComplete="current-password"
-                  required
-                  value={password}
-                  onChange={handlePasswordChange}
-                  className="w-full rounded-lg border border-slate-700 bg-slate-900/50 px-4 py-3 text-slate-100 placeholder-slate-500 focus:border-violet-500 focus:outline-none focus:ring-2 focus:ring-violet-500/40 transition"
-                  placeholder="••••••••"
-                />
-              </div>
+              </form>
+            ) : (
+              <form onSubmit={handleLogin} className="space-y-6">
+                <div className="space-y-2">
+                  <label htmlFor="identifier" className="text-sm font-medium text-slate-300">
+                    Email or Username
+                  </label>
+                  <input
+                    id="identifier"
+                    type="text"
+                    autoComplete="username"
+                    required
+                    value={identifier}
+                    onChange={handleIdentifierChange}
+                    className="w-full rounded-lg border border-slate-700 bg-slate-900/50 px-4 py-3 text-slate-100 placeholder-slate-500 focus:border-violet-500 focus:outline-none focus:ring-2 focus:ring-violet-500/40 transition"
+                    placeholder="you@example.com or username"
+                  />
+                </div>
 
-              {error && (
-                <div className="rounded-lg border border-red-500/50 bg-red-500/10 px-4 py-3 text-sm text-red-200">
-                  {error}
+                <div className="space-y-2">
+                  <div className="flex items-center justify-between">
+                    <label htmlFor="password" className="text-sm font-medium text-slate-300">
+                      Password
+                    </label>
+                    <button type="button" className="text-sm text-violet-400 hover:text-violet-300 transition">
+                      Forgot password?
+                    </button>
+                  </div>
+                  <input
+                    id="password"
+                    type="password"
+                    autoComplete="current-password"
+                    required
+                    value={password}
+                    onChange={handlePasswordChange}
+                    className="w-full rounded-lg border border-slate-700 bg-slate-900/50 px-4 py-3 text-slate-100 placeholder-slate-500 focus:border-violet-500 focus:outline-none focus:ring-2 focus:ring-violet-500/40 transition"
+                    placeholder="••••••••"
+                  />
                 </div>
-              )}
-
-              <button
-                type="submit"
-                disabled={isLoading}
-                className="w-full rounded-lg bg-gradient-to-r from-violet-600 to-indigo-600 px-4 py-3 font-semibold text-white shadow-lg shadow-violet-500/30 transition hover:from-violet-500 hover:to-indigo-500 focus:outline-none focus:ring-2 focus:ring-violet-500 focus:ring-offset-2 focus:ring-offset-slate-950 disabled:cursor-not-allowed disabled:opacity-60"
-              >
-                {isLoading ? 'Signing in...' : 'Sign in'}
-              </button>
-
-              <div className="text-center text-sm text-slate-400">
-                Don't have an account?{' '}
-                <Link to="/register" className="font-semibold text-violet-400 hover:text-violet-300 transition">
-                  Create one for free
-                </Link>
-              </div>
-            </form>
+
+                {error && (
+                  <div className="rounded-lg border border-red-500/50 bg-red-500/10 px-4 py-3 text-sm text-red-200">
+                    {error}
+                  </div>
+                )}
+
+                <button
+                  type="submit"
+                  disabled={isLoading}
+                  className="w-full rounded-lg bg-gradient-to-r from-violet-600 to-indigo-600 px-4 py-3 font-semibold text-white shadow-lg shadow-violet-500/30 transition hover:from-violet-500 hover:to-indigo-500 focus:outline-none focus:ring-2 focus:ring-violet-500 focus:ring-offset-2 focus:ring-offset-slate-950 disabled:cursor-not-allowed disabled:opacity-60"
+                >
+                  {isLoading ? 'Signing in...' : 'Sign in'}
+                </button>
+
+                <div className="text-center text-sm text-slate-400">
+                  Don't have an account?{' '}
+                  <Link to="/register" className="font-semibold text-violet-400 hover:text-violet-300 transition">
+                    Create one for free
+                  </Link>
+                </div>
+              </form>
+            )}
           </div>
         </main>
       </div>
@@ -0,0 +1,49 @@
+import React, { useEffect } from 'react';
+import { useLocation, useNavigate } from 'react-router-dom';
+
+// The API finishes an OAuth sign-in by redirecting here with the session token, or
+// a two-factor challenge, in the URL fragment so it never reaches server logs.
+const OAuthCallbackPage: React.FC = () => {
+  const location = useLocation();
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    const params = new URLSearchParams(location.hash.replace(/^#/, ''));
+    const token = params.get('token');
+    const expiresAt = params.get('expires_at');
+    const challengeToken = params.get('challenge_token');
+
+    if (token && expiresAt) {
+      localStorage.setItem('authToken', token);
+      localStorage.setItem('authTokenExpiresAt', expiresAt);
+
+      const pendingInviteCode = sessionStorage.getItem('pendingInviteCode');
+      if (pendingInviteCode) {
+        sessionStorage.removeItem('pendingInviteCode');
+        navigate(`/invite/${pendingInviteCode}`, { replace: true });
+      } else {
+        navigate('/chat', { replace: true });
+      }
+      return;
+    }
+
+    if (challengeToken) {
+      navigate('/', { replace: true, state: { challengeToken } });
+      return;
+    }
+
+    navigate('/?oauth_error=oauth_failed', { replace: true });
+  }, [location.hash, navigate]);
+
+  return (
+    <div className="relative flex min-h-screen items-center justify-center bg-slate-950 text-slate-100">
+      <div className="absolute inset-0 bg-gradient-to-b from-slate-950 via-slate-950/90 to-slate-900/80" aria-hidden="true" />
+      <div className="relative z-10 flex flex-col items-center gap-4 rounded-3xl border border-slate-800/70 bg-slate-950/80 px-8 py-10 shadow-2xl">
+        <div className="h-3 w-3 animate-ping rounded-full bg-primary-300" />
+        <h1 className="text-lg font-semibold text-white">Signing you in…</h1>
+      </div>
+    </div>
+  );
+};
+
+export default OAuthCallbackPage;
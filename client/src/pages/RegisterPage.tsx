@@ -1,7 +1,6 @@
 import React, { useState, ChangeEvent, FormEvent, useRef, useEffect } from 'react';
-import { AxiosError } from 'axios';
 import { Link, useNavigate } from 'react-router-dom';
-import { authAPI } from '../services/api';
+import { authAPI, getApiErrorMessage } from '../services/api';
 
 const RegisterPage: React.FC = () => {
   const navigate = useNavigate();
@@ -39,8 +38,7 @@ const RegisterPage: React.FC = () => {
       }, 4000);
     } catch (err) {
       console.error('Registration error:', err);
-      const axiosError = err as AxiosError<{ error?: string }>;
-      const serverMessage = axiosError?.response?.data?.error;
+      const serverMessage = getApiErrorMessage(err);
       setError(serverMessage || 'Registration failed. Try a different email or username.');
     } finally {
       setIsLoading(false);
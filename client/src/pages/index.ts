@@ -5,6 +5,7 @@ export { default as VerifyEmailPage } from './VerifyEmailPage';
 export { default as CreateServerPage } from './CreateServerPage';
 export { default as InvitePage } from './InvitePage';
 export { default as LogoutPage } from './LogoutPage';
+export { default as OAuthCallbackPage } from './OAuthCallbackPage';
 export { default as NotFoundPage } from './NotFoundPage';
 export { UserSettingsPage } from './UserSettingsPage';
 export { ServerSettingsPage } from './ServerSettingsPage';
@@ -6,6 +6,8 @@ import {
   Server,
   Channel,
   AuthResponse,
+  LoginResponse,
+  TwoFactorLoginRequest,
   RegisterResponse,
   VerifyEmailResponse,
   CreateServerRequest,
@@ -27,6 +29,8 @@ import {
   PresignAvatarUploadResponse,
   SetAvatarRequest,
   UserSummary,
+  ApiErrorResponse,
+  BootstrapResponse,
 } from "../types/index";
 
 // Default to a relative path so production builds don't accidentally call localhost.
@@ -37,6 +41,19 @@ const api = axios.create({
   baseURL: API_BASE_URL,
 });
 
+// getApiError returns the structured error body of a failed API request, if any.
+export const getApiError = (error: unknown): ApiErrorResponse["error"] | undefined => {
+  if (!axios.isAxiosError<ApiErrorResponse>(error)) {
+    return undefined;
+  }
+  const body = error.response?.data?.error;
+  return body && typeof body.message === "string" ? body : undefined;
+};
+
+// getApiErrorMessage returns the server's message for a failed API request, if any.
+export const getApiErrorMessage = (error: unknown): string | undefined =>
+  getApiError(error)?.message;
+
 // Add auth token to requests if available
 api.interceptors.request.use((config: InternalAxiosRequestConfig) => {
   const token = localStorage.getItem("authToken");
@@ -48,8 +65,13 @@ api.interceptors.request.use((config: InternalAxiosRequestConfig) => {
 
 // Auth API
 export const authAPI = {
-  login: async (credentials: LoginRequest): Promise<AuthResponse> => {
-    const response = await api.post<AuthResponse>("/auth/login", credentials);
+  login: async (credentials: LoginRequest): Promise<LoginResponse> => {
+    const response = await api.post<LoginResponse>("/auth/login", credentials);
+    return response.data;
+  },
+
+  completeTwoFactorLogin: async (payload: TwoFactorLoginRequest): Promise<AuthResponse> => {
+    const response = await api.post<AuthResponse>("/auth/2fa", payload);
     return response.data;
   },
 
@@ -81,6 +103,11 @@ export const authAPI = {
 
 // Servers API
 export const serversAPI = {
+  getBootstrap: async (): Promise<BootstrapResponse> => {
+    const response = await api.get<{ data: BootstrapResponse }>("/bootstrap");
+    return response.data.data;
+  },
+
   getServers: async (): Promise<{ servers: Server[] }> => {
     const response = await api.get<{ data: { servers: Server[] } }>("/servers");
     return response.data.data;
@@ -133,6 +160,8 @@ export const invitesAPI = {
     payload: {
       expires_in_hours?: number;
       max_uses?: number;
+      one_time?: boolean;
+      role?: 'admin' | 'member';
       emails?: string[];
       message?: string;
     },
@@ -194,6 +223,17 @@ export const channelsAPI = {
     return response.data;
   },
 
+  removeMessageAttachment: async (
+    channelId: number,
+    messageId: number,
+    attachmentId: number,
+  ): Promise<CreateMessageResponse> => {
+    const response = await api.delete<CreateMessageResponse>(
+      `/channels/${channelId}/messages/${messageId}/attachments/${attachmentId}`,
+    );
+    return response.data;
+  },
+
   sendTypingIndicator: async (
     channelId: number,
     active = true,
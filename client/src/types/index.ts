@@ -3,8 +3,18 @@ export interface User {
   username: string;
   email: string;
   avatar?: string;
+  /** Identicon path (under the API base) to show when avatar is empty. */
+  default_avatar?: string;
+  /** Server nickname and the name to show, set on message authors. */
+  nickname?: string;
+  display_name?: string;
   email_verified_at?: string;
+  two_factor_enabled?: boolean;
   last_login_at?: string;
+  /** When the user last had a connection open; empty if never recorded. */
+  last_seen_at?: string;
+  presence_status?: "online" | "away" | "dnd" | "invisible";
+  read_receipts?: boolean;
   created_at: string;
   updated_at: string;
 }
@@ -13,6 +23,7 @@ export interface UserSummary {
   id: number;
   username: string;
   avatar?: string;
+  default_avatar?: string;
 }
 
 export interface Server {
@@ -23,7 +34,10 @@ export interface Server {
   owner_id: number;
   owner?: Partial<User> | null;
   current_member_role?: "owner" | "member";
+  public?: boolean;
+  tags?: string[];
   channels?: Channel[];
+  channels_truncated?: boolean;
   members?: User[];
   created_at: string;
   updated_at: string;
@@ -38,6 +52,9 @@ export interface Channel {
   server?: Server;
   messages?: Message[];
   position: number;
+  /** Messages are withheld until the user acknowledges the NSFW warning. */
+  nsfw?: boolean;
+  archived_at?: string;
   created_at: string;
   updated_at: string;
 }
@@ -51,9 +68,19 @@ export interface Message {
   channel?: Channel;
   type: "text" | "image" | "file";
   edited_at?: string;
+  expires_at?: string;
   created_at: string;
   updated_at: string;
   attachments?: MessageAttachment[];
+  link_preview?: LinkPreview | null;
+}
+
+export interface LinkPreview {
+  url: string;
+  title: string;
+  description: string;
+  image_url: string;
+  site_name: string;
 }
 
 export interface MessageAttachment {
@@ -63,12 +90,17 @@ export interface MessageAttachment {
   file_name: string;
   content_type: string;
   file_size: number;
+  alt_text?: string;
   width?: number;
   height?: number;
   preview_url?: string;
   preview_object_key?: string;
   preview_width?: number;
   preview_height?: number;
+  // Audio attachments: peak amplitudes (0-100) for a waveform scrubber, and length in seconds.
+  waveform?: number[];
+  duration?: number;
+  position?: number;
   created_at: string;
 }
 
@@ -92,6 +124,24 @@ export interface AuthResponse {
   };
 }
 
+// Login answers users with two-factor authentication with a challenge to finish
+// through /auth/2fa instead of a token.
+export interface TwoFactorChallengeResponse {
+  message: string;
+  data: {
+    two_factor_required: true;
+    challenge_token: string;
+    expires_at: string;
+  };
+}
+
+export type LoginResponse = AuthResponse | TwoFactorChallengeResponse;
+
+export interface TwoFactorLoginRequest {
+  challenge_token: string;
+  code: string;
+}
+
 export interface RegisterResponse {
   message: string;
   data: {
@@ -119,7 +169,10 @@ export interface ServerInvite {
   inviter_id: number;
   max_uses: number;
   uses: number;
+  role?: string;
   expires_at?: string;
+  revoked_at?: string;
+  active?: boolean;
   invite_url?: string;
   created_at: string;
   updated_at: string;
@@ -182,6 +235,8 @@ export interface MessageAttachmentInput {
   file_name: string;
   content_type: string;
   file_size: number;
+  alt_text?: string;
+  position?: number;
 }
 
 export interface CreateAttachmentUploadRequest {
@@ -209,12 +264,24 @@ export interface CreateMessageResponse {
 export interface GetMessagesParams {
   limit?: number;
   before?: string;
+  after?: string;
+  // Centres the page on this message ID; cannot be combined with before/after.
+  around?: number;
+  include_total?: boolean;
 }
 
 export interface GetMessagesResponse {
   messages: Message[];
-  has_more: boolean;
+  has_more?: boolean;
   next_cursor?: string;
+  // Set for around requests.
+  target_id?: number;
+  has_more_before?: boolean;
+  has_more_after?: boolean;
+  before_cursor?: string;
+  after_cursor?: string;
+  // Approximate, cached count of the channel's messages (include_total=true).
+  total?: number;
 }
 
 export interface WebSocketMessage {
@@ -238,6 +305,7 @@ export interface WebRTCParticipant {
   session_id?: string;
   channel_id?: number;
   media_state?: WebRTCMediaState;
+  hand_raised?: boolean;
   last_seen?: string;
   username?: string;
   avatar?: string;
@@ -247,6 +315,12 @@ export interface ChannelParticipantsMap {
   [channelId: string]: WebRTCParticipant[];
 }
 
+export interface BootstrapResponse {
+  user: User;
+  servers: Server[];
+  participants: ChannelParticipantsMap;
+}
+
 export interface JoinWebRTCResponse {
   session_token: string;
   expires_at: string;
@@ -257,6 +331,7 @@ export interface JoinWebRTCResponse {
   };
   participant: WebRTCParticipant;
   participants: WebRTCParticipant[];
+  screen_sharers: number[];
   iceservers: unknown;
   sfu: unknown;
 }
@@ -289,3 +364,14 @@ export interface PresignAvatarUploadResponse {
   file_url: string;
   expires_at: string;
 }
+
+export interface ApiError {
+  code: string;
+  message: string;
+  details?: Record<string, unknown>;
+}
+
+export interface ApiErrorResponse {
+  error: ApiError;
+  request_id?: string;
+}
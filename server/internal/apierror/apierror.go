@@ -0,0 +1,204 @@
+// Package apierror writes the JSON error body shared by every API endpoint:
+//
+//	{"error": {"code": "channel_full", "message": "channel is full", "details": {...}}}
+//
+// Codes are stable snake_case identifiers that clients can branch on and
+// translate; messages are human-readable English and may change. Details is
+// only present when the error carries extra data, such as retry_after.
+package apierror
+
+import "github.com/gin-gonic/gin"
+
+// Generic codes, used when an error has nothing more specific to say.
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeGone               = "gone"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+	CodeNotImplemented     = "not_implemented"
+	CodeStorageError       = "storage_error"
+	CodeServiceUnavailable = "service_unavailable"
+)
+
+// Validation codes.
+const (
+	CodeInvalidID              = "invalid_id"
+	CodeInvalidCursor          = "invalid_cursor"
+	CodeInvalidPosition        = "invalid_position"
+	CodeInvalidRole            = "invalid_role"
+	CodeInvalidChannelType     = "invalid_channel_type"
+	CodeInvalidMessageType     = "invalid_message_type"
+	CodeInvalidMaxParticipants = "invalid_max_participants"
+	CodeInvalidMessageTTL      = "invalid_message_ttl"
+	CodeInvalidDNDSchedule     = "invalid_dnd_schedule"
+	CodeInvalidWordFilter      = "invalid_word_filter"
+	CodeInvalidSlowmode        = "invalid_slowmode"
+	CodeInvalidWelcomeChannel  = "invalid_welcome_channel"
+	CodeInvalidTransferTarget  = "invalid_transfer_target"
+	CodeInvalidAttachment      = "invalid_attachment"
+	CodeInvalidFile            = "invalid_file"
+	CodeInvalidEmojiName       = "invalid_emoji_name"
+	CodeInvalidEmojiImage      = "invalid_emoji_image"
+	CodeInvalidImageType       = "invalid_image_type"
+	CodeInvalidPassword        = "invalid_password"
+	CodeNameRequired           = "name_required"
+	CodeContentRequired        = "content_required"
+	CodeFileRequired           = "file_required"
+	CodeAttachmentsRequired    = "attachments_required"
+	CodeTokenRequired          = "token_required"
+	CodeInviteCodeRequired     = "invite_code_required"
+	CodeRulesRequired          = "rules_required"
+	CodeMessageTooLong         = "message_too_long"
+	CodeMessageBlocked         = "message_blocked"
+	CodeNotTextChannel         = "not_text_channel"
+	CodeNotAudioChannel        = "not_audio_channel"
+	CodeChannelArchived        = "channel_archived"
+	CodeChannelNotPrivate      = "channel_not_private"
+	CodeEmailUnchanged         = "email_unchanged"
+	CodeRangeNotSatisfiable    = "range_not_satisfiable"
+)
+
+// Authentication codes.
+const (
+	CodeAuthorizationRequired    = "authorization_required"
+	CodeInvalidToken             = "invalid_token"
+	CodeInvalidCredentials       = "invalid_credentials"
+	CodeIncorrectPassword        = "incorrect_password"
+	CodeSessionRevoked           = "session_revoked"
+	CodeEmailNotVerified         = "email_not_verified"
+	CodeInvalidConfirmationToken = "invalid_confirmation_token"
+	CodeInvalidVerificationToken = "invalid_verification_token"
+	CodeInvalidAPIToken          = "invalid_api_token"
+	CodeAPITokenNotAllowed       = "api_token_not_allowed"
+	CodeAPITokenScopeMissing     = "api_token_scope_missing"
+	CodeAPITokenWrongServer      = "api_token_wrong_server"
+	CodeOriginNotAllowed         = "origin_not_allowed"
+	CodeTwoFactorUnavailable     = "two_factor_unavailable"
+	CodeTwoFactorEnabled         = "two_factor_already_enabled"
+	CodeTwoFactorNotEnabled      = "two_factor_not_enabled"
+	CodeTwoFactorNotSetUp        = "two_factor_not_set_up"
+	CodeInvalidTwoFactorCode     = "invalid_two_factor_code"
+	CodeInvalidTwoFactorToken    = "invalid_two_factor_challenge"
+	CodeOAuthProviderUnknown     = "oauth_provider_unknown"
+	CodeOAuthStateMismatch       = "oauth_state_mismatch"
+	CodeOAuthEmailUnverified     = "oauth_email_unverified"
+	CodeOAuthFailed              = "oauth_failed"
+)
+
+// Permission codes.
+const (
+	CodeMembershipRequired    = "membership_required"
+	CodeOwnerRequired         = "owner_required"
+	CodePermissionDenied      = "permission_denied"
+	CodeInsufficientRole      = "insufficient_role"
+	CodeChannelAccessRequired = "channel_access_required"
+	CodeOwnerRoleImmutable    = "owner_role_immutable"
+	CodeCannotBanSelf         = "cannot_ban_self"
+	CodeBanned                = "banned"
+
+	// CodeNSFWAcknowledgmentRequired means the channel is NSFW and the caller has
+	// not yet confirmed they want to see it.
+	CodeNSFWAcknowledgmentRequired = "nsfw_acknowledgment_required"
+)
+
+// Not found codes.
+const (
+	CodeServerNotFound           = "server_not_found"
+	CodeChannelNotFound          = "channel_not_found"
+	CodeCategoryNotFound         = "category_not_found"
+	CodeMessageNotFound          = "message_not_found"
+	CodeAttachmentNotFound       = "attachment_not_found"
+	CodeUserNotFound             = "user_not_found"
+	CodeSessionNotFound          = "session_not_found"
+	CodeWebhookNotFound          = "webhook_not_found"
+	CodeAPITokenNotFound         = "api_token_not_found"
+	CodeInviteNotFound           = "invite_not_found"
+	CodeEmojiNotFound            = "emoji_not_found"
+	CodeBanNotFound              = "ban_not_found"
+	CodePushSubscriptionNotFound = "push_subscription_not_found"
+	CodeExportNotFound           = "export_not_found"
+	CodeNotServerMember          = "not_server_member"
+	CodeNotChannelMember         = "not_channel_member"
+)
+
+// State codes.
+const (
+	CodeInviteExpired       = "invite_expired"
+	CodeInviteRevoked       = "invite_revoked"
+	CodeInviteMaxed         = "invite_maxed"
+	CodeChannelFull         = "channel_full"
+	CodeClientNonceConflict = "client_nonce_conflict"
+	CodeEmailInUse          = "email_in_use"
+	CodeUserConflict        = "user_conflict"
+	CodeUsernameReserved    = "username_reserved"
+	CodeBanExists           = "ban_exists"
+	CodeMemberPending       = "member_pending"
+	CodeMemberNotPending    = "member_not_pending"
+	CodeSlowmode            = "slowmode"
+	CodeUploadsDisabled     = "uploads_disabled"
+	CodeTURNDisabled        = "turn_disabled"
+	CodeEmojiNameTaken      = "emoji_name_taken"
+	CodeEmojiLimitReached   = "emoji_limit_reached"
+	CodePushDisabled        = "push_disabled"
+	CodeOwnsServers         = "owns_servers_with_members"
+	CodeQuotaExceeded       = "storage_quota_exceeded"
+)
+
+// Body builds the error payload. Pass nil details to omit the field.
+func Body(code, message string, details gin.H) gin.H {
+	body := gin.H{
+		"code":    code,
+		"message": message,
+	}
+	if len(details) > 0 {
+		body["details"] = details
+	}
+
+	return gin.H{"error": body}
+}
+
+// Respond writes an error response.
+func Respond(c *gin.Context, status int, code, message string) {
+	c.JSON(status, Body(code, message, nil))
+}
+
+// RespondWithDetails writes an error response carrying extra machine-readable data.
+func RespondWithDetails(c *gin.Context, status int, code, message string, details gin.H) {
+	c.JSON(status, Body(code, message, details))
+}
+
+// Abort writes an error response and stops the handler chain.
+func Abort(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, Body(code, message, nil))
+}
+
+// CodeForStatus returns the generic code for an HTTP status, used when an
+// error has no more specific code.
+func CodeForStatus(status int) string {
+	switch {
+	case status == 401:
+		return CodeUnauthorized
+	case status == 403:
+		return CodeForbidden
+	case status == 404:
+		return CodeNotFound
+	case status == 409:
+		return CodeConflict
+	case status == 410:
+		return CodeGone
+	case status == 429:
+		return CodeRateLimited
+	case status == 501:
+		return CodeNotImplemented
+	case status == 503:
+		return CodeServiceUnavailable
+	case status >= 500:
+		return CodeInternal
+	default:
+		return CodeInvalidRequest
+	}
+}
@@ -0,0 +1,113 @@
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespond(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		respond func(c *gin.Context)
+		want    string
+	}{
+		{
+			name:    "without details",
+			respond: func(c *gin.Context) { Respond(c, http.StatusNotFound, CodeChannelNotFound, "channel not found") },
+			want:    `{"error":{"code":"channel_not_found","message":"channel not found"}}`,
+		},
+		{
+			name: "with details",
+			respond: func(c *gin.Context) {
+				RespondWithDetails(c, http.StatusTooManyRequests, CodeRateLimited, "slow down", gin.H{"retry_after": 3})
+			},
+			want: `{"error":{"code":"rate_limited","details":{"retry_after":3},"message":"slow down"}}`,
+		},
+		{
+			name: "empty details are omitted",
+			respond: func(c *gin.Context) {
+				RespondWithDetails(c, http.StatusBadRequest, CodeInvalidRequest, "bad", gin.H{})
+			},
+			want: `{"error":{"code":"invalid_request","message":"bad"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			tt.respond(c)
+
+			assertJSONBody(t, w.Body.Bytes(), tt.want)
+		})
+	}
+}
+
+func TestAbortStopsTheChain(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		Abort(c, http.StatusUnauthorized, CodeUnauthorized, "authentication required")
+	}, func(c *gin.Context) {
+		t.Error("handler after Abort ran")
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	assertJSONBody(t, w.Body.Bytes(), `{"error":{"code":"unauthorized","message":"authentication required"}}`)
+}
+
+func TestCodeForStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{status: http.StatusBadRequest, want: CodeInvalidRequest},
+		{status: http.StatusUnprocessableEntity, want: CodeInvalidRequest},
+		{status: http.StatusUnauthorized, want: CodeUnauthorized},
+		{status: http.StatusForbidden, want: CodeForbidden},
+		{status: http.StatusNotFound, want: CodeNotFound},
+		{status: http.StatusConflict, want: CodeConflict},
+		{status: http.StatusGone, want: CodeGone},
+		{status: http.StatusTooManyRequests, want: CodeRateLimited},
+		{status: http.StatusInternalServerError, want: CodeInternal},
+		{status: http.StatusNotImplemented, want: CodeNotImplemented},
+		{status: http.StatusBadGateway, want: CodeInternal},
+		{status: http.StatusServiceUnavailable, want: CodeServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		if got := CodeForStatus(tt.status); got != tt.want {
+			t.Errorf("CodeForStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func assertJSONBody(t *testing.T, body []byte, want string) {
+	t.Helper()
+
+	var got, expected any
+	if err := json.Unmarshal(body, &got); err != nil {
+		t.Fatalf("decode body %s: %v", body, err)
+	}
+	if err := json.Unmarshal([]byte(want), &expected); err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(expected)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("body = %s, want %s", gotJSON, wantJSON)
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	apiTokenPrefix       = "bfc_"
+	apiTokenDisplayChars = 8
+)
+
+// ErrInvalidAPIToken is returned for unknown or revoked API tokens.
+var ErrInvalidAPIToken = errors.New("invalid api token")
+
+// APITokenScopes lists the scopes an API token may be granted.
+var APITokenScopes = []string{
+	models.APITokenScopeMessagesRead,
+	models.APITokenScopeMessagesWrite,
+	models.APITokenScopeServersRead,
+}
+
+// NewAPIToken returns a fresh plaintext token along with the prefix shown in
+// listings and the hash to persist.
+func NewAPIToken() (plaintext, prefix, hash string, err error) {
+	secret, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	plaintext = apiTokenPrefix + secret
+	prefix = plaintext[:len(apiTokenPrefix)+apiTokenDisplayChars]
+
+	return plaintext, prefix, HashToken(plaintext), nil
+}
+
+// NormalizeScopes validates and de-duplicates requested scopes, returning them
+// in a stable order.
+func NormalizeScopes(requested []string) ([]string, error) {
+	wanted := make(map[string]bool, len(requested))
+	for _, scope := range requested {
+		wanted[strings.ToLower(strings.TrimSpace(scope))] = true
+	}
+
+	scopes := make([]string, 0, len(wanted))
+	for _, scope := range APITokenScopes {
+		if wanted[scope] {
+			scopes = append(scopes, scope)
+			delete(wanted, scope)
+		}
+	}
+
+	for scope := range wanted {
+		return nil, errors.New("unknown scope: " + scope)
+	}
+
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+
+	return scopes, nil
+}
+
+// TokenHasScope reports whether the token was granted the scope.
+func TokenHasScope(token *models.APIToken, scope string) bool {
+	for _, granted := range strings.Split(token.Scopes, ",") {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveAPIToken looks up an API token and returns claims for the user it acts as.
+func ResolveAPIToken(db *gorm.DB, plaintext string) (*models.APIToken, *Claims, error) {
+	if !strings.HasPrefix(plaintext, apiTokenPrefix) {
+		return nil, nil, ErrInvalidAPIToken
+	}
+
+	var token models.APIToken
+	if err := db.Where("token_hash = ? AND revoked_at IS NULL", HashToken(plaintext)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := db.Select("id", "username", "email").First(&user, token.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAPIToken
+		}
+		return nil, nil, err
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > sessionTouchInterval {
+		_ = db.Model(&token).Update("last_used_at", time.Now()).Error
+	}
+
+	claims := &Claims{
+		UserID:   user.ID,
+		Email:    user.Email,
+		Username: user.Username,
+	}
+
+	return &token, claims, nil
+}
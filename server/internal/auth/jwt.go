@@ -56,8 +56,9 @@ func ensureJWTConfig() error {
 	return jwtConfigErr
 }
 
-// GenerateJWT builds a signed JWT for the provided user.
-func GenerateJWT(user models.User) (string, time.Time, error) {
+// GenerateJWT builds a signed JWT for the provided user. A non-empty sessionID is
+// stored as the token's jti so the session can later be revoked.
+func GenerateJWT(user models.User, sessionID string) (string, time.Time, error) {
 	if err := ensureJWTConfig(); err != nil {
 		return "", time.Time{}, err
 	}
@@ -69,6 +70,7 @@ func GenerateJWT(user models.User) (string, time.Time, error) {
 		Email:    user.Email,
 		Username: user.Username,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
 			Subject:   strconv.FormatUint(uint64(user.ID), 10),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
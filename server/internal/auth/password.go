@@ -1,20 +1,139 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
 
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-var errEmptyPassword = errors.New("password cannot be empty")
+// Password hashing algorithms selectable with PASSWORD_HASH.
+const (
+	PasswordHashBcrypt   = "bcrypt"
+	PasswordHashArgon2id = "argon2id"
+)
+
+const (
+	argon2idPrefix = "$argon2id$"
+
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+var (
+	errEmptyPassword = errors.New("password cannot be empty")
+
+	// ErrPasswordMismatch is returned by ComparePassword when the password is wrong.
+	ErrPasswordMismatch = errors.New("password does not match")
+
+	// ErrUnknownPasswordHash is returned for stored hashes in an unrecognized format.
+	ErrUnknownPasswordHash = errors.New("unrecognized password hash format")
+)
+
+// PasswordHashing selects the algorithm and cost used for new password hashes.
+type PasswordHashing struct {
+	Algorithm  string
+	BcryptCost int
 
-// HashPassword hashes the provided plaintext password using bcrypt.
+	// Argon2id parameters; Memory is in KiB.
+	Argon2Memory      uint32
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+}
+
+// DefaultPasswordHashing returns bcrypt at its default cost.
+func DefaultPasswordHashing() PasswordHashing {
+	return PasswordHashing{
+		Algorithm:         PasswordHashBcrypt,
+		BcryptCost:        bcrypt.DefaultCost,
+		Argon2Memory:      defaultArgon2Memory,
+		Argon2Iterations:  defaultArgon2Iterations,
+		Argon2Parallelism: defaultArgon2Parallelism,
+	}
+}
+
+// PasswordHashingFromEnv reads PASSWORD_HASH, BCRYPT_COST, ARGON2_MEMORY_KB,
+// ARGON2_ITERATIONS and ARGON2_PARALLELISM. Invalid values are reported in the
+// error and replaced with their defaults, so the returned settings are always usable.
+func PasswordHashingFromEnv() (PasswordHashing, error) {
+	cfg := DefaultPasswordHashing()
+	var problems []string
+
+	if raw := strings.ToLower(strings.TrimSpace(os.Getenv("PASSWORD_HASH"))); raw != "" {
+		switch raw {
+		case PasswordHashBcrypt, PasswordHashArgon2id:
+			cfg.Algorithm = raw
+		default:
+			problems = append(problems, fmt.Sprintf("PASSWORD_HASH must be %q or %q", PasswordHashBcrypt, PasswordHashArgon2id))
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("BCRYPT_COST")); raw != "" {
+		cost, err := strconv.Atoi(raw)
+		if err != nil || cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+			problems = append(problems, fmt.Sprintf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+		} else {
+			cfg.BcryptCost = cost
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ARGON2_MEMORY_KB")); raw != "" {
+		memory, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || memory < 8*1024 {
+			problems = append(problems, "ARGON2_MEMORY_KB must be at least 8192")
+		} else {
+			cfg.Argon2Memory = uint32(memory)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ARGON2_ITERATIONS")); raw != "" {
+		iterations, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil || iterations < 1 {
+			problems = append(problems, "ARGON2_ITERATIONS must be at least 1")
+		} else {
+			cfg.Argon2Iterations = uint32(iterations)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ARGON2_PARALLELISM")); raw != "" {
+		parallelism, err := strconv.ParseUint(raw, 10, 8)
+		if err != nil || parallelism < 1 {
+			problems = append(problems, "ARGON2_PARALLELISM must be between 1 and 255")
+		} else {
+			cfg.Argon2Parallelism = uint8(parallelism)
+		}
+	}
+
+	if len(problems) > 0 {
+		return cfg, errors.New(strings.Join(problems, "; "))
+	}
+
+	return cfg, nil
+}
+
+// HashPassword hashes the provided plaintext password with the configured algorithm.
 func HashPassword(password string) (string, error) {
 	if password == "" {
 		return "", errEmptyPassword
 	}
 
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	cfg, _ := PasswordHashingFromEnv()
+
+	if cfg.Algorithm == PasswordHashArgon2id {
+		return hashArgon2id(password, cfg)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), cfg.BcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -22,7 +141,119 @@ func HashPassword(password string) (string, error) {
 	return string(hashed), nil
 }
 
-// ComparePassword compares a bcrypt hashed password with its possible plaintext equivalent.
+// ComparePassword checks a plaintext password against a stored bcrypt or Argon2id
+// hash, detecting the format from the hash itself.
 func ComparePassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		params, salt, key, err := decodeArgon2id(hashedPassword)
+		if err != nil {
+			return err
+		}
+
+		candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(candidate, key) != 1 {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+
+	if !isBcryptHash(hashedPassword) {
+		return ErrUnknownPasswordHash
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+// PasswordNeedsRehash reports whether a stored hash was made with a different
+// algorithm or cost than is configured now. Callers can rehash the password after
+// a successful login to upgrade it.
+func PasswordNeedsRehash(hashedPassword string) bool {
+	cfg, _ := PasswordHashingFromEnv()
+
+	if strings.HasPrefix(hashedPassword, argon2idPrefix) {
+		if cfg.Algorithm != PasswordHashArgon2id {
+			return true
+		}
+		params, _, _, err := decodeArgon2id(hashedPassword)
+		if err != nil {
+			return true
+		}
+		return params.memory != cfg.Argon2Memory ||
+			params.iterations != cfg.Argon2Iterations ||
+			params.parallelism != cfg.Argon2Parallelism
+	}
+
+	if cfg.Algorithm != PasswordHashBcrypt {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(hashedPassword))
+	return err != nil || cost != cfg.BcryptCost
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+// hashArgon2id encodes the hash in the standard PHC string format:
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+func hashArgon2id(password string, cfg PasswordHashing) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, cfg.Argon2Iterations, cfg.Argon2Memory, cfg.Argon2Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		cfg.Argon2Memory,
+		cfg.Argon2Iterations,
+		cfg.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(encoded string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownPasswordHash
+	}
+
+	return params, salt, key, nil
+}
+
+func isBcryptHash(hashedPassword string) bool {
+	return strings.HasPrefix(hashedPassword, "$2a$") ||
+		strings.HasPrefix(hashedPassword, "$2b$") ||
+		strings.HasPrefix(hashedPassword, "$2y$")
 }
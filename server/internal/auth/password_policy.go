@@ -0,0 +1,61 @@
+package auth
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultPasswordMinLength = 8
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = loadCommonPasswords(commonPasswordList)
+
+// PasswordMinLength returns the minimum password length, configurable via
+// PASSWORD_MIN_LENGTH (default 8).
+func PasswordMinLength() int {
+	if raw := strings.TrimSpace(os.Getenv("PASSWORD_MIN_LENGTH")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			return parsed
+		}
+	}
+
+	return defaultPasswordMinLength
+}
+
+// ValidatePassword checks a new password against the password policy and returns
+// an error describing the first rule it fails.
+func ValidatePassword(password string) error {
+	if password == "" {
+		return errEmptyPassword
+	}
+
+	minLength := PasswordMinLength()
+	if utf8.RuneCountInString(password) < minLength {
+		return fmt.Errorf("password must be at least %d characters long", minLength)
+	}
+
+	if commonPasswords[strings.ToLower(password)] {
+		return fmt.Errorf("password is too common; choose something harder to guess")
+	}
+
+	return nil
+}
+
+func loadCommonPasswords(list string) map[string]bool {
+	passwords := make(map[string]bool)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+		passwords[line] = true
+	}
+
+	return passwords
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fastHashing keeps hashing cheap in tests.
+func fastHashing(t *testing.T, algorithm string) {
+	t.Helper()
+	t.Setenv("PASSWORD_HASH", algorithm)
+	t.Setenv("BCRYPT_COST", "4")
+	t.Setenv("ARGON2_MEMORY_KB", "8192")
+	t.Setenv("ARGON2_ITERATIONS", "1")
+	t.Setenv("ARGON2_PARALLELISM", "1")
+}
+
+func TestHashAndComparePassword(t *testing.T) {
+	for _, algorithm := range []string{PasswordHashBcrypt, PasswordHashArgon2id} {
+		t.Run(algorithm, func(t *testing.T) {
+			fastHashing(t, algorithm)
+
+			hashed, err := HashPassword("correct horse")
+			if err != nil {
+				t.Fatalf("HashPassword: %v", err)
+			}
+			if algorithm == PasswordHashArgon2id && !strings.HasPrefix(hashed, "$argon2id$v=19$m=8192,t=1,p=1$") {
+				t.Fatalf("hash = %q, want a PHC argon2id string with the configured parameters", hashed)
+			}
+
+			if err := ComparePassword(hashed, "correct horse"); err != nil {
+				t.Fatalf("ComparePassword with the right password: %v", err)
+			}
+			if err := ComparePassword(hashed, "wrong horse"); !errors.Is(err, ErrPasswordMismatch) {
+				t.Fatalf("ComparePassword with the wrong password = %v, want ErrPasswordMismatch", err)
+			}
+		})
+	}
+}
+
+func TestHashPasswordRejectsEmpty(t *testing.T) {
+	if _, err := HashPassword(""); err == nil {
+		t.Fatal("HashPassword accepted an empty password")
+	}
+}
+
+func TestComparePasswordUnknownFormats(t *testing.T) {
+	for _, hashed := range []string{"", "plaintext", "$argon2id$v=19$broken", "$argon2id$v=18$m=8192,t=1,p=1$c2FsdA$a2V5", "$1$md5$hash"} {
+		if err := ComparePassword(hashed, "password"); !errors.Is(err, ErrUnknownPasswordHash) {
+			t.Errorf("ComparePassword(%q) = %v, want ErrUnknownPasswordHash", hashed, err)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	fastHashing(t, PasswordHashBcrypt)
+	bcryptHash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fastHashing(t, PasswordHashArgon2id)
+	argonHash, err := HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		hashed string
+		want   bool
+	}{
+		{name: "bcrypt unchanged", env: map[string]string{"PASSWORD_HASH": "bcrypt"}, hashed: bcryptHash, want: false},
+		{name: "bcrypt cost raised", env: map[string]string{"PASSWORD_HASH": "bcrypt", "BCRYPT_COST": "5"}, hashed: bcryptHash, want: true},
+		{name: "bcrypt to argon2id", env: map[string]string{"PASSWORD_HASH": "argon2id"}, hashed: bcryptHash, want: true},
+		{name: "argon2id unchanged", env: map[string]string{"PASSWORD_HASH": "argon2id"}, hashed: argonHash, want: false},
+		{name: "argon2id memory raised", env: map[string]string{"PASSWORD_HASH": "argon2id", "ARGON2_MEMORY_KB": "16384"}, hashed: argonHash, want: true},
+		{name: "argon2id to bcrypt", env: map[string]string{"PASSWORD_HASH": "bcrypt"}, hashed: argonHash, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fastHashing(t, PasswordHashBcrypt)
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+			if got := PasswordNeedsRehash(tt.hashed); got != tt.want {
+				t.Fatalf("PasswordNeedsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordHashingFromEnvReportsInvalidValues(t *testing.T) {
+	t.Setenv("PASSWORD_HASH", "md5")
+	t.Setenv("BCRYPT_COST", "99")
+	t.Setenv("ARGON2_MEMORY_KB", "1024")
+	t.Setenv("ARGON2_ITERATIONS", "0")
+	t.Setenv("ARGON2_PARALLELISM", "300")
+
+	cfg, err := PasswordHashingFromEnv()
+	if err == nil {
+		t.Fatal("PasswordHashingFromEnv accepted invalid settings")
+	}
+	for _, name := range []string{"PASSWORD_HASH", "BCRYPT_COST", "ARGON2_MEMORY_KB", "ARGON2_ITERATIONS", "ARGON2_PARALLELISM"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not mention %s", err, name)
+		}
+	}
+	if cfg != DefaultPasswordHashing() {
+		t.Fatalf("cfg = %+v, want the defaults", cfg)
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// sessionTouchInterval limits how often last_used_at is written for an active session.
+const sessionTouchInterval = time.Minute
+
+// ErrSessionRevoked is returned when a token belongs to a revoked or unknown session.
+var ErrSessionRevoked = errors.New("session has been revoked")
+
+// NewSessionID returns a random identifier to embed in a session's JWT.
+func NewSessionID() (string, error) {
+	return GenerateRandomToken(32)
+}
+
+// HashToken returns the SHA-256 hex digest stored in place of session IDs and API token secrets.
+func HashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateSession checks that the session behind the claims is still active and
+// records its use. Tokens issued without a session ID are accepted until they expire.
+func ValidateSession(db *gorm.DB, claims *Claims) error {
+	if claims == nil || claims.ID == "" {
+		return nil
+	}
+
+	var session models.Session
+	if err := db.Where("token_hash = ?", HashToken(claims.ID)).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionRevoked
+		}
+		return err
+	}
+
+	if session.RevokedAt != nil || session.UserID != claims.UserID {
+		return ErrSessionRevoked
+	}
+
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		_ = db.Model(&session).Update("last_used_at", time.Now()).Error
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew accepts codes from one period either side of now to allow for clock drift.
+	totpSkew = 1
+
+	totpSecretBytes = 20
+	backupCodeBytes = 5
+)
+
+var (
+	// ErrTwoFactorKeyMissing means no key is configured for encrypting TOTP secrets.
+	ErrTwoFactorKeyMissing = errors.New("two-factor encryption key is not configured")
+
+	errMalformedSecret = errors.New("malformed encrypted secret")
+
+	totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// GenerateTOTPSecret returns a new random base32 TOTP secret.
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPURL returns the otpauth:// URL authenticator apps read from a QR code.
+func TOTPURL(issuer, account, secret string) string {
+	label := url.PathEscape(issuer + ":" + account)
+
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+// ValidateTOTP checks a 6-digit code against the secret at the given time. On success
+// it returns the time step the code belongs to, so callers can refuse to accept the
+// same step twice.
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for offset := int64(-totpSkew); offset <= totpSkew; offset++ {
+		counter := current + offset
+		if hmac.Equal([]byte(totpCode(key, counter)), []byte(code)) {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// totpCode computes the RFC 6238 code for one time step.
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateBackupCodes returns n single-use recovery codes formatted as xxxx-xxxx.
+func GenerateBackupCodes(n int) ([]string, error) {
+	codes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		buf := make([]byte, backupCodeBytes)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+
+		encoded := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes = append(codes, encoded[:4]+"-"+encoded[4:])
+	}
+
+	return codes, nil
+}
+
+// NormalizeBackupCode lowercases a backup code and strips separators so it can be hashed.
+func NormalizeBackupCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// EncryptTwoFactorSecret seals a TOTP secret with AES-GCM for storage.
+func EncryptTwoFactorSecret(secret string) (string, error) {
+	gcm, err := twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), nil)
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptTwoFactorSecret opens a secret sealed by EncryptTwoFactorSecret.
+func DecryptTwoFactorSecret(encrypted string) (string, error) {
+	gcm, err := twoFactorCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return "", errMalformedSecret
+	}
+
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", errMalformedSecret
+	}
+
+	return string(plain), nil
+}
+
+// TwoFactorAvailable reports whether TOTP secrets can be encrypted.
+func TwoFactorAvailable() bool {
+	_, err := twoFactorKey()
+	return err == nil
+}
+
+// twoFactorKey derives the AES-256 key from TWO_FACTOR_ENCRYPTION_KEY, falling back
+// to JWT_SECRET so 2FA works without extra configuration. Changing whichever is in
+// use makes existing secrets unreadable.
+func twoFactorKey() ([]byte, error) {
+	material := strings.TrimSpace(os.Getenv("TWO_FACTOR_ENCRYPTION_KEY"))
+	if material == "" {
+		material = strings.TrimSpace(os.Getenv("JWT_SECRET"))
+	}
+	if material == "" {
+		return nil, ErrTwoFactorKeyMissing
+	}
+
+	key := sha256.Sum256([]byte("bafachat-2fa:" + material))
+	return key[:], nil
+}
+
+func twoFactorCipher() (cipher.AEAD, error) {
+	key, err := twoFactorKey()
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key from RFC 6238, base32 encoded.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; 6-digit codes are their last six digits.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+	}
+
+	for _, v := range vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0))
+		if !ok {
+			t.Errorf("code %s rejected at %d", v.code, v.unix)
+			continue
+		}
+		if want := v.unix / totpPeriod; step != want {
+			t.Errorf("step = %d at %d, want %d", step, v.unix, want)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	// 287082 belongs to step 1 (30s to 59s).
+	tests := []struct {
+		name   string
+		secret string
+		unix   int64
+		code   string
+		want   bool
+	}{
+		{name: "one step early", unix: 59 - totpPeriod, code: "287082", want: true},
+		{name: "one step late", unix: 59 + totpPeriod, code: "287082", want: true},
+		{name: "two steps late", unix: 59 + 2*totpPeriod, code: "287082", want: false},
+		{name: "surrounding spaces", unix: 59, code: " 287082 ", want: true},
+		{name: "lowercase secret", secret: "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", unix: 59, code: "287082", want: true},
+		{name: "wrong code", unix: 59, code: "123456", want: false},
+		{name: "too short", unix: 59, code: "28708", want: false},
+		{name: "too long", unix: 59, code: "2870820", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secret := tt.secret
+			if secret == "" {
+				secret = rfc6238Secret
+			}
+			if _, ok := ValidateTOTP(secret, tt.code, time.Unix(tt.unix, 0)); ok != tt.want {
+				t.Fatalf("ValidateTOTP(%q) at %d = %v, want %v", tt.code, tt.unix, ok, tt.want)
+			}
+		})
+	}
+
+	if _, ok := ValidateTOTP("not base32!", "287082", time.Unix(59, 0)); ok {
+		t.Fatal("ValidateTOTP accepted a malformed secret")
+	}
+}
+
+func TestGenerateTOTPSecretValidatesItsOwnCodes(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != totpSecretBytes {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want %d", secret, len(key), err, totpSecretBytes)
+	}
+
+	now := time.Now()
+	if _, ok := ValidateTOTP(secret, totpCode(key, now.Unix()/totpPeriod), now); !ok {
+		t.Fatal("current code rejected")
+	}
+}
+
+func TestTOTPURL(t *testing.T) {
+	parsed, err := url.Parse(TOTPURL("BafaChat", "ada@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/BafaChat:ada@example.com" {
+		t.Fatalf("URL = %s, want otpauth://totp/BafaChat:ada@example.com", parsed)
+	}
+	query := parsed.Query()
+	for key, want := range map[string]string{"secret": rfc6238Secret, "issuer": "BafaChat", "digits": "6", "period": "30", "algorithm": "SHA1"} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestBackupCodes(t *testing.T) {
+	codes, err := GenerateBackupCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+
+	format := regexp.MustCompile(`^[a-z2-7]{4}-[a-z2-7]{4}$`)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if !format.MatchString(code) {
+			t.Fatalf("code %q is not formatted as xxxx-xxxx", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+
+	if got := NormalizeBackupCode(" ABCD-efgh "); got != "abcdefgh" {
+		t.Fatalf("NormalizeBackupCode = %q, want %q", got, "abcdefgh")
+	}
+	if got := NormalizeBackupCode("abcd efgh"); got != "abcdefgh" {
+		t.Fatalf("NormalizeBackupCode = %q, want %q", got, "abcdefgh")
+	}
+}
+
+func TestTwoFactorSecretEncryption(t *testing.T) {
+	t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "")
+	t.Setenv("JWT_SECRET", "")
+	if TwoFactorAvailable() {
+		t.Fatal("TwoFactorAvailable without a key")
+	}
+	if _, err := EncryptTwoFactorSecret(rfc6238Secret); !errors.Is(err, ErrTwoFactorKeyMissing) {
+		t.Fatalf("EncryptTwoFactorSecret = %v, want ErrTwoFactorKeyMissing", err)
+	}
+
+	// JWT_SECRET is the fallback key.
+	t.Setenv("JWT_SECRET", "jwt-secret")
+	sealed, err := EncryptTwoFactorSecret(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sealed == rfc6238Secret {
+		t.Fatal("secret stored in the clear")
+	}
+	if opened, err := DecryptTwoFactorSecret(sealed); err != nil || opened != rfc6238Secret {
+		t.Fatalf("DecryptTwoFactorSecret = %q, %v; want the original secret", opened, err)
+	}
+
+	// A different key cannot open it, and tampering is detected.
+	t.Setenv("TWO_FACTOR_ENCRYPTION_KEY", "another-key")
+	if _, err := DecryptTwoFactorSecret(sealed); err == nil {
+		t.Fatal("secret opened with the wrong key")
+	}
+	if _, err := DecryptTwoFactorSecret("bm90IHNlYWxlZA=="); err == nil {
+		t.Fatal("DecryptTwoFactorSecret accepted data it did not seal")
+	}
+}
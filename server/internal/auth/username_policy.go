@@ -0,0 +1,42 @@
+package auth
+
+import (
+	_ "embed"
+	"os"
+	"strings"
+)
+
+//go:embed reserved_usernames.txt
+var reservedUsernameList string
+
+var reservedUsernames = loadReservedUsernames(reservedUsernameList)
+
+// IsReservedUsername reports whether username is reserved for staff, system
+// accounts or mention keywords such as @everyone and @here. The comparison is
+// case-insensitive. RESERVED_USERNAMES, a comma-separated list, replaces the
+// built-in list when set.
+func IsReservedUsername(username string) bool {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if username == "" {
+		return false
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("RESERVED_USERNAMES")); raw != "" {
+		return loadReservedUsernames(strings.ReplaceAll(raw, ",", "\n"))[username]
+	}
+
+	return reservedUsernames[username]
+}
+
+func loadReservedUsernames(list string) map[string]bool {
+	names := make(map[string]bool)
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.ToLower(strings.TrimSpace(line))
+		if line == "" {
+			continue
+		}
+		names[line] = true
+	}
+
+	return names
+}
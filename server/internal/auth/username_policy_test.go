@@ -0,0 +1,30 @@
+package auth
+
+import "testing"
+
+func TestIsReservedUsername(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		username string
+		want     bool
+	}{
+		{name: "built-in", username: "admin", want: true},
+		{name: "case and space insensitive", username: "  EveryOne ", want: true},
+		{name: "mention keyword", username: "here", want: true},
+		{name: "ordinary name", username: "ada", want: false},
+		{name: "reserved name as prefix only", username: "admin2", want: false},
+		{name: "empty", username: "  ", want: false},
+		{name: "override adds a name", override: "Ops, staff ", username: "ops", want: true},
+		{name: "override replaces the built-in list", override: "ops", username: "admin", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RESERVED_USERNAMES", tt.override)
+			if got := IsReservedUsername(tt.username); got != tt.want {
+				t.Fatalf("IsReservedUsername(%q) = %v, want %v", tt.username, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package avatars
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+const (
+	// identiconGrid is the number of cells along each side of an identicon.
+	identiconGrid = 5
+)
+
+var identiconBackground = color.RGBA{R: 0xf1, G: 0xf5, B: 0xf9, A: 0xff}
+
+// Identicon renders a symmetric 5x5 pattern derived from seed as a PNG of the
+// given size. The same seed always produces the same image.
+func Identicon(seed string, size int) ([]byte, error) {
+	if size <= 0 {
+		size = AvatarSize
+	}
+
+	sum := sha256.Sum256([]byte(seed))
+
+	// The first two bytes pick the hue; the rest decide which cells are filled.
+	hue := float64(int(sum[0])<<8|int(sum[1])) / 65536 * 360
+	foreground := hslToRGB(hue, 0.55, 0.55)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: identiconBackground}, image.Point{}, draw.Src)
+
+	cell := size / (identiconGrid + 1)
+	offset := (size - cell*identiconGrid) / 2
+
+	half := (identiconGrid + 1) / 2
+	for row := 0; row < identiconGrid; row++ {
+		for col := 0; col < half; col++ {
+			if sum[2+row*half+col]%2 == 0 {
+				continue
+			}
+
+			for _, x := range []int{col, identiconGrid - 1 - col} {
+				rect := image.Rect(offset+x*cell, offset+row*cell, offset+(x+1)*cell, offset+(row+1)*cell)
+				draw.Draw(img, rect, &image.Uniform{C: foreground}, image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func hslToRGB(hue, saturation, lightness float64) color.RGBA {
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - chroma/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = chroma, x, 0
+	case hue < 120:
+		r, g, b = x, chroma, 0
+	case hue < 180:
+		r, g, b = 0, chroma, x
+	case hue < 240:
+		r, g, b = 0, x, chroma
+	case hue < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 0xff,
+	}
+}
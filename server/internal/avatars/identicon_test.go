@@ -0,0 +1,100 @@
+package avatars
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestIdenticonIsDeterministic(t *testing.T) {
+	first, err := Identicon("user:42", 64)
+	if err != nil {
+		t.Fatalf("Identicon: %v", err)
+	}
+	second, err := Identicon("user:42", 64)
+	if err != nil {
+		t.Fatalf("Identicon: %v", err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("Identicon returned different images for the same seed")
+	}
+
+	other, err := Identicon("user:43", 64)
+	if err != nil {
+		t.Fatalf("Identicon: %v", err)
+	}
+	if bytes.Equal(first, other) {
+		t.Fatal("Identicon returned the same image for different seeds")
+	}
+}
+
+func TestIdenticonSizeAndSymmetry(t *testing.T) {
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		{name: "explicit size", size: 96, want: 96},
+		{name: "default size", size: 0, want: AvatarSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := Identicon("server:7", tt.size)
+			if err != nil {
+				t.Fatalf("Identicon: %v", err)
+			}
+
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("decode png: %v", err)
+			}
+			bounds := img.Bounds()
+			if bounds.Dx() != tt.want || bounds.Dy() != tt.want {
+				t.Fatalf("size = %dx%d, want %dx%d", bounds.Dx(), bounds.Dy(), tt.want, tt.want)
+			}
+
+			cell := tt.want / (identiconGrid + 1)
+			offset := (tt.want - cell*identiconGrid) / 2
+			for row := 0; row < identiconGrid; row++ {
+				for col := 0; col < identiconGrid/2; col++ {
+					left := cellColor(img, offset, cell, row, col)
+					right := cellColor(img, offset, cell, row, identiconGrid-1-col)
+					if left != right {
+						t.Fatalf("cell (%d,%d) = %v, mirror = %v", row, col, left, right)
+					}
+				}
+			}
+
+			if got := color.RGBAModel.Convert(img.At(0, 0)); got != identiconBackground {
+				t.Fatalf("corner = %v, want background %v", got, identiconBackground)
+			}
+		})
+	}
+}
+
+func cellColor(img image.Image, offset, cell, row, col int) color.Color {
+	return color.RGBAModel.Convert(img.At(offset+col*cell+cell/2, offset+row*cell+cell/2))
+}
+
+func TestHSLToRGB(t *testing.T) {
+	tests := []struct {
+		name string
+		hue  float64
+		want color.RGBA
+	}{
+		{name: "red", hue: 0, want: color.RGBA{R: 0xff, A: 0xff}},
+		{name: "green", hue: 120, want: color.RGBA{G: 0xff, A: 0xff}},
+		{name: "blue", hue: 240, want: color.RGBA{B: 0xff, A: 0xff}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hslToRGB(tt.hue, 1, 0.5); got != tt.want {
+				t.Fatalf("hslToRGB(%v, 1, 0.5) = %v, want %v", tt.hue, got, tt.want)
+			}
+		})
+	}
+}
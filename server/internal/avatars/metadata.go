@@ -0,0 +1,74 @@
+package avatars
+
+import (
+	"bytes"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+const (
+	// MaxMetadataStripSize bounds the images re-encoded in memory to strip metadata.
+	MaxMetadataStripSize = 32 * 1024 * 1024
+	// metadataStripJPEGQuality keeps re-encoded originals visually lossless.
+	metadataStripJPEGQuality = 92
+)
+
+// MetadataStrippingEnabled reports whether uploaded JPEG/PNG originals should be
+// re-encoded to drop EXIF and other metadata. Controlled by STRIP_IMAGE_METADATA
+// (default true).
+func MetadataStrippingEnabled() bool {
+	raw := strings.TrimSpace(os.Getenv("STRIP_IMAGE_METADATA"))
+	if raw == "" {
+		return true
+	}
+
+	enabled, err := strconv.ParseBool(raw)
+	if err != nil {
+		return true
+	}
+
+	return enabled
+}
+
+// CanStripMetadata reports whether StripMetadata supports the content type.
+// Animated formats such as GIF and WebP are passed through unchanged because
+// re-encoding would drop every frame after the first.
+func CanStripMetadata(contentType string) bool {
+	switch strings.ToLower(strings.TrimSpace(contentType)) {
+	case "image/jpeg", "image/jpg", "image/png":
+		return true
+	default:
+		return false
+	}
+}
+
+// StripMetadata re-encodes a JPEG or PNG image without its metadata. The EXIF
+// orientation is applied to the pixels first so the image still displays upright.
+func StripMetadata(data []byte, contentType string) ([]byte, error) {
+	if !CanStripMetadata(contentType) {
+		return nil, fmt.Errorf("unsupported image type %q", contentType)
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if strings.Contains(strings.ToLower(contentType), "png") {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: metadataStripJPEGQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
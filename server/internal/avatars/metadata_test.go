@@ -0,0 +1,157 @@
+package avatars
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func TestMetadataStrippingEnabled(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "unset", value: "", want: true},
+		{name: "true", value: "true", want: true},
+		{name: "false", value: "false", want: false},
+		{name: "zero", value: "0", want: false},
+		{name: "invalid keeps default", value: "sometimes", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STRIP_IMAGE_METADATA", tt.value)
+			if got := MetadataStrippingEnabled(); got != tt.want {
+				t.Fatalf("MetadataStrippingEnabled() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanStripMetadata(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{contentType: "image/jpeg", want: true},
+		{contentType: "image/jpg", want: true},
+		{contentType: " IMAGE/PNG ", want: true},
+		{contentType: "image/gif", want: false},
+		{contentType: "image/webp", want: false},
+		{contentType: "application/pdf", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := CanStripMetadata(tt.contentType); got != tt.want {
+				t.Fatalf("CanStripMetadata(%q) = %v, want %v", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripMetadataRemovesJPEGExif(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, testImage(), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	original := withExifSegment(encoded.Bytes())
+	if !bytes.Contains(original, []byte("Exif\x00\x00")) {
+		t.Fatal("test image has no EXIF segment")
+	}
+
+	stripped, err := StripMetadata(original, "image/jpeg")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+
+	if bytes.Contains(stripped, []byte("Exif\x00\x00")) {
+		t.Fatal("stripped JPEG still has an EXIF segment")
+	}
+	assertSameBounds(t, stripped)
+}
+
+func TestStripMetadataRemovesPNGTextChunks(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, testImage()); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	original := withTextChunk(encoded.Bytes(), "Comment", "taken at home")
+
+	stripped, err := StripMetadata(original, "image/png")
+	if err != nil {
+		t.Fatalf("StripMetadata: %v", err)
+	}
+
+	if bytes.Contains(stripped, []byte("taken at home")) {
+		t.Fatal("stripped PNG still has its text chunk")
+	}
+	assertSameBounds(t, stripped)
+}
+
+func TestStripMetadataRejectsUnsupportedTypes(t *testing.T) {
+	if _, err := StripMetadata([]byte("GIF89a"), "image/gif"); err == nil {
+		t.Fatal("StripMetadata accepted a GIF")
+	}
+	if _, err := StripMetadata([]byte("not an image"), "image/png"); err == nil {
+		t.Fatal("StripMetadata accepted bytes that are not an image")
+	}
+}
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 60), G: uint8(y * 80), B: 120, A: 255})
+		}
+	}
+	return img
+}
+
+func assertSameBounds(t *testing.T, data []byte) {
+	t.Helper()
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode stripped image: %v", err)
+	}
+	if config.Width != 4 || config.Height != 3 {
+		t.Fatalf("stripped image is %dx%d, want 4x3", config.Width, config.Height)
+	}
+}
+
+// withExifSegment inserts an APP1 segment holding an empty little-endian TIFF
+// directory straight after the JPEG's SOI marker.
+func withExifSegment(jpegData []byte) []byte {
+	payload := append([]byte("Exif\x00\x00"), "II*\x00\x08\x00\x00\x00\x00\x00"...)
+
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, jpegData[:2]...)
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+// withTextChunk inserts a tEXt chunk straight after the PNG's IHDR chunk.
+func withTextChunk(pngData []byte, keyword, text string) []byte {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+
+	data := append([]byte(keyword+"\x00"), text...)
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], "tEXt")
+	chunk = append(chunk, data...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := append([]byte{}, pngData[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, pngData[ihdrEnd:]...)
+}
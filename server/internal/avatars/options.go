@@ -0,0 +1,122 @@
+package avatars
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FormatAuto keeps PNG output for PNG sources and uses JPEG for everything else.
+	FormatAuto = "auto"
+	// FormatWebP encodes static avatars as WebP when cwebp is installed.
+	FormatWebP = "webp"
+
+	maxAvatarSize = 1024
+)
+
+// Options controls the size and encoding of processed avatars.
+type Options struct {
+	Size        int
+	JPEGQuality int
+	Format      string
+	// AllowWebP lets handlers switch Format to WebP for clients that accept it.
+	AllowWebP bool
+}
+
+// DefaultOptions returns the historical 128px JPEG/PNG behaviour.
+func DefaultOptions() Options {
+	return Options{
+		Size:        AvatarSize,
+		JPEGQuality: JPEGQuality,
+		Format:      FormatAuto,
+	}
+}
+
+// OptionsFromEnv reads AVATAR_SIZE, AVATAR_JPEG_QUALITY and AVATAR_WEBP, falling
+// back to DefaultOptions for missing or invalid values.
+func OptionsFromEnv() Options {
+	opts := DefaultOptions()
+
+	if raw := strings.TrimSpace(os.Getenv("AVATAR_SIZE")); raw != "" {
+		if size, err := strconv.Atoi(raw); err == nil && size > 0 && size <= maxAvatarSize {
+			opts.Size = size
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("AVATAR_JPEG_QUALITY")); raw != "" {
+		if quality, err := strconv.Atoi(raw); err == nil && quality >= 1 && quality <= 100 {
+			opts.JPEGQuality = quality
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("AVATAR_WEBP")); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err == nil {
+			opts.AllowWebP = enabled
+		}
+	}
+
+	return opts
+}
+
+// ForAccept switches the output format to WebP when it is enabled and the
+// client's Accept header lists image/webp.
+func (o Options) ForAccept(accept string) Options {
+	if o.AllowWebP && strings.Contains(strings.ToLower(accept), "image/webp") {
+		o.Format = FormatWebP
+	}
+	return o
+}
+
+func (o Options) normalized() Options {
+	defaults := DefaultOptions()
+	if o.Size <= 0 {
+		o.Size = defaults.Size
+	}
+	if o.JPEGQuality <= 0 || o.JPEGQuality > 100 {
+		o.JPEGQuality = defaults.JPEGQuality
+	}
+	if o.Format == "" {
+		o.Format = defaults.Format
+	}
+	return o
+}
+
+// encodeWebP converts an image to WebP using the cwebp tool from libwebp, since
+// the imaging pipeline can only decode the format.
+func encodeWebP(img image.Image, quality int) ([]byte, error) {
+	cwebp, err := exec.LookPath("cwebp")
+	if err != nil {
+		return nil, fmt.Errorf("cwebp is not installed")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "bafachat-avatar-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var source bytes.Buffer
+	if err := png.Encode(&source, img); err != nil {
+		return nil, fmt.Errorf("encode source png: %w", err)
+	}
+
+	inputPath := filepath.Join(tmpDir, "avatar.png")
+	outputPath := filepath.Join(tmpDir, "avatar.webp")
+	if err := os.WriteFile(inputPath, source.Bytes(), 0o600); err != nil {
+		return nil, fmt.Errorf("write temp png: %w", err)
+	}
+
+	cmd := exec.Command(cwebp, "-quiet", "-q", strconv.Itoa(quality), inputPath, "-o", outputPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("cwebp failed: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	return os.ReadFile(outputPath)
+}
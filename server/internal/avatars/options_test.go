@@ -0,0 +1,96 @@
+package avatars
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func TestOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    string
+		quality string
+		webp    string
+		want    Options
+	}{
+		{name: "defaults", want: DefaultOptions()},
+		{name: "overrides", size: "256", quality: "75", webp: "true", want: Options{Size: 256, JPEGQuality: 75, Format: FormatAuto, AllowWebP: true}},
+		{name: "size above limit", size: "4096", want: DefaultOptions()},
+		{name: "quality out of range", quality: "0", want: DefaultOptions()},
+		{name: "invalid values", size: "big", quality: "high", webp: "maybe", want: DefaultOptions()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AVATAR_SIZE", tt.size)
+			t.Setenv("AVATAR_JPEG_QUALITY", tt.quality)
+			t.Setenv("AVATAR_WEBP", tt.webp)
+
+			if got := OptionsFromEnv(); got != tt.want {
+				t.Fatalf("OptionsFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOptionsForAccept(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowWebP bool
+		accept    string
+		want      string
+	}{
+		{name: "webp accepted", allowWebP: true, accept: "image/avif,image/webp,*/*", want: FormatWebP},
+		{name: "webp not accepted", allowWebP: true, accept: "image/png,*/*", want: FormatAuto},
+		{name: "webp disabled", allowWebP: false, accept: "image/webp", want: FormatAuto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.AllowWebP = tt.allowWebP
+			if got := opts.ForAccept(tt.accept).Format; got != tt.want {
+				t.Fatalf("ForAccept(%q).Format = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessAvatarWithOptionsSize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	for x := 0; x < 300; x++ {
+		for y := 0; y < 200; y++ {
+			src.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 0x80, A: 0xff})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("encode source: %v", err)
+	}
+
+	output, contentType, err := ProcessAvatarWithOptions(bytes.NewReader(buf.Bytes()), "image/png", nil, Options{Size: 64})
+	if err != nil {
+		t.Fatalf("ProcessAvatarWithOptions: %v", err)
+	}
+	if contentType != "image/png" {
+		t.Fatalf("content type = %q, want %q", contentType, "image/png")
+	}
+
+	img, err := png.Decode(bytes.NewReader(output))
+	if err != nil {
+		t.Fatalf("decode output: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 64 || bounds.Dy() != 64 {
+		t.Fatalf("output size = %dx%d, want 64x64", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func TestOptionsNormalized(t *testing.T) {
+	got := Options{JPEGQuality: 150}.normalized()
+	if got.Size != AvatarSize || got.JPEGQuality != JPEGQuality || got.Format != FormatAuto {
+		t.Fatalf("normalized() = %+v, want defaults", got)
+	}
+}
@@ -5,18 +5,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
+	"image/draw"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
 	"io"
+	"log/slog"
+	"slices"
 	"strings"
 
 	"github.com/disintegration/imaging"
 )
 
 const (
-	// AvatarSize is the standard size for avatar thumbnails
+	// AvatarSize is the default size for avatar thumbnails
 	AvatarSize = 128
-	// JPEGQuality is the quality setting for JPEG compression
+	// JPEGQuality is the default quality setting for JPEG and WebP compression
 	JPEGQuality = 90
 )
 
@@ -30,13 +34,68 @@ type CropData struct {
 }
 
 // ProcessAvatar processes an image by cropping and resizing it to create an avatar thumbnail
+// using DefaultOptions.
 func ProcessAvatar(reader io.Reader, contentType string, cropData *CropData) ([]byte, string, error) {
+	return ProcessAvatarWithOptions(reader, contentType, cropData, DefaultOptions())
+}
+
+// ProcessAvatarWithOptions crops and resizes an image to opts.Size. Animated GIFs keep
+// their animation; every other image becomes a single JPEG, PNG or WebP frame.
+func ProcessAvatarWithOptions(reader io.Reader, contentType string, cropData *CropData, opts Options) ([]byte, string, error) {
+	opts = opts.normalized()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read image: %w", err)
+	}
+
+	if strings.EqualFold(strings.TrimSpace(contentType), "image/gif") {
+		if anim, err := gif.DecodeAll(bytes.NewReader(data)); err == nil && len(anim.Image) > 1 {
+			output, err := processAnimatedGIF(anim, cropData, opts.Size)
+			if err != nil {
+				return nil, "", err
+			}
+			return output, "image/gif", nil
+		}
+	}
+
 	// Decode the image
-	img, format, err := image.Decode(reader)
+	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to decode image: %w", err)
 	}
 
+	img = transformAvatar(img, cropData, opts.Size)
+
+	if opts.Format == FormatWebP {
+		output, err := encodeWebP(img, opts.JPEGQuality)
+		if err == nil {
+			return output, "image/webp", nil
+		}
+		slog.Warn("avatars: falling back from webp output", "error", err)
+	}
+
+	// Encode the processed image
+	var buf bytes.Buffer
+	outputContentType := "image/jpeg"
+
+	// Use PNG for images with transparency
+	if format == "png" {
+		outputContentType = "image/png"
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.JPEGQuality})
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	return buf.Bytes(), outputContentType, nil
+}
+
+// transformAvatar applies the optional crop and then fills a size x size square.
+func transformAvatar(img image.Image, cropData *CropData, size int) image.Image {
 	// If crop data is provided, crop the image first
 	if cropData != nil && cropData.Width > 0 && cropData.Height > 0 {
 		bounds := img.Bounds()
@@ -75,25 +134,84 @@ func ProcessAvatar(reader io.Reader, contentType string, cropData *CropData) ([]
 	}
 
 	// Resize to avatar size while maintaining aspect ratio
-	img = imaging.Fill(img, AvatarSize, AvatarSize, imaging.Center, imaging.Lanczos)
+	return imaging.Fill(img, size, size, imaging.Center, imaging.Lanczos)
+}
 
-	// Encode the processed image
-	var buf bytes.Buffer
-	outputContentType := "image/jpeg"
+// processAnimatedGIF crops and resizes every frame of an animated GIF.
+// Frames are composited onto a full-size canvas first, honouring each frame's
+// disposal method, so partial frames still render correctly once resized.
+func processAnimatedGIF(anim *gif.GIF, cropData *CropData, size int) ([]byte, error) {
+	canvasBounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	if canvasBounds.Empty() {
+		for _, frame := range anim.Image {
+			canvasBounds = canvasBounds.Union(frame.Bounds())
+		}
+	}
 
-	// Use PNG for images with transparency
-	if format == "png" {
-		outputContentType = "image/png"
-		err = png.Encode(&buf, img)
-	} else {
-		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: JPEGQuality})
+	canvas := image.NewRGBA(canvasBounds)
+	output := &gif.GIF{
+		Image:     make([]*image.Paletted, 0, len(anim.Image)),
+		Delay:     make([]int, 0, len(anim.Image)),
+		Disposal:  make([]byte, 0, len(anim.Image)),
+		LoopCount: anim.LoopCount,
 	}
 
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to encode image: %w", err)
+	for index, frame := range anim.Image {
+		var disposal byte
+		if index < len(anim.Disposal) {
+			disposal = anim.Disposal[index]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvasBounds)
+			draw.Draw(previous, canvasBounds, canvas, canvasBounds.Min, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		transformed := transformAvatar(canvas, cropData, size)
+		paletted := image.NewPaletted(transformed.Bounds(), frame.Palette)
+		draw.FloydSteinberg.Draw(paletted, paletted.Bounds(), transformed, transformed.Bounds().Min)
+
+		delay := 0
+		if index < len(anim.Delay) {
+			delay = anim.Delay[index]
+		}
+
+		output.Image = append(output.Image, paletted)
+		output.Delay = append(output.Delay, delay)
+		// Each output frame is a full composite, so nothing needs disposing.
+		output.Disposal = append(output.Disposal, gif.DisposalNone)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
 	}
 
-	return buf.Bytes(), outputContentType, nil
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, output); err != nil {
+		return nil, fmt.Errorf("failed to encode animated gif: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// ThumbnailExtension returns the file extension for a processed avatar's content type.
+func ThumbnailExtension(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	default:
+		return ".jpg"
+	}
 }
 
 // SerializeCropData converts CropData to a JSON string for storage
@@ -124,12 +242,10 @@ func DeserializeCropData(jsonStr string) (*CropData, error) {
 	return &data, nil
 }
 
+// ImageTypes lists the content types accepted for avatars and server icons.
+var ImageTypes = []string{"image/jpeg", "image/jpg", "image/png", "image/gif", "image/webp"}
+
 // IsValidImageType checks if the content type is a supported image format
 func IsValidImageType(contentType string) bool {
-	contentType = strings.ToLower(strings.TrimSpace(contentType))
-	return contentType == "image/jpeg" ||
-		contentType == "image/jpg" ||
-		contentType == "image/png" ||
-		contentType == "image/gif" ||
-		contentType == "image/webp"
+	return slices.Contains(ImageTypes, strings.ToLower(strings.TrimSpace(contentType)))
 }
@@ -2,7 +2,7 @@ package database
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"net/url"
 	"os"
 	"strings"
@@ -27,11 +27,13 @@ func GetDB() *gorm.DB {
 		var err error
 		dbInstance, err = connect()
 		if err != nil {
-			log.Fatalf("failed to connect to database: %v", err)
+			slog.Error("failed to connect to database", "error", err)
+			os.Exit(1)
 		}
 
 		if err := autoMigrate(dbInstance); err != nil {
-			log.Fatalf("failed to run database migrations: %v", err)
+			slog.Error("failed to run database migrations", "error", err)
+			os.Exit(1)
 		}
 	})
 
@@ -98,16 +100,79 @@ func connect() (*gorm.DB, error) {
 	return db, nil
 }
 
+// Migrate brings the schema of db up to date. GetDB runs it on startup; tests use
+// it to prepare a scratch schema.
+func Migrate(db *gorm.DB) error {
+	return autoMigrate(db)
+}
+
 func autoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	// Servers created before storage accounting need their usage counted once.
+	backfillStorage := !db.Migrator().HasColumn(&models.Server{}, "StorageUsedBytes")
+
+	if err := db.AutoMigrate(
 		&models.User{},
 		&models.Server{},
 		&models.ServerMember{},
 		&models.Channel{},
+		&models.ChannelMember{},
+		&models.ChannelCategory{},
 		&models.Message{},
 		&models.MessageAttachment{},
+		&models.UploadIntent{},
+		&models.MessageMention{},
+		&models.CustomEmoji{},
+		&models.MessageEmoji{},
+		&models.LinkPreview{},
 		&models.ServerInvite{},
-	)
+		&models.ServerBan{},
+		&models.ServerWordFilter{},
+		&models.ChannelRead{},
+		&models.NSFWAcknowledgment{},
+		&models.Session{},
+		&models.TwoFactorBackupCode{},
+		&models.TwoFactorChallenge{},
+		&models.OAuthIdentity{},
+		&models.DataExport{},
+		&models.APIToken{},
+		&models.ChannelWebhook{},
+		&models.PushSubscription{},
+		&models.NotificationPreference{},
+		&models.DNDSchedule{},
+	); err != nil {
+		return err
+	}
+
+	if backfillStorage {
+		if err := RecomputeServerStorage(db); err != nil {
+			return fmt.Errorf("backfill server storage usage: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// RecomputeServerStorage sets each server's storage_used_bytes to the total size
+// of the objects stored for attachments in its channels, counting an object shared
+// by several attachments once. With no IDs, every server is recomputed. Handlers
+// keep the counter current as attachments come and go; this repairs it.
+func RecomputeServerStorage(db *gorm.DB, serverIDs ...uint) error {
+	objects := db.Table("message_attachments").
+		Select("DISTINCT message_attachments.object_key, message_attachments.file_size").
+		Joins("JOIN messages ON messages.id = message_attachments.message_id").
+		Joins("JOIN channels ON channels.id = messages.channel_id").
+		Where("channels.server_id = servers.id")
+	usage := db.Table("(?) AS stored_objects", objects).
+		Select("COALESCE(SUM(stored_objects.file_size), 0)")
+
+	query := db.Model(&models.Server{})
+	if len(serverIDs) > 0 {
+		query = query.Where("id IN ?", serverIDs)
+	} else {
+		query = query.Where("1 = 1")
+	}
+
+	return query.UpdateColumn("storage_used_bytes", gorm.Expr("(?)", usage)).Error
 }
 
 func getEnv(key, fallback string) string {
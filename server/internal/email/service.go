@@ -14,6 +14,13 @@ import (
 
 const defaultBaseURL = "https://api.postmarkapp.com"
 
+// Aliases of the Postmark templates the app sends. The templates are managed in
+// Postmark; docs/email-templates.md lists the model each one receives.
+const (
+	TemplateEmailVerification = "email-verification"
+	TemplateServerInvite      = "server-invite"
+)
+
 // Service provides helpers for sending transactional email via Postmark.
 type Service struct {
 	httpClient    *http.Client
@@ -56,6 +63,41 @@ type SendTemplateInput struct {
 	MessageStream string
 }
 
+// Postmark API error codes that mean the recipient will never accept mail.
+const (
+	postmarkErrorInvalidRequest    = 300
+	postmarkErrorInactiveRecipient = 406
+)
+
+// APIError is an error response from the Postmark API.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	ErrorCode  int    `json:"ErrorCode"`
+	Message    string `json:"Message"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("postmark error (%d): %s", e.ErrorCode, e.Message)
+}
+
+// Permanent reports whether sending the same message again cannot succeed. Postmark
+// rate limits and server errors are transient; every other rejection, such as a hard
+// bounced or suppressed recipient, an invalid address or a bad server token, is not.
+func (e *APIError) Permanent() bool {
+	if e.ErrorCode == postmarkErrorInactiveRecipient || e.ErrorCode == postmarkErrorInvalidRequest {
+		return true
+	}
+
+	return e.StatusCode < http.StatusInternalServerError && e.StatusCode != http.StatusTooManyRequests
+}
+
+// IsPermanent reports whether err is a Postmark rejection that retrying will not fix.
+// Network errors and timeouts are treated as transient.
+func IsPermanent(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.Permanent()
+}
+
 // NewServiceFromEnv builds a Service using environment variables.
 func NewServiceFromEnv() (*Service, error) {
 	cfg := Config{
@@ -177,16 +219,12 @@ func (s *Service) send(ctx context.Context, path string, payload map[string]any)
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		var apiErr struct {
-			ErrorCode int    `json:"ErrorCode"`
-			Message   string `json:"Message"`
-		}
-
-		if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
-			return fmt.Errorf("postmark request failed with status %d", resp.StatusCode)
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(apiErr); err != nil {
+			apiErr.Message = fmt.Sprintf("request failed with status %d", resp.StatusCode)
 		}
 
-		return fmt.Errorf("postmark error (%d): %s", apiErr.ErrorCode, apiErr.Message)
+		return apiErr
 	}
 
 	return nil
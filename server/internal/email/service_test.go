@@ -0,0 +1,213 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIErrorPermanent(t *testing.T) {
+	tests := []struct {
+		name string
+		err  APIError
+		want bool
+	}{
+		{name: "inactive recipient", err: APIError{StatusCode: http.StatusUnprocessableEntity, ErrorCode: postmarkErrorInactiveRecipient}, want: true},
+		{name: "invalid request", err: APIError{StatusCode: http.StatusUnprocessableEntity, ErrorCode: postmarkErrorInvalidRequest}, want: true},
+		{name: "bad server token", err: APIError{StatusCode: http.StatusUnauthorized, ErrorCode: 10}, want: true},
+		{name: "rate limited", err: APIError{StatusCode: http.StatusTooManyRequests}, want: false},
+		{name: "server error", err: APIError{StatusCode: http.StatusInternalServerError}, want: false},
+		{name: "server error with recipient code", err: APIError{StatusCode: http.StatusServiceUnavailable, ErrorCode: postmarkErrorInactiveRecipient}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Permanent(); got != tt.want {
+				t.Fatalf("Permanent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPermanent(t *testing.T) {
+	permanent := &APIError{StatusCode: http.StatusUnprocessableEntity, ErrorCode: postmarkErrorInactiveRecipient}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "network error", err: errors.New("dial tcp: connection refused"), want: false},
+		{name: "api error", err: permanent, want: true},
+		{name: "wrapped api error", err: fmt.Errorf("send: %w", permanent), want: true},
+		{name: "transient api error", err: &APIError{StatusCode: http.StatusBadGateway}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsPermanent(tt.err); got != tt.want {
+				t.Fatalf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServiceValidatesConfig(t *testing.T) {
+	if _, err := NewService(Config{FromEmail: "noreply@example.com"}); err == nil {
+		t.Fatal("NewService without a server token succeeded, want error")
+	}
+	if _, err := NewService(Config{ServerToken: "token"}); err == nil {
+		t.Fatal("NewService without a from address succeeded, want error")
+	}
+
+	svc, err := NewService(Config{ServerToken: "token", FromEmail: "noreply@example.com"})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	if svc.messageStream != "outbound" {
+		t.Fatalf("messageStream = %q, want %q", svc.messageStream, "outbound")
+	}
+	if svc.baseURL != defaultBaseURL {
+		t.Fatalf("baseURL = %q, want %q", svc.baseURL, defaultBaseURL)
+	}
+}
+
+// newTestService points a Service at a stub Postmark API.
+func newTestService(t *testing.T, handler http.HandlerFunc) *Service {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	svc, err := NewService(Config{
+		ServerToken: "server-token",
+		FromEmail:   "noreply@example.com",
+		FromName:    "Bafa",
+		BaseURL:     server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+
+	return svc
+}
+
+func TestSendTemplateEmailPayload(t *testing.T) {
+	var (
+		path    string
+		token   string
+		payload map[string]any
+	)
+	svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		token = r.Header.Get("X-Postmark-Server-Token")
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	err := svc.SendTemplateEmail(context.Background(), SendTemplateInput{
+		To:            "jane@example.com",
+		TemplateAlias: TemplateEmailVerification,
+		Model:         map[string]any{"username": "jane"},
+		Tag:           "verification",
+	})
+	if err != nil {
+		t.Fatalf("SendTemplateEmail: %v", err)
+	}
+
+	if path != "/email/withTemplate" {
+		t.Fatalf("path = %q, want %q", path, "/email/withTemplate")
+	}
+	if token != "server-token" {
+		t.Fatalf("server token = %q, want %q", token, "server-token")
+	}
+	if got := payload["From"]; got != "Bafa <noreply@example.com>" {
+		t.Fatalf("From = %v, want %q", got, "Bafa <noreply@example.com>")
+	}
+	if got := payload["TemplateAlias"]; got != TemplateEmailVerification {
+		t.Fatalf("TemplateAlias = %v, want %q", got, TemplateEmailVerification)
+	}
+	if _, ok := payload["TemplateId"]; ok {
+		t.Fatal("TemplateId set, want omitted when sending by alias")
+	}
+	if got := payload["MessageStream"]; got != "outbound" {
+		t.Fatalf("MessageStream = %v, want %q", got, "outbound")
+	}
+	model, _ := payload["TemplateModel"].(map[string]any)
+	if model["username"] != "jane" {
+		t.Fatalf("TemplateModel = %v, want username jane", payload["TemplateModel"])
+	}
+}
+
+func TestSendTemplateEmailRequiresTemplate(t *testing.T) {
+	svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request sent for invalid input")
+	})
+
+	if err := svc.SendTemplateEmail(context.Background(), SendTemplateInput{To: "jane@example.com"}); err == nil {
+		t.Fatal("SendTemplateEmail without a template succeeded, want error")
+	}
+	if err := svc.SendTemplateEmail(context.Background(), SendTemplateInput{TemplateAlias: TemplateServerInvite}); err == nil {
+		t.Fatal("SendTemplateEmail without a recipient succeeded, want error")
+	}
+}
+
+func TestSendReturnsAPIError(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		wantCode      int
+		wantPermanent bool
+	}{
+		{name: "inactive recipient", status: http.StatusUnprocessableEntity, body: `{"ErrorCode":406,"Message":"Inactive recipient"}`, wantCode: 406, wantPermanent: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, body: `{"ErrorCode":0,"Message":"Slow down"}`, wantCode: 0, wantPermanent: false},
+		{name: "undecodable body", status: http.StatusInternalServerError, body: "upstream failure", wantCode: 0, wantPermanent: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestService(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			})
+
+			err := svc.SendEmail(context.Background(), SendEmailInput{To: "jane@example.com", Subject: "Hi", TextBody: "Hello"})
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("SendEmail error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Fatalf("StatusCode = %d, want %d", apiErr.StatusCode, tt.status)
+			}
+			if apiErr.ErrorCode != tt.wantCode {
+				t.Fatalf("ErrorCode = %d, want %d", apiErr.ErrorCode, tt.wantCode)
+			}
+			if apiErr.Message == "" {
+				t.Fatal("Message is empty")
+			}
+			if got := IsPermanent(err); got != tt.wantPermanent {
+				t.Fatalf("IsPermanent = %v, want %v", got, tt.wantPermanent)
+			}
+		})
+	}
+}
+
+func TestResolveMessageStream(t *testing.T) {
+	svc := &Service{messageStream: "outbound"}
+
+	if got := svc.resolveMessageStream("  "); got != "outbound" {
+		t.Fatalf("resolveMessageStream(blank) = %q, want %q", got, "outbound")
+	}
+	if got := svc.resolveMessageStream("broadcast"); got != "broadcast" {
+		t.Fatalf("resolveMessageStream(broadcast) = %q, want %q", got, "broadcast")
+	}
+}
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Policies for the messages of a deleted account, selected with ACCOUNT_DELETION_MESSAGES.
+const (
+	deletedMessagesAnonymize = "anonymize"
+	deletedMessagesDelete    = "delete"
+)
+
+// accountDeletionMessagePolicyFromEnv reads ACCOUNT_DELETION_MESSAGES: "anonymize"
+// (the default) keeps messages under the Deleted User placeholder, "delete" removes them.
+func accountDeletionMessagePolicyFromEnv() string {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("ACCOUNT_DELETION_MESSAGES")), deletedMessagesDelete) {
+		return deletedMessagesDelete
+	}
+
+	return deletedMessagesAnonymize
+}
+
+// ownedServerSummary describes a server the deleting user owns.
+type ownedServerSummary struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	MemberCount int64  `json:"member_count"`
+}
+
+// DeleteCurrentUser permanently deletes the caller's account after confirming their
+// password. Servers the user owns alone are deleted; owning a server that still has
+// other members blocks deletion until ownership is transferred. Memberships, sessions,
+// tokens and credentials are removed, and authored messages are anonymized or deleted
+// according to ACCOUNT_DELETION_MESSAGES.
+func DeleteCurrentUser(c *gin.Context) {
+	var req models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := caller.DB.First(&user, caller.Claims.UserID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return
+	}
+
+	if err := auth.ComparePassword(user.Password, strings.TrimSpace(req.Password)); err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeIncorrectPassword, "current password is incorrect")
+		return
+	}
+
+	var owned []models.Server
+	if err := caller.DB.Where("owner_id = ?", user.ID).Find(&owned).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load owned servers")
+		return
+	}
+
+	blocking := make([]ownedServerSummary, 0)
+	for _, server := range owned {
+		var others int64
+		if err := caller.DB.Model(&models.ServerMember{}).
+			Where("server_id = ? AND user_id <> ?", server.ID, user.ID).
+			Count(&others).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to count server members")
+			return
+		}
+		if others > 0 {
+			blocking = append(blocking, ownedServerSummary{ID: server.ID, Name: server.Name, MemberCount: others + 1})
+		}
+	}
+
+	if len(blocking) > 0 {
+		apierror.RespondWithDetails(c, http.StatusConflict, apierror.CodeOwnsServers,
+			"transfer ownership of servers that have other members before deleting your account",
+			gin.H{"servers": blocking})
+		return
+	}
+
+	var memberServerIDs []uint
+	if err := caller.DB.Model(&models.ServerMember{}).
+		Where("user_id = ?", user.ID).
+		Pluck("server_id", &memberServerIDs).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load memberships")
+		return
+	}
+
+	for _, serverID := range memberServerIDs {
+		evictFromServerVoiceChannels(c, caller.DB, serverID, user.ID, "account_deleted")
+	}
+
+	policy := accountDeletionMessagePolicyFromEnv()
+	objectKeys := make([]string, 0)
+	var messageCount, sessionCount int64
+
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		for _, server := range owned {
+			keys, err := deleteServerData(tx, server)
+			if err != nil {
+				return err
+			}
+			objectKeys = append(objectKeys, keys...)
+		}
+
+		if err := removeUserMemberships(tx, user.ID); err != nil {
+			return err
+		}
+
+		count, keys, err := releaseAuthoredMessages(tx, user.ID, policy)
+		if err != nil {
+			return err
+		}
+		messageCount = count
+		objectKeys = append(objectKeys, keys...)
+
+		count, err = deleteUserCredentials(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		sessionCount = count
+
+		var exportKeys []string
+		if err := tx.Model(&models.DataExport{}).Where("user_id = ? AND object_key <> ''", user.ID).Pluck("object_key", &exportKeys).Error; err != nil {
+			return err
+		}
+		objectKeys = append(objectKeys, exportKeys...)
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.DataExport{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.User{}, user.ID).Error
+	}); err != nil {
+		requestLogger(c).Error("failed to delete account", "user_id", user.ID, "error", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete account")
+		return
+	}
+
+	ownedIDs := make(map[uint]bool, len(owned))
+	for _, server := range owned {
+		ownedIDs[server.ID] = true
+	}
+
+	if storageService, ok := getStorageService(c); ok {
+		if key, ok := storageService.ObjectKeyFromURL(user.Avatar); ok {
+			objectKeys = append(objectKeys, key)
+		}
+		if user.AvatarOriginalKey != "" {
+			objectKeys = append(objectKeys, user.AvatarOriginalKey)
+		}
+		for _, server := range owned {
+			if key, ok := storageService.ObjectKeyFromURL(server.Icon); ok {
+				objectKeys = append(objectKeys, key)
+			}
+			if server.IconOriginalKey != "" {
+				objectKeys = append(objectKeys, server.IconOriginalKey)
+			}
+		}
+
+		objectKeys, err = unreferencedObjectKeys(caller.DB, objectKeys)
+		if err != nil {
+			requestLogger(c).Warn("failed to check account object references", "user_id", user.ID, "error", err)
+			objectKeys = nil
+		}
+
+		if len(objectKeys) > 0 {
+			if err := storageService.DeleteObjects(c.Request.Context(), objectKeys); err != nil {
+				requestLogger(c).Warn("failed to delete account objects", "user_id", user.ID, "count", len(objectKeys), "error", err)
+			}
+		}
+	}
+
+	left := 0
+	hub, hasHub := getWebSocketHub(c)
+	for _, serverID := range memberServerIDs {
+		if ownedIDs[serverID] {
+			continue
+		}
+		left++
+
+		if hasHub {
+			_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventMemberDeleted, gin.H{
+				"server_id": serverID,
+				"user_id":   user.ID,
+				"messages":  policy,
+			}))
+			hub.RemoveServerMember(serverID, user.ID)
+		}
+	}
+	if hasHub {
+		hub.DisconnectUser(user.ID)
+	}
+
+	deletedServers := make([]gin.H, 0, len(owned))
+	for _, server := range owned {
+		deletedServers = append(deletedServers, gin.H{"id": server.ID, "name": server.Name})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account deleted",
+		"data": gin.H{
+			"deleted_servers":  deletedServers,
+			"servers_left":     left,
+			"messages_policy":  policy,
+			"messages":         messageCount,
+			"sessions_revoked": sessionCount,
+			"objects_removed":  len(objectKeys),
+		},
+	})
+}
+
+// deleteServerData removes a server and everything in it, returning the storage
+// keys of its attachments and custom emojis. The icon is left to the caller.
+func deleteServerData(tx *gorm.DB, server models.Server) ([]string, error) {
+	const serverChannels = "channel_id IN (SELECT id FROM channels WHERE server_id = ?)"
+
+	keys, err := messageObjectKeys(tx, serverChannels, server.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var emojiKeys []string
+	if err := tx.Model(&models.CustomEmoji{}).Where("server_id = ?", server.ID).Pluck("object_key", &emojiKeys).Error; err != nil {
+		return nil, err
+	}
+	keys = append(keys, emojiKeys...)
+
+	if err := deleteMessagesWhere(tx, serverChannels, server.ID); err != nil {
+		return nil, err
+	}
+
+	// Emojis from this server may be used in messages elsewhere.
+	if err := tx.Where("emoji_id IN (SELECT id FROM custom_emojis WHERE server_id = ?)", server.ID).
+		Delete(&models.MessageEmoji{}).Error; err != nil {
+		return nil, err
+	}
+
+	for _, model := range []interface{}{&models.ChannelMember{}, &models.ChannelRead{}, &models.NSFWAcknowledgment{}} {
+		if err := tx.Where(serverChannels, server.ID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	for _, model := range []interface{}{
+		&models.ChannelWebhook{},
+		&models.Channel{},
+		&models.ChannelCategory{},
+		&models.CustomEmoji{},
+		&models.ServerInvite{},
+		&models.ServerBan{},
+		&models.ServerWordFilter{},
+		&models.ServerMember{},
+		&models.APIToken{},
+	} {
+		if err := tx.Where("server_id = ?", server.ID).Delete(model).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return keys, tx.Delete(&models.Server{}, server.ID).Error
+}
+
+// removeUserMemberships drops the user from every server and private channel,
+// along with their read markers, bans and the mentions of them in messages.
+func removeUserMemberships(tx *gorm.DB, userID uint) error {
+	for _, model := range []interface{}{
+		&models.ServerMember{},
+		&models.ChannelMember{},
+		&models.ChannelRead{},
+		&models.NSFWAcknowledgment{},
+		&models.ServerBan{},
+		&models.MessageMention{},
+	} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseAuthoredMessages applies the message policy to the user's messages and
+// returns how many were affected, plus the storage keys of deleted attachments.
+// Webhooks and invites the user created, and webhook messages, always move to the
+// placeholder so integrations and shared invite links keep working.
+func releaseAuthoredMessages(tx *gorm.DB, userID uint, policy string) (int64, []string, error) {
+	placeholder, err := deletedUserPlaceholder(tx)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var count int64
+	var keys []string
+
+	if policy == deletedMessagesDelete {
+		const ownMessages = "user_id = ? AND webhook_id IS NULL"
+
+		keys, err = messageObjectKeys(tx, ownMessages, userID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if err := tx.Model(&models.Message{}).Where(ownMessages, userID).Count(&count).Error; err != nil {
+			return 0, nil, err
+		}
+		if err := deleteMessagesWhere(tx, ownMessages, userID); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	// Client nonces are unique per author, so they are cleared before messages move
+	// to the shared placeholder.
+	result := tx.Model(&models.Message{}).
+		Where("user_id = ?", userID).
+		Updates(map[string]interface{}{"user_id": placeholder.ID, "client_nonce": nil})
+	if result.Error != nil {
+		return 0, nil, result.Error
+	}
+	if policy == deletedMessagesAnonymize {
+		count = result.RowsAffected
+	}
+
+	if err := tx.Model(&models.ChannelWebhook{}).
+		Where("created_by = ?", userID).
+		Update("created_by", placeholder.ID).Error; err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Model(&models.ServerInvite{}).
+		Where("inviter_id = ?", userID).
+		Update("inviter_id", placeholder.ID).Error; err != nil {
+		return 0, nil, err
+	}
+
+	return count, keys, nil
+}
+
+// deleteUserCredentials removes everything that lets the user sign in or be
+// reached, returning how many sessions were revoked.
+func deleteUserCredentials(tx *gorm.DB, userID uint) (int64, error) {
+	result := tx.Where("user_id = ?", userID).Delete(&models.Session{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	for _, model := range []interface{}{
+		&models.TwoFactorBackupCode{},
+		&models.TwoFactorChallenge{},
+		&models.OAuthIdentity{},
+		&models.APIToken{},
+		&models.PushSubscription{},
+		&models.NotificationPreference{},
+		&models.DNDSchedule{},
+	} {
+		if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return result.RowsAffected, nil
+}
+
+// deletedUserPlaceholder returns the shared account that owns anonymized content,
+// creating it on first use. It has no usable password and no verified email, so
+// nobody can sign in as it, and registration refuses its username.
+func deletedUserPlaceholder(tx *gorm.DB) (models.User, error) {
+	var placeholder models.User
+	err := tx.Where("username = ? AND email = ?", models.DeletedUserUsername, models.DeletedUserEmail).First(&placeholder).Error
+	if err == nil {
+		return placeholder, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return placeholder, err
+	}
+
+	placeholder = models.User{
+		Username: models.DeletedUserUsername,
+		Email:    models.DeletedUserEmail,
+		Password: "!",
+	}
+	return placeholder, tx.Create(&placeholder).Error
+}
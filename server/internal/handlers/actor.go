@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// actor bundles the authenticated caller with the request-scoped database
+// handle and, once resolved, their membership in the server being acted on.
+type actor struct {
+	DB         *gorm.DB
+	Claims     *auth.Claims
+	Membership *models.ServerMember
+}
+
+// actorError carries the HTTP status, error code and message a handler should respond with.
+type actorError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *actorError) Error() string {
+	return e.Message
+}
+
+var (
+	errActorDatabaseUnavailable = &actorError{Status: http.StatusInternalServerError, Code: apierror.CodeInternal, Message: "database connection unavailable"}
+	errActorUnauthenticated     = &actorError{Status: http.StatusUnauthorized, Code: apierror.CodeUnauthorized, Message: "authentication required"}
+	errActorMembershipRequired  = &actorError{Status: http.StatusForbidden, Code: apierror.CodeMembershipRequired, Message: "membership required"}
+)
+
+// resolveActor loads the database handle and the caller's claims.
+func resolveActor(c *gin.Context) (*actor, error) {
+	db, ok := getDB(c)
+	if !ok {
+		return nil, errActorDatabaseUnavailable
+	}
+
+	claims, ok := getUserClaims(c)
+	if !ok {
+		return nil, errActorUnauthenticated
+	}
+
+	return &actor{DB: db.WithContext(c), Claims: claims}, nil
+}
+
+// resolveServerActor resolves the caller and requires an active membership in the server.
+func resolveServerActor(c *gin.Context, serverID uint) (*actor, error) {
+	a, err := resolveActor(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.loadMembership(serverID); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// resolveServerActorFromParam parses the :serverID route parameter before resolving the actor.
+func resolveServerActorFromParam(c *gin.Context) (*actor, uint, error) {
+	serverIDValue, err := strconv.ParseUint(c.Param("serverID"), 10, 64)
+	if err != nil {
+		return nil, 0, &actorError{Status: http.StatusBadRequest, Code: apierror.CodeInvalidID, Message: "invalid server id"}
+	}
+	serverID := uint(serverIDValue)
+
+	a, err := resolveServerActor(c, serverID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return a, serverID, nil
+}
+
+// resolveChannelActor parses the :id route parameter, loads the channel, and
+// requires an active membership in the server that owns it plus access to the
+// channel when it is private.
+func resolveChannelActor(c *gin.Context) (*actor, models.Channel, error) {
+	channelIDValue, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return nil, models.Channel{}, &actorError{Status: http.StatusBadRequest, Code: apierror.CodeInvalidID, Message: "invalid channel id"}
+	}
+
+	a, err := resolveActor(c)
+	if err != nil {
+		return nil, models.Channel{}, err
+	}
+
+	var channel models.Channel
+	if err := a.DB.First(&channel, channelIDValue).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, models.Channel{}, &actorError{Status: http.StatusNotFound, Code: apierror.CodeChannelNotFound, Message: "channel not found"}
+		}
+		return nil, models.Channel{}, &actorError{Status: http.StatusInternalServerError, Code: apierror.CodeInternal, Message: "failed to load channel"}
+	}
+
+	if err := a.loadMembership(channel.ServerID); err != nil {
+		return nil, models.Channel{}, err
+	}
+
+	if err := ensureChannelAccess(a.DB, channel, a.Claims.UserID); err != nil {
+		if errors.Is(err, errChannelAccessRequired) {
+			return nil, models.Channel{}, &actorError{Status: http.StatusForbidden, Code: apierror.CodeChannelAccessRequired, Message: err.Error()}
+		}
+		return nil, models.Channel{}, &actorError{Status: http.StatusInternalServerError, Code: apierror.CodeInternal, Message: "failed to verify channel access"}
+	}
+
+	return a, channel, nil
+}
+
+func (a *actor) loadMembership(serverID uint) error {
+	var membership models.ServerMember
+	if err := a.DB.Where("server_id = ? AND user_id = ?", serverID, a.Claims.UserID).First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errActorMembershipRequired
+		}
+		return &actorError{Status: http.StatusInternalServerError, Code: apierror.CodeInternal, Message: "failed to verify membership"}
+	}
+
+	if membership.Role == models.ServerRolePending {
+		return errActorMembershipRequired
+	}
+
+	a.Membership = &membership
+	return nil
+}
+
+// Role returns the caller's role in the resolved server.
+func (a *actor) Role() string {
+	if a.Membership == nil {
+		return ""
+	}
+	return a.Membership.Role
+}
+
+// Require returns a 403 permission_denied actorError with the given message when the caller's role lacks the permission.
+func (a *actor) Require(permission, deniedMessage string) error {
+	if !roleHasPermission(a.Role(), permission) {
+		return &actorError{Status: http.StatusForbidden, Code: apierror.CodePermissionDenied, Message: deniedMessage}
+	}
+	return nil
+}
+
+// RequireOwner returns a 403 owner_required actorError with the given message unless the caller owns the server.
+func (a *actor) RequireOwner(deniedMessage string) error {
+	if a.Role() != models.ServerRoleOwner {
+		return &actorError{Status: http.StatusForbidden, Code: apierror.CodeOwnerRequired, Message: deniedMessage}
+	}
+	return nil
+}
+
+// respondActorError writes the response for an error returned by the actor helpers.
+func respondActorError(c *gin.Context, err error) {
+	var actorErr *actorError
+	if errors.As(err, &actorErr) {
+		apierror.Respond(c, actorErr.Status, actorErr.Code, actorErr.Message)
+		return
+	}
+
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to validate permissions")
+}
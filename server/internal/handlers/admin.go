@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// failedEmailListLimit is how many recent failed emails GetFailedEmails returns.
+const failedEmailListLimit = 50
+
+// GetFailedEmails reports the emails that could not be delivered and were moved
+// to the dead-letter queue, with the most recent recipients and errors.
+func GetFailedEmails(c *gin.Context) {
+	inspector, ok := getQueueInspector(c)
+	if !ok {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "queue is not configured")
+		return
+	}
+
+	report, err := queue.FailedEmails(inspector, failedEmailListLimit)
+	if err != nil {
+		requestLogger(c).Error("failed to list failed emails", "error", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load failed emails")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"failed_emails": report,
+		},
+	})
+}
+
+// RetryFailedEmail re-queues a failed email for another round of delivery attempts.
+func RetryFailedEmail(c *gin.Context) {
+	inspector, ok := getQueueInspector(c)
+	if !ok {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "queue is not configured")
+		return
+	}
+
+	taskID := c.Param("taskID")
+	if err := queue.RetryFailedEmail(inspector, taskID); err != nil {
+		if errors.Is(err, queue.ErrFailedEmailNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, err.Error())
+			return
+		}
+		requestLogger(c).Error("failed to retry failed email", "task_id", taskID, "error", err)
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to retry email")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email queued for retry",
+		"data": gin.H{
+			"task_id": taskID,
+		},
+	})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateAPIToken mints an API token for the current user. The plaintext token is only returned here.
+func CreateAPIToken(c *gin.Context) {
+	var req models.CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNameRequired, "name is required")
+		return
+	}
+
+	scopes, err := auth.NormalizeScopes(req.Scopes)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if req.ServerID != nil {
+		if err := caller.loadMembership(*req.ServerID); err != nil {
+			respondActorError(c, err)
+			return
+		}
+	}
+
+	plaintext, prefix, hash, err := auth.NewAPIToken()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate api token")
+		return
+	}
+
+	token := models.APIToken{
+		UserID:      caller.Claims.UserID,
+		ServerID:    req.ServerID,
+		Name:        name,
+		TokenHash:   hash,
+		TokenPrefix: prefix,
+		Scopes:      strings.Join(scopes, ","),
+	}
+
+	if err := caller.DB.Create(&token).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create api token")
+		return
+	}
+
+	payload := serializeAPIToken(token)
+	payload["token"] = plaintext
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "API token created. Copy it now; it will not be shown again.",
+		"data": gin.H{
+			"token": payload,
+		},
+	})
+}
+
+// GetAPITokens lists the current user's active API tokens.
+func GetAPITokens(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var tokens []models.APIToken
+	if err := caller.DB.
+		Where("user_id = ? AND revoked_at IS NULL", caller.Claims.UserID).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load api tokens")
+		return
+	}
+
+	payload := make([]gin.H, 0, len(tokens))
+	for _, token := range tokens {
+		payload = append(payload, serializeAPIToken(token))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"tokens": payload}})
+}
+
+// RevokeAPIToken permanently disables one of the current user's API tokens.
+func RevokeAPIToken(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	tokenIDValue, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || tokenIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid token id")
+		return
+	}
+
+	result := caller.DB.
+		Model(&models.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", uint(tokenIDValue), caller.Claims.UserID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to revoke api token")
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeAPITokenNotFound, "api token not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func serializeAPIToken(token models.APIToken) gin.H {
+	var lastUsedAt string
+	if token.LastUsedAt != nil {
+		lastUsedAt = token.LastUsedAt.Format(time.RFC3339)
+	}
+
+	scopes := []string{}
+	if token.Scopes != "" {
+		scopes = strings.Split(token.Scopes, ",")
+	}
+
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"server_id":    token.ServerID,
+		"token_prefix": token.TokenPrefix,
+		"scopes":       scopes,
+		"created_at":   token.CreatedAt.Format(time.RFC3339),
+		"last_used_at": lastUsedAt,
+	}
+}
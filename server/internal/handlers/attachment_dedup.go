@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errStoredAttachmentGone is returned when the attachment whose object an upload
+// meant to share was deleted before the new message could reference it.
+var errStoredAttachmentGone = errors.New("stored attachment was deleted")
+
+// hashContent returns the hex SHA-256 of body and rewinds it for the upload.
+func hashContent(body io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// findStoredAttachment returns an attachment in the server whose content has the
+// given hash, or nil when the server has not stored these bytes yet.
+func findStoredAttachment(db *gorm.DB, serverID uint, contentHash string) (*models.MessageAttachment, error) {
+	var attachment models.MessageAttachment
+	err := db.
+		Joins("JOIN messages ON messages.id = message_attachments.message_id").
+		Joins("JOIN channels ON channels.id = messages.channel_id").
+		Where("channels.server_id = ? AND message_attachments.content_hash = ?", serverID, contentHash).
+		Order("message_attachments.id ASC").
+		Take(&attachment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &attachment, nil
+}
+
+// reuseStoredAttachment points attachment at the object, and any preview already
+// built for it, of a stored attachment with the same content.
+func reuseStoredAttachment(attachment *models.MessageAttachment, stored models.MessageAttachment) {
+	attachment.ObjectKey = stored.ObjectKey
+	attachment.URL = stored.URL
+	attachment.Width = stored.Width
+	attachment.Height = stored.Height
+	attachment.PreviewURL = stored.PreviewURL
+	attachment.PreviewObjectKey = stored.PreviewObjectKey
+	attachment.PreviewWidth = stored.PreviewWidth
+	attachment.PreviewHeight = stored.PreviewHeight
+	attachment.Waveform = stored.Waveform
+	attachment.Duration = stored.Duration
+}
+
+// lockStoredAttachment takes a share lock on the stored attachment for the rest of
+// the transaction. A concurrent delete of that row then waits until the new
+// reference is committed, and so sees it when deciding which objects to remove.
+func lockStoredAttachment(tx *gorm.DB, id uint) error {
+	var attachment models.MessageAttachment
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Select("id").Where("id = ?", id).Take(&attachment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errStoredAttachmentGone
+	}
+
+	return err
+}
+
+// unreferencedObjectKeys filters keys down to those no attachment still refers to,
+// so shared objects are only deleted with their last reference. Call it after the
+// transaction that removed the attachments has committed.
+func unreferencedObjectKeys(db *gorm.DB, keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return keys, nil
+	}
+
+	var referenced []string
+	if err := db.Model(&models.MessageAttachment{}).
+		Where("object_key IN ?", keys).
+		Distinct().
+		Pluck("object_key", &referenced).Error; err != nil {
+		return nil, err
+	}
+
+	var referencedPreviews []string
+	if err := db.Model(&models.MessageAttachment{}).
+		Where("preview_object_key IN ?", keys).
+		Distinct().
+		Pluck("preview_object_key", &referencedPreviews).Error; err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool, len(referenced)+len(referencedPreviews))
+	for _, key := range append(referenced, referencedPreviews...) {
+		skip[key] = true
+	}
+
+	unreferenced := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if skip[key] {
+			continue
+		}
+		skip[key] = true
+		unreferenced = append(unreferenced, key)
+	}
+
+	return unreferenced, nil
+}
@@ -3,20 +3,28 @@ package handlers
 import (
     "bytes"
     "context"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
     "fmt"
     "image"
     "io"
-    "log"
     "math"
     "os"
     "os/exec"
+    "path/filepath"
     "strings"
     "time"
 
+    "bafachat/internal/logging"
     "bafachat/internal/models"
+    "bafachat/internal/queue"
     "bafachat/internal/storage"
+    "bafachat/internal/websocket"
 
     "github.com/disintegration/imaging"
+    "github.com/gin-gonic/gin"
+    "github.com/hibiken/asynq"
     "gorm.io/gorm"
 )
 
@@ -25,6 +33,11 @@ const (
     previewMaxHeight       = 640
     previewJPEGQuality     = 82
     previewGenerationLimit = 12 * time.Second
+
+    // waveformBars is how many peak amplitudes are stored for an audio attachment.
+    waveformBars = 64
+    // waveformSampleRate is the mono PCM rate audio is decoded to for measuring.
+    waveformSampleRate = 8000
 )
 
 type previewResult struct {
@@ -34,6 +47,8 @@ type previewResult struct {
     previewHeight int
     width         int
     height        int
+    waveform      []int
+    duration      float64
 }
 
 func generateAttachmentPreviews(ctx context.Context, db *gorm.DB, storageService *storage.Service, attachments []models.MessageAttachment) []models.MessageAttachment {
@@ -49,11 +64,7 @@ func generateAttachmentPreviews(ctx context.Context, db *gorm.DB, storageService
 
     for index := range updated {
         attachment := &updated[index]
-        if attachment.PreviewObjectKey != "" {
-            continue
-        }
-
-        if attachment.ContentType == "" {
+        if !needsPreview(*attachment) {
             continue
         }
 
@@ -66,12 +77,16 @@ func generateAttachmentPreviews(ctx context.Context, db *gorm.DB, storageService
             result, err = buildImagePreview(ctx, storageService, attachment)
         case strings.HasPrefix(contentType, "video/"):
             result, err = buildVideoPreview(ctx, storageService, attachment)
+        case contentType == "application/pdf":
+            result, err = buildPDFPreview(ctx, storageService, attachment)
+        case strings.HasPrefix(contentType, "audio/"):
+            result, err = buildAudioWaveform(ctx, storageService, attachment)
         default:
             continue
         }
 
         if err != nil {
-            log.Printf("attachment preview: failed to generate preview for attachment %d: %v", attachment.ID, err)
+            logging.FromContext(ctx).Warn("attachment preview: failed to generate preview", "attachment_id", attachment.ID, "error", err)
             continue
         }
 
@@ -79,11 +94,23 @@ func generateAttachmentPreviews(ctx context.Context, db *gorm.DB, storageService
             continue
         }
 
-        updates := map[string]interface{}{
-            "preview_object_key": result.objectKey,
-            "preview_url":        result.url,
-            "preview_width":      result.previewWidth,
-            "preview_height":     result.previewHeight,
+        updates := map[string]interface{}{}
+        if result.objectKey != "" {
+            updates["preview_object_key"] = result.objectKey
+            updates["preview_url"] = result.url
+            updates["preview_width"] = result.previewWidth
+            updates["preview_height"] = result.previewHeight
+        }
+
+        var waveform string
+        if len(result.waveform) > 0 {
+            encoded, err := json.Marshal(result.waveform)
+            if err != nil {
+                continue
+            }
+            waveform = string(encoded)
+            updates["waveform"] = waveform
+            updates["duration"] = result.duration
         }
 
         if result.width > 0 {
@@ -97,14 +124,20 @@ func generateAttachmentPreviews(ctx context.Context, db *gorm.DB, storageService
             Model(&models.MessageAttachment{}).
             Where("id = ?", attachment.ID).
             Updates(updates).Error; err != nil {
-            log.Printf("attachment preview: failed to persist metadata for attachment %d: %v", attachment.ID, err)
+            logging.FromContext(ctx).Error("attachment preview: failed to persist metadata", "attachment_id", attachment.ID, "error", err)
             continue
         }
 
-        attachment.PreviewObjectKey = result.objectKey
-        attachment.PreviewURL = result.url
-        attachment.PreviewWidth = result.previewWidth
-        attachment.PreviewHeight = result.previewHeight
+        if result.objectKey != "" {
+            attachment.PreviewObjectKey = result.objectKey
+            attachment.PreviewURL = result.url
+            attachment.PreviewWidth = result.previewWidth
+            attachment.PreviewHeight = result.previewHeight
+        }
+        if waveform != "" {
+            attachment.Waveform = waveform
+            attachment.Duration = result.duration
+        }
         if result.width > 0 {
             attachment.Width = result.width
         }
@@ -116,6 +149,92 @@ func generateAttachmentPreviews(ctx context.Context, db *gorm.DB, storageService
     return updated
 }
 
+// prepareAttachmentPreviews queues preview generation for the message's attachments
+// and returns them unchanged. When no queue is available, or enqueuing fails,
+// previews are generated inline as before.
+func prepareAttachmentPreviews(c *gin.Context, db *gorm.DB, storageService *storage.Service, message models.Message) []models.MessageAttachment {
+    attachmentIDs := make([]uint, 0, len(message.Attachments))
+    for _, attachment := range message.Attachments {
+        if needsPreview(attachment) {
+            attachmentIDs = append(attachmentIDs, attachment.ID)
+        }
+    }
+
+    if len(attachmentIDs) == 0 {
+        return message.Attachments
+    }
+
+    if queueClient, ok := getQueueClient(c); ok {
+        task, err := queue.NewPreviewTask(queue.PreviewTaskPayload{
+            MessageID:     message.ID,
+            AttachmentIDs: attachmentIDs,
+            RequestID:     logging.RequestID(c.Request.Context()),
+        })
+        if err == nil {
+            if _, err = queueClient.Enqueue(task, asynq.Timeout(time.Minute)); err == nil {
+                return message.Attachments
+            }
+        }
+        requestLogger(c).Warn("attachment preview: failed to enqueue previews, generating inline", "message_id", message.ID, "error", err)
+    }
+
+    return generateAttachmentPreviews(c.Request.Context(), db, storageService, message.Attachments)
+}
+
+// NewAttachmentPreviewProcessor returns the queue worker for preview tasks. It
+// builds the previews, then publishes message.updated so clients can swap them in.
+func NewAttachmentPreviewProcessor(db *gorm.DB, storageService *storage.Service, hub *websocket.Hub) queue.PreviewProcessor {
+    return func(ctx context.Context, payload queue.PreviewTaskPayload) error {
+        var attachments []models.MessageAttachment
+        if err := db.WithContext(ctx).
+            Where("message_id = ? AND id IN ?", payload.MessageID, payload.AttachmentIDs).
+            Find(&attachments).Error; err != nil {
+            return fmt.Errorf("load attachments: %w", err)
+        }
+
+        if len(attachments) == 0 {
+            return nil
+        }
+
+        generateAttachmentPreviews(ctx, db, storageService, attachments)
+
+        var message models.Message
+        if err := db.WithContext(ctx).
+            Preload("User").
+            Preload("Attachments").
+            Preload("Mentions.User", preloadMentionUsers).
+            Preload("Emojis.Emoji").
+            Preload("LinkPreview").
+            Preload("Channel").
+            First(&message, payload.MessageID).Error; err != nil {
+            if errors.Is(err, gorm.ErrRecordNotFound) {
+                return nil
+            }
+            return fmt.Errorf("load message: %w", err)
+        }
+        applyAuthorNickname(db.WithContext(ctx), &message)
+
+        if hub != nil {
+            _ = publishChannelEvent(hub, db.WithContext(ctx), message.Channel, websocket.MessageUpdated(serializeMessage(message), message.ChannelID, message.Channel.ServerID))
+        }
+
+        return nil
+    }
+}
+
+func needsPreview(attachment models.MessageAttachment) bool {
+    contentType := strings.ToLower(attachment.ContentType)
+    if strings.HasPrefix(contentType, "audio/") {
+        return attachment.Waveform == ""
+    }
+
+    if attachment.PreviewObjectKey != "" {
+        return false
+    }
+
+    return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") || contentType == "application/pdf"
+}
+
 func buildImagePreview(ctx context.Context, storageService *storage.Service, attachment *models.MessageAttachment) (*previewResult, error) {
     reader, _, _, err := storageService.GetObject(ctx, attachment.ObjectKey)
     if err != nil {
@@ -255,6 +374,256 @@ func buildVideoPreview(ctx context.Context, storageService *storage.Service, att
     }, nil
 }
 
+func buildPDFPreview(ctx context.Context, storageService *storage.Service, attachment *models.MessageAttachment) (*previewResult, error) {
+    renderer, err := pdfRenderer()
+    if err != nil {
+        logging.FromContext(ctx).Info("attachment preview: skipping pdf preview", "attachment_id", attachment.ID, "error", err)
+        return nil, nil
+    }
+
+    reader, _, _, err := storageService.GetObject(ctx, attachment.ObjectKey)
+    if err != nil {
+        return nil, fmt.Errorf("fetch object: %w", err)
+    }
+    defer reader.Close()
+
+    tmpDir, err := os.MkdirTemp("", "bafachat-pdf-*")
+    if err != nil {
+        return nil, fmt.Errorf("create temp dir: %w", err)
+    }
+    defer os.RemoveAll(tmpDir)
+
+    pdfPath := filepath.Join(tmpDir, "document.pdf")
+    pdfFile, err := os.Create(pdfPath)
+    if err != nil {
+        return nil, fmt.Errorf("create temp pdf: %w", err)
+    }
+
+    if _, err := io.Copy(pdfFile, reader); err != nil {
+        pdfFile.Close()
+        return nil, fmt.Errorf("buffer pdf: %w", err)
+    }
+
+    if err := pdfFile.Close(); err != nil {
+        return nil, fmt.Errorf("close temp pdf: %w", err)
+    }
+
+    var cmd *exec.Cmd
+    var pagePath string
+    switch filepath.Base(renderer) {
+    case "pdftoppm":
+        // -singlefile writes <prefix>.jpg for the first page only.
+        pagePath = filepath.Join(tmpDir, "page.jpg")
+        cmd = exec.CommandContext(
+            ctx,
+            renderer,
+            "-jpeg",
+            "-f", "1",
+            "-l", "1",
+            "-singlefile",
+            "-scale-to", fmt.Sprintf("%d", previewMaxWidth),
+            pdfPath,
+            filepath.Join(tmpDir, "page"),
+        )
+    default:
+        pagePath = filepath.Join(tmpDir, "page.png")
+        cmd = exec.CommandContext(
+            ctx,
+            renderer,
+            "draw",
+            "-q",
+            "-o", pagePath,
+            "-w", fmt.Sprintf("%d", previewMaxWidth),
+            "-h", fmt.Sprintf("%d", previewMaxHeight),
+            "-F", "png",
+            pdfPath,
+            "1",
+        )
+    }
+    cmd.Stdout = io.Discard
+    cmd.Stderr = io.Discard
+
+    if err := cmd.Run(); err != nil {
+        return nil, fmt.Errorf("%s render: %w", filepath.Base(renderer), err)
+    }
+
+    pageData, err := os.ReadFile(pagePath)
+    if err != nil {
+        return nil, fmt.Errorf("read rendered page: %w", err)
+    }
+
+    img, err := imaging.Decode(bytes.NewReader(pageData))
+    if err != nil {
+        return nil, fmt.Errorf("decode rendered page: %w", err)
+    }
+
+    preview := resizeToFit(img, previewMaxWidth, previewMaxHeight)
+
+    var buffer bytes.Buffer
+    if err := imaging.Encode(&buffer, preview, imaging.JPEG, imaging.JPEGQuality(previewJPEGQuality)); err != nil {
+        return nil, fmt.Errorf("encode preview: %w", err)
+    }
+
+    upload, err := storageService.UploadObject(
+        ctx,
+        attachment.FileName+"-preview.jpg",
+        "image/jpeg",
+        int64(buffer.Len()),
+        bytes.NewReader(buffer.Bytes()),
+    )
+    if err != nil {
+        return nil, fmt.Errorf("upload preview: %w", err)
+    }
+
+    bounds := preview.Bounds()
+
+    return &previewResult{
+        objectKey:     upload.ObjectKey,
+        url:           upload.FileURL,
+        previewWidth:  bounds.Dx(),
+        previewHeight: bounds.Dy(),
+    }, nil
+}
+
+// buildAudioWaveform decodes an audio attachment with ffmpeg to measure its
+// duration and a downsampled peak amplitude for each of waveformBars slices.
+// It is skipped when ffmpeg is not installed.
+func buildAudioWaveform(ctx context.Context, storageService *storage.Service, attachment *models.MessageAttachment) (*previewResult, error) {
+    ffmpeg, err := exec.LookPath("ffmpeg")
+    if err != nil {
+        logging.FromContext(ctx).Info("attachment preview: skipping audio waveform", "attachment_id", attachment.ID, "error", err)
+        return nil, nil
+    }
+
+    reader, _, _, err := storageService.GetObject(ctx, attachment.ObjectKey)
+    if err != nil {
+        return nil, fmt.Errorf("fetch object: %w", err)
+    }
+    defer reader.Close()
+
+    // Decode to raw 16-bit mono PCM on stdout.
+    cmd := exec.CommandContext(
+        ctx,
+        ffmpeg,
+        "-i", "pipe:0",
+        "-vn",
+        "-ac", "1",
+        "-ar", fmt.Sprintf("%d", waveformSampleRate),
+        "-f", "s16le",
+        "pipe:1",
+    )
+    cmd.Stdin = reader
+    cmd.Stderr = io.Discard
+
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, fmt.Errorf("ffmpeg stdout: %w", err)
+    }
+
+    if err := cmd.Start(); err != nil {
+        return nil, fmt.Errorf("start ffmpeg: %w", err)
+    }
+
+    peaks, samples, readErr := readPCMPeaks(stdout, waveformSampleRate/10)
+    if err := cmd.Wait(); err != nil {
+        return nil, fmt.Errorf("ffmpeg decode: %w", err)
+    }
+    if readErr != nil {
+        return nil, fmt.Errorf("read pcm: %w", readErr)
+    }
+
+    if samples == 0 {
+        return nil, errors.New("audio contains no samples")
+    }
+
+    return &previewResult{
+        waveform: downsamplePeaks(peaks, waveformBars),
+        duration: math.Round(float64(samples)/waveformSampleRate*100) / 100,
+    }, nil
+}
+
+// readPCMPeaks reads little-endian 16-bit PCM and returns the peak absolute
+// amplitude of each window of windowSize samples, plus the total sample count.
+func readPCMPeaks(reader io.Reader, windowSize int) ([]int, int, error) {
+    buffer := make([]byte, windowSize*2)
+    peaks := make([]int, 0, 256)
+    samples := 0
+
+    for {
+        n, err := io.ReadFull(reader, buffer)
+        n -= n % 2
+        if n > 0 {
+            peak := 0
+            for offset := 0; offset < n; offset += 2 {
+                value := int(int16(binary.LittleEndian.Uint16(buffer[offset:])))
+                if value < 0 {
+                    value = -value
+                }
+                if value > peak {
+                    peak = value
+                }
+            }
+            peaks = append(peaks, peak)
+            samples += n / 2
+        }
+
+        if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+            return peaks, samples, nil
+        }
+        if err != nil {
+            return nil, 0, err
+        }
+    }
+}
+
+// downsamplePeaks reduces window peaks to bars values scaled 0-100 relative to
+// the loudest window, so quiet recordings still show their shape.
+func downsamplePeaks(peaks []int, bars int) []int {
+    if len(peaks) == 0 {
+        return nil
+    }
+    if len(peaks) < bars {
+        bars = len(peaks)
+    }
+
+    loudest := 0
+    for _, peak := range peaks {
+        if peak > loudest {
+            loudest = peak
+        }
+    }
+
+    waveform := make([]int, bars)
+    if loudest == 0 {
+        return waveform
+    }
+
+    for bar := range waveform {
+        start := bar * len(peaks) / bars
+        end := (bar + 1) * len(peaks) / bars
+        peak := 0
+        for _, value := range peaks[start:end] {
+            if value > peak {
+                peak = value
+            }
+        }
+        waveform[bar] = int(math.Round(float64(peak) * 100 / float64(loudest)))
+    }
+
+    return waveform
+}
+
+// pdfRenderer locates pdftoppm (poppler) or, failing that, mutool (MuPDF).
+func pdfRenderer() (string, error) {
+    for _, name := range []string{"pdftoppm", "mutool"} {
+        if path, err := exec.LookPath(name); err == nil {
+            return path, nil
+        }
+    }
+
+    return "", fmt.Errorf("neither pdftoppm nor mutool is installed")
+}
+
 func resizeToFit(img image.Image, maxWidth, maxHeight int) image.Image {
     width := img.Bounds().Dx()
     height := img.Bounds().Dy()
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StreamAttachment serves an attachment's object to members of the channel's
+// server. It honours single byte ranges for media seeking and If-None-Match
+// for conditional requests.
+func StreamAttachment(c *gin.Context) {
+	storageService, ok := getStorageService(c)
+	if !ok {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
+		return
+	}
+
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := ensureNSFWAcknowledged(caller.DB, channel, caller.Claims.UserID); err != nil {
+		respondNSFWError(c, err)
+		return
+	}
+
+	attachmentIDValue, err := strconv.ParseUint(c.Param("attachmentID"), 10, 64)
+	if err != nil || attachmentIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid attachment id")
+		return
+	}
+
+	var attachment models.MessageAttachment
+	if err := caller.DB.
+		Joins("JOIN messages ON messages.id = message_attachments.message_id").
+		Where("message_attachments.id = ? AND messages.channel_id = ?", attachmentIDValue, channel.ID).
+		First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeAttachmentNotFound, "attachment not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load attachment")
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	info, err := storageService.StatObject(ctx, attachment.ObjectKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeAttachmentNotFound, "attachment not found")
+			return
+		}
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeStorageError, "failed to load attachment")
+		return
+	}
+
+	c.Header("Accept-Ranges", "bytes")
+	c.Header("Cache-Control", "private, max-age=300")
+	if info.ETag != "" {
+		c.Header("ETag", info.ETag)
+	}
+
+	if info.ETag != "" && etagMatches(c.GetHeader("If-None-Match"), info.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	byteRange := strings.TrimSpace(c.GetHeader("Range"))
+	if byteRange != "" {
+		// Only single byte ranges are supported; anything else gets the full body.
+		if !strings.HasPrefix(byteRange, "bytes=") || strings.Contains(byteRange, ",") {
+			byteRange = ""
+		}
+		// A stale If-Range validator means the client's partial copy is outdated.
+		if ifRange := strings.TrimSpace(c.GetHeader("If-Range")); ifRange != "" && ifRange != info.ETag {
+			byteRange = ""
+		}
+	}
+
+	stream, err := storageService.OpenObject(ctx, attachment.ObjectKey, byteRange)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidRange):
+			c.Header("Content-Range", "bytes */"+strconv.FormatInt(info.Size, 10))
+			apierror.Respond(c, http.StatusRequestedRangeNotSatisfiable, apierror.CodeRangeNotSatisfiable, "requested range not satisfiable")
+		case errors.Is(err, storage.ErrObjectNotFound):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeAttachmentNotFound, "attachment not found")
+		default:
+			apierror.Respond(c, http.StatusBadGateway, apierror.CodeStorageError, "failed to load attachment")
+		}
+		return
+	}
+	defer stream.Body.Close()
+
+	contentType := attachment.ContentType
+	if contentType == "" {
+		contentType = stream.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	headers := map[string]string{
+		"Content-Disposition": storageService.ContentDisposition(contentType, attachment.FileName),
+	}
+
+	status := http.StatusOK
+	if stream.ContentRange != "" {
+		status = http.StatusPartialContent
+		headers["Content-Range"] = stream.ContentRange
+	}
+
+	c.DataFromReader(status, stream.ContentLength, contentType, stream.Body, headers)
+}
+
+// etagMatches reports whether an If-None-Match header lists the given ETag.
+func etagMatches(header, etag string) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -1,107 +1,365 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"bafachat/internal/apierror"
+	"bafachat/internal/avatars"
 	"bafachat/internal/models"
+	"bafachat/internal/storage"
+	"bafachat/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
+const (
+	defaultMaxAttachmentsPerMessage = 10
+	defaultMaxAttachmentTotalMB     = 250
+)
+
+// attachmentPolicy captures deployment-wide limits on the files attached to a single message.
+type attachmentPolicy struct {
+	// MaxPerMessage is the largest number of attachments a message may carry.
+	MaxPerMessage int
+	// MaxTotalBytes caps the combined declared size of a message's attachments; 0 means no cap.
+	MaxTotalBytes int64
+}
+
+// attachmentPolicyFromEnv reads ATTACHMENT_MAX_PER_MESSAGE and ATTACHMENT_MAX_TOTAL_MB.
+func attachmentPolicyFromEnv() attachmentPolicy {
+	policy := attachmentPolicy{
+		MaxPerMessage: defaultMaxAttachmentsPerMessage,
+		MaxTotalBytes: defaultMaxAttachmentTotalMB * 1024 * 1024,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ATTACHMENT_MAX_PER_MESSAGE")); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			policy.MaxPerMessage = value
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ATTACHMENT_MAX_TOTAL_MB")); raw != "" {
+		if value, err := strconv.ParseInt(raw, 10, 64); err == nil && value >= 0 {
+			policy.MaxTotalBytes = value * 1024 * 1024
+		}
+	}
+
+	return policy
+}
+
+// validate returns a client-facing error when a message's attachments exceed the policy.
+func (p attachmentPolicy) validate(count int, totalBytes int64) error {
+	if count > p.MaxPerMessage {
+		return fmt.Errorf("a message can include at most %d attachments", p.MaxPerMessage)
+	}
+
+	if p.MaxTotalBytes > 0 && totalBytes > p.MaxTotalBytes {
+		return fmt.Errorf("attachments exceed the combined limit of %d bytes per message", p.MaxTotalBytes)
+	}
+
+	return nil
+}
+
+const maxAttachmentAltTextLength = 1000
+
+var (
+	errAttachmentNotUploaded = errors.New("attachment object has not been uploaded")
+	errAttachmentMismatch    = errors.New("uploaded object does not match the attachment")
+	errAttachmentAltTooLong  = fmt.Errorf("alt_text must be at most %d characters", maxAttachmentAltTextLength)
+)
+
+// normalizeAttachmentAltText trims alt text and checks its length.
+func normalizeAttachmentAltText(altText string) (string, error) {
+	altText = strings.TrimSpace(altText)
+	if utf8.RuneCountInString(altText) > maxAttachmentAltTextLength {
+		return "", errAttachmentAltTooLong
+	}
+
+	return altText, nil
+}
+
+// verifyUploadedAttachment checks a presigned upload against the size and type
+// the client declares for it when creating the message.
+func verifyUploadedAttachment(ctx context.Context, storageService *storage.Service, attachment models.MessageAttachment) error {
+	info, err := storageService.StatObject(ctx, attachment.ObjectKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			return errAttachmentNotUploaded
+		}
+		return err
+	}
+
+	if info.Size != attachment.FileSize {
+		return fmt.Errorf("%w: stored size is %d bytes, not %d", errAttachmentMismatch, info.Size, attachment.FileSize)
+	}
+
+	if stored, declared := attachmentMediaType(info.ContentType), attachmentMediaType(attachment.ContentType); stored != declared {
+		return fmt.Errorf("%w: stored content type is %q, not %q", errAttachmentMismatch, stored, declared)
+	}
+
+	return nil
+}
+
+// attachmentMediaType lowercases a content type and drops its parameters.
+func attachmentMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	return strings.ToLower(mediaType)
+}
+
 type presignAttachmentRequest struct {
 	FileName    string `json:"file_name" binding:"required"`
 	ContentType string `json:"content_type"`
 	FileSize    int64  `json:"file_size" binding:"required"`
 }
 
+type presignAttachmentBatchRequest struct {
+	Files []presignAttachmentRequest `json:"files" binding:"required,dive"`
+}
+
 // CreateAttachmentUpload issues a pre-signed upload URL for the caller to upload an attachment directly to object storage.
 func CreateAttachmentUpload(c *gin.Context) {
 	storageService, ok := getStorageService(c)
 	if !ok {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file uploads are not configured"})
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
 		return
 	}
 
 	channelIDParam := c.Param("id")
 	channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	var channel models.Channel
 	if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
 		return
 	}
 
 	if channel.Type != models.ChannelTypeText {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "attachments are only supported in text channels"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "attachments are only supported in text channels")
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
 		return
 	}
 
 	if err := ensureServerMembership(db.WithContext(c), channel.ServerID, claims.UserID); err != nil {
 		switch err {
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
 		}
 		return
 	}
 
+	if err := ensureChannelAccess(db.WithContext(c), channel, claims.UserID); err != nil {
+		respondChannelAccessError(c, err)
+		return
+	}
+
 	var req presignAttachmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	req.FileName = strings.TrimSpace(req.FileName)
 	if req.FileName == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file_name is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "file_name is required")
 		return
 	}
 
 	if req.FileSize <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file_size must be greater than 0"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "file_size must be greater than 0")
+		return
+	}
+
+	if err := checkServerStorageQuota(db.WithContext(c), channel.ServerID, req.FileSize); err != nil {
+		respondStorageQuotaError(c, err)
 		return
 	}
 
 	signature, err := storageService.PresignUpload(c.Request.Context(), req.FileName, req.ContentType, req.FileSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := recordUploadIntents(db.WithContext(c), claims.UserID, channel.ID, []*storage.UploadSignature{signature}, []int64{req.FileSize}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to record upload")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": serializeUploadSignature(signature),
+	})
+}
+
+// CreateAttachmentUploadBatch issues pre-signed upload URLs for several attachments in a single request.
+func CreateAttachmentUploadBatch(c *gin.Context) {
+	storageService, ok := getStorageService(c)
+	if !ok {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
+		return
+	}
+
+	channelIDParam := c.Param("id")
+	channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+
+	claims, ok := getUserClaims(c)
+	if !ok {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
+		return
+	}
+
+	var channel models.Channel
+	if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
+		return
+	}
+
+	if channel.Type != models.ChannelTypeText {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "attachments are only supported in text channels")
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
+		return
+	}
+
+	if err := ensureServerMembership(db.WithContext(c), channel.ServerID, claims.UserID); err != nil {
+		switch err {
+		case errServerMembershipRequired:
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
+		}
+		return
+	}
+
+	if err := ensureChannelAccess(db.WithContext(c), channel, claims.UserID); err != nil {
+		respondChannelAccessError(c, err)
+		return
+	}
+
+	var req presignAttachmentBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(req.Files) == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeFileRequired, "at least one file is required")
+		return
+	}
+
+	policy := attachmentPolicyFromEnv()
+	if err := policy.validate(len(req.Files), 0); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var totalSize int64
+	for index := range req.Files {
+		req.Files[index].FileName = strings.TrimSpace(req.Files[index].FileName)
+		if req.Files[index].FileName == "" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, fmt.Sprintf("files[%d]: file_name is required", index))
+			return
+		}
+
+		if req.Files[index].FileSize <= 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, fmt.Sprintf("files[%d]: file_size must be greater than 0", index))
+			return
+		}
+
+		totalSize += req.Files[index].FileSize
+	}
+
+	if err := policy.validate(len(req.Files), totalSize); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := checkServerStorageQuota(db.WithContext(c), channel.ServerID, totalSize); err != nil {
+		respondStorageQuotaError(c, err)
+		return
+	}
+
+	uploads := make([]gin.H, 0, len(req.Files))
+	signatures := make([]*storage.UploadSignature, 0, len(req.Files))
+	fileSizes := make([]int64, 0, len(req.Files))
+	for index, file := range req.Files {
+		signature, err := storageService.PresignUpload(c.Request.Context(), file.FileName, file.ContentType, file.FileSize)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, fmt.Sprintf("files[%d]: %v", index, err))
+			return
+		}
+
+		uploads = append(uploads, serializeUploadSignature(signature))
+		signatures = append(signatures, signature)
+		fileSizes = append(fileSizes, file.FileSize)
+	}
+
+	if err := recordUploadIntents(db.WithContext(c), claims.UserID, channel.ID, signatures, fileSizes); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to record uploads")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
-			"upload_url": signature.UploadURL,
-			"method":     signature.Method,
-			"headers":    signature.Headers,
-			"object_key": signature.ObjectKey,
-			"file_url":   signature.FileURL,
-			"expires_at": signature.ExpiresAt.Format(time.RFC3339),
+			"uploads": uploads,
 		},
 	})
 }
@@ -110,68 +368,118 @@ func CreateAttachmentUpload(c *gin.Context) {
 func UploadAttachmentMessage(c *gin.Context) {
 	storageService, ok := getStorageService(c)
 	if !ok {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file uploads are not configured"})
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
 		return
 	}
 
 	channelIDParam := c.Param("id")
 	channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	var channel models.Channel
 	if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
 		return
 	}
 
 	if channel.Type != models.ChannelTypeText {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "attachments are only supported in text channels"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "attachments are only supported in text channels")
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
 		return
 	}
 
 	if err := ensureServerMembership(db.WithContext(c), channel.ServerID, claims.UserID); err != nil {
 		switch err {
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
+		}
+		return
+	}
+
+	if err := ensureChannelAccess(db.WithContext(c), channel, claims.UserID); err != nil {
+		respondChannelAccessError(c, err)
+		return
+	}
+
+	var ttlSeconds *int
+	if raw := strings.TrimSpace(c.PostForm("ttl_seconds")); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, errInvalidMessageTTL)
+			return
+		}
+		if err := validateMessageTTL(value); err != nil {
+			respondError(c, http.StatusBadRequest, err)
+			return
 		}
+		ttlSeconds = &value
+	}
+
+	if !enforceMessageRateLimit(c, channel.ID, fmt.Sprintf("user:%d", claims.UserID)) {
+		return
+	}
+
+	if !enforceSlowmode(c, db.WithContext(c), channel, claims.UserID) {
+		return
+	}
+
+	// Filter before uploading so a blocked message leaves nothing in storage.
+	content, ok := filterMessageContent(c, db.WithContext(c), channel.ServerID, strings.TrimSpace(c.PostForm("content")),
+		"channel_id", channel.ID, "user_id", claims.UserID)
+	if !ok {
 		return
 	}
 
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeFileRequired, "file is required")
 		return
 	}
 
 	if fileHeader.Size <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file must be greater than 0 bytes"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "file must be greater than 0 bytes")
+		return
+	}
+
+	if err := attachmentPolicyFromEnv().validate(1, fileHeader.Size); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	altText, err := normalizeAttachmentAltText(c.PostForm("alt_text"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	file, err := fileHeader.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
 		return
 	}
 	defer file.Close()
@@ -181,23 +489,69 @@ func UploadAttachmentMessage(c *gin.Context) {
 		contentType = "application/octet-stream"
 	}
 
-	uploadResult, err := storageService.UploadObject(c.Request.Context(), fileHeader.Filename, contentType, fileHeader.Size, file)
+	var body io.ReadSeeker = file
+	fileSize := fileHeader.Size
+	if avatars.MetadataStrippingEnabled() && avatars.CanStripMetadata(contentType) && fileSize <= avatars.MaxMetadataStripSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
+			return
+		}
+
+		data = stripImageMetadata(c, data, contentType)
+		body = bytes.NewReader(data)
+		fileSize = int64(len(data))
+	}
+
+	contentHash, err := hashContent(body)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
 		return
 	}
 
-	attachments := []models.MessageAttachment{
-		{
-			ObjectKey:   uploadResult.ObjectKey,
-			URL:         uploadResult.FileURL,
-			FileName:    fileHeader.Filename,
-			ContentType: contentType,
-			FileSize:    fileHeader.Size,
-		},
+	attachment := models.MessageAttachment{
+		FileName:    fileHeader.Filename,
+		ContentType: contentType,
+		FileSize:    fileSize,
+		ContentHash: contentHash,
+		AltText:     altText,
+	}
+
+	// Bytes the server already stores are referenced rather than uploaded again.
+	stored, err := findStoredAttachment(db.WithContext(c), channel.ServerID, contentHash)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to look up attachment")
+		return
+	}
+
+	uploadAttachment := func() bool {
+		if err := checkServerStorageQuota(db.WithContext(c), channel.ServerID, fileSize); err != nil {
+			respondStorageQuotaError(c, err)
+			return false
+		}
+
+		upload := storageService.UploadObject
+		if threshold := storageService.MultipartThreshold(); threshold > 0 && fileSize > threshold {
+			upload = storageService.UploadLargeObject
+		}
+
+		uploadResult, err := upload(c.Request.Context(), fileHeader.Filename, contentType, fileSize, body)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, err)
+			return false
+		}
+
+		attachment.ObjectKey = uploadResult.ObjectKey
+		attachment.URL = uploadResult.FileURL
+		return true
+	}
+
+	if stored != nil {
+		reuseStoredAttachment(&attachment, *stored)
+	} else if !uploadAttachment() {
+		return
 	}
 
-	content := strings.TrimSpace(c.PostForm("content"))
 	messageType := models.MessageTypeFile
 	if content != "" {
 		messageType = models.MessageTypeFile
@@ -205,43 +559,81 @@ func UploadAttachmentMessage(c *gin.Context) {
 
 	var createdMessage models.Message
 
-	if err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+	createMessage := func(tx *gorm.DB) error {
+		if stored != nil {
+			if err := lockStoredAttachment(tx, stored.ID); err != nil {
+				return err
+			}
+		}
+
 		message := models.Message{
 			Content:   content,
 			UserID:    claims.UserID,
 			ChannelID: channel.ID,
 			Type:      messageType,
+			ExpiresAt: messageExpiry(channel, ttlSeconds, time.Now()),
 		}
 
 		if err := tx.Create(&message).Error; err != nil {
 			return err
 		}
 
-		for i := range attachments {
-			attachments[i].MessageID = message.ID
-		}
+		attachments := []models.MessageAttachment{attachment}
+		attachments[0].MessageID = message.ID
 
 		if err := tx.Create(&attachments).Error; err != nil {
 			return err
 		}
 
-		if err := tx.Preload("User").Preload("Attachments").First(&createdMessage, message.ID).Error; err != nil {
+		if stored == nil {
+			if err := addServerStorageUsage(tx, channel.ServerID, attachments); err != nil {
+				return err
+			}
+		}
+
+		if err := createMessageMentions(tx, message, channel.ServerID); err != nil {
+			return err
+		}
+
+		if err := createMessageEmojis(tx, message, channel.ServerID); err != nil {
+			return err
+		}
+
+		if err := tx.Preload("User").Preload("Attachments").Preload("Mentions.User", preloadMentionUsers).Preload("Emojis.Emoji").First(&createdMessage, message.ID).Error; err != nil {
 			return err
 		}
 
 		return nil
-	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create message"})
-		return
 	}
 
-	serialized := serializeMessage(createdMessage)
+	err = db.WithContext(c).Transaction(createMessage)
+	if errors.Is(err, errStoredAttachmentGone) {
+		// The shared object's last reference was deleted meanwhile, so store our own copy.
+		stored = nil
+		attachment = models.MessageAttachment{
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			FileSize:    attachment.FileSize,
+			ContentHash: attachment.ContentHash,
+			AltText:     attachment.AltText,
+		}
+		if !uploadAttachment() {
+			return
+		}
+		err = db.WithContext(c).Transaction(createMessage)
+	}
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create message")
+		return
+	}
 
 	if len(createdMessage.Attachments) > 0 {
-		createdMessage.Attachments = generateAttachmentPreviews(c.Request.Context(), db, storageService, createdMessage.Attachments)
-		serialized = serializeMessage(createdMessage)
+		createdMessage.Attachments = prepareAttachmentPreviews(c, db, storageService, createdMessage)
 	}
 
+	applyAuthorNickname(db.WithContext(c), &createdMessage)
+	serialized := serializeMessage(createdMessage)
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Message created",
 		"data": gin.H{
@@ -249,14 +641,81 @@ func UploadAttachmentMessage(c *gin.Context) {
 		},
 	})
 
-	if hub, ok := getWebSocketHub(c); ok {
-		_ = hub.Publish(gin.H{
-			"type": "message.created",
-			"data": gin.H{
-				"message":    serialized,
-				"channel_id": channel.ID,
-				"server_id":  channel.ServerID,
-			},
-		})
+	publishToChannel(c, db, channel, websocket.MessageCreated(serialized, channel.ID, channel.ServerID))
+
+	notifyMentionedUsers(c, channel, createdMessage, serialized)
+	queueLinkPreview(c, db, createdMessage)
+}
+
+// stripImageMetadata re-encodes a JPEG/PNG upload without EXIF data, returning
+// the original bytes unchanged when the image cannot be processed.
+func stripImageMetadata(c *gin.Context, data []byte, contentType string) []byte {
+	stripped, err := avatars.StripMetadata(data, contentType)
+	if err != nil {
+		requestLogger(c).Warn("failed to strip image metadata", "error", err)
+		return data
+	}
+
+	return stripped
+}
+
+// stripPresignedAttachmentMetadata strips metadata from a JPEG/PNG attachment
+// that was uploaded straight to storage and writes it back under the same key.
+// It returns the object's size afterwards, which is the declared size when the
+// object is left alone.
+func stripPresignedAttachmentMetadata(c *gin.Context, storageService *storage.Service, attachment models.MessageAttachment) int64 {
+	if !avatars.MetadataStrippingEnabled() || !avatars.CanStripMetadata(attachment.ContentType) || attachment.FileSize > avatars.MaxMetadataStripSize {
+		return attachment.FileSize
+	}
+
+	reader, _, _, err := storageService.GetObject(c.Request.Context(), attachment.ObjectKey)
+	if err != nil {
+		requestLogger(c).Warn("failed to fetch attachment to strip metadata", "object_key", attachment.ObjectKey, "error", err)
+		return attachment.FileSize
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, attachment.FileSize))
+	if err != nil {
+		requestLogger(c).Warn("failed to read attachment to strip metadata", "object_key", attachment.ObjectKey, "error", err)
+		return attachment.FileSize
+	}
+
+	disposition := storageService.ContentDisposition(attachment.ContentType, attachment.FileName)
+	return int64(len(replaceWithStrippedImage(c, storageService, attachment.ObjectKey, attachment.ContentType, disposition, data)))
+}
+
+// replaceWithStrippedImage strips metadata from the bytes of a presigned upload
+// and overwrites the stored object with the result. Presigned uploads never pass
+// through the API, so this is where they lose their EXIF data. It returns the
+// bytes now stored, which are the original ones when stripping is disabled or
+// unsupported, or when the object cannot be replaced.
+func replaceWithStrippedImage(c *gin.Context, storageService *storage.Service, objectKey, contentType, contentDisposition string, data []byte) []byte {
+	if !avatars.MetadataStrippingEnabled() || !avatars.CanStripMetadata(contentType) || len(data) > avatars.MaxMetadataStripSize {
+		return data
+	}
+
+	stripped, err := avatars.StripMetadata(data, contentType)
+	if err != nil {
+		requestLogger(c).Warn("failed to strip image metadata", "object_key", objectKey, "error", err)
+		return data
+	}
+
+	if err := storageService.ReplaceObject(c.Request.Context(), objectKey, contentType, contentDisposition, int64(len(stripped)), bytes.NewReader(stripped)); err != nil {
+		requestLogger(c).Warn("failed to replace image with stripped copy", "object_key", objectKey, "error", err)
+		return data
+	}
+
+	return stripped
+}
+
+func serializeUploadSignature(signature *storage.UploadSignature) gin.H {
+	return gin.H{
+		"upload_url": signature.UploadURL,
+		"method":     signature.Method,
+		"headers":    signature.Headers,
+		"object_key": signature.ObjectKey,
+		"file_url":   signature.FileURL,
+		"expires_at": signature.ExpiresAt.Format(time.RFC3339),
 	}
 }
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"testing"
+)
+
+func TestAttachmentPolicyValidate(t *testing.T) {
+	policy := attachmentPolicy{MaxPerMessage: 3, MaxTotalBytes: 1000}
+	uncapped := attachmentPolicy{MaxPerMessage: 3, MaxTotalBytes: 0}
+
+	tests := []struct {
+		name       string
+		policy     attachmentPolicy
+		count      int
+		totalBytes int64
+		wantErr    bool
+	}{
+		{name: "under both limits", policy: policy, count: 2, totalBytes: 500},
+		{name: "count at the limit", policy: policy, count: 3, totalBytes: 500},
+		{name: "count one over", policy: policy, count: 4, totalBytes: 500, wantErr: true},
+		{name: "size at the limit", policy: policy, count: 1, totalBytes: 1000},
+		{name: "size one byte over", policy: policy, count: 1, totalBytes: 1001, wantErr: true},
+		{name: "both at the limit", policy: policy, count: 3, totalBytes: 1000},
+		{name: "zero size cap allows any size", policy: uncapped, count: 3, totalBytes: 1 << 40},
+		{name: "zero size cap still limits count", policy: uncapped, count: 4, totalBytes: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.validate(tt.count, tt.totalBytes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate(%d, %d) error = %v, wantErr %v", tt.count, tt.totalBytes, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttachmentPolicyFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		perMsg  string
+		totalMB string
+		want    attachmentPolicy
+	}{
+		{name: "defaults", want: attachmentPolicy{MaxPerMessage: 10, MaxTotalBytes: 250 << 20}},
+		{name: "overrides", perMsg: "4", totalMB: "8", want: attachmentPolicy{MaxPerMessage: 4, MaxTotalBytes: 8 << 20}},
+		{name: "zero size disables the cap", totalMB: "0", want: attachmentPolicy{MaxPerMessage: 10, MaxTotalBytes: 0}},
+		{name: "invalid values keep defaults", perMsg: "0", totalMB: "-1", want: attachmentPolicy{MaxPerMessage: 10, MaxTotalBytes: 250 << 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ATTACHMENT_MAX_PER_MESSAGE", tt.perMsg)
+			t.Setenv("ATTACHMENT_MAX_TOTAL_MB", tt.totalMB)
+			if got := attachmentPolicyFromEnv(); got != tt.want {
+				t.Fatalf("attachmentPolicyFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
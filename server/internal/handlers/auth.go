@@ -8,13 +8,13 @@ import (
 	"strings"
 	"time"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/auth"
 	"bafachat/internal/email"
 	"bafachat/internal/models"
 	"bafachat/internal/queue"
 
 	"github.com/gin-gonic/gin"
-	"github.com/hibiken/asynq"
 	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
 )
@@ -25,13 +25,13 @@ const defaultAppBaseURL = "http://localhost:3000"
 func Register(c *gin.Context) {
 	var req models.RegisterRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
@@ -39,24 +39,29 @@ func Register(c *gin.Context) {
 	emailAddr := strings.ToLower(strings.TrimSpace(req.Email))
 	password := strings.TrimSpace(req.Password)
 
+	if err := auth.ValidatePassword(password); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
 	if err := ensureUniqueUser(db, username, emailAddr); err != nil {
 		status := http.StatusInternalServerError
-		if errors.Is(err, errUserConflict) {
+		if errors.Is(err, errUserConflict) || errors.Is(err, errUsernameReserved) {
 			status = http.StatusConflict
 		}
-		c.JSON(status, gin.H{"error": err.Error()})
+		respondError(c, status, err)
 		return
 	}
 
 	hashedPassword, err := auth.HashPassword(password)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid password"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPassword, "invalid password")
 		return
 	}
 
 	verificationToken, err := auth.GenerateRandomToken(32)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate verification token"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate verification token")
 		return
 	}
 
@@ -72,11 +77,11 @@ func Register(c *gin.Context) {
 	if err := db.WithContext(c).Create(&user).Error; err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			c.JSON(http.StatusConflict, gin.H{"error": errUserConflict.Error()})
+			respondError(c, http.StatusConflict, errUserConflict)
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create user")
 		return
 	}
 
@@ -94,13 +99,13 @@ func Register(c *gin.Context) {
 func Login(c *gin.Context) {
 	var req models.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
@@ -113,43 +118,52 @@ func Login(c *gin.Context) {
 		emailAddr := strings.ToLower(identifier)
 		if err := db.WithContext(c).Where("email = ?", emailAddr).First(&user).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+				apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "invalid credentials")
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query user"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to query user")
 			return
 		}
 	} else {
 		// Use case-insensitive comparison for username
 		if err := db.WithContext(c).Where("LOWER(username) = LOWER(?)", identifier).First(&user).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+				apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "invalid credentials")
 				return
 			}
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to query user"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to query user")
 			return
 		}
 	}
 
 	if err := auth.ComparePassword(user.Password, password); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidCredentials, "invalid credentials")
 		return
 	}
 
+	if auth.PasswordNeedsRehash(user.Password) {
+		upgradePasswordHash(db, c, &user, password)
+	}
+
 	if user.EmailVerifiedAt == nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": "email verification required"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeEmailNotVerified, "email verification required")
 		return
 	}
 
-	token, expiresAt, err := auth.GenerateJWT(user)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to generate auth token"})
+	if user.TwoFactorEnabledAt != nil {
+		startTwoFactorChallenge(c, db, user)
 		return
 	}
 
-	if err := touchLastLogin(db, c, &user); err != nil {
-		// Non-blocking: log and continue serving response.
-		c.Error(err) // Logged by gin
+	completeLogin(c, db, user)
+}
+
+// completeLogin starts a session for an authenticated user and responds with its JWT.
+func completeLogin(c *gin.Context, db *gorm.DB, user models.User) {
+	token, expiresAt, err := issueSession(c, db, &user)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -162,27 +176,51 @@ func Login(c *gin.Context) {
 	})
 }
 
+// issueSession records a new session for the user and returns its signed JWT.
+func issueSession(c *gin.Context, db *gorm.DB, user *models.User) (string, time.Time, error) {
+	sessionID, err := auth.NewSessionID()
+	if err != nil {
+		return "", time.Time{}, errors.New("failed to generate auth token")
+	}
+
+	token, expiresAt, err := auth.GenerateJWT(*user, sessionID)
+	if err != nil {
+		return "", time.Time{}, errors.New("failed to generate auth token")
+	}
+
+	if err := createSession(db.WithContext(c), c, user.ID, sessionID, expiresAt); err != nil {
+		return "", time.Time{}, errors.New("failed to create session")
+	}
+
+	if err := touchLastLogin(db, c, user); err != nil {
+		// Non-blocking: log and continue serving response.
+		c.Error(err) // Logged by gin
+	}
+
+	return token, expiresAt, nil
+}
+
 // VerifyEmail confirms a user's email using the provided verification token.
 func VerifyEmail(c *gin.Context) {
 	token := strings.TrimSpace(c.Query("token"))
 	if token == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "verification token is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeTokenRequired, "verification token is required")
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	var user models.User
 	if err := db.WithContext(c).Where("email_verification_token = ?", token).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired verification token"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidVerificationToken, "invalid or expired verification token")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify email"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify email")
 		return
 	}
 
@@ -193,7 +231,7 @@ func VerifyEmail(c *gin.Context) {
 	}
 
 	if err := db.WithContext(c).Model(&user).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update verification status"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update verification status")
 		return
 	}
 
@@ -208,8 +246,17 @@ func VerifyEmail(c *gin.Context) {
 	})
 }
 
-// Logout handles user logout.
+// Logout handles user logout, revoking the session behind the bearer token when one is supplied.
 func Logout(c *gin.Context) {
+	if claims := optionalBearerClaims(c); claims != nil && claims.ID != "" {
+		if db, ok := getDB(c); ok {
+			if err := revokeSessionByID(db.WithContext(c), claims.UserID, claims.ID); err != nil {
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to revoke session")
+				return
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "User logged out successfully",
 	})
@@ -219,29 +266,29 @@ func Logout(c *gin.Context) {
 func GetCurrentUser(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claimsValue, exists := c.Get("userClaims")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	claims, ok := claimsValue.(*auth.Claims)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authentication state"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "invalid authentication state")
 		return
 	}
 
 	var user models.User
 	if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
 		return
 	}
 
@@ -250,10 +297,13 @@ func GetCurrentUser(c *gin.Context) {
 
 // UpdateCurrentUser updates the current user's profile placeholder.
 func UpdateCurrentUser(c *gin.Context) {
-	c.JSON(http.StatusNotImplemented, gin.H{"error": "update profile not implemented"})
+	apierror.Respond(c, http.StatusNotImplemented, apierror.CodeNotImplemented, "update profile not implemented")
 }
 
-var errUserConflict = errors.New("username or email already in use")
+var (
+	errUserConflict     = errors.New("username or email already in use")
+	errUsernameReserved = errors.New("username is reserved")
+)
 
 func isEmailFormat(identifier string) bool {
 	// Basic email validation: contains @ with non-empty parts before and after
@@ -272,7 +322,13 @@ func isEmailFormat(identifier string) bool {
 	return dotIndex > 0 && dotIndex < len(afterAt)-1
 }
 
+// ensureUniqueUser rejects reserved usernames and usernames or emails that are
+// already taken. Any future username change should go through it too.
 func ensureUniqueUser(db *gorm.DB, username, email string) error {
+	if auth.IsReservedUsername(username) || strings.EqualFold(strings.TrimSpace(username), models.DeletedUserUsername) {
+		return errUsernameReserved
+	}
+
 	var count int64
 	if err := db.Model(&models.User{}).
 		Where("LOWER(username) = ? OR LOWER(email) = ?", strings.ToLower(username), strings.ToLower(email)).
@@ -297,6 +353,23 @@ func touchLastLogin(db *gorm.DB, c *gin.Context, user *models.User) error {
 	return nil
 }
 
+// upgradePasswordHash rehashes the password with the current algorithm and cost
+// after a successful login. Failures are logged and leave the old hash in place.
+func upgradePasswordHash(db *gorm.DB, c *gin.Context, user *models.User, password string) {
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		requestLogger(c).Warn("failed to rehash password", "user_id", user.ID, "error", err)
+		return
+	}
+
+	if err := db.WithContext(c).Model(user).Update("password", hashed).Error; err != nil {
+		requestLogger(c).Warn("failed to store rehashed password", "user_id", user.ID, "error", err)
+		return
+	}
+
+	user.Password = hashed
+}
+
 func serializeUser(user models.User) gin.H {
 	var emailVerifiedAt string
 	if user.EmailVerifiedAt != nil {
@@ -308,65 +381,47 @@ func serializeUser(user models.User) gin.H {
 		lastLogin = user.LastLoginAt.Format(time.RFC3339)
 	}
 
+	var lastSeen string
+	if user.LastSeenAt != nil {
+		lastSeen = user.LastSeenAt.Format(time.RFC3339)
+	}
+
 	return gin.H{
-		"id":                user.ID,
-		"username":          user.Username,
-		"email":             user.Email,
-		"avatar":            user.Avatar,
-		"email_verified_at": emailVerifiedAt,
-		"last_login_at":     lastLogin,
-		"created_at":        user.CreatedAt.Format(time.RFC3339),
-		"updated_at":        user.UpdatedAt.Format(time.RFC3339),
+		"id":                 user.ID,
+		"username":           user.Username,
+		"email":              user.Email,
+		"avatar":             user.Avatar,
+		"default_avatar":     defaultAvatarURL(user.ID),
+		"email_verified_at":  emailVerifiedAt,
+		"two_factor_enabled": user.TwoFactorEnabledAt != nil,
+		"pending_email":      user.PendingEmail,
+		"last_login_at":      lastLogin,
+		"last_seen_at":       lastSeen,
+		"presence_status":    user.PresenceStatus,
+		"read_receipts":      user.ReadReceiptsEnabled,
+		"created_at":         user.CreatedAt.Format(time.RFC3339),
+		"updated_at":         user.UpdatedAt.Format(time.RFC3339),
 	}
 }
 
 func sendVerificationEmail(c *gin.Context, user *models.User) {
-	queueClient, hasQueue := getQueueClient(c)
-	emailService, hasEmail := getEmailService(c)
-	if !hasQueue && !hasEmail {
-		return
-	}
-
 	baseURL := strings.TrimSpace(os.Getenv("APP_BASE_URL"))
 	if baseURL == "" {
 		baseURL = defaultAppBaseURL
 	}
 
 	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", strings.TrimRight(baseURL, "/"), user.EmailVerificationToken)
-	subject := "Verify your BafaChat account"
-	htmlBody := fmt.Sprintf(`<p>Hi %s,</p><p>Thanks for joining BafaChat! Confirm your email by clicking the button below:</p><p><a href="%s" style="background-color:#38bdf8;border-radius:8px;color:#0f172a;padding:10px 16px;text-decoration:none;font-weight:600;">Verify Email</a></p><p>If the button doesn't work, copy and paste this link into your browser:</p><p>%s</p><p>— The BafaChat Team</p>`, user.Username, verifyURL, verifyURL)
-	textBody := fmt.Sprintf("Hi %s,\n\nThanks for joining BafaChat! Confirm your email by visiting the link below:\n%s\n\n— The BafaChat Team", user.Username, verifyURL)
-
-	payload := queue.EmailTaskPayload{
-		To:       user.Email,
-		Subject:  subject,
-		HTMLBody: htmlBody,
-		TextBody: textBody,
-		Tag:      "auth-email-verification",
+
+	deliverTemplateEmail(c, queue.TemplateEmailTaskPayload{
+		To:            user.Email,
+		TemplateAlias: email.TemplateEmailVerification,
+		Model: map[string]any{
+			"username":   user.Username,
+			"verify_url": verifyURL,
+		},
+		Tag: "auth-email-verification",
 		Meta: map[string]string{
 			"user_id": fmt.Sprintf("%d", user.ID),
 		},
-	}
-
-	ctx := c.Request.Context()
-
-	if hasQueue {
-		task, err := queue.NewEmailTask(payload)
-		if err == nil {
-			if _, enqueueErr := queueClient.Enqueue(task, asynq.MaxRetry(5)); enqueueErr == nil {
-				return
-			}
-		}
-	}
-
-	if hasEmail {
-		_ = emailService.SendEmail(ctx, email.SendEmailInput{
-			To:       payload.To,
-			Subject:  payload.Subject,
-			HTMLBody: payload.HTMLBody,
-			TextBody: payload.TextBody,
-			Tag:      payload.Tag,
-			Metadata: payload.Meta,
-		})
-	}
+	})
 }
@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/avatars"
 	"bafachat/internal/models"
+	"bafachat/internal/storage"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -20,30 +23,30 @@ import (
 func PresignUserAvatarUpload(c *gin.Context) {
 	storageService, ok := getStorageService(c)
 	if !ok {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file uploads are not configured"})
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
 		return
 	}
 
 	_, ok = getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	var req presignAttachmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	if !avatars.IsValidImageType(req.ContentType) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image type, must be jpeg, png, gif, or webp"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidImageType, "invalid image type, must be jpeg, png, gif, or webp")
 		return
 	}
 
 	signature, err := storageService.PresignAvatarUpload(c.Request.Context(), req.FileName, req.ContentType, req.FileSize, "users")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -63,19 +66,19 @@ func PresignUserAvatarUpload(c *gin.Context) {
 func SetUserAvatar(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	storageService, ok := getStorageService(c)
 	if !ok {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file uploads are not configured"})
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
@@ -88,18 +91,18 @@ func SetUserAvatar(c *gin.Context) {
 		// Direct upload path
 		fileHeader, err := c.FormFile("file")
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeFileRequired, "file is required")
 			return
 		}
 
 		if fileHeader.Size <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "file must be greater than 0 bytes"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "file must be greater than 0 bytes")
 			return
 		}
 
 		f, err := fileHeader.Open()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
 			return
 		}
 		defer f.Close()
@@ -107,7 +110,7 @@ func SetUserAvatar(c *gin.Context) {
 		// Read file into memory (avatars are expected to be small)
 		buf, err := io.ReadAll(f)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to read file"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
 			return
 		}
 
@@ -117,10 +120,14 @@ func SetUserAvatar(c *gin.Context) {
 		}
 
 		if !avatars.IsValidImageType(detectedContentType) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image type"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidImageType, "invalid image type")
 			return
 		}
 
+		if avatars.MetadataStrippingEnabled() && avatars.CanStripMetadata(detectedContentType) {
+			buf = stripImageMetadata(c, buf, detectedContentType)
+		}
+
 		// Parse optional crop_data
 		var cropData *avatars.CropData
 		cropJSON := c.PostForm("crop_data")
@@ -147,27 +154,27 @@ func SetUserAvatar(c *gin.Context) {
 			"users",
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload original avatar"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to upload original avatar")
 			return
 		}
 
 		// Process and upload thumbnail
-		processedBytes, processedContentType, err := avatars.ProcessAvatar(bytes.NewReader(buf), detectedContentType, cropData)
+		processedBytes, processedContentType, err := avatars.ProcessAvatarWithOptions(bytes.NewReader(buf), detectedContentType, cropData, avatarOptions(c))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to process avatar: %v", err)})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, fmt.Sprintf("failed to process avatar: %v", err))
 			return
 		}
 
 		thumbnailResult, err := storageService.UploadAvatarObject(
 			c.Request.Context(),
-			"avatar-thumbnail.jpg",
+			"avatar-thumbnail"+avatars.ThumbnailExtension(processedContentType),
 			processedContentType,
 			int64(len(processedBytes)),
 			bytes.NewReader(processedBytes),
 			"users",
 		)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload processed avatar"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to upload processed avatar")
 			return
 		}
 
@@ -176,7 +183,7 @@ func SetUserAvatar(c *gin.Context) {
 		if cropData != nil {
 			cropDataJSON, err = avatars.SerializeCropData(cropData)
 			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save crop data"})
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to save crop data")
 				return
 			}
 		}
@@ -184,10 +191,12 @@ func SetUserAvatar(c *gin.Context) {
 		// Update user record
 		var user models.User
 		if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
 			return
 		}
 
+		previousAvatar, previousOriginalKey := user.Avatar, user.AvatarOriginalKey
+
 		updates := map[string]interface{}{
 			"avatar":              thumbnailResult.FileURL,
 			"avatar_original_key": originalResult.ObjectKey,
@@ -195,13 +204,15 @@ func SetUserAvatar(c *gin.Context) {
 		}
 
 		if err := db.WithContext(c).Model(&user).Updates(updates).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update avatar"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update avatar")
 			return
 		}
 
+		removeReplacedAvatarObjects(c, storageService, previousAvatar, previousOriginalKey, originalResult.ObjectKey)
+
 		// Reload user to get updated values
 		if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload user"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to reload user")
 			return
 		}
 
@@ -217,22 +228,30 @@ func SetUserAvatar(c *gin.Context) {
 	// Fallback: existing presign-based flow (JSON body)
 	var req models.SetAvatarRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// Fetch the uploaded image from storage
 	objectReader, _, contentType, err := storageService.GetObject(c.Request.Context(), req.ObjectKey)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to retrieve uploaded image"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "failed to retrieve uploaded image")
 		return
 	}
 	defer objectReader.Close()
 
 	if !avatars.IsValidImageType(contentType) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image type"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidImageType, "invalid image type")
+		return
+	}
+
+	// The original is kept, so strip its metadata now that it has been uploaded
+	original, err := io.ReadAll(objectReader)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "failed to retrieve uploaded image")
 		return
 	}
+	original = replaceWithStrippedImage(c, storageService, req.ObjectKey, contentType, "", original)
 
 	// Convert CropData from models to avatars package type
 	var cropData *avatars.CropData
@@ -247,9 +266,9 @@ func SetUserAvatar(c *gin.Context) {
 	}
 
 	// Process the avatar (crop and resize)
-	processedBytes, processedContentType, err := avatars.ProcessAvatar(objectReader, contentType, cropData)
+	processedBytes, processedContentType, err := avatars.ProcessAvatarWithOptions(bytes.NewReader(original), contentType, cropData, avatarOptions(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to process avatar: %v", err)})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, fmt.Sprintf("failed to process avatar: %v", err))
 		return
 	}
 
@@ -257,14 +276,14 @@ func SetUserAvatar(c *gin.Context) {
 	thumbnailReader := bytes.NewReader(processedBytes)
 	thumbnailResult, err := storageService.UploadAvatarObject(
 		c.Request.Context(),
-		"avatar-thumbnail.jpg",
+		"avatar-thumbnail"+avatars.ThumbnailExtension(processedContentType),
 		processedContentType,
 		int64(len(processedBytes)),
 		thumbnailReader,
 		"users",
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload processed avatar"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to upload processed avatar")
 		return
 	}
 
@@ -273,7 +292,7 @@ func SetUserAvatar(c *gin.Context) {
 	if req.CropData != nil {
 		cropDataJSON, err = avatars.SerializeCropData(cropData)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save crop data"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to save crop data")
 			return
 		}
 	}
@@ -281,10 +300,12 @@ func SetUserAvatar(c *gin.Context) {
 	// Update user record
 	var user models.User
 	if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
 		return
 	}
 
+	previousAvatar, previousOriginalKey := user.Avatar, user.AvatarOriginalKey
+
 	updates := map[string]interface{}{
 		"avatar":              thumbnailResult.FileURL,
 		"avatar_original_key": req.ObjectKey,
@@ -292,13 +313,15 @@ func SetUserAvatar(c *gin.Context) {
 	}
 
 	if err := db.WithContext(c).Model(&user).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update avatar"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update avatar")
 		return
 	}
 
+	removeReplacedAvatarObjects(c, storageService, previousAvatar, previousOriginalKey, req.ObjectKey)
+
 	// Reload user to get updated values
 	if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to reload user")
 		return
 	}
 
@@ -314,22 +337,24 @@ func SetUserAvatar(c *gin.Context) {
 func DeleteUserAvatar(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	var user models.User
 	if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
 		return
 	}
 
+	previousAvatar, previousOriginalKey := user.Avatar, user.AvatarOriginalKey
+
 	updates := map[string]interface{}{
 		"avatar":              "",
 		"avatar_original_key": "",
@@ -337,13 +362,17 @@ func DeleteUserAvatar(c *gin.Context) {
 	}
 
 	if err := db.WithContext(c).Model(&user).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete avatar"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete avatar")
 		return
 	}
 
+	if storageService, ok := getStorageService(c); ok {
+		removeReplacedAvatarObjects(c, storageService, previousAvatar, previousOriginalKey, "")
+	}
+
 	// Reload user to get updated values
 	if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to reload user")
 		return
 	}
 
@@ -359,58 +388,58 @@ func DeleteUserAvatar(c *gin.Context) {
 func PresignServerAvatarUpload(c *gin.Context) {
 	storageService, ok := getStorageService(c)
 	if !ok {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file uploads are not configured"})
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	serverID := c.Param("serverID")
 	if serverID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "server ID is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "server ID is required")
 		return
 	}
 
 	var server models.Server
 	if err := db.WithContext(c).First(&server, serverID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
 	// Only server owner can update avatar
 	if server.OwnerID != claims.UserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only server owners can update the server avatar"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeOwnerRequired, "only server owners can update the server avatar")
 		return
 	}
 
 	var req presignAttachmentRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	if !avatars.IsValidImageType(req.ContentType) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image type, must be jpeg, png, gif, or webp"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidImageType, "invalid image type, must be jpeg, png, gif, or webp")
 		return
 	}
 
 	signature, err := storageService.PresignAvatarUpload(c.Request.Context(), req.FileName, req.ContentType, req.FileSize, "servers")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
@@ -430,62 +459,70 @@ func PresignServerAvatarUpload(c *gin.Context) {
 func SetServerAvatar(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	storageService, ok := getStorageService(c)
 	if !ok {
-		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "file uploads are not configured"})
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	serverID := c.Param("serverID")
 	if serverID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "server ID is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "server ID is required")
 		return
 	}
 
 	var server models.Server
 	if err := db.WithContext(c).First(&server, serverID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
 	// Only server owner can update avatar
 	if server.OwnerID != claims.UserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only server owners can update the server avatar"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeOwnerRequired, "only server owners can update the server avatar")
 		return
 	}
 
 	var req models.SetAvatarRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	// Fetch the uploaded image from storage
 	objectReader, _, contentType, err := storageService.GetObject(c.Request.Context(), req.ObjectKey)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to retrieve uploaded image"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "failed to retrieve uploaded image")
 		return
 	}
 	defer objectReader.Close()
 
 	if !avatars.IsValidImageType(contentType) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid image type"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidImageType, "invalid image type")
+		return
+	}
+
+	// The original is kept, so strip its metadata now that it has been uploaded
+	original, err := io.ReadAll(objectReader)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "failed to retrieve uploaded image")
 		return
 	}
+	original = replaceWithStrippedImage(c, storageService, req.ObjectKey, contentType, "", original)
 
 	// Convert CropData from models to avatars package type
 	var cropData *avatars.CropData
@@ -500,9 +537,9 @@ func SetServerAvatar(c *gin.Context) {
 	}
 
 	// Process the avatar (crop and resize)
-	processedBytes, processedContentType, err := avatars.ProcessAvatar(objectReader, contentType, cropData)
+	processedBytes, processedContentType, err := avatars.ProcessAvatarWithOptions(bytes.NewReader(original), contentType, cropData, avatarOptions(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to process avatar: %v", err)})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, fmt.Sprintf("failed to process avatar: %v", err))
 		return
 	}
 
@@ -510,14 +547,14 @@ func SetServerAvatar(c *gin.Context) {
 	thumbnailReader := bytes.NewReader(processedBytes)
 	thumbnailResult, err := storageService.UploadAvatarObject(
 		c.Request.Context(),
-		"server-avatar-thumbnail.jpg",
+		"server-avatar-thumbnail"+avatars.ThumbnailExtension(processedContentType),
 		processedContentType,
 		int64(len(processedBytes)),
 		thumbnailReader,
 		"servers",
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload processed avatar"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to upload processed avatar")
 		return
 	}
 
@@ -526,11 +563,13 @@ func SetServerAvatar(c *gin.Context) {
 	if req.CropData != nil {
 		cropDataJSON, err = avatars.SerializeCropData(cropData)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to save crop data"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to save crop data")
 			return
 		}
 	}
 
+	previousIcon, previousOriginalKey := server.Icon, server.IconOriginalKey
+
 	updates := map[string]interface{}{
 		"icon":              thumbnailResult.FileURL,
 		"icon_original_key": req.ObjectKey,
@@ -538,13 +577,15 @@ func SetServerAvatar(c *gin.Context) {
 	}
 
 	if err := db.WithContext(c).Model(&server).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update server avatar"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update server avatar")
 		return
 	}
 
+	removeReplacedAvatarObjects(c, storageService, previousIcon, previousOriginalKey, req.ObjectKey)
+
 	// Reload server to get updated values
 	if err := db.WithContext(c).Preload("Owner").First(&server, serverID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to reload server")
 		return
 	}
 
@@ -560,38 +601,40 @@ func SetServerAvatar(c *gin.Context) {
 func DeleteServerAvatar(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	serverID := c.Param("serverID")
 	if serverID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "server ID is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "server ID is required")
 		return
 	}
 
 	var server models.Server
 	if err := db.WithContext(c).First(&server, serverID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
 	// Only server owner can update avatar
 	if server.OwnerID != claims.UserID {
-		c.JSON(http.StatusForbidden, gin.H{"error": "only server owners can update the server avatar"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeOwnerRequired, "only server owners can update the server avatar")
 		return
 	}
 
+	previousIcon, previousOriginalKey := server.Icon, server.IconOriginalKey
+
 	updates := map[string]interface{}{
 		"icon":              "",
 		"icon_original_key": "",
@@ -599,13 +642,17 @@ func DeleteServerAvatar(c *gin.Context) {
 	}
 
 	if err := db.WithContext(c).Model(&server).Updates(updates).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete server avatar"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete server avatar")
 		return
 	}
 
+	if storageService, ok := getStorageService(c); ok {
+		removeReplacedAvatarObjects(c, storageService, previousIcon, previousOriginalKey, "")
+	}
+
 	// Reload server to get updated values
 	if err := db.WithContext(c).Preload("Owner").First(&server, serverID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reload server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to reload server")
 		return
 	}
 
@@ -616,3 +663,62 @@ func DeleteServerAvatar(c *gin.Context) {
 		},
 	})
 }
+
+// removeReplacedAvatarObjects deletes the thumbnail and original objects of an avatar
+// that is no longer referenced. The original is kept when it is reused by the new avatar,
+// as happens when re-cropping. Failures are logged rather than surfaced to the client.
+func removeReplacedAvatarObjects(c *gin.Context, storageService *storage.Service, previousURL, previousOriginalKey, currentOriginalKey string) {
+	keys := make([]string, 0, 2)
+	if key, ok := storageService.ObjectKeyFromURL(previousURL); ok {
+		keys = append(keys, key)
+	}
+	if previousOriginalKey != "" && previousOriginalKey != currentOriginalKey {
+		keys = append(keys, previousOriginalKey)
+	}
+
+	if len(keys) == 0 {
+		return
+	}
+
+	if err := storageService.DeleteObjects(c.Request.Context(), keys); err != nil {
+		requestLogger(c).Warn("failed to delete replaced avatar objects", "keys", keys, "error", err)
+	}
+}
+
+// avatarOptions returns the configured avatar processing options, opting into
+// WebP output when the uploading client accepts it.
+func avatarOptions(c *gin.Context) avatars.Options {
+	return avatars.OptionsFromEnv().ForAccept(c.GetHeader("Accept"))
+}
+
+// GetDefaultAvatar serves the identicon shown for a user without an uploaded avatar.
+// It is derived from the user ID alone, so it never changes and can be cached indefinitely.
+func GetDefaultAvatar(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || userID == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+		return
+	}
+
+	etag := fmt.Sprintf(`"identicon-%d"`, userID)
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	data, err := avatars.Identicon(fmt.Sprintf("user:%d", userID), avatars.OptionsFromEnv().Size)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to render avatar")
+		return
+	}
+
+	c.Data(http.StatusOK, "image/png", data)
+}
+
+// defaultAvatarURL is the API path of the user's identicon, for clients to show
+// when avatar is empty.
+func defaultAvatarURL(userID uint) string {
+	return fmt.Sprintf("/api/v1/users/%d/default-avatar", userID)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errServerBanned     = errors.New("you are banned from this server")
+	errServerBanExists  = errors.New("user is already banned")
+	errServerBanMissing = errors.New("ban not found")
+)
+
+// GetServerBans lists the active bans for a server.
+func GetServerBans(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageMembers, "you do not have permission to view bans"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var bans []models.ServerBan
+	if err := caller.DB.
+		Preload("User", func(tx *gorm.DB) *gorm.DB {
+			return tx.Select("id", "username", "avatar")
+		}).
+		Where("server_id = ?", serverID).
+		Order("created_at DESC").
+		Find(&bans).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load bans")
+		return
+	}
+
+	payload := make([]gin.H, 0, len(bans))
+	for _, ban := range bans {
+		payload = append(payload, serializeServerBan(ban))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"bans": payload}})
+}
+
+// CreateServerBan bans a user from a server, removing their membership and ending active voice sessions.
+func CreateServerBan(c *gin.Context) {
+	var req models.CreateServerBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageMembers, "you do not have permission to ban members"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if req.UserID == caller.Claims.UserID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeCannotBanSelf, "you cannot ban yourself")
+		return
+	}
+
+	var target models.User
+	if err := caller.DB.Select("id", "username", "avatar").First(&target, req.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return
+	}
+
+	ban := models.ServerBan{
+		ServerID: serverID,
+		UserID:   target.ID,
+		BannedBy: caller.Claims.UserID,
+		Reason:   strings.TrimSpace(req.Reason),
+	}
+
+	err = caller.DB.Transaction(func(tx *gorm.DB) error {
+		var membership models.ServerMember
+		if err := tx.Where("server_id = ? AND user_id = ?", serverID, target.ID).First(&membership).Error; err == nil {
+			if !canModerateMember(caller.Role(), membership.Role) {
+				return errServerPermissionRequired
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		banned, err := isUserBanned(tx, serverID, target.ID)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return errServerBanExists
+		}
+
+		if err := tx.Create(&ban).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("server_id = ? AND user_id = ?", serverID, target.ID).
+			Delete(&models.ServerMember{}).Error
+	})
+	if err != nil {
+		switch err {
+		case errServerPermissionRequired:
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeInsufficientRole, "you cannot ban a member with an equal or higher role")
+		case errServerBanExists:
+			respondError(c, http.StatusConflict, err)
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to ban user")
+		}
+		return
+	}
+
+	evictFromServerVoiceChannels(c, caller.DB, serverID, target.ID, "banned")
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventMemberBanned, gin.H{
+			"server_id": serverID,
+			"user_id":   target.ID,
+			"banned_by": caller.Claims.UserID,
+		}))
+		hub.RemoveServerMember(serverID, target.ID)
+	}
+
+	ban.User = target
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "User banned",
+		"data": gin.H{
+			"ban": serializeServerBan(ban),
+		},
+	})
+}
+
+// DeleteServerBan lifts a ban so the user may rejoin via an invite.
+func DeleteServerBan(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	targetIDValue, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil || targetIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageMembers, "you do not have permission to remove bans"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	result := caller.DB.
+		Where("server_id = ? AND user_id = ?", serverID, uint(targetIDValue)).
+		Delete(&models.ServerBan{})
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to remove ban")
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		respondError(c, http.StatusNotFound, errServerBanMissing)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func isUserBanned(db *gorm.DB, serverID, userID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.ServerBan{}).
+		Where("server_id = ? AND user_id = ?", serverID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func serializeServerBan(ban models.ServerBan) gin.H {
+	var user gin.H
+	if ban.User.ID != 0 {
+		user = gin.H{
+			"id":       ban.User.ID,
+			"username": ban.User.Username,
+			"avatar":   ban.User.Avatar,
+		}
+	}
+
+	return gin.H{
+		"id":         ban.ID,
+		"server_id":  ban.ServerID,
+		"user_id":    ban.UserID,
+		"user":       user,
+		"banned_by":  ban.BannedBy,
+		"reason":     ban.Reason,
+		"created_at": ban.CreatedAt.Format(time.RFC3339),
+	}
+}
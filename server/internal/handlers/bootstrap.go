@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBootstrapChannelsPerServer caps the channels returned for each server. Clients
+// load the rest of a truncated server with GetChannels.
+const maxBootstrapChannelsPerServer = 200
+
+// GetBootstrap returns what a client needs on cold start in one response: the
+// current user, their servers with the unarchived channels and categories they
+// can see, and the active voice participants of those channels. Servers the
+// caller is still pending approval in are listed without channels.
+func GetBootstrap(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := caller.DB.First(&user, caller.Claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return
+	}
+
+	var servers []models.Server
+	if err := caller.DB.
+		Select("servers.*, server_members.role AS current_member_role").
+		Joins("JOIN server_members ON server_members.server_id = servers.id AND server_members.user_id = ?", caller.Claims.UserID).
+		Preload("Owner").
+		Order("servers.id ASC").
+		Find(&servers).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load servers")
+		return
+	}
+
+	serverChannels := make(map[uint][]models.Channel, len(servers))
+	truncated := make(map[uint]bool, len(servers))
+	channelIDs := make([]uint, 0)
+	audioChannels := make([]models.Channel, 0)
+	for _, server := range servers {
+		if server.CurrentMemberRole == models.ServerRolePending {
+			continue
+		}
+
+		canManage := roleHasPermission(server.CurrentMemberRole, models.PermissionManageChannels)
+
+		var channels []models.Channel
+		if err := caller.DB.
+			Scopes(visibleChannels(caller.Claims.UserID, canManage)).
+			Where("server_id = ? AND archived_at IS NULL", server.ID).
+			Order("position ASC, created_at ASC").
+			Limit(maxBootstrapChannelsPerServer + 1).
+			Find(&channels).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channels")
+			return
+		}
+
+		if len(channels) > maxBootstrapChannelsPerServer {
+			channels = channels[:maxBootstrapChannelsPerServer]
+			truncated[server.ID] = true
+		}
+
+		serverChannels[server.ID] = channels
+		for _, channel := range channels {
+			channelIDs = append(channelIDs, channel.ID)
+			if channel.Type == models.ChannelTypeAudio {
+				audioChannels = append(audioChannels, channel)
+			}
+		}
+	}
+
+	unread, err := channelUnreadCounts(caller.DB, caller.Claims.UserID, channelIDs)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load unread counts")
+		return
+	}
+
+	serverCategories := make(map[uint][]models.ChannelCategory, len(serverChannels))
+	if len(serverChannels) > 0 {
+		serverIDs := make([]uint, 0, len(serverChannels))
+		for serverID := range serverChannels {
+			serverIDs = append(serverIDs, serverID)
+		}
+
+		var categories []models.ChannelCategory
+		if err := caller.DB.
+			Where("server_id IN ?", serverIDs).
+			Order("position ASC, created_at ASC").
+			Find(&categories).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load categories")
+			return
+		}
+
+		for _, category := range categories {
+			serverCategories[category.ServerID] = append(serverCategories[category.ServerID], category)
+		}
+	}
+
+	participants := map[string]interface{}{}
+	if hub, ok := getWebSocketHub(c); ok {
+		participants = channelParticipants(c, caller.DB, hub, audioChannels)
+	}
+
+	serverPayload := make([]gin.H, 0, len(servers))
+	for _, server := range servers {
+		channels := serverChannels[server.ID]
+		channelPayload := make([]gin.H, 0, len(channels))
+		for _, channel := range channels {
+			payload := serializeChannel(channel)
+			payload["unread_count"] = unread[channel.ID]
+			channelPayload = append(channelPayload, payload)
+		}
+
+		categories := serverCategories[server.ID]
+		categoryPayload := make([]gin.H, 0, len(categories))
+		for _, category := range categories {
+			categoryPayload = append(categoryPayload, serializeChannelCategory(category))
+		}
+
+		payload := serializeServer(server)
+		payload["channels"] = channelPayload
+		payload["categories"] = categoryPayload
+		payload["channels_truncated"] = truncated[server.ID]
+		serverPayload = append(serverPayload, payload)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"user":         serializeUser(user),
+		"servers":      serverPayload,
+		"participants": participants,
+	}})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errChannelCategoryNotFound = errors.New("category not found")
+
+// CreateChannelCategory adds a category to the server's sidebar. Only server owners may manage categories.
+func CreateChannelCategory(c *gin.Context) {
+	var req models.CreateChannelCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can manage categories"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNameRequired, "category name is required")
+		return
+	}
+
+	var position int
+	if req.Position != nil {
+		if *req.Position < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPosition, "position must not be negative")
+			return
+		}
+		position = *req.Position
+	} else {
+		var maxPosition sql.NullInt64
+		if err := caller.DB.
+			Model(&models.ChannelCategory{}).
+			Where("server_id = ?", serverID).
+			Select("MAX(position)").
+			Scan(&maxPosition).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to determine category position")
+			return
+		}
+
+		if maxPosition.Valid {
+			position = int(maxPosition.Int64) + 1
+		}
+	}
+
+	category := models.ChannelCategory{
+		ServerID: serverID,
+		Name:     name,
+		Position: position,
+	}
+
+	if err := caller.DB.Create(&category).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create category")
+		return
+	}
+
+	serialized := serializeChannelCategory(category)
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventCategoryCreated, gin.H{
+			"category":  serialized,
+			"server_id": serverID,
+		}))
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Category created",
+		"data": gin.H{
+			"category": serialized,
+		},
+	})
+}
+
+// UpdateChannelCategory renames or reorders a category.
+func UpdateChannelCategory(c *gin.Context) {
+	var req models.UpdateChannelCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, category, ok := resolveChannelCategory(c)
+	if !ok {
+		return
+	}
+
+	changes := map[string]interface{}{}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeNameRequired, "category name is required")
+			return
+		}
+		if name != category.Name {
+			changes["name"] = name
+		}
+	}
+
+	if req.Position != nil {
+		if *req.Position < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPosition, "position must not be negative")
+			return
+		}
+		if *req.Position != category.Position {
+			changes["position"] = *req.Position
+		}
+	}
+
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Category unchanged",
+			"data": gin.H{
+				"category": serializeChannelCategory(category),
+			},
+		})
+		return
+	}
+
+	if err := caller.DB.Model(&category).Updates(changes).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update category")
+		return
+	}
+
+	if err := caller.DB.First(&category, category.ID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load category")
+		return
+	}
+
+	serialized := serializeChannelCategory(category)
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(category.ServerID, websocket.NewEvent(websocket.EventCategoryUpdated, gin.H{
+			"category":  serialized,
+			"changes":   changes,
+			"server_id": category.ServerID,
+		}))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Category updated",
+		"data": gin.H{
+			"category": serialized,
+			"changes":  changes,
+		},
+	})
+}
+
+// DeleteChannelCategory removes a category. Its channels are kept and become uncategorized.
+func DeleteChannelCategory(c *gin.Context) {
+	caller, category, ok := resolveChannelCategory(c)
+	if !ok {
+		return
+	}
+
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Channel{}).
+			Where("category_id = ?", category.ID).
+			Update("category_id", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&category).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete category")
+		return
+	}
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(category.ServerID, websocket.NewEvent(websocket.EventCategoryDeleted, gin.H{
+			"category_id": category.ID,
+			"server_id":   category.ServerID,
+		}))
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// resolveChannelCategory loads the category named by :categoryID for an owner of
+// :serverID, writing an error response and returning false on failure.
+func resolveChannelCategory(c *gin.Context) (*actor, models.ChannelCategory, bool) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return nil, models.ChannelCategory{}, false
+	}
+
+	if err := caller.RequireOwner("only server owners can manage categories"); err != nil {
+		respondActorError(c, err)
+		return nil, models.ChannelCategory{}, false
+	}
+
+	categoryIDValue, err := strconv.ParseUint(c.Param("categoryID"), 10, 64)
+	if err != nil || categoryIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid category id")
+		return nil, models.ChannelCategory{}, false
+	}
+
+	category, err := loadChannelCategory(caller.DB, serverID, uint(categoryIDValue))
+	if err != nil {
+		respondChannelCategoryError(c, err)
+		return nil, models.ChannelCategory{}, false
+	}
+
+	return caller, category, true
+}
+
+// loadChannelCategory returns the category only if it belongs to the given server.
+func loadChannelCategory(db *gorm.DB, serverID, categoryID uint) (models.ChannelCategory, error) {
+	var category models.ChannelCategory
+	if err := db.Where("id = ? AND server_id = ?", categoryID, serverID).First(&category).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return category, errChannelCategoryNotFound
+		}
+		return category, err
+	}
+
+	return category, nil
+}
+
+// respondChannelCategoryError writes the response for an error from loadChannelCategory.
+func respondChannelCategoryError(c *gin.Context, err error) {
+	if errors.Is(err, errChannelCategoryNotFound) {
+		respondError(c, http.StatusNotFound, err)
+		return
+	}
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load category")
+}
+
+func serializeChannelCategory(category models.ChannelCategory) gin.H {
+	return gin.H{
+		"id":         category.ID,
+		"server_id":  category.ServerID,
+		"name":       category.Name,
+		"position":   category.Position,
+		"created_at": category.CreatedAt.Format(time.RFC3339),
+		"updated_at": category.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errChannelAccessRequired = errors.New("channel access required")
+
+// visibleChannels limits a channel query to the channels the user may see. Users who
+// can manage channels see every private channel in the server.
+func visibleChannels(userID uint, canManage bool) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if canManage {
+			return tx
+		}
+		return tx.Where(
+			"channels.private = ? OR EXISTS (SELECT 1 FROM channel_members WHERE channel_members.channel_id = channels.id AND channel_members.user_id = ?)",
+			false, userID,
+		)
+	}
+}
+
+// ensureChannelAccess requires that the user can see the channel. Public channels are
+// open to every server member; private channels require a ChannelMember row unless the
+// user can manage channels. Server membership must be checked separately.
+func ensureChannelAccess(db *gorm.DB, channel models.Channel, userID uint) error {
+	if !channel.Private {
+		return nil
+	}
+
+	canManage, err := hasPermission(db, channel.ServerID, userID, models.PermissionManageChannels)
+	if err != nil {
+		return err
+	}
+	if canManage {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.ChannelMember{}).
+		Where("channel_id = ? AND user_id = ?", channel.ID, userID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return errChannelAccessRequired
+	}
+
+	return nil
+}
+
+// respondChannelAccessError writes the response for an error from ensureChannelAccess.
+func respondChannelAccessError(c *gin.Context, err error) {
+	switch err {
+	case errChannelAccessRequired:
+		respondError(c, http.StatusForbidden, err)
+	case errServerMembershipRequired:
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
+	default:
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify channel access")
+	}
+}
+
+// channelAudience returns the users allowed to see a private channel: its members plus
+// every server member whose role can manage channels.
+func channelAudience(db *gorm.DB, channel models.Channel) ([]uint, error) {
+	var memberIDs []uint
+	if err := db.Model(&models.ChannelMember{}).
+		Where("channel_id = ?", channel.ID).
+		Pluck("user_id", &memberIDs).Error; err != nil {
+		return nil, err
+	}
+
+	managerRoles := []string{models.ServerRoleOwner}
+	for role, permissions := range rolePermissions {
+		if permissions[models.PermissionManageChannels] {
+			managerRoles = append(managerRoles, role)
+		}
+	}
+
+	var managerIDs []uint
+	if err := db.Model(&models.ServerMember{}).
+		Where("server_id = ? AND role IN ?", channel.ServerID, managerRoles).
+		Pluck("user_id", &managerIDs).Error; err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(memberIDs)+len(managerIDs))
+	audience := make([]uint, 0, len(memberIDs)+len(managerIDs))
+	for _, id := range append(memberIDs, managerIDs...) {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		audience = append(audience, id)
+	}
+
+	return audience, nil
+}
+
+// publishChannelEvent delivers a channel-scoped event. Public channel events go to the
+// whole server; private channel events only reach users who can see the channel.
+func publishChannelEvent(hub *websocket.Hub, db *gorm.DB, channel models.Channel, event websocket.Event) error {
+	if !channel.Private {
+		return hub.PublishToServer(channel.ServerID, event)
+	}
+
+	audience, err := channelAudience(db, channel)
+	if err != nil {
+		return err
+	}
+
+	for _, userID := range audience {
+		if err := hub.PublishToUser(userID, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishToChannel is publishChannelEvent for request handlers.
+func publishToChannel(c *gin.Context, db *gorm.DB, channel models.Channel, event websocket.Event) {
+	hub, ok := getWebSocketHub(c)
+	if !ok {
+		return
+	}
+
+	if err := publishChannelEvent(hub, db.WithContext(c), channel, event); err != nil {
+		requestLogger(c).Warn("failed to publish channel event", "type", event.Type, "channel_id", channel.ID, "error", err)
+	}
+}
+
+// AddChannelMember grants a server member access to a private channel.
+func AddChannelMember(c *gin.Context) {
+	caller, channel, targetID, ok := resolveChannelMemberTarget(c)
+	if !ok {
+		return
+	}
+
+	var membership models.ServerMember
+	if err := caller.DB.
+		Where("server_id = ? AND user_id = ?", channel.ServerID, targetID).
+		First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotServerMember, "user is not a member of this server")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load membership")
+		return
+	}
+
+	if membership.Role == models.ServerRolePending {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeMemberPending, "pending members cannot be added to channels")
+		return
+	}
+
+	member := models.ChannelMember{
+		ChannelID: channel.ID,
+		UserID:    targetID,
+		AddedBy:   caller.Claims.UserID,
+	}
+
+	result := caller.DB.Where(models.ChannelMember{ChannelID: channel.ID, UserID: targetID}).FirstOrCreate(&member)
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to add channel member")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		event := websocket.NewEvent(websocket.EventChannelMemberAdded, gin.H{
+			"channel":    serializeChannel(channel),
+			"channel_id": channel.ID,
+			"server_id":  channel.ServerID,
+			"user_id":    targetID,
+			"added_by":   caller.Claims.UserID,
+		})
+		publishToChannel(c, caller.DB, channel, event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Channel member added",
+		"data": gin.H{
+			"channel_id": channel.ID,
+			"user_id":    targetID,
+		},
+	})
+}
+
+// RemoveChannelMember revokes a user's access to a private channel and ends any voice session they hold in it.
+func RemoveChannelMember(c *gin.Context) {
+	caller, channel, targetID, ok := resolveChannelMemberTarget(c)
+	if !ok {
+		return
+	}
+
+	result := caller.DB.
+		Where("channel_id = ? AND user_id = ?", channel.ID, targetID).
+		Delete(&models.ChannelMember{})
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to remove channel member")
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotChannelMember, "user is not a member of this channel")
+		return
+	}
+
+	event := websocket.NewEvent(websocket.EventChannelMemberRemoved, gin.H{
+		"channel_id": channel.ID,
+		"server_id":  channel.ServerID,
+		"user_id":    targetID,
+		"removed_by": caller.Claims.UserID,
+	})
+	publishToChannel(c, caller.DB, channel, event)
+
+	if hub, ok := getWebSocketHub(c); ok {
+		// The removed user is no longer in the audience, so notify them directly.
+		_ = hub.PublishToUser(targetID, event)
+
+		if channel.Type == models.ChannelTypeAudio {
+			removed := hub.EvictParticipant(channel.ID, targetID, "access_revoked")
+			if rtcManager, hasManager := getWebRTCManager(c); removed != nil && hasManager && removed.SessionToken != "" {
+				rtcManager.Revoke(removed.SessionToken)
+			}
+		}
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// resolveChannelMemberTarget loads the private channel and target user for the channel
+// member endpoints, writing an error response and returning false on failure.
+func resolveChannelMemberTarget(c *gin.Context) (*actor, models.Channel, uint, bool) {
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return nil, models.Channel{}, 0, false
+	}
+
+	targetIDValue, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil || targetIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+		return nil, models.Channel{}, 0, false
+	}
+
+	if err := caller.Require(models.PermissionManageChannels, "you do not have permission to manage channel members"); err != nil {
+		respondActorError(c, err)
+		return nil, models.Channel{}, 0, false
+	}
+
+	if !channel.Private {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeChannelNotPrivate, "channel is not private")
+		return nil, models.Channel{}, 0, false
+	}
+
+	return caller, channel, uint(targetIDValue), true
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errChannelArchived = errors.New("this channel is archived and no longer accepts messages")
+
+// ArchiveChannel makes a channel read-only and hides it from the default channel
+// list. Its messages stay readable.
+func ArchiveChannel(c *gin.Context) {
+	setChannelArchived(c, true)
+}
+
+// UnarchiveChannel reopens an archived channel for new messages.
+func UnarchiveChannel(c *gin.Context) {
+	setChannelArchived(c, false)
+}
+
+func setChannelArchived(c *gin.Context, archived bool) {
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageChannels, "you do not have permission to archive channels"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	message := "Channel archived"
+	eventType := websocket.EventChannelArchived
+	if !archived {
+		message = "Channel unarchived"
+		eventType = websocket.EventChannelUnarchived
+	}
+
+	if (channel.ArchivedAt != nil) == archived {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Channel unchanged",
+			"data": gin.H{
+				"channel": serializeChannel(channel),
+			},
+		})
+		return
+	}
+
+	var archivedAt interface{}
+	if archived {
+		archivedAt = time.Now()
+	}
+
+	if err := caller.DB.Model(&channel).Update("archived_at", archivedAt).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update channel")
+		return
+	}
+
+	if err := caller.DB.First(&channel, channel.ID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
+		return
+	}
+
+	serialized := serializeChannel(channel)
+	publishToChannel(c, caller.DB, channel, websocket.NewEvent(eventType, gin.H{
+		"channel":   serialized,
+		"server_id": channel.ServerID,
+	}))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"data": gin.H{
+			"channel": serialized,
+		},
+	})
+}
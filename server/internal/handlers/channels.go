@@ -2,17 +2,22 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/models"
+	"bafachat/internal/websocket"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 const (
@@ -20,161 +25,209 @@ const (
 	maxChannelPageSize     = 200
 )
 
-// GetChannels returns all channels for a specific server
+// GetChannels returns all channels for a specific server. Archived channels are
+// left out unless include_archived=true.
 func GetChannels(c *gin.Context) {
-	db, ok := getDB(c)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
 		return
 	}
 
-	claims, ok := getUserClaims(c)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
-		return
+	canManage := roleHasPermission(caller.Role(), models.PermissionManageChannels)
+
+	query := caller.DB.
+		Scopes(visibleChannels(caller.Claims.UserID, canManage)).
+		Where("server_id = ?", serverID)
+	if includeArchived, _ := strconv.ParseBool(c.Query("include_archived")); !includeArchived {
+		query = query.Where("archived_at IS NULL")
 	}
 
-	serverIDParam := c.Param("serverID")
-	serverIDValue, err := strconv.ParseUint(serverIDParam, 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+	var channels []models.Channel
+	if err := query.
+		Order("position ASC, created_at ASC").
+		Find(&channels).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channels")
 		return
 	}
 
-	if err := ensureServerMembership(db.WithContext(c), uint(serverIDValue), claims.UserID); err != nil {
-		switch err {
-		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
-		}
+	channelIDs := make([]uint, 0, len(channels))
+	for _, channel := range channels {
+		channelIDs = append(channelIDs, channel.ID)
+	}
+
+	unread, err := channelUnreadCounts(caller.DB, caller.Claims.UserID, channelIDs)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load unread counts")
 		return
 	}
 
-	var channels []models.Channel
-	if err := db.WithContext(c).
-		Where("server_id = ?", uint(serverIDValue)).
+	var categories []models.ChannelCategory
+	if err := caller.DB.
+		Where("server_id = ?", serverID).
 		Order("position ASC, created_at ASC").
-		Find(&channels).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channels"})
+		Find(&categories).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load categories")
 		return
 	}
 
 	response := make([]gin.H, 0, len(channels))
+	grouped := make(map[uint][]gin.H, len(categories))
 	for _, channel := range channels {
-		response = append(response, serializeChannel(channel))
+		payload := serializeChannel(channel)
+		payload["unread_count"] = unread[channel.ID]
+		response = append(response, payload)
+
+		if channel.CategoryID != nil {
+			grouped[*channel.CategoryID] = append(grouped[*channel.CategoryID], payload)
+		}
+	}
+
+	categoryResponse := make([]gin.H, 0, len(categories))
+	for _, category := range categories {
+		payload := serializeChannelCategory(category)
+		categoryChannels := grouped[category.ID]
+		if categoryChannels == nil {
+			categoryChannels = []gin.H{}
+		}
+		payload["channels"] = categoryChannels
+		categoryResponse = append(categoryResponse, payload)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": gin.H{"channels": response}})
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"channels":   response,
+		"categories": categoryResponse,
+	}})
 }
 
 // CreateChannel creates a new channel in a server
 func CreateChannel(c *gin.Context) {
 	var req models.CreateChannelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	if req.ServerID == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "server id is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "server id is required")
 		return
 	}
 
 	var server models.Server
 	if err := db.WithContext(c).First(&server, req.ServerID).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
-	if err := requireServerOwner(db.WithContext(c), server.ID, claims.UserID); err != nil {
+	if err := requirePermission(db.WithContext(c), server.ID, claims.UserID, models.PermissionManageChannels); err != nil {
 		switch err {
-		case errServerOwnerRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "only server owners can create channels"})
+		case errServerPermissionRequired:
+			apierror.Respond(c, http.StatusForbidden, apierror.CodePermissionDenied, "you do not have permission to create channels")
 			return
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 			return
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to validate permissions"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to validate permissions")
 			return
 		}
 	}
 
 	channelType := normalizeChannelType(req.Type)
 	if channelType == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "channel type must be text or audio"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidChannelType, "channel type must be text or audio")
 		return
 	}
 
 	name := strings.TrimSpace(req.Name)
 	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "channel name is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNameRequired, "channel name is required")
 		return
 	}
 
-	description := strings.TrimSpace(req.Description)
-	position := req.Position
-	if position <= 0 {
-		var maxPosition sql.NullInt64
-		if err := db.WithContext(c).
-			Model(&models.Channel{}).
-			Where("server_id = ?", server.ID).
-			Select("MAX(position)").
-			Scan(&maxPosition).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to determine channel position"})
+	var categoryID *uint
+	if req.CategoryID != nil && *req.CategoryID != 0 {
+		category, err := loadChannelCategory(db.WithContext(c), server.ID, *req.CategoryID)
+		if err != nil {
+			respondChannelCategoryError(c, err)
 			return
 		}
-
-		if maxPosition.Valid {
-			position = int(maxPosition.Int64) + 1
-		} else {
-			position = 0
-		}
+		categoryID = &category.ID
 	}
 
+	description := strings.TrimSpace(req.Description)
+
 	channel := models.Channel{
 		Name:        name,
 		Description: description,
 		Type:        channelType,
 		ServerID:    server.ID,
-		Position:    position,
+		Private:     req.Private,
+		CategoryID:  categoryID,
+		NSFW:        req.NSFW,
 	}
 
-	if err := db.WithContext(c).Create(&channel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create channel"})
+	var shifted []models.Channel
+	if err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		position, moved, err := claimChannelPosition(tx, server.ID, req.Position)
+		if err != nil {
+			return err
+		}
+		channel.Position = position
+		shifted = moved
+
+		if err := tx.Create(&channel).Error; err != nil {
+			return err
+		}
+
+		if !channel.Private {
+			return nil
+		}
+
+		// The creator keeps access to a private channel even if they later lose their role.
+		return tx.Create(&models.ChannelMember{
+			ChannelID: channel.ID,
+			UserID:    claims.UserID,
+			AddedBy:   claims.UserID,
+		}).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create channel")
 		return
 	}
 
 	if err := db.WithContext(c).First(&channel, channel.ID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
 		return
 	}
 
-	if hub, ok := getWebSocketHub(c); ok {
-		_ = hub.Publish(gin.H{
-			"type": "channel.created",
-			"data": gin.H{
-				"channel":   serializeChannel(channel),
-				"server_id": server.ID,
-			},
-		})
+	publishToChannel(c, db, channel, websocket.NewEvent(websocket.EventChannelCreated, gin.H{
+		"channel":   serializeChannel(channel),
+		"server_id": server.ID,
+	}))
+
+	// Channels moved down to make room are announced like any other position change.
+	for _, moved := range shifted {
+		publishToChannel(c, db, moved, websocket.NewEvent(websocket.EventChannelSettingsUpdated, gin.H{
+			"channel":   serializeChannel(moved),
+			"changes":   gin.H{"position": moved.Position},
+			"server_id": moved.ServerID,
+		}))
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
@@ -185,48 +238,265 @@ func CreateChannel(c *gin.Context) {
 	})
 }
 
-// GetMessages returns messages for a specific channel
+// claimChannelPosition returns the position for a new channel in the server. Without
+// a requested position the channel goes last; otherwise channels at or after the
+// requested position move down one so positions stay unique, and are returned
+// with their new positions. The server row lock serializes concurrent creates so
+// two channels never claim the same position.
+func claimChannelPosition(tx *gorm.DB, serverID uint, requested int) (int, []models.Channel, error) {
+	var server models.Server
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&server, serverID).Error; err != nil {
+		return 0, nil, err
+	}
+
+	if requested > 0 {
+		if err := tx.Model(&models.Channel{}).
+			Where("server_id = ? AND position >= ?", serverID, requested).
+			UpdateColumn("position", gorm.Expr("position + 1")).Error; err != nil {
+			return 0, nil, err
+		}
+
+		var shifted []models.Channel
+		if err := tx.Where("server_id = ? AND position > ?", serverID, requested).
+			Order("position ASC").
+			Find(&shifted).Error; err != nil {
+			return 0, nil, err
+		}
+		return requested, shifted, nil
+	}
+
+	var maxPosition sql.NullInt64
+	if err := tx.Model(&models.Channel{}).
+		Where("server_id = ?", serverID).
+		Select("MAX(position)").
+		Scan(&maxPosition).Error; err != nil {
+		return 0, nil, err
+	}
+
+	if !maxPosition.Valid {
+		return 0, nil, nil
+	}
+
+	return int(maxPosition.Int64) + 1, nil, nil
+}
+
+// UpdateChannel applies changes to a channel's settings and notifies server members.
+func UpdateChannel(c *gin.Context) {
+	var req models.UpdateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageChannels, "you do not have permission to update channels"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	changes := map[string]interface{}{}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeNameRequired, "channel name is required")
+			return
+		}
+		if name != channel.Name {
+			changes["name"] = name
+		}
+	}
+
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if description != channel.Description {
+			changes["description"] = description
+		}
+	}
+
+	if req.Position != nil {
+		if *req.Position < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidPosition, "position must not be negative")
+			return
+		}
+		if *req.Position != channel.Position {
+			changes["position"] = *req.Position
+		}
+	}
+
+	if req.MaxParticipants != nil {
+		if channel.Type != models.ChannelTypeAudio {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotAudioChannel, "max participants only apply to audio channels")
+			return
+		}
+		if *req.MaxParticipants < 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidMaxParticipants, "max participants must not be negative")
+			return
+		}
+		if *req.MaxParticipants != channel.MaxParticipants {
+			changes["max_participants"] = *req.MaxParticipants
+		}
+	}
+
+	if req.SlowmodeSeconds != nil {
+		if channel.Type != models.ChannelTypeText {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "slowmode only applies to text channels")
+			return
+		}
+		if *req.SlowmodeSeconds < 0 || *req.SlowmodeSeconds > maxSlowmodeSeconds {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidSlowmode, fmt.Sprintf("slowmode must be between 0 and %d seconds", maxSlowmodeSeconds))
+			return
+		}
+		if *req.SlowmodeSeconds != channel.SlowmodeSeconds {
+			changes["slowmode_seconds"] = *req.SlowmodeSeconds
+		}
+	}
+
+	if req.MessageTTLSeconds != nil {
+		if channel.Type != models.ChannelTypeText {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "message ttl only applies to text channels")
+			return
+		}
+		if *req.MessageTTLSeconds != 0 {
+			if err := validateMessageTTL(*req.MessageTTLSeconds); err != nil {
+				respondError(c, http.StatusBadRequest, err)
+				return
+			}
+		}
+		if *req.MessageTTLSeconds != channel.MessageTTLSeconds {
+			changes["message_ttl_seconds"] = *req.MessageTTLSeconds
+		}
+	}
+
+	if req.Private != nil && *req.Private != channel.Private {
+		changes["private"] = *req.Private
+	}
+
+	if req.NSFW != nil && *req.NSFW != channel.NSFW {
+		changes["nsfw"] = *req.NSFW
+	}
+
+	if req.CategoryID != nil {
+		if *req.CategoryID == 0 {
+			if channel.CategoryID != nil {
+				changes["category_id"] = nil
+			}
+		} else if channel.CategoryID == nil || *channel.CategoryID != *req.CategoryID {
+			category, err := loadChannelCategory(caller.DB, channel.ServerID, *req.CategoryID)
+			if err != nil {
+				respondChannelCategoryError(c, err)
+				return
+			}
+			changes["category_id"] = category.ID
+		}
+	}
+
+	if len(changes) == 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Channel unchanged",
+			"data": gin.H{
+				"channel": serializeChannel(channel),
+				"changes": changes,
+			},
+		})
+		return
+	}
+
+	if err := caller.DB.Model(&channel).Updates(changes).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update channel")
+		return
+	}
+
+	if err := caller.DB.First(&channel, channel.ID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
+		return
+	}
+
+	serialized := serializeChannel(channel)
+
+	event := websocket.NewEvent(websocket.EventChannelSettingsUpdated, gin.H{
+		"channel":   serialized,
+		"changes":   changes,
+		"server_id": channel.ServerID,
+	})
+
+	if _, visibilityChanged := changes["private"]; visibilityChanged {
+		// Everyone in the server needs to refresh their channel list when visibility flips.
+		if hub, ok := getWebSocketHub(c); ok {
+			_ = hub.PublishToServer(channel.ServerID, event)
+		}
+	} else {
+		publishToChannel(c, caller.DB, channel, event)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Channel updated",
+		"data": gin.H{
+			"channel": serialized,
+			"changes": changes,
+		},
+	})
+}
+
+// GetMessages returns messages for a specific channel, paging with before or after,
+// or centred on a message with around=<messageID>. With include_total=true the
+// response also carries an approximate total for the channel.
 func GetMessages(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	channelIDParam := c.Param("id")
 	channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
 		return
 	}
 
 	var channel models.Channel
 	if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
 		return
 	}
 
 	if err := ensureServerMembership(db.WithContext(c), channel.ServerID, claims.UserID); err != nil {
 		switch err {
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 			return
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
 			return
 		}
 	}
 
+	if err := ensureChannelAccess(db.WithContext(c), channel, claims.UserID); err != nil {
+		respondChannelAccessError(c, err)
+		return
+	}
+
+	if err := ensureNSFWAcknowledged(db.WithContext(c), channel, claims.UserID); err != nil {
+		respondNSFWError(c, err)
+		return
+	}
+
 	limit := defaultChannelPageSize
 	if rawLimit := strings.TrimSpace(c.Query("limit")); rawLimit != "" {
 		if parsedLimit, err := strconv.Atoi(rawLimit); err == nil {
@@ -242,22 +512,51 @@ func GetMessages(c *gin.Context) {
 
 	var messages []models.Message
 	beforeCursor := strings.TrimSpace(c.Query("before"))
+	afterCursor := strings.TrimSpace(c.Query("after"))
+	if beforeCursor != "" && afterCursor != "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "before and after cannot be combined")
+		return
+	}
+
+	if aroundCursor := strings.TrimSpace(c.Query("around")); aroundCursor != "" {
+		if beforeCursor != "" || afterCursor != "" {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "around cannot be combined with before or after")
+			return
+		}
+		targetID, err := strconv.ParseUint(aroundCursor, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "invalid around cursor")
+			return
+		}
+		getMessagesAround(c, db, channel, uint(targetID), limit)
+		return
+	}
+
 	var beforeTime time.Time
 	beforeProvided := false
 	if beforeCursor != "" {
 		parsed, err := time.Parse(time.RFC3339, beforeCursor)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid before cursor"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "invalid before cursor")
 			return
 		}
 		beforeTime = parsed.UTC()
 		beforeProvided = true
 	}
 
-	query := db.WithContext(c).
-		Preload("User").
-		Preload("Attachments").
-		Where("channel_id = ?", channel.ID)
+	var afterTime time.Time
+	afterProvided := false
+	if afterCursor != "" {
+		parsed, err := time.Parse(time.RFC3339, afterCursor)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "invalid after cursor")
+			return
+		}
+		afterTime = parsed.UTC()
+		afterProvided = true
+	}
+
+	query := channelMessages(db.WithContext(c), channel.ID)
 
 	if beforeProvided {
 		query = query.Where("created_at < ?", beforeTime)
@@ -265,11 +564,19 @@ func GetMessages(c *gin.Context) {
 
 	fetchLimit := limit + 1
 
+	// Forward pages read oldest-first from the cursor; backward pages read
+	// newest-first and are reversed below so both return ascending order.
+	order := "created_at DESC, id DESC"
+	if afterProvided {
+		query = query.Where("created_at > ?", afterTime)
+		order = "created_at ASC, id ASC"
+	}
+
 	if err := query.
-		Order("created_at DESC, id DESC").
+		Order(order).
 		Limit(fetchLimit).
 		Find(&messages).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load messages"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load messages")
 		return
 	}
 
@@ -279,10 +586,14 @@ func GetMessages(c *gin.Context) {
 		messages = messages[:limit]
 	}
 
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+	if !afterProvided {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
 	}
 
+	applyAuthorNicknames(db.WithContext(c), channel.ID, messages)
+
 	response := make([]gin.H, 0, len(messages))
 	for _, message := range messages {
 		response = append(response, serializeMessage(message))
@@ -294,62 +605,120 @@ func GetMessages(c *gin.Context) {
 	}
 
 	if len(messages) > 0 {
-		payload["next_cursor"] = messages[0].CreatedAt.UTC().Format(time.RFC3339)
+		if afterProvided {
+			// Sub-second precision keeps messages sharing a second from being refetched.
+			payload["next_cursor"] = messages[len(messages)-1].CreatedAt.UTC().Format(time.RFC3339Nano)
+		} else {
+			payload["next_cursor"] = messages[0].CreatedAt.UTC().Format(time.RFC3339)
+		}
+	}
+
+	if !addMessageTotal(c, db, channel.ID, payload) {
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"data": payload})
 }
 
+// channelMessages selects a channel's unexpired messages with everything
+// serializeMessage needs preloaded.
+func channelMessages(db *gorm.DB, channelID uint) *gorm.DB {
+	return db.
+		Preload("User").
+		Preload("Attachments").
+		Preload("Mentions.User", preloadMentionUsers).
+		Preload("Emojis.Emoji").
+		Preload("LinkPreview").
+		Scopes(unexpiredMessages).
+		Where("channel_id = ?", channelID)
+}
+
 // CreateMessage creates a text message inside a channel
 func CreateMessage(c *gin.Context) {
 	var req models.CreateMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	channelIDParam := c.Param("id")
 	channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
 		return
 	}
 
 	var channel models.Channel
 	if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
 		return
 	}
 
 	if err := ensureServerMembership(db.WithContext(c), channel.ServerID, claims.UserID); err != nil {
 		switch err {
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 			return
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
 			return
 		}
 	}
 
+	if err := ensureChannelAccess(db.WithContext(c), channel, claims.UserID); err != nil {
+		respondChannelAccessError(c, err)
+		return
+	}
+
 	if channel.Type != models.ChannelTypeText {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "messages can only be created in text channels"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "messages can only be created in text channels")
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
+		return
+	}
+
+	clientNonce, err := requestClientNonce(c, req.ClientNonce)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// A retried send must not be rejected by slowmode, so replays are answered first.
+	if clientNonce != nil && replayMessageForNonce(c, db.WithContext(c), channel, claims.UserID, *clientNonce) {
+		return
+	}
+
+	if req.TTLSeconds != nil {
+		if err := validateMessageTTL(*req.TTLSeconds); err != nil {
+			respondError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	if !enforceMessageRateLimit(c, channel.ID, fmt.Sprintf("user:%d", claims.UserID)) {
+		return
+	}
+
+	if !enforceSlowmode(c, db.WithContext(c), channel, claims.UserID) {
 		return
 	}
 
@@ -370,50 +739,79 @@ func CreateMessage(c *gin.Context) {
 	switch messageType {
 	case models.MessageTypeText:
 		if content == "" && !hasAttachments {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "message content is required"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeContentRequired, "message content is required")
 			return
 		}
 	case models.MessageTypeFile:
 		if !hasAttachments {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "attachments are required for file messages"})
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeAttachmentsRequired, "attachments are required for file messages")
 			return
 		}
 	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported message type"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidMessageType, "unsupported message type")
 		return
 	}
 
+	content, ok = filterMessageContent(c, db.WithContext(c), channel.ServerID, content,
+		"channel_id", channel.ID, "user_id", claims.UserID)
+	if !ok {
+		return
+	}
+
+	attachmentLimits := attachmentPolicyFromEnv()
+	if err := attachmentLimits.validate(len(req.Attachments), 0); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	var totalAttachmentSize int64
 	attachments := make([]models.MessageAttachment, 0, len(req.Attachments))
 	if hasAttachments {
-		for _, attachment := range req.Attachments {
+		for index, attachment := range req.Attachments {
 			objectKey := strings.TrimSpace(attachment.ObjectKey)
 			if objectKey == "" || strings.Contains(objectKey, "..") {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid attachment object key"})
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "invalid attachment object key")
 				return
 			}
 
 			url := strings.TrimSpace(attachment.URL)
 			if url == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "attachment url is required"})
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "attachment url is required")
 				return
 			}
 
 			fileName := strings.TrimSpace(attachment.FileName)
 			if fileName == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "attachment file name is required"})
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "attachment file name is required")
 				return
 			}
 
 			contentType := strings.TrimSpace(attachment.ContentType)
 			if contentType == "" {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "attachment content type is required"})
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "attachment content type is required")
 				return
 			}
 
 			if attachment.FileSize <= 0 {
-				c.JSON(http.StatusBadRequest, gin.H{"error": "attachment file size must be greater than zero"})
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "attachment file size must be greater than zero")
 				return
 			}
+			totalAttachmentSize += attachment.FileSize
+
+			altText, err := normalizeAttachmentAltText(attachment.AltText)
+			if err != nil {
+				respondError(c, http.StatusBadRequest, err)
+				return
+			}
+
+			position := index
+			if attachment.Position != nil {
+				if *attachment.Position < 0 {
+					apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidAttachment, "attachment position must not be negative")
+					return
+				}
+				position = *attachment.Position
+			}
 
 			attachments = append(attachments, models.MessageAttachment{
 				ObjectKey:   objectKey,
@@ -421,18 +819,47 @@ func CreateMessage(c *gin.Context) {
 				FileName:    fileName,
 				ContentType: contentType,
 				FileSize:    attachment.FileSize,
+				AltText:     altText,
+				Position:    position,
 			})
 		}
+
+		normalizeAttachmentPositions(attachments)
+	}
+
+	if err := attachmentLimits.validate(len(attachments), totalAttachmentSize); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	// Presigned uploads go straight to storage, so confirm the objects exist and
+	// match what the client declares before trusting the metadata, then strip
+	// image metadata as the API upload path does.
+	if hasStorage {
+		for index, attachment := range attachments {
+			if err := verifyUploadedAttachment(c.Request.Context(), storageService, attachment); err != nil {
+				if errors.Is(err, errAttachmentNotUploaded) || errors.Is(err, errAttachmentMismatch) {
+					respondError(c, http.StatusBadRequest, fmt.Errorf("attachments[%d]: %w", index, err))
+					return
+				}
+				requestLogger(c).Error("failed to verify attachment upload", "object_key", attachment.ObjectKey, "error", err)
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify attachment")
+				return
+			}
+			attachments[index].FileSize = stripPresignedAttachmentMetadata(c, storageService, attachment)
+		}
 	}
 
 	var createdMessage models.Message
 
 	if err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
 		message := models.Message{
-			Content:   content,
-			UserID:    claims.UserID,
-			ChannelID: channel.ID,
-			Type:      messageType,
+			Content:     content,
+			UserID:      claims.UserID,
+			ChannelID:   channel.ID,
+			Type:        messageType,
+			ClientNonce: clientNonce,
+			ExpiresAt:   messageExpiry(channel, req.TTLSeconds, time.Now()),
 		}
 
 		if err := tx.Create(&message).Error; err != nil {
@@ -446,22 +873,41 @@ func CreateMessage(c *gin.Context) {
 			if err := tx.Create(&attachments).Error; err != nil {
 				return err
 			}
+			if err := addServerStorageUsage(tx, channel.ServerID, attachments); err != nil {
+				return err
+			}
+			if err := consumeUploadIntents(tx, attachments); err != nil {
+				return err
+			}
 		}
 
-		if err := tx.Preload("User").Preload("Attachments").First(&createdMessage, message.ID).Error; err != nil {
+		if err := createMessageMentions(tx, message, channel.ServerID); err != nil {
+			return err
+		}
+
+		if err := createMessageEmojis(tx, message, channel.ServerID); err != nil {
+			return err
+		}
+
+		if err := tx.Preload("User").Preload("Attachments").Preload("Mentions.User", preloadMentionUsers).Preload("Emojis.Emoji").First(&createdMessage, message.ID).Error; err != nil {
 			return err
 		}
 
 		return nil
 	}); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create message"})
+		// A concurrent retry may have won the unique (user_id, client_nonce) index.
+		if clientNonce != nil && replayMessageForNonce(c, db.WithContext(c), channel, claims.UserID, *clientNonce) {
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create message")
 		return
 	}
 
 	if hasStorage && len(createdMessage.Attachments) > 0 {
-		createdMessage.Attachments = generateAttachmentPreviews(c.Request.Context(), db, storageService, createdMessage.Attachments)
+		createdMessage.Attachments = prepareAttachmentPreviews(c, db, storageService, createdMessage)
 	}
 
+	applyAuthorNickname(db.WithContext(c), &createdMessage)
 	serialized := serializeMessage(createdMessage)
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Message created",
@@ -470,16 +916,10 @@ func CreateMessage(c *gin.Context) {
 		},
 	})
 
-	if hub, ok := getWebSocketHub(c); ok {
-		_ = hub.Publish(gin.H{
-			"type": "message.created",
-			"data": gin.H{
-				"message":    serialized,
-				"channel_id": channel.ID,
-				"server_id":  channel.ServerID,
-			},
-		})
-	}
+	publishToChannel(c, db, channel, websocket.MessageCreated(serialized, channel.ID, channel.ServerID))
+
+	notifyMentionedUsers(c, channel, createdMessage, serialized)
+	queueLinkPreview(c, db, createdMessage)
 }
 
 func normalizeChannelType(value string) string {
@@ -499,93 +939,96 @@ func normalizeChannelType(value string) string {
 }
 
 func serializeChannel(channel models.Channel) gin.H {
+	var archivedAt string
+	if channel.ArchivedAt != nil {
+		archivedAt = channel.ArchivedAt.Format(time.RFC3339)
+	}
+
 	return gin.H{
-		"id":          channel.ID,
-		"name":        channel.Name,
-		"description": channel.Description,
-		"type":        channel.Type,
-		"server_id":   channel.ServerID,
-		"position":    channel.Position,
-		"created_at":  channel.CreatedAt.Format(time.RFC3339),
-		"updated_at":  channel.UpdatedAt.Format(time.RFC3339),
+		"id":                  channel.ID,
+		"name":                channel.Name,
+		"description":         channel.Description,
+		"type":                channel.Type,
+		"server_id":           channel.ServerID,
+		"position":            channel.Position,
+		"max_participants":    channel.MaxParticipants,
+		"slowmode_seconds":    channel.SlowmodeSeconds,
+		"message_ttl_seconds": channel.MessageTTLSeconds,
+		"private":             channel.Private,
+		"category_id":         channel.CategoryID,
+		"nsfw":                channel.NSFW,
+		"archived_at":         archivedAt,
+		"created_at":          channel.CreatedAt.Format(time.RFC3339),
+		"updated_at":          channel.UpdatedAt.Format(time.RFC3339),
 	}
 }
 
 func serializeMessage(message models.Message) gin.H {
 	var author gin.H
-	if message.User.ID != 0 {
+	if message.WebhookID != nil {
+		// Webhook messages display the name and avatar supplied by the integration.
+		author = gin.H{
+			"id":       nil,
+			"username": message.WebhookName,
+			"avatar":   message.WebhookAvatar,
+			"bot":      true,
+		}
+	} else if message.User.ID != 0 {
 		author = gin.H{
-			"id":       message.User.ID,
-			"username": message.User.Username,
-			"email":    message.User.Email,
-			"avatar":   message.User.Avatar,
+			"id":             message.User.ID,
+			"username":       message.User.Username,
+			"nickname":       message.AuthorNickname,
+			"display_name":   memberDisplayName(message.AuthorNickname, message.User.Username),
+			"email":          message.User.Email,
+			"avatar":         message.User.Avatar,
+			"default_avatar": defaultAvatarURL(message.User.ID),
 		}
 	}
 
+	sortAttachments(message.Attachments)
 	attachments := make([]gin.H, 0, len(message.Attachments))
 	for _, attachment := range message.Attachments {
 		attachments = append(attachments, serializeAttachment(attachment))
 	}
 
+	var expiresAt string
+	if message.ExpiresAt != nil {
+		expiresAt = message.ExpiresAt.Format(time.RFC3339)
+	}
+
 	return gin.H{
-		"id":          message.ID,
-		"content":     message.Content,
-		"type":        message.Type,
-		"user_id":     message.UserID,
-		"user":        author,
-		"channel_id":  message.ChannelID,
-		"attachments": attachments,
-		"created_at":  message.CreatedAt.Format(time.RFC3339),
-		"updated_at":  message.UpdatedAt.Format(time.RFC3339),
+		"id":           message.ID,
+		"content":      message.Content,
+		"type":         message.Type,
+		"user_id":      message.UserID,
+		"user":         author,
+		"channel_id":   message.ChannelID,
+		"attachments":  attachments,
+		"mentions":     serializeMessageMentions(message.Mentions),
+		"emojis":       serializeMessageEmojis(message.Emojis),
+		"link_preview": serializeLinkPreview(message.LinkPreview),
+		"webhook_id":   message.WebhookID,
+		"client_nonce": message.ClientNonce,
+		"expires_at":   expiresAt,
+		"created_at":   message.CreatedAt.Format(time.RFC3339),
+		"updated_at":   message.UpdatedAt.Format(time.RFC3339),
 	}
 }
 
-// SendTypingIndicator broadcasts a typing signal for the current user within a channel.
+// SendTypingIndicator broadcasts a typing signal for the current user to those who can see the channel.
+// Repeated signals are debounced; see shouldPublishTyping.
 func SendTypingIndicator(c *gin.Context) {
-	db, ok := getDB(c)
-	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
-		return
-	}
-
-	claims, ok := getUserClaims(c)
-	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
-		return
-	}
-
-	channelIDParam := c.Param("id")
-	channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
+	caller, channel, err := resolveChannelActor(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
-		return
-	}
-
-	var channel models.Channel
-	if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
-		return
-	}
-
-	if err := ensureServerMembership(db.WithContext(c), channel.ServerID, claims.UserID); err != nil {
-		switch err {
-		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
-		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
-		}
+		respondActorError(c, err)
 		return
 	}
 
 	var user models.User
-	if err := db.WithContext(c).
+	if err := caller.DB.
 		Select("id", "username", "avatar").
-		First(&user, claims.UserID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load user"})
+		First(&user, caller.Claims.UserID).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
 		return
 	}
 
@@ -593,7 +1036,7 @@ func SendTypingIndicator(c *gin.Context) {
 		Active *bool `json:"active"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid payload")
 		return
 	}
 
@@ -611,21 +1054,19 @@ func SendTypingIndicator(c *gin.Context) {
 
 	expiresAt := expiry.UTC().Format(time.RFC3339)
 
-	if hub, ok := getWebSocketHub(c); ok {
-		_ = hub.Publish(gin.H{
-			"type": "channel.typing",
-			"data": gin.H{
-				"channel_id": channel.ID,
-				"server_id":  channel.ServerID,
-				"user": gin.H{
-					"id":       user.ID,
-					"username": user.Username,
-					"avatar":   user.Avatar,
-				},
-				"active":     active,
-				"expires_at": expiresAt,
+	debounced := !shouldPublishTyping(c, channel.ID, user.ID, active)
+	if !debounced {
+		publishToChannel(c, caller.DB, channel, websocket.NewEvent(websocket.EventChannelTyping, gin.H{
+			"channel_id": channel.ID,
+			"server_id":  channel.ServerID,
+			"user": gin.H{
+				"id":       user.ID,
+				"username": user.Username,
+				"avatar":   user.Avatar,
 			},
-		})
+			"active":     active,
+			"expires_at": expiresAt,
+		}))
 	}
 
 	c.JSON(http.StatusAccepted, gin.H{
@@ -633,11 +1074,17 @@ func SendTypingIndicator(c *gin.Context) {
 		"data": gin.H{
 			"active":     active,
 			"expires_at": expiresAt,
+			"debounced":  debounced,
 		},
 	})
 }
 
 func serializeAttachment(attachment models.MessageAttachment) gin.H {
+	var waveform []int
+	if attachment.Waveform != "" {
+		_ = json.Unmarshal([]byte(attachment.Waveform), &waveform)
+	}
+
 	return gin.H{
 		"id":                 attachment.ID,
 		"object_key":         attachment.ObjectKey,
@@ -645,12 +1092,16 @@ func serializeAttachment(attachment models.MessageAttachment) gin.H {
 		"file_name":          attachment.FileName,
 		"content_type":       attachment.ContentType,
 		"file_size":          attachment.FileSize,
+		"alt_text":           attachment.AltText,
 		"width":              attachment.Width,
 		"height":             attachment.Height,
 		"preview_url":        attachment.PreviewURL,
 		"preview_object_key": attachment.PreviewObjectKey,
 		"preview_width":      attachment.PreviewWidth,
 		"preview_height":     attachment.PreviewHeight,
+		"waveform":           waveform,
+		"duration":           attachment.Duration,
+		"position":           attachment.Position,
 		"created_at":         attachment.CreatedAt.Format(time.RFC3339),
 	}
 }
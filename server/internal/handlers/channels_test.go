@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"cmp"
+	"database/sql/driver"
+	"slices"
+	"strings"
+	"testing"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// positionCreates creates channels one after another, each asking for a
+// position; 0 means "append". shifted lists the channels each create moves down.
+var positionCreates = []struct {
+	name     string
+	position int
+	shifted  []string
+}{
+	{name: "general", position: 0},
+	{name: "random", position: 0},
+	{name: "news", position: 1, shifted: []string{"random"}},
+	{name: "help", position: 1, shifted: []string{"news", "random"}},
+	{name: "last", position: 0},
+	{name: "intro", position: 2, shifted: []string{"news", "random", "last"}},
+}
+
+// wantPositionOrder is the channel order after positionCreates.
+var wantPositionOrder = []string{"general", "help", "intro", "news", "random", "last"}
+
+// fakeChannelTable is an in-memory channels table for one server that answers
+// the statements claimChannelPosition sends.
+type fakeChannelTable struct {
+	channels []models.Channel
+}
+
+func (f *fakeChannelTable) answer(t *testing.T) fakeQueryFunc {
+	return func(query string, args []driver.Value) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(query, `SELECT "id" FROM "servers"`):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{args[0]}}}, nil
+		case strings.HasPrefix(query, `UPDATE "channels" SET "position"=position + 1 WHERE server_id = $1 AND position >= $2`):
+			var affected int64
+			for i := range f.channels {
+				if int64(f.channels[i].Position) >= args[1].(int64) {
+					f.channels[i].Position++
+					affected++
+				}
+			}
+			return fakeResult{affected: affected}, nil
+		case strings.HasPrefix(query, `SELECT * FROM "channels" WHERE server_id = $1 AND position > $2 ORDER BY position ASC`):
+			result := fakeResult{columns: []string{"id", "name", "position"}}
+			for _, channel := range f.sorted() {
+				if int64(channel.Position) > args[1].(int64) {
+					result.rows = append(result.rows, []driver.Value{int64(channel.ID), channel.Name, int64(channel.Position)})
+				}
+			}
+			return result, nil
+		case strings.HasPrefix(query, `SELECT MAX(position) FROM "channels" WHERE server_id = $1`):
+			var highest driver.Value
+			for _, channel := range f.channels {
+				if highest == nil || int64(channel.Position) > highest.(int64) {
+					highest = int64(channel.Position)
+				}
+			}
+			return fakeResult{columns: []string{"max"}, rows: [][]driver.Value{{highest}}}, nil
+		}
+		t.Errorf("unexpected statement %q", query)
+		return fakeResult{}, nil
+	}
+}
+
+func (f *fakeChannelTable) sorted() []models.Channel {
+	return slices.SortedFunc(slices.Values(f.channels), func(a, b models.Channel) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+}
+
+// checkChannelOrder fails the test when two channels share a position or the
+// channels are not in wantPositionOrder.
+func checkChannelOrder(t *testing.T, channels []models.Channel) {
+	t.Helper()
+
+	var names []string
+	positions := map[int]string{}
+	for _, channel := range channels {
+		if other, taken := positions[channel.Position]; taken {
+			t.Fatalf("%s and %s share position %d", other, channel.Name, channel.Position)
+		}
+		positions[channel.Position] = channel.Name
+		names = append(names, channel.Name)
+	}
+
+	if !slices.Equal(names, wantPositionOrder) {
+		t.Fatalf("order = %v, want %v", names, wantPositionOrder)
+	}
+}
+
+func shiftedNames(shifted []models.Channel) []string {
+	var names []string
+	for _, channel := range shifted {
+		names = append(names, channel.Name)
+	}
+	return names
+}
+
+func TestClaimChannelPositionKeepsPositionsUnique(t *testing.T) {
+	table := &fakeChannelTable{}
+	db, _ := openFakeDB(t, table.answer(t))
+
+	for i, create := range positionCreates {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			position, shifted, err := claimChannelPosition(tx, 10, create.position)
+			if err != nil {
+				return err
+			}
+
+			if names := shiftedNames(shifted); !slices.Equal(names, create.shifted) {
+				t.Errorf("creating %s shifted %v, want %v", create.name, names, create.shifted)
+			}
+
+			table.channels = append(table.channels, models.Channel{ID: uint(i + 1), Name: create.name, ServerID: 10, Position: position})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", create.name, err)
+		}
+	}
+
+	checkChannelOrder(t, table.sorted())
+}
+
+func TestClaimChannelPositionKeepsPositionsUniqueInPostgres(t *testing.T) {
+	db := openTestDB(t)
+
+	owner := models.User{Username: "owner", Email: "owner@example.com", Password: "x"}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	server := models.Server{Name: "test", OwnerID: owner.ID}
+	if err := db.Create(&server).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, create := range positionCreates {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			position, shifted, err := claimChannelPosition(tx, server.ID, create.position)
+			if err != nil {
+				return err
+			}
+
+			if names := shiftedNames(shifted); !slices.Equal(names, create.shifted) {
+				t.Errorf("creating %s shifted %v, want %v", create.name, names, create.shifted)
+			}
+
+			return tx.Create(&models.Channel{Name: create.name, ServerID: server.ID, Position: position}).Error
+		})
+		if err != nil {
+			t.Fatalf("create %s: %v", create.name, err)
+		}
+	}
+
+	var channels []models.Channel
+	if err := db.Where("server_id = ?", server.ID).Order("position ASC").Find(&channels).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	checkChannelOrder(t, channels)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxClientNonceLength matches the size of the messages.client_nonce column.
+const maxClientNonceLength = 64
+
+// requestClientNonce returns the idempotency key for a message send, taken from the
+// client_nonce field or, failing that, the Idempotency-Key header. Nil means none was sent.
+func requestClientNonce(c *gin.Context, bodyNonce string) (*string, error) {
+	nonce := strings.TrimSpace(bodyNonce)
+	if nonce == "" {
+		nonce = strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+	}
+
+	if nonce == "" {
+		return nil, nil
+	}
+
+	if len(nonce) > maxClientNonceLength {
+		return nil, fmt.Errorf("client nonce must be at most %d characters", maxClientNonceLength)
+	}
+
+	return &nonce, nil
+}
+
+// replayMessageForNonce answers a retried send with the message already created for the
+// user's nonce. It returns false when no such message exists and the send should proceed.
+func replayMessageForNonce(c *gin.Context, db *gorm.DB, channel models.Channel, userID uint, nonce string) bool {
+	var message models.Message
+	if err := db.
+		Preload("User").
+		Preload("Attachments").
+		Preload("Mentions.User", preloadMentionUsers).
+		Preload("Emojis.Emoji").
+		Preload("LinkPreview").
+		Where("user_id = ? AND client_nonce = ?", userID, nonce).
+		First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load message")
+		return true
+	}
+
+	if message.ChannelID != channel.ID {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeClientNonceConflict, "client nonce was already used in another channel")
+		return true
+	}
+
+	applyAuthorNickname(db, &message)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Message already created",
+		"data": gin.H{
+			"message": serializeMessage(message),
+		},
+	})
+	return true
+}
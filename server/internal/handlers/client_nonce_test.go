@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestClientNonce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name      string
+		body      string
+		header    string
+		want      string
+		wantNil   bool
+		wantError bool
+	}{
+		{name: "none sent", wantNil: true},
+		{name: "body nonce", body: " abc-123 ", want: "abc-123"},
+		{name: "header fallback", header: "key-1", want: "key-1"},
+		{name: "body wins over header", body: "from-body", header: "from-header", want: "from-body"},
+		{name: "blank body uses header", body: "   ", header: "key-2", want: "key-2"},
+		{name: "at the limit", body: strings.Repeat("n", maxClientNonceLength), want: strings.Repeat("n", maxClientNonceLength)},
+		{name: "too long", header: strings.Repeat("n", maxClientNonceLength+1), wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/channels/1/messages", nil)
+			if tt.header != "" {
+				c.Request.Header.Set("Idempotency-Key", tt.header)
+			}
+
+			got, err := requestClientNonce(c, tt.body)
+			if tt.wantError {
+				if err == nil {
+					t.Fatalf("requestClientNonce = %v, want error", *got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("requestClientNonce: %v", err)
+			}
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("requestClientNonce = %q, want nil", *got)
+				}
+				return
+			}
+			if got == nil || *got != tt.want {
+				t.Fatalf("requestClientNonce = %v, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,581 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/logging"
+	"bafachat/internal/models"
+	"bafachat/internal/queue"
+	"bafachat/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultExportInlineMaxMessages = 1000
+	defaultExportInlineMaxMB       = 25
+	defaultExportTTL               = 7 * 24 * time.Hour
+
+	// exportMessageBatchSize bounds how many messages are loaded at once while exporting.
+	exportMessageBatchSize = 500
+)
+
+// dataExportPolicy decides when an export is answered inline and how long queued exports are kept.
+type dataExportPolicy struct {
+	// InlineMaxMessages is the most authored messages an inline export may contain.
+	InlineMaxMessages int64
+	// InlineMaxBytes caps the attachment bytes an inline zip may contain.
+	InlineMaxBytes int64
+	// TTL is how long a queued export stays downloadable.
+	TTL time.Duration
+}
+
+// dataExportPolicyFromEnv reads DATA_EXPORT_INLINE_MAX_MESSAGES, DATA_EXPORT_INLINE_MAX_MB
+// and DATA_EXPORT_TTL.
+func dataExportPolicyFromEnv() dataExportPolicy {
+	policy := dataExportPolicy{
+		InlineMaxMessages: defaultExportInlineMaxMessages,
+		InlineMaxBytes:    defaultExportInlineMaxMB * 1024 * 1024,
+		TTL:               defaultExportTTL,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("DATA_EXPORT_INLINE_MAX_MESSAGES")); raw != "" {
+		if value, err := strconv.ParseInt(raw, 10, 64); err == nil && value >= 0 {
+			policy.InlineMaxMessages = value
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("DATA_EXPORT_INLINE_MAX_MB")); raw != "" {
+		if value, err := strconv.ParseInt(raw, 10, 64); err == nil && value >= 0 {
+			policy.InlineMaxBytes = value * 1024 * 1024
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("DATA_EXPORT_TTL")); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			policy.TTL = value
+		}
+	}
+
+	return policy
+}
+
+// ExportCurrentUser returns the caller's profile, server memberships and authored
+// messages. With ?attachments=true the export is a zip that also holds the files
+// they attached. Small exports are returned directly; larger ones are built by the
+// queue worker, which emails a download link, and the request answers 202.
+func ExportCurrentUser(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	includeAttachments, _ := strconv.ParseBool(c.Query("attachments"))
+	policy := dataExportPolicyFromEnv()
+
+	var messageCount int64
+	if err := authoredMessages(caller.DB, caller.Claims.UserID).Model(&models.Message{}).Count(&messageCount).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to count messages")
+		return
+	}
+
+	var attachmentBytes int64
+	if includeAttachments {
+		if err := caller.DB.Model(&models.MessageAttachment{}).
+			Where("message_id IN (?)", authoredMessages(caller.DB, caller.Claims.UserID).Model(&models.Message{}).Select("id")).
+			Select("COALESCE(SUM(file_size), 0)").
+			Scan(&attachmentBytes).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to measure attachments")
+			return
+		}
+	}
+
+	storageService, hasStorage := getStorageService(c)
+	if includeAttachments && !hasStorage {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file storage is not configured")
+		return
+	}
+
+	if messageCount <= policy.InlineMaxMessages && attachmentBytes <= policy.InlineMaxBytes {
+		var user models.User
+		if err := caller.DB.First(&user, caller.Claims.UserID).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+			return
+		}
+
+		export, attachments, err := buildDataExport(caller.DB, user, includeAttachments)
+		if err != nil {
+			requestLogger(c).Error("failed to build data export", "user_id", user.ID, "error", err)
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to build export")
+			return
+		}
+
+		if !includeAttachments {
+			c.Header("Content-Disposition", `attachment; filename="`+dataExportFileName(time.Now(), "json")+`"`)
+			c.JSON(http.StatusOK, gin.H{"data": export})
+			return
+		}
+
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", `attachment; filename="`+dataExportFileName(time.Now(), "zip")+`"`)
+		c.Status(http.StatusOK)
+		if err := writeDataExportZip(c.Request.Context(), c.Writer, storageService, export, attachments); err != nil {
+			// The status is already sent, so the truncated zip is all the client will see.
+			requestLogger(c).Error("failed to stream data export", "user_id", user.ID, "error", err)
+		}
+		return
+	}
+
+	queueClient, hasQueue := getQueueClient(c)
+	if !hasQueue || !hasStorage {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "this account is too large to export right now")
+		return
+	}
+
+	var existing models.DataExport
+	err = caller.DB.Where("user_id = ? AND status = ?", caller.Claims.UserID, models.DataExportStatusPending).First(&existing).Error
+	if err == nil {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message": "An export is already being prepared. We'll email you a download link when it's ready.",
+			"data":    gin.H{"export": serializeDataExport(existing)},
+		})
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load exports")
+		return
+	}
+
+	export := models.DataExport{
+		UserID:             caller.Claims.UserID,
+		Status:             models.DataExportStatusPending,
+		IncludeAttachments: includeAttachments,
+	}
+	if err := caller.DB.Create(&export).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to start export")
+		return
+	}
+
+	task, err := queue.NewDataExportTask(queue.DataExportTaskPayload{
+		ExportID:  export.ID,
+		BaseURL:   requestBaseURL(c),
+		RequestID: logging.RequestID(c.Request.Context()),
+	})
+	if err == nil {
+		_, err = queueClient.Enqueue(task)
+	}
+	if err != nil {
+		_ = caller.DB.Delete(&export).Error
+		requestLogger(c).Error("failed to queue data export", "user_id", caller.Claims.UserID, "error", err)
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeServiceUnavailable, "failed to queue export")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Export started. We'll email you a download link when it's ready.",
+		"data":    gin.H{"export": serializeDataExport(export)},
+	})
+}
+
+// DownloadDataExport streams a finished export. The token from the email is the
+// only credential, so the link works without signing in until the export expires.
+func DownloadDataExport(c *gin.Context) {
+	db, ok := getDB(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+
+	storageService, ok := getStorageService(c)
+	if !ok {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file storage is not configured")
+		return
+	}
+
+	token := strings.TrimSpace(c.Param("token"))
+
+	var export models.DataExport
+	if err := db.WithContext(c).
+		Where("token_hash = ? AND status = ? AND expires_at > ?", auth.HashToken(token), models.DataExportStatusReady, time.Now()).
+		First(&export).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeExportNotFound, "export not found or expired")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load export")
+		return
+	}
+
+	stream, err := storageService.OpenObject(c.Request.Context(), export.ObjectKey, "")
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeExportNotFound, "export not found or expired")
+			return
+		}
+		apierror.Respond(c, http.StatusBadGateway, apierror.CodeStorageError, "failed to load export")
+		return
+	}
+	defer stream.Body.Close()
+
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, stream.ContentLength, "application/zip", stream.Body, map[string]string{
+		"Content-Disposition": `attachment; filename="` + dataExportFileName(export.CreatedAt, "zip") + `"`,
+	})
+}
+
+// NewDataExportProcessor returns the queue worker for data export tasks. It builds
+// the zip, stores it privately and emails the owner a download link. An export that
+// keeps failing is marked failed once its retries run out.
+func NewDataExportProcessor(db *gorm.DB, storageService *storage.Service, queueClient *asynq.Client) queue.DataExportProcessor {
+	return func(ctx context.Context, payload queue.DataExportTaskPayload) error {
+		err := buildQueuedDataExport(ctx, db, storageService, queueClient, payload)
+		if err == nil {
+			return nil
+		}
+
+		retried, _ := asynq.GetRetryCount(ctx)
+		maxRetry, _ := asynq.GetMaxRetry(ctx)
+		if retried >= maxRetry || errors.Is(err, asynq.SkipRetry) {
+			_ = db.WithContext(ctx).Model(&models.DataExport{}).
+				Where("id = ? AND status = ?", payload.ExportID, models.DataExportStatusPending).
+				Update("status", models.DataExportStatusFailed).Error
+		}
+
+		return err
+	}
+}
+
+func buildQueuedDataExport(ctx context.Context, db *gorm.DB, storageService *storage.Service, queueClient *asynq.Client, payload queue.DataExportTaskPayload) error {
+	db = db.WithContext(ctx)
+
+	var export models.DataExport
+	if err := db.First(&export, payload.ExportID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("load export: %w", err)
+	}
+	if export.Status != models.DataExportStatusPending {
+		return nil
+	}
+
+	var user models.User
+	if err := db.First(&user, export.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return db.Delete(&export).Error
+		}
+		return fmt.Errorf("load user: %w", err)
+	}
+
+	data, attachments, err := buildDataExport(db, user, export.IncludeAttachments)
+	if err != nil {
+		return fmt.Errorf("build export: %w", err)
+	}
+
+	file, err := os.CreateTemp("", "bafachat-export-*.zip")
+	if err != nil {
+		return fmt.Errorf("create temp file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := writeDataExportZip(ctx, file, storageService, data, attachments); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	objectKey, err := storageService.UploadExportObject(ctx, user.ID, size, file)
+	if err != nil {
+		return fmt.Errorf("upload export: %w", err)
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(dataExportPolicyFromEnv().TTL)
+	if err := db.Model(&export).Updates(map[string]interface{}{
+		"status":       models.DataExportStatusReady,
+		"token_hash":   auth.HashToken(token),
+		"object_key":   objectKey,
+		"file_size":    size,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	}).Error; err != nil {
+		_ = storageService.DeleteObject(ctx, objectKey)
+		return fmt.Errorf("store export: %w", err)
+	}
+
+	downloadURL := fmt.Sprintf("%s/api/v1/exports/%s", strings.TrimRight(payload.BaseURL, "/"), token)
+	task, err := queue.NewEmailTask(dataExportEmailPayload(user, downloadURL, expiresAt))
+	if err == nil {
+		_, err = queueClient.EnqueueContext(ctx, task)
+	}
+	if err != nil {
+		// The export itself is done; retrying would build it again.
+		logging.FromContext(ctx).Error("failed to queue data export email", "export_id", export.ID, "error", err)
+	}
+
+	return nil
+}
+
+// SweepExpiredDataExports removes exports past their download window along with
+// their stored zips. It returns how many exports were removed.
+func SweepExpiredDataExports(ctx context.Context, db *gorm.DB, storageService *storage.Service) (int, error) {
+	var exports []models.DataExport
+	if err := db.WithContext(ctx).
+		Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).
+		Find(&exports).Error; err != nil {
+		return 0, fmt.Errorf("load expired exports: %w", err)
+	}
+	if len(exports) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uint, 0, len(exports))
+	keys := make([]string, 0, len(exports))
+	for _, export := range exports {
+		ids = append(ids, export.ID)
+		if export.ObjectKey != "" {
+			keys = append(keys, export.ObjectKey)
+		}
+	}
+
+	if storageService != nil && len(keys) > 0 {
+		if err := storageService.DeleteObjects(ctx, keys); err != nil {
+			return 0, fmt.Errorf("delete expired export objects: %w", err)
+		}
+	}
+
+	if err := db.WithContext(ctx).Where("id IN ?", ids).Delete(&models.DataExport{}).Error; err != nil {
+		return 0, fmt.Errorf("delete expired exports: %w", err)
+	}
+
+	return len(exports), nil
+}
+
+// authoredMessages scopes to the messages the user wrote themselves, leaving out
+// webhook messages posted under their name and messages that have expired.
+func authoredMessages(db *gorm.DB, userID uint) *gorm.DB {
+	return db.Scopes(unexpiredMessages).Where("messages.user_id = ? AND messages.webhook_id IS NULL", userID)
+}
+
+// buildDataExport gathers the user's profile, memberships and authored messages.
+// When attachments are included, each attachment records the path its file has in
+// the zip, and the attachments are returned so the caller can add the files.
+func buildDataExport(db *gorm.DB, user models.User, includeAttachments bool) (gin.H, []exportedAttachment, error) {
+	type membershipRow struct {
+		ServerID   uint
+		ServerName string
+		Role       string
+		JoinedAt   time.Time
+	}
+
+	var memberships []membershipRow
+	if err := db.Table("server_members").
+		Select("server_members.server_id, servers.name AS server_name, server_members.role, server_members.joined_at").
+		Joins("JOIN servers ON servers.id = server_members.server_id").
+		Where("server_members.user_id = ?", user.ID).
+		Order("server_members.joined_at ASC").
+		Scan(&memberships).Error; err != nil {
+		return nil, nil, fmt.Errorf("load memberships: %w", err)
+	}
+
+	servers := make([]gin.H, 0, len(memberships))
+	for _, membership := range memberships {
+		servers = append(servers, gin.H{
+			"id":        membership.ServerID,
+			"name":      membership.ServerName,
+			"role":      membership.Role,
+			"joined_at": membership.JoinedAt.Format(time.RFC3339),
+		})
+	}
+
+	var channels []models.Channel
+	if err := db.Select("id", "name", "server_id").
+		Where("id IN (?)", authoredMessages(db, user.ID).Model(&models.Message{}).Distinct("channel_id")).
+		Find(&channels).Error; err != nil {
+		return nil, nil, fmt.Errorf("load channels: %w", err)
+	}
+	channelsByID := make(map[uint]models.Channel, len(channels))
+	for _, channel := range channels {
+		channelsByID[channel.ID] = channel
+	}
+
+	messages := make([]gin.H, 0)
+	attachments := make([]exportedAttachment, 0)
+
+	var batch []models.Message
+	result := authoredMessages(db, user.ID).
+		Preload("Attachments").
+		Order("messages.id ASC").
+		FindInBatches(&batch, exportMessageBatchSize, func(tx *gorm.DB, _ int) error {
+			for _, message := range batch {
+				channel := channelsByID[message.ChannelID]
+
+				files := make([]gin.H, 0, len(message.Attachments))
+				for _, attachment := range message.Attachments {
+					file := gin.H{
+						"id":           attachment.ID,
+						"file_name":    attachment.FileName,
+						"content_type": attachment.ContentType,
+						"file_size":    attachment.FileSize,
+						"url":          attachment.URL,
+					}
+					if includeAttachments {
+						exported := exportedAttachment{
+							ObjectKey: attachment.ObjectKey,
+							Path:      fmt.Sprintf("attachments/%d-%s", attachment.ID, zipEntryName(attachment.FileName)),
+						}
+						file["path"] = exported.Path
+						attachments = append(attachments, exported)
+					}
+					files = append(files, file)
+				}
+
+				var editedAt string
+				if message.EditedAt != nil {
+					editedAt = message.EditedAt.Format(time.RFC3339)
+				}
+
+				messages = append(messages, gin.H{
+					"id":           message.ID,
+					"server_id":    channel.ServerID,
+					"channel_id":   message.ChannelID,
+					"channel_name": channel.Name,
+					"type":         message.Type,
+					"content":      message.Content,
+					"attachments":  files,
+					"created_at":   message.CreatedAt.Format(time.RFC3339),
+					"edited_at":    editedAt,
+				})
+			}
+			return nil
+		})
+	if result.Error != nil {
+		return nil, nil, fmt.Errorf("load messages: %w", result.Error)
+	}
+
+	return gin.H{
+		"exported_at": time.Now().Format(time.RFC3339),
+		"profile":     serializeUser(user),
+		"servers":     servers,
+		"messages":    messages,
+	}, attachments, nil
+}
+
+// exportedAttachment is an attachment file to copy into an export zip.
+type exportedAttachment struct {
+	ObjectKey string
+	Path      string
+}
+
+// writeDataExportZip writes export.json and the attachment files into a zip.
+// Attachments that are missing from storage are skipped.
+func writeDataExportZip(ctx context.Context, w io.Writer, storageService *storage.Service, export gin.H, attachments []exportedAttachment) error {
+	archive := zip.NewWriter(w)
+
+	entry, err := archive.Create("export.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	for _, attachment := range attachments {
+		stream, err := storageService.OpenObject(ctx, attachment.ObjectKey, "")
+		if err != nil {
+			if errors.Is(err, storage.ErrObjectNotFound) {
+				continue
+			}
+			return err
+		}
+
+		entry, err := archive.CreateHeader(&zip.FileHeader{Name: attachment.Path, Method: zip.Store})
+		if err == nil {
+			_, err = io.Copy(entry, stream.Body)
+		}
+		stream.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func dataExportEmailPayload(user models.User, downloadURL string, expiresAt time.Time) queue.EmailTaskPayload {
+	expires := expiresAt.UTC().Format("January 2, 2006")
+	intro := "Your BafaChat data export is ready."
+
+	htmlBody := fmt.Sprintf(`<p>Hi %s,</p><p>%s It stays available until %s.</p><p><a href="%s" style="background-color:#38bdf8;border-radius:8px;color:#0f172a;padding:10px 16px;text-decoration:none;font-weight:600;">Download export</a></p><p>If you didn't request this export, change your password.</p><p>— The BafaChat Team</p>`,
+		user.Username,
+		intro,
+		expires,
+		downloadURL,
+	)
+	textBody := fmt.Sprintf("Hi %s,\n\n%s It stays available until %s.\n\nDownload: %s\n\nIf you didn't request this export, change your password.\n\n— The BafaChat Team", user.Username, intro, expires, downloadURL)
+
+	return queue.EmailTaskPayload{
+		To:       user.Email,
+		Subject:  "Your BafaChat data export is ready",
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		Tag:      "data-export",
+	}
+}
+
+func serializeDataExport(export models.DataExport) gin.H {
+	var expiresAt string
+	if export.ExpiresAt != nil {
+		expiresAt = export.ExpiresAt.Format(time.RFC3339)
+	}
+
+	return gin.H{
+		"id":                  export.ID,
+		"status":              export.Status,
+		"include_attachments": export.IncludeAttachments,
+		"expires_at":          expiresAt,
+		"created_at":          export.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func dataExportFileName(at time.Time, ext string) string {
+	return fmt.Sprintf("bafachat-export-%s.%s", at.UTC().Format("2006-01-02"), ext)
+}
+
+// zipEntryName keeps an attachment's file name from escaping its folder in the zip.
+func zipEntryName(name string) string {
+	name = strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(strings.TrimSpace(name))
+	if name == "" {
+		return "file"
+	}
+	return name
+}
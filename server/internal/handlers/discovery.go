@@ -0,0 +1,324 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultDiscoverPageSize = 24
+	maxDiscoverPageSize     = 100
+)
+
+var errInvalidServerTag = errors.New("tags may only contain lowercase letters, digits and dashes")
+
+type discoverableServerRow struct {
+	ID          uint
+	Name        string
+	Description string
+	Icon        string
+	Tags        string
+	MemberCount int64
+	CreatedAt   time.Time
+}
+
+// UpdateServerDiscovery lets the owner list the server in public discovery and set
+// the description and tags shown there.
+func UpdateServerDiscovery(c *gin.Context) {
+	var req models.UpdateServerDiscoveryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can change discovery settings"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var server models.Server
+	if err := caller.DB.First(&server, serverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
+		return
+	}
+
+	if req.Public != nil {
+		server.Public = *req.Public
+	}
+	if req.Description != nil {
+		server.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.Tags != nil {
+		tags, err := normalizeServerTags(req.Tags)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, err)
+			return
+		}
+		server.Tags = strings.Join(tags, ",")
+	}
+
+	if err := caller.DB.Model(&server).Updates(map[string]interface{}{
+		"public":      server.Public,
+		"description": server.Description,
+		"tags":        server.Tags,
+	}).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update discovery settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Discovery settings updated",
+		"data": gin.H{
+			"server_id":   server.ID,
+			"public":      server.Public,
+			"description": server.Description,
+			"tags":        serverTags(server),
+		},
+	})
+}
+
+// DiscoverServers lists servers whose owners opted into discovery, with member
+// counts. q matches the name or a tag, tag filters by an exact tag, and results
+// are paged by server ID with limit and cursor.
+func DiscoverServers(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	limit := defaultDiscoverPageSize
+	if rawLimit := strings.TrimSpace(c.Query("limit")); rawLimit != "" {
+		if parsedLimit, err := strconv.Atoi(rawLimit); err == nil {
+			limit = min(max(parsedLimit, 1), maxDiscoverPageSize)
+		}
+	}
+
+	var cursor uint64
+	if rawCursor := strings.TrimSpace(c.Query("cursor")); rawCursor != "" {
+		parsed, err := strconv.ParseUint(rawCursor, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "invalid cursor")
+			return
+		}
+		cursor = parsed
+	}
+
+	memberCounts := caller.DB.
+		Model(&models.ServerMember{}).
+		Select("COUNT(*)").
+		Where("server_members.server_id = servers.id AND server_members.role <> ?", models.ServerRolePending)
+
+	query := caller.DB.
+		Model(&models.Server{}).
+		Select("servers.id, servers.name, servers.description, servers.icon, servers.tags, servers.created_at, (?) AS member_count", memberCounts).
+		Where("servers.public = ?", true)
+
+	if search := strings.ToLower(strings.TrimSpace(c.Query("q"))); search != "" {
+		pattern := "%" + escapeLike(search) + "%"
+		query = query.Where("(LOWER(servers.name) LIKE ? OR LOWER(servers.tags) LIKE ?)", pattern, pattern)
+	}
+	if tag := strings.ToLower(strings.TrimSpace(c.Query("tag"))); tag != "" {
+		query = query.Where("',' || servers.tags || ',' LIKE ?", "%,"+escapeLike(tag)+",%")
+	}
+	if cursor > 0 {
+		query = query.Where("servers.id > ?", cursor)
+	}
+
+	var rows []discoverableServerRow
+	if err := query.Order("servers.id ASC").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load servers")
+		return
+	}
+
+	hasMore := false
+	if len(rows) > limit {
+		hasMore = true
+		rows = rows[:limit]
+	}
+
+	ids := make([]uint, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+
+	joined := make(map[uint]bool, len(rows))
+	if len(ids) > 0 {
+		var memberOf []uint
+		if err := caller.DB.Model(&models.ServerMember{}).
+			Where("user_id = ? AND server_id IN ?", caller.Claims.UserID, ids).
+			Pluck("server_id", &memberOf).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load memberships")
+			return
+		}
+		for _, id := range memberOf {
+			joined[id] = true
+		}
+	}
+
+	var online map[uint]int
+	if hub, ok := getWebSocketHub(c); ok {
+		online = hub.OnlineServerMemberCounts(ids)
+	}
+
+	servers := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		servers = append(servers, gin.H{
+			"id":           row.ID,
+			"name":         row.Name,
+			"description":  row.Description,
+			"icon":         row.Icon,
+			"tags":         serverTags(models.Server{Tags: row.Tags}),
+			"member_count": row.MemberCount,
+			"online_count": online[row.ID],
+			"joined":       joined[row.ID],
+			"created_at":   row.CreatedAt.Format(time.RFC3339),
+		})
+	}
+
+	payload := gin.H{
+		"servers":  servers,
+		"has_more": hasMore,
+	}
+
+	if hasMore && len(rows) > 0 {
+		payload["next_cursor"] = strconv.FormatUint(uint64(rows[len(rows)-1].ID), 10)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": payload})
+}
+
+// JoinPublicServer adds the caller to a server listed in discovery without an
+// invite. Bans and the server's join gate apply as they do for invites. Servers
+// that are not public answer as if they did not exist.
+func JoinPublicServer(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	serverIDValue, err := strconv.ParseUint(c.Param("serverID"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid server id")
+		return
+	}
+
+	var (
+		server     models.Server
+		membership models.ServerMember
+		joined     bool
+	)
+	err = caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND public = ?", uint(serverIDValue), true).First(&server).Error; err != nil {
+			return err
+		}
+
+		banned, err := isUserBanned(tx, server.ID, caller.Claims.UserID)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return errServerBanned
+		}
+
+		err = tx.Where("server_id = ? AND user_id = ?", server.ID, caller.Claims.UserID).First(&membership).Error
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		membership = models.ServerMember{
+			ServerID: server.ID,
+			UserID:   caller.Claims.UserID,
+			Role:     initialMemberRole(server),
+		}
+		if err := tx.Create(&membership).Error; err != nil {
+			return err
+		}
+		joined = true
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+		case errors.Is(err, errServerBanned):
+			respondError(c, http.StatusForbidden, err)
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to join server")
+		}
+		return
+	}
+
+	if joined && membership.Role != models.ServerRolePending {
+		handleMemberJoined(c, server.ID, caller.Claims.UserID)
+	}
+
+	server.CurrentMemberRole = membership.Role
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Joined server",
+		"data": gin.H{
+			"server":     serializeServer(server),
+			"membership": serializeServerMembership(membership),
+		},
+	})
+}
+
+// normalizeServerTags lowercases and de-duplicates tags, keeping their order.
+func normalizeServerTags(raw []string) ([]string, error) {
+	tags := make([]string, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for _, tag := range raw {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return nil, errInvalidServerTag
+			}
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	return tags, nil
+}
+
+// serverTags splits the stored comma-separated tags.
+func serverTags(server models.Server) []string {
+	if server.Tags == "" {
+		return []string{}
+	}
+
+	return strings.Split(server.Tags, ",")
+}
+
+// escapeLike escapes LIKE wildcards so user input only matches literally.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+}
@@ -0,0 +1,317 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	// Schedules name IANA zones, which must resolve on hosts without zoneinfo.
+	_ "time/tzdata"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const minutesPerDay = 24 * 60
+
+var (
+	errInvalidDNDTime     = errors.New("start and end must be times in HH:MM format")
+	errInvalidDNDTimezone = errors.New("timezone must be an IANA time zone such as Europe/London")
+	errInvalidDNDDays     = errors.New("days must be weekday numbers from 0 (Sunday) to 6")
+)
+
+// GetDNDSchedule returns the current user's quiet hours and whether do not
+// disturb is in effect right now.
+func GetDNDSchedule(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	schedule, err := loadDNDSchedule(caller.DB, caller.Claims.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load do not disturb schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"schedule": serializeDNDSchedule(schedule, time.Now()),
+		},
+	})
+}
+
+// UpdateDNDSchedule changes the current user's quiet hours.
+func UpdateDNDSchedule(c *gin.Context) {
+	var req models.UpdateDNDScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	schedule, err := loadDNDSchedule(caller.DB, caller.Claims.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load do not disturb schedule")
+		return
+	}
+
+	if err := applyDNDScheduleUpdate(&schedule, req); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidDNDSchedule, err.Error())
+		return
+	}
+
+	if err := caller.DB.Save(&schedule).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update do not disturb schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Do not disturb schedule updated",
+		"data": gin.H{
+			"schedule": serializeDNDSchedule(schedule, time.Now()),
+		},
+	})
+}
+
+// SetDNDOverride turns do not disturb on or off for the given number of minutes,
+// overriding the schedule until then.
+func SetDNDOverride(c *gin.Context) {
+	var req models.SetDNDOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	schedule, err := loadDNDSchedule(caller.DB, caller.Claims.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load do not disturb schedule")
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(time.Duration(req.DurationMinutes) * time.Minute)
+	schedule.OverrideActive = req.Active
+	schedule.OverrideUntil = &until
+
+	if err := caller.DB.Save(&schedule).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update do not disturb schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Do not disturb override set",
+		"data": gin.H{
+			"schedule": serializeDNDSchedule(schedule, now),
+		},
+	})
+}
+
+// ClearDNDOverride ends a manual toggle so the schedule applies again.
+func ClearDNDOverride(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	schedule, err := loadDNDSchedule(caller.DB, caller.Claims.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load do not disturb schedule")
+		return
+	}
+
+	schedule.OverrideActive = false
+	schedule.OverrideUntil = nil
+
+	if err := caller.DB.Save(&schedule).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update do not disturb schedule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Do not disturb override cleared",
+		"data": gin.H{
+			"schedule": serializeDNDSchedule(schedule, time.Now()),
+		},
+	})
+}
+
+// loadDNDSchedule returns the user's saved schedule, or a disabled one if they have none.
+func loadDNDSchedule(db *gorm.DB, userID uint) (models.DNDSchedule, error) {
+	var schedule models.DNDSchedule
+	if err := db.Where("user_id = ?", userID).First(&schedule).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.DNDSchedule{UserID: userID, Timezone: "UTC"}, nil
+		}
+		return schedule, err
+	}
+
+	return schedule, nil
+}
+
+// userInDND reports whether mention push notifications and emails should be held
+// back for the user at now, either because they chose the dnd presence status or
+// because of their schedule.
+func userInDND(db *gorm.DB, user models.User, now time.Time) (bool, error) {
+	if user.PresenceStatus == models.PresenceStatusDND {
+		return true, nil
+	}
+
+	schedule, err := loadDNDSchedule(db, user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return dndActive(schedule, now), nil
+}
+
+// dndActive reports whether the schedule, or a manual override of it, puts the
+// user in do not disturb at now.
+func dndActive(schedule models.DNDSchedule, now time.Time) bool {
+	if schedule.OverrideUntil != nil && now.Before(*schedule.OverrideUntil) {
+		return schedule.OverrideActive
+	}
+
+	if !schedule.Enabled {
+		return false
+	}
+
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+
+	local := now.In(location)
+	minute := local.Hour()*60 + local.Minute()
+	days := parseDNDDays(schedule.Days)
+	startsOn := func(day time.Weekday) bool {
+		return len(days) == 0 || slices.Contains(days, int(day))
+	}
+
+	start, end := schedule.StartMinute, schedule.EndMinute
+	switch {
+	case start == end:
+		return startsOn(local.Weekday())
+	case start < end:
+		return startsOn(local.Weekday()) && minute >= start && minute < end
+	default:
+		// The window runs past midnight, so the early hours belong to yesterday's window.
+		if minute >= start {
+			return startsOn(local.Weekday())
+		}
+		return minute < end && startsOn(local.AddDate(0, 0, -1).Weekday())
+	}
+}
+
+func applyDNDScheduleUpdate(schedule *models.DNDSchedule, req models.UpdateDNDScheduleRequest) error {
+	if req.Start != nil {
+		minute, err := parseDNDTime(*req.Start)
+		if err != nil {
+			return err
+		}
+		schedule.StartMinute = minute
+	}
+	if req.End != nil {
+		minute, err := parseDNDTime(*req.End)
+		if err != nil {
+			return err
+		}
+		schedule.EndMinute = minute
+	}
+	if req.Timezone != nil {
+		timezone := strings.TrimSpace(*req.Timezone)
+		if timezone == "" || strings.EqualFold(timezone, "local") {
+			return errInvalidDNDTimezone
+		}
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return errInvalidDNDTimezone
+		}
+		schedule.Timezone = timezone
+	}
+	if req.Days != nil {
+		days := make([]string, 0, len(*req.Days))
+		seen := make(map[int]bool, len(*req.Days))
+		for _, day := range *req.Days {
+			if day < 0 || day > 6 {
+				return errInvalidDNDDays
+			}
+			if seen[day] {
+				continue
+			}
+			seen[day] = true
+			days = append(days, strconv.Itoa(day))
+		}
+		slices.Sort(days)
+		schedule.Days = strings.Join(days, ",")
+	}
+	if req.Enabled != nil {
+		schedule.Enabled = *req.Enabled
+	}
+
+	return nil
+}
+
+// parseDNDTime parses "HH:MM" into minutes after midnight.
+func parseDNDTime(value string) (int, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, errInvalidDNDTime
+	}
+
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
+
+func formatDNDTime(minute int) string {
+	minute = ((minute % minutesPerDay) + minutesPerDay) % minutesPerDay
+	return fmt.Sprintf("%02d:%02d", minute/60, minute%60)
+}
+
+func parseDNDDays(raw string) []int {
+	days := []int{}
+	for _, part := range strings.Split(raw, ",") {
+		if day, err := strconv.Atoi(strings.TrimSpace(part)); err == nil {
+			days = append(days, day)
+		}
+	}
+
+	return days
+}
+
+func serializeDNDSchedule(schedule models.DNDSchedule, now time.Time) gin.H {
+	var override gin.H
+	if schedule.OverrideUntil != nil && now.Before(*schedule.OverrideUntil) {
+		override = gin.H{
+			"active": schedule.OverrideActive,
+			"until":  schedule.OverrideUntil.UTC().Format(time.RFC3339),
+		}
+	}
+
+	return gin.H{
+		"enabled":    schedule.Enabled,
+		"start":      formatDNDTime(schedule.StartMinute),
+		"end":        formatDNDTime(schedule.EndMinute),
+		"timezone":   schedule.Timezone,
+		"days":       parseDNDDays(schedule.Days),
+		"override":   override,
+		"active_now": dndActive(schedule, now),
+	}
+}
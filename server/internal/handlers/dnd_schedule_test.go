@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDNDActive(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		// 2 March 2026 is a Monday.
+		return time.Date(2026, time.March, day, hour, minute, 0, 0, time.UTC)
+	}
+	weeknights := models.DNDSchedule{Enabled: true, StartMinute: 22 * 60, EndMinute: 7 * 60, Timezone: "UTC", Days: "1,2,3,4,5"}
+	officeHoursNY := models.DNDSchedule{Enabled: true, StartMinute: 9 * 60, EndMinute: 17 * 60, Timezone: "America/New_York"}
+
+	future := at(3, 8, 0)
+	past := at(2, 11, 0)
+
+	tests := []struct {
+		name     string
+		schedule models.DNDSchedule
+		now      time.Time
+		want     bool
+	}{
+		{name: "overnight window start day", schedule: weeknights, now: at(2, 23, 0), want: true},
+		{name: "overnight window after midnight", schedule: weeknights, now: at(3, 3, 0), want: true},
+		{name: "friday night runs into saturday", schedule: weeknights, now: at(7, 3, 0), want: true},
+		{name: "saturday night not scheduled", schedule: weeknights, now: at(7, 23, 0), want: false},
+		{name: "monday morning belongs to sunday", schedule: weeknights, now: at(2, 3, 0), want: false},
+		{name: "end is exclusive", schedule: weeknights, now: at(3, 7, 0), want: false},
+		{name: "daytime outside window", schedule: weeknights, now: at(2, 12, 0), want: false},
+		{name: "schedule timezone inside window", schedule: officeHoursNY, now: at(2, 15, 0), want: true},
+		{name: "schedule timezone after window", schedule: officeHoursNY, now: at(2, 22, 0), want: false},
+		{name: "equal start and end is all day", schedule: models.DNDSchedule{Enabled: true, StartMinute: 0, EndMinute: 0, Timezone: "UTC"}, now: at(4, 13, 0), want: true},
+		{name: "disabled", schedule: models.DNDSchedule{StartMinute: 0, EndMinute: 0, Timezone: "UTC"}, now: at(4, 13, 0), want: false},
+		{name: "override off beats schedule", schedule: withOverride(weeknights, false, future), now: at(2, 23, 0), want: false},
+		{name: "override on beats schedule", schedule: withOverride(weeknights, true, future), now: at(2, 12, 0), want: true},
+		{name: "expired override ignored", schedule: withOverride(weeknights, true, past), now: at(2, 12, 0), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := dndActive(tt.schedule, tt.now); got != tt.want {
+				t.Fatalf("dndActive(%s) = %v, want %v", tt.now.Format(time.RFC3339), got, tt.want)
+			}
+		})
+	}
+}
+
+func withOverride(schedule models.DNDSchedule, active bool, until time.Time) models.DNDSchedule {
+	schedule.OverrideActive = active
+	schedule.OverrideUntil = &until
+	return schedule
+}
+
+func TestApplyDNDScheduleUpdate(t *testing.T) {
+	str := func(value string) *string { return &value }
+	days := func(values ...int) *[]int { return &values }
+	enabled := true
+
+	schedule := models.DNDSchedule{Timezone: "UTC"}
+	err := applyDNDScheduleUpdate(&schedule, models.UpdateDNDScheduleRequest{
+		Enabled:  &enabled,
+		Start:    str("22:30"),
+		End:      str(" 06:45 "),
+		Timezone: str("America/New_York"),
+		Days:     days(5, 1, 5, 3),
+	})
+	if err != nil {
+		t.Fatalf("applyDNDScheduleUpdate: %v", err)
+	}
+	if !schedule.Enabled || schedule.StartMinute != 22*60+30 || schedule.EndMinute != 6*60+45 {
+		t.Fatalf("schedule = %+v, want enabled 22:30-06:45", schedule)
+	}
+	if schedule.Timezone != "America/New_York" {
+		t.Fatalf("Timezone = %q, want %q", schedule.Timezone, "America/New_York")
+	}
+	if schedule.Days != "1,3,5" {
+		t.Fatalf("Days = %q, want %q", schedule.Days, "1,3,5")
+	}
+
+	tests := []struct {
+		name string
+		req  models.UpdateDNDScheduleRequest
+		want error
+	}{
+		{name: "bad start", req: models.UpdateDNDScheduleRequest{Start: str("25:00")}, want: errInvalidDNDTime},
+		{name: "bad end", req: models.UpdateDNDScheduleRequest{End: str("7pm")}, want: errInvalidDNDTime},
+		{name: "local timezone", req: models.UpdateDNDScheduleRequest{Timezone: str("Local")}, want: errInvalidDNDTimezone},
+		{name: "unknown timezone", req: models.UpdateDNDScheduleRequest{Timezone: str("Mars/Olympus_Mons")}, want: errInvalidDNDTimezone},
+		{name: "day out of range", req: models.UpdateDNDScheduleRequest{Days: days(7)}, want: errInvalidDNDDays},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := models.DNDSchedule{Timezone: "UTC"}
+			if err := applyDNDScheduleUpdate(&schedule, tt.req); !errors.Is(err, tt.want) {
+				t.Fatalf("applyDNDScheduleUpdate error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerializeDNDSchedule(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+	until := now.Add(30 * time.Minute)
+	schedule := models.DNDSchedule{
+		Enabled:        true,
+		StartMinute:    22 * 60,
+		EndMinute:      7 * 60,
+		Timezone:       "UTC",
+		Days:           "1,2",
+		OverrideActive: true,
+		OverrideUntil:  &until,
+	}
+
+	got := serializeDNDSchedule(schedule, now)
+	if got["start"] != "22:00" || got["end"] != "07:00" {
+		t.Fatalf("start/end = %v/%v, want 22:00/07:00", got["start"], got["end"])
+	}
+	if got["active_now"] != true {
+		t.Fatalf("active_now = %v, want true while the override is on", got["active_now"])
+	}
+	if override, _ := got["override"].(gin.H); override == nil {
+		t.Fatal("override = nil, want the active override")
+	}
+
+	got = serializeDNDSchedule(schedule, until.Add(time.Second))
+	if override, _ := got["override"].(gin.H); override != nil {
+		t.Fatalf("override after expiry = %v, want nil", override)
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/email"
+	"bafachat/internal/models"
+	"bafachat/internal/queue"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// emailChangeTokenTTL bounds how long an email change confirmation link stays valid.
+const emailChangeTokenTTL = 24 * time.Hour
+
+var errEmailInUse = errors.New("email is already in use")
+
+// RequestEmailChange stores a pending email address for the current user and sends a
+// confirmation link to it. The account email only changes once the link is confirmed.
+func RequestEmailChange(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := caller.DB.First(&user, caller.Claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return
+	}
+
+	if err := auth.ComparePassword(user.Password, strings.TrimSpace(req.CurrentPassword)); err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeIncorrectPassword, "current password is incorrect")
+		return
+	}
+
+	newEmail := strings.ToLower(strings.TrimSpace(req.Email))
+	if newEmail == user.Email {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeEmailUnchanged, "new email must be different from the current email")
+		return
+	}
+
+	inUse, err := isEmailInUse(caller.DB, newEmail, user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to check email")
+		return
+	}
+	if inUse {
+		respondError(c, http.StatusConflict, errEmailInUse)
+		return
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate confirmation token")
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"pending_email":         newEmail,
+		"pending_email_token":   token,
+		"pending_email_sent_at": now,
+	}
+
+	if err := caller.DB.Model(&user).Updates(updates).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to save pending email")
+		return
+	}
+
+	user.PendingEmail = newEmail
+	user.PendingEmailToken = token
+	user.PendingEmailSentAt = &now
+
+	sendEmailChangeConfirmation(c, &user)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Check your new email address to confirm the change.",
+		"data": gin.H{
+			"pending_email": newEmail,
+		},
+	})
+}
+
+// ConfirmEmailChange applies a pending email change using the token sent to the new address.
+func ConfirmEmailChange(c *gin.Context) {
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeTokenRequired, "confirmation token is required")
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+
+	var user models.User
+	if err := db.WithContext(c).Where("pending_email_token = ?", token).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidConfirmationToken, "invalid or expired confirmation token")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to confirm email")
+		return
+	}
+
+	if user.PendingEmail == "" || user.PendingEmailSentAt == nil || time.Since(*user.PendingEmailSentAt) > emailChangeTokenTTL {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidConfirmationToken, "invalid or expired confirmation token")
+		return
+	}
+
+	inUse, err := isEmailInUse(db.WithContext(c), user.PendingEmail, user.ID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to check email")
+		return
+	}
+	if inUse {
+		respondError(c, http.StatusConflict, errEmailInUse)
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]any{
+		"email":                 user.PendingEmail,
+		"email_verified_at":     now,
+		"pending_email":         "",
+		"pending_email_token":   "",
+		"pending_email_sent_at": nil,
+	}
+
+	if err := db.WithContext(c).Model(&user).Updates(updates).Error; err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			respondError(c, http.StatusConflict, errEmailInUse)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update email")
+		return
+	}
+
+	user.Email = user.PendingEmail
+	user.EmailVerifiedAt = &now
+	user.PendingEmail = ""
+	user.PendingEmailToken = ""
+	user.PendingEmailSentAt = nil
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email updated successfully",
+		"data": gin.H{
+			"user": serializeUser(user),
+		},
+	})
+}
+
+func isEmailInUse(db *gorm.DB, emailAddr string, excludeUserID uint) (bool, error) {
+	var count int64
+	if err := db.Model(&models.User{}).
+		Where("email = ? AND id <> ?", emailAddr, excludeUserID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func sendEmailChangeConfirmation(c *gin.Context, user *models.User) {
+	queueClient, hasQueue := getQueueClient(c)
+	emailService, hasEmail := getEmailService(c)
+	if !hasQueue && !hasEmail {
+		return
+	}
+
+	baseURL := strings.TrimSpace(os.Getenv("APP_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultAppBaseURL
+	}
+
+	confirmURL := fmt.Sprintf("%s/confirm-email?token=%s", strings.TrimRight(baseURL, "/"), user.PendingEmailToken)
+	subject := "Confirm your new BafaChat email address"
+	htmlBody := fmt.Sprintf(`<p>Hi %s,</p><p>We received a request to change the email address on your BafaChat account to this one. Confirm the change by clicking the button below:</p><p><a href="%s" style="background-color:#38bdf8;border-radius:8px;color:#0f172a;padding:10px 16px;text-decoration:none;font-weight:600;">Confirm Email</a></p><p>If the button doesn't work, copy and paste this link into your browser:</p><p>%s</p><p>If you didn't request this, you can ignore this email.</p><p>— The BafaChat Team</p>`, user.Username, confirmURL, confirmURL)
+	textBody := fmt.Sprintf("Hi %s,\n\nWe received a request to change the email address on your BafaChat account to this one. Confirm the change by visiting the link below:\n%s\n\nIf you didn't request this, you can ignore this email.\n\n— The BafaChat Team", user.Username, confirmURL)
+
+	payload := queue.EmailTaskPayload{
+		To:       user.PendingEmail,
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		Tag:      "auth-email-change",
+		Meta: map[string]string{
+			"user_id": fmt.Sprintf("%d", user.ID),
+		},
+	}
+
+	ctx := c.Request.Context()
+
+	if hasQueue {
+		task, err := queue.NewEmailTask(payload)
+		if err == nil {
+			if _, enqueueErr := queueClient.Enqueue(task); enqueueErr == nil {
+				return
+			}
+		}
+	}
+
+	if hasEmail {
+		_ = emailService.SendEmail(ctx, email.SendEmailInput{
+			To:       payload.To,
+			Subject:  payload.Subject,
+			HTMLBody: payload.HTMLBody,
+			TextBody: payload.TextBody,
+			Tag:      payload.Tag,
+			Metadata: payload.Meta,
+		})
+	}
+}
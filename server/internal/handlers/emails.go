@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"bafachat/internal/queue"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deliverTemplateEmail queues a Postmark template email, sending it directly
+// when the queue is unavailable or rejects the task.
+func deliverTemplateEmail(c *gin.Context, payload queue.TemplateEmailTaskPayload) {
+	if queueClient, ok := getQueueClient(c); ok {
+		task, err := queue.NewTemplateEmailTask(payload)
+		if err == nil {
+			if _, err = queueClient.Enqueue(task); err == nil {
+				return
+			}
+		}
+		requestLogger(c).Warn("failed to queue template email, sending directly", "template", payload.TemplateAlias, "error", err)
+	}
+
+	emailService, ok := getEmailService(c)
+	if !ok {
+		return
+	}
+
+	if err := emailService.SendTemplateEmail(c.Request.Context(), payload.SendInput()); err != nil {
+		requestLogger(c).Error("failed to send template email", "template", payload.TemplateAlias, "tag", payload.Tag, "error", err)
+	}
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	_ "golang.org/x/image/webp"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// defaultServerEmojiLimit and defaultEmojiMaxBytes apply when SERVER_EMOJI_LIMIT
+	// or EMOJI_MAX_BYTES is unset.
+	defaultServerEmojiLimit = 50
+	defaultEmojiMaxBytes    = 256 * 1024
+
+	// maxEmojiDimension is the largest width and height an emoji image may have.
+	maxEmojiDimension = 128
+)
+
+var (
+	errEmojiNotFound      = errors.New("emoji not found")
+	errEmojiNameTaken     = errors.New("an emoji with this name already exists in this server")
+	errEmojiLimitReached  = errors.New("this server has reached its custom emoji limit")
+	errEmojiImageNotValid = errors.New("emoji must be a square image")
+)
+
+// emojiNamePattern matches the names accepted for custom emoji.
+var emojiNamePattern = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
+// emojiReferencePattern matches :name: tokens in message content.
+var emojiReferencePattern = regexp.MustCompile(`:([A-Za-z0-9_]{2,32}):`)
+
+// emojiPolicy captures deployment-wide limits on custom emoji.
+type emojiPolicy struct {
+	// MaxPerServer caps how many custom emoji a server may have.
+	MaxPerServer int
+	// MaxBytes caps the size of an uploaded emoji image.
+	MaxBytes int64
+}
+
+// emojiPolicyFromEnv reads SERVER_EMOJI_LIMIT and EMOJI_MAX_BYTES.
+func emojiPolicyFromEnv() emojiPolicy {
+	policy := emojiPolicy{
+		MaxPerServer: defaultServerEmojiLimit,
+		MaxBytes:     defaultEmojiMaxBytes,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("SERVER_EMOJI_LIMIT")); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value >= 0 {
+			policy.MaxPerServer = value
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("EMOJI_MAX_BYTES")); raw != "" {
+		if value, err := strconv.ParseInt(raw, 10, 64); err == nil && value > 0 {
+			policy.MaxBytes = value
+		}
+	}
+
+	return policy
+}
+
+// GetServerEmojis lists a server's custom emoji.
+func GetServerEmojis(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var emojis []models.CustomEmoji
+	if err := caller.DB.Where("server_id = ?", serverID).Order("name ASC").Find(&emojis).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load emojis")
+		return
+	}
+
+	payload := make([]gin.H, 0, len(emojis))
+	for _, emoji := range emojis {
+		payload = append(payload, serializeCustomEmoji(emoji))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"emojis": payload,
+			"limit":  emojiPolicyFromEnv().MaxPerServer,
+		},
+	})
+}
+
+// CreateServerEmoji uploads a custom emoji from a multipart form with "name" and "file"
+// fields. The image must be a square PNG, JPEG, GIF or WebP no larger than
+// maxEmojiDimension pixels. Owners and admins may manage emoji.
+func CreateServerEmoji(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageEmojis, "you do not have permission to manage emojis"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	storageService, ok := getStorageService(c)
+	if !ok {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUploadsDisabled, "file uploads are not configured")
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(c.PostForm("name")))
+	if !emojiNamePattern.MatchString(name) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidEmojiName, "emoji name must be 2-32 letters, numbers or underscores")
+		return
+	}
+
+	policy := emojiPolicyFromEnv()
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeFileRequired, "file is required")
+		return
+	}
+
+	if fileHeader.Size <= 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidFile, "file must be greater than 0 bytes")
+		return
+	}
+
+	if fileHeader.Size > policy.MaxBytes {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidEmojiImage,
+			fmt.Sprintf("emoji images must be at most %d bytes", policy.MaxBytes),
+			gin.H{"max_bytes": policy.MaxBytes})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
+		return
+	}
+	defer file.Close()
+
+	buf, err := io.ReadAll(io.LimitReader(file, policy.MaxBytes+1))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read file")
+		return
+	}
+
+	if int64(len(buf)) > policy.MaxBytes {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidEmojiImage,
+			fmt.Sprintf("emoji images must be at most %d bytes", policy.MaxBytes),
+			gin.H{"max_bytes": policy.MaxBytes})
+		return
+	}
+
+	// Trust the bytes rather than the client's Content-Type header.
+	contentType := http.DetectContentType(buf)
+	if contentType != "image/png" && contentType != "image/jpeg" && contentType != "image/gif" && contentType != "image/webp" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidImageType, "invalid image type, must be png, jpeg, gif, or webp")
+		return
+	}
+
+	if err := validateEmojiImage(buf); err != nil {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeInvalidEmojiImage, err.Error(),
+			gin.H{"max_dimension": maxEmojiDimension})
+		return
+	}
+
+	var count int64
+	if err := caller.DB.Model(&models.CustomEmoji{}).Where("server_id = ?", serverID).Count(&count).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to count emojis")
+		return
+	}
+	if count >= int64(policy.MaxPerServer) {
+		respondEmojiLimitReached(c, policy)
+		return
+	}
+
+	uploaded, err := storageService.UploadEmojiObject(c.Request.Context(), serverID, fileHeader.Filename, contentType, int64(len(buf)), bytes.NewReader(buf))
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to upload emoji")
+		return
+	}
+
+	emoji := models.CustomEmoji{
+		ServerID:    serverID,
+		Name:        name,
+		ObjectKey:   uploaded.ObjectKey,
+		ImageURL:    uploaded.FileURL,
+		ContentType: contentType,
+		Animated:    contentType == "image/gif" && isAnimatedGIF(buf),
+		CreatedBy:   caller.Claims.UserID,
+	}
+
+	// The server row lock serializes concurrent uploads so the limit and name checks hold.
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		var server models.Server
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&server, serverID).Error; err != nil {
+			return err
+		}
+
+		var existing int64
+		if err := tx.Model(&models.CustomEmoji{}).Where("server_id = ?", serverID).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing >= int64(policy.MaxPerServer) {
+			return errEmojiLimitReached
+		}
+
+		var taken int64
+		if err := tx.Model(&models.CustomEmoji{}).Where("server_id = ? AND name = ?", serverID, name).Count(&taken).Error; err != nil {
+			return err
+		}
+		if taken > 0 {
+			return errEmojiNameTaken
+		}
+
+		return tx.Create(&emoji).Error
+	}); err != nil {
+		if deleteErr := storageService.DeleteObject(c.Request.Context(), uploaded.ObjectKey); deleteErr != nil {
+			requestLogger(c).Warn("failed to delete unused emoji object", "key", uploaded.ObjectKey, "error", deleteErr)
+		}
+
+		switch {
+		case errors.Is(err, errEmojiLimitReached):
+			respondEmojiLimitReached(c, policy)
+		case errors.Is(err, errEmojiNameTaken):
+			respondError(c, http.StatusConflict, err)
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create emoji")
+		}
+		return
+	}
+
+	serialized := serializeCustomEmoji(emoji)
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventEmojiCreated, gin.H{
+			"emoji":     serialized,
+			"server_id": serverID,
+		}))
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Emoji created",
+		"data": gin.H{
+			"emoji": serialized,
+		},
+	})
+}
+
+// DeleteServerEmoji removes a custom emoji and its image. Messages that used it keep
+// their :name: text.
+func DeleteServerEmoji(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageEmojis, "you do not have permission to manage emojis"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	emojiIDValue, err := strconv.ParseUint(c.Param("emojiID"), 10, 64)
+	if err != nil || emojiIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid emoji id")
+		return
+	}
+
+	var emoji models.CustomEmoji
+	if err := caller.DB.Where("id = ? AND server_id = ?", emojiIDValue, serverID).First(&emoji).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, errEmojiNotFound)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load emoji")
+		return
+	}
+
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("emoji_id = ?", emoji.ID).Delete(&models.MessageEmoji{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&emoji).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete emoji")
+		return
+	}
+
+	if storageService, ok := getStorageService(c); ok {
+		if err := storageService.DeleteObject(c.Request.Context(), emoji.ObjectKey); err != nil {
+			requestLogger(c).Warn("failed to delete emoji object", "key", emoji.ObjectKey, "error", err)
+		}
+	}
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventEmojiDeleted, gin.H{
+			"emoji_id":  emoji.ID,
+			"name":      emoji.Name,
+			"server_id": serverID,
+		}))
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// validateEmojiImage checks that the image decodes and is a small square.
+func validateEmojiImage(data []byte) error {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%w: unable to read image", errEmojiImageNotValid)
+	}
+
+	if config.Width != config.Height {
+		return fmt.Errorf("%w: got %dx%d", errEmojiImageNotValid, config.Width, config.Height)
+	}
+
+	if config.Width > maxEmojiDimension {
+		return fmt.Errorf("%w of at most %dx%d pixels", errEmojiImageNotValid, maxEmojiDimension, maxEmojiDimension)
+	}
+
+	return nil
+}
+
+// isAnimatedGIF reports whether a GIF has more than one frame.
+func isAnimatedGIF(data []byte) bool {
+	decoded, err := gif.DecodeAll(bytes.NewReader(data))
+	return err == nil && len(decoded.Image) > 1
+}
+
+func respondEmojiLimitReached(c *gin.Context, policy emojiPolicy) {
+	apierror.RespondWithDetails(c, http.StatusConflict, apierror.CodeEmojiLimitReached, errEmojiLimitReached.Error(),
+		gin.H{"limit": policy.MaxPerServer})
+}
+
+// parseEmojiNames extracts the distinct, lower-cased custom emoji names referenced in content.
+func parseEmojiNames(content string) []string {
+	matches := emojiReferencePattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(matches))
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		name := strings.ToLower(match[1])
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// createMessageEmojis stores a row for each of the server's custom emoji referenced in
+// the message, so clients can render :name: tokens as images. Unknown names are left as text.
+func createMessageEmojis(tx *gorm.DB, message models.Message, serverID uint) error {
+	names := parseEmojiNames(message.Content)
+	if len(names) == 0 {
+		return nil
+	}
+
+	var emojiIDs []uint
+	if err := tx.Model(&models.CustomEmoji{}).
+		Where("server_id = ? AND name IN ?", serverID, names).
+		Pluck("id", &emojiIDs).Error; err != nil {
+		return err
+	}
+
+	if len(emojiIDs) == 0 {
+		return nil
+	}
+
+	rows := make([]models.MessageEmoji, 0, len(emojiIDs))
+	for _, emojiID := range emojiIDs {
+		rows = append(rows, models.MessageEmoji{
+			MessageID: message.ID,
+			EmojiID:   emojiID,
+		})
+	}
+
+	return tx.Create(&rows).Error
+}
+
+func serializeMessageEmojis(emojis []models.MessageEmoji) []gin.H {
+	payload := make([]gin.H, 0, len(emojis))
+	for _, emoji := range emojis {
+		payload = append(payload, gin.H{
+			"id":        emoji.Emoji.ID,
+			"name":      emoji.Emoji.Name,
+			"image_url": emoji.Emoji.ImageURL,
+			"animated":  emoji.Emoji.Animated,
+		})
+	}
+
+	return payload
+}
+
+func serializeCustomEmoji(emoji models.CustomEmoji) gin.H {
+	return gin.H{
+		"id":           emoji.ID,
+		"server_id":    emoji.ServerID,
+		"name":         emoji.Name,
+		"image_url":    emoji.ImageURL,
+		"content_type": emoji.ContentType,
+		"animated":     emoji.Animated,
+		"created_by":   emoji.CreatedBy,
+		"created_at":   emoji.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/models"
+	"bafachat/internal/storage"
+	"bafachat/internal/websocket"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultMaxMessageTTLSeconds caps message lifetimes at a week when
+	// MESSAGE_TTL_MAX_SECONDS is unset.
+	defaultMaxMessageTTLSeconds = 7 * 24 * 60 * 60
+
+	// expiredMessageBatchSize bounds how many expired messages one sweep pass deletes.
+	expiredMessageBatchSize = 200
+)
+
+var errInvalidMessageTTL = errors.New("invalid message ttl")
+
+// maxMessageTTLFromEnv reads MESSAGE_TTL_MAX_SECONDS, the longest lifetime a
+// message or channel may request.
+func maxMessageTTLFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("MESSAGE_TTL_MAX_SECONDS"))
+	if raw == "" {
+		return defaultMaxMessageTTLSeconds
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		return defaultMaxMessageTTLSeconds
+	}
+
+	return value
+}
+
+// validateMessageTTL checks a requested lifetime in seconds against the deployment maximum.
+func validateMessageTTL(seconds int) error {
+	maxTTL := maxMessageTTLFromEnv()
+	if seconds <= 0 || seconds > maxTTL {
+		return fmt.Errorf("%w: must be between 1 and %d seconds", errInvalidMessageTTL, maxTTL)
+	}
+
+	return nil
+}
+
+// messageExpiry returns when a new message in the channel should disappear. A
+// per-message TTL can shorten the channel's TTL but never outlive it; nil means
+// the message is kept.
+func messageExpiry(channel models.Channel, requestedSeconds *int, now time.Time) *time.Time {
+	ttl := channel.MessageTTLSeconds
+	if requestedSeconds != nil && (ttl <= 0 || *requestedSeconds < ttl) {
+		ttl = *requestedSeconds
+	}
+
+	if ttl <= 0 {
+		return nil
+	}
+
+	expiresAt := now.Add(time.Duration(ttl) * time.Second)
+	return &expiresAt
+}
+
+// unexpiredMessages hides messages whose lifetime has passed but that the
+// sweeper has not deleted yet.
+func unexpiredMessages(tx *gorm.DB) *gorm.DB {
+	return tx.Where("messages.expires_at IS NULL OR messages.expires_at > ?", time.Now())
+}
+
+// SweepExpiredMessages deletes messages past their expiry along with their mentions,
+// emoji references, link previews, attachments and attachment objects, then publishes
+// message.deleted for each. It returns how many messages were removed.
+func SweepExpiredMessages(ctx context.Context, db *gorm.DB, storageService *storage.Service, hub *websocket.Hub) (int, error) {
+	deleted := 0
+
+	for {
+		var messages []models.Message
+		if err := db.WithContext(ctx).
+			Preload("Attachments").
+			Preload("Channel").
+			Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).
+			Order("expires_at ASC").
+			Limit(expiredMessageBatchSize).
+			Find(&messages).Error; err != nil {
+			return deleted, fmt.Errorf("load expired messages: %w", err)
+		}
+
+		if len(messages) == 0 {
+			return deleted, nil
+		}
+
+		messageIDs := make([]uint, 0, len(messages))
+		objectKeys := make([]string, 0)
+		for _, message := range messages {
+			messageIDs = append(messageIDs, message.ID)
+			for _, attachment := range message.Attachments {
+				objectKeys = append(objectKeys, attachment.ObjectKey)
+				if attachment.PreviewObjectKey != "" {
+					objectKeys = append(objectKeys, attachment.PreviewObjectKey)
+				}
+			}
+		}
+
+		if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return deleteMessagesWhere(tx, "id IN ?", messageIDs)
+		}); err != nil {
+			return deleted, fmt.Errorf("delete expired messages: %w", err)
+		}
+
+		deleted += len(messages)
+
+		objectKeys, err := unreferencedObjectKeys(db.WithContext(ctx), objectKeys)
+		if err != nil {
+			slog.Warn("failed to check expired attachment object references", "error", err)
+			objectKeys = nil
+		}
+
+		if storageService != nil && len(objectKeys) > 0 {
+			if err := storageService.DeleteObjects(ctx, objectKeys); err != nil {
+				slog.Warn("failed to delete expired attachment objects", "count", len(objectKeys), "error", err)
+			}
+		}
+
+		if hub != nil {
+			for _, message := range messages {
+				_ = publishChannelEvent(hub, db.WithContext(ctx), message.Channel, websocket.MessageDeleted(message.ID, message.ChannelID, message.Channel.ServerID, "expired"))
+			}
+		}
+
+		if len(messages) < expiredMessageBatchSize {
+			return deleted, nil
+		}
+	}
+}
+
+// deleteMessagesWhere deletes the messages matching the condition together with
+// their mentions, emoji references, link previews and attachment rows, and
+// releases the storage the attachments used. Attachment objects in storage are
+// left for the caller to remove.
+func deleteMessagesWhere(tx *gorm.DB, condition string, args ...interface{}) error {
+	objects, err := messageStoredObjects(tx, condition, args...)
+	if err != nil {
+		return err
+	}
+
+	dependents := []interface{}{
+		&models.MessageMention{},
+		&models.MessageEmoji{},
+		&models.LinkPreview{},
+		&models.MessageAttachment{},
+	}
+
+	for _, model := range dependents {
+		matching := tx.Model(&models.Message{}).Select("id").Where(condition, args...)
+		if err := tx.Where("message_id IN (?)", matching).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Where(condition, args...).Delete(&models.Message{}).Error; err != nil {
+		return err
+	}
+
+	return releaseServerStorageUsage(tx, objects)
+}
+
+// messageObjectKeys returns the storage keys of the attachments and previews of
+// the messages matching the condition.
+func messageObjectKeys(tx *gorm.DB, condition string, args ...interface{}) ([]string, error) {
+	var attachments []models.MessageAttachment
+	matching := tx.Model(&models.Message{}).Select("id").Where(condition, args...)
+	if err := tx.Select("object_key", "preview_object_key").
+		Where("message_id IN (?)", matching).
+		Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		keys = append(keys, attachment.ObjectKey)
+		if attachment.PreviewObjectKey != "" {
+			keys = append(keys, attachment.PreviewObjectKey)
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"bafachat/internal/models"
+)
+
+func TestMessageExpiry(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+	seconds := func(value int) *int { return &value }
+
+	tests := []struct {
+		name       string
+		channelTTL int
+		requested  *int
+		want       time.Duration
+		wantNil    bool
+	}{
+		{name: "kept forever", wantNil: true},
+		{name: "channel ttl", channelTTL: 3600, want: time.Hour},
+		{name: "message ttl without channel ttl", requested: seconds(60), want: time.Minute},
+		{name: "message ttl shortens channel ttl", channelTTL: 3600, requested: seconds(60), want: time.Minute},
+		{name: "message ttl cannot outlive channel", channelTTL: 60, requested: seconds(3600), want: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := messageExpiry(models.Channel{MessageTTLSeconds: tt.channelTTL}, tt.requested, now)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("messageExpiry = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(now.Add(tt.want)) {
+				t.Fatalf("messageExpiry = %v, want %v", got, now.Add(tt.want))
+			}
+		})
+	}
+}
+
+func TestValidateMessageTTL(t *testing.T) {
+	t.Setenv("MESSAGE_TTL_MAX_SECONDS", "3600")
+
+	tests := []struct {
+		seconds int
+		wantErr bool
+	}{
+		{seconds: 1},
+		{seconds: 3600},
+		{seconds: 0, wantErr: true},
+		{seconds: -5, wantErr: true},
+		{seconds: 3601, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		err := validateMessageTTL(tt.seconds)
+		if tt.wantErr != (err != nil) {
+			t.Fatalf("validateMessageTTL(%d) = %v, wantErr %v", tt.seconds, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, errInvalidMessageTTL) {
+			t.Fatalf("validateMessageTTL(%d) = %v, want errInvalidMessageTTL", tt.seconds, err)
+		}
+	}
+}
+
+func TestMaxMessageTTLFromEnv(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{raw: "", want: defaultMaxMessageTTLSeconds},
+		{raw: " 120 ", want: 120},
+		{raw: "0", want: defaultMaxMessageTTLSeconds},
+		{raw: "forever", want: defaultMaxMessageTTLSeconds},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("MESSAGE_TTL_MAX_SECONDS", tt.raw)
+		if got := maxMessageTTLFromEnv(); got != tt.want {
+			t.Fatalf("maxMessageTTLFromEnv(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+
+	"bafachat/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// pgUniqueViolation is the Postgres SQLSTATE for a unique constraint violation.
+const pgUniqueViolation = "23505"
+
+// sentinelErrorCodes maps the handlers' sentinel errors to their stable API codes.
+var sentinelErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{errInviteNotFound, apierror.CodeInviteNotFound},
+	{errInviteExpired, apierror.CodeInviteExpired},
+	{errInviteRevoked, apierror.CodeInviteRevoked},
+	{errInviteMaxed, apierror.CodeInviteMaxed},
+	{errServerBanned, apierror.CodeBanned},
+	{errServerBanExists, apierror.CodeBanExists},
+	{errServerBanMissing, apierror.CodeBanNotFound},
+	{errServerMembershipRequired, apierror.CodeNotServerMember},
+	{errServerOwnerRequired, apierror.CodeOwnerRequired},
+	{errServerPermissionRequired, apierror.CodePermissionDenied},
+	{errChannelAccessRequired, apierror.CodeChannelAccessRequired},
+	{errNSFWAcknowledgmentRequired, apierror.CodeNSFWAcknowledgmentRequired},
+	{errChannelArchived, apierror.CodeChannelArchived},
+	{errMessageBlocked, apierror.CodeMessageBlocked},
+	{errChannelCategoryNotFound, apierror.CodeCategoryNotFound},
+	{errEmojiNotFound, apierror.CodeEmojiNotFound},
+	{errInvalidMessageTTL, apierror.CodeInvalidMessageTTL},
+	{errAttachmentNotUploaded, apierror.CodeInvalidAttachment},
+	{errAttachmentMismatch, apierror.CodeInvalidAttachment},
+	{errAttachmentAltTooLong, apierror.CodeInvalidAttachment},
+	{errEmojiNameTaken, apierror.CodeEmojiNameTaken},
+	{errEmojiLimitReached, apierror.CodeEmojiLimitReached},
+	{errJoinGateRulesMissing, apierror.CodeRulesRequired},
+	{errMemberNotPending, apierror.CodeMemberNotPending},
+	{errEmailInUse, apierror.CodeEmailInUse},
+	{errUserConflict, apierror.CodeUserConflict},
+	{errUsernameReserved, apierror.CodeUsernameReserved},
+	{errInvalidTwoFactorCode, apierror.CodeInvalidTwoFactorCode},
+	{errInvalidTwoFactorChallenge, apierror.CodeInvalidTwoFactorToken},
+}
+
+// respondError writes err's message with the code registered for it in
+// sentinelErrorCodes, or the generic code for the status when it has none, as
+// is the case for request binding and validation errors.
+func respondError(c *gin.Context, status int, err error) {
+	code := apierror.CodeForStatus(status)
+	for _, sentinel := range sentinelErrorCodes {
+		if errors.Is(err, sentinel.err) {
+			code = sentinel.code
+			break
+		}
+	}
+
+	apierror.Respond(c, status, code, err.Error())
+}
+
+// isUniqueViolation reports whether err came from a unique constraint. Without
+// gorm's TranslateError option, Postgres reports these as a pgconn.PgError rather
+// than gorm.ErrDuplicatedKey, so both are checked.
+func isUniqueViolation(err error) bool {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
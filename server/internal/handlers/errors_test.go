@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"bafachat/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		status   int
+		err      error
+		wantCode string
+	}{
+		{name: "sentinel", status: http.StatusGone, err: errInviteExpired, wantCode: apierror.CodeInviteExpired},
+		{name: "wrapped sentinel", status: http.StatusBadRequest, err: fmt.Errorf("attachments[2]: %w", errAttachmentMismatch), wantCode: apierror.CodeInvalidAttachment},
+		{name: "unregistered error", status: http.StatusBadRequest, err: errors.New("name is required"), wantCode: apierror.CodeInvalidRequest},
+		{name: "unregistered error uses the status code", status: http.StatusConflict, err: errors.New("already exists"), wantCode: apierror.CodeConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			respondError(c, tt.status, tt.err)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body struct {
+				Error struct {
+					Code    string `json:"code"`
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Message != tt.err.Error() {
+				t.Fatalf("error = %+v, want code %q and message %q", body.Error, tt.wantCode, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestSentinelErrorCodesAreUnique(t *testing.T) {
+	seen := map[error]bool{}
+	for _, sentinel := range sentinelErrorCodes {
+		if seen[sentinel.err] {
+			t.Errorf("%q is registered twice", sentinel.err)
+		}
+		seen[sentinel.err] = true
+		if sentinel.code == "" {
+			t.Errorf("%q has no code", sentinel.err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"bafachat/internal/auth"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeResult is what a fakeDB returns for one statement: rows for queries, or
+// the number of rows affected for other statements.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	affected int64
+}
+
+// fakeQueryFunc answers a statement sent to a fakeDB. Arguments are in
+// placeholder order.
+type fakeQueryFunc func(query string, args []driver.Value) (fakeResult, error)
+
+// fakeDB is a database/sql connection that answers statements with a
+// fakeQueryFunc, so handlers can be tested without Postgres. It records every
+// statement it is sent.
+type fakeDB struct {
+	mu         sync.Mutex
+	answer     fakeQueryFunc
+	statements []string
+}
+
+// openFakeDB returns a gorm Postgres handle whose connection is backed by answer.
+func openFakeDB(t *testing.T, answer fakeQueryFunc) (*gorm.DB, *fakeDB) {
+	t.Helper()
+
+	fake := &fakeDB{answer: answer}
+	sqlDB := sql.OpenDB(fakeConnector{db: fake})
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	return db, fake
+}
+
+// ranStatement reports whether a statement starting with prefix was sent.
+func (f *fakeDB) ranStatement(prefix string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.ContainsFunc(f.statements, func(statement string) bool {
+		return strings.HasPrefix(statement, prefix)
+	})
+}
+
+func (f *fakeDB) run(query string, named []driver.NamedValue) (fakeResult, error) {
+	args := make([]driver.Value, len(named))
+	for i, arg := range named {
+		args[i] = arg.Value
+	}
+
+	f.mu.Lock()
+	f.statements = append(f.statements, query)
+	answer := f.answer
+	f.mu.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "SAVEPOINT"), strings.HasPrefix(query, "ROLLBACK TO SAVEPOINT"), strings.HasPrefix(query, "RELEASE SAVEPOINT"):
+		return fakeResult{}, nil
+	}
+	return answer(query, args)
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return fakeConn{db: c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("use fakeConnector")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(result.affected), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	result, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: result.columns, rows: result.rows}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// newHandlerContext returns a test context for a request by userID, with db as
+// the request's database.
+func newHandlerContext(db *gorm.DB, userID uint, method, target, body string, params gin.Params) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = params
+	c.Set("db", db)
+	c.Set("userClaims", &auth.Claims{UserID: userID})
+
+	return c, w
+}
+
+// responseCode returns the error code of an apierror response, or "".
+func responseCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if w.Code < http.StatusBadRequest {
+		return ""
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	return body.Error.Code
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// healthProbeTimeout bounds each dependency check so a hung dependency fails the probe quickly.
+	healthProbeTimeout = 2 * time.Second
+
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+	healthStatusDisabled    = "disabled"
+)
+
+// HealthLive reports that the process is up and serving requests. It does not touch
+// any dependency, so orchestrators only restart the instance when it is truly stuck.
+func HealthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "healthy",
+		"service": "bafachat-server",
+	})
+}
+
+// HealthReady checks the database, Redis and object storage and returns 503 when any
+// configured dependency is unavailable, so traffic is routed away from the instance.
+// Redis and storage are reported as disabled when the instance started without them.
+func HealthReady(c *gin.Context) {
+	checks := gin.H{
+		"database": probeDatabase(c),
+		"redis":    probeRedis(c),
+		"storage":  probeStorage(c),
+	}
+
+	status := http.StatusOK
+	overall := "ready"
+	for _, result := range checks {
+		if result == healthStatusUnavailable {
+			status = http.StatusServiceUnavailable
+			overall = "unavailable"
+		}
+	}
+
+	c.JSON(status, gin.H{
+		"status":       overall,
+		"service":      "bafachat-server",
+		"dependencies": checks,
+	})
+}
+
+func probeDatabase(c *gin.Context) string {
+	db, ok := getDB(c)
+	if !ok {
+		return healthStatusUnavailable
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return healthStatusUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthProbeTimeout)
+	defer cancel()
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return healthStatusUnavailable
+	}
+
+	return healthStatusOK
+}
+
+func probeRedis(c *gin.Context) string {
+	client, ok := getRedisClient(c)
+	if !ok {
+		return healthStatusDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthProbeTimeout)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		return healthStatusUnavailable
+	}
+
+	return healthStatusOK
+}
+
+func probeStorage(c *gin.Context) string {
+	storageService, ok := getStorageService(c)
+	if !ok {
+		return healthStatusDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), healthProbeTimeout)
+	defer cancel()
+
+	if err := storageService.Ping(ctx); err != nil {
+		return healthStatusUnavailable
+	}
+
+	return healthStatusOK
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
-	"log"
+	"log/slog"
 
 	"bafachat/internal/auth"
 	"bafachat/internal/email"
+	"bafachat/internal/logging"
 	"bafachat/internal/models"
+	"bafachat/internal/push"
 	"bafachat/internal/storage"
+	"bafachat/internal/unfurl"
 	"bafachat/internal/webrtc"
 	"bafachat/internal/websocket"
 
@@ -15,16 +18,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// requestLogger returns the structured logger tagged with the request's ID.
+func requestLogger(c *gin.Context) *slog.Logger {
+	return logging.FromContext(c.Request.Context())
+}
+
 func getDB(c *gin.Context) (*gorm.DB, bool) {
 	value, exists := c.Get("db")
 	if !exists {
-		log.Println("database connection not found in context")
+		requestLogger(c).Error("database connection not found in context")
 		return nil, false
 	}
 
 	db, ok := value.(*gorm.DB)
 	if !ok {
-		log.Println("invalid database connection type")
+		requestLogger(c).Error("invalid database connection type")
 		return nil, false
 	}
 
@@ -39,7 +47,7 @@ func getEmailService(c *gin.Context) (*email.Service, bool) {
 
 	svc, ok := value.(*email.Service)
 	if !ok {
-		log.Println("invalid email service type")
+		requestLogger(c).Error("invalid email service type")
 		return nil, false
 	}
 
@@ -54,13 +62,28 @@ func getQueueClient(c *gin.Context) (*asynq.Client, bool) {
 
 	client, ok := value.(*asynq.Client)
 	if !ok {
-		log.Println("invalid queue client type")
+		requestLogger(c).Error("invalid queue client type")
 		return nil, false
 	}
 
 	return client, true
 }
 
+func getQueueInspector(c *gin.Context) (*asynq.Inspector, bool) {
+	value, exists := c.Get("queueInspector")
+	if !exists {
+		return nil, false
+	}
+
+	inspector, ok := value.(*asynq.Inspector)
+	if !ok {
+		requestLogger(c).Error("invalid queue inspector type")
+		return nil, false
+	}
+
+	return inspector, true
+}
+
 func getWebSocketHub(c *gin.Context) (*websocket.Hub, bool) {
 	value, exists := c.Get("wsHub")
 	if !exists {
@@ -69,13 +92,43 @@ func getWebSocketHub(c *gin.Context) (*websocket.Hub, bool) {
 
 	hub, ok := value.(*websocket.Hub)
 	if !ok {
-		log.Println("invalid websocket hub type")
+		requestLogger(c).Error("invalid websocket hub type")
 		return nil, false
 	}
 
 	return hub, true
 }
 
+func getPushDispatcher(c *gin.Context) (*push.Dispatcher, bool) {
+	value, exists := c.Get("pushDispatcher")
+	if !exists {
+		return nil, false
+	}
+
+	dispatcher, ok := value.(*push.Dispatcher)
+	if !ok {
+		requestLogger(c).Error("invalid push dispatcher type")
+		return nil, false
+	}
+
+	return dispatcher, dispatcher.Enabled()
+}
+
+func getLinkPreviewFetcher(c *gin.Context) (*unfurl.Fetcher, bool) {
+	value, exists := c.Get("linkPreviewFetcher")
+	if !exists {
+		return nil, false
+	}
+
+	fetcher, ok := value.(*unfurl.Fetcher)
+	if !ok {
+		requestLogger(c).Error("invalid link preview fetcher type")
+		return nil, false
+	}
+
+	return fetcher, fetcher != nil
+}
+
 func getStorageService(c *gin.Context) (*storage.Service, bool) {
 	value, exists := c.Get("storage")
 	if !exists {
@@ -84,7 +137,7 @@ func getStorageService(c *gin.Context) (*storage.Service, bool) {
 
 	service, ok := value.(*storage.Service)
 	if !ok {
-		log.Println("invalid storage service type")
+		requestLogger(c).Error("invalid storage service type")
 		return nil, false
 	}
 
@@ -99,7 +152,7 @@ func getWebRTCManager(c *gin.Context) (*webrtc.Manager, bool) {
 
 	manager, ok := value.(*webrtc.Manager)
 	if !ok {
-		log.Println("invalid webrtc manager type")
+		requestLogger(c).Error("invalid webrtc manager type")
 		return nil, false
 	}
 
@@ -114,7 +167,7 @@ func getWebRTCConfig(c *gin.Context) (webrtc.Config, bool) {
 
 	config, ok := value.(webrtc.Config)
 	if !ok {
-		log.Println("invalid webrtc config type")
+		requestLogger(c).Error("invalid webrtc config type")
 		return webrtc.Config{}, false
 	}
 
@@ -129,7 +182,7 @@ func getUserClaims(c *gin.Context) (*auth.Claims, bool) {
 
 	claims, ok := value.(*auth.Claims)
 	if !ok {
-		log.Println("invalid user claims type")
+		requestLogger(c).Error("invalid user claims type")
 		return nil, false
 	}
 
@@ -149,7 +202,7 @@ func getCurrentUserRecord(c *gin.Context) (*models.User, bool) {
 
 	var user models.User
 	if err := db.WithContext(c).First(&user, claims.UserID).Error; err != nil {
-		log.Printf("failed to load current user: %v", err)
+		requestLogger(c).Error("failed to load current user", "user_id", claims.UserID, "error", err)
 		return nil, false
 	}
 
@@ -2,13 +2,18 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
@@ -20,17 +25,126 @@ var (
 	errInviteMaxed       = errors.New("invite has reached its maximum uses")
 )
 
+// defaultCappedInviteUses is applied to invites created without an explicit
+// limit when the deployment forbids unlimited invites but sets no cap.
+const defaultCappedInviteUses = 100
+
+// Pixel sizes for invite QR codes.
+const (
+	defaultInviteQRSize = 256
+	minInviteQRSize     = 128
+	maxInviteQRSize     = 1024
+)
+
+// Invite code alphabets. URL codes are base64url; readable codes use
+// readableInviteCodeChars and suit invites that are read out or typed.
+const (
+	inviteCodeAlphabetURL      = "url"
+	inviteCodeAlphabetReadable = "readable"
+)
+
+const (
+	defaultInviteCodeLength = 16
+	// maxInviteCodeLength matches the size of the invite code column.
+	maxInviteCodeLength = 64
+	// minInviteCodeBits keeps codes hard to guess and collisions rare whatever
+	// length is configured.
+	minInviteCodeBits = 64
+)
+
+// invitePolicy captures deployment-wide limits on invite usage.
+type invitePolicy struct {
+	// MaxUses is the largest max_uses value an invite may carry; 0 means no cap.
+	MaxUses int
+	// AllowUnlimited permits invites with max_uses of 0.
+	AllowUnlimited bool
+	// CodeLength is the number of characters in a new invite code.
+	CodeLength int
+	// CodeAlphabet is inviteCodeAlphabetURL or inviteCodeAlphabetReadable.
+	CodeAlphabet string
+}
+
+// invitePolicyFromEnv reads INVITE_MAX_USES, INVITE_ALLOW_UNLIMITED,
+// INVITE_CODE_LENGTH and INVITE_CODE_ALPHABET. Code lengths are raised to carry
+// at least minInviteCodeBits of randomness and capped at maxInviteCodeLength.
+func invitePolicyFromEnv() invitePolicy {
+	policy := invitePolicy{
+		AllowUnlimited: true,
+		CodeLength:     defaultInviteCodeLength,
+		CodeAlphabet:   inviteCodeAlphabetURL,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("INVITE_MAX_USES")); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			policy.MaxUses = value
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("INVITE_ALLOW_UNLIMITED")); raw != "" {
+		if value, err := strconv.ParseBool(raw); err == nil {
+			policy.AllowUnlimited = value
+		}
+	}
+
+	if raw := strings.ToLower(strings.TrimSpace(os.Getenv("INVITE_CODE_ALPHABET"))); raw == inviteCodeAlphabetReadable {
+		policy.CodeAlphabet = inviteCodeAlphabetReadable
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("INVITE_CODE_LENGTH")); raw != "" {
+		if value, err := strconv.Atoi(raw); err == nil && value > 0 {
+			policy.CodeLength = value
+		}
+	}
+
+	bitsPerChar := 6
+	if policy.CodeAlphabet == inviteCodeAlphabetReadable {
+		bitsPerChar = 5
+	}
+	if minLength := (minInviteCodeBits + bitsPerChar - 1) / bitsPerChar; policy.CodeLength < minLength {
+		policy.CodeLength = minLength
+	}
+	if policy.CodeLength > maxInviteCodeLength {
+		policy.CodeLength = maxInviteCodeLength
+	}
+
+	return policy
+}
+
+// defaultMaxUses returns the max_uses value for invites created without one.
+func (p invitePolicy) defaultMaxUses() int {
+	if p.AllowUnlimited {
+		return 0
+	}
+	if p.MaxUses > 0 {
+		return p.MaxUses
+	}
+	return defaultCappedInviteUses
+}
+
+// validateMaxUses checks a requested max_uses value against the policy.
+func (p invitePolicy) validateMaxUses(maxUses int) error {
+	if maxUses == 0 && !p.AllowUnlimited {
+		return errors.New("unlimited invites are not allowed; max_uses must be at least 1")
+	}
+
+	if p.MaxUses > 0 && maxUses > p.MaxUses {
+		return fmt.Errorf("max_uses cannot exceed %d", p.MaxUses)
+	}
+
+	return nil
+}
+
 // GetInvite returns information about an invite code.
 func GetInvite(c *gin.Context) {
 	code := strings.TrimSpace(c.Param("code"))
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invite code is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInviteCodeRequired, "invite code is required")
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
@@ -41,10 +155,10 @@ func GetInvite(c *gin.Context) {
 		Where("code = ?", code).
 		First(&invite).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": errInviteNotFound.Error()})
+			respondError(c, http.StatusNotFound, errInviteNotFound)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load invite"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load invite")
 		return
 	}
 
@@ -57,7 +171,7 @@ func GetInvite(c *gin.Context) {
 			status = http.StatusForbidden
 		}
 
-		c.JSON(status, gin.H{"error": err.Error()})
+		respondError(c, status, err)
 		return
 	}
 
@@ -69,27 +183,91 @@ func GetInvite(c *gin.Context) {
 	})
 }
 
+// GetInviteQRCode renders an invite's URL as a PNG QR code. Like GetInvite it needs
+// no authentication, so the image can be embedded in emails. ?size sets the width
+// in pixels, clamped to between minInviteQRSize and maxInviteQRSize.
+func GetInviteQRCode(c *gin.Context) {
+	code := strings.TrimSpace(c.Param("code"))
+	if code == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInviteCodeRequired, "invite code is required")
+		return
+	}
+
+	size := defaultInviteQRSize
+	if raw := strings.TrimSpace(c.Query("size")); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "size must be a number of pixels")
+			return
+		}
+		size = min(max(value, minInviteQRSize), maxInviteQRSize)
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+
+	var invite models.ServerInvite
+	if err := db.WithContext(c).Where("code = ?", code).First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, errInviteNotFound)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load invite")
+		return
+	}
+
+	if err := validateInvite(invite); err != nil {
+		status := http.StatusBadRequest
+		switch err {
+		case errInviteExpired, errInviteRevoked:
+			status = http.StatusGone
+		case errInviteMaxed:
+			status = http.StatusForbidden
+		}
+
+		respondError(c, status, err)
+		return
+	}
+
+	png, err := qrcode.Encode(buildInviteURL(invite.Code), qrcode.Medium, size)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to render qr code")
+		return
+	}
+
+	// Keep the cache short so revoking the invite takes effect quickly.
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
 // AcceptInvite allows an authenticated user to join the server associated with an invite.
 func AcceptInvite(c *gin.Context) {
 	code := strings.TrimSpace(c.Param("code"))
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invite code is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInviteCodeRequired, "invite code is required")
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
-	var invite models.ServerInvite
+	var (
+		invite     models.ServerInvite
+		memberRole string
+		joined     bool
+	)
 	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
 		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
 			Preload("Server").
@@ -105,23 +283,35 @@ func AcceptInvite(c *gin.Context) {
 			return err
 		}
 
-		if err := ensureServerMembership(tx, invite.ServerID, claims.UserID); err == nil {
+		banned, err := isUserBanned(tx, invite.ServerID, claims.UserID)
+		if err != nil {
+			return err
+		}
+		if banned {
+			return errServerBanned
+		}
+
+		var existing models.ServerMember
+		if err := tx.Where("server_id = ? AND user_id = ?", invite.ServerID, claims.UserID).First(&existing).Error; err == nil {
+			memberRole = existing.Role
 			return nil
-		} else if !errors.Is(err, errServerMembershipRequired) {
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
 			return err
 		}
 
 		member := models.ServerMember{
 			ServerID: invite.ServerID,
 			UserID:   claims.UserID,
-			Role:     models.ServerRoleMember,
+			Role:     inviteMemberRole(invite),
 		}
+		memberRole = member.Role
 		inviterID := invite.InviterID
 		member.InvitedBy = &inviterID
 
 		if err := tx.Create(&member).Error; err != nil && !errors.Is(err, gorm.ErrDuplicatedKey) {
 			return err
 		}
+		joined = true
 
 		if err := incrementInviteUsage(tx, &invite); err != nil {
 			return err
@@ -133,20 +323,25 @@ func AcceptInvite(c *gin.Context) {
 	if err != nil {
 		switch err {
 		case errInviteNotFound:
-			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			respondError(c, http.StatusNotFound, err)
 		case errInviteExpired, errInviteRevoked:
-			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+			respondError(c, http.StatusGone, err)
 		case errInviteMaxed:
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
-		case errServerMembershipRequired:
-			// Should not hit due to earlier check, but handle defensively.
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			respondError(c, http.StatusForbidden, err)
+		case errServerBanned:
+			respondError(c, http.StatusForbidden, err)
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to accept invite"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to accept invite")
 		}
 		return
 	}
 
+	invite.Server.CurrentMemberRole = memberRole
+
+	if joined && memberRole != models.ServerRolePending {
+		handleMemberJoined(c, invite.ServerID, claims.UserID)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Invite accepted",
 		"data": gin.H{
@@ -156,7 +351,105 @@ func AcceptInvite(c *gin.Context) {
 	})
 }
 
+// GetServerInvites lists a server's invites. Expired, revoked, and exhausted invites are
+// omitted unless include_inactive=true is supplied.
+func GetServerInvites(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageInvites, "you do not have permission to view invites"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	includeInactive, _ := strconv.ParseBool(strings.TrimSpace(c.Query("include_inactive")))
+
+	query := caller.DB.Where("server_id = ?", serverID)
+	if !includeInactive {
+		query = query.
+			Where("revoked_at IS NULL").
+			Where("(expires_at IS NULL OR expires_at > ?)", time.Now()).
+			Where("(max_uses = 0 OR uses < max_uses)")
+	}
+
+	var invites []models.ServerInvite
+	if err := query.Order("created_at DESC").Find(&invites).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load invites")
+		return
+	}
+
+	payload := make([]gin.H, 0, len(invites))
+	for _, invite := range invites {
+		payload = append(payload, serializeInvite(invite))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"invites": payload}})
+}
+
+// RevokeServerInvite marks an invite as revoked so it can no longer be accepted.
+func RevokeServerInvite(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.Require(models.PermissionManageInvites, "you do not have permission to revoke invites"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	code := strings.TrimSpace(c.Param("code"))
+	if code == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInviteCodeRequired, "invite code is required")
+		return
+	}
+
+	var invite models.ServerInvite
+	if err := caller.DB.Where("server_id = ? AND code = ?", serverID, code).First(&invite).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, errInviteNotFound)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load invite")
+		return
+	}
+
+	if invite.RevokedAt == nil {
+		now := time.Now()
+		if err := caller.DB.Model(&invite).Update("revoked_at", now).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to revoke invite")
+			return
+		}
+		invite.RevokedAt = &now
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// inviteMemberRole returns the role for someone joining through the invite. An
+// invite that grants a role skips the join gate, since the owner who created it
+// has already vouched for the invitee; it is ignored if that user no longer owns
+// the server.
+func inviteMemberRole(invite models.ServerInvite) string {
+	if invite.Role != "" && invite.Role != models.ServerRoleMember &&
+		assignableServerRoles[invite.Role] && invite.InviterID == invite.Server.OwnerID {
+		return invite.Role
+	}
+
+	return initialMemberRole(invite.Server)
+}
+
+// validateInvite reports why an invite can no longer be accepted. Used-up invites
+// are also revoked, so that check comes first to report them as spent.
 func validateInvite(invite models.ServerInvite) error {
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
+		return errInviteMaxed
+	}
+
 	if invite.RevokedAt != nil {
 		return errInviteRevoked
 	}
@@ -165,22 +458,35 @@ func validateInvite(invite models.ServerInvite) error {
 		return errInviteExpired
 	}
 
-	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
-		return errInviteMaxed
-	}
-
 	return nil
 }
 
+// incrementInviteUsage records one use and revokes the invite once it reaches
+// max_uses. The update only matches while uses are left, so even without the row
+// lock AcceptInvite takes, two accepts cannot both claim the last use.
 func incrementInviteUsage(tx *gorm.DB, invite *models.ServerInvite) error {
 	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses {
 		return errInviteMaxed
 	}
 
-	if err := tx.Model(invite).Where("id = ?", invite.ID).UpdateColumn("uses", gorm.Expr("uses + 1")).Error; err != nil {
-		return err
+	result := tx.Model(&models.ServerInvite{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInviteMaxed
 	}
-
 	invite.Uses++
+
+	if invite.MaxUses > 0 && invite.Uses >= invite.MaxUses && invite.RevokedAt == nil {
+		now := time.Now()
+		if err := tx.Model(&models.ServerInvite{}).Where("id = ?", invite.ID).UpdateColumn("revoked_at", now).Error; err != nil {
+			return err
+		}
+		invite.RevokedAt = &now
+	}
+
 	return nil
 }
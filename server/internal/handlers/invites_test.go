@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInvitePolicyFromEnvCodeLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   string
+		alphabet string
+		want     invitePolicy
+	}{
+		{name: "defaults", want: invitePolicy{AllowUnlimited: true, CodeLength: defaultInviteCodeLength, CodeAlphabet: inviteCodeAlphabetURL}},
+		{name: "short url codes raised to 64 bits", length: "6", want: invitePolicy{AllowUnlimited: true, CodeLength: 11, CodeAlphabet: inviteCodeAlphabetURL}},
+		{name: "short readable codes raised to 64 bits", length: "6", alphabet: " Readable ", want: invitePolicy{AllowUnlimited: true, CodeLength: 13, CodeAlphabet: inviteCodeAlphabetReadable}},
+		{name: "long codes capped to column size", length: "500", want: invitePolicy{AllowUnlimited: true, CodeLength: maxInviteCodeLength, CodeAlphabet: inviteCodeAlphabetURL}},
+		{name: "unknown alphabet keeps url", length: "20", alphabet: "emoji", want: invitePolicy{AllowUnlimited: true, CodeLength: 20, CodeAlphabet: inviteCodeAlphabetURL}},
+		{name: "invalid length keeps default", length: "-3", want: invitePolicy{AllowUnlimited: true, CodeLength: defaultInviteCodeLength, CodeAlphabet: inviteCodeAlphabetURL}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INVITE_MAX_USES", "")
+			t.Setenv("INVITE_ALLOW_UNLIMITED", "")
+			t.Setenv("INVITE_CODE_LENGTH", tt.length)
+			t.Setenv("INVITE_CODE_ALPHABET", tt.alphabet)
+
+			if got := invitePolicyFromEnv(); got != tt.want {
+				t.Fatalf("invitePolicyFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateInviteCode(t *testing.T) {
+	tests := []struct {
+		name     string
+		length   int
+		alphabet string
+		want     int
+	}{
+		{name: "url", length: 11, alphabet: inviteCodeAlphabetURL, want: 11},
+		{name: "url multiple of four", length: 16, alphabet: inviteCodeAlphabetURL, want: 16},
+		{name: "readable", length: 13, alphabet: inviteCodeAlphabetReadable, want: 13},
+		{name: "zero length uses default", length: 0, alphabet: inviteCodeAlphabetURL, want: defaultInviteCodeLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seen := make(map[string]bool)
+			for i := 0; i < 50; i++ {
+				code, err := generateInviteCode(tt.length, tt.alphabet)
+				if err != nil {
+					t.Fatalf("generateInviteCode: %v", err)
+				}
+				if len(code) != tt.want {
+					t.Fatalf("len(%q) = %d, want %d", code, len(code), tt.want)
+				}
+				if !isURLSafeInviteCode(code) {
+					t.Fatalf("code %q is not URL-safe", code)
+				}
+				if tt.alphabet == inviteCodeAlphabetReadable && strings.Trim(code, readableInviteCodeChars) != "" {
+					t.Fatalf("readable code %q uses characters outside %q", code, readableInviteCodeChars)
+				}
+				if seen[code] {
+					t.Fatalf("generated duplicate code %q", code)
+				}
+				seen[code] = true
+			}
+		})
+	}
+}
+
+func TestIsURLSafeInviteCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{code: "aZ09-_", want: true},
+		{code: "", want: false},
+		{code: "abc+def", want: false},
+		{code: "abc/def", want: false},
+		{code: "abc def", want: false},
+		{code: "abc=", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isURLSafeInviteCode(tt.code); got != tt.want {
+			t.Fatalf("isURLSafeInviteCode(%q) = %v, want %v", tt.code, got, tt.want)
+		}
+	}
+}
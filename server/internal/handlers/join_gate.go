@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errJoinGateRulesMissing = errors.New("rules text is required when rules acceptance is enabled")
+	errMemberNotPending     = errors.New("member is not pending approval")
+)
+
+// UpdateServerJoinGate configures whether new members must accept rules and/or be approved before gaining access.
+func UpdateServerJoinGate(c *gin.Context) {
+	var req models.UpdateServerJoinGateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can configure the join gate"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var (
+		server    models.Server
+		activated []uint
+	)
+	err = caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&server, serverID).Error; err != nil {
+			return err
+		}
+
+		if req.Rules != nil {
+			server.Rules = strings.TrimSpace(*req.Rules)
+		}
+		if req.RequireRules != nil {
+			server.RequireRules = *req.RequireRules
+		}
+		if req.RequireApproval != nil {
+			server.RequireApproval = *req.RequireApproval
+		}
+
+		if server.RequireRules && server.Rules == "" {
+			return errJoinGateRulesMissing
+		}
+
+		if err := tx.Model(&server).Updates(map[string]interface{}{
+			"rules":            server.Rules,
+			"require_rules":    server.RequireRules,
+			"require_approval": server.RequireApproval,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Relaxing the gate releases anyone who now satisfies the remaining requirements.
+		ids, err := activatePendingMembers(tx, server, 0)
+		activated = ids
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errJoinGateRulesMissing):
+			respondError(c, http.StatusBadRequest, err)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update join gate")
+		}
+		return
+	}
+
+	syncActivatedMembers(c, server.ID, activated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Join gate updated",
+		"data": gin.H{
+			"server_id":        server.ID,
+			"rules":            server.Rules,
+			"require_rules":    server.RequireRules,
+			"require_approval": server.RequireApproval,
+		},
+	})
+}
+
+// AcceptServerRules records that the current user accepted the server rules, activating their membership when no other requirement remains.
+func AcceptServerRules(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	serverIDValue, err := strconv.ParseUint(c.Param("serverID"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid server id")
+		return
+	}
+	serverID := uint(serverIDValue)
+
+	var (
+		membership models.ServerMember
+		activated  []uint
+	)
+	err = caller.DB.Transaction(func(tx *gorm.DB) error {
+		var server models.Server
+		if err := tx.First(&server, serverID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("server_id = ? AND user_id = ?", serverID, caller.Claims.UserID).First(&membership).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errServerMembershipRequired
+			}
+			return err
+		}
+
+		if membership.RulesAcceptedAt == nil {
+			now := time.Now()
+			if err := tx.Model(&models.ServerMember{}).
+				Where("server_id = ? AND user_id = ?", serverID, caller.Claims.UserID).
+				Update("rules_accepted_at", now).Error; err != nil {
+				return err
+			}
+			membership.RulesAcceptedAt = &now
+		}
+
+		ids, err := activatePendingMembers(tx, server, caller.Claims.UserID)
+		if err != nil {
+			return err
+		}
+		activated = ids
+
+		return tx.Where("server_id = ? AND user_id = ?", serverID, caller.Claims.UserID).First(&membership).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errServerMembershipRequired):
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to accept rules")
+		}
+		return
+	}
+
+	syncActivatedMembers(c, serverID, activated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Rules accepted",
+		"data": gin.H{
+			"membership": serializeServerMembership(membership),
+		},
+	})
+}
+
+// ApproveServerMember approves a pending member, activating their membership when no other requirement remains.
+func ApproveServerMember(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	targetIDValue, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil || targetIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+		return
+	}
+	targetID := uint(targetIDValue)
+
+	if err := caller.Require(models.PermissionManageMembers, "you do not have permission to approve members"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var (
+		membership models.ServerMember
+		activated  []uint
+	)
+	err = caller.DB.Transaction(func(tx *gorm.DB) error {
+		var server models.Server
+		if err := tx.First(&server, serverID).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("server_id = ? AND user_id = ?", serverID, targetID).First(&membership).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errServerMembershipRequired
+			}
+			return err
+		}
+
+		if membership.Role != models.ServerRolePending {
+			return errMemberNotPending
+		}
+
+		if membership.ApprovedAt == nil {
+			now := time.Now()
+			if err := tx.Model(&models.ServerMember{}).
+				Where("server_id = ? AND user_id = ?", serverID, targetID).
+				Updates(map[string]interface{}{
+					"approved_at": now,
+					"approved_by": caller.Claims.UserID,
+				}).Error; err != nil {
+				return err
+			}
+		}
+
+		ids, err := activatePendingMembers(tx, server, targetID)
+		if err != nil {
+			return err
+		}
+		activated = ids
+
+		return tx.Where("server_id = ? AND user_id = ?", serverID, targetID).First(&membership).Error
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errServerMembershipRequired):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotServerMember, "user is not a member of this server")
+		case errors.Is(err, errMemberNotPending):
+			respondError(c, http.StatusConflict, err)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+		default:
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to approve member")
+		}
+		return
+	}
+
+	syncActivatedMembers(c, serverID, activated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Member approved",
+		"data": gin.H{
+			"membership": serializeServerMembership(membership),
+		},
+	})
+}
+
+// initialMemberRole returns the role assigned to someone joining the server.
+func initialMemberRole(server models.Server) string {
+	if server.RequireRules || server.RequireApproval {
+		return models.ServerRolePending
+	}
+
+	return models.ServerRoleMember
+}
+
+// activatePendingMembers promotes pending members who satisfy every enabled join gate requirement
+// and returns the IDs of the promoted users. When userID is non-zero only that member is considered.
+func activatePendingMembers(tx *gorm.DB, server models.Server, userID uint) ([]uint, error) {
+	query := tx.Model(&models.ServerMember{}).
+		Where("server_id = ? AND role = ?", server.ID, models.ServerRolePending)
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+	if server.RequireRules {
+		query = query.Where("rules_accepted_at IS NOT NULL")
+	}
+	if server.RequireApproval {
+		query = query.Where("approved_at IS NOT NULL")
+	}
+
+	var userIDs []uint
+	if err := query.Pluck("user_id", &userIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+
+	if err := tx.Model(&models.ServerMember{}).
+		Where("server_id = ? AND user_id IN ?", server.ID, userIDs).
+		Update("role", models.ServerRoleMember).Error; err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
+
+// syncActivatedMembers runs the member-joined hooks for members released from the join gate.
+func syncActivatedMembers(c *gin.Context, serverID uint, userIDs []uint) {
+	for _, userID := range userIDs {
+		handleMemberJoined(c, serverID, userID)
+	}
+}
+
+func serializeServerMembership(membership models.ServerMember) gin.H {
+	payload := gin.H{
+		"server_id": membership.ServerID,
+		"user_id":   membership.UserID,
+		"role":      membership.Role,
+		"nickname":  membership.Nickname,
+		"pending":   membership.Role == models.ServerRolePending,
+		"joined_at": membership.JoinedAt.Format(time.RFC3339),
+	}
+
+	if membership.RulesAcceptedAt != nil {
+		payload["rules_accepted_at"] = membership.RulesAcceptedAt.Format(time.RFC3339)
+	}
+	if membership.ApprovedAt != nil {
+		payload["approved_at"] = membership.ApprovedAt.Format(time.RFC3339)
+	}
+
+	return payload
+}
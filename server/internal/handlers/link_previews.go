@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"bafachat/internal/logging"
+	"bafachat/internal/models"
+	"bafachat/internal/queue"
+	"bafachat/internal/unfurl"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// linkPreviewTimeout bounds a preview fetched without the queue.
+const linkPreviewTimeout = 30 * time.Second
+
+// queueLinkPreview schedules a preview card for the first URL in the message. It is
+// built by the queue worker, or in the background when no queue is available, and
+// clients receive it through message.updated.
+func queueLinkPreview(c *gin.Context, db *gorm.DB, message models.Message) {
+	fetcher, ok := getLinkPreviewFetcher(c)
+	if !ok {
+		return
+	}
+
+	link := unfurl.FirstURL(message.Content)
+	if link == "" {
+		return
+	}
+
+	if queueClient, ok := getQueueClient(c); ok {
+		task, err := queue.NewLinkPreviewTask(queue.LinkPreviewTaskPayload{
+			MessageID: message.ID,
+			URL:       link,
+			RequestID: logging.RequestID(c.Request.Context()),
+		})
+		if err == nil {
+			if _, err = queueClient.Enqueue(task, asynq.Timeout(time.Minute)); err == nil {
+				return
+			}
+		}
+		requestLogger(c).Warn("link preview: failed to enqueue, fetching in background", "message_id", message.ID, "error", err)
+	}
+
+	hub, _ := getWebSocketHub(c)
+	requestCtx := context.WithoutCancel(c.Request.Context())
+
+	go func() {
+		ctx, cancel := context.WithTimeout(requestCtx, linkPreviewTimeout)
+		defer cancel()
+
+		if err := buildLinkPreview(ctx, db, hub, fetcher, message.ID, link); err != nil {
+			logging.FromContext(ctx).Info("link preview skipped", "message_id", message.ID, "error", err)
+		}
+	}()
+}
+
+// NewLinkPreviewProcessor returns the queue worker for link preview tasks.
+func NewLinkPreviewProcessor(db *gorm.DB, hub *websocket.Hub, fetcher *unfurl.Fetcher) queue.LinkPreviewProcessor {
+	return func(ctx context.Context, payload queue.LinkPreviewTaskPayload) error {
+		return buildLinkPreview(ctx, db, hub, fetcher, payload.MessageID, payload.URL)
+	}
+}
+
+// buildLinkPreview fetches the link's metadata, stores it against the message and
+// publishes message.updated. A message deleted in the meantime is skipped.
+func buildLinkPreview(ctx context.Context, db *gorm.DB, hub *websocket.Hub, fetcher *unfurl.Fetcher, messageID uint, link string) error {
+	preview, err := fetcher.Fetch(ctx, link)
+	if err != nil {
+		return err
+	}
+
+	db = db.WithContext(ctx)
+
+	var exists int64
+	if err := db.Model(&models.Message{}).Where("id = ?", messageID).Count(&exists).Error; err != nil {
+		return fmt.Errorf("load message: %w", err)
+	}
+	if exists == 0 {
+		return nil
+	}
+
+	record := models.LinkPreview{
+		MessageID:   messageID,
+		URL:         preview.URL,
+		Title:       preview.Title,
+		Description: preview.Description,
+		ImageURL:    preview.ImageURL,
+		SiteName:    preview.SiteName,
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"url", "title", "description", "image_url", "site_name"}),
+	}).Create(&record).Error; err != nil {
+		return fmt.Errorf("save link preview: %w", err)
+	}
+
+	var message models.Message
+	if err := db.
+		Preload("User").
+		Preload("Attachments").
+		Preload("Mentions.User", preloadMentionUsers).
+		Preload("Emojis.Emoji").
+		Preload("LinkPreview").
+		Preload("Channel").
+		First(&message, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("load message: %w", err)
+	}
+	applyAuthorNickname(db, &message)
+
+	if hub != nil {
+		_ = publishChannelEvent(hub, db, message.Channel, websocket.MessageUpdated(serializeMessage(message), message.ChannelID, message.Channel.ServerID))
+	}
+
+	return nil
+}
+
+func serializeLinkPreview(preview *models.LinkPreview) gin.H {
+	if preview == nil {
+		return nil
+	}
+
+	return gin.H{
+		"url":         preview.URL,
+		"title":       preview.Title,
+		"description": preview.Description,
+		"image_url":   preview.ImageURL,
+		"site_name":   preview.SiteName,
+	}
+}
@@ -0,0 +1,526 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultMemberPageSize = 50
+	maxMemberPageSize     = 200
+)
+
+type serverMemberRow struct {
+	UserID   uint
+	Username string
+	Nickname string
+	Avatar   string
+	Role     string
+	JoinedAt time.Time
+	// LastSeenAt is nil for users who have not connected since it was tracked.
+	LastSeenAt *time.Time
+}
+
+// GetServerMembers returns a paginated list of a server's members with basic profile details.
+func GetServerMembers(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	limit := defaultMemberPageSize
+	if rawLimit := strings.TrimSpace(c.Query("limit")); rawLimit != "" {
+		if parsedLimit, err := strconv.Atoi(rawLimit); err == nil {
+			if parsedLimit < 1 {
+				parsedLimit = 1
+			}
+			if parsedLimit > maxMemberPageSize {
+				parsedLimit = maxMemberPageSize
+			}
+			limit = parsedLimit
+		}
+	}
+
+	var cursor uint64
+	if rawCursor := strings.TrimSpace(c.Query("cursor")); rawCursor != "" {
+		parsed, err := strconv.ParseUint(rawCursor, 10, 64)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidCursor, "invalid cursor")
+			return
+		}
+		cursor = parsed
+	}
+
+	role := strings.ToLower(strings.TrimSpace(c.Query("role")))
+
+	// Pending members are only listed when moderators explicitly ask for the approval queue.
+	if role == models.ServerRolePending {
+		if err := caller.Require(models.PermissionManageMembers, "you do not have permission to view pending members"); err != nil {
+			respondActorError(c, err)
+			return
+		}
+	}
+
+	base := caller.DB.
+		Model(&models.ServerMember{}).
+		Where("server_members.server_id = ?", serverID)
+	if role != "" {
+		base = base.Where("server_members.role = ?", role)
+	} else {
+		base = base.Where("server_members.role <> ?", models.ServerRolePending)
+	}
+
+	var total int64
+	if err := base.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to count members")
+		return
+	}
+
+	query := base.Session(&gorm.Session{}).
+		Select("server_members.user_id, users.username, server_members.nickname, users.avatar, server_members.role, server_members.joined_at, users.last_seen_at").
+		Joins("JOIN users ON users.id = server_members.user_id")
+	if cursor > 0 {
+		query = query.Where("server_members.user_id > ?", cursor)
+	}
+
+	var rows []serverMemberRow
+	if err := query.
+		Order("server_members.user_id ASC").
+		Limit(limit + 1).
+		Scan(&rows).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load members")
+		return
+	}
+
+	hasMore := false
+	if len(rows) > limit {
+		hasMore = true
+		rows = rows[:limit]
+	}
+
+	members := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		members = append(members, serializeServerMemberRow(row))
+	}
+
+	payload := gin.H{
+		"members":  members,
+		"total":    total,
+		"has_more": hasMore,
+	}
+
+	if hasMore && len(rows) > 0 {
+		payload["next_cursor"] = strconv.FormatUint(uint64(rows[len(rows)-1].UserID), 10)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": payload})
+}
+
+// KickServerMember removes a member from a server and ends any active voice sessions they hold there.
+func KickServerMember(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	targetIDValue, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil || targetIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+		return
+	}
+	targetID := uint(targetIDValue)
+
+	if err := caller.Require(models.PermissionManageMembers, "you do not have permission to kick members"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var membership models.ServerMember
+	if err := caller.DB.
+		Where("server_id = ? AND user_id = ?", serverID, targetID).
+		First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotServerMember, "user is not a member of this server")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load membership")
+		return
+	}
+
+	if !canModerateMember(caller.Role(), membership.Role) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeInsufficientRole, "you cannot kick a member with an equal or higher role")
+		return
+	}
+
+	if err := caller.DB.
+		Where("server_id = ? AND user_id = ?", serverID, targetID).
+		Delete(&models.ServerMember{}).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to remove member")
+		return
+	}
+
+	evictFromServerVoiceChannels(c, caller.DB, serverID, targetID, "kicked")
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventMemberKicked, gin.H{
+			"server_id": serverID,
+			"user_id":   targetID,
+			"kicked_by": caller.Claims.UserID,
+		}))
+		hub.RemoveServerMember(serverID, targetID)
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UpdateServerMemberRole assigns a new role to a server member. Only the server owner may change roles.
+func UpdateServerMemberRole(c *gin.Context) {
+	var req models.UpdateServerMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if !assignableServerRoles[role] {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRole, "role must be admin or member")
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	targetIDValue, err := strconv.ParseUint(c.Param("userID"), 10, 64)
+	if err != nil || targetIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+		return
+	}
+	targetID := uint(targetIDValue)
+
+	if err := caller.RequireOwner("only server owners can assign roles"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var membership models.ServerMember
+	if err := caller.DB.
+		Where("server_id = ? AND user_id = ?", serverID, targetID).
+		First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotServerMember, "user is not a member of this server")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load membership")
+		return
+	}
+
+	if membership.Role == models.ServerRoleOwner {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeOwnerRoleImmutable, "the server owner's role cannot be changed")
+		return
+	}
+
+	// Pending members join through approval, which also checks rules acceptance
+	// and announces them; a role change must not skip that.
+	if membership.Role == models.ServerRolePending {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeMemberPending, "member is pending approval; approve them with the approve endpoint instead")
+		return
+	}
+
+	if membership.Role != role {
+		if err := caller.DB.
+			Model(&models.ServerMember{}).
+			Where("server_id = ? AND user_id = ?", serverID, targetID).
+			Update("role", role).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update role")
+			return
+		}
+
+		if hub, ok := getWebSocketHub(c); ok {
+			_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventMemberRoleUpdated, gin.H{
+				"server_id":  serverID,
+				"user_id":    targetID,
+				"role":       role,
+				"updated_by": caller.Claims.UserID,
+			}))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role updated",
+		"data": gin.H{
+			"server_id": serverID,
+			"user_id":   targetID,
+			"role":      role,
+		},
+	})
+}
+
+// UpdateServerMemberNickname sets a member's nickname in the server. Members may
+// change their own with "me" as the user ID; changing someone else's requires
+// manage_members and, like kicking, only owners may change an admin's.
+func UpdateServerMemberNickname(c *gin.Context) {
+	var req models.UpdateMemberNicknameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	targetID := caller.Claims.UserID
+	if param := c.Param("userID"); param != "me" {
+		targetIDValue, err := strconv.ParseUint(param, 10, 64)
+		if err != nil || targetIDValue == 0 {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid user id")
+			return
+		}
+		targetID = uint(targetIDValue)
+	}
+
+	nickname := strings.TrimSpace(req.Nickname)
+
+	membership := *caller.Membership
+	if targetID != caller.Claims.UserID {
+		if err := caller.Require(models.PermissionManageMembers, "you do not have permission to change nicknames"); err != nil {
+			respondActorError(c, err)
+			return
+		}
+
+		if err := caller.DB.
+			Where("server_id = ? AND user_id = ?", serverID, targetID).
+			First(&membership).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				apierror.Respond(c, http.StatusNotFound, apierror.CodeNotServerMember, "user is not a member of this server")
+				return
+			}
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load membership")
+			return
+		}
+
+		if !canModerateMember(caller.Role(), membership.Role) {
+			respondError(c, http.StatusForbidden, errServerPermissionRequired)
+			return
+		}
+	}
+
+	if membership.Nickname != nickname {
+		if err := caller.DB.
+			Model(&models.ServerMember{}).
+			Where("server_id = ? AND user_id = ?", serverID, targetID).
+			Update("nickname", nickname).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update nickname")
+			return
+		}
+
+		if hub, ok := getWebSocketHub(c); ok {
+			_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventMemberNicknameUpdated, gin.H{
+				"server_id":  serverID,
+				"user_id":    targetID,
+				"nickname":   nickname,
+				"updated_by": caller.Claims.UserID,
+			}))
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Nickname updated",
+		"data": gin.H{
+			"server_id": serverID,
+			"user_id":   targetID,
+			"nickname":  nickname,
+		},
+	})
+}
+
+// TransferServerOwnership hands the server to another active member. The previous
+// owner stays on as an admin.
+func TransferServerOwnership(c *gin.Context) {
+	var req models.TransferServerOwnershipRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only the server owner can transfer ownership"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if req.UserID == caller.Claims.UserID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidTransferTarget, "you already own this server")
+		return
+	}
+
+	var membership models.ServerMember
+	if err := caller.DB.
+		Where("server_id = ? AND user_id = ?", serverID, req.UserID).
+		First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotServerMember, "user is not a member of this server")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load membership")
+		return
+	}
+
+	if membership.Role == models.ServerRolePending {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidTransferTarget, "pending members cannot own a server")
+		return
+	}
+
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Server{}).Where("id = ?", serverID).Update("owner_id", req.UserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.ServerMember{}).
+			Where("server_id = ? AND user_id = ?", serverID, req.UserID).
+			Update("role", models.ServerRoleOwner).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ServerMember{}).
+			Where("server_id = ? AND user_id = ?", serverID, caller.Claims.UserID).
+			Update("role", models.ServerRoleAdmin).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to transfer ownership")
+		return
+	}
+
+	if hub, ok := getWebSocketHub(c); ok {
+		_ = hub.PublishToServer(serverID, websocket.NewEvent(websocket.EventServerOwnershipTransferred, gin.H{
+			"server_id":         serverID,
+			"owner_id":          req.UserID,
+			"previous_owner_id": caller.Claims.UserID,
+		}))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Ownership transferred",
+		"data": gin.H{
+			"server_id":         serverID,
+			"owner_id":          req.UserID,
+			"previous_owner_id": caller.Claims.UserID,
+		},
+	})
+}
+
+// evictFromServerVoiceChannels ends any WebRTC sessions the user holds in the server's audio channels.
+func evictFromServerVoiceChannels(c *gin.Context, db *gorm.DB, serverID, userID uint, reason string) {
+	hub, ok := getWebSocketHub(c)
+	if !ok {
+		return
+	}
+
+	var channelIDs []uint
+	if err := db.WithContext(c).
+		Model(&models.Channel{}).
+		Where("server_id = ? AND type = ?", serverID, models.ChannelTypeAudio).
+		Pluck("id", &channelIDs).Error; err != nil {
+		requestLogger(c).Error("failed to load voice channels", "server_id", serverID, "error", err)
+		return
+	}
+
+	rtcManager, hasManager := getWebRTCManager(c)
+	for _, channelID := range channelIDs {
+		removed := hub.EvictParticipant(channelID, userID, reason)
+		if removed != nil && hasManager && removed.SessionToken != "" {
+			rtcManager.Revoke(removed.SessionToken)
+		}
+	}
+}
+
+func serializeServerMemberRow(row serverMemberRow) gin.H {
+	var lastSeen string
+	if row.LastSeenAt != nil {
+		lastSeen = row.LastSeenAt.Format(time.RFC3339)
+	}
+
+	return gin.H{
+		"id":             row.UserID,
+		"username":       row.Username,
+		"nickname":       row.Nickname,
+		"display_name":   memberDisplayName(row.Nickname, row.Username),
+		"avatar":         row.Avatar,
+		"default_avatar": defaultAvatarURL(row.UserID),
+		"role":           row.Role,
+		"joined_at":      row.JoinedAt.Format(time.RFC3339),
+		"last_seen_at":   lastSeen,
+	}
+}
+
+// memberDisplayName is the name shown for a member within a server: their
+// nickname there, or their username when they have none.
+func memberDisplayName(nickname, username string) string {
+	if nickname != "" {
+		return nickname
+	}
+	return username
+}
+
+// applyAuthorNicknames fills in AuthorNickname on messages from one channel with
+// their authors' nicknames in its server. It is best effort: if the lookup fails,
+// messages show usernames.
+func applyAuthorNicknames(db *gorm.DB, channelID uint, messages []models.Message) {
+	authorIDs := make([]uint, 0, len(messages))
+	for _, message := range messages {
+		if message.WebhookID == nil && message.UserID != 0 {
+			authorIDs = append(authorIDs, message.UserID)
+		}
+	}
+	if len(authorIDs) == 0 {
+		return
+	}
+
+	var rows []struct {
+		UserID   uint
+		Nickname string
+	}
+	if err := db.Table("server_members").
+		Select("server_members.user_id, server_members.nickname").
+		Joins("JOIN channels ON channels.server_id = server_members.server_id").
+		Where("channels.id = ? AND server_members.user_id IN ? AND server_members.nickname <> ''", channelID, authorIDs).
+		Scan(&rows).Error; err != nil {
+		return
+	}
+
+	nicknames := make(map[uint]string, len(rows))
+	for _, row := range rows {
+		nicknames[row.UserID] = row.Nickname
+	}
+	for i := range messages {
+		if messages[i].WebhookID == nil {
+			messages[i].AuthorNickname = nicknames[messages[i].UserID]
+		}
+	}
+}
+
+// applyAuthorNickname is applyAuthorNicknames for a single message.
+func applyAuthorNickname(db *gorm.DB, message *models.Message) {
+	messages := []models.Message{*message}
+	applyAuthorNicknames(db, message.ChannelID, messages)
+	message.AuthorNickname = messages[0].AuthorNickname
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"strings"
+	"testing"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMemberDisplayName(t *testing.T) {
+	if got := memberDisplayName("Captain", "jane"); got != "Captain" {
+		t.Fatalf("memberDisplayName with nickname = %q, want %q", got, "Captain")
+	}
+	if got := memberDisplayName("", "jane"); got != "jane" {
+		t.Fatalf("memberDisplayName without nickname = %q, want %q", got, "jane")
+	}
+}
+
+func TestApplyAuthorNicknames(t *testing.T) {
+	db := openTestDB(t)
+
+	jane := models.User{Username: "jane", Email: "jane@example.com", Password: "x"}
+	bob := models.User{Username: "bob", Email: "bob@example.com", Password: "x"}
+	for _, user := range []*models.User{&jane, &bob} {
+		if err := db.Create(user).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server := models.Server{Name: "gophers", OwnerID: jane.ID}
+	other := models.Server{Name: "elsewhere", OwnerID: bob.ID}
+	for _, s := range []*models.Server{&server, &other} {
+		if err := db.Create(s).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	members := []models.ServerMember{
+		{ServerID: server.ID, UserID: jane.ID, Nickname: "Captain"},
+		{ServerID: server.ID, UserID: bob.ID},
+		{ServerID: other.ID, UserID: bob.ID, Nickname: "Bobby"},
+	}
+	if err := db.Create(&members).Error; err != nil {
+		t.Fatal(err)
+	}
+	channel := models.Channel{Name: "general", ServerID: server.ID}
+	if err := db.Create(&channel).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	webhookID := uint(7)
+	messages := []models.Message{
+		{UserID: jane.ID, ChannelID: channel.ID},
+		{UserID: bob.ID, ChannelID: channel.ID},
+		{UserID: jane.ID, ChannelID: channel.ID, WebhookID: &webhookID},
+	}
+	applyAuthorNicknames(db, channel.ID, messages)
+
+	want := []string{"Captain", "", ""}
+	for i, message := range messages {
+		if message.AuthorNickname != want[i] {
+			t.Fatalf("messages[%d].AuthorNickname = %q, want %q", i, message.AuthorNickname, want[i])
+		}
+	}
+
+	single := models.Message{UserID: jane.ID, ChannelID: channel.ID}
+	applyAuthorNickname(db, &single)
+	if single.AuthorNickname != "Captain" {
+		t.Fatalf("applyAuthorNickname = %q, want %q", single.AuthorNickname, "Captain")
+	}
+}
+
+func TestUpdateServerMemberRoleRejectsPendingMember(t *testing.T) {
+	roles := map[int64]string{1: models.ServerRoleOwner, 2: models.ServerRolePending}
+	db, fake := openFakeDB(t, func(query string, args []driver.Value) (fakeResult, error) {
+		if !strings.HasPrefix(query, "SELECT") {
+			return fakeResult{affected: 1}, nil
+		}
+		userID, _ := args[1].(int64)
+		result := fakeResult{columns: []string{"server_id", "user_id", "role"}}
+		if role, ok := roles[userID]; ok {
+			result.rows = [][]driver.Value{{int64(10), userID, role}}
+		}
+		return result, nil
+	})
+
+	params := gin.Params{{Key: "serverID", Value: "10"}, {Key: "userID", Value: "2"}}
+	c, w := newHandlerContext(db, 1, http.MethodPatch, "/servers/10/members/2/role", `{"role":"member"}`, params)
+
+	UpdateServerMemberRole(c)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if code := responseCode(t, w); code != apierror.CodeMemberPending {
+		t.Fatalf("code = %q, want %q", code, apierror.CodeMemberPending)
+	}
+	if fake.ranStatement("UPDATE") {
+		t.Fatal("pending member's role was updated")
+	}
+}
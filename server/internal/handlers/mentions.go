@@ -0,0 +1,375 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"bafachat/internal/email"
+	"bafachat/internal/logging"
+	"bafachat/internal/models"
+	"bafachat/internal/queue"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
+	"gorm.io/gorm"
+)
+
+// defaultMentionEmailDelay is how long a mention email waits when MENTION_EMAIL_DELAY is
+// unset, so a user who is only briefly disconnected is not emailed.
+const defaultMentionEmailDelay = 2 * time.Minute
+
+// mentionPattern matches @username tokens that are not part of a larger word or email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]{3,32})`)
+
+// parseMentionUsernames extracts the distinct, lower-cased usernames mentioned in content.
+func parseMentionUsernames(content string) []string {
+	matches := mentionPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool, len(matches))
+	usernames := make([]string, 0, len(matches))
+	for _, match := range matches {
+		username := strings.ToLower(strings.TrimRight(match[1], ".-"))
+		if len(username) < 3 || seen[username] {
+			continue
+		}
+		seen[username] = true
+		usernames = append(usernames, username)
+	}
+
+	return usernames
+}
+
+// createMessageMentions stores a mention row for each active server member referenced in the message.
+// Mentions of users outside the server are ignored.
+func createMessageMentions(tx *gorm.DB, message models.Message, serverID uint) error {
+	usernames := parseMentionUsernames(message.Content)
+	if len(usernames) == 0 {
+		return nil
+	}
+
+	var userIDs []uint
+	if err := tx.Model(&models.ServerMember{}).
+		Joins("JOIN users ON users.id = server_members.user_id").
+		Where("server_members.server_id = ? AND server_members.role <> ?", serverID, models.ServerRolePending).
+		Where("LOWER(users.username) IN ?", usernames).
+		Distinct().
+		Pluck("server_members.user_id", &userIDs).Error; err != nil {
+		return err
+	}
+
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	mentions := make([]models.MessageMention, 0, len(userIDs))
+	for _, userID := range userIDs {
+		mentions = append(mentions, models.MessageMention{
+			MessageID: message.ID,
+			UserID:    userID,
+		})
+	}
+
+	return tx.Create(&mentions).Error
+}
+
+// preloadMentionUsers limits mentioned user records to the fields serialized with a
+// message and those notifyMentionedUsers checks.
+func preloadMentionUsers(tx *gorm.DB) *gorm.DB {
+	return tx.Select("id", "username", "avatar", "email", "presence_status")
+}
+
+// notifyMentionedUsers delivers a mention.created event to each mentioned user. Users
+// who are not currently connected get a push notification and, if they are still away
+// after a grace delay, an email, as their notification preferences allow. Users in do
+// not disturb, by status or schedule, get neither.
+func notifyMentionedUsers(c *gin.Context, channel models.Channel, message models.Message, serialized gin.H) {
+	if len(message.Mentions) == 0 {
+		return
+	}
+
+	hub, hasHub := getWebSocketHub(c)
+	db, hasDB := getDB(c)
+
+	var server models.Server
+	serverLoaded := false
+
+	for _, mention := range message.Mentions {
+		if mention.UserID == message.UserID {
+			continue
+		}
+
+		// Mentioning someone outside a private channel must not leak its messages to them.
+		if channel.Private && (!hasDB || ensureChannelAccess(db.WithContext(c), channel, mention.UserID) != nil) {
+			continue
+		}
+
+		if hasHub {
+			_ = hub.PublishToUser(mention.UserID, websocket.MentionCreated(serialized, channel.ID, channel.ServerID))
+
+			if hub.IsOnline(mention.UserID) {
+				continue
+			}
+		}
+
+		// Users in do not disturb still see the mention when they return.
+		if hasDB {
+			quiet, err := userInDND(db.WithContext(c), mention.User, time.Now())
+			if err != nil {
+				requestLogger(c).Warn("failed to load do not disturb schedule", "user_id", mention.UserID, "error", err)
+			} else if quiet {
+				continue
+			}
+		}
+
+		preferences := models.DefaultNotificationPreference(mention.UserID)
+		if hasDB {
+			loaded, err := loadNotificationPreferences(db.WithContext(c), mention.UserID)
+			if err != nil {
+				requestLogger(c).Warn("failed to load notification preferences", "user_id", mention.UserID, "error", err)
+			} else {
+				preferences = loaded
+			}
+		}
+
+		if !serverLoaded {
+			if hasDB {
+				_ = db.WithContext(c).Select("id", "name").First(&server, channel.ServerID).Error
+			}
+			serverLoaded = true
+		}
+
+		if preferences.PushMentions && hasDB {
+			sendMentionPush(c, db.WithContext(c), mention.UserID, message, channel, server)
+		}
+
+		if preferences.EmailMentions && mention.User.Email != "" && hasDB {
+			scheduleMentionEmail(c, db, hub, mention.UserID, message.ID)
+		}
+	}
+}
+
+// mentionEmailDelayFromEnv reads MENTION_EMAIL_DELAY as a Go duration. Zero sends
+// the email as soon as the mention is posted.
+func mentionEmailDelayFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("MENTION_EMAIL_DELAY"))
+	if raw == "" {
+		return defaultMentionEmailDelay
+	}
+
+	delay, err := time.ParseDuration(raw)
+	if err != nil || delay < 0 {
+		return defaultMentionEmailDelay
+	}
+
+	return delay
+}
+
+// scheduleMentionEmail emails an offline user about a mention once the grace delay
+// has passed, unless they have come back online or read the channel by then. The
+// wait runs as a delayed queue task, or a timer when the queue is unavailable.
+func scheduleMentionEmail(c *gin.Context, db *gorm.DB, hub *websocket.Hub, recipientID, messageID uint) {
+	queueClient, hasQueue := getQueueClient(c)
+	emailService, hasEmail := getEmailService(c)
+	delay := mentionEmailDelayFromEnv()
+
+	if hasQueue {
+		task, err := queue.NewMentionEmailTask(queue.MentionEmailTaskPayload{
+			MessageID:   messageID,
+			RecipientID: recipientID,
+			RequestID:   logging.RequestID(c.Request.Context()),
+		}, delay)
+		if err != nil {
+			return
+		}
+		if _, err := queueClient.Enqueue(task); err != nil {
+			requestLogger(c).Warn("failed to queue mention email", "user_id", recipientID, "message_id", messageID, "error", err)
+		}
+		return
+	}
+
+	if !hasEmail {
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	time.AfterFunc(delay, func() {
+		payload, ok, err := pendingMentionEmail(ctx, db, hub, recipientID, messageID)
+		if err != nil {
+			logging.FromContext(ctx).Warn("failed to prepare mention email", "user_id", recipientID, "message_id", messageID, "error", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		if err := emailService.SendEmail(ctx, email.SendEmailInput{
+			To:       payload.To,
+			Subject:  payload.Subject,
+			HTMLBody: payload.HTMLBody,
+			TextBody: payload.TextBody,
+			Tag:      payload.Tag,
+			Metadata: payload.Meta,
+		}); err != nil {
+			logging.FromContext(ctx).Warn("failed to send mention email", "user_id", recipientID, "message_id", messageID, "error", err)
+		}
+	})
+}
+
+// NewMentionEmailProcessor returns the queue processor for delayed mention emails.
+// Emails that are still needed are queued as ordinary email tasks, so they share
+// the email retry and dead-letter handling.
+func NewMentionEmailProcessor(db *gorm.DB, hub *websocket.Hub, queueClient *asynq.Client) queue.MentionEmailProcessor {
+	return func(ctx context.Context, payload queue.MentionEmailTaskPayload) error {
+		emailPayload, ok, err := pendingMentionEmail(ctx, db, hub, payload.RecipientID, payload.MessageID)
+		if err != nil || !ok {
+			return err
+		}
+
+		task, err := queue.NewEmailTask(emailPayload)
+		if err != nil {
+			return fmt.Errorf("build mention email: %w: %w", err, asynq.SkipRetry)
+		}
+
+		_, err = queueClient.EnqueueContext(ctx, task)
+		return err
+	}
+}
+
+// pendingMentionEmail builds the email for a mention after the grace delay. It
+// reports false when the email is no longer wanted: the recipient is online, has
+// read the channel past the message, has turned mention emails off, is in do not
+// disturb or has lost access to the channel, or the message was deleted.
+func pendingMentionEmail(ctx context.Context, db *gorm.DB, hub *websocket.Hub, recipientID, messageID uint) (queue.EmailTaskPayload, bool, error) {
+	if hub != nil && hub.IsOnline(recipientID) {
+		return queue.EmailTaskPayload{}, false, nil
+	}
+
+	db = db.WithContext(ctx)
+
+	var message models.Message
+	if err := db.Preload("User").Preload("Channel").First(&message, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return queue.EmailTaskPayload{}, false, nil
+		}
+		return queue.EmailTaskPayload{}, false, fmt.Errorf("load message: %w", err)
+	}
+	if message.ExpiresAt != nil && !message.ExpiresAt.After(time.Now()) {
+		return queue.EmailTaskPayload{}, false, nil
+	}
+
+	var recipient models.User
+	if err := db.Select("id", "username", "email", "presence_status").First(&recipient, recipientID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return queue.EmailTaskPayload{}, false, nil
+		}
+		return queue.EmailTaskPayload{}, false, fmt.Errorf("load recipient: %w", err)
+	}
+	if recipient.Email == "" {
+		return queue.EmailTaskPayload{}, false, nil
+	}
+
+	quiet, err := userInDND(db, recipient, time.Now())
+	if err != nil {
+		return queue.EmailTaskPayload{}, false, fmt.Errorf("load do not disturb schedule: %w", err)
+	}
+	if quiet {
+		return queue.EmailTaskPayload{}, false, nil
+	}
+
+	preferences, err := loadNotificationPreferences(db, recipientID)
+	if err != nil {
+		return queue.EmailTaskPayload{}, false, fmt.Errorf("load notification preferences: %w", err)
+	}
+	if !preferences.EmailMentions {
+		return queue.EmailTaskPayload{}, false, nil
+	}
+
+	var read models.ChannelRead
+	if err := db.Where("user_id = ? AND channel_id = ?", recipientID, message.ChannelID).First(&read).Error; err == nil {
+		if read.LastReadMessageID >= message.ID {
+			return queue.EmailTaskPayload{}, false, nil
+		}
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return queue.EmailTaskPayload{}, false, fmt.Errorf("load read state: %w", err)
+	}
+
+	if message.Channel.Private {
+		if err := ensureChannelAccess(db, message.Channel, recipientID); err != nil {
+			if errors.Is(err, errChannelAccessRequired) {
+				return queue.EmailTaskPayload{}, false, nil
+			}
+			return queue.EmailTaskPayload{}, false, fmt.Errorf("check channel access: %w", err)
+		}
+	}
+
+	var server models.Server
+	_ = db.Select("id", "name").First(&server, message.Channel.ServerID).Error
+
+	return mentionEmailPayload(recipient, message, message.Channel, server), true, nil
+}
+
+func mentionEmailPayload(recipient models.User, message models.Message, channel models.Channel, server models.Server) queue.EmailTaskPayload {
+	authorName := message.User.Username
+	if strings.TrimSpace(authorName) == "" {
+		authorName = "Someone"
+	}
+
+	location := fmt.Sprintf("#%s", channel.Name)
+	if server.Name != "" {
+		location = fmt.Sprintf("#%s in %s", channel.Name, server.Name)
+	}
+
+	chatURL := buildChatURL()
+	subject := fmt.Sprintf("%s mentioned you in %s", authorName, location)
+	intro := fmt.Sprintf("%s mentioned you in %s on BafaChat.", authorName, location)
+
+	htmlBody := fmt.Sprintf(`<p>%s</p>%s<p><a href="%s" style="background-color:#38bdf8;border-radius:8px;color:#0f172a;padding:10px 16px;text-decoration:none;font-weight:600;">Open BafaChat</a></p><p>— The BafaChat Team</p>`,
+		intro,
+		formatOptionalHTMLMessage(message.Content),
+		chatURL,
+	)
+	textBody := fmt.Sprintf("%s\n\n%s\n\nOpen BafaChat: %s\n\n— The BafaChat Team", intro, message.Content, chatURL)
+
+	return queue.EmailTaskPayload{
+		To:       recipient.Email,
+		Subject:  subject,
+		HTMLBody: htmlBody,
+		TextBody: textBody,
+		Tag:      "message-mention",
+		Meta: map[string]string{
+			"server_id":  fmt.Sprintf("%d", channel.ServerID),
+			"channel_id": fmt.Sprintf("%d", channel.ID),
+			"message_id": fmt.Sprintf("%d", message.ID),
+		},
+	}
+}
+
+func buildChatURL() string {
+	baseURL := strings.TrimSpace(os.Getenv("APP_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultAppBaseURL
+	}
+
+	return fmt.Sprintf("%s/chat", strings.TrimRight(baseURL, "/"))
+}
+
+func serializeMessageMentions(mentions []models.MessageMention) []gin.H {
+	payload := make([]gin.H, 0, len(mentions))
+	for _, mention := range mentions {
+		payload = append(payload, gin.H{
+			"user_id":  mention.UserID,
+			"username": mention.User.Username,
+		})
+	}
+
+	return payload
+}
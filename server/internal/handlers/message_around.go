@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// messageCountTTL is how long a channel's message total is served from cache.
+const messageCountTTL = time.Minute
+
+type cachedMessageCount struct {
+	count     int64
+	expiresAt time.Time
+}
+
+var messageCounts = struct {
+	sync.Mutex
+	entries map[uint]cachedMessageCount
+}{entries: make(map[uint]cachedMessageCount)}
+
+// approximateMessageCount returns the number of unexpired messages in a channel.
+// Counts are cached per channel for messageCountTTL, so they can trail recent
+// activity slightly.
+func approximateMessageCount(db *gorm.DB, channelID uint) (int64, error) {
+	now := time.Now()
+
+	messageCounts.Lock()
+	entry, ok := messageCounts.entries[channelID]
+	messageCounts.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.count, nil
+	}
+
+	var count int64
+	if err := db.Model(&models.Message{}).
+		Scopes(unexpiredMessages).
+		Where("channel_id = ?", channelID).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+
+	messageCounts.Lock()
+	for id, cached := range messageCounts.entries {
+		if now.After(cached.expiresAt) {
+			delete(messageCounts.entries, id)
+		}
+	}
+	messageCounts.entries[channelID] = cachedMessageCount{count: count, expiresAt: now.Add(messageCountTTL)}
+	messageCounts.Unlock()
+
+	return count, nil
+}
+
+// addMessageTotal sets payload["total"] when the request asks for it with
+// include_total=true. It reports false after writing an error response.
+func addMessageTotal(c *gin.Context, db *gorm.DB, channelID uint, payload gin.H) bool {
+	if include, _ := strconv.ParseBool(c.Query("include_total")); !include {
+		return true
+	}
+
+	total, err := approximateMessageCount(db.WithContext(c), channelID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to count messages")
+		return false
+	}
+
+	payload["total"] = total
+	return true
+}
+
+// getMessagesAround answers GetMessages with around=<messageID>: the target and
+// up to limit messages around it, split evenly before and after, in ascending
+// order. before_cursor and after_cursor continue paging in either direction.
+func getMessagesAround(c *gin.Context, db *gorm.DB, channel models.Channel, targetID uint, limit int) {
+	var target models.Message
+	if err := db.WithContext(c).
+		Scopes(unexpiredMessages).
+		Where("id = ? AND channel_id = ?", targetID, channel.ID).
+		First(&target).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeMessageNotFound, "message not found in this channel")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load message")
+		return
+	}
+
+	beforeLimit := (limit - 1) / 2
+	afterLimit := limit - 1 - beforeLimit
+
+	var before []models.Message
+	if err := channelMessages(db.WithContext(c), channel.ID).
+		Where("(created_at, id) < (?, ?)", target.CreatedAt, target.ID).
+		Order("created_at DESC, id DESC").
+		Limit(beforeLimit + 1).
+		Find(&before).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load messages")
+		return
+	}
+
+	var after []models.Message
+	if err := channelMessages(db.WithContext(c), channel.ID).
+		Where("(created_at, id) >= (?, ?)", target.CreatedAt, target.ID).
+		Order("created_at ASC, id ASC").
+		Limit(afterLimit + 2).
+		Find(&after).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load messages")
+		return
+	}
+
+	hasMoreBefore := len(before) > beforeLimit
+	if hasMoreBefore {
+		before = before[:beforeLimit]
+	}
+
+	// after starts with the target itself.
+	hasMoreAfter := len(after) > afterLimit+1
+	if hasMoreAfter {
+		after = after[:afterLimit+1]
+	}
+
+	messages := make([]models.Message, 0, len(before)+len(after))
+	for i := len(before) - 1; i >= 0; i-- {
+		messages = append(messages, before[i])
+	}
+	messages = append(messages, after...)
+
+	applyAuthorNicknames(db.WithContext(c), channel.ID, messages)
+
+	response := make([]gin.H, 0, len(messages))
+	for _, message := range messages {
+		response = append(response, serializeMessage(message))
+	}
+
+	payload := gin.H{
+		"messages":        response,
+		"target_id":       target.ID,
+		"has_more_before": hasMoreBefore,
+		"has_more_after":  hasMoreAfter,
+	}
+
+	if len(messages) > 0 {
+		payload["before_cursor"] = messages[0].CreatedAt.UTC().Format(time.RFC3339)
+		// Sub-second precision keeps messages sharing a second from being refetched.
+		payload["after_cursor"] = messages[len(messages)-1].CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	if !addMessageTotal(c, db, channel.ID, payload) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": payload})
+}
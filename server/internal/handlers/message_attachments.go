@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"cmp"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// normalizeAttachmentPositions orders attachments by their requested position,
+// keeping request order for ties, and renumbers them from 0.
+func normalizeAttachmentPositions(attachments []models.MessageAttachment) {
+	slices.SortStableFunc(attachments, func(a, b models.MessageAttachment) int {
+		return cmp.Compare(a.Position, b.Position)
+	})
+	for index := range attachments {
+		attachments[index].Position = index
+	}
+}
+
+// sortAttachments puts a message's attachments in display order.
+func sortAttachments(attachments []models.MessageAttachment) {
+	slices.SortStableFunc(attachments, func(a, b models.MessageAttachment) int {
+		return cmp.Or(cmp.Compare(a.Position, b.Position), cmp.Compare(a.ID, b.ID))
+	})
+}
+
+// DeleteMessageAttachment lets the author remove one attachment from a sent
+// message. The stored object is deleted once nothing else references it, and
+// message.updated is broadcast with the remaining attachments.
+func DeleteMessageAttachment(c *gin.Context) {
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("messageID"), 10, 64)
+	if err != nil || messageID == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid message id")
+		return
+	}
+
+	attachmentID, err := strconv.ParseUint(c.Param("attachmentID"), 10, 64)
+	if err != nil || attachmentID == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid attachment id")
+		return
+	}
+
+	var message models.Message
+	if err := channelMessages(caller.DB, channel.ID).First(&message, messageID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeMessageNotFound, "message not found in this channel")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load message")
+		return
+	}
+
+	if message.WebhookID != nil || message.UserID != caller.Claims.UserID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodePermissionDenied, "only the author can remove attachments from a message")
+		return
+	}
+
+	index := slices.IndexFunc(message.Attachments, func(attachment models.MessageAttachment) bool {
+		return attachment.ID == uint(attachmentID)
+	})
+	if index < 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeAttachmentNotFound, "attachment not found")
+		return
+	}
+	removed := message.Attachments[index]
+
+	if len(message.Attachments) == 1 && strings.TrimSpace(message.Content) == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeContentRequired, "a message needs content or an attachment; delete the message instead")
+		return
+	}
+
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&removed).Error; err != nil {
+			return err
+		}
+		return releaseServerStorageUsage(tx, []storedObject{{ServerID: channel.ServerID, ObjectKey: removed.ObjectKey, FileSize: removed.FileSize}})
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to remove attachment")
+		return
+	}
+
+	objectKeys := []string{removed.ObjectKey}
+	if removed.PreviewObjectKey != "" {
+		objectKeys = append(objectKeys, removed.PreviewObjectKey)
+	}
+
+	objectKeys, err = unreferencedObjectKeys(caller.DB, objectKeys)
+	if err != nil {
+		requestLogger(c).Warn("failed to check removed attachment object references", "attachment_id", removed.ID, "error", err)
+		objectKeys = nil
+	}
+
+	if storageService, ok := getStorageService(c); ok && len(objectKeys) > 0 {
+		if err := storageService.DeleteObjects(c.Request.Context(), objectKeys); err != nil {
+			requestLogger(c).Warn("failed to delete removed attachment objects", "attachment_id", removed.ID, "error", err)
+		}
+	}
+
+	message.Attachments = slices.Delete(message.Attachments, index, index+1)
+	applyAuthorNickname(caller.DB, &message)
+	serialized := serializeMessage(message)
+
+	publishToChannel(c, caller.DB, channel, websocket.MessageUpdated(serialized, channel.ID, channel.ServerID))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Attachment removed",
+		"data": gin.H{
+			"message": serialized,
+		},
+	})
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+
+	"bafachat/internal/models"
+)
+
+func attachmentNames(attachments []models.MessageAttachment) []string {
+	names := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		names[i] = attachment.FileName
+	}
+	return names
+}
+
+func TestNormalizeAttachmentPositions(t *testing.T) {
+	attachments := []models.MessageAttachment{
+		{FileName: "c", Position: 5},
+		{FileName: "a", Position: -1},
+		{FileName: "b1", Position: 2},
+		{FileName: "b2", Position: 2},
+	}
+
+	normalizeAttachmentPositions(attachments)
+
+	want := []string{"a", "b1", "b2", "c"}
+	for i, attachment := range attachments {
+		if attachment.FileName != want[i] || attachment.Position != i {
+			t.Fatalf("attachments = %v, want names %v with positions 0..3", attachmentNames(attachments), want)
+		}
+	}
+}
+
+func TestSortAttachments(t *testing.T) {
+	attachments := []models.MessageAttachment{
+		{ID: 9, FileName: "late", Position: 1},
+		{ID: 4, FileName: "second", Position: 0},
+		{ID: 2, FileName: "first", Position: 0},
+	}
+
+	sortAttachments(attachments)
+
+	got := attachmentNames(attachments)
+	want := []string{"first", "second", "late"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sortAttachments order = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// enforceMessageRateLimit takes a token from the sender's bucket for the channel
+// and sets the X-RateLimit headers. When the bucket is empty it writes a 429
+// response with Retry-After and returns false. Unlike slowmode this applies to
+// everyone, owners and webhooks included. Without Redis, or when Redis fails,
+// messages are let through.
+func enforceMessageRateLimit(c *gin.Context, channelID uint, sender string) bool {
+	limiter, bucket, ok := getMessageRateLimiter(c)
+	if !ok || !bucket.Enabled() {
+		return true
+	}
+
+	result, err := limiter.Take(c.Request.Context(), fmt.Sprintf("message:%d:%s", channelID, sender), bucket)
+	if err != nil {
+		requestLogger(c).Warn("message rate limit check failed", "channel_id", channelID, "error", err)
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(bucket.Capacity))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+
+	if result.Allowed {
+		return true
+	}
+
+	seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apierror.RespondWithDetails(c, http.StatusTooManyRequests, apierror.CodeRateLimited,
+		"you are sending messages too quickly; please slow down",
+		gin.H{"retry_after": seconds},
+	)
+	return false
+}
+
+func getMessageRateLimiter(c *gin.Context) (*middleware.RateLimiter, middleware.TokenBucket, bool) {
+	value, exists := c.Get("rateLimiter")
+	if !exists {
+		return nil, middleware.TokenBucket{}, false
+	}
+
+	limiter, ok := value.(*middleware.RateLimiter)
+	if !ok {
+		requestLogger(c).Error("invalid rate limiter type")
+		return nil, middleware.TokenBucket{}, false
+	}
+
+	bucket, ok := c.Get("messageRateLimit")
+	if !ok {
+		return nil, middleware.TokenBucket{}, false
+	}
+
+	config, ok := bucket.(middleware.TokenBucket)
+	if !ok {
+		requestLogger(c).Error("invalid message rate limit type")
+		return nil, middleware.TokenBucket{}, false
+	}
+
+	return limiter, config, true
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"bafachat/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestEnforceMessageRateLimitLetsMessagesThrough(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	unreachable := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { _ = unreachable.Close() })
+
+	tests := []struct {
+		name    string
+		limiter *middleware.RateLimiter
+		bucket  *middleware.TokenBucket
+	}{
+		{name: "no limiter"},
+		{name: "limiter without bucket", limiter: middleware.NewRateLimiter(unreachable)},
+		{name: "disabled bucket", limiter: middleware.NewRateLimiter(unreachable), bucket: &middleware.TokenBucket{Capacity: 0, Refill: time.Second}},
+		{name: "redis unavailable", limiter: middleware.NewRateLimiter(unreachable), bucket: &middleware.TokenBucket{Capacity: 1, Refill: time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/channels/1/messages", nil)
+			if tt.limiter != nil {
+				c.Set("rateLimiter", tt.limiter)
+			}
+			if tt.bucket != nil {
+				c.Set("messageRateLimit", *tt.bucket)
+			}
+
+			if !enforceMessageRateLimit(c, 1, "user:2") {
+				t.Fatal("enforceMessageRateLimit rejected the message")
+			}
+			if c.Writer.Written() {
+				t.Fatalf("response was written with status %d", w.Code)
+			}
+			if got := w.Header().Get("X-RateLimit-Limit"); got != "" {
+				t.Fatalf("X-RateLimit-Limit = %q, want it unset", got)
+			}
+		})
+	}
+}
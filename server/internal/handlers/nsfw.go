@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errNSFWAcknowledgmentRequired = errors.New("this channel is marked NSFW; confirm you want to view it first")
+
+// ensureNSFWAcknowledged requires that the user has confirmed the warning of an NSFW
+// channel. Other channels always pass.
+func ensureNSFWAcknowledged(db *gorm.DB, channel models.Channel, userID uint) error {
+	if !channel.NSFW {
+		return nil
+	}
+
+	var count int64
+	if err := db.Model(&models.NSFWAcknowledgment{}).
+		Where("user_id = ? AND channel_id = ?", userID, channel.ID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return errNSFWAcknowledgmentRequired
+	}
+
+	return nil
+}
+
+// respondNSFWError writes the response for an error from ensureNSFWAcknowledged.
+func respondNSFWError(c *gin.Context, err error) {
+	if errors.Is(err, errNSFWAcknowledgmentRequired) {
+		respondError(c, http.StatusForbidden, err)
+		return
+	}
+
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to check NSFW acknowledgment")
+}
+
+// AcknowledgeNSFWChannel records that the caller wants to see an NSFW channel, so
+// its messages are returned from then on without asking again.
+func AcknowledgeNSFWChannel(c *gin.Context) {
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	acknowledgment := models.NSFWAcknowledgment{
+		UserID:    caller.Claims.UserID,
+		ChannelID: channel.ID,
+	}
+	if err := caller.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&acknowledgment).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to save NSFW acknowledgment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "NSFW channel acknowledged",
+		"data": gin.H{
+			"channel_id":   channel.ID,
+			"acknowledged": true,
+		},
+	})
+}
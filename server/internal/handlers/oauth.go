@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+	"bafachat/internal/oauth"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	oauthStateTTL    = 10 * time.Minute
+
+	oauthUsernameMaxLength = 32
+	oauthUsernameAttempts  = 5
+)
+
+var errOAuthUsernameUnavailable = errors.New("could not find a free username")
+
+// StartOAuth redirects the browser to the provider's consent page. A random state
+// is kept in a short-lived cookie and checked again on the callback.
+func StartOAuth(c *gin.Context) {
+	provider, err := oauth.ProviderFromEnv(c.Param("provider"))
+	if err != nil {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeOAuthProviderUnknown, "oauth provider is not enabled")
+		return
+	}
+
+	state, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to start oauth login")
+		return
+	}
+
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     oauthCallbackPath(provider.Name),
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, oauthRedirectURL(c, provider.Name)))
+}
+
+// OAuthCallback exchanges the authorization code, finds or creates the matching
+// user and hands the app a JWT in the URL fragment of its /oauth/callback page.
+// Users with 2FA get a challenge token instead, to finish with POST /auth/2fa.
+func OAuthCallback(c *gin.Context) {
+	provider, err := oauth.ProviderFromEnv(c.Param("provider"))
+	if err != nil {
+		redirectOAuthError(c, apierror.CodeOAuthProviderUnknown)
+		return
+	}
+
+	expectedState, _ := c.Cookie(oauthStateCookie)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oauthStateCookie,
+		Path:     oauthCallbackPath(provider.Name),
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	if expectedState == "" || c.Query("state") != expectedState {
+		redirectOAuthError(c, apierror.CodeOAuthStateMismatch)
+		return
+	}
+
+	code := strings.TrimSpace(c.Query("code"))
+	if code == "" {
+		// The user declined consent or the provider reported an error.
+		redirectOAuthError(c, apierror.CodeOAuthFailed)
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		redirectOAuthError(c, apierror.CodeInternal)
+		return
+	}
+
+	profile, err := provider.Exchange(c, code, oauthRedirectURL(c, provider.Name))
+	if err != nil {
+		if errors.Is(err, oauth.ErrNoVerifiedEmail) {
+			redirectOAuthError(c, apierror.CodeOAuthEmailUnverified)
+			return
+		}
+		requestLogger(c).Warn("oauth exchange failed", "provider", provider.Name, "error", err)
+		redirectOAuthError(c, apierror.CodeOAuthFailed)
+		return
+	}
+
+	user, err := resolveOAuthUser(c, db, provider.Name, profile)
+	if err != nil {
+		requestLogger(c).Error("failed to resolve oauth user", "provider", provider.Name, "error", err)
+		redirectOAuthError(c, apierror.CodeOAuthFailed)
+		return
+	}
+
+	fragment := url.Values{}
+	if user.TwoFactorEnabledAt != nil {
+		token, expiresAt, err := createTwoFactorChallenge(c, db, user)
+		if err != nil {
+			redirectOAuthError(c, apierror.CodeInternal)
+			return
+		}
+		fragment.Set("challenge_token", token)
+		fragment.Set("expires_at", expiresAt.Format(time.RFC3339))
+	} else {
+		token, expiresAt, err := issueSession(c, db, &user)
+		if err != nil {
+			redirectOAuthError(c, apierror.CodeInternal)
+			return
+		}
+		fragment.Set("token", token)
+		fragment.Set("expires_at", expiresAt.Format(time.RFC3339))
+	}
+
+	c.Redirect(http.StatusFound, appBaseURL()+"/oauth/callback#"+fragment.Encode())
+}
+
+// resolveOAuthUser returns the user linked to the provider account. Without a link,
+// an existing account with the same email is linked, since the provider has
+// verified it; otherwise a new, already verified account is created. An existing
+// account that never verified its email may have been registered by someone else,
+// so its credentials are reset before the link is made.
+func resolveOAuthUser(c *gin.Context, db *gorm.DB, provider string, profile oauth.Profile) (models.User, error) {
+	var user models.User
+
+	err := db.WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var identity models.OAuthIdentity
+		err := tx.Where("provider = ? AND external_id = ?", provider, profile.ExternalID).First(&identity).Error
+		if err == nil {
+			if err := tx.First(&user, identity.UserID).Error; err != nil {
+				return err
+			}
+			if identity.Email != profile.Email {
+				return tx.Model(&identity).Update("email", profile.Email).Error
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		err = tx.Where("LOWER(email) = ?", strings.ToLower(profile.Email)).First(&user).Error
+		switch {
+		case err == nil:
+			if user.EmailVerifiedAt == nil {
+				if err := claimUnverifiedAccount(tx, &user); err != nil {
+					return err
+				}
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			created, err := createOAuthUser(tx, profile)
+			if err != nil {
+				return err
+			}
+			user = created
+		default:
+			return err
+		}
+
+		return tx.Create(&models.OAuthIdentity{
+			UserID:     user.ID,
+			Provider:   provider,
+			ExternalID: profile.ExternalID,
+			Email:      profile.Email,
+		}).Error
+	})
+
+	return user, err
+}
+
+// claimUnverifiedAccount hands an account whose email was never verified to the
+// provider account that has proven the email. Whoever chose the password never
+// did, so the password is replaced and their sessions, API tokens, 2FA and other
+// sign-in methods are revoked.
+func claimUnverifiedAccount(tx *gorm.DB, user *models.User) error {
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := tx.Model(user).Updates(map[string]any{
+		"password":                   hashedPassword,
+		"email_verified_at":          now,
+		"email_verification_token":   "",
+		"email_verification_sent_at": nil,
+		"two_factor_secret":          "",
+		"two_factor_enabled_at":      nil,
+	}).Error; err != nil {
+		return err
+	}
+	user.Password = hashedPassword
+	user.EmailVerifiedAt = &now
+	user.TwoFactorSecret = ""
+	user.TwoFactorEnabledAt = nil
+
+	for _, model := range []interface{}{&models.Session{}, &models.APIToken{}} {
+		if err := tx.Model(model).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+	}
+
+	for _, model := range []interface{}{
+		&models.TwoFactorBackupCode{},
+		&models.TwoFactorChallenge{},
+		&models.OAuthIdentity{},
+		&models.PushSubscription{},
+	} {
+		if err := tx.Where("user_id = ?", user.ID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// randomPasswordHash hashes a random secret that is never shown, for accounts
+// that can only sign in through a linked provider.
+func randomPasswordHash() (string, error) {
+	secret, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	return auth.HashPassword(secret)
+}
+
+// createOAuthUser registers a user for a provider profile. The password is random
+// and never shown, so the account can only sign in through a linked provider.
+func createOAuthUser(tx *gorm.DB, profile oauth.Profile) (models.User, error) {
+	username, err := availableOAuthUsername(tx, profile)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	hashedPassword, err := randomPasswordHash()
+	if err != nil {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		Username:        username,
+		Email:           profile.Email,
+		Password:        hashedPassword,
+		EmailVerifiedAt: &now,
+	}
+
+	if err := tx.Create(&user).Error; err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// availableOAuthUsername derives a username from the provider profile, adding a
+// random suffix when the plain name is reserved or already taken.
+func availableOAuthUsername(tx *gorm.DB, profile oauth.Profile) (string, error) {
+	base := sanitizeOAuthUsername(profile.Username)
+	if len(base) < 3 {
+		base = sanitizeOAuthUsername(strings.Split(profile.Email, "@")[0])
+	}
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	candidate := base
+	for attempt := 0; attempt < oauthUsernameAttempts; attempt++ {
+		if attempt > 0 {
+			suffix, err := auth.GenerateRandomToken(2)
+			if err != nil {
+				return "", err
+			}
+			suffix = "_" + suffix
+			candidate = truncateUsername(base, oauthUsernameMaxLength-len(suffix)) + suffix
+		}
+
+		err := ensureUniqueUser(tx, candidate, profile.Email)
+		if err == nil {
+			return candidate, nil
+		}
+		if !errors.Is(err, errUserConflict) && !errors.Is(err, errUsernameReserved) {
+			return "", err
+		}
+	}
+
+	return "", errOAuthUsernameUnavailable
+}
+
+// sanitizeOAuthUsername keeps letters, digits, dots, dashes and underscores, turning
+// spaces into underscores.
+func sanitizeOAuthUsername(name string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(name) {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)), r == '_', r == '-', r == '.':
+			b.WriteRune(r)
+		case unicode.IsSpace(r):
+			b.WriteRune('_')
+		}
+	}
+
+	return truncateUsername(b.String(), oauthUsernameMaxLength)
+}
+
+func truncateUsername(name string, max int) string {
+	if len(name) > max {
+		return name[:max]
+	}
+	return name
+}
+
+// oauthRedirectURL is the callback URL registered with the provider. It defaults to
+// the host the request came in on; set OAUTH_REDIRECT_BASE_URL when the API is
+// reached through a proxy that rewrites the host.
+func oauthRedirectURL(c *gin.Context, provider string) string {
+	base := strings.TrimSpace(os.Getenv("OAUTH_REDIRECT_BASE_URL"))
+	if base == "" {
+		base = requestBaseURL(c)
+	}
+
+	return strings.TrimRight(base, "/") + oauthCallbackPath(provider)
+}
+
+func oauthCallbackPath(provider string) string {
+	return fmt.Sprintf("/api/v1/auth/oauth/%s/callback", provider)
+}
+
+func redirectOAuthError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, appBaseURL()+"/?oauth_error="+url.QueryEscape(code))
+}
+
+func appBaseURL() string {
+	baseURL := strings.TrimSpace(os.Getenv("APP_BASE_URL"))
+	if baseURL == "" {
+		baseURL = defaultAppBaseURL
+	}
+
+	return strings.TrimRight(baseURL, "/")
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSanitizeOAuthUsername(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "octocat", want: "octocat"},
+		{name: "spaces become underscores", in: " Jane Doe ", want: "Jane_Doe"},
+		{name: "drops symbols and non-ascii", in: "jané!@#.d-o_e", want: "jan.d-o_e"},
+		{name: "truncated", in: "abcdefghijklmnopqrstuvwxyz0123456789", want: "abcdefghijklmnopqrstuvwxyz012345"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeOAuthUsername(tt.in); got != tt.want {
+				t.Fatalf("sanitizeOAuthUsername(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectOAuthErrorTargetsLoginPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("APP_BASE_URL", "https://chat.example.com/")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/auth/oauth/github/callback", nil)
+
+	redirectOAuthError(c, "oauth_failed")
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if got, want := w.Header().Get("Location"), "https://chat.example.com/?oauth_error=oauth_failed"; got != want {
+		t.Fatalf("Location = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/models"
+	"bafachat/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOrphanUploadGracePeriod = 24 * time.Hour
+	orphanUploadBatchSize          = 500
+)
+
+type orphanUploadPolicy struct {
+	Enabled     bool
+	GracePeriod time.Duration
+}
+
+// orphanUploadPolicyFromEnv reads ORPHAN_UPLOAD_CLEANUP (default on) and
+// ORPHAN_UPLOAD_GRACE_PERIOD, how long a presigned upload may go unused.
+func orphanUploadPolicyFromEnv() orphanUploadPolicy {
+	policy := orphanUploadPolicy{
+		Enabled:     true,
+		GracePeriod: defaultOrphanUploadGracePeriod,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ORPHAN_UPLOAD_CLEANUP")); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err == nil {
+			policy.Enabled = enabled
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("ORPHAN_UPLOAD_GRACE_PERIOD")); raw != "" {
+		if value, err := time.ParseDuration(raw); err == nil && value > 0 {
+			policy.GracePeriod = value
+		}
+	}
+
+	return policy
+}
+
+// recordUploadIntents remembers the objects presigned for a user so the cleanup
+// job can delete any that never make it into a message.
+func recordUploadIntents(db *gorm.DB, userID, channelID uint, signatures []*storage.UploadSignature, fileSizes []int64) error {
+	intents := make([]models.UploadIntent, 0, len(signatures))
+	for index, signature := range signatures {
+		intents = append(intents, models.UploadIntent{
+			ObjectKey: signature.ObjectKey,
+			UserID:    userID,
+			ChannelID: channelID,
+			FileSize:  fileSizes[index],
+		})
+	}
+	if len(intents) == 0 {
+		return nil
+	}
+
+	return db.Create(&intents).Error
+}
+
+// consumeUploadIntents drops the intents for objects a message now references.
+func consumeUploadIntents(tx *gorm.DB, attachments []models.MessageAttachment) error {
+	keys := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		keys = append(keys, attachment.ObjectKey)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return tx.Where("object_key IN ?", keys).Delete(&models.UploadIntent{}).Error
+}
+
+// SweepOrphanedUploads deletes objects that were presigned longer ago than the
+// grace period but never attached to a message. It returns how many objects were
+// removed and how many bytes they held. It does nothing when cleanup is disabled.
+func SweepOrphanedUploads(ctx context.Context, db *gorm.DB, storageService *storage.Service) (int, int64, error) {
+	policy := orphanUploadPolicyFromEnv()
+	if !policy.Enabled || storageService == nil {
+		return 0, 0, nil
+	}
+
+	cutoff := time.Now().Add(-policy.GracePeriod)
+	removed := 0
+	var reclaimed int64
+
+	for {
+		var intents []models.UploadIntent
+		if err := db.WithContext(ctx).
+			Where("created_at <= ?", cutoff).
+			Order("id ASC").
+			Limit(orphanUploadBatchSize).
+			Find(&intents).Error; err != nil {
+			return removed, reclaimed, fmt.Errorf("load upload intents: %w", err)
+		}
+
+		if len(intents) == 0 {
+			return removed, reclaimed, nil
+		}
+
+		ids := make([]uint, 0, len(intents))
+		keys := make([]string, 0, len(intents))
+		for _, intent := range intents {
+			ids = append(ids, intent.ID)
+			keys = append(keys, intent.ObjectKey)
+		}
+
+		orphaned, err := unreferencedObjectKeys(db.WithContext(ctx), keys)
+		if err != nil {
+			return removed, reclaimed, fmt.Errorf("check upload references: %w", err)
+		}
+
+		// Clients that abandon the flow often never upload at all, so objects that
+		// do not exist are skipped.
+		existing := make([]string, 0, len(orphaned))
+		var batchBytes int64
+		for _, key := range orphaned {
+			info, err := storageService.StatObject(ctx, key)
+			switch {
+			case errors.Is(err, storage.ErrObjectNotFound):
+				continue
+			case err != nil:
+				slog.Warn("failed to stat orphaned upload", "object_key", key, "error", err)
+			default:
+				batchBytes += info.Size
+			}
+			existing = append(existing, key)
+		}
+
+		if len(existing) > 0 {
+			if err := storageService.DeleteObjects(ctx, existing); err != nil {
+				return removed, reclaimed, fmt.Errorf("delete orphaned uploads: %w", err)
+			}
+			removed += len(existing)
+			reclaimed += batchBytes
+		}
+
+		if err := db.WithContext(ctx).Where("id IN ?", ids).Delete(&models.UploadIntent{}).Error; err != nil {
+			return removed, reclaimed, fmt.Errorf("delete upload intents: %w", err)
+		}
+
+		if len(intents) < orphanUploadBatchSize {
+			return removed, reclaimed, nil
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var errServerPermissionRequired = errors.New("you do not have permission to perform this action")
+
+// rolePermissions lists the permissions granted to each non-owner role. Owners
+// implicitly hold every permission.
+var rolePermissions = map[string]map[string]bool{
+	models.ServerRoleAdmin: {
+		models.PermissionManageChannels: true,
+		models.PermissionManageMembers:  true,
+		models.PermissionManageInvites:  true,
+		models.PermissionDeleteMessages: true,
+		models.PermissionManageEmojis:   true,
+	},
+	models.ServerRoleMember: {},
+}
+
+// assignableServerRoles are the roles an owner may grant through the role endpoint.
+var assignableServerRoles = map[string]bool{
+	models.ServerRoleAdmin:  true,
+	models.ServerRoleMember: true,
+}
+
+func roleHasPermission(role, permission string) bool {
+	if role == models.ServerRoleOwner {
+		return true
+	}
+
+	return rolePermissions[role][permission]
+}
+
+// hasPermission reports whether the user's role in the server grants the permission.
+// It returns errServerMembershipRequired when the user is not a member.
+func hasPermission(db *gorm.DB, serverID, userID uint, permission string) (bool, error) {
+	var membership models.ServerMember
+	if err := db.Where("server_id = ? AND user_id = ?", serverID, userID).First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, errServerMembershipRequired
+		}
+		return false, err
+	}
+
+	return roleHasPermission(membership.Role, permission), nil
+}
+
+// requirePermission returns errServerPermissionRequired when the user lacks the permission.
+func requirePermission(db *gorm.DB, serverID, userID uint, permission string) error {
+	allowed, err := hasPermission(db, serverID, userID, permission)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return errServerPermissionRequired
+	}
+
+	return nil
+}
+
+// canModerateMember reports whether an actor with actorRole may act on a member with targetRole.
+// Owners can never be moderated, and only owners may moderate admins.
+func canModerateMember(actorRole, targetRole string) bool {
+	if targetRole == models.ServerRoleOwner {
+		return false
+	}
+
+	if targetRole == models.ServerRoleAdmin {
+		return actorRole == models.ServerRoleOwner
+	}
+
+	return true
+}
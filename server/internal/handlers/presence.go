@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type serverPresenceRow struct {
+	UserID      uint
+	Username    string
+	LastLoginAt *time.Time
+	LastSeenAt  *time.Time
+}
+
+// GetServerPresence reports each member's presence status as other users see it,
+// so invisible members are listed as offline.
+// Offline members include when they were last connected, or their last login
+// when that has not been recorded yet.
+func GetServerPresence(c *gin.Context) {
+	hub, ok := getWebSocketHub(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "websocket hub unavailable")
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var rows []serverPresenceRow
+	if err := caller.DB.
+		Model(&models.ServerMember{}).
+		Select("server_members.user_id, users.username, users.last_login_at, users.last_seen_at").
+		Joins("JOIN users ON users.id = server_members.user_id").
+		Where("server_members.server_id = ? AND server_members.role <> ?", serverID, models.ServerRolePending).
+		Order("server_members.user_id ASC").
+		Scan(&rows).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load members")
+		return
+	}
+
+	presence := make([]gin.H, 0, len(rows))
+	online := 0
+	for _, row := range rows {
+		entry := gin.H{
+			"user_id":  row.UserID,
+			"username": row.Username,
+			"status":   models.PresenceStatusOffline,
+		}
+
+		if status := hub.PresenceStatus(row.UserID); status != models.PresenceStatusOffline {
+			entry["status"] = status
+			online++
+		} else if row.LastSeenAt != nil {
+			entry["last_seen_at"] = row.LastSeenAt.Format(time.RFC3339)
+		} else if row.LastLoginAt != nil {
+			entry["last_seen_at"] = row.LastLoginAt.Format(time.RFC3339)
+		}
+
+		presence = append(presence, entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"presence":     presence,
+			"online_count": online,
+		},
+	})
+}
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/logging"
+	"bafachat/internal/models"
+	"bafachat/internal/push"
+	"bafachat/internal/queue"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxPushBodyLength keeps notification bodies short enough for lock screens
+	// and well inside the Web Push payload limit.
+	maxPushBodyLength = 140
+
+	// pushDeliveryTimeout bounds a push sent without the queue.
+	pushDeliveryTimeout = 30 * time.Second
+)
+
+// CreatePushSubscription registers the current device for push notifications. Subscribing
+// an endpoint that is already registered updates its keys and moves it to the current user.
+func CreatePushSubscription(c *gin.Context) {
+	var req models.CreatePushSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	platform := req.Platform
+	if platform == "" {
+		platform = push.PlatformWeb
+	}
+
+	dispatcher, ok := getPushDispatcher(c)
+	if !ok || !dispatcher.Supports(platform) {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodePushDisabled, "push notifications are not configured")
+		return
+	}
+
+	subscription := models.PushSubscription{
+		UserID:    caller.Claims.UserID,
+		Platform:  platform,
+		Endpoint:  strings.TrimSpace(req.Endpoint),
+		P256dh:    strings.TrimSpace(req.Keys.P256dh),
+		Auth:      strings.TrimSpace(req.Keys.Auth),
+		UserAgent: truncateString(c.Request.UserAgent(), 512),
+	}
+
+	if err := caller.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "endpoint"}},
+		DoUpdates: clause.AssignmentColumns([]string{"user_id", "platform", "p256dh", "auth", "user_agent"}),
+	}).Create(&subscription).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to save push subscription")
+		return
+	}
+
+	if err := caller.DB.Where("endpoint = ?", subscription.Endpoint).First(&subscription).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load push subscription")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Push subscription saved",
+		"data": gin.H{
+			"subscription": serializePushSubscription(subscription),
+		},
+	})
+}
+
+// DeletePushSubscription unregisters one of the current user's devices, typically on logout.
+func DeletePushSubscription(c *gin.Context) {
+	var req models.DeletePushSubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	result := caller.DB.
+		Where("user_id = ? AND endpoint = ?", caller.Claims.UserID, strings.TrimSpace(req.Endpoint)).
+		Delete(&models.PushSubscription{})
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to delete push subscription")
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodePushSubscriptionNotFound, "push subscription not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetNotificationPreferences returns how the current user is notified about mentions while offline.
+func GetNotificationPreferences(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	preferences, err := loadNotificationPreferences(caller.DB, caller.Claims.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load notification preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"preferences": serializeNotificationPreferences(preferences),
+		},
+	})
+}
+
+// UpdateNotificationPreferences changes the current user's mention notification settings.
+func UpdateNotificationPreferences(c *gin.Context) {
+	var req models.UpdateNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	preferences, err := loadNotificationPreferences(caller.DB, caller.Claims.UserID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load notification preferences")
+		return
+	}
+
+	if req.PushMentions != nil {
+		preferences.PushMentions = *req.PushMentions
+	}
+	if req.EmailMentions != nil {
+		preferences.EmailMentions = *req.EmailMentions
+	}
+
+	if err := caller.DB.Save(&preferences).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update notification preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notification preferences updated",
+		"data": gin.H{
+			"preferences": serializeNotificationPreferences(preferences),
+		},
+	})
+}
+
+// loadNotificationPreferences returns the user's saved preferences, or the defaults if they have none.
+func loadNotificationPreferences(db *gorm.DB, userID uint) (models.NotificationPreference, error) {
+	var preferences models.NotificationPreference
+	if err := db.Where("user_id = ?", userID).First(&preferences).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.DefaultNotificationPreference(userID), nil
+		}
+		return preferences, err
+	}
+
+	return preferences, nil
+}
+
+// sendMentionPush notifies each of the recipient's devices about a mention. Deliveries are
+// queued one task per device; without a queue they are sent in the background.
+func sendMentionPush(c *gin.Context, db *gorm.DB, recipientID uint, message models.Message, channel models.Channel, server models.Server) {
+	dispatcher, ok := getPushDispatcher(c)
+	if !ok {
+		return
+	}
+
+	var subscriptions []models.PushSubscription
+	if err := db.Where("user_id = ?", recipientID).Find(&subscriptions).Error; err != nil {
+		requestLogger(c).Warn("failed to load push subscriptions", "user_id", recipientID, "error", err)
+		return
+	}
+
+	if len(subscriptions) == 0 {
+		return
+	}
+
+	notification := mentionNotification(message, channel, server)
+	queueClient, hasQueue := getQueueClient(c)
+	requestCtx := context.WithoutCancel(c.Request.Context())
+	requestID := logging.RequestID(requestCtx)
+
+	for _, subscription := range subscriptions {
+		if !dispatcher.Supports(subscription.Platform) {
+			continue
+		}
+
+		if hasQueue {
+			task, err := queue.NewPushTask(queue.PushTaskPayload{
+				SubscriptionID: subscription.ID,
+				Notification:   notification,
+				RequestID:      requestID,
+			})
+			if err != nil {
+				continue
+			}
+			if _, err := queueClient.Enqueue(task); err != nil {
+				requestLogger(c).Warn("failed to queue push notification", "subscription_id", subscription.ID, "error", err)
+			}
+			continue
+		}
+
+		go func(subscription models.PushSubscription) {
+			ctx, cancel := context.WithTimeout(requestCtx, pushDeliveryTimeout)
+			defer cancel()
+
+			if err := deliverPush(ctx, db, dispatcher, subscription, notification); err != nil {
+				logging.FromContext(ctx).Warn("failed to send push notification", "subscription_id", subscription.ID, "error", err)
+			}
+		}(subscription)
+	}
+}
+
+// NewPushProcessor returns the queue processor that delivers push notifications.
+func NewPushProcessor(db *gorm.DB, dispatcher *push.Dispatcher) queue.PushProcessor {
+	return func(ctx context.Context, payload queue.PushTaskPayload) error {
+		var subscription models.PushSubscription
+		if err := db.WithContext(ctx).First(&subscription, payload.SubscriptionID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return fmt.Errorf("load push subscription: %w", err)
+		}
+
+		return deliverPush(ctx, db, dispatcher, subscription, payload.Notification)
+	}
+}
+
+// deliverPush sends a notification to one subscription, deleting the subscription
+// when the push service reports it has expired.
+func deliverPush(ctx context.Context, db *gorm.DB, dispatcher *push.Dispatcher, subscription models.PushSubscription, notification push.Notification) error {
+	err := dispatcher.Send(ctx, push.Subscription{
+		Platform: subscription.Platform,
+		Endpoint: subscription.Endpoint,
+		P256dh:   subscription.P256dh,
+		Auth:     subscription.Auth,
+	}, notification)
+
+	if errors.Is(err, push.ErrSubscriptionGone) {
+		if deleteErr := db.WithContext(ctx).Delete(&models.PushSubscription{}, subscription.ID).Error; deleteErr != nil {
+			return fmt.Errorf("delete expired push subscription: %w", deleteErr)
+		}
+		logging.FromContext(ctx).Info("removed expired push subscription", "subscription_id", subscription.ID, "user_id", subscription.UserID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	_ = db.WithContext(ctx).Model(&models.PushSubscription{}).
+		Where("id = ?", subscription.ID).
+		Update("last_used_at", now).Error
+
+	return nil
+}
+
+func mentionNotification(message models.Message, channel models.Channel, server models.Server) push.Notification {
+	authorName := message.User.Username
+	if strings.TrimSpace(authorName) == "" {
+		authorName = "Someone"
+	}
+
+	title := fmt.Sprintf("%s mentioned you in #%s", authorName, channel.Name)
+	if server.Name != "" {
+		title = fmt.Sprintf("%s mentioned you in #%s (%s)", authorName, channel.Name, server.Name)
+	}
+
+	return push.Notification{
+		Title: title,
+		Body:  truncateString(message.Content, maxPushBodyLength),
+		URL:   buildChatURL(),
+		Tag:   fmt.Sprintf("mention-%d", message.ID),
+		Data: map[string]any{
+			"server_id":  channel.ServerID,
+			"channel_id": channel.ID,
+			"message_id": message.ID,
+		},
+	}
+}
+
+// truncateString shortens value to at most limit runes, marking the cut with an ellipsis.
+func truncateString(value string, limit int) string {
+	value = strings.TrimSpace(value)
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+
+	runes := []rune(value)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
+
+func serializePushSubscription(subscription models.PushSubscription) gin.H {
+	var lastUsedAt string
+	if subscription.LastUsedAt != nil {
+		lastUsedAt = subscription.LastUsedAt.Format(time.RFC3339)
+	}
+
+	return gin.H{
+		"id":           subscription.ID,
+		"platform":     subscription.Platform,
+		"endpoint":     subscription.Endpoint,
+		"user_agent":   subscription.UserAgent,
+		"created_at":   subscription.CreatedAt.Format(time.RFC3339),
+		"last_used_at": lastUsedAt,
+	}
+}
+
+func serializeNotificationPreferences(preferences models.NotificationPreference) gin.H {
+	return gin.H{
+		"push_mentions":  preferences.PushMentions,
+		"email_mentions": preferences.EmailMentions,
+	}
+}
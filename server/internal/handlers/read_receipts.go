@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultReadReceiptMaxMembers = 10
+
+type channelReceiptRow struct {
+	UserID            uint
+	LastReadMessageID uint
+	LastReadAt        time.Time
+}
+
+// readReceiptMaxMembersFromEnv reads READ_RECEIPT_MAX_MEMBERS, the most users that
+// may see a channel for read receipts to be tracked in it. Larger channels get
+// none, so marking a channel read never costs work per member.
+func readReceiptMaxMembersFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("READ_RECEIPT_MAX_MEMBERS"))
+	if raw == "" {
+		return defaultReadReceiptMaxMembers
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return defaultReadReceiptMaxMembers
+	}
+
+	return value
+}
+
+// receiptAudience returns the users who can see the channel, or false when there
+// are too many of them for read receipts.
+func receiptAudience(db *gorm.DB, channel models.Channel) ([]uint, bool, error) {
+	limit := readReceiptMaxMembersFromEnv()
+	if limit == 0 {
+		return nil, false, nil
+	}
+
+	var audience []uint
+	if channel.Private {
+		members, err := channelAudience(db, channel)
+		if err != nil {
+			return nil, false, err
+		}
+		audience = members
+	} else if err := db.Model(&models.ServerMember{}).
+		Where("server_id = ? AND role <> ?", channel.ServerID, models.ServerRolePending).
+		Limit(limit+1).
+		Pluck("user_id", &audience).Error; err != nil {
+		return nil, false, err
+	}
+
+	if len(audience) > limit {
+		return nil, false, nil
+	}
+
+	return audience, true, nil
+}
+
+// publishReadReceipt sends receipt.updated to the other users who can see a small
+// channel after the reader marks it read, unless the reader has turned receipts off.
+func publishReadReceipt(c *gin.Context, db *gorm.DB, channel models.Channel, read models.ChannelRead) {
+	hub, ok := getWebSocketHub(c)
+	if !ok || read.LastReadMessageID == 0 {
+		return
+	}
+
+	var reader models.User
+	if err := db.Select("id", "read_receipts_enabled").First(&reader, read.UserID).Error; err != nil {
+		requestLogger(c).Warn("failed to load read receipt setting", "user_id", read.UserID, "error", err)
+		return
+	}
+	if !reader.ReadReceiptsEnabled {
+		return
+	}
+
+	audience, ok, err := receiptAudience(db, channel)
+	if err != nil {
+		requestLogger(c).Warn("failed to load read receipt audience", "channel_id", channel.ID, "error", err)
+		return
+	}
+	if !ok {
+		return
+	}
+
+	event := websocket.NewEvent(websocket.EventReceiptUpdated, gin.H{
+		"channel_id":           channel.ID,
+		"server_id":            channel.ServerID,
+		"user_id":              read.UserID,
+		"last_read_message_id": read.LastReadMessageID,
+		"last_read_at":         read.LastReadAt.Format(time.RFC3339),
+	})
+	for _, userID := range audience {
+		if userID == read.UserID {
+			continue
+		}
+		if err := hub.PublishToUser(userID, event); err != nil {
+			requestLogger(c).Warn("failed to publish read receipt", "channel_id", channel.ID, "user_id", userID, "error", err)
+			return
+		}
+	}
+}
+
+// GetChannelReceipts returns how far each other member has read a small channel.
+// Members who turned read receipts off are left out, and channels with too many
+// members report receipts as unavailable.
+func GetChannelReceipts(c *gin.Context) {
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	audience, ok, err := receiptAudience(caller.DB, channel)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel members")
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{
+			"channel_id": channel.ID,
+			"available":  false,
+			"receipts":   []gin.H{},
+		}})
+		return
+	}
+
+	var rows []channelReceiptRow
+	if len(audience) > 0 {
+		if err := caller.DB.Model(&models.ChannelRead{}).
+			Select("channel_reads.user_id, channel_reads.last_read_message_id, channel_reads.last_read_at").
+			Joins("JOIN users ON users.id = channel_reads.user_id").
+			Where("channel_reads.channel_id = ? AND channel_reads.user_id IN ?", channel.ID, audience).
+			Where("channel_reads.user_id <> ? AND users.read_receipts_enabled = ?", caller.Claims.UserID, true).
+			Order("channel_reads.user_id ASC").
+			Scan(&rows).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load read receipts")
+			return
+		}
+	}
+
+	receipts := make([]gin.H, 0, len(rows))
+	for _, row := range rows {
+		receipts = append(receipts, gin.H{
+			"user_id":              row.UserID,
+			"last_read_message_id": row.LastReadMessageID,
+			"last_read_at":         row.LastReadAt.Format(time.RFC3339),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"channel_id": channel.ID,
+		"available":  true,
+		"receipts":   receipts,
+	}})
+}
+
+// GetPrivacySettings returns the current user's privacy settings.
+func GetPrivacySettings(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := caller.DB.Select("id", "read_receipts_enabled").First(&user, caller.Claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"privacy": serializePrivacySettings(user),
+		},
+	})
+}
+
+// UpdatePrivacySettings changes the current user's privacy settings.
+func UpdatePrivacySettings(c *gin.Context) {
+	var req models.UpdatePrivacySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var user models.User
+	if err := caller.DB.Select("id", "read_receipts_enabled").First(&user, caller.Claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return
+	}
+
+	if req.ReadReceipts != nil {
+		user.ReadReceiptsEnabled = *req.ReadReceipts
+		if err := caller.DB.Model(&user).UpdateColumn("read_receipts_enabled", user.ReadReceiptsEnabled).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update privacy settings")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Privacy settings updated",
+		"data": gin.H{
+			"privacy": serializePrivacySettings(user),
+		},
+	})
+}
+
+func serializePrivacySettings(user models.User) gin.H {
+	return gin.H{
+		"read_receipts": user.ReadReceiptsEnabled,
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"html/template"
@@ -11,19 +12,19 @@ import (
 	"strings"
 	"time"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/auth"
 	"bafachat/internal/email"
 	"bafachat/internal/models"
 	"bafachat/internal/queue"
+	"bafachat/internal/websocket"
 
 	"github.com/gin-gonic/gin"
-	"github.com/hibiken/asynq"
 	"gorm.io/gorm"
 )
 
 const (
 	defaultInviteExpiryHours   = 168
-	inviteCodeBytes            = 12
 	maxInviteEmailsPerRequest  = 10
 )
 
@@ -36,13 +37,13 @@ var (
 func GetServers(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
@@ -53,7 +54,7 @@ func GetServers(c *gin.Context) {
 		Preload("Owner").
 		Find(&servers).Error
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load servers"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load servers")
 		return
 	}
 
@@ -69,25 +70,25 @@ func GetServers(c *gin.Context) {
 func CreateServer(c *gin.Context) {
 	var req models.CreateServerRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	name := strings.TrimSpace(req.Name)
 	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "server name is required"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNameRequired, "server name is required")
 		return
 	}
 
@@ -132,7 +133,7 @@ func CreateServer(c *gin.Context) {
 		}
 
 		expiresAt := time.Now().Add(defaultInviteExpiryHours * time.Hour)
-		newInvite, err := createServerInvite(tx, server.ID, claims.UserID, &expiresAt, 0)
+		newInvite, err := createServerInvite(tx, server.ID, claims.UserID, &expiresAt, invitePolicyFromEnv().defaultMaxUses(), models.ServerRoleMember)
 		if err != nil {
 			return err
 		}
@@ -143,17 +144,21 @@ func CreateServer(c *gin.Context) {
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create server")
 		return
 	}
 
 	if err := db.WithContext(c).Preload("Owner").First(&server, server.ID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
 	server.CurrentMemberRole = models.ServerRoleOwner
 
+	if hub, ok := getWebSocketHub(c); ok {
+		hub.AddServerMember(server.ID, claims.UserID)
+	}
+
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Server created",
 		"data": gin.H{
@@ -168,48 +173,48 @@ func CreateServerInvite(c *gin.Context) {
 	serverIDParam := c.Param("serverID")
 	serverIDValue, err := strconv.ParseUint(serverIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid server id")
 		return
 	}
 
 	var req models.CreateServerInviteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondError(c, http.StatusBadRequest, err)
 		return
 	}
 
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	var server models.Server
 	if err := db.WithContext(c).First(&server, uint(serverIDValue)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
-	if err := requireServerOwner(db.WithContext(c), server.ID, claims.UserID); err != nil {
+	if err := requirePermission(db.WithContext(c), server.ID, claims.UserID, models.PermissionManageInvites); err != nil {
 		switch err {
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 			return
-		case errServerOwnerRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errServerPermissionRequired:
+			respondError(c, http.StatusForbidden, err)
 			return
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify permissions"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify permissions")
 			return
 		}
 	}
@@ -218,6 +223,32 @@ func CreateServerInvite(c *gin.Context) {
 	if maxUses < 0 {
 		maxUses = 0
 	}
+	if req.OneTime {
+		if maxUses > 1 {
+			respondError(c, http.StatusBadRequest, errors.New("one_time invites cannot set max_uses above 1"))
+			return
+		}
+		maxUses = 1
+	}
+
+	if err := invitePolicyFromEnv().validateMaxUses(maxUses); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	role := strings.ToLower(strings.TrimSpace(req.Role))
+	if role == "" {
+		role = models.ServerRoleMember
+	}
+	if !assignableServerRoles[role] {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRole, "role must be admin or member")
+		return
+	}
+	// Only owners may assign roles, so only they may create invites that grant one.
+	if role != models.ServerRoleMember && server.OwnerID != claims.UserID {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeOwnerRequired, "only server owners can create invites that grant a role")
+		return
+	}
 
 	var expiresAt *time.Time
 	if req.ExpiresInHours > 0 {
@@ -227,7 +258,7 @@ func CreateServerInvite(c *gin.Context) {
 
 	var invite models.ServerInvite
 	err = db.WithContext(c).Transaction(func(tx *gorm.DB) error {
-		createdInvite, err := createServerInvite(tx, server.ID, claims.UserID, expiresAt, maxUses)
+		createdInvite, err := createServerInvite(tx, server.ID, claims.UserID, expiresAt, maxUses, role)
 		if err != nil {
 			return err
 		}
@@ -237,7 +268,7 @@ func CreateServerInvite(c *gin.Context) {
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create invite"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create invite")
 		return
 	}
 
@@ -258,20 +289,20 @@ func CreateServerInvite(c *gin.Context) {
 func GetServer(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	serverIDParam := c.Param("serverID")
 	serverIDValue, err := strconv.ParseUint(serverIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid server id")
 		return
 	}
 
@@ -281,10 +312,10 @@ func GetServer(c *gin.Context) {
 		Where("id = ?", uint(serverIDValue)).
 		First(&server).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "server not found"})
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load server"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
 		return
 	}
 
@@ -293,10 +324,10 @@ func GetServer(c *gin.Context) {
 		Where("server_id = ? AND user_id = ?", server.ID, claims.UserID).
 		First(&membership).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
 		return
 	}
 
@@ -309,35 +340,35 @@ func GetServer(c *gin.Context) {
 func GetServerChannelParticipants(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	claims, ok := getUserClaims(c)
 	if !ok {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
 		return
 	}
 
 	hub, ok := getWebSocketHub(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "websocket hub unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "websocket hub unavailable")
 		return
 	}
 
 	serverIDParam := c.Param("serverID")
 	serverIDValue, err := strconv.ParseUint(serverIDParam, 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid server id"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid server id")
 		return
 	}
 
 	if err := ensureServerMembership(db.WithContext(c), uint(serverIDValue), claims.UserID); err != nil {
 		switch err {
 		case errServerMembershipRequired:
-			c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+			apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
 		default:
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
 		}
 		return
 	}
@@ -346,61 +377,80 @@ func GetServerChannelParticipants(c *gin.Context) {
 	if err := db.WithContext(c).
 		Where("server_id = ? AND type = ?", uint(serverIDValue), models.ChannelTypeAudio).
 		Find(&channels).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channels"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channels")
 		return
 	}
 
-	result := make(map[string]interface{})
+	result := channelParticipants(c, db.WithContext(c), hub, channels)
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// channelParticipants returns the active WebRTC participants of each channel that
+// has any, keyed by channel ID. Users are looked up in one query across all the
+// channels; if that fails, participants are still listed under their session
+// display name.
+func channelParticipants(c *gin.Context, db *gorm.DB, hub *websocket.Hub, channels []models.Channel) map[string]interface{} {
+	channelList := make(map[uint][]websocket.Participant, len(channels))
+	userIDs := make([]uint, 0)
+	seen := make(map[uint]bool)
 	for _, channel := range channels {
 		participants := hub.WebRTCParticipants(channel.ID)
-		if len(participants) > 0 {
-			serializedParticipants := make([]map[string]interface{}, 0, len(participants))
-			
-			userIDs := make([]uint, 0, len(participants))
-			for _, p := range participants {
-				userIDs = append(userIDs, p.UserID)
-			}
+		if len(participants) == 0 {
+			continue
+		}
 
-			var users []models.User
-			if len(userIDs) > 0 {
-				if err := db.WithContext(c).
-					Select("id", "username", "avatar").
-					Where("id IN ?", userIDs).
-					Find(&users).Error; err != nil {
-					continue
-				}
+		channelList[channel.ID] = participants
+		for _, participant := range participants {
+			if !seen[participant.UserID] {
+				seen[participant.UserID] = true
+				userIDs = append(userIDs, participant.UserID)
 			}
+		}
+	}
 
-			userMap := make(map[uint]models.User)
-			for _, user := range users {
-				userMap[user.ID] = user
-			}
+	userMap := make(map[uint]models.User, len(userIDs))
+	if len(userIDs) > 0 {
+		var users []models.User
+		if err := db.
+			Select("id", "username", "avatar").
+			Where("id IN ?", userIDs).
+			Find(&users).Error; err != nil {
+			requestLogger(c).Warn("failed to load voice participant profiles", "users", len(userIDs), "error", err)
+		}
 
-			for _, participant := range participants {
-				user, ok := userMap[participant.UserID]
-				serialized := map[string]interface{}{
-					"user_id":      participant.UserID,
-					"display_name": participant.DisplayName,
-					"role":         participant.Role,
-					"session_id":   participant.SessionID,
-					"media_state":  participant.MediaState,
-					"channel_id":   participant.ChannelID,
-					"last_seen":    participant.LastSeen.Format(time.RFC3339),
-					"username":     "",
-					"avatar":       "",
-				}
-				if ok {
-					serialized["username"] = user.Username
-					serialized["avatar"] = user.Avatar
-				}
-				serializedParticipants = append(serializedParticipants, serialized)
-			}
+		for _, user := range users {
+			userMap[user.ID] = user
+		}
+	}
 
-			result[strconv.Itoa(int(channel.ID))] = serializedParticipants
+	result := make(map[string]interface{}, len(channelList))
+	for channelID, participants := range channelList {
+		serializedParticipants := make([]map[string]interface{}, 0, len(participants))
+		for _, participant := range participants {
+			serialized := map[string]interface{}{
+				"user_id":      participant.UserID,
+				"display_name": participant.DisplayName,
+				"role":         participant.Role,
+				"session_id":   participant.SessionID,
+				"media_state":  participant.MediaState,
+				"hand_raised":  participant.HandRaised,
+				"channel_id":   participant.ChannelID,
+				"last_seen":    participant.LastSeen.Format(time.RFC3339),
+				"username":     participant.DisplayName,
+				"avatar":       "",
+			}
+			if user, ok := userMap[participant.UserID]; ok {
+				serialized["username"] = user.Username
+				serialized["avatar"] = user.Avatar
+			}
+			serializedParticipants = append(serializedParticipants, serialized)
 		}
+
+		result[strconv.Itoa(int(channelID))] = serializedParticipants
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": result})
+	return result
 }
 
 func requireServerOwner(db *gorm.DB, serverID, userID uint) error {
@@ -419,6 +469,7 @@ func requireServerOwner(db *gorm.DB, serverID, userID uint) error {
 	return nil
 }
 
+// ensureServerMembership requires an active membership; members still pending the join gate are rejected.
 func ensureServerMembership(db *gorm.DB, serverID, userID uint) error {
 	var membership models.ServerMember
 	if err := db.Where("server_id = ? AND user_id = ?", serverID, userID).First(&membership).Error; err != nil {
@@ -428,13 +479,19 @@ func ensureServerMembership(db *gorm.DB, serverID, userID uint) error {
 		return err
 	}
 
+	if membership.Role == models.ServerRolePending {
+		return errServerMembershipRequired
+	}
+
 	return nil
 }
 
-func createServerInvite(tx *gorm.DB, serverID, inviterID uint, expiresAt *time.Time, maxUses int) (models.ServerInvite, error) {
+func createServerInvite(tx *gorm.DB, serverID, inviterID uint, expiresAt *time.Time, maxUses int, role string) (models.ServerInvite, error) {
+	policy := invitePolicyFromEnv()
+
 	maxAttempts := 5
 	for attempts := 0; attempts < maxAttempts; attempts++ {
-		code, err := generateInviteCode(inviteCodeBytes)
+		code, err := newInviteCode(policy.CodeLength, policy.CodeAlphabet)
 		if err != nil {
 			return models.ServerInvite{}, err
 		}
@@ -444,11 +501,17 @@ func createServerInvite(tx *gorm.DB, serverID, inviterID uint, expiresAt *time.T
 			ServerID:  serverID,
 			InviterID: inviterID,
 			MaxUses:   maxUses,
+			Role:      role,
 			ExpiresAt: expiresAt,
 		}
 
-		if err := tx.Create(&invite).Error; err != nil {
-			if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// Insert under a savepoint: in Postgres a failed statement aborts the
+		// surrounding transaction, so a code collision must be rolled back on its
+		// own before the next attempt.
+		if err := tx.Transaction(func(attempt *gorm.DB) error {
+			return attempt.Create(&invite).Error
+		}); err != nil {
+			if isUniqueViolation(err) {
 				continue
 			}
 			return models.ServerInvite{}, err
@@ -460,18 +523,62 @@ func createServerInvite(tx *gorm.DB, serverID, inviterID uint, expiresAt *time.T
 	return models.ServerInvite{}, fmt.Errorf("failed to generate unique invite code")
 }
 
-func generateInviteCode(bytes int) (string, error) {
-	if bytes <= 0 {
-		bytes = inviteCodeBytes
+// newInviteCode generates invite codes; tests replace it to force collisions.
+var newInviteCode = generateInviteCode
+
+// generateInviteCode returns a random code of the given length. Both alphabets
+// are URL-safe, and the result is checked so a code can always be put in a link.
+func generateInviteCode(length int, alphabet string) (string, error) {
+	if length <= 0 {
+		length = defaultInviteCodeLength
 	}
 
-	code, err := auth.GenerateRandomToken(bytes)
-	if err != nil {
-		return "", err
+	var code string
+	if alphabet == inviteCodeAlphabetReadable {
+		buf := make([]byte, length)
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		// The alphabet has 32 characters, so the low five bits pick one without bias.
+		for i, b := range buf {
+			buf[i] = readableInviteCodeChars[b&31]
+		}
+		code = string(buf)
+	} else {
+		// Each base64url character carries six bits, so this many bytes always
+		// encodes to at least length characters.
+		token, err := auth.GenerateRandomToken((length*3 + 3) / 4)
+		if err != nil {
+			return "", err
+		}
+		code = token[:length]
+	}
+
+	if !isURLSafeInviteCode(code) {
+		return "", fmt.Errorf("generated invite code %q is not URL-safe", code)
 	}
 
-	// Remove any padding that might sneak in, keeping URL-safe characters only.
-	return strings.TrimRight(code, "="), nil
+	return code, nil
+}
+
+// readableInviteCodeChars leaves out 0, 1, I and O, which are easily confused.
+const readableInviteCodeChars = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// isURLSafeInviteCode reports whether code is non-empty and uses only [A-Za-z0-9_-].
+func isURLSafeInviteCode(code string) bool {
+	if code == "" {
+		return false
+	}
+
+	for _, r := range code {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+
+	return true
 }
 
 func normalizeEmails(inputs []string) []string {
@@ -510,82 +617,24 @@ func normalizeEmails(inputs []string) []string {
 }
 
 func sendServerInviteEmails(c *gin.Context, server models.Server, invite models.ServerInvite, emails []string, inviterName, customMessage string) {
-	queueClient, hasQueue := getQueueClient(c)
-	emailService, hasEmail := getEmailService(c)
-	if !hasQueue && !hasEmail {
-		return
-	}
-
-	inviteURL := buildInviteURL(invite.Code)
-
-	subject := fmt.Sprintf("You're invited to %s on BafaChat", server.Name)
-	if strings.TrimSpace(inviterName) != "" {
-		subject = fmt.Sprintf("%s invited you to %s on BafaChat", inviterName, server.Name)
-	}
-
-	var intro string
-	if strings.TrimSpace(inviterName) != "" {
-		intro = fmt.Sprintf("%s invited you to join the %s workspace on BafaChat.", inviterName, server.Name)
-	} else {
-		intro = fmt.Sprintf("You've been invited to join the %s workspace on BafaChat.", server.Name)
-	}
-
-	if customMessage != "" {
-		customMessage = strings.TrimSpace(customMessage)
-	}
-
-	htmlBody := fmt.Sprintf(`<p>%s</p>%s<p><a href="%s" style="background-color:#38bdf8;border-radius:8px;color:#0f172a;padding:10px 16px;text-decoration:none;font-weight:600;">Accept invite</a></p><p>If the button doesn't work, copy and paste this link into your browser:</p><p>%s</p><p>— The BafaChat Team</p>`,
-		intro,
-		formatOptionalHTMLMessage(customMessage),
-		inviteURL,
-		inviteURL,
-	)
-
-	textBody := fmt.Sprintf("%s\n\nAccept your invite: %s\n\n— The BafaChat Team", intro, inviteURL)
-	if customMessage != "" {
-		textBody = fmt.Sprintf("%s\n\n%s\n\nAccept your invite: %s\n\n— The BafaChat Team", intro, customMessage, inviteURL)
-	}
-
-	payload := queue.EmailTaskPayload{
-		To:       strings.Join(emails, ","),
-		Subject:  subject,
-		HTMLBody: htmlBody,
-		TextBody: textBody,
-		Tag:      "server-invite",
-		Meta: map[string]string{
-			"server_id": fmt.Sprintf("%d", server.ID),
-			"invite_id": fmt.Sprintf("%d", invite.ID),
-		},
-	}
-
-	ctx := c.Request.Context()
-
-	if hasQueue {
-		for _, emailAddr := range emails {
-			payload.To = emailAddr
-			task, err := queue.NewEmailTask(payload)
-			if err != nil {
-				continue
-			}
-			if _, err := queueClient.Enqueue(task, asynq.MaxRetry(3)); err != nil {
-				continue
-			}
-		}
-		return
-	}
-
-	if hasEmail {
-		for _, emailAddr := range emails {
-			payload.To = emailAddr
-			_ = emailService.SendEmail(ctx, email.SendEmailInput{
-				To:       payload.To,
-				Subject:  payload.Subject,
-				HTMLBody: payload.HTMLBody,
-				TextBody: payload.TextBody,
-				Tag:      payload.Tag,
-				Metadata: payload.Meta,
-			})
-		}
+	model := map[string]any{
+		"server_name":    server.Name,
+		"inviter_name":   strings.TrimSpace(inviterName),
+		"invite_url":     buildInviteURL(invite.Code),
+		"custom_message": strings.TrimSpace(customMessage),
+	}
+
+	for _, emailAddr := range emails {
+		deliverTemplateEmail(c, queue.TemplateEmailTaskPayload{
+			To:            emailAddr,
+			TemplateAlias: email.TemplateServerInvite,
+			Model:         model,
+			Tag:           "server-invite",
+			Meta: map[string]string{
+				"server_id": fmt.Sprintf("%d", server.ID),
+				"invite_id": fmt.Sprintf("%d", invite.ID),
+			},
+		})
 	}
 }
 
@@ -624,6 +673,13 @@ func serializeServer(server models.Server) gin.H {
 		"icon":        server.Icon,
 		"owner_id":    server.OwnerID,
 		"owner":       owner,
+		"rules":       server.Rules,
+		"require_rules": server.RequireRules,
+		"require_approval": server.RequireApproval,
+		"welcome_channel_id": server.WelcomeChannelID,
+		"welcome_message": server.WelcomeMessage,
+		"public":      server.Public,
+		"tags":        serverTags(server),
 		"current_member_role": server.CurrentMemberRole,
 		"created_at":  server.CreatedAt.Format(time.RFC3339),
 		"updated_at":  server.UpdatedAt.Format(time.RFC3339),
@@ -636,6 +692,11 @@ func serializeInvite(invite models.ServerInvite) gin.H {
 		expiresAt = invite.ExpiresAt.Format(time.RFC3339)
 	}
 
+	var revokedAt string
+	if invite.RevokedAt != nil {
+		revokedAt = invite.RevokedAt.Format(time.RFC3339)
+	}
+
 	return gin.H{
 		"id":          invite.ID,
 		"code":        invite.Code,
@@ -643,7 +704,10 @@ func serializeInvite(invite models.ServerInvite) gin.H {
 		"inviter_id":  invite.InviterID,
 		"max_uses":    invite.MaxUses,
 		"uses":        invite.Uses,
+		"role":        invite.Role,
 		"expires_at":  expiresAt,
+		"revoked_at":  revokedAt,
+		"active":      validateInvite(invite) == nil,
 		"invite_url":  buildInviteURL(invite.Code),
 		"created_at":  invite.CreatedAt.Format(time.RFC3339),
 		"updated_at":  invite.UpdatedAt.Format(time.RFC3339),
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"bafachat/internal/models"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "postgres unique violation", err: &pgconn.PgError{Code: "23505"}, want: true},
+		{name: "wrapped unique violation", err: fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505"}), want: true},
+		{name: "gorm duplicated key", err: gorm.ErrDuplicatedKey, want: true},
+		{name: "other postgres error", err: &pgconn.PgError{Code: "23503"}, want: false},
+		{name: "other error", err: errors.New("connection reset"), want: false},
+		{name: "nil", err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isUniqueViolation(tt.err); got != tt.want {
+				t.Fatalf("isUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateServerInviteRetriesCodeCollision(t *testing.T) {
+	store := &fakeInviteStore{taken: map[string]bool{"TAKEN": true}}
+	db := openFakeInviteDB(t, store)
+	stubInviteCodes(t, "TAKEN", "FRESH")
+
+	var invite models.ServerInvite
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		invite, err = createServerInvite(tx, 1, 2, nil, 0, "member")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("createServerInvite: %v", err)
+	}
+
+	if invite.Code != "FRESH" {
+		t.Fatalf("invite code = %q, want %q", invite.Code, "FRESH")
+	}
+	if invite.ID == 0 {
+		t.Fatal("invite was not given an ID")
+	}
+	if got := store.attemptedCodes(); !slices.Equal(got, []string{"TAKEN", "FRESH"}) {
+		t.Fatalf("attempted codes = %v, want [TAKEN FRESH]", got)
+	}
+	// The failed insert must be rolled back on its own so the transaction survives.
+	if !store.ranStatement("ROLLBACK TO SAVEPOINT") {
+		t.Fatalf("collision was not rolled back to a savepoint; statements: %v", store.statements)
+	}
+}
+
+func TestCreateServerInviteGivesUpAfterRepeatedCollisions(t *testing.T) {
+	store := &fakeInviteStore{taken: map[string]bool{"TAKEN": true}}
+	db := openFakeInviteDB(t, store)
+	stubInviteCodes(t, "TAKEN")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := createServerInvite(tx, 1, 2, nil, 0, "member")
+		return err
+	})
+	if err == nil {
+		t.Fatal("createServerInvite succeeded with every code taken")
+	}
+	if got := len(store.attemptedCodes()); got != 5 {
+		t.Fatalf("attempts = %d, want 5", got)
+	}
+}
+
+func TestCreateServerInviteReturnsOtherErrors(t *testing.T) {
+	store := &fakeInviteStore{taken: map[string]bool{}, insertErr: &pgconn.PgError{Code: "23503"}}
+	db := openFakeInviteDB(t, store)
+	stubInviteCodes(t, "FRESH")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		_, err := createServerInvite(tx, 1, 2, nil, 0, "member")
+		return err
+	})
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23503" {
+		t.Fatalf("err = %v, want the foreign key violation", err)
+	}
+	if got := len(store.attemptedCodes()); got != 1 {
+		t.Fatalf("attempts = %d, want 1", got)
+	}
+}
+
+// stubInviteCodes makes newInviteCode return codes in order, repeating the last.
+func stubInviteCodes(t *testing.T, codes ...string) {
+	t.Helper()
+
+	original := newInviteCode
+	next := 0
+	newInviteCode = func(int, string) (string, error) {
+		code := codes[min(next, len(codes)-1)]
+		next++
+		return code, nil
+	}
+	t.Cleanup(func() { newInviteCode = original })
+}
+
+// openFakeInviteDB returns a gorm Postgres DB whose connection is backed by store.
+func openFakeInviteDB(t *testing.T, store *fakeInviteStore) *gorm.DB {
+	t.Helper()
+
+	sqlDB := sql.OpenDB(fakeInviteConnector{store: store})
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open fake database: %v", err)
+	}
+	return db
+}
+
+// fakeInviteStore stands in for the server_invites table. Inserting a code that
+// is already taken fails the way Postgres does, with a unique violation.
+type fakeInviteStore struct {
+	mu         sync.Mutex
+	taken      map[string]bool
+	insertErr  error
+	attempts   []string
+	statements []string
+	nextID     int64
+}
+
+func (s *fakeInviteStore) attemptedCodes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.attempts)
+}
+
+func (s *fakeInviteStore) ranStatement(prefix string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.ContainsFunc(s.statements, func(statement string) bool {
+		return strings.HasPrefix(statement, prefix)
+	})
+}
+
+func (s *fakeInviteStore) exec(query string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, query)
+}
+
+func (s *fakeInviteStore) insert(query string, args []driver.NamedValue) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statements = append(s.statements, query)
+
+	if !strings.HasPrefix(query, `INSERT INTO "server_invites"`) {
+		return 0, fmt.Errorf("unexpected query %q", query)
+	}
+
+	code, _ := args[0].Value.(string)
+	s.attempts = append(s.attempts, code)
+	if s.insertErr != nil {
+		return 0, s.insertErr
+	}
+	if s.taken[code] {
+		return 0, &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+	}
+
+	s.taken[code] = true
+	s.nextID++
+	return s.nextID, nil
+}
+
+type fakeInviteConnector struct{ store *fakeInviteStore }
+
+func (c fakeInviteConnector) Connect(context.Context) (driver.Conn, error) {
+	return fakeInviteConn{store: c.store}, nil
+}
+
+func (c fakeInviteConnector) Driver() driver.Driver { return fakeInviteDriver{} }
+
+type fakeInviteDriver struct{}
+
+func (fakeInviteDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("use fakeInviteConnector")
+}
+
+type fakeInviteConn struct{ store *fakeInviteStore }
+
+func (c fakeInviteConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c fakeInviteConn) Close() error { return nil }
+
+func (c fakeInviteConn) Begin() (driver.Tx, error) { return fakeInviteTx{}, nil }
+
+func (c fakeInviteConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.store.exec(query)
+	return driver.RowsAffected(0), nil
+}
+
+func (c fakeInviteConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	id, err := c.store.insert(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeIDRows{id: id}, nil
+}
+
+type fakeInviteTx struct{}
+
+func (fakeInviteTx) Commit() error   { return nil }
+func (fakeInviteTx) Rollback() error { return nil }
+
+// fakeIDRows is the single-row result of INSERT ... RETURNING "id".
+type fakeIDRows struct {
+	id   int64
+	done bool
+}
+
+func (r *fakeIDRows) Columns() []string { return []string{"id"} }
+func (r *fakeIDRows) Close() error      { return nil }
+
+func (r *fakeIDRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = r.id
+	return nil
+}
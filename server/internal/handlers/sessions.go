@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const maxSessionUserAgentLength = 512
+
+// GetSessions lists the current user's active sessions, flagging the one making the request.
+func GetSessions(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var sessions []models.Session
+	if err := caller.DB.
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", caller.Claims.UserID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load sessions")
+		return
+	}
+
+	currentHash := ""
+	if caller.Claims.ID != "" {
+		currentHash = auth.HashToken(caller.Claims.ID)
+	}
+
+	payload := make([]gin.H, 0, len(sessions))
+	for _, session := range sessions {
+		payload = append(payload, serializeSession(session, session.TokenHash == currentHash))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"sessions": payload}})
+}
+
+// RevokeSession signs out one of the current user's sessions.
+func RevokeSession(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	sessionIDValue, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || sessionIDValue == 0 {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid session id")
+		return
+	}
+
+	result := caller.DB.
+		Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", uint(sessionIDValue), caller.Claims.UserID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to revoke session")
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeSessionNotFound, "session not found")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func createSession(db *gorm.DB, c *gin.Context, userID uint, sessionID string, expiresAt time.Time) error {
+	userAgent := strings.TrimSpace(c.Request.UserAgent())
+	if len(userAgent) > maxSessionUserAgentLength {
+		userAgent = userAgent[:maxSessionUserAgentLength]
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		TokenHash:  auth.HashToken(sessionID),
+		UserAgent:  userAgent,
+		IPAddress:  c.ClientIP(),
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt,
+	}
+
+	return db.Create(&session).Error
+}
+
+func revokeSessionByID(db *gorm.DB, userID uint, sessionID string) error {
+	return db.Model(&models.Session{}).
+		Where("token_hash = ? AND user_id = ? AND revoked_at IS NULL", auth.HashToken(sessionID), userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// optionalBearerClaims parses the Authorization header on routes that do not require authentication.
+func optionalBearerClaims(c *gin.Context) *auth.Claims {
+	parts := strings.Fields(c.GetHeader("Authorization"))
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return nil
+	}
+
+	claims, err := auth.ParseJWT(parts[1])
+	if err != nil {
+		return nil
+	}
+
+	return claims
+}
+
+func serializeSession(session models.Session, current bool) gin.H {
+	return gin.H{
+		"id":           session.ID,
+		"user_agent":   session.UserAgent,
+		"ip_address":   session.IPAddress,
+		"created_at":   session.CreatedAt.Format(time.RFC3339),
+		"last_used_at": session.LastUsedAt.Format(time.RFC3339),
+		"expires_at":   session.ExpiresAt.Format(time.RFC3339),
+		"current":      current,
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxSlowmodeSeconds caps slowmode at six hours.
+	maxSlowmodeSeconds = 6 * 60 * 60
+	slowmodeKeyPrefix  = "bafachat:slowmode:"
+)
+
+// enforceSlowmode reports whether the user may post in the channel now. When the
+// user must wait it writes a 429 response with retry_after and returns false.
+// Members who can manage channels (owners and admins) are exempt.
+func enforceSlowmode(c *gin.Context, db *gorm.DB, channel models.Channel, userID uint) bool {
+	if channel.SlowmodeSeconds <= 0 {
+		return true
+	}
+
+	exempt, err := hasPermission(db, channel.ServerID, userID, models.PermissionManageChannels)
+	if err != nil && !errors.Is(err, errServerMembershipRequired) {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify permissions")
+		return false
+	}
+	if exempt {
+		return true
+	}
+
+	interval := time.Duration(channel.SlowmodeSeconds) * time.Second
+
+	retryAfter, err := slowmodeRetryAfter(c, db, channel.ID, userID, interval)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to check slowmode")
+		return false
+	}
+
+	if retryAfter <= 0 {
+		return true
+	}
+
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	apierror.RespondWithDetails(c, http.StatusTooManyRequests, apierror.CodeSlowmode,
+		"slowmode is enabled; please wait before sending another message",
+		gin.H{"retry_after": seconds},
+	)
+	return false
+}
+
+// slowmodeRetryAfter claims the user's slot for the interval in Redis, returning the
+// remaining wait when the slot is already taken. Without Redis it falls back to the
+// user's most recent message in the channel.
+func slowmodeRetryAfter(c *gin.Context, db *gorm.DB, channelID, userID uint, interval time.Duration) (time.Duration, error) {
+	if client, ok := getRedisClient(c); ok {
+		ctx := c.Request.Context()
+		key := fmt.Sprintf("%s%d:%d", slowmodeKeyPrefix, channelID, userID)
+
+		claimed, err := client.SetNX(ctx, key, time.Now().Unix(), interval).Result()
+		if err == nil {
+			if claimed {
+				return 0, nil
+			}
+
+			ttl, err := client.PTTL(ctx, key).Result()
+			if err == nil {
+				if ttl < 0 {
+					return 0, nil
+				}
+				return ttl, nil
+			}
+		}
+
+		requestLogger(c).Warn("slowmode: redis unavailable, falling back to database", "error", err)
+	}
+
+	var last models.Message
+	if err := db.Select("id", "created_at").
+		Where("channel_id = ? AND user_id = ? AND webhook_id IS NULL", channelID, userID).
+		Order("created_at DESC").
+		First(&last).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return interval - time.Since(last.CreatedAt), nil
+}
+
+func getRedisClient(c *gin.Context) (*redis.Client, bool) {
+	value, exists := c.Get("redis")
+	if !exists {
+		return nil, false
+	}
+
+	client, ok := value.(*redis.Client)
+	if !ok {
+		requestLogger(c).Error("invalid redis client type")
+		return nil, false
+	}
+
+	return client, true
+}
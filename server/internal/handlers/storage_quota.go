@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"maps"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errStorageQuotaExceeded = errors.New("this server has used its file storage quota")
+
+// serverStorageQuotaFromEnv reads SERVER_STORAGE_QUOTA_MB, the attachment bytes a
+// single server may store. It returns 0, meaning no quota, when unset.
+func serverStorageQuotaFromEnv() int64 {
+	raw := strings.TrimSpace(os.Getenv("SERVER_STORAGE_QUOTA_MB"))
+	if raw == "" {
+		return 0
+	}
+
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+
+	return value * 1024 * 1024
+}
+
+// checkServerStorageQuota returns errStorageQuotaExceeded when storing incoming
+// more bytes would take the server past its quota.
+func checkServerStorageQuota(db *gorm.DB, serverID uint, incoming int64) error {
+	quota := serverStorageQuotaFromEnv()
+	if quota == 0 {
+		return nil
+	}
+
+	var server models.Server
+	if err := db.Select("id", "storage_used_bytes").First(&server, serverID).Error; err != nil {
+		return err
+	}
+
+	if server.StorageUsedBytes+incoming > quota {
+		return errStorageQuotaExceeded
+	}
+
+	return nil
+}
+
+// respondStorageQuotaError writes the response for an error from checkServerStorageQuota.
+func respondStorageQuotaError(c *gin.Context, err error) {
+	if errors.Is(err, errStorageQuotaExceeded) {
+		apierror.RespondWithDetails(c, http.StatusRequestEntityTooLarge, apierror.CodeQuotaExceeded, err.Error(), gin.H{
+			"quota_bytes": serverStorageQuotaFromEnv(),
+		})
+		return
+	}
+
+	apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to check storage quota")
+}
+
+// addServerStorageUsage counts newly stored attachments against the server.
+func addServerStorageUsage(tx *gorm.DB, serverID uint, attachments []models.MessageAttachment) error {
+	var total int64
+	for _, attachment := range attachments {
+		total += attachment.FileSize
+	}
+	if total == 0 {
+		return nil
+	}
+
+	return tx.Model(&models.Server{}).
+		Where("id = ?", serverID).
+		UpdateColumn("storage_used_bytes", gorm.Expr("storage_used_bytes + ?", total)).Error
+}
+
+// storedObject is an attachment object counted against a server's storage.
+type storedObject struct {
+	ServerID  uint
+	ObjectKey string
+	FileSize  int64
+}
+
+// messageStoredObjects returns the attachment objects of the messages matching the
+// condition, once per server.
+func messageStoredObjects(tx *gorm.DB, condition string, args ...interface{}) ([]storedObject, error) {
+	var objects []storedObject
+	matching := tx.Model(&models.Message{}).Select("id").Where(condition, args...)
+	err := tx.Table("message_attachments").
+		Select("DISTINCT channels.server_id, message_attachments.object_key, message_attachments.file_size").
+		Joins("JOIN messages ON messages.id = message_attachments.message_id").
+		Joins("JOIN channels ON channels.id = messages.channel_id").
+		Where("message_attachments.message_id IN (?)", matching).
+		Scan(&objects).Error
+
+	return objects, err
+}
+
+// releaseServerStorageUsage stops counting deleted attachment objects against their
+// servers. Call it in the transaction that deleted the attachments; an object
+// another of the server's attachments still shares stays counted. The server rows
+// are locked first so concurrent deletes of an object's last two references
+// cannot both see the other and leave it counted.
+func releaseServerStorageUsage(tx *gorm.DB, objects []storedObject) error {
+	if len(objects) == 0 {
+		return nil
+	}
+
+	serverIDs := make([]uint, 0, len(objects))
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		serverIDs = append(serverIDs, object.ServerID)
+		keys = append(keys, object.ObjectKey)
+	}
+	slices.Sort(serverIDs)
+	serverIDs = slices.Compact(serverIDs)
+
+	var locked []models.Server
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").
+		Where("id IN ?", serverIDs).
+		Order("id ASC").
+		Find(&locked).Error; err != nil {
+		return err
+	}
+
+	var remaining []storedObject
+	if err := tx.Table("message_attachments").
+		Select("DISTINCT channels.server_id, message_attachments.object_key").
+		Joins("JOIN messages ON messages.id = message_attachments.message_id").
+		Joins("JOIN channels ON channels.id = messages.channel_id").
+		Where("channels.server_id IN ? AND message_attachments.object_key IN ?", serverIDs, keys).
+		Scan(&remaining).Error; err != nil {
+		return err
+	}
+
+	shared := make(map[storedObject]bool, len(remaining))
+	for _, object := range remaining {
+		shared[object] = true
+	}
+
+	released := make(map[uint]int64, len(serverIDs))
+	for _, object := range objects {
+		if !shared[storedObject{ServerID: object.ServerID, ObjectKey: object.ObjectKey}] {
+			released[object.ServerID] += object.FileSize
+		}
+	}
+
+	for _, serverID := range slices.Sorted(maps.Keys(released)) {
+		if released[serverID] == 0 {
+			continue
+		}
+		if err := tx.Model(&models.Server{}).
+			Where("id = ?", serverID).
+			UpdateColumn("storage_used_bytes", gorm.Expr("GREATEST(storage_used_bytes - ?, 0)", released[serverID])).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetServerStorage reports the server's attachment storage usage and quota to its owner and admins.
+func GetServerStorage(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if role := caller.Role(); role != models.ServerRoleOwner && role != models.ServerRoleAdmin {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodePermissionDenied, "only server owners and admins can view storage usage")
+		return
+	}
+
+	var server models.Server
+	if err := caller.DB.Select("id", "storage_used_bytes").First(&server, serverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
+		return
+	}
+
+	quota := serverStorageQuotaFromEnv()
+	payload := gin.H{
+		"server_id":   server.ID,
+		"used_bytes":  server.StorageUsedBytes,
+		"quota_bytes": quota,
+	}
+	if quota > 0 {
+		payload["remaining_bytes"] = max(quota-server.StorageUsedBytes, 0)
+		payload["used_percent"] = math.Round(float64(server.StorageUsedBytes)*1000/float64(quota)) / 10
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": payload})
+}
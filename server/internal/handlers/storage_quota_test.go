@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServerStorageQuotaFromEnv(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int64
+	}{
+		{raw: "", want: 0},
+		{raw: "10", want: 10 * 1024 * 1024},
+		{raw: "-1", want: 0},
+		{raw: "lots", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("SERVER_STORAGE_QUOTA_MB", tt.raw)
+		if got := serverStorageQuotaFromEnv(); got != tt.want {
+			t.Fatalf("serverStorageQuotaFromEnv(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestCheckServerStorageQuotaWithoutQuota(t *testing.T) {
+	t.Setenv("SERVER_STORAGE_QUOTA_MB", "")
+
+	// No quota means no database lookup, so a nil handle is never touched.
+	if err := checkServerStorageQuota(nil, 1, 1<<40); err != nil {
+		t.Fatalf("checkServerStorageQuota = %v, want nil", err)
+	}
+}
+
+func TestRespondStorageQuotaError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("SERVER_STORAGE_QUOTA_MB", "5")
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantQuota  bool
+	}{
+		{name: "quota exceeded", err: errStorageQuotaExceeded, wantStatus: http.StatusRequestEntityTooLarge, wantQuota: true},
+		{name: "lookup failed", err: errors.New("connection reset"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			respondStorageQuotaError(c, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var body struct {
+				Error struct {
+					Details map[string]any `json:"details"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if got := body.Error.Details["quota_bytes"] != nil; got != tt.wantQuota {
+				t.Fatalf("details = %v, want quota_bytes present %v", body.Error.Details, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestServerStorageQuotaAccounting(t *testing.T) {
+	db := openTestDB(t)
+	t.Setenv("SERVER_STORAGE_QUOTA_MB", "1")
+
+	owner := models.User{Username: "owner", Email: "owner@example.com", Password: "x"}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	server := models.Server{Name: "gophers", OwnerID: owner.ID}
+	if err := db.Create(&server).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	attachments := []models.MessageAttachment{{FileSize: 600 * 1024}, {FileSize: 300 * 1024}}
+	if err := addServerStorageUsage(db, server.ID, attachments); err != nil {
+		t.Fatalf("addServerStorageUsage: %v", err)
+	}
+
+	var stored models.Server
+	if err := db.First(&stored, server.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.StorageUsedBytes != 900*1024 {
+		t.Fatalf("StorageUsedBytes = %d, want %d", stored.StorageUsedBytes, 900*1024)
+	}
+
+	if err := checkServerStorageQuota(db, server.ID, 100*1024); err != nil {
+		t.Fatalf("checkServerStorageQuota within quota = %v, want nil", err)
+	}
+	if err := checkServerStorageQuota(db, server.ID, 200*1024); !errors.Is(err, errStorageQuotaExceeded) {
+		t.Fatalf("checkServerStorageQuota over quota = %v, want errStorageQuotaExceeded", err)
+	}
+}
+
+func TestReleaseServerStorageUsage(t *testing.T) {
+	released := map[int64]int64{}
+	db, fake := openFakeDB(t, func(query string, args []driver.Value) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(query, `SELECT "id" FROM "servers"`):
+			if !strings.HasSuffix(query, "FOR UPDATE") {
+				t.Errorf("servers loaded without a lock: %q", query)
+			}
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(10)}, {int64(11)}}}, nil
+		case strings.HasPrefix(query, "SELECT DISTINCT channels.server_id"):
+			// Another attachment in server 10 still uses the shared object.
+			return fakeResult{columns: []string{"server_id", "object_key"}, rows: [][]driver.Value{{int64(10), "shared"}}}, nil
+		case strings.HasPrefix(query, `UPDATE "servers"`):
+			released[args[1].(int64)] += args[0].(int64)
+			return fakeResult{affected: 1}, nil
+		}
+		t.Errorf("unexpected statement %q", query)
+		return fakeResult{}, nil
+	})
+
+	objects := []storedObject{
+		{ServerID: 10, ObjectKey: "shared", FileSize: 100},
+		{ServerID: 10, ObjectKey: "gone", FileSize: 200},
+		{ServerID: 11, ObjectKey: "shared", FileSize: 50},
+	}
+	if err := releaseServerStorageUsage(db, objects); err != nil {
+		t.Fatalf("releaseServerStorageUsage: %v", err)
+	}
+
+	if len(released) != 2 || released[10] != 200 || released[11] != 50 {
+		t.Fatalf("released bytes by server = %v, want map[10:200 11:50]", released)
+	}
+
+	fake.statements = nil
+	if err := releaseServerStorageUsage(db, nil); err != nil || len(fake.statements) != 0 {
+		t.Fatalf("releaseServerStorageUsage(nil) = %v after %d statements, want nothing run", err, len(fake.statements))
+	}
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"bafachat/internal/auth"
+	"bafachat/internal/avatars"
+	"bafachat/internal/oauth"
+	"bafachat/internal/push"
+	"bafachat/internal/webrtc"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetServerTime returns the server's current UTC time so clients can correct for local clock skew.
+func GetServerTime(c *gin.Context) {
+	now := time.Now().UTC()
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"now":     now.Format(time.RFC3339Nano),
+			"unix_ms": now.UnixMilli(),
+		},
+	})
+}
+
+// GetClientConfig exposes deployment limits that clients use to pick sensible UI
+// defaults, and which optional services (uploads, email, TURN) are enabled.
+func GetClientConfig(c *gin.Context) {
+	invites := invitePolicyFromEnv()
+	attachments := attachmentPolicyFromEnv()
+	emojis := emojiPolicyFromEnv()
+
+	storageService, uploadsEnabled := getStorageService(c)
+	_, emailEnabled := getEmailService(c)
+
+	rtcConfig, ok := getWebRTCConfig(c)
+	if !ok {
+		rtcConfig = webrtc.ConfigFromEnv()
+	}
+
+	// Browsers need the VAPID public key to subscribe; it is empty while Web Push is disabled.
+	var webPushKey string
+	if dispatcher, ok := getPushDispatcher(c); ok && dispatcher.Supports(push.PlatformWeb) {
+		webPushKey = push.WebPushConfigFromEnv().PublicKey
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"invites": gin.H{
+				"max_uses":        invites.MaxUses,
+				"allow_unlimited": invites.AllowUnlimited,
+			},
+			"attachments": gin.H{
+				"max_per_message":     attachments.MaxPerMessage,
+				"max_total_bytes":     attachments.MaxTotalBytes,
+				"max_upload_size":     storageService.MaxUploadSize(),
+				"max_alt_text_length": maxAttachmentAltTextLength,
+				"storage_quota_bytes": serverStorageQuotaFromEnv(),
+			},
+			"avatars": gin.H{
+				"content_types":   avatars.ImageTypes,
+				"max_upload_size": storageService.MaxUploadSize(),
+				"size":            avatars.OptionsFromEnv().Size,
+			},
+			"messages": gin.H{
+				"max_ttl_seconds":    maxMessageTTLFromEnv(),
+				"webhook_max_length": maxWebhookContentLength,
+			},
+			"voice": gin.H{
+				"max_participants":    rtcConfig.MaxParticipants,
+				"audio_only":          rtcConfig.AudioOnly,
+				"single_screen_share": rtcConfig.SingleScreenShare,
+			},
+			"emojis": gin.H{
+				"max_per_server": emojis.MaxPerServer,
+				"max_bytes":      emojis.MaxBytes,
+				"max_dimension":  maxEmojiDimension,
+			},
+			"passwords": gin.H{
+				"min_length": auth.PasswordMinLength(),
+			},
+			"push": gin.H{
+				"web_public_key": webPushKey,
+			},
+			"oauth": gin.H{
+				"providers": oauth.EnabledProviders(),
+			},
+			"features": gin.H{
+				"uploads": uploadsEnabled,
+				"email":   emailEnabled,
+				"turn":    rtcConfig.TURN.Enabled(),
+			},
+		},
+	})
+}
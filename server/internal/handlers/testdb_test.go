@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"bafachat/internal/database"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB returns a database in a fresh schema that is dropped when the test
+// ends. Tests that need one are skipped unless TEST_DATABASE_URL points at a
+// PostgreSQL database they may create schemas in.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// One connection, so the search_path set below applies to every query.
+	sqlDB.SetMaxOpenConns(1)
+
+	schema := fmt.Sprintf("handlers_test_%d", time.Now().UnixNano())
+	if err := db.Exec(`CREATE SCHEMA "` + schema + `"`).Error; err != nil {
+		t.Fatalf("create test schema: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = db.Exec(`DROP SCHEMA "` + schema + `" CASCADE`).Error
+		_ = sqlDB.Close()
+	})
+
+	if err := db.Exec(`SET search_path TO "` + schema + `"`).Error; err != nil {
+		t.Fatalf("set search path: %v", err)
+	}
+
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("migrate test schema: %v", err)
+	}
+
+	return db
+}
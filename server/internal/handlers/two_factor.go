@@ -0,0 +1,403 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	twoFactorIssuer          = "BafaChat"
+	twoFactorBackupCodeCount = 10
+
+	// twoFactorChallengeTTL is how long a user has to enter their code after the password step.
+	twoFactorChallengeTTL = 5 * time.Minute
+	// twoFactorChallengeAttempts caps wrong codes per challenge before the login must restart.
+	twoFactorChallengeAttempts = 5
+)
+
+var (
+	errInvalidTwoFactorCode      = errors.New("invalid two-factor code")
+	errInvalidTwoFactorChallenge = errors.New("two-factor challenge is invalid or has expired")
+)
+
+// SetupTwoFactor generates a new TOTP secret for the current user and returns it with
+// an otpauth:// URL for authenticator apps. 2FA is not enforced until VerifyTwoFactor
+// confirms a code from the app.
+func SetupTwoFactor(c *gin.Context) {
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if !auth.TwoFactorAvailable() {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeTwoFactorUnavailable, "two-factor authentication is not configured")
+		return
+	}
+
+	user, ok := loadTwoFactorUser(c, caller.DB, caller.Claims.UserID)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabledAt != nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeTwoFactorEnabled, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate two-factor secret")
+		return
+	}
+
+	encrypted, err := auth.EncryptTwoFactorSecret(secret)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to store two-factor secret")
+		return
+	}
+
+	if err := caller.DB.Model(&user).Update("two_factor_secret", encrypted).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to store two-factor secret")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor setup started",
+		"data": gin.H{
+			"secret":      secret,
+			"otpauth_url": auth.TOTPURL(twoFactorIssuer, user.Email, secret),
+		},
+	})
+}
+
+// VerifyTwoFactor enables 2FA once the user proves their app produces valid codes,
+// and returns a fresh set of single-use backup codes. They are only shown once.
+func VerifyTwoFactor(c *gin.Context) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	user, ok := loadTwoFactorUser(c, caller.DB, caller.Claims.UserID)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabledAt != nil {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeTwoFactorEnabled, "two-factor authentication is already enabled")
+		return
+	}
+
+	if user.TwoFactorSecret == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeTwoFactorNotSetUp, "start two-factor setup first")
+		return
+	}
+
+	secret, err := auth.DecryptTwoFactorSecret(user.TwoFactorSecret)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to read two-factor secret")
+		return
+	}
+
+	step, valid := auth.ValidateTOTP(secret, req.Code, time.Now())
+	if !valid {
+		respondError(c, http.StatusBadRequest, errInvalidTwoFactorCode)
+		return
+	}
+
+	codes, err := auth.GenerateBackupCodes(twoFactorBackupCodeCount)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate backup codes")
+		return
+	}
+
+	now := time.Now()
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorBackupCode{}).Error; err != nil {
+			return err
+		}
+
+		backupCodes := make([]models.TwoFactorBackupCode, 0, len(codes))
+		for _, code := range codes {
+			backupCodes = append(backupCodes, models.TwoFactorBackupCode{
+				UserID:   user.ID,
+				CodeHash: auth.HashToken(auth.NormalizeBackupCode(code)),
+			})
+		}
+		if err := tx.Create(&backupCodes).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_enabled_at": now,
+			"two_factor_last_step":  step,
+		}).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to enable two-factor authentication")
+		return
+	}
+
+	user.TwoFactorEnabledAt = &now
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication enabled",
+		"data": gin.H{
+			"user":         serializeUser(user),
+			"backup_codes": codes,
+		},
+	})
+}
+
+// DisableTwoFactor turns 2FA off after confirming the password and a current TOTP or backup code.
+func DisableTwoFactor(c *gin.Context) {
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, err := resolveActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	user, ok := loadTwoFactorUser(c, caller.DB, caller.Claims.UserID)
+	if !ok {
+		return
+	}
+
+	if user.TwoFactorEnabledAt == nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeTwoFactorNotEnabled, "two-factor authentication is not enabled")
+		return
+	}
+
+	if err := auth.ComparePassword(user.Password, strings.TrimSpace(req.Password)); err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeIncorrectPassword, "current password is incorrect")
+		return
+	}
+
+	if err := consumeTwoFactorCode(caller.DB, &user, req.Code); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			respondError(c, http.StatusUnauthorized, err)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify two-factor code")
+		return
+	}
+
+	if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorBackupCode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.TwoFactorChallenge{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_secret":     "",
+			"two_factor_enabled_at": nil,
+			"two_factor_last_step":  0,
+		}).Error
+	}); err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to disable two-factor authentication")
+		return
+	}
+
+	user.TwoFactorEnabledAt = nil
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication disabled",
+		"data": gin.H{
+			"user": serializeUser(user),
+		},
+	})
+}
+
+// CompleteTwoFactorLogin finishes a login that Login answered with a challenge,
+// issuing the JWT once a valid TOTP or backup code is supplied.
+func CompleteTwoFactorLogin(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+	tx := db.WithContext(c)
+
+	var challenge models.TwoFactorChallenge
+	if err := tx.
+		Where("token_hash = ? AND expires_at > ?", auth.HashToken(strings.TrimSpace(req.ChallengeToken)), time.Now()).
+		First(&challenge).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusUnauthorized, errInvalidTwoFactorChallenge)
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load two-factor challenge")
+		return
+	}
+
+	var user models.User
+	if err := tx.First(&user, challenge.UserID).Error; err != nil || user.TwoFactorEnabledAt == nil {
+		_ = tx.Delete(&challenge).Error
+		respondError(c, http.StatusUnauthorized, errInvalidTwoFactorChallenge)
+		return
+	}
+
+	if err := consumeTwoFactorCode(tx, &user, req.Code); err != nil {
+		if !errors.Is(err, errInvalidTwoFactorCode) {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify two-factor code")
+			return
+		}
+
+		if challenge.Attempts+1 >= twoFactorChallengeAttempts {
+			_ = tx.Delete(&challenge).Error
+		} else {
+			_ = tx.Model(&challenge).Update("attempts", gorm.Expr("attempts + 1")).Error
+		}
+		respondError(c, http.StatusUnauthorized, err)
+		return
+	}
+
+	if err := tx.Delete(&challenge).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to complete two-factor login")
+		return
+	}
+
+	completeLogin(c, db, user)
+}
+
+// startTwoFactorChallenge answers a correct password for a 2FA user with a
+// short-lived challenge token in place of a JWT.
+func startTwoFactorChallenge(c *gin.Context, db *gorm.DB, user models.User) {
+	token, expiresAt, err := createTwoFactorChallenge(c, db, user)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to start two-factor login")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Two-factor authentication required",
+		"data": gin.H{
+			"two_factor_required": true,
+			"challenge_token":     token,
+			"expires_at":          expiresAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// createTwoFactorChallenge stores a new challenge for the user and returns its token.
+func createTwoFactorChallenge(c *gin.Context, db *gorm.DB, user models.User) (string, time.Time, error) {
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	challenge := models.TwoFactorChallenge{
+		UserID:    user.ID,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: now.Add(twoFactorChallengeTTL),
+	}
+
+	tx := db.WithContext(c)
+	_ = tx.Where("user_id = ? AND expires_at <= ?", user.ID, now).Delete(&models.TwoFactorChallenge{}).Error
+
+	if err := tx.Create(&challenge).Error; err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, challenge.ExpiresAt, nil
+}
+
+// consumeTwoFactorCode accepts either a TOTP code, which must be from a newer time
+// step than the last one used, or an unused backup code, which is marked used.
+func consumeTwoFactorCode(db *gorm.DB, user *models.User, code string) error {
+	code = strings.TrimSpace(code)
+
+	if isTOTPCode(code) {
+		secret, err := auth.DecryptTwoFactorSecret(user.TwoFactorSecret)
+		if err != nil {
+			return err
+		}
+
+		step, valid := auth.ValidateTOTP(secret, code, time.Now())
+		if !valid || step <= user.TwoFactorLastStep {
+			return errInvalidTwoFactorCode
+		}
+
+		result := db.Model(&models.User{}).
+			Where("id = ? AND two_factor_last_step < ?", user.ID, step).
+			Update("two_factor_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidTwoFactorCode
+		}
+
+		user.TwoFactorLastStep = step
+		return nil
+	}
+
+	result := db.Model(&models.TwoFactorBackupCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, auth.HashToken(auth.NormalizeBackupCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// loadTwoFactorUser loads the full user row, writing an error response and returning false on failure.
+func loadTwoFactorUser(c *gin.Context, db *gorm.DB, userID uint) (models.User, bool) {
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeUserNotFound, "user not found")
+			return user, false
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load user")
+		return user, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// typingDebounceInterval is the minimum gap between published "typing" signals
+	// from one user in one channel. It stays below the 6 second indicator expiry so
+	// a user who keeps typing never appears to stop.
+	typingDebounceInterval = 3 * time.Second
+	typingKeyPrefix        = "bafachat:typing:"
+)
+
+// typingFallback debounces typing signals in process when Redis is unavailable.
+var typingFallback = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// shouldPublishTyping reports whether a typing signal should be broadcast. Repeated
+// active signals inside typingDebounceInterval are dropped; a stop signal is always
+// published and resets the window so the next keystroke is announced immediately.
+func shouldPublishTyping(c *gin.Context, channelID, userID uint, active bool) bool {
+	key := fmt.Sprintf("%s%d:%d", typingKeyPrefix, channelID, userID)
+
+	if client, ok := getRedisClient(c); ok {
+		ctx := c.Request.Context()
+
+		var err error
+		if !active {
+			if err = client.Del(ctx, key).Err(); err == nil {
+				return true
+			}
+		} else {
+			var claimed bool
+			if claimed, err = client.SetNX(ctx, key, 1, typingDebounceInterval).Result(); err == nil {
+				return claimed
+			}
+		}
+
+		requestLogger(c).Warn("typing: redis unavailable, debouncing in process", "error", err)
+	}
+
+	now := time.Now()
+
+	typingFallback.Lock()
+	defer typingFallback.Unlock()
+
+	if !active {
+		delete(typingFallback.last, key)
+		return true
+	}
+
+	if last, ok := typingFallback.last[key]; ok && now.Sub(last) < typingDebounceInterval {
+		return false
+	}
+
+	if len(typingFallback.last) > 1024 {
+		for staleKey, last := range typingFallback.last {
+			if now.Sub(last) >= typingDebounceInterval {
+				delete(typingFallback.last, staleKey)
+			}
+		}
+	}
+
+	typingFallback.last[key] = now
+	return true
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// markServerReadBatchSize bounds the rows in each upsert MarkServerRead issues.
+const markServerReadBatchSize = 1000
+
+type channelUnreadRow struct {
+	ChannelID uint
+	Count     int64
+}
+
+type latestChannelMessageRow struct {
+	ChannelID uint
+	ID        uint
+	CreatedAt time.Time
+}
+
+// MarkChannelRead records that the current user has read a channel up to a message.
+// Without a message_id the channel is marked read up to its latest message. Other
+// members of small channels are sent a read receipt.
+func MarkChannelRead(c *gin.Context) {
+	caller, channel, err := resolveChannelActor(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var req models.MarkChannelReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid payload")
+		return
+	}
+
+	read := models.ChannelRead{
+		UserID:     caller.Claims.UserID,
+		ChannelID:  channel.ID,
+		LastReadAt: time.Now(),
+	}
+
+	var message models.Message
+	query := caller.DB.Select("id", "created_at").Where("channel_id = ?", channel.ID)
+	if req.MessageID != 0 {
+		query = query.Where("id = ?", req.MessageID)
+	} else {
+		query = query.Order("id DESC")
+	}
+
+	if err := query.First(&message).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load message")
+			return
+		}
+		if req.MessageID != 0 {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeMessageNotFound, "message not found")
+			return
+		}
+	} else {
+		read.LastReadMessageID = message.ID
+		read.LastReadAt = message.CreatedAt
+	}
+
+	// The read pointer only moves forward, so a stale client reporting an older
+	// message cannot bring back unreads that were already cleared.
+	result := caller.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "channel_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "last_read_at", "updated_at"}),
+		Where: clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: "channel_reads.last_read_message_id < excluded.last_read_message_id"},
+		}},
+	}).Create(&read)
+	if result.Error != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to mark channel read")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		publishReadReceipt(c, caller.DB, channel, read)
+	} else if err := caller.DB.
+		Where("user_id = ? AND channel_id = ?", read.UserID, read.ChannelID).
+		First(&read).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load read state")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"channel_id":           read.ChannelID,
+			"last_read_message_id": read.LastReadMessageID,
+			"last_read_at":         read.LastReadAt.Format(time.RFC3339),
+			"unread_count":         0,
+		},
+	})
+}
+
+// GetServerUnreads summarises unread counts for every channel in a server so clients can reconcile badges on reconnect.
+func GetServerUnreads(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	channelIDs, err := visibleServerChannelIDs(caller, serverID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channels")
+		return
+	}
+
+	summary, err := serverUnreadSummary(caller.DB, caller.Claims.UserID, serverID, channelIDs)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load unread counts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": summary})
+}
+
+// MarkServerRead marks every channel the caller can see in a server as read up to
+// its latest message in one transaction, using bulk upserts rather than a write per
+// channel, and returns the new unread summary. Nothing is broadcast.
+func MarkServerRead(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	channelIDs, err := visibleServerChannelIDs(caller, serverID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channels")
+		return
+	}
+
+	var latest []latestChannelMessageRow
+	if len(channelIDs) > 0 {
+		if err := caller.DB.Model(&models.Message{}).
+			Select("DISTINCT ON (messages.channel_id) messages.channel_id, messages.id, messages.created_at").
+			Where("messages.channel_id IN ?", channelIDs).
+			Order("messages.channel_id ASC, messages.id DESC").
+			Scan(&latest).Error; err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load messages")
+			return
+		}
+	}
+
+	latestByChannel := make(map[uint]latestChannelMessageRow, len(latest))
+	for _, row := range latest {
+		latestByChannel[row.ChannelID] = row
+	}
+
+	// Channels without messages are marked read as of now, as MarkChannelRead does.
+	now := time.Now()
+	reads := make([]models.ChannelRead, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		read := models.ChannelRead{
+			UserID:     caller.Claims.UserID,
+			ChannelID:  channelID,
+			LastReadAt: now,
+		}
+		if row, ok := latestByChannel[channelID]; ok {
+			read.LastReadMessageID = row.ID
+			read.LastReadAt = row.CreatedAt
+		}
+		reads = append(reads, read)
+	}
+
+	if len(reads) > 0 {
+		if err := caller.DB.Transaction(func(tx *gorm.DB) error {
+			return tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "channel_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"last_read_message_id", "last_read_at", "updated_at"}),
+			}).CreateInBatches(&reads, markServerReadBatchSize).Error
+		}); err != nil {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to mark server read")
+			return
+		}
+	}
+
+	summary, err := serverUnreadSummary(caller.DB, caller.Claims.UserID, serverID, channelIDs)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load unread counts")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Server marked as read",
+		"data":    summary,
+	})
+}
+
+// visibleServerChannelIDs returns the IDs of the server's channels the caller can see, in display order.
+func visibleServerChannelIDs(caller *actor, serverID uint) ([]uint, error) {
+	canManage := roleHasPermission(caller.Role(), models.PermissionManageChannels)
+
+	var channelIDs []uint
+	err := caller.DB.Model(&models.Channel{}).
+		Scopes(visibleChannels(caller.Claims.UserID, canManage)).
+		Where("server_id = ?", serverID).
+		Order("position ASC, created_at ASC").
+		Pluck("id", &channelIDs).Error
+
+	return channelIDs, err
+}
+
+// serverUnreadSummary builds the per-channel unread counts and read positions for the given channels of a server.
+func serverUnreadSummary(db *gorm.DB, userID, serverID uint, channelIDs []uint) (gin.H, error) {
+	unread, err := channelUnreadCounts(db, userID, channelIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var reads []models.ChannelRead
+	if len(channelIDs) > 0 {
+		if err := db.
+			Where("user_id = ? AND channel_id IN ?", userID, channelIDs).
+			Find(&reads).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	lastRead := make(map[uint]models.ChannelRead, len(reads))
+	for _, read := range reads {
+		lastRead[read.ChannelID] = read
+	}
+
+	var total int64
+	channels := make([]gin.H, 0, len(channelIDs))
+	for _, channelID := range channelIDs {
+		entry := gin.H{
+			"channel_id":   channelID,
+			"unread_count": unread[channelID],
+		}
+		if read, ok := lastRead[channelID]; ok {
+			entry["last_read_message_id"] = read.LastReadMessageID
+			entry["last_read_at"] = read.LastReadAt.Format(time.RFC3339)
+		}
+
+		total += unread[channelID]
+		channels = append(channels, entry)
+	}
+
+	return gin.H{
+		"server_id": serverID,
+		"channels":  channels,
+		"total":     total,
+	}, nil
+}
+
+// channelUnreadCounts counts messages from other users created after the user's last read
+// time in each channel. Channels the user has never read count every such message.
+func channelUnreadCounts(db *gorm.DB, userID uint, channelIDs []uint) (map[uint]int64, error) {
+	counts := make(map[uint]int64, len(channelIDs))
+	if len(channelIDs) == 0 {
+		return counts, nil
+	}
+
+	var rows []channelUnreadRow
+	if err := db.Model(&models.Message{}).
+		Select("messages.channel_id, COUNT(*) AS count").
+		Joins("LEFT JOIN channel_reads ON channel_reads.channel_id = messages.channel_id AND channel_reads.user_id = ?", userID).
+		Where("messages.channel_id IN ?", channelIDs).
+		Where("messages.user_id <> ?", userID).
+		Scopes(unexpiredMessages).
+		Where("(channel_reads.last_read_at IS NULL OR messages.created_at > channel_reads.last_read_at)").
+		Group("messages.channel_id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		counts[row.ChannelID] = row.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMarkChannelReadOnlyMovesForward(t *testing.T) {
+	tests := []struct {
+		name        string
+		upserted    int64
+		wantLastID  uint
+		wantReceipt bool
+	}{
+		{name: "newer message", upserted: 1, wantLastID: 40, wantReceipt: true},
+		{name: "older message", upserted: 0, wantLastID: 50, wantReceipt: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			db, fake := openFakeDB(t, func(query string, _ []driver.Value) (fakeResult, error) {
+				switch {
+				case strings.HasPrefix(query, `SELECT * FROM "channels"`):
+					return fakeResult{columns: []string{"id", "server_id", "type"}, rows: [][]driver.Value{{int64(20), int64(10), models.ChannelTypeText}}}, nil
+				case strings.HasPrefix(query, `SELECT * FROM "server_members"`):
+					return fakeResult{columns: []string{"server_id", "user_id", "role"}, rows: [][]driver.Value{{int64(10), int64(1), models.ServerRoleMember}}}, nil
+				case strings.HasPrefix(query, `SELECT "id","created_at" FROM "messages"`):
+					return fakeResult{columns: []string{"id", "created_at"}, rows: [][]driver.Value{{int64(40), now}}}, nil
+				case strings.HasPrefix(query, `INSERT INTO "channel_reads"`):
+					if !strings.Contains(query, "WHERE channel_reads.last_read_message_id < excluded.last_read_message_id") {
+						t.Errorf("upsert %q does not guard against moving backwards", query)
+					}
+					return fakeResult{affected: tt.upserted}, nil
+				case strings.HasPrefix(query, `SELECT * FROM "channel_reads"`):
+					return fakeResult{columns: []string{"user_id", "channel_id", "last_read_message_id", "last_read_at"}, rows: [][]driver.Value{{int64(1), int64(20), int64(50), now}}}, nil
+				case strings.HasPrefix(query, `SELECT "id","read_receipts_enabled"`):
+					return fakeResult{columns: []string{"id", "read_receipts_enabled"}, rows: [][]driver.Value{{int64(1), false}}}, nil
+				}
+				t.Errorf("unexpected statement %q", query)
+				return fakeResult{}, nil
+			})
+
+			c, w := newHandlerContext(db, 1, http.MethodPost, "/channels/20/read", `{"message_id":40}`, gin.Params{{Key: "id", Value: "20"}})
+			c.Set("wsHub", websocket.NewHub())
+
+			MarkChannelRead(c)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			var body struct {
+				Data struct {
+					LastReadMessageID uint `json:"last_read_message_id"`
+				} `json:"data"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Data.LastReadMessageID != tt.wantLastID {
+				t.Fatalf("last_read_message_id = %d, want %d", body.Data.LastReadMessageID, tt.wantLastID)
+			}
+			if got := fake.ranStatement(`SELECT "id","read_receipts_enabled"`); got != tt.wantReceipt {
+				t.Fatalf("read receipt sent = %v, want %v", got, tt.wantReceipt)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -18,13 +19,13 @@ type lookupUsersRequest struct {
 func LookupUsers(c *gin.Context) {
 	db, ok := getDB(c)
 	if !ok {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
 		return
 	}
 
 	var req lookupUsersRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid request payload")
 		return
 	}
 
@@ -54,7 +55,7 @@ func LookupUsers(c *gin.Context) {
 		Select("id", "username", "avatar").
 		Where("id IN ?", normalized).
 		Find(&users).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to lookup users"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to lookup users")
 		return
 	}
 
@@ -62,9 +63,10 @@ func LookupUsers(c *gin.Context) {
 	found := make(map[uint]struct{}, len(users))
 	for _, user := range users {
 		serialized = append(serialized, gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"avatar":   user.Avatar,
+			"id":             user.ID,
+			"username":       user.Username,
+			"avatar":         user.Avatar,
+			"default_avatar": defaultAvatarURL(user.ID),
 		})
 		found[user.ID] = struct{}{}
 	}
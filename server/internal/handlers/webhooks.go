@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxWebhookContentLength bounds the content accepted from a single webhook call.
+const maxWebhookContentLength = 4000
+
+// CreateChannelWebhook creates an incoming webhook for a text channel. Only server owners may
+// create webhooks, and the secret URL is returned only in this response.
+func CreateChannelWebhook(c *gin.Context) {
+	var req models.CreateChannelWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can create webhooks"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	channelIDValue, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
+		return
+	}
+
+	var channel models.Channel
+	if err := caller.DB.Where("id = ? AND server_id = ?", channelIDValue, serverID).First(&channel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
+		return
+	}
+
+	if channel.Type != models.ChannelTypeText {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "webhooks can only post to text channels")
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
+		return
+	}
+
+	token, err := auth.GenerateRandomToken(32)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to generate webhook token")
+		return
+	}
+
+	webhook := models.ChannelWebhook{
+		ServerID:  serverID,
+		ChannelID: channel.ID,
+		Name:      strings.TrimSpace(req.Name),
+		AvatarURL: strings.TrimSpace(req.AvatarURL),
+		TokenHash: auth.HashToken(token),
+		CreatedBy: caller.Claims.UserID,
+	}
+
+	if err := caller.DB.Create(&webhook).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create webhook")
+		return
+	}
+
+	payload := serializeChannelWebhook(webhook)
+	payload["token"] = token
+	payload["url"] = fmt.Sprintf("%s/api/v1/webhooks/%s", requestBaseURL(c), token)
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created. Copy the URL now; it will not be shown again.",
+		"data": gin.H{
+			"webhook": payload,
+		},
+	})
+}
+
+// ExecuteWebhook posts a message to the webhook's channel on behalf of an external system.
+func ExecuteWebhook(c *gin.Context) {
+	var req models.ExecuteWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeContentRequired, "message content is required")
+		return
+	}
+
+	if utf8.RuneCountInString(content) > maxWebhookContentLength {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeMessageTooLong, fmt.Sprintf("message content must be at most %d characters", maxWebhookContentLength))
+		return
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+
+	var webhook models.ChannelWebhook
+	if err := db.WithContext(c).Where("token_hash = ?", auth.HashToken(c.Param("token"))).First(&webhook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeWebhookNotFound, "webhook not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load webhook")
+		return
+	}
+
+	var channel models.Channel
+	if err := db.WithContext(c).First(&channel, webhook.ChannelID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeWebhookNotFound, "webhook not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
+		return
+	}
+
+	if channel.ArchivedAt != nil {
+		respondError(c, http.StatusForbidden, errChannelArchived)
+		return
+	}
+
+	if !enforceMessageRateLimit(c, channel.ID, fmt.Sprintf("webhook:%d", webhook.ID)) {
+		return
+	}
+
+	content, ok = filterMessageContent(c, db.WithContext(c), channel.ServerID, content,
+		"channel_id", channel.ID, "webhook_id", webhook.ID)
+	if !ok {
+		return
+	}
+
+	username := strings.TrimSpace(req.Username)
+	if username == "" {
+		username = webhook.Name
+	}
+
+	avatarURL := strings.TrimSpace(req.AvatarURL)
+	if avatarURL == "" {
+		avatarURL = webhook.AvatarURL
+	}
+
+	message := models.Message{
+		Content:       content,
+		UserID:        webhook.CreatedBy,
+		ChannelID:     channel.ID,
+		Type:          models.MessageTypeText,
+		WebhookID:     &webhook.ID,
+		WebhookName:   username,
+		WebhookAvatar: avatarURL,
+		ExpiresAt:     messageExpiry(channel, nil, time.Now()),
+	}
+
+	if err := db.WithContext(c).Create(&message).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to create message")
+		return
+	}
+
+	serialized := serializeMessage(message)
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Message created",
+		"data": gin.H{
+			"message": serialized,
+		},
+	})
+
+	publishToChannel(c, db, channel, websocket.MessageCreated(serialized, channel.ID, channel.ServerID))
+
+	queueLinkPreview(c, db, message)
+}
+
+// requestBaseURL reconstructs the public origin of the API from the incoming request.
+func requestBaseURL(c *gin.Context) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := strings.TrimSpace(c.GetHeader("X-Forwarded-Proto")); forwarded != "" {
+		scheme = strings.ToLower(strings.Split(forwarded, ",")[0])
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
+
+func serializeChannelWebhook(webhook models.ChannelWebhook) gin.H {
+	return gin.H{
+		"id":         webhook.ID,
+		"server_id":  webhook.ServerID,
+		"channel_id": webhook.ChannelID,
+		"name":       webhook.Name,
+		"avatar_url": webhook.AvatarURL,
+		"created_by": webhook.CreatedBy,
+		"created_at": webhook.CreatedAt.Format(time.RFC3339),
+	}
+}
@@ -6,6 +6,7 @@ import (
     "strconv"
     "time"
 
+    "bafachat/internal/apierror"
     "bafachat/internal/models"
 
     "github.com/gin-gonic/gin"
@@ -13,13 +14,14 @@ import (
 )
 
 type joinWebRTCResponse struct {
-    SessionToken string                 `json:"session_token"`
-    ExpiresAt    string                 `json:"expires_at"`
-    Channel      gin.H                  `json:"channel"`
-    Participant  gin.H                  `json:"participant"`
-    Participants []map[string]any       `json:"participants"`
-    ICEServers   interface{}            `json:"iceservers"`
-    SFU          interface{}            `json:"sfu"`
+    SessionToken  string           `json:"session_token"`
+    ExpiresAt     string           `json:"expires_at"`
+    Channel       gin.H            `json:"channel"`
+    Participant   gin.H            `json:"participant"`
+    Participants  []map[string]any `json:"participants"`
+    ScreenSharers []uint           `json:"screen_sharers"`
+    ICEServers    interface{}      `json:"iceservers"`
+    SFU           interface{}      `json:"sfu"`
 }
 
 type leaveWebRTCRequest struct {
@@ -30,53 +32,53 @@ type leaveWebRTCRequest struct {
 func JoinWebRTCChannel(c *gin.Context) {
     db, ok := getDB(c)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
         return
     }
 
     claims, ok := getUserClaims(c)
     if !ok {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+        apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
         return
     }
 
     rtcManager, ok := getWebRTCManager(c)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "signaling manager unavailable"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "signaling manager unavailable")
         return
     }
 
     rtcConfig, ok := getWebRTCConfig(c)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "signaling configuration unavailable"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "signaling configuration unavailable")
         return
     }
 
     hub, ok := getWebSocketHub(c)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "websocket hub unavailable"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "websocket hub unavailable")
         return
     }
 
     channelIDParam := c.Param("id")
     channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
     if err != nil || channelIDValue == 0 {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+        apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
         return
     }
 
     var channel models.Channel
     if err := db.WithContext(c).First(&channel, channelIDValue).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+            apierror.Respond(c, http.StatusNotFound, apierror.CodeChannelNotFound, "channel not found")
             return
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to load channel"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
         return
     }
 
     if channel.Type != models.ChannelTypeAudio {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "channel does not support realtime media"})
+        apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotAudioChannel, "channel does not support realtime media")
         return
     }
 
@@ -85,16 +87,34 @@ func JoinWebRTCChannel(c *gin.Context) {
         Where("server_id = ? AND user_id = ?", channel.ServerID, claims.UserID).
         First(&membership).Error; err != nil {
         if errors.Is(err, gorm.ErrRecordNotFound) {
-            c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+            apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
             return
         }
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
         return
     }
 
-    session, err := rtcManager.Issue(claims.UserID, channel.ID, claims.Username, membership.Role)
+    if err := ensureChannelAccess(db.WithContext(c), channel, claims.UserID); err != nil {
+        respondChannelAccessError(c, err)
+        return
+    }
+
+    maxParticipants := rtcConfig.MaxParticipants
+    if channel.MaxParticipants > 0 {
+        maxParticipants = channel.MaxParticipants
+    }
+
+    // Reserve a seat before issuing the token so concurrent joins cannot both
+    // pass the limit while neither has authenticated over the websocket yet.
+    if !hub.ReserveParticipantSlot(channel.ID, claims.UserID, maxParticipants, rtcManager.TTL()) {
+        apierror.Respond(c, http.StatusConflict, apierror.CodeChannelFull, "channel is full")
+        return
+    }
+
+    session, err := rtcManager.Issue(claims.UserID, channel.ID, memberDisplayName(membership.Nickname, claims.Username), membership.Role)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to issue session token"})
+        hub.ReleaseParticipantSlot(channel.ID, claims.UserID)
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to issue session token")
         return
     }
 
@@ -107,6 +127,7 @@ func JoinWebRTCChannel(c *gin.Context) {
             "role":          participant.Role,
             "session_id":    participant.SessionID,
             "media_state":   participant.MediaState,
+            "hand_raised":   participant.HandRaised,
             "channel_id":    participant.ChannelID,
             "last_seen":     participant.LastSeen.Format(time.RFC3339),
         })
@@ -130,10 +151,12 @@ func JoinWebRTCChannel(c *gin.Context) {
                 "camera": "off",
                 "screen": "off",
             },
+            "hand_raised": false,
         },
-        Participants: serializedParticipants,
-        ICEServers:   rtcConfig.ICEServers,
-        SFU:          nil,
+        Participants:  serializedParticipants,
+        ScreenSharers: hub.ScreenSharers(channel.ID),
+        ICEServers:    rtcConfig.ICEServersFor(claims.UserID, time.Now()),
+        SFU:           nil,
     }
 
     c.JSON(http.StatusOK, gin.H{"data": response})
@@ -143,37 +166,37 @@ func JoinWebRTCChannel(c *gin.Context) {
 func LeaveWebRTCChannel(c *gin.Context) {
     db, ok := getDB(c)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "database connection unavailable"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
         return
     }
 
     claims, ok := getUserClaims(c)
     if !ok {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+        apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
         return
     }
 
     rtcManager, ok := getWebRTCManager(c)
     if !ok {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "signaling manager unavailable"})
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "signaling manager unavailable")
         return
     }
 
     channelIDParam := c.Param("id")
     channelIDValue, err := strconv.ParseUint(channelIDParam, 10, 64)
     if err != nil || channelIDValue == 0 {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "invalid channel id"})
+        apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidID, "invalid channel id")
         return
     }
 
     var payload leaveWebRTCRequest
     if err := c.ShouldBindJSON(&payload); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        respondError(c, http.StatusBadRequest, err)
         return
     }
 
     if payload.SessionToken == "" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "session token is required"})
+        apierror.Respond(c, http.StatusBadRequest, apierror.CodeTokenRequired, "session token is required")
         return
     }
 
@@ -184,13 +207,45 @@ func LeaveWebRTCChannel(c *gin.Context) {
     if err := ensureServerMembership(db.WithContext(c), uint(channelIDValue), claims.UserID); err != nil {
         switch err {
         case errServerMembershipRequired:
-            c.JSON(http.StatusForbidden, gin.H{"error": "membership required"})
+            apierror.Respond(c, http.StatusForbidden, apierror.CodeMembershipRequired, "membership required")
             return
         default:
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to verify membership"})
+            apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to verify membership")
             return
         }
     }
 
     c.Status(http.StatusNoContent)
 }
+
+// GetTURNCredentials issues short-lived TURN credentials for the current user.
+func GetTURNCredentials(c *gin.Context) {
+    claims, ok := getUserClaims(c)
+    if !ok {
+        apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "authentication required")
+        return
+    }
+
+    rtcConfig, ok := getWebRTCConfig(c)
+    if !ok {
+        apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "signaling configuration unavailable")
+        return
+    }
+
+    if !rtcConfig.TURN.Enabled() {
+        apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeTURNDisabled, "turn credentials are not configured")
+        return
+    }
+
+    creds := rtcConfig.TURN.Credentials(claims.UserID, time.Now())
+
+    c.JSON(http.StatusOK, gin.H{
+        "data": gin.H{
+            "urls":       creds.URLs,
+            "username":   creds.Username,
+            "credential": creds.Credential,
+            "ttl":        int(creds.TTL.Seconds()),
+            "expires_at": creds.ExpiresAt.Format(time.RFC3339),
+        },
+    })
+}
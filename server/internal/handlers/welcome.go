@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultWelcomeMessage = "Welcome {user} to {server}!"
+
+// UpdateServerWelcome configures the channel and template used to greet new members.
+func UpdateServerWelcome(c *gin.Context) {
+	var req models.UpdateServerWelcomeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can configure welcome messages"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	var server models.Server
+	if err := caller.DB.First(&server, serverID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeServerNotFound, "server not found")
+			return
+		}
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load server")
+		return
+	}
+
+	if req.ChannelID != nil {
+		if *req.ChannelID == 0 {
+			server.WelcomeChannelID = nil
+		} else {
+			var channel models.Channel
+			if err := caller.DB.
+				Where("id = ? AND server_id = ?", *req.ChannelID, serverID).
+				First(&channel).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidWelcomeChannel, "welcome channel must belong to this server")
+					return
+				}
+				apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load channel")
+				return
+			}
+
+			if channel.Type != models.ChannelTypeText {
+				apierror.Respond(c, http.StatusBadRequest, apierror.CodeNotTextChannel, "welcome channel must be a text channel")
+				return
+			}
+
+			if channel.ArchivedAt != nil {
+				apierror.Respond(c, http.StatusConflict, apierror.CodeChannelArchived, "welcome channel is archived")
+				return
+			}
+
+			channelID := channel.ID
+			server.WelcomeChannelID = &channelID
+		}
+	}
+
+	if req.Message != nil {
+		server.WelcomeMessage = strings.TrimSpace(*req.Message)
+	}
+
+	if err := caller.DB.Model(&server).Updates(map[string]interface{}{
+		"welcome_channel_id": server.WelcomeChannelID,
+		"welcome_message":    server.WelcomeMessage,
+	}).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update welcome settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Welcome settings updated",
+		"data": gin.H{
+			"server_id":          server.ID,
+			"welcome_channel_id": server.WelcomeChannelID,
+			"welcome_message":    server.WelcomeMessage,
+		},
+	})
+}
+
+// handleMemberJoined runs the side effects of a user becoming an active member of a server.
+func handleMemberJoined(c *gin.Context, serverID, userID uint) {
+	if hub, ok := getWebSocketHub(c); ok {
+		hub.AddServerMember(serverID, userID)
+	}
+
+	db, ok := getDB(c)
+	if !ok {
+		return
+	}
+
+	if err := postWelcomeMessage(c, db, serverID, userID); err != nil {
+		requestLogger(c).Error("failed to post welcome message", "user_id", userID, "server_id", serverID, "error", err)
+	}
+}
+
+// postWelcomeMessage posts the server's welcome template as a system message when one is configured.
+func postWelcomeMessage(c *gin.Context, db *gorm.DB, serverID, userID uint) error {
+	var server models.Server
+	if err := db.WithContext(c).First(&server, serverID).Error; err != nil {
+		return err
+	}
+
+	if server.WelcomeChannelID == nil {
+		return nil
+	}
+
+	var channel models.Channel
+	if err := db.WithContext(c).First(&channel, *server.WelcomeChannelID).Error; err != nil {
+		return err
+	}
+
+	// An archived channel no longer accepts messages, welcome messages included.
+	if channel.ArchivedAt != nil {
+		return nil
+	}
+
+	var user models.User
+	if err := db.WithContext(c).Select("id", "username", "email", "avatar").First(&user, userID).Error; err != nil {
+		return err
+	}
+
+	message := models.Message{
+		Content:   renderWelcomeMessage(server, user),
+		UserID:    user.ID,
+		ChannelID: channel.ID,
+		Type:      models.MessageTypeSystem,
+		ExpiresAt: messageExpiry(channel, nil, time.Now()),
+	}
+	if err := db.WithContext(c).Create(&message).Error; err != nil {
+		return err
+	}
+	message.User = user
+
+	publishToChannel(c, db, channel, websocket.MessageCreated(serializeMessage(message), channel.ID, serverID))
+
+	return nil
+}
+
+// renderWelcomeMessage fills the {user} and {server} placeholders in the welcome template.
+func renderWelcomeMessage(server models.Server, user models.User) string {
+	template := server.WelcomeMessage
+	if template == "" {
+		template = defaultWelcomeMessage
+	}
+
+	return strings.NewReplacer(
+		"{user}", "@"+user.Username,
+		"{server}", server.Name,
+	).Replace(template)
+}
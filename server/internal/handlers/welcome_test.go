@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+	"bafachat/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+	gorillaws "github.com/gorilla/websocket"
+)
+
+// welcomeDB answers the welcome handlers' queries for server 10, owned by user
+// 1, whose welcome channel 20 is the given row and has user 3 as its only member.
+func welcomeDB(t *testing.T, channel []driver.Value) fakeQueryFunc {
+	t.Helper()
+
+	return func(query string, _ []driver.Value) (fakeResult, error) {
+		switch {
+		case strings.HasPrefix(query, `SELECT * FROM "servers"`):
+			return fakeResult{
+				columns: []string{"id", "name", "owner_id", "welcome_channel_id"},
+				rows:    [][]driver.Value{{int64(10), "gophers", int64(1), int64(20)}},
+			}, nil
+		case strings.HasPrefix(query, `SELECT * FROM "server_members"`):
+			return fakeResult{columns: []string{"server_id", "user_id", "role"}, rows: [][]driver.Value{{int64(10), int64(1), models.ServerRoleOwner}}}, nil
+		case strings.HasPrefix(query, `SELECT * FROM "channels"`):
+			return fakeResult{columns: []string{"id", "server_id", "name", "type", "private", "archived_at", "message_ttl_seconds"}, rows: [][]driver.Value{channel}}, nil
+		case strings.HasPrefix(query, `SELECT "id","username"`):
+			return fakeResult{columns: []string{"id", "username"}, rows: [][]driver.Value{{int64(2), "jane"}}}, nil
+		case strings.HasPrefix(query, `INSERT INTO "messages"`):
+			return fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(100)}}, affected: 1}, nil
+		case strings.Contains(query, `FROM "channel_members"`):
+			return fakeResult{columns: []string{"user_id"}, rows: [][]driver.Value{{int64(3)}}}, nil
+		case strings.Contains(query, `FROM "server_members"`):
+			return fakeResult{columns: []string{"user_id"}, rows: [][]driver.Value{{int64(1)}}}, nil
+		}
+		t.Errorf("unexpected statement %q", query)
+		return fakeResult{}, nil
+	}
+}
+
+// connectHubClient opens a websocket connection to hub as userID and waits
+// until the hub has registered it.
+func connectHubClient(t *testing.T, hub *websocket.Hub, url string, userID uint) *gorillaws.Conn {
+	t.Helper()
+
+	token, _, err := auth.GenerateJWT(models.User{ID: userID}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _, err := gorillaws.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http")+"/ws?token="+token, nil)
+	if err != nil {
+		t.Fatalf("dial websocket: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !hub.IsOnline(userID) {
+		if time.Now().After(deadline) {
+			t.Fatalf("user %d never registered with the hub", userID)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return conn
+}
+
+// nextEventOf reads events until one of the given types arrives and returns its type.
+func nextEventOf(t *testing.T, conn *gorillaws.Conn, types ...string) string {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var event struct {
+			Type string `json:"type"`
+		}
+		if err := conn.ReadJSON(&event); err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		for _, eventType := range types {
+			if event.Type == eventType {
+				return event.Type
+			}
+		}
+	}
+}
+
+func TestPostWelcomeMessageStaysInPrivateChannel(t *testing.T) {
+	t.Setenv("JWT_SECRET", "welcome-test-secret")
+
+	db, _ := openFakeDB(t, welcomeDB(t, []driver.Value{int64(20), int64(10), "welcome", models.ChannelTypeText, true, nil, int64(0)}))
+
+	hub := websocket.NewHub()
+	go hub.Run()
+	t.Cleanup(func() { _ = hub.Shutdown(context.Background()) })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/ws", func(c *gin.Context) { websocket.HandleWebSocket(hub, nil, c) })
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	member := connectHubClient(t, hub, server.URL, 3)
+	outsider := connectHubClient(t, hub, server.URL, 4)
+
+	c, _ := newHandlerContext(db, 2, http.MethodPost, "/servers/10/join", "", nil)
+	c.Set("wsHub", hub)
+	if err := postWelcomeMessage(c, db, 10, 2); err != nil {
+		t.Fatalf("postWelcomeMessage: %v", err)
+	}
+
+	if got := nextEventOf(t, member, websocket.EventMessageCreated); got != websocket.EventMessageCreated {
+		t.Fatalf("channel member got %q, want %q", got, websocket.EventMessageCreated)
+	}
+	// The welcome message reached its recipients' queues before the member read
+	// it, so a later event cannot overtake it on the outsider's connection.
+	if err := hub.Publish(websocket.NewEvent(websocket.EventEmojiCreated, gin.H{"server_id": 10})); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextEventOf(t, outsider, websocket.EventMessageCreated, websocket.EventEmojiCreated); got != websocket.EventEmojiCreated {
+		t.Fatalf("server member outside the private welcome channel received %q", got)
+	}
+}
+
+func TestWelcomeSkipsArchivedChannel(t *testing.T) {
+	archived := []driver.Value{int64(20), int64(10), "welcome", models.ChannelTypeText, false, time.Now(), int64(0)}
+
+	db, fake := openFakeDB(t, welcomeDB(t, archived))
+	c, _ := newHandlerContext(db, 2, http.MethodPost, "/servers/10/join", "", nil)
+	if err := postWelcomeMessage(c, db, 10, 2); err != nil {
+		t.Fatalf("postWelcomeMessage: %v", err)
+	}
+	if fake.ranStatement(`INSERT INTO "messages"`) {
+		t.Fatal("welcome message posted into an archived channel")
+	}
+
+	db, fake = openFakeDB(t, welcomeDB(t, archived))
+	params := gin.Params{{Key: "serverID", Value: "10"}}
+	c, w := newHandlerContext(db, 1, http.MethodPut, "/servers/10/welcome", `{"channel_id":20}`, params)
+	UpdateServerWelcome(c)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("UpdateServerWelcome status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if code := responseCode(t, w); code != apierror.CodeChannelArchived {
+		t.Fatalf("UpdateServerWelcome code = %q, want %q", code, apierror.CodeChannelArchived)
+	}
+	if fake.ranStatement("UPDATE") {
+		t.Fatal("archived channel saved as the welcome channel")
+	}
+}
+
+func TestWelcomeMessageFollowsChannelTTL(t *testing.T) {
+	answer := welcomeDB(t, []driver.Value{int64(20), int64(10), "welcome", models.ChannelTypeText, false, nil, int64(3600)})
+
+	var expiresAt driver.Value
+	db, _ := openFakeDB(t, func(query string, args []driver.Value) (fakeResult, error) {
+		if strings.HasPrefix(query, `INSERT INTO "messages"`) {
+			columns := strings.Split(query[strings.Index(query, "(")+1:strings.Index(query, ")")], ",")
+			if i := slices.Index(columns, `"expires_at"`); i >= 0 {
+				expiresAt = args[i]
+			}
+		}
+		return answer(query, args)
+	})
+
+	before := time.Now()
+	c, _ := newHandlerContext(db, 2, http.MethodPost, "/servers/10/join", "", nil)
+	if err := postWelcomeMessage(c, db, 10, 2); err != nil {
+		t.Fatalf("postWelcomeMessage: %v", err)
+	}
+
+	got, ok := expiresAt.(time.Time)
+	if !ok {
+		t.Fatalf("expires_at = %v, want a time", expiresAt)
+	}
+	if got.Before(before.Add(time.Hour)) || got.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("expires_at = %v, want an hour after posting", got)
+	}
+}
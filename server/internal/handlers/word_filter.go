@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var errMessageBlocked = errors.New("message contains a term this server does not allow")
+
+// GetServerWordFilter returns the server's blocked terms and what happens to
+// messages that use them. Only the owner can see the list.
+func GetServerWordFilter(c *gin.Context) {
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can view the word filter"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	filter, err := loadServerWordFilter(caller.DB, serverID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load word filter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"word_filter": serializeServerWordFilter(filter),
+		},
+	})
+}
+
+// UpdateServerWordFilter replaces the server's blocked terms or changes the
+// action taken on matching messages.
+func UpdateServerWordFilter(c *gin.Context) {
+	var req models.UpdateServerWordFilterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondError(c, http.StatusBadRequest, err)
+		return
+	}
+
+	caller, serverID, err := resolveServerActorFromParam(c)
+	if err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	if err := caller.RequireOwner("only server owners can configure the word filter"); err != nil {
+		respondActorError(c, err)
+		return
+	}
+
+	filter, err := loadServerWordFilter(caller.DB, serverID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load word filter")
+		return
+	}
+
+	if req.Terms != nil {
+		terms := make([]string, 0, len(*req.Terms))
+		for _, term := range *req.Terms {
+			term = strings.ToLower(strings.Join(strings.Fields(term), " "))
+			if term == "" || slices.Contains(terms, term) {
+				continue
+			}
+			terms = append(terms, term)
+		}
+		filter.Terms = strings.Join(terms, "\n")
+	}
+
+	if req.Action != nil {
+		filter.Action = *req.Action
+	}
+
+	if err := caller.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&filter).Error; err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to update word filter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Word filter updated",
+		"data": gin.H{
+			"word_filter": serializeServerWordFilter(filter),
+		},
+	})
+}
+
+// filterMessageContent applies the server's word filter to message content
+// before it is stored. Blocked messages get a 422 response, are written to the
+// audit log and return false; masked terms come back as asterisks. The log
+// arguments identify who sent the message.
+func filterMessageContent(c *gin.Context, db *gorm.DB, serverID uint, content string, logArgs ...any) (string, bool) {
+	if content == "" {
+		return content, true
+	}
+
+	filter, err := loadServerWordFilter(db, serverID)
+	if err != nil {
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to load word filter")
+		return "", false
+	}
+
+	matches := matchFilteredTerms(wordFilterTerms(filter), content)
+	if len(matches) == 0 {
+		return content, true
+	}
+
+	if filter.Action == models.WordFilterActionMask {
+		var masked strings.Builder
+		last := 0
+		for _, match := range matches {
+			masked.WriteString(content[last:match[0]])
+			masked.WriteString(strings.Repeat("*", utf8.RuneCountInString(content[match[0]:match[1]])))
+			last = match[1]
+		}
+		masked.WriteString(content[last:])
+		return masked.String(), true
+	}
+
+	requestLogger(c).Info("audit: message blocked by word filter",
+		append([]any{"server_id", serverID, "matches", len(matches)}, logArgs...)...)
+	respondError(c, http.StatusUnprocessableEntity, errMessageBlocked)
+	return "", false
+}
+
+// matchFilteredTerms returns the byte ranges of content that match a term,
+// case-insensitively. A term only matches as a whole word, so "ass" does not
+// match inside "class".
+func matchFilteredTerms(terms []string, content string) [][2]int {
+	if len(terms) == 0 {
+		return nil
+	}
+
+	// Longer terms first, so a phrase wins over a term it starts with.
+	sorted := slices.Clone(terms)
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+	quoted := make([]string, 0, len(sorted))
+	for _, term := range sorted {
+		quoted = append(quoted, regexp.QuoteMeta(term))
+	}
+	pattern := regexp.MustCompile("(?i)(?:" + strings.Join(quoted, "|") + ")")
+
+	var matches [][2]int
+	for offset := 0; offset < len(content); {
+		loc := pattern.FindStringIndex(content[offset:])
+		if loc == nil {
+			break
+		}
+
+		start, end := offset+loc[0], offset+loc[1]
+		if isWholeWord(content, start, end) {
+			matches = append(matches, [2]int{start, end})
+			offset = end
+			continue
+		}
+
+		_, size := utf8.DecodeRuneInString(content[start:])
+		offset = start + size
+	}
+
+	return matches
+}
+
+// isWholeWord reports whether content[start:end] is not part of a longer word.
+func isWholeWord(content string, start, end int) bool {
+	if start > 0 {
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		first, _ := utf8.DecodeRuneInString(content[start:end])
+		if isWordRune(before) && isWordRune(first) {
+			return false
+		}
+	}
+
+	if end < len(content) {
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		last, _ := utf8.DecodeLastRuneInString(content[start:end])
+		if isWordRune(after) && isWordRune(last) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// loadServerWordFilter returns the server's word filter, or an empty blocking
+// filter if it has none.
+func loadServerWordFilter(db *gorm.DB, serverID uint) (models.ServerWordFilter, error) {
+	var filter models.ServerWordFilter
+	if err := db.Where("server_id = ?", serverID).First(&filter).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.ServerWordFilter{ServerID: serverID, Action: models.WordFilterActionBlock}, nil
+		}
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func wordFilterTerms(filter models.ServerWordFilter) []string {
+	if filter.Terms == "" {
+		return []string{}
+	}
+
+	return strings.Split(filter.Terms, "\n")
+}
+
+func serializeServerWordFilter(filter models.ServerWordFilter) gin.H {
+	terms := wordFilterTerms(filter)
+	return gin.H{
+		"server_id": filter.ServerID,
+		"terms":     terms,
+		"action":    filter.Action,
+		"enabled":   len(terms) > 0,
+	}
+}
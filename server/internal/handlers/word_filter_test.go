@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMatchFilteredTerms(t *testing.T) {
+	tests := []struct {
+		name    string
+		terms   []string
+		content string
+		want    []string
+	}{
+		{name: "no terms", terms: nil, content: "anything goes", want: nil},
+		{name: "case insensitive", terms: []string{"darn"}, content: "Darn it, DARN", want: []string{"Darn", "DARN"}},
+		{name: "not inside a word", terms: []string{"ass"}, content: "first class assets", want: nil},
+		{name: "whole word next to punctuation", terms: []string{"ass"}, content: "(ass!)", want: []string{"ass"}},
+		{name: "phrase beats its prefix", terms: []string{"bad", "bad word"}, content: "a bad word here", want: []string{"bad word"}},
+		{name: "retries after a partial match", terms: []string{"cat"}, content: "concat cat", want: []string{"cat"}},
+		{name: "non-ascii letters are word runes", terms: []string{"fun"}, content: "éfun fun", want: []string{"fun"}},
+		{name: "term with regexp characters", terms: []string{"a.b"}, content: "axb a.b", want: []string{"a.b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, match := range matchFilteredTerms(tt.terms, tt.content) {
+				got = append(got, tt.content[match[0]:match[1]])
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("matchFilteredTerms(%q, %q) = %q, want %q", tt.terms, tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerializeServerWordFilter(t *testing.T) {
+	empty := serializeServerWordFilter(models.ServerWordFilter{ServerID: 1, Action: models.WordFilterActionBlock})
+	if empty["enabled"] != false {
+		t.Fatalf("enabled = %v for a filter without terms, want false", empty["enabled"])
+	}
+	if terms, ok := empty["terms"].([]string); !ok || terms == nil || len(terms) != 0 {
+		t.Fatalf("terms = %#v, want an empty list", empty["terms"])
+	}
+
+	filter := serializeServerWordFilter(models.ServerWordFilter{ServerID: 1, Terms: "darn\nbad word", Action: models.WordFilterActionMask})
+	if filter["enabled"] != true {
+		t.Fatalf("enabled = %v, want true", filter["enabled"])
+	}
+	if terms := filter["terms"].([]string); !slices.Equal(terms, []string{"darn", "bad word"}) {
+		t.Fatalf("terms = %q, want [darn bad word]", terms)
+	}
+}
+
+func TestFilterMessageContent(t *testing.T) {
+	db := openTestDB(t)
+	gin.SetMode(gin.TestMode)
+
+	owner := models.User{Username: "owner", Email: "owner@example.com", Password: "x"}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	masked := models.Server{Name: "masked", OwnerID: owner.ID}
+	blocked := models.Server{Name: "blocked", OwnerID: owner.ID}
+	unfiltered := models.Server{Name: "unfiltered", OwnerID: owner.ID}
+	for _, server := range []*models.Server{&masked, &blocked, &unfiltered} {
+		if err := db.Create(server).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	filters := []models.ServerWordFilter{
+		{ServerID: masked.ID, Terms: "darn", Action: models.WordFilterActionMask},
+		{ServerID: blocked.ID, Terms: "darn", Action: models.WordFilterActionBlock},
+	}
+	if err := db.Create(&filters).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		serverID   uint
+		content    string
+		want       string
+		wantOK     bool
+		wantStatus int
+	}{
+		{name: "mask", serverID: masked.ID, content: "Darn, it broke", want: "****, it broke", wantOK: true},
+		{name: "block", serverID: blocked.ID, content: "darn", wantOK: false, wantStatus: http.StatusUnprocessableEntity},
+		{name: "clean content", serverID: blocked.ID, content: "all good", want: "all good", wantOK: true},
+		{name: "no filter", serverID: unfiltered.ID, content: "darn", want: "darn", wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+			got, ok := filterMessageContent(c, db, tt.serverID, tt.content)
+			if ok != tt.wantOK || got != tt.want {
+				t.Fatalf("filterMessageContent(%q) = %q, %v; want %q, %v", tt.content, got, ok, tt.want, tt.wantOK)
+			}
+			if !tt.wantOK && w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+// Package logging configures the process-wide structured logger and carries
+// request IDs through contexts so log lines can be correlated per request.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type contextKey struct{}
+
+// Setup installs a slog logger as the default. LOG_FORMAT selects "json" (the
+// default) or "text" output and LOG_LEVEL sets the minimum level (debug, info,
+// warn, error). Because slog.SetDefault also redirects the standard log
+// package, any remaining log.Printf output is emitted in the same format.
+func Setup() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(os.Getenv("LOG_LEVEL")))); err != nil {
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("LOG_FORMAT")), "text") {
+		handler = slog.NewTextHandler(os.Stdout, options)
+	} else {
+		handler = slog.NewJSONHandler(os.Stdout, options)
+	}
+
+	logger := slog.New(handler)
+	slog.SetDefault(logger)
+	return logger
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// RequestID returns the request ID stored in ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
+
+// FromContext returns the default logger, tagged with the request ID when ctx has one.
+func FromContext(ctx context.Context) *slog.Logger {
+	logger := slog.Default()
+	if requestID := RequestID(ctx); requestID != "" {
+		logger = logger.With("request_id", requestID)
+	}
+	return logger
+}
@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-123")
+	if got := RequestID(ctx); got != "req-123" {
+		t.Fatalf("RequestID = %q, want %q", got, "req-123")
+	}
+	if got := RequestID(context.Background()); got != "" {
+		t.Fatalf("RequestID without an ID = %q, want empty", got)
+	}
+	if got := RequestID(nil); got != "" {
+		t.Fatalf("RequestID(nil) = %q, want empty", got)
+	}
+}
+
+func TestFromContextTagsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	FromContext(WithRequestID(context.Background(), "req-123")).Info("tagged")
+	FromContext(context.Background()).Info("untagged")
+
+	decoder := json.NewDecoder(&buf)
+	var tagged, untagged map[string]any
+	if err := decoder.Decode(&tagged); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoder.Decode(&untagged); err != nil {
+		t.Fatal(err)
+	}
+
+	if tagged["request_id"] != "req-123" {
+		t.Fatalf("tagged line = %v, want request_id req-123", tagged)
+	}
+	if _, ok := untagged["request_id"]; ok {
+		t.Fatalf("untagged line = %v, want no request_id", untagged)
+	}
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"bafachat/internal/apierror"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminTokenMiddleware guards operator endpoints with the shared ADMIN_API_TOKEN,
+// sent as "Authorization: Bearer <token>". When the variable is unset the
+// endpoints are disabled and respond 404.
+func AdminTokenMiddleware() gin.HandlerFunc {
+	token := strings.TrimSpace(os.Getenv("ADMIN_API_TOKEN"))
+
+	return func(c *gin.Context) {
+		if token == "" {
+			apierror.Abort(c, http.StatusNotFound, apierror.CodeNotFound, "not found")
+			return
+		}
+
+		parts := strings.Fields(c.GetHeader("Authorization"))
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") ||
+			subtle.ConstantTimeCompare([]byte(parts[1]), []byte(token)) != 1 {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "invalid admin token")
+			return
+		}
+
+		c.Next()
+	}
+}
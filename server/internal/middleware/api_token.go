@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// apiTokenRouteScopes lists the only routes API tokens may call, keyed by method
+// and route pattern, with the scope each one requires.
+var apiTokenRouteScopes = map[string]string{
+	"GET /api/v1/users/me":                                models.APITokenScopeServersRead,
+	"POST /api/v1/users/lookup":                           models.APITokenScopeServersRead,
+	"GET /api/v1/servers/:serverID":                       models.APITokenScopeServersRead,
+	"GET /api/v1/servers/:serverID/channels":              models.APITokenScopeServersRead,
+	"GET /api/v1/servers/:serverID/members":               models.APITokenScopeServersRead,
+	"GET /api/v1/channels/:id/messages":                   models.APITokenScopeMessagesRead,
+	"GET /api/v1/channels/:id/attachments/:attachmentID":  models.APITokenScopeMessagesRead,
+	"POST /api/v1/channels/:id/messages":                  models.APITokenScopeMessagesWrite,
+	"POST /api/v1/channels/:id/messages/attachments":      models.APITokenScopeMessagesWrite,
+	"POST /api/v1/channels/:id/attachments/presign":       models.APITokenScopeMessagesWrite,
+	"POST /api/v1/channels/:id/attachments/presign-batch": models.APITokenScopeMessagesWrite,
+	"POST /api/v1/channels/:id/typing":                    models.APITokenScopeMessagesWrite,
+}
+
+// authenticateAPIToken resolves a Bot token, enforces its scopes and optional
+// server restriction, and stores claims for the user it acts as.
+func authenticateAPIToken(c *gin.Context, secret string) {
+	value, ok := c.Get("db")
+	db, isDB := value.(*gorm.DB)
+	if !ok || !isDB {
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "database connection unavailable")
+		return
+	}
+	db = db.WithContext(c)
+
+	token, claims, err := auth.ResolveAPIToken(db, secret)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidAPIToken) {
+			apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidAPIToken, err.Error())
+		} else {
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to validate api token")
+		}
+		c.Abort()
+		return
+	}
+
+	scope, allowed := apiTokenRouteScopes[c.Request.Method+" "+c.FullPath()]
+	if !allowed {
+		apierror.Abort(c, http.StatusForbidden, apierror.CodeAPITokenNotAllowed, "this endpoint is not available to api tokens")
+		return
+	}
+
+	if !auth.TokenHasScope(token, scope) {
+		apierror.Abort(c, http.StatusForbidden, apierror.CodeAPITokenScopeMissing, "api token is missing the "+scope+" scope")
+		return
+	}
+
+	if token.ServerID != nil {
+		inServer, err := routeInServer(c, db, *token.ServerID)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to validate api token")
+			return
+		}
+		if !inServer {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeAPITokenWrongServer, "api token is not valid for this server")
+			return
+		}
+	}
+
+	c.Set("userClaims", claims)
+	c.Set("apiToken", token)
+	c.Next()
+}
+
+// routeInServer reports whether the request targets the given server, either
+// directly via :serverID or through the channel named by :id.
+func routeInServer(c *gin.Context, db *gorm.DB, serverID uint) (bool, error) {
+	if raw := c.Param("serverID"); raw != "" {
+		parsed, err := strconv.ParseUint(raw, 10, 64)
+		return err == nil && uint(parsed) == serverID, nil
+	}
+
+	if strings.HasPrefix(c.FullPath(), "/api/v1/channels/:id") {
+		channelID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			return false, nil
+		}
+
+		var channel models.Channel
+		if err := db.Select("id", "server_id").First(&channel, channelID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		return channel.ServerID == serverID, nil
+	}
+
+	// Routes that are not tied to a server, such as /users/me.
+	return true, nil
+}
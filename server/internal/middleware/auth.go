@@ -1,59 +1,31 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"os"
 	"strings"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/auth"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
-// CORSMiddleware handles Cross-Origin Resource Sharing.
-// It respects the CORS_ALLOWED_ORIGINS environment variable (comma-separated).
+// CORSMiddleware handles Cross-Origin Resource Sharing for the allowed origins.
 // When Access-Control-Allow-Credentials is true we must echo a concrete origin
 // rather than using "*".
-func CORSMiddleware() gin.HandlerFunc {
-	// Build allowed set from env var once
-	raw := strings.TrimSpace(os.Getenv("CORS_ALLOWED_ORIGINS"))
-	allowed := map[string]struct{}{}
-	allowAll := false
-	if raw == "" {
-		// default to allowing everything (but will echo request origin)
-		allowAll = true
-	} else {
-		for _, part := range strings.Split(raw, ",") {
-			p := strings.TrimSpace(part)
-			if p == "" {
-				continue
-			}
-			if p == "*" {
-				allowAll = true
-				continue
-			}
-			allowed[p] = struct{}{}
-		}
-	}
-
+func CORSMiddleware(allowed AllowedOrigins) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		origin := c.GetHeader("Origin")
-
-		// Choose header value: prefer echoing the request origin when allowed,
-		// fall back to echoing origin if allowAll is true, otherwise omit.
-		if origin != "" {
-			if allowAll {
-				c.Header("Access-Control-Allow-Origin", origin)
-			} else {
-				if _, ok := allowed[origin]; ok {
-					c.Header("Access-Control-Allow-Origin", origin)
-				}
-			}
+		// Echo the request origin when it is allowed, otherwise omit the header.
+		if origin := c.GetHeader("Origin"); allowed.Allows(origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
 		}
 
 		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, x-amz-acl, x-amz-meta-*")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, x-amz-acl, x-amz-meta-*, Range, If-Range, If-None-Match, Idempotency-Key, X-Request-ID")
+		c.Header("Access-Control-Expose-Headers", "Accept-Ranges, Content-Range, Content-Length, ETag, X-Request-ID, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset")
+		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -64,30 +36,47 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-// AuthMiddleware validates JWT tokens
+// AuthMiddleware validates JWT bearer tokens and, via the Bot scheme, API tokens
+// limited to the routes their scopes allow.
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeAuthorizationRequired, "Authorization header required")
 			return
 		}
 
 		parts := strings.Fields(authHeader)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bot") {
+			authenticateAPIToken(c, parts[1])
+			return
+		}
+
 		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "invalid authorization header")
 			return
 		}
 
 		claims, err := auth.ParseJWT(parts[1])
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "invalid or expired token")
 			return
 		}
 
+		if db, ok := c.Get("db"); ok {
+			if gormDB, ok := db.(*gorm.DB); ok {
+				if err := auth.ValidateSession(gormDB.WithContext(c), claims); err != nil {
+					if errors.Is(err, auth.ErrSessionRevoked) {
+						apierror.Respond(c, http.StatusUnauthorized, apierror.CodeSessionRevoked, err.Error())
+					} else {
+						apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "failed to validate session")
+					}
+					c.Abort()
+					return
+				}
+			}
+		}
+
 		c.Set("userClaims", claims)
 		c.Next()
 	}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"os"
+	"strings"
+)
+
+// AllowedOrigins is the set of browser origins allowed to call the API and open
+// websocket connections, read from CORS_ALLOWED_ORIGINS.
+type AllowedOrigins struct {
+	all        bool
+	configured bool
+	origins    map[string]struct{}
+}
+
+// AllowedOriginsFromEnv parses the comma-separated CORS_ALLOWED_ORIGINS list. An
+// entry of "*", or leaving the variable unset, allows every origin, which is only
+// meant for development.
+func AllowedOriginsFromEnv() AllowedOrigins {
+	allowed := AllowedOrigins{origins: map[string]struct{}{}}
+
+	raw := strings.TrimSpace(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if raw == "" {
+		allowed.all = true
+		return allowed
+	}
+	allowed.configured = true
+
+	for _, part := range strings.Split(raw, ",") {
+		origin := normalizeOrigin(part)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			allowed.all = true
+			continue
+		}
+		allowed.origins[origin] = struct{}{}
+	}
+
+	return allowed
+}
+
+// AllowsAll reports whether every origin is accepted.
+func (a AllowedOrigins) AllowsAll() bool {
+	return a.all
+}
+
+// Configured reports whether CORS_ALLOWED_ORIGINS was set, as opposed to every
+// origin being allowed because it was left unset.
+func (a AllowedOrigins) Configured() bool {
+	return a.configured
+}
+
+// Allows reports whether the Origin header value is accepted. An empty origin is
+// never allowed here; callers decide how to treat requests without one.
+func (a AllowedOrigins) Allows(origin string) bool {
+	origin = normalizeOrigin(origin)
+	if origin == "" {
+		return false
+	}
+	if a.all {
+		return true
+	}
+
+	_, ok := a.origins[origin]
+	return ok
+}
+
+// normalizeOrigin lowercases an origin and drops a trailing slash so list entries
+// like "https://Chat.example.com/" still match the header browsers send.
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
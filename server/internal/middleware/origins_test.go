@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAllowedOriginsAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    string
+		origin string
+		want   bool
+	}{
+		{name: "listed origin", env: "https://chat.example.com", origin: "https://chat.example.com", want: true},
+		{name: "case and trailing slash", env: "https://Chat.example.com/", origin: "https://chat.EXAMPLE.com", want: true},
+		{name: "one of several", env: "https://a.example.com, https://b.example.com", origin: "https://b.example.com", want: true},
+		{name: "unlisted origin", env: "https://chat.example.com", origin: "https://evil.example.com", want: false},
+		{name: "different scheme", env: "https://chat.example.com", origin: "http://chat.example.com", want: false},
+		{name: "different port", env: "https://chat.example.com", origin: "https://chat.example.com:8443", want: false},
+		{name: "missing origin", env: "https://chat.example.com", origin: "", want: false},
+		{name: "wildcard", env: "*", origin: "https://anything.example.com", want: true},
+		{name: "unset allows all", env: "", origin: "https://anything.example.com", want: true},
+		{name: "missing origin with wildcard", env: "*", origin: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.env)
+			if got := AllowedOriginsFromEnv().Allows(tt.origin); got != tt.want {
+				t.Fatalf("Allows(%q) with %q = %v, want %v", tt.origin, tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedOriginsConfigured(t *testing.T) {
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{env: "", want: false},
+		{env: "*", want: true},
+		{env: "https://chat.example.com", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("CORS_ALLOWED_ORIGINS", tt.env)
+		if got := AllowedOriginsFromEnv().Configured(); got != tt.want {
+			t.Fatalf("Configured() with %q = %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestCORSMiddlewareEchoesOnlyAllowedOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://chat.example.com")
+
+	r := gin.New()
+	r.Use(CORSMiddleware(AllowedOriginsFromEnv()))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name   string
+		origin string
+		want   string
+	}{
+		{name: "allowed", origin: "https://chat.example.com", want: "https://chat.example.com"},
+		{name: "disallowed", origin: "https://evil.example.com", want: ""},
+		{name: "missing", origin: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.want {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
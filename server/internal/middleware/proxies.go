@@ -0,0 +1,21 @@
+package middleware
+
+import (
+	"os"
+	"strings"
+)
+
+// TrustedProxiesFromEnv parses the comma-separated TRUSTED_PROXIES list of proxy
+// IPs or CIDRs whose X-Forwarded-For header is believed. Unset trusts no proxy,
+// so the client IP is the address of the connection itself; otherwise any client
+// could pick its own IP and get around the per-IP rate limits.
+func TrustedProxiesFromEnv() []string {
+	var proxies []string
+	for _, part := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy := strings.TrimSpace(part); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+
+	return proxies
+}
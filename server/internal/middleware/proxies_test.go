@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTrustedProxiesFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		want []string
+	}{
+		{name: "unset trusts nothing", env: "", want: nil},
+		{name: "list", env: " 10.0.0.0/8, 192.168.1.10 ,", want: []string{"10.0.0.0/8", "192.168.1.10"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.env)
+			if got := TrustedProxiesFromEnv(); !slices.Equal(got, tt.want) {
+				t.Fatalf("TrustedProxiesFromEnv() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPKeyIgnoresForwardedForFromUntrustedPeers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name    string
+		proxies []string
+		want    string
+	}{
+		{name: "no trusted proxies", proxies: nil, want: "ip:203.0.113.7"},
+		{name: "peer is not trusted", proxies: []string{"10.0.0.0/8"}, want: "ip:203.0.113.7"},
+		{name: "peer is trusted", proxies: []string{"203.0.113.0/24"}, want: "ip:198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			if err := r.SetTrustedProxies(tt.proxies); err != nil {
+				t.Fatalf("SetTrustedProxies: %v", err)
+			}
+
+			var got string
+			r.GET("/", func(c *gin.Context) {
+				got = ClientIPKey(c)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "203.0.113.7:4567"
+			req.Header.Set("X-Forwarded-For", "198.51.100.1")
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.want {
+				t.Fatalf("ClientIPKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
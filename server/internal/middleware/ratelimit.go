@@ -0,0 +1,357 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/auth"
+	"bafachat/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRateLimitPrefix = "bafachat:ratelimit:"
+	// maxRateLimitBodyBytes bounds how much of a request body is read to build a rate limit key.
+	maxRateLimitBodyBytes = 64 * 1024
+)
+
+// RateLimit describes how many requests are allowed within a sliding window.
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// Enabled reports whether the limit should be enforced.
+func (l RateLimit) Enabled() bool {
+	return l.Limit > 0 && l.Window > 0
+}
+
+// AuthRateLimits holds the limits applied to the authentication routes.
+type AuthRateLimits struct {
+	// PerIP caps every auth request from a single client IP.
+	PerIP RateLimit
+	// PerIdentifier caps login attempts against a single username or email.
+	PerIdentifier RateLimit
+}
+
+// AuthRateLimitsFromEnv reads the auth rate limits from environment variables:
+//
+//	AUTH_RATE_LIMIT_IP          - requests per window per client IP (default 20, 0 disables).
+//	AUTH_RATE_LIMIT_IDENTIFIER  - login attempts per window per identifier (default 5, 0 disables).
+//	AUTH_RATE_LIMIT_WINDOW      - sliding window duration (default 15m).
+func AuthRateLimitsFromEnv() AuthRateLimits {
+	window := 15 * time.Minute
+	if raw := strings.TrimSpace(os.Getenv("AUTH_RATE_LIMIT_WINDOW")); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			window = parsed
+		}
+	}
+
+	limits := AuthRateLimits{
+		PerIP:         RateLimit{Limit: 20, Window: window},
+		PerIdentifier: RateLimit{Limit: 5, Window: window},
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("AUTH_RATE_LIMIT_IP")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			limits.PerIP.Limit = parsed
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("AUTH_RATE_LIMIT_IDENTIFIER")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			limits.PerIdentifier.Limit = parsed
+		}
+	}
+
+	return limits
+}
+
+// WebhookRateLimitFromEnv reads the per-webhook limit from WEBHOOK_RATE_LIMIT
+// (default 30, 0 disables) and WEBHOOK_RATE_LIMIT_WINDOW (default 1m).
+func WebhookRateLimitFromEnv() RateLimit {
+	limit := RateLimit{Limit: 30, Window: time.Minute}
+
+	if raw := strings.TrimSpace(os.Getenv("WEBHOOK_RATE_LIMIT")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			limit.Limit = parsed
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("WEBHOOK_RATE_LIMIT_WINDOW")); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			limit.Window = parsed
+		}
+	}
+
+	return limit
+}
+
+// TokenBucket allows bursts of up to Capacity requests and regains one token
+// every Refill.
+type TokenBucket struct {
+	Capacity int
+	Refill   time.Duration
+}
+
+// Enabled reports whether the bucket should be enforced.
+func (b TokenBucket) Enabled() bool {
+	return b.Capacity > 0 && b.Refill > 0
+}
+
+// TokenBucketResult describes a bucket after a request has tried to take a token.
+type TokenBucketResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next token is available.
+	RetryAfter time.Duration
+	// ResetAfter is how long until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// MessageRateLimitFromEnv reads the per-user, per-channel message limit from
+// MESSAGE_RATE_LIMIT_BURST (default 10, 0 disables) and MESSAGE_RATE_LIMIT_REFILL,
+// the time to regain one message (default 1s). It applies on top of slowmode.
+func MessageRateLimitFromEnv() TokenBucket {
+	bucket := TokenBucket{Capacity: 10, Refill: time.Second}
+
+	if raw := strings.TrimSpace(os.Getenv("MESSAGE_RATE_LIMIT_BURST")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			bucket.Capacity = parsed
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("MESSAGE_RATE_LIMIT_REFILL")); raw != "" {
+		if parsed, err := time.ParseDuration(raw); err == nil && parsed > 0 {
+			bucket.Refill = parsed
+		}
+	}
+
+	return bucket
+}
+
+// RateLimiter counts requests in Redis using a sorted-set sliding window so that
+// limits hold across multiple API instances.
+type RateLimiter struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRateLimiter returns a limiter backed by the given Redis client.
+func NewRateLimiter(client *redis.Client) *RateLimiter {
+	return &RateLimiter{client: client, prefix: defaultRateLimitPrefix}
+}
+
+// Allow records a request against key and reports whether it is within the limit.
+// When the limit is exceeded it also returns how long until the oldest request
+// leaves the window.
+func (r *RateLimiter) Allow(ctx context.Context, key string, limit RateLimit) (bool, time.Duration, error) {
+	now := time.Now()
+	redisKey := r.prefix + key
+	windowStart := now.Add(-limit.Window)
+	member := strconv.FormatInt(now.UnixNano(), 10) + "-" + strconv.FormatUint(rand.Uint64(), 36)
+
+	var count *redis.IntCmd
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRemRangeByScore(ctx, redisKey, "-inf", strconv.FormatInt(windowStart.UnixNano(), 10))
+		pipe.ZAdd(ctx, redisKey, redis.Z{Score: float64(now.UnixNano()), Member: member})
+		count = pipe.ZCard(ctx, redisKey)
+		pipe.PExpire(ctx, redisKey, limit.Window)
+		return nil
+	})
+	if err != nil {
+		return true, 0, err
+	}
+
+	if count.Val() <= int64(limit.Limit) {
+		return true, 0, nil
+	}
+
+	// Rejected requests do not consume a slot, so the client can retry as soon as
+	// the oldest accepted request leaves the window.
+	r.client.ZRem(ctx, redisKey, member)
+
+	oldest, err := r.client.ZRangeWithScores(ctx, redisKey, 0, 0).Result()
+	if err != nil || len(oldest) == 0 {
+		return false, limit.Window, nil
+	}
+
+	retryAfter := time.Unix(0, int64(oldest[0].Score)).Add(limit.Window).Sub(now)
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+
+	return false, retryAfter, nil
+}
+
+// tokenBucketScript refills the bucket for the time elapsed since it was last
+// touched, then takes a token if one is left. It returns whether a token was
+// taken, the tokens remaining and the milliseconds until the next refill.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local refill = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local state = redis.call("HMGET", KEYS[1], "tokens", "ts")
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+	tokens = capacity
+	ts = now
+end
+
+local regained = math.floor(math.max(0, now - ts) / refill)
+if regained > 0 then
+	tokens = math.min(capacity, tokens + regained)
+	ts = ts + regained * refill
+end
+if tokens >= capacity then
+	ts = now
+end
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "ts", ts)
+redis.call("PEXPIRE", KEYS[1], capacity * refill)
+
+return {allowed, tokens, ts + refill - now}
+`)
+
+// Take removes a token from the bucket stored under key. Rejected requests do
+// not consume anything.
+func (r *RateLimiter) Take(ctx context.Context, key string, bucket TokenBucket) (TokenBucketResult, error) {
+	refill := bucket.Refill.Milliseconds()
+	if refill < 1 {
+		refill = 1
+	}
+
+	values, err := tokenBucketScript.Run(ctx, r.client, []string{r.prefix + key},
+		bucket.Capacity, refill, time.Now().UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return TokenBucketResult{Allowed: true}, err
+	}
+	if len(values) != 3 {
+		return TokenBucketResult{Allowed: true}, fmt.Errorf("unexpected token bucket reply: %v", values)
+	}
+
+	remaining := int(values[1])
+	nextToken := time.Duration(values[2]) * time.Millisecond
+
+	result := TokenBucketResult{
+		Allowed:   values[0] == 1,
+		Remaining: remaining,
+	}
+	if remaining < bucket.Capacity {
+		result.ResetAfter = nextToken + time.Duration(bucket.Capacity-remaining-1)*time.Duration(refill)*time.Millisecond
+	}
+	if !result.Allowed {
+		result.RetryAfter = nextToken
+	}
+
+	return result, nil
+}
+
+// RateLimitKeyFunc derives the bucket for a request. Returning an empty key skips limiting.
+type RateLimitKeyFunc func(c *gin.Context) string
+
+// ClientIPKey buckets requests by client IP. X-Forwarded-For only counts when the
+// request came through one of the engine's trusted proxies; see TrustedProxiesFromEnv.
+func ClientIPKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// HashedParamKey buckets requests by a route parameter, hashing it so secrets
+// such as webhook tokens are not written to Redis.
+func HashedParamKey(name string) RateLimitKeyFunc {
+	return func(c *gin.Context) string {
+		value := c.Param(name)
+		if value == "" {
+			return ""
+		}
+		return name + ":" + auth.HashToken(value)
+	}
+}
+
+// LoginIdentifierKey buckets login attempts by the submitted username or email.
+// The request body is restored so the handler can still bind it.
+func LoginIdentifierKey(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRateLimitBodyBytes))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		Identifier string `json:"identifier"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+
+	identifier := strings.ToLower(strings.TrimSpace(payload.Identifier))
+	if identifier == "" {
+		return ""
+	}
+
+	return "login:" + identifier
+}
+
+// RateLimitMiddleware rejects requests with 429 and a Retry-After header once the
+// bucket chosen by keyFunc exceeds limit. A nil limiter or a Redis error lets the
+// request through so an outage does not lock users out.
+func RateLimitMiddleware(limiter *RateLimiter, scope string, limit RateLimit, keyFunc RateLimitKeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || !limit.Enabled() {
+			c.Next()
+			return
+		}
+
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := limiter.Allow(c.Request.Context(), scope+":"+key, limit)
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Warn("rate limit check failed", "scope", scope, "error", err)
+			c.Next()
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			apierror.RespondWithDetails(c, http.StatusTooManyRequests, apierror.CodeRateLimited,
+				"too many requests, please try again later",
+				gin.H{"retry_after": seconds},
+			)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestMessageRateLimitFromEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		burst  string
+		refill string
+		want   TokenBucket
+	}{
+		{name: "defaults", want: TokenBucket{Capacity: 10, Refill: time.Second}},
+		{name: "configured", burst: "3", refill: "500ms", want: TokenBucket{Capacity: 3, Refill: 500 * time.Millisecond}},
+		{name: "zero burst disables", burst: "0", want: TokenBucket{Capacity: 0, Refill: time.Second}},
+		{name: "invalid values keep defaults", burst: "-1", refill: "soon", want: TokenBucket{Capacity: 10, Refill: time.Second}},
+		{name: "non-positive refill keeps default", refill: "0s", want: TokenBucket{Capacity: 10, Refill: time.Second}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MESSAGE_RATE_LIMIT_BURST", tt.burst)
+			t.Setenv("MESSAGE_RATE_LIMIT_REFILL", tt.refill)
+			if got := MessageRateLimitFromEnv(); got != tt.want {
+				t.Fatalf("MessageRateLimitFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenBucketEnabled(t *testing.T) {
+	tests := []struct {
+		bucket TokenBucket
+		want   bool
+	}{
+		{bucket: TokenBucket{Capacity: 10, Refill: time.Second}, want: true},
+		{bucket: TokenBucket{Capacity: 0, Refill: time.Second}, want: false},
+		{bucket: TokenBucket{Capacity: 10}, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.bucket.Enabled(); got != tt.want {
+			t.Fatalf("%+v.Enabled() = %v, want %v", tt.bucket, got, tt.want)
+		}
+	}
+}
+
+func TestTakeFailsOpenWhenRedisIsDown(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	t.Cleanup(func() { _ = client.Close() })
+
+	result, err := NewRateLimiter(client).Take(context.Background(), "message:1:user:2", TokenBucket{Capacity: 1, Refill: time.Second})
+	if err == nil {
+		t.Fatal("Take succeeded without Redis")
+	}
+	if !result.Allowed {
+		t.Fatal("Take rejected the request when Redis was unavailable")
+	}
+}
+
+func TestRateLimitMiddlewareSkipsWithoutLimiter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RateLimitMiddleware(nil, "auth", RateLimit{Limit: 1, Window: time.Minute}, ClientIPKey))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status = %d, want %d", i, w.Code, http.StatusNoContent)
+		}
+	}
+}
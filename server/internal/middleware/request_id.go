@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"bafachat/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the correlation ID in both directions.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied IDs so they cannot bloat log lines.
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware assigns each request a correlation ID, reusing a valid
+// incoming X-Request-ID. The ID is stored in the request context for logging,
+// echoed in the response header, and added to JSON error bodies.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := strings.TrimSpace(c.GetHeader(RequestIDHeader))
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		c.Set("requestID", requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+		c.Writer = &requestIDWriter{ResponseWriter: c.Writer, requestID: requestID}
+
+		c.Next()
+	}
+}
+
+// RequestLogger writes one structured line per request, replacing gin.Logger.
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+
+		logging.FromContext(c.Request.Context()).LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+func validRequestID(value string) bool {
+	if value == "" || len(value) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range value {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(buf)
+}
+
+// requestIDWriter adds "request_id" to JSON object bodies of error responses so
+// clients can quote it when reporting a problem.
+type requestIDWriter struct {
+	gin.ResponseWriter
+	requestID string
+	tagged    bool
+}
+
+func (w *requestIDWriter) Write(data []byte) (int, error) {
+	if w.tagged || w.Status() < http.StatusBadRequest || len(data) < 2 || data[0] != '{' ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(data)
+	}
+	w.tagged = true
+
+	encodedID, err := json.Marshal(w.requestID)
+	if err != nil {
+		return w.ResponseWriter.Write(data)
+	}
+
+	var body bytes.Buffer
+	body.Grow(len(data) + len(encodedID) + 16)
+	body.WriteString(`{"request_id":`)
+	body.Write(encodedID)
+	if data[1] != '}' {
+		body.WriteByte(',')
+	}
+	body.Write(data[1:])
+
+	if _, err := w.ResponseWriter.Write(body.Bytes()); err != nil {
+		return 0, err
+	}
+	// Report the caller's byte count so writers that check it are not confused.
+	return len(data), nil
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"bafachat/internal/apierror"
+	"bafachat/internal/logging"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{name: "reuses a valid incoming ID", incoming: "edge-4f2a", reused: true},
+		{name: "generates one when missing", incoming: ""},
+		{name: "replaces one with spaces", incoming: "not valid"},
+		{name: "replaces one that is too long", incoming: strings.Repeat("a", maxRequestIDLength+1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			router := gin.New()
+			router.Use(RequestIDMiddleware())
+			router.GET("/", func(c *gin.Context) {
+				seen = logging.RequestID(c.Request.Context())
+				c.Status(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			header := w.Header().Get(RequestIDHeader)
+			if header == "" || header != seen {
+				t.Fatalf("header %q and context %q should hold the same ID", header, seen)
+			}
+			if got := header == tt.incoming; got != tt.reused {
+				t.Fatalf("ID %q reused = %v, want %v", header, got, tt.reused)
+			}
+		})
+	}
+}
+
+func TestRequestIDAddedToErrorBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+	router.GET("/error", func(c *gin.Context) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "missing")
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": "fine"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/error", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	if body["request_id"] != "req-1" || body["error"] == nil {
+		t.Fatalf("error body = %s, want the error with request_id req-1", w.Body)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/ok", nil)
+	req.Header.Set(RequestIDHeader, "req-2")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if strings.Contains(w.Body.String(), "request_id") {
+		t.Fatalf("success body = %s, want no request_id", w.Body)
+	}
+}
@@ -3,14 +3,45 @@ package models
 import "time"
 
 const (
-	ServerRoleOwner  = "owner"
-	ServerRoleMember = "member"
+	ServerRoleOwner   = "owner"
+	ServerRoleAdmin   = "admin"
+	ServerRoleMember  = "member"
+	ServerRolePending = "pending"
+
+	PermissionManageChannels = "manage_channels"
+	PermissionManageMembers  = "manage_members"
+	PermissionManageInvites  = "manage_invites"
+	PermissionDeleteMessages = "delete_messages"
+	PermissionManageEmojis   = "manage_emojis"
 
 	ChannelTypeText  = "text"
 	ChannelTypeAudio = "audio"
 
-	MessageTypeText = "text"
-	MessageTypeFile = "file"
+	MessageTypeText   = "text"
+	MessageTypeFile   = "file"
+	MessageTypeSystem = "system"
+
+	// DeletedUserUsername and DeletedUserEmail identify the placeholder account that
+	// takes over anonymized messages and webhooks when a user deletes their account.
+	DeletedUserUsername = "Deleted User"
+	DeletedUserEmail    = "deleted-user@bafachat.invalid"
+
+	DataExportStatusPending = "pending"
+	DataExportStatusReady   = "ready"
+	DataExportStatusFailed  = "failed"
+
+	APITokenScopeMessagesRead  = "messages:read"
+	APITokenScopeMessagesWrite = "messages:write"
+	APITokenScopeServersRead   = "servers:read"
+
+	// Presence statuses a user can choose. Invisible users stay connected but are
+	// shown to others as offline; do not disturb suppresses notifications.
+	PresenceStatusOnline    = "online"
+	PresenceStatusAway      = "away"
+	PresenceStatusDND       = "dnd"
+	PresenceStatusInvisible = "invisible"
+	// PresenceStatusOffline is shown for users who are disconnected or invisible.
+	PresenceStatusOffline = "offline"
 )
 
 // User represents a user in the system.
@@ -25,18 +56,39 @@ type User struct {
 	EmailVerifiedAt         *time.Time `json:"email_verified_at"`
 	EmailVerificationToken  string     `json:"-" gorm:"size:191"`
 	EmailVerificationSentAt *time.Time `json:"-"`
+	PendingEmail            string     `json:"-" gorm:"size:255"`
+	PendingEmailToken       string     `json:"-" gorm:"size:191;index"`
+	PendingEmailSentAt      *time.Time `json:"-"`
 	LastLoginAt             *time.Time `json:"last_login_at"`
-	CreatedAt               time.Time  `json:"created_at"`
-	UpdatedAt               time.Time  `json:"updated_at"`
+	// LastSeenAt is refreshed about once a minute while the user has a websocket
+	// connection open, and when their last connection closes.
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	// PresenceStatus is the last status the user chose, restored when they reconnect.
+	PresenceStatus string `json:"presence_status" gorm:"size:16;default:'online'"`
+	// ReadReceiptsEnabled controls whether other members are told how far the
+	// user has read in small channels.
+	ReadReceiptsEnabled bool `json:"read_receipts_enabled" gorm:"not null;default:true"`
+	// TwoFactorSecret is the AES-GCM encrypted TOTP secret. It is set during setup
+	// and only enforced once TwoFactorEnabledAt is set.
+	TwoFactorSecret    string     `json:"-" gorm:"type:text"`
+	TwoFactorEnabledAt *time.Time `json:"two_factor_enabled_at"`
+	// TwoFactorLastStep is the last TOTP time step accepted, so a code cannot be replayed.
+	TwoFactorLastStep int64     `json:"-"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
 }
 
 // ServerMember represents a user's membership within a server, including their role.
 type ServerMember struct {
-	ServerID  uint      `json:"server_id" gorm:"primaryKey"`
-	UserID    uint      `json:"user_id" gorm:"primaryKey"`
-	Role      string    `json:"role" gorm:"size:32;default:'member'"`
-	JoinedAt  time.Time `json:"joined_at" gorm:"autoCreateTime"`
-	InvitedBy *uint     `json:"invited_by"`
+	ServerID        uint       `json:"server_id" gorm:"primaryKey"`
+	UserID          uint       `json:"user_id" gorm:"primaryKey"`
+	Role            string     `json:"role" gorm:"size:32;default:'member'"`
+	Nickname        string     `json:"nickname" gorm:"size:32"`
+	JoinedAt        time.Time  `json:"joined_at" gorm:"autoCreateTime"`
+	InvitedBy       *uint      `json:"invited_by"`
+	RulesAcceptedAt *time.Time `json:"rules_accepted_at"`
+	ApprovedAt      *time.Time `json:"approved_at"`
+	ApprovedBy      *uint      `json:"approved_by"`
 }
 
 // Server represents a Discord-like server/guild.
@@ -49,6 +101,14 @@ type Server struct {
 	IconCropData      string         `json:"-" gorm:"type:text"`
 	OwnerID           uint           `json:"owner_id" gorm:"not null"`
 	Owner             User           `json:"owner" gorm:"foreignKey:OwnerID"`
+	Rules             string         `json:"rules" gorm:"type:text"`
+	RequireRules      bool           `json:"require_rules" gorm:"not null;default:false"`
+	RequireApproval   bool           `json:"require_approval" gorm:"not null;default:false"`
+	WelcomeChannelID  *uint          `json:"welcome_channel_id"`
+	WelcomeMessage    string         `json:"welcome_message" gorm:"type:text"`
+	Public            bool           `json:"public" gorm:"not null;default:false;index"`
+	Tags              string         `json:"tags" gorm:"size:255"`
+	StorageUsedBytes  int64          `json:"storage_used_bytes" gorm:"not null;default:0"`
 	Channels          []Channel      `json:"channels" gorm:"foreignKey:ServerID"`
 	Members           []User         `json:"members" gorm:"many2many:server_members;"`
 	MemberRelations   []ServerMember `json:"-" gorm:"foreignKey:ServerID"`
@@ -70,41 +130,179 @@ type Channel struct {
 	Position    int       `json:"position" gorm:"default:0"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+
+	// MaxParticipants caps concurrent voice participants; 0 uses the deployment default.
+	MaxParticipants int `json:"max_participants" gorm:"default:0"`
+
+	// SlowmodeSeconds is the minimum gap between a member's messages; 0 disables slowmode.
+	SlowmodeSeconds int `json:"slowmode_seconds" gorm:"default:0"`
+
+	// Private channels are only visible to their ChannelMembers and to owners/admins.
+	Private bool `json:"private" gorm:"default:false"`
+
+	// CategoryID groups the channel under a ChannelCategory; nil leaves it uncategorized.
+	CategoryID *uint `json:"category_id" gorm:"index"`
+
+	// MessageTTLSeconds makes new messages disappear after this many seconds; 0 keeps them.
+	MessageTTLSeconds int `json:"message_ttl_seconds" gorm:"default:0"`
+
+	// NSFW channels only show messages to members who have acknowledged the warning.
+	NSFW bool `json:"nsfw" gorm:"default:false"`
+
+	// ArchivedAt hides the channel from the channel list and stops new messages
+	// while keeping its history readable; nil means the channel is active.
+	ArchivedAt *time.Time `json:"archived_at" gorm:"index"`
+}
+
+// NSFWAcknowledgment records that a user confirmed they want to see an NSFW channel.
+type NSFWAcknowledgment struct {
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	ChannelID uint      `json:"channel_id" gorm:"primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChannelCategory groups a server's channels in the sidebar.
+type ChannelCategory struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ServerID  uint      `json:"server_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"not null"`
+	Position  int       `json:"position" gorm:"default:0"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ChannelMember grants a server member access to a private channel.
+type ChannelMember struct {
+	ChannelID uint      `json:"channel_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey;index"`
+	AddedBy   uint      `json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // Message represents a message in a channel.
 type Message struct {
-	ID          uint                `json:"id" gorm:"primaryKey"`
-	Content     string              `json:"content" gorm:"not null"`
-	UserID      uint                `json:"user_id" gorm:"not null"`
-	User        User                `json:"user" gorm:"foreignKey:UserID"`
-	ChannelID   uint                `json:"channel_id" gorm:"not null"`
-	Channel     Channel             `json:"channel" gorm:"foreignKey:ChannelID"`
-	Type        string              `json:"type" gorm:"default:'text'"`
-	Attachments []MessageAttachment `json:"attachments" gorm:"foreignKey:MessageID"`
-	EditedAt    *time.Time          `json:"edited_at"`
-	CreatedAt   time.Time           `json:"created_at"`
-	UpdatedAt   time.Time           `json:"updated_at"`
+	ID            uint                `json:"id" gorm:"primaryKey"`
+	Content       string              `json:"content" gorm:"not null"`
+	UserID        uint                `json:"user_id" gorm:"not null;uniqueIndex:idx_messages_user_client_nonce"`
+	User          User                `json:"user" gorm:"foreignKey:UserID"`
+	ChannelID     uint                `json:"channel_id" gorm:"not null"`
+	Channel       Channel             `json:"channel" gorm:"foreignKey:ChannelID"`
+	Type          string              `json:"type" gorm:"default:'text'"`
+	Attachments   []MessageAttachment `json:"attachments" gorm:"foreignKey:MessageID"`
+	Mentions      []MessageMention    `json:"mentions" gorm:"foreignKey:MessageID"`
+	Emojis        []MessageEmoji      `json:"emojis" gorm:"foreignKey:MessageID"`
+	LinkPreview   *LinkPreview        `json:"link_preview" gorm:"foreignKey:MessageID"`
+	WebhookID     *uint               `json:"webhook_id" gorm:"index"`
+	WebhookName   string              `json:"webhook_name" gorm:"size:80"`
+	WebhookAvatar string              `json:"webhook_avatar" gorm:"size:512"`
+	ClientNonce   *string             `json:"client_nonce" gorm:"size:64;uniqueIndex:idx_messages_user_client_nonce"`
+	EditedAt      *time.Time          `json:"edited_at"`
+	ExpiresAt     *time.Time          `json:"expires_at" gorm:"index"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+
+	// AuthorNickname is the author's nickname in the channel's server, filled in before serializing.
+	AuthorNickname string `json:"-" gorm:"-"`
+}
+
+// MessageMention records a server member referenced by @username in a message.
+type MessageMention struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MessageID uint      `json:"message_id" gorm:"not null;uniqueIndex:idx_message_mentions_message_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;index;uniqueIndex:idx_message_mentions_message_user"`
+	User      User      `json:"user" gorm:"foreignKey:UserID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageEmoji records a server custom emoji referenced by :name: in a message.
+type MessageEmoji struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	MessageID uint        `json:"message_id" gorm:"not null;uniqueIndex:idx_message_emojis_message_emoji"`
+	EmojiID   uint        `json:"emoji_id" gorm:"not null;index;uniqueIndex:idx_message_emojis_message_emoji"`
+	Emoji     CustomEmoji `json:"emoji" gorm:"foreignKey:EmojiID"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// LinkPreview is the card shown under a message for the first URL in its content.
+type LinkPreview struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	MessageID   uint      `json:"message_id" gorm:"not null;uniqueIndex"`
+	URL         string    `json:"url" gorm:"type:text;not null"`
+	Title       string    `json:"title" gorm:"type:text"`
+	Description string    `json:"description" gorm:"type:text"`
+	ImageURL    string    `json:"image_url" gorm:"type:text"`
+	SiteName    string    `json:"site_name" gorm:"size:100"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CustomEmoji is a server-specific emoji image usable as :name: in messages.
+type CustomEmoji struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ServerID    uint      `json:"server_id" gorm:"not null;uniqueIndex:idx_custom_emojis_server_name"`
+	Name        string    `json:"name" gorm:"size:32;not null;uniqueIndex:idx_custom_emojis_server_name"`
+	ObjectKey   string    `json:"-" gorm:"size:512;not null"`
+	ImageURL    string    `json:"image_url" gorm:"size:1024;not null"`
+	ContentType string    `json:"content_type" gorm:"size:64"`
+	Animated    bool      `json:"animated"`
+	CreatedBy   uint      `json:"created_by" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ChannelRead tracks the last message a user has read in a channel.
+type ChannelRead struct {
+	UserID            uint      `json:"user_id" gorm:"primaryKey"`
+	ChannelID         uint      `json:"channel_id" gorm:"primaryKey;index"`
+	LastReadMessageID uint      `json:"last_read_message_id"`
+	LastReadAt        time.Time `json:"last_read_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// MarkChannelReadRequest captures the optional message a user has read up to.
+type MarkChannelReadRequest struct {
+	MessageID uint `json:"message_id"`
 }
 
 // MessageAttachment stores metadata for files linked to messages.
 type MessageAttachment struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	MessageID   uint      `json:"message_id" gorm:"index;not null"`
-	ObjectKey   string    `json:"object_key" gorm:"size:512;not null"`
+	ObjectKey   string    `json:"object_key" gorm:"size:512;not null;index"`
 	URL         string    `json:"url" gorm:"size:1024;not null"`
 	FileName    string    `json:"file_name" gorm:"size:255;not null"`
 	ContentType string    `json:"content_type" gorm:"size:255;not null"`
 	FileSize    int64     `json:"file_size" gorm:"not null"`
+	// ContentHash is the hex SHA-256 of the stored bytes, set for files uploaded
+	// through the API. Attachments in the same server with the same hash share
+	// one object.
+	ContentHash string    `json:"content_hash" gorm:"size:64;index"`
+	// AltText describes the attachment for screen readers; set by the uploader.
+	AltText     string    `json:"alt_text" gorm:"size:1000"`
 	Width       int       `json:"width"`
 	Height      int       `json:"height"`
 	PreviewURL  string    `json:"preview_url" gorm:"size:1024"`
-	PreviewObjectKey string `json:"preview_object_key" gorm:"size:512"`
+	PreviewObjectKey string `json:"preview_object_key" gorm:"size:512;index"`
 	PreviewWidth int       `json:"preview_width"`
 	PreviewHeight int      `json:"preview_height"`
+	// Waveform is a JSON array of peak amplitudes, set for audio attachments.
+	Waveform    string    `json:"-" gorm:"type:text"`
+	Duration    float64   `json:"duration"`
+	// Position orders the attachments of a message, starting at 0.
+	Position    int       `json:"position" gorm:"not null;default:0"`
 	CreatedAt   time.Time `json:"created_at" gorm:"autoCreateTime"`
 }
 
+// UploadIntent records an attachment upload URL handed out by the presign
+// endpoints. It is removed once a message references the object; intents left
+// past the cleanup grace period have their objects deleted as abandoned.
+type UploadIntent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ObjectKey string    `json:"object_key" gorm:"size:512;not null;uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	ChannelID uint      `json:"channel_id" gorm:"not null"`
+	FileSize  int64     `json:"file_size" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
 // ServerInvite represents a reusable invite link to join a server.
 type ServerInvite struct {
 	ID        uint       `json:"id" gorm:"primaryKey"`
@@ -115,18 +313,205 @@ type ServerInvite struct {
 	Inviter   User       `json:"inviter" gorm:"foreignKey:InviterID"`
 	MaxUses   int        `json:"max_uses"`
 	Uses      int        `json:"uses"`
+	Role      string     `json:"role" gorm:"size:32;not null;default:'member'"`
 	ExpiresAt *time.Time `json:"expires_at"`
 	RevokedAt *time.Time `json:"revoked_at"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 }
 
+// ServerBan records a user who is barred from joining a server.
+type ServerBan struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ServerID  uint      `json:"server_id" gorm:"not null;uniqueIndex:idx_server_bans_server_user"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_server_bans_server_user"`
+	User      User      `json:"user" gorm:"foreignKey:UserID"`
+	BannedBy  uint      `json:"banned_by" gorm:"not null"`
+	Reason    string    `json:"reason" gorm:"size:512"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Word filter actions.
+const (
+	WordFilterActionBlock = "block"
+	WordFilterActionMask  = "mask"
+)
+
+// ServerWordFilter lists terms the server owner does not allow in messages.
+// Servers without a row, or with no terms, do not filter.
+type ServerWordFilter struct {
+	ServerID uint `json:"server_id" gorm:"primaryKey"`
+	// Terms holds the blocked terms, lowercased, one per line.
+	Terms     string    `json:"-" gorm:"type:text"`
+	Action    string    `json:"action" gorm:"size:16;not null;default:'block'"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Session records a login so users can review and revoke their signed-in devices.
+// TokenHash stores a SHA-256 of the session ID carried in the JWT, never the token itself.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	UserAgent  string     `json:"user_agent" gorm:"size:512"`
+	IPAddress  string     `json:"ip_address" gorm:"size:64"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt time.Time  `json:"last_used_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// TwoFactorBackupCode is a single-use recovery code. Only a SHA-256 of the code is stored.
+type TwoFactorBackupCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TwoFactorChallenge is the short-lived second step of a login for a user with 2FA.
+type TwoFactorChallenge struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	TokenHash string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Attempts  int       `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OAuthIdentity links a user to an account at an external sign-in provider.
+// A user may have one identity per provider.
+type OAuthIdentity struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	Provider   string    `json:"provider" gorm:"size:32;not null;uniqueIndex:idx_oauth_identities_provider_external"`
+	ExternalID string    `json:"external_id" gorm:"size:191;not null;uniqueIndex:idx_oauth_identities_provider_external"`
+	Email      string    `json:"email" gorm:"size:255"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DataExport is a queued export of a user's data. Once ready, the zip is kept in
+// private storage and downloaded with a token that was emailed to the user; only a
+// SHA-256 of the token is stored.
+type DataExport struct {
+	ID                 uint       `json:"id" gorm:"primaryKey"`
+	UserID             uint       `json:"user_id" gorm:"not null;index"`
+	Status             string     `json:"status" gorm:"size:16;not null;default:'pending'"`
+	IncludeAttachments bool       `json:"include_attachments" gorm:"not null;default:false"`
+	TokenHash          string     `json:"-" gorm:"size:64;index"`
+	ObjectKey          string     `json:"-" gorm:"size:512"`
+	FileSize           int64      `json:"file_size"`
+	CompletedAt        *time.Time `json:"completed_at"`
+	ExpiresAt          *time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// APIToken lets integrations call the API on a user's behalf using the Bot scheme.
+// Only a SHA-256 of the secret is stored; ServerID optionally restricts the token to one server.
+type APIToken struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	ServerID    *uint      `json:"server_id" gorm:"index"`
+	Name        string     `json:"name" gorm:"size:100;not null"`
+	TokenHash   string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	TokenPrefix string     `json:"token_prefix" gorm:"size:16"`
+	Scopes      string     `json:"scopes" gorm:"size:255"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
+
+// ChannelWebhook lets external systems post messages into a channel through a secret URL.
+// Only a SHA-256 of the URL token is stored.
+type ChannelWebhook struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ServerID  uint      `json:"server_id" gorm:"not null;index"`
+	ChannelID uint      `json:"channel_id" gorm:"not null;index"`
+	Name      string    `json:"name" gorm:"size:80;not null"`
+	AvatarURL string    `json:"avatar_url" gorm:"size:512"`
+	TokenHash string    `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	CreatedBy uint      `json:"created_by" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PushSubscription registers a device to receive push notifications while the user is offline.
+// Endpoint is the push service URL; P256dh and Auth are the browser's encryption keys for Web Push.
+type PushSubscription struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Platform   string     `json:"platform" gorm:"size:16;not null"`
+	Endpoint   string     `json:"endpoint" gorm:"size:1024;not null;uniqueIndex"`
+	P256dh     string     `json:"-" gorm:"size:255"`
+	Auth       string     `json:"-" gorm:"size:255"`
+	UserAgent  string     `json:"user_agent" gorm:"size:512"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// NotificationPreference stores how a user wants to be notified about mentions while offline.
+// Users without a row get the defaults from DefaultNotificationPreference.
+type NotificationPreference struct {
+	UserID        uint      `json:"-" gorm:"primaryKey"`
+	PushMentions  bool      `json:"push_mentions" gorm:"not null"`
+	EmailMentions bool      `json:"email_mentions" gorm:"not null"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// DefaultNotificationPreference returns the preferences used until a user changes them.
+func DefaultNotificationPreference(userID uint) NotificationPreference {
+	return NotificationPreference{
+		UserID:        userID,
+		PushMentions:  true,
+		EmailMentions: true,
+	}
+}
+
+// DNDSchedule holds a user's quiet hours, during which mention push notifications
+// and emails are held back. In-app events are still delivered. Users without a
+// row have no schedule.
+type DNDSchedule struct {
+	UserID  uint `json:"-" gorm:"primaryKey"`
+	Enabled bool `json:"enabled" gorm:"not null"`
+	// StartMinute and EndMinute are minutes after local midnight. A window that
+	// ends before it starts runs past midnight and belongs to the day it starts on.
+	StartMinute int    `json:"start_minute" gorm:"not null"`
+	EndMinute   int    `json:"end_minute" gorm:"not null"`
+	Timezone    string `json:"timezone" gorm:"size:64;not null;default:'UTC'"`
+	// Days lists the weekdays the window starts on as comma-separated numbers,
+	// 0 for Sunday. Empty means every day.
+	Days string `json:"days" gorm:"size:32"`
+	// OverrideUntil ends a manual toggle; until then DND is on when OverrideActive
+	// is set and off otherwise, whatever the schedule says.
+	OverrideActive bool       `json:"override_active" gorm:"not null"`
+	OverrideUntil  *time.Time `json:"override_until"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
 // LoginRequest represents the login request payload.
 type LoginRequest struct {
 	Identifier string `json:"identifier" binding:"required"`
 	Password   string `json:"password" binding:"required,min=6"`
 }
 
+// TwoFactorCodeRequest confirms a TOTP code, e.g. when enabling 2FA.
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest turns 2FA off; Code may be a TOTP or backup code.
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// TwoFactorLoginRequest completes a login that returned a two-factor challenge.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
 // RegisterRequest represents the registration request payload.
 type RegisterRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=32"`
@@ -134,6 +519,81 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+// ChangeEmailRequest represents the payload for requesting an email address change.
+type ChangeEmailRequest struct {
+	Email           string `json:"email" binding:"required,email"`
+	CurrentPassword string `json:"current_password" binding:"required"`
+}
+
+// DeleteAccountRequest confirms account deletion with the user's password.
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// CreateAPITokenRequest represents the payload for minting an API token.
+type CreateAPITokenRequest struct {
+	Name     string   `json:"name" binding:"required,min=1,max=100"`
+	Scopes   []string `json:"scopes" binding:"required,min=1"`
+	ServerID *uint    `json:"server_id"`
+}
+
+// CreatePushSubscriptionRequest represents the payload for registering a push subscription.
+// It matches the JSON a browser's PushSubscription serializes to, plus the platform.
+type CreatePushSubscriptionRequest struct {
+	Platform string `json:"platform" binding:"omitempty,oneof=web"`
+	Endpoint string `json:"endpoint" binding:"required,url,max=1024"`
+	Keys     struct {
+		P256dh string `json:"p256dh" binding:"required"`
+		Auth   string `json:"auth" binding:"required"`
+	} `json:"keys"`
+}
+
+// DeletePushSubscriptionRequest identifies the push subscription to remove.
+type DeletePushSubscriptionRequest struct {
+	Endpoint string `json:"endpoint" binding:"required"`
+}
+
+// UpdateNotificationPreferencesRequest captures the notification settings to change. Nil fields are left unchanged.
+type UpdateNotificationPreferencesRequest struct {
+	PushMentions  *bool `json:"push_mentions"`
+	EmailMentions *bool `json:"email_mentions"`
+}
+
+// UpdateDNDScheduleRequest captures the quiet hours to change. Times are "HH:MM" in
+// the schedule's timezone. Nil fields are left unchanged.
+type UpdateDNDScheduleRequest struct {
+	Enabled  *bool   `json:"enabled"`
+	Start    *string `json:"start"`
+	End      *string `json:"end"`
+	Timezone *string `json:"timezone"`
+	Days     *[]int  `json:"days"`
+}
+
+// UpdatePrivacySettingsRequest captures the privacy settings to change. Nil fields are left unchanged.
+type UpdatePrivacySettingsRequest struct {
+	ReadReceipts *bool `json:"read_receipts"`
+}
+
+// SetDNDOverrideRequest turns do not disturb on or off for a while, whatever the
+// schedule says.
+type SetDNDOverrideRequest struct {
+	Active          bool `json:"active"`
+	DurationMinutes int  `json:"duration_minutes" binding:"required,min=1,max=10080"`
+}
+
+// CreateChannelWebhookRequest represents the payload for creating an incoming webhook.
+type CreateChannelWebhookRequest struct {
+	Name      string `json:"name" binding:"required,min=1,max=80"`
+	AvatarURL string `json:"avatar_url" binding:"omitempty,url,max=512"`
+}
+
+// ExecuteWebhookRequest represents the payload external systems post to a webhook URL.
+type ExecuteWebhookRequest struct {
+	Content   string `json:"content" binding:"required"`
+	Username  string `json:"username" binding:"omitempty,max=80"`
+	AvatarURL string `json:"avatar_url" binding:"omitempty,url,max=512"`
+}
+
 // CreateServerRequest represents the create server request payload.
 type CreateServerRequest struct {
 	Name        string `json:"name" binding:"required,min=1,max=100"`
@@ -148,6 +608,40 @@ type CreateChannelRequest struct {
 	Type        string `json:"type"`
 	ServerID    uint   `json:"server_id" binding:"required"`
 	Position    int    `json:"position"`
+	Private     bool   `json:"private"`
+	CategoryID  *uint  `json:"category_id"`
+	NSFW        bool   `json:"nsfw"`
+}
+
+// UpdateChannelRequest captures the mutable channel settings. Nil fields are left unchanged.
+type UpdateChannelRequest struct {
+	Name        *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description"`
+	Position    *int    `json:"position"`
+
+	MaxParticipants *int  `json:"max_participants"`
+	SlowmodeSeconds *int  `json:"slowmode_seconds"`
+	Private         *bool `json:"private"`
+
+	// MessageTTLSeconds sets how long new messages live; 0 disables expiry.
+	MessageTTLSeconds *int `json:"message_ttl_seconds"`
+
+	// CategoryID moves the channel into a category; 0 removes it from its category.
+	CategoryID *uint `json:"category_id"`
+
+	NSFW *bool `json:"nsfw"`
+}
+
+// CreateChannelCategoryRequest represents the payload to create a channel category.
+type CreateChannelCategoryRequest struct {
+	Name     string `json:"name" binding:"required,min=1,max=100"`
+	Position *int   `json:"position"`
+}
+
+// UpdateChannelCategoryRequest captures the mutable category settings. Nil fields are left unchanged.
+type UpdateChannelCategoryRequest struct {
+	Name     *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Position *int    `json:"position"`
 }
 
 // CreateMessageRequest represents the payload to create a channel message.
@@ -155,6 +649,10 @@ type CreateMessageRequest struct {
 	Content     string                    `json:"content"`
 	Type        string                    `json:"type"`
 	Attachments []CreateMessageAttachment `json:"attachments"`
+	ClientNonce string                    `json:"client_nonce"`
+	// TTLSeconds makes the message disappear after this many seconds. It can only
+	// shorten the channel's message TTL.
+	TTLSeconds *int `json:"ttl_seconds"`
 }
 
 // CreateMessageAttachment captures attachment metadata supplied by clients after uploading to object storage.
@@ -164,16 +662,71 @@ type CreateMessageAttachment struct {
 	FileName    string `json:"file_name" binding:"required"`
 	ContentType string `json:"content_type" binding:"required"`
 	FileSize    int64  `json:"file_size" binding:"required"`
+	AltText     string `json:"alt_text"`
+	// Position sets the display order; attachments without one keep their order in the request.
+	Position    *int   `json:"position"`
 }
 
 // CreateServerInviteRequest captures the payload for generating invite links and optional email sends.
+// OneTime is shorthand for MaxUses of 1; Role is the role granted on joining and defaults to member.
 type CreateServerInviteRequest struct {
 	ExpiresInHours int      `json:"expires_in_hours"`
 	MaxUses        int      `json:"max_uses"`
+	OneTime        bool     `json:"one_time"`
+	Role           string   `json:"role"`
 	Emails         []string `json:"emails"`
 	Message        string   `json:"message"`
 }
 
+// UpdateServerJoinGateRequest captures the payload for configuring a server's join gate.
+type UpdateServerJoinGateRequest struct {
+	Rules           *string `json:"rules" binding:"omitempty,max=8000"`
+	RequireRules    *bool   `json:"require_rules"`
+	RequireApproval *bool   `json:"require_approval"`
+}
+
+// UpdateServerWelcomeRequest captures the payload for configuring a server's welcome message.
+// A channel_id of 0 disables the welcome message.
+type UpdateServerWelcomeRequest struct {
+	ChannelID *uint   `json:"channel_id"`
+	Message   *string `json:"message" binding:"omitempty,max=2000"`
+}
+
+// UpdateServerDiscoveryRequest captures the payload for listing a server in public discovery.
+type UpdateServerDiscoveryRequest struct {
+	Public      *bool    `json:"public"`
+	Description *string  `json:"description" binding:"omitempty,max=500"`
+	Tags        []string `json:"tags" binding:"omitempty,max=5,dive,min=1,max=24"`
+}
+
+// UpdateServerWordFilterRequest captures the payload for configuring a server's word filter.
+// An empty terms list turns the filter off.
+type UpdateServerWordFilterRequest struct {
+	Terms  *[]string `json:"terms" binding:"omitempty,max=200,dive,max=64"`
+	Action *string   `json:"action" binding:"omitempty,oneof=block mask"`
+}
+
+// UpdateServerMemberRoleRequest captures the payload for assigning a member's role.
+type UpdateServerMemberRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// UpdateMemberNicknameRequest sets a member's nickname in one server; an empty nickname clears it.
+type UpdateMemberNicknameRequest struct {
+	Nickname string `json:"nickname" binding:"max=32"`
+}
+
+// TransferServerOwnershipRequest names the member who becomes the server owner.
+type TransferServerOwnershipRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// CreateServerBanRequest captures the payload for banning a user from a server.
+type CreateServerBanRequest struct {
+	UserID uint   `json:"user_id" binding:"required"`
+	Reason string `json:"reason" binding:"max=512"`
+}
+
 // AvatarCropData stores the crop/position information for an avatar image.
 type AvatarCropData struct {
 	X      float64 `json:"x"`
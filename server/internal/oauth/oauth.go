@@ -0,0 +1,261 @@
+// Package oauth implements the authorization code flow for third-party sign-in.
+// Each Provider knows its endpoints and how to turn an access token into a
+// Profile; handlers decide how a profile maps onto local accounts.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider names used in routes and stored on identities.
+const (
+	ProviderGoogle = "google"
+	ProviderGitHub = "github"
+)
+
+const (
+	requestTimeout  = 10 * time.Second
+	maxResponseSize = 1 << 20
+)
+
+var (
+	// ErrUnknownProvider is returned for providers that do not exist or are not configured.
+	ErrUnknownProvider = errors.New("unknown oauth provider")
+
+	// ErrNoVerifiedEmail means the provider did not return an email it has verified.
+	ErrNoVerifiedEmail = errors.New("oauth account has no verified email")
+)
+
+// Profile is the account information a provider returns after sign-in.
+type Profile struct {
+	ExternalID string
+	Email      string
+	// Username is the provider's handle or display name, used to suggest a local username.
+	Username string
+}
+
+// Provider is one configured OAuth identity provider.
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+
+	fetchProfile func(ctx context.Context, client *http.Client, accessToken string) (Profile, error)
+}
+
+// ProvidersFromEnv returns the providers whose client ID and secret are set:
+// GOOGLE_CLIENT_ID/GOOGLE_CLIENT_SECRET and GITHUB_CLIENT_ID/GITHUB_CLIENT_SECRET.
+func ProvidersFromEnv() map[string]Provider {
+	providers := make(map[string]Provider)
+
+	if id, secret := envCredentials("GOOGLE"); id != "" && secret != "" {
+		providers[ProviderGoogle] = Provider{
+			Name:         ProviderGoogle,
+			ClientID:     id,
+			ClientSecret: secret,
+			AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+			TokenURL:     "https://oauth2.googleapis.com/token",
+			Scopes:       []string{"openid", "email", "profile"},
+			fetchProfile: fetchGoogleProfile,
+		}
+	}
+
+	if id, secret := envCredentials("GITHUB"); id != "" && secret != "" {
+		providers[ProviderGitHub] = Provider{
+			Name:         ProviderGitHub,
+			ClientID:     id,
+			ClientSecret: secret,
+			AuthURL:      "https://github.com/login/oauth/authorize",
+			TokenURL:     "https://github.com/login/oauth/access_token",
+			Scopes:       []string{"read:user", "user:email"},
+			fetchProfile: fetchGitHubProfile,
+		}
+	}
+
+	return providers
+}
+
+// ProviderFromEnv returns the named provider if it is configured.
+func ProviderFromEnv(name string) (Provider, error) {
+	provider, ok := ProvidersFromEnv()[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Provider{}, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+// EnabledProviders lists the configured provider names in a stable order.
+func EnabledProviders() []string {
+	providers := ProvidersFromEnv()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AuthCodeURL returns the provider URL that starts sign-in.
+func (p Provider) AuthCodeURL(state, redirectURL string) string {
+	query := url.Values{}
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", redirectURL)
+	query.Set("response_type", "code")
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	if p.Name == ProviderGoogle {
+		query.Set("prompt", "select_account")
+	}
+
+	return p.AuthURL + "?" + query.Encode()
+}
+
+// Exchange trades the authorization code for an access token and loads the user's profile.
+func (p Provider) Exchange(ctx context.Context, code, redirectURL string) (Profile, error) {
+	client := &http.Client{Timeout: requestTimeout}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Profile{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := doJSON(client, req, &token); err != nil {
+		return Profile{}, fmt.Errorf("exchange oauth code: %w", err)
+	}
+	if token.AccessToken == "" {
+		return Profile{}, fmt.Errorf("exchange oauth code: %s %s", token.Error, token.Description)
+	}
+
+	return p.fetchProfile(ctx, client, token.AccessToken)
+}
+
+func fetchGoogleProfile(ctx context.Context, client *http.Client, accessToken string) (Profile, error) {
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := getJSON(ctx, client, "https://openidconnect.googleapis.com/v1/userinfo", accessToken, &info); err != nil {
+		return Profile{}, fmt.Errorf("load google profile: %w", err)
+	}
+
+	if info.Sub == "" {
+		return Profile{}, errors.New("load google profile: missing subject")
+	}
+	if info.Email == "" || !info.EmailVerified {
+		return Profile{}, ErrNoVerifiedEmail
+	}
+
+	username := info.Name
+	if username == "" {
+		username = strings.Split(info.Email, "@")[0]
+	}
+
+	return Profile{
+		ExternalID: info.Sub,
+		Email:      strings.ToLower(info.Email),
+		Username:   username,
+	}, nil
+}
+
+func fetchGitHubProfile(ctx context.Context, client *http.Client, accessToken string) (Profile, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user", accessToken, &user); err != nil {
+		return Profile{}, fmt.Errorf("load github profile: %w", err)
+	}
+	if user.ID == 0 {
+		return Profile{}, errors.New("load github profile: missing id")
+	}
+
+	// The profile email may be hidden or unverified; the emails endpoint says which are verified.
+	var emails []struct {
+		Email    string `json:"email"`
+		Primary  bool   `json:"primary"`
+		Verified bool   `json:"verified"`
+	}
+	if err := getJSON(ctx, client, "https://api.github.com/user/emails", accessToken, &emails); err != nil {
+		return Profile{}, fmt.Errorf("load github emails: %w", err)
+	}
+
+	var email string
+	for _, candidate := range emails {
+		if candidate.Verified && (candidate.Primary || email == "") {
+			email = candidate.Email
+		}
+	}
+	if email == "" {
+		return Profile{}, ErrNoVerifiedEmail
+	}
+
+	return Profile{
+		ExternalID: strconv.FormatInt(user.ID, 10),
+		Email:      strings.ToLower(email),
+		Username:   user.Login,
+	}, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, endpoint, accessToken string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	return doJSON(client, req, target)
+}
+
+func doJSON(client *http.Client, req *http.Request, target any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(body, target)
+}
+
+func envCredentials(prefix string) (string, string) {
+	return strings.TrimSpace(os.Getenv(prefix + "_CLIENT_ID")), strings.TrimSpace(os.Getenv(prefix + "_CLIENT_SECRET"))
+}
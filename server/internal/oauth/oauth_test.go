@@ -0,0 +1,248 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// roundTripFunc serves provider API requests from memory.
+type roundTripFunc func(*http.Request) *http.Response
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req), nil
+}
+
+// apiClient returns a client answering each URL path with the given JSON body.
+func apiClient(t *testing.T, responses map[string]string) *http.Client {
+	t.Helper()
+
+	return &http.Client{Transport: roundTripFunc(func(req *http.Request) *http.Response {
+		if got := req.Header.Get("Authorization"); got != "Bearer token-123" {
+			t.Errorf("Authorization = %q, want bearer token", got)
+		}
+		body, ok := responses[req.URL.Path]
+		status := http.StatusOK
+		if !ok {
+			status = http.StatusNotFound
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}
+	})}
+}
+
+func TestProvidersFromEnv(t *testing.T) {
+	t.Setenv("GOOGLE_CLIENT_ID", "google-id")
+	t.Setenv("GOOGLE_CLIENT_SECRET", "google-secret")
+	t.Setenv("GITHUB_CLIENT_ID", "github-id")
+	t.Setenv("GITHUB_CLIENT_SECRET", "")
+
+	if got := EnabledProviders(); len(got) != 1 || got[0] != ProviderGoogle {
+		t.Fatalf("EnabledProviders() = %v, want [google]", got)
+	}
+	if _, err := ProviderFromEnv(" GitHub "); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("ProviderFromEnv(github) error = %v, want ErrUnknownProvider", err)
+	}
+
+	t.Setenv("GITHUB_CLIENT_SECRET", "github-secret")
+	if got := EnabledProviders(); len(got) != 2 || got[0] != ProviderGitHub || got[1] != ProviderGoogle {
+		t.Fatalf("EnabledProviders() = %v, want [github google]", got)
+	}
+
+	provider, err := ProviderFromEnv(" GitHub ")
+	if err != nil {
+		t.Fatalf("ProviderFromEnv: %v", err)
+	}
+	if provider.Name != ProviderGitHub || provider.ClientSecret != "github-secret" {
+		t.Fatalf("ProviderFromEnv = %+v, want configured github provider", provider)
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   string
+		wantPrompt string
+	}{
+		{name: "google selects account", provider: ProviderGoogle, wantPrompt: "select_account"},
+		{name: "github", provider: ProviderGitHub, wantPrompt: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := Provider{Name: tt.provider, ClientID: "client", AuthURL: "https://idp.example.com/authorize", Scopes: []string{"openid", "email"}}
+
+			parsed, err := url.Parse(provider.AuthCodeURL("state-1", "https://chat.example.com/callback"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := parsed.Query()
+			if parsed.Host != "idp.example.com" || query.Get("client_id") != "client" || query.Get("state") != "state-1" {
+				t.Fatalf("AuthCodeURL = %s", parsed)
+			}
+			if query.Get("redirect_uri") != "https://chat.example.com/callback" || query.Get("response_type") != "code" {
+				t.Fatalf("AuthCodeURL = %s, want code flow to the callback", parsed)
+			}
+			if query.Get("scope") != "openid email" {
+				t.Fatalf("scope = %q, want %q", query.Get("scope"), "openid email")
+			}
+			if query.Get("prompt") != tt.wantPrompt {
+				t.Fatalf("prompt = %q, want %q", query.Get("prompt"), tt.wantPrompt)
+			}
+		})
+	}
+}
+
+func TestExchange(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("parse form: %v", err)
+		}
+		form = r.PostForm
+		if r.PostForm.Get("code") == "bad" {
+			_, _ = w.Write([]byte(`{"error":"bad_verification_code","error_description":"The code is wrong"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"access_token":"token-123"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	provider := Provider{
+		Name:         ProviderGitHub,
+		ClientID:     "client",
+		ClientSecret: "secret",
+		TokenURL:     server.URL,
+		fetchProfile: func(_ context.Context, _ *http.Client, accessToken string) (Profile, error) {
+			return Profile{ExternalID: accessToken}, nil
+		},
+	}
+
+	profile, err := provider.Exchange(context.Background(), "good", "https://chat.example.com/callback")
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if profile.ExternalID != "token-123" {
+		t.Fatalf("profile loaded with token %q, want %q", profile.ExternalID, "token-123")
+	}
+	if form.Get("grant_type") != "authorization_code" || form.Get("client_secret") != "secret" {
+		t.Fatalf("token request form = %v", form)
+	}
+
+	_, err = provider.Exchange(context.Background(), "bad", "https://chat.example.com/callback")
+	if err == nil || !strings.Contains(err.Error(), "bad_verification_code") {
+		t.Fatalf("Exchange(bad) error = %v, want the provider's error", err)
+	}
+}
+
+func TestFetchGoogleProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Profile
+		wantErr error
+	}{
+		{
+			name: "verified",
+			body: `{"sub":"g-1","email":"Jane@Example.com","email_verified":true,"name":"Jane Doe"}`,
+			want: Profile{ExternalID: "g-1", Email: "jane@example.com", Username: "Jane Doe"},
+		},
+		{
+			name: "name falls back to email",
+			body: `{"sub":"g-1","email":"jane@example.com","email_verified":true}`,
+			want: Profile{ExternalID: "g-1", Email: "jane@example.com", Username: "jane"},
+		},
+		{
+			name:    "unverified email",
+			body:    `{"sub":"g-1","email":"jane@example.com","email_verified":false}`,
+			wantErr: ErrNoVerifiedEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := apiClient(t, map[string]string{"/v1/userinfo": tt.body})
+
+			got, err := fetchGoogleProfile(context.Background(), client, "token-123")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("fetchGoogleProfile error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchGoogleProfile: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("fetchGoogleProfile = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchGitHubProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		emails  string
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "primary verified email wins",
+			emails: `[{"email":"old@example.com","verified":true},{"email":"Main@Example.com","primary":true,"verified":true}]`,
+			want:   "main@example.com",
+		},
+		{
+			name:   "unverified primary skipped",
+			emails: `[{"email":"main@example.com","primary":true,"verified":false},{"email":"work@example.com","verified":true}]`,
+			want:   "work@example.com",
+		},
+		{
+			name:    "no verified email",
+			emails:  `[{"email":"main@example.com","primary":true,"verified":false}]`,
+			wantErr: ErrNoVerifiedEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := apiClient(t, map[string]string{
+				"/user":        `{"id":583231,"login":"octocat"}`,
+				"/user/emails": tt.emails,
+			})
+
+			got, err := fetchGitHubProfile(context.Background(), client, "token-123")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("fetchGitHubProfile error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fetchGitHubProfile: %v", err)
+			}
+			want := Profile{ExternalID: "583231", Email: tt.want, Username: "octocat"}
+			if got != want {
+				t.Fatalf("fetchGitHubProfile = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDoJSONRejectsErrorStatus(t *testing.T) {
+	client := apiClient(t, map[string]string{})
+
+	var target map[string]any
+	err := getJSON(context.Background(), client, "https://api.github.com/missing", "token-123", &target)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("getJSON error = %v, want unexpected status 404", err)
+	}
+}
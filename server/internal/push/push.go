@@ -0,0 +1,102 @@
+// Package push delivers notifications to users' devices while they are offline.
+// Each delivery backend, such as Web Push, implements Sender for one platform,
+// and the Dispatcher routes a notification to the backend for the
+// subscription's platform. FCM or APNs can be added as further Senders.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Platforms a subscription can belong to.
+const (
+	PlatformWeb = "web"
+)
+
+var (
+	// ErrSubscriptionGone means the push service no longer accepts the
+	// subscription and it should be deleted.
+	ErrSubscriptionGone = errors.New("push subscription is no longer valid")
+
+	// ErrPermanent wraps delivery failures that retrying will not fix.
+	ErrPermanent = errors.New("push delivery rejected")
+
+	// ErrUnsupportedPlatform is returned when no Sender handles a subscription's platform.
+	ErrUnsupportedPlatform = errors.New("unsupported push platform")
+)
+
+// Subscription identifies a device registered to receive pushes.
+type Subscription struct {
+	Platform string
+	Endpoint string
+	P256dh   string
+	Auth     string
+}
+
+// Notification is the payload shown to the user.
+type Notification struct {
+	Title string         `json:"title"`
+	Body  string         `json:"body"`
+	URL   string         `json:"url,omitempty"`
+	Tag   string         `json:"tag,omitempty"`
+	Data  map[string]any `json:"data,omitempty"`
+}
+
+// Sender delivers notifications for a single platform.
+type Sender interface {
+	Platform() string
+	Send(ctx context.Context, subscription Subscription, payload []byte) error
+}
+
+// Dispatcher routes notifications to the Sender registered for each platform.
+type Dispatcher struct {
+	senders map[string]Sender
+}
+
+// NewDispatcher returns a dispatcher for the given senders. Nil senders are ignored.
+func NewDispatcher(senders ...Sender) *Dispatcher {
+	d := &Dispatcher{senders: make(map[string]Sender, len(senders))}
+	for _, sender := range senders {
+		if sender != nil {
+			d.senders[sender.Platform()] = sender
+		}
+	}
+
+	return d
+}
+
+// Enabled reports whether any delivery backend is configured.
+func (d *Dispatcher) Enabled() bool {
+	return d != nil && len(d.senders) > 0
+}
+
+// Supports reports whether notifications can be delivered to the platform.
+func (d *Dispatcher) Supports(platform string) bool {
+	if d == nil {
+		return false
+	}
+	_, ok := d.senders[platform]
+	return ok
+}
+
+// Send delivers a notification to one subscription.
+func (d *Dispatcher) Send(ctx context.Context, subscription Subscription, notification Notification) error {
+	if d == nil {
+		return ErrUnsupportedPlatform
+	}
+
+	sender, ok := d.senders[subscription.Platform]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnsupportedPlatform, subscription.Platform)
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	return sender.Send(ctx, subscription, payload)
+}
@@ -0,0 +1,311 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type recordingSender struct {
+	platform string
+	payloads [][]byte
+}
+
+func (s *recordingSender) Platform() string {
+	return s.platform
+}
+
+func (s *recordingSender) Send(_ context.Context, _ Subscription, payload []byte) error {
+	s.payloads = append(s.payloads, payload)
+	return nil
+}
+
+func TestDispatcherRoutesByPlatform(t *testing.T) {
+	web := &recordingSender{platform: PlatformWeb}
+	dispatcher := NewDispatcher(nil, web)
+
+	if !dispatcher.Enabled() {
+		t.Fatal("Enabled() = false, want true")
+	}
+	if !dispatcher.Supports(PlatformWeb) || dispatcher.Supports("apns") {
+		t.Fatalf("Supports(web, apns) = (%v, %v), want (true, false)", dispatcher.Supports(PlatformWeb), dispatcher.Supports("apns"))
+	}
+
+	notification := Notification{Title: "jane mentioned you", Body: "hi @bob", URL: "/channels/1"}
+	if err := dispatcher.Send(context.Background(), Subscription{Platform: PlatformWeb}, notification); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if len(web.payloads) != 1 {
+		t.Fatalf("sender got %d payloads, want 1", len(web.payloads))
+	}
+	var got Notification
+	if err := json.Unmarshal(web.payloads[0], &got); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if got.Title != notification.Title || got.URL != notification.URL {
+		t.Fatalf("payload = %+v, want %+v", got, notification)
+	}
+
+	err := dispatcher.Send(context.Background(), Subscription{Platform: "apns"}, notification)
+	if !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Fatalf("Send(apns) error = %v, want ErrUnsupportedPlatform", err)
+	}
+}
+
+func TestNilDispatcher(t *testing.T) {
+	var dispatcher *Dispatcher
+
+	if dispatcher.Enabled() || dispatcher.Supports(PlatformWeb) {
+		t.Fatal("nil dispatcher reports itself enabled")
+	}
+	if err := dispatcher.Send(context.Background(), Subscription{Platform: PlatformWeb}, Notification{}); !errors.Is(err, ErrUnsupportedPlatform) {
+		t.Fatalf("Send error = %v, want ErrUnsupportedPlatform", err)
+	}
+}
+
+// newTestSender builds a sender with a freshly generated VAPID key pair.
+func newTestSender(t *testing.T) *WebPushSender {
+	t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate VAPID key: %v", err)
+	}
+
+	sender, err := NewWebPushSender(WebPushConfig{
+		PublicKey:  base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		PrivateKey: base64.RawURLEncoding.EncodeToString(key.Bytes()),
+		Subject:    "mailto:ops@example.com",
+	})
+	if err != nil {
+		t.Fatalf("NewWebPushSender: %v", err)
+	}
+
+	return sender
+}
+
+// newTestSubscription returns a browser subscription and the browser's private key.
+func newTestSubscription(t *testing.T, endpoint string) (Subscription, *ecdh.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate subscription key: %v", err)
+	}
+	auth := make([]byte, 16)
+	if _, err := rand.Read(auth); err != nil {
+		t.Fatalf("generate auth secret: %v", err)
+	}
+
+	return Subscription{
+		Platform: PlatformWeb,
+		Endpoint: endpoint,
+		P256dh:   base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()),
+		Auth:     base64.URLEncoding.EncodeToString(auth),
+	}, key, auth
+}
+
+func TestNewWebPushSenderValidatesKeys(t *testing.T) {
+	key, _ := ecdh.P256().GenerateKey(rand.Reader)
+	other, _ := ecdh.P256().GenerateKey(rand.Reader)
+	private := base64.RawURLEncoding.EncodeToString(key.Bytes())
+
+	tests := []struct {
+		name string
+		cfg  WebPushConfig
+	}{
+		{name: "missing private key", cfg: WebPushConfig{Subject: "mailto:ops@example.com"}},
+		{name: "missing subject", cfg: WebPushConfig{PrivateKey: private}},
+		{name: "malformed private key", cfg: WebPushConfig{PrivateKey: "not-a-key", Subject: "mailto:ops@example.com"}},
+		{name: "mismatched public key", cfg: WebPushConfig{
+			PrivateKey: private,
+			PublicKey:  base64.RawURLEncoding.EncodeToString(other.PublicKey().Bytes()),
+			Subject:    "mailto:ops@example.com",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewWebPushSender(tt.cfg); err == nil {
+				t.Fatal("NewWebPushSender succeeded, want error")
+			}
+		})
+	}
+
+	sender, err := NewWebPushSender(WebPushConfig{PrivateKey: private, Subject: "mailto:ops@example.com"})
+	if err != nil {
+		t.Fatalf("NewWebPushSender without a public key: %v", err)
+	}
+	if want := base64.RawURLEncoding.EncodeToString(key.PublicKey().Bytes()); sender.PublicKey() != want {
+		t.Fatalf("PublicKey() = %q, want %q", sender.PublicKey(), want)
+	}
+}
+
+func TestEncryptWebPushPayloadRoundTrip(t *testing.T) {
+	subscription, browserKey, auth := newTestSubscription(t, "https://push.example.com/send/abc")
+	plaintext := []byte(`{"title":"jane mentioned you"}`)
+
+	body, err := encryptWebPushPayload(subscription, plaintext)
+	if err != nil {
+		t.Fatalf("encryptWebPushPayload: %v", err)
+	}
+
+	// Decrypt as the browser would (RFC 8291 section 3.4).
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != webPushRecordSize {
+		t.Fatalf("record size = %d, want %d", rs, webPushRecordSize)
+	}
+	keyIDLen := int(body[20])
+	serverPublic := body[21 : 21+keyIDLen]
+	ciphertext := body[21+keyIDLen:]
+
+	serverKey, err := ecdh.P256().NewPublicKey(serverPublic)
+	if err != nil {
+		t.Fatalf("server key: %v", err)
+	}
+	sharedSecret, err := browserKey.ECDH(serverKey)
+	if err != nil {
+		t.Fatalf("ECDH: %v", err)
+	}
+
+	keyInfo := append([]byte("WebPush: info\x00"), browserKey.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, serverPublic...)
+	inputKey, _ := hkdfExpand(sharedSecret, auth, keyInfo, 32)
+	contentKey, _ := hkdfExpand(inputKey, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce, _ := hkdfExpand(inputKey, salt, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, _ := aes.NewCipher(contentKey)
+	gcm, _ := cipher.NewGCM(block)
+	record, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("decrypt: %v", err)
+	}
+
+	if record[len(record)-1] != 0x02 {
+		t.Fatalf("padding delimiter = %#x, want 0x02", record[len(record)-1])
+	}
+	if got := string(record[:len(record)-1]); got != string(plaintext) {
+		t.Fatalf("plaintext = %q, want %q", got, plaintext)
+	}
+}
+
+func TestEncryptWebPushPayloadRejectsBadKeys(t *testing.T) {
+	subscription, _, _ := newTestSubscription(t, "https://push.example.com/send/abc")
+
+	badAuth := subscription
+	badAuth.Auth = base64.RawURLEncoding.EncodeToString([]byte("short"))
+	if _, err := encryptWebPushPayload(badAuth, []byte("hi")); err == nil {
+		t.Fatal("encrypt with a short auth secret succeeded, want error")
+	}
+
+	badKey := subscription
+	badKey.P256dh = base64.RawURLEncoding.EncodeToString([]byte("not a point"))
+	if _, err := encryptWebPushPayload(badKey, []byte("hi")); err == nil {
+		t.Fatal("encrypt with an invalid p256dh key succeeded, want error")
+	}
+}
+
+func TestVAPIDToken(t *testing.T) {
+	sender := newTestSender(t)
+
+	token, err := sender.vapidToken("https://push.example.com:8443/send/abc")
+	if err != nil {
+		t.Fatalf("vapidToken: %v", err)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return &sender.signingKey.PublicKey, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}))
+	if err != nil {
+		t.Fatalf("parse token: %v", err)
+	}
+	if claims["aud"] != "https://push.example.com:8443" {
+		t.Fatalf("aud = %v, want %q", claims["aud"], "https://push.example.com:8443")
+	}
+	if claims["sub"] != "mailto:ops@example.com" {
+		t.Fatalf("sub = %v, want %q", claims["sub"], "mailto:ops@example.com")
+	}
+
+	if _, err := sender.vapidToken("http://push.example.com/send/abc"); err == nil {
+		t.Fatal("vapidToken for an http endpoint succeeded, want error")
+	}
+}
+
+func TestWebPushSendRejectsPermanently(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached a loopback push endpoint")
+	}))
+	t.Cleanup(server.Close)
+
+	sender := newTestSender(t)
+	valid, _, _ := newTestSubscription(t, server.URL+"/send/abc")
+	insecure, _, _ := newTestSubscription(t, "http://push.example.com/send/abc")
+
+	tests := []struct {
+		name         string
+		subscription Subscription
+		payload      []byte
+	}{
+		{name: "oversized payload", subscription: valid, payload: []byte(strings.Repeat("x", maxWebPushPayload+1))},
+		{name: "insecure endpoint", subscription: insecure, payload: []byte("{}")},
+		{name: "loopback endpoint", subscription: valid, payload: []byte("{}")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := sender.Send(context.Background(), tt.subscription, tt.payload)
+			if !errors.Is(err, ErrPermanent) {
+				t.Fatalf("Send error = %v, want ErrPermanent", err)
+			}
+		})
+	}
+}
+
+func TestDecodeBase64URL(t *testing.T) {
+	want := []byte{0xfb, 0xff, 0x01}
+
+	for _, value := range []string{"-_8B", "+/8B", "-_8B==", " -_8B "} {
+		got, err := decodeBase64URL(value)
+		if err != nil {
+			t.Fatalf("decodeBase64URL(%q): %v", value, err)
+		}
+		if string(got) != string(want) {
+			t.Fatalf("decodeBase64URL(%q) = %x, want %x", value, got, want)
+		}
+	}
+}
+
+func TestWebPushConfigFromEnv(t *testing.T) {
+	t.Setenv("VAPID_SUBJECT", " mailto:ops@example.com ")
+	t.Setenv("WEB_PUSH_TTL", "1h")
+	t.Setenv("OUTBOUND_FETCH_ALLOWED_SCHEMES", "http,https")
+
+	cfg := WebPushConfigFromEnv()
+	if cfg.Subject != "mailto:ops@example.com" {
+		t.Fatalf("Subject = %q, want %q", cfg.Subject, "mailto:ops@example.com")
+	}
+	if cfg.TTL.Hours() != 1 {
+		t.Fatalf("TTL = %v, want 1h", cfg.TTL)
+	}
+	if len(cfg.Fetch.AllowedSchemes) != 1 || cfg.Fetch.AllowedSchemes[0] != "https" {
+		t.Fatalf("AllowedSchemes = %v, want [https]", cfg.Fetch.AllowedSchemes)
+	}
+
+	t.Setenv("WEB_PUSH_TTL", "-5m")
+	if cfg := WebPushConfigFromEnv(); cfg.TTL != defaultWebPushTTL {
+		t.Fatalf("TTL with negative override = %v, want %v", cfg.TTL, defaultWebPushTTL)
+	}
+}
@@ -0,0 +1,304 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"bafachat/internal/safefetch"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// webPushRecordSize is the aes128gcm record size; the whole payload fits in one record.
+	webPushRecordSize = 4096
+
+	// maxWebPushPayload is the largest plaintext that fits in a single 4096-byte
+	// push message once the header, padding delimiter and GCM tag are added.
+	maxWebPushPayload = webPushRecordSize - 86 - 1 - 16
+
+	// defaultWebPushTTL is how long the push service keeps an undelivered message.
+	defaultWebPushTTL = 24 * time.Hour
+
+	// vapidTokenLifetime must not exceed the 24 hours allowed by RFC 8292.
+	vapidTokenLifetime = 12 * time.Hour
+)
+
+// WebPushConfig holds the VAPID identity used to sign Web Push requests.
+type WebPushConfig struct {
+	// PublicKey is the base64url uncompressed P-256 public key shared with browsers.
+	PublicKey string
+	// PrivateKey is the base64url 32-byte P-256 private key.
+	PrivateKey string
+	// Subject is a mailto: or https: contact for the push service operator.
+	Subject string
+	TTL     time.Duration
+	// Fetch limits requests to push endpoints, which subscribers choose.
+	Fetch safefetch.Config
+}
+
+// WebPushConfigFromEnv reads VAPID_PUBLIC_KEY, VAPID_PRIVATE_KEY, VAPID_SUBJECT
+// and WEB_PUSH_TTL, plus the shared outbound fetch limits. Push endpoints are
+// always https.
+func WebPushConfigFromEnv() WebPushConfig {
+	cfg := WebPushConfig{
+		PublicKey:  strings.TrimSpace(os.Getenv("VAPID_PUBLIC_KEY")),
+		PrivateKey: strings.TrimSpace(os.Getenv("VAPID_PRIVATE_KEY")),
+		Subject:    strings.TrimSpace(os.Getenv("VAPID_SUBJECT")),
+		TTL:        defaultWebPushTTL,
+		Fetch:      safefetch.ConfigFromEnv(),
+	}
+	cfg.Fetch.AllowedSchemes = []string{"https"}
+
+	if raw := strings.TrimSpace(os.Getenv("WEB_PUSH_TTL")); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			cfg.TTL = ttl
+		}
+	}
+
+	return cfg
+}
+
+// WebPushSender delivers encrypted notifications to browser push services
+// (RFC 8030) using aes128gcm payload encryption (RFC 8291) and VAPID (RFC 8292).
+type WebPushSender struct {
+	httpClient *safefetch.Client
+	publicKey  string
+	signingKey *ecdsa.PrivateKey
+	subject    string
+	ttl        time.Duration
+}
+
+// NewWebPushSender validates the VAPID key pair and returns a sender.
+func NewWebPushSender(cfg WebPushConfig) (*WebPushSender, error) {
+	if cfg.PrivateKey == "" {
+		return nil, errors.New("VAPID_PRIVATE_KEY is required")
+	}
+	if cfg.Subject == "" {
+		return nil, errors.New("VAPID_SUBJECT is required")
+	}
+
+	scalar, err := decodeBase64URL(cfg.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+
+	privateKey, err := ecdh.P256().NewPrivateKey(scalar)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID_PRIVATE_KEY: %w", err)
+	}
+	publicKey := privateKey.PublicKey().Bytes()
+
+	if cfg.PublicKey != "" {
+		configured, err := decodeBase64URL(cfg.PublicKey)
+		if err != nil || !bytes.Equal(configured, publicKey) {
+			return nil, errors.New("VAPID_PUBLIC_KEY does not match VAPID_PRIVATE_KEY")
+		}
+	}
+
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultWebPushTTL
+	}
+
+	return &WebPushSender{
+		httpClient: safefetch.New(cfg.Fetch),
+		publicKey:  base64.RawURLEncoding.EncodeToString(publicKey),
+		signingKey: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(publicKey[1:33]),
+				Y:     new(big.Int).SetBytes(publicKey[33:]),
+			},
+			D: new(big.Int).SetBytes(scalar),
+		},
+		subject: cfg.Subject,
+		ttl:     ttl,
+	}, nil
+}
+
+// PublicKey returns the base64url application server key browsers subscribe with.
+func (s *WebPushSender) PublicKey() string {
+	return s.publicKey
+}
+
+// Platform implements Sender.
+func (s *WebPushSender) Platform() string {
+	return PlatformWeb
+}
+
+// Send implements Sender.
+func (s *WebPushSender) Send(ctx context.Context, subscription Subscription, payload []byte) error {
+	if len(payload) > maxWebPushPayload {
+		return fmt.Errorf("%w: payload of %d bytes exceeds %d", ErrPermanent, len(payload), maxWebPushPayload)
+	}
+
+	body, err := encryptWebPushPayload(subscription, payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+
+	token, err := s.vapidToken(subscription.Endpoint)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrPermanent, err)
+	}
+
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(s.ttl.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", fmt.Sprintf("vapid t=%s, k=%s", token, s.publicKey))
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, safefetch.ErrBlocked) {
+			return fmt.Errorf("%w: %v", ErrPermanent, err)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrSubscriptionGone
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("web push failed with status %d", resp.StatusCode)
+	default:
+		return fmt.Errorf("%w: web push failed with status %d", ErrPermanent, resp.StatusCode)
+	}
+}
+
+// vapidToken signs the JWT that identifies this server to the endpoint's push service.
+func (s *WebPushSender) vapidToken(endpoint string) (string, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return "", errors.New("push endpoint must be an https URL")
+	}
+
+	claims := jwt.MapClaims{
+		"aud": parsed.Scheme + "://" + parsed.Host,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": s.subject,
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(s.signingKey)
+}
+
+// encryptWebPushPayload encrypts a payload for the subscription's browser key as
+// a single aes128gcm record (RFC 8291 section 3).
+func encryptWebPushPayload(subscription Subscription, plaintext []byte) ([]byte, error) {
+	userAgentKey, err := decodeBase64URL(subscription.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	authSecret, err := decodeBase64URL(subscription.Auth)
+	if err != nil || len(authSecret) != 16 {
+		return nil, errors.New("invalid auth secret")
+	}
+
+	curve := ecdh.P256()
+	userAgentPublic, err := curve.NewPublicKey(userAgentKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+
+	serverPrivate, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serverPublic := serverPrivate.PublicKey().Bytes()
+
+	sharedSecret, err := serverPrivate.ECDH(userAgentPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	keyInfo := make([]byte, 0, 14+len(userAgentKey)+len(serverPublic))
+	keyInfo = append(keyInfo, "WebPush: info\x00"...)
+	keyInfo = append(keyInfo, userAgentKey...)
+	keyInfo = append(keyInfo, serverPublic...)
+	inputKey, err := hkdfExpand(sharedSecret, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	contentKey, err := hkdfExpand(inputKey, salt, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdfExpand(inputKey, salt, []byte("Content-Encoding: nonce\x00"), 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// A single record ends with the 0x02 padding delimiter.
+	record := make([]byte, 0, len(plaintext)+1)
+	record = append(record, plaintext...)
+	record = append(record, 0x02)
+
+	header := make([]byte, 0, 16+4+1+len(serverPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, webPushRecordSize)
+	header = append(header, byte(len(serverPublic)))
+	header = append(header, serverPublic...)
+
+	return gcm.Seal(header, nonce, record, nil), nil
+}
+
+func hkdfExpand(secret, salt, info []byte, length int) ([]byte, error) {
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// decodeBase64URL accepts the padded or unpadded base64url keys browsers and
+// key generators produce.
+func decodeBase64URL(value string) ([]byte, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "=")
+	value = strings.NewReplacer("+", "-", "/", "_").Replace(value)
+	return base64.RawURLEncoding.DecodeString(value)
+}
@@ -0,0 +1,126 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/hibiken/asynq"
+)
+
+const (
+	// defaultQueue is the Asynq queue tasks are enqueued to when no queue is named.
+	defaultQueue = "default"
+
+	// archivePageSize is how many archived tasks are read from Redis per request
+	// when counting failed emails.
+	archivePageSize = 100
+)
+
+// ErrFailedEmailNotFound is returned when a task ID does not name an archived email.
+var ErrFailedEmailNotFound = errors.New("failed email not found")
+
+// FailedEmail is an email task, plain or template, that Asynq archived after it failed permanently
+// or exhausted its retries.
+type FailedEmail struct {
+	TaskID   string    `json:"task_id"`
+	To       string    `json:"to"`
+	Subject  string    `json:"subject,omitempty"`
+	Template string    `json:"template,omitempty"`
+	Tag      string    `json:"tag,omitempty"`
+	Error    string    `json:"error"`
+	Retried  int       `json:"retried"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// FailedEmailReport summarises the email tasks in the dead-letter (archived) queue.
+type FailedEmailReport struct {
+	Count  int           `json:"count"`
+	Recent []FailedEmail `json:"recent"`
+}
+
+// NewInspector returns an Asynq inspector for reading and managing queued tasks.
+func NewInspector(cfg Config) (*asynq.Inspector, error) {
+	if cfg.Addr == "" {
+		return nil, errors.New("redis address is required")
+	}
+
+	return asynq.NewInspector(asynq.RedisClientOpt{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	}), nil
+}
+
+// FailedEmails counts the archived email tasks and returns the most recent ones,
+// newest first.
+func FailedEmails(inspector *asynq.Inspector, limit int) (FailedEmailReport, error) {
+	report := FailedEmailReport{Recent: []FailedEmail{}}
+
+	for page := 1; ; page++ {
+		tasks, err := inspector.ListArchivedTasks(defaultQueue, asynq.Page(page), asynq.PageSize(archivePageSize))
+		if err != nil {
+			if errors.Is(err, asynq.ErrQueueNotFound) {
+				return report, nil
+			}
+			return report, err
+		}
+
+		for _, task := range tasks {
+			if !isEmailTask(task.Type) {
+				continue
+			}
+
+			report.Count++
+			if len(report.Recent) < limit {
+				report.Recent = append(report.Recent, failedEmailFromTask(task))
+			}
+		}
+
+		if len(tasks) < archivePageSize {
+			return report, nil
+		}
+	}
+}
+
+// RetryFailedEmail moves an archived email task back to the pending queue.
+func RetryFailedEmail(inspector *asynq.Inspector, taskID string) error {
+	task, err := inspector.GetTaskInfo(defaultQueue, taskID)
+	if err != nil {
+		if errors.Is(err, asynq.ErrQueueNotFound) || errors.Is(err, asynq.ErrTaskNotFound) {
+			return ErrFailedEmailNotFound
+		}
+		return err
+	}
+
+	if !isEmailTask(task.Type) || task.State != asynq.TaskStateArchived {
+		return ErrFailedEmailNotFound
+	}
+
+	return inspector.RunTask(defaultQueue, taskID)
+}
+
+func isEmailTask(taskType string) bool {
+	return taskType == TypeEmailDelivery || taskType == TypeTemplateEmail
+}
+
+func failedEmailFromTask(task *asynq.TaskInfo) FailedEmail {
+	failed := FailedEmail{
+		TaskID:   task.ID,
+		Error:    task.LastErr,
+		Retried:  task.Retried,
+		FailedAt: task.LastFailedAt,
+	}
+
+	if task.Type == TypeTemplateEmail {
+		var payload TemplateEmailTaskPayload
+		_ = json.Unmarshal(task.Payload, &payload)
+		failed.To, failed.Template, failed.Tag = payload.To, payload.TemplateAlias, payload.Tag
+		return failed
+	}
+
+	var payload EmailTaskPayload
+	_ = json.Unmarshal(task.Payload, &payload)
+	failed.To, failed.Subject, failed.Tag = payload.To, payload.Subject, payload.Tag
+	return failed
+}
@@ -13,6 +13,9 @@ import (
 	"time"
 
 	"bafachat/internal/email"
+	"bafachat/internal/logging"
+	"bafachat/internal/push"
+	"bafachat/internal/unfurl"
 
 	"github.com/hibiken/asynq"
 )
@@ -20,6 +23,26 @@ import (
 const (
 	// TypeEmailDelivery represents a task to deliver an email.
 	TypeEmailDelivery = "email:deliver"
+	// TypeTemplateEmail represents a task to deliver a Postmark template email.
+	TypeTemplateEmail = "email:template"
+	// TypePreviewGeneration represents a task to build previews for message attachments.
+	TypePreviewGeneration = "attachments:preview"
+	// TypePushDelivery represents a task to deliver a push notification to one subscription.
+	TypePushDelivery = "push:deliver"
+	// TypeMentionEmail represents a delayed check that emails a mentioned user who is still away.
+	TypeMentionEmail = "mention:email"
+	// TypeLinkPreview represents a task to fetch the preview card for a link in a message.
+	TypeLinkPreview = "messages:link_preview"
+	// TypeDataExport represents a task to build a user's data export and email the download link.
+	TypeDataExport = "users:export"
+
+	// defaultEmailMaxRetry and defaultPreviewMaxRetry are used when
+	// EMAIL_MAX_RETRY or PREVIEW_MAX_RETRY is unset.
+	defaultEmailMaxRetry   = 5
+	defaultPreviewMaxRetry = 3
+	defaultPushMaxRetry    = 3
+	defaultLinkMaxRetry    = 2
+	defaultExportMaxRetry  = 2
 )
 
 // Config holds Redis/Asynq configuration values.
@@ -40,6 +63,83 @@ type EmailTaskPayload struct {
 	Meta     map[string]string `json:"meta,omitempty"`
 }
 
+// TemplateEmailTaskPayload defines the payload for template email tasks. It
+// mirrors email.SendTemplateInput, with the template referenced by alias.
+type TemplateEmailTaskPayload struct {
+	To            string            `json:"to"`
+	TemplateAlias string            `json:"template_alias"`
+	Model         map[string]any    `json:"model"`
+	Tag           string            `json:"tag,omitempty"`
+	Meta          map[string]string `json:"meta,omitempty"`
+}
+
+// SendInput converts the payload into the email service's input.
+func (p TemplateEmailTaskPayload) SendInput() email.SendTemplateInput {
+	return email.SendTemplateInput{
+		To:            p.To,
+		TemplateAlias: p.TemplateAlias,
+		Model:         p.Model,
+		Tag:           p.Tag,
+		Metadata:      p.Meta,
+	}
+}
+
+// PreviewTaskPayload identifies the attachments of a message that need previews.
+type PreviewTaskPayload struct {
+	MessageID     uint   `json:"message_id"`
+	AttachmentIDs []uint `json:"attachment_ids"`
+	// RequestID ties the task's log lines to the request that queued it.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// PushTaskPayload identifies the subscription to notify and what to show.
+type PushTaskPayload struct {
+	SubscriptionID uint              `json:"subscription_id"`
+	Notification   push.Notification `json:"notification"`
+	// RequestID ties the task's log lines to the request that queued it.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// MentionEmailTaskPayload identifies a mention whose email is waiting out the grace delay.
+type MentionEmailTaskPayload struct {
+	MessageID   uint `json:"message_id"`
+	RecipientID uint `json:"recipient_id"`
+	// RequestID ties the task's log lines to the request that queued it.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// LinkPreviewTaskPayload identifies the message and the URL to unfurl for it.
+type LinkPreviewTaskPayload struct {
+	MessageID uint   `json:"message_id"`
+	URL       string `json:"url"`
+	// RequestID ties the task's log lines to the request that queued it.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// DataExportTaskPayload identifies the export to build.
+type DataExportTaskPayload struct {
+	ExportID uint `json:"export_id"`
+	// BaseURL is the API origin the download link in the email points at.
+	BaseURL string `json:"base_url"`
+	// RequestID ties the task's log lines to the request that queued it.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// DataExportProcessor builds a queued data export and notifies its owner.
+type DataExportProcessor func(ctx context.Context, payload DataExportTaskPayload) error
+
+// LinkPreviewProcessor fetches and stores a queued link preview.
+type LinkPreviewProcessor func(ctx context.Context, payload LinkPreviewTaskPayload) error
+
+// MentionEmailProcessor decides whether a delayed mention email is still needed and sends it.
+type MentionEmailProcessor func(ctx context.Context, payload MentionEmailTaskPayload) error
+
+// PushProcessor delivers a queued push notification.
+type PushProcessor func(ctx context.Context, payload PushTaskPayload) error
+
+// PreviewProcessor builds and persists previews for a queued preview task.
+type PreviewProcessor func(ctx context.Context, payload PreviewTaskPayload) error
+
 // ConfigFromEnv builds an Asynq configuration using environment variables.
 func ConfigFromEnv() Config {
 	cfg := Config{
@@ -113,18 +213,53 @@ func NewServer(cfg Config) (*asynq.Server, error) {
 			// Exponential backoff with sane defaults.
 			return time.Duration(n*n) * time.Second
 		},
+		ErrorHandler: asynq.ErrorHandlerFunc(reportTaskFailure),
 	})
 
 	return server, nil
 }
 
-// NewMux registers queue handlers and returns a ServeMux.
-func NewMux(emailService *email.Service) *asynq.ServeMux {
+// NewMux registers queue handlers and returns a ServeMux. Preview, push, mention
+// email, link preview and data export tasks are only handled when a processor is supplied.
+func NewMux(emailService *email.Service, previews PreviewProcessor, pushes PushProcessor, mentions MentionEmailProcessor, links LinkPreviewProcessor, exports DataExportProcessor) *asynq.ServeMux {
 	mux := asynq.NewServeMux()
 
 	mux.HandleFunc(TypeEmailDelivery, func(ctx context.Context, task *asynq.Task) error {
 		return handleEmailDelivery(ctx, task, emailService)
 	})
+	mux.HandleFunc(TypeTemplateEmail, func(ctx context.Context, task *asynq.Task) error {
+		return handleTemplateEmail(ctx, task, emailService)
+	})
+
+	if previews != nil {
+		mux.HandleFunc(TypePreviewGeneration, func(ctx context.Context, task *asynq.Task) error {
+			return handlePreviewGeneration(ctx, task, previews)
+		})
+	}
+
+	if pushes != nil {
+		mux.HandleFunc(TypePushDelivery, func(ctx context.Context, task *asynq.Task) error {
+			return handlePushDelivery(ctx, task, pushes)
+		})
+	}
+
+	if mentions != nil {
+		mux.HandleFunc(TypeMentionEmail, func(ctx context.Context, task *asynq.Task) error {
+			return handleMentionEmail(ctx, task, mentions)
+		})
+	}
+
+	if links != nil {
+		mux.HandleFunc(TypeLinkPreview, func(ctx context.Context, task *asynq.Task) error {
+			return handleLinkPreview(ctx, task, links)
+		})
+	}
+
+	if exports != nil {
+		mux.HandleFunc(TypeDataExport, func(ctx context.Context, task *asynq.Task) error {
+			return handleDataExport(ctx, task, exports)
+		})
+	}
 
 	return mux
 }
@@ -146,13 +281,200 @@ func NewEmailTask(payload EmailTaskPayload) (*asynq.Task, error) {
 		return nil, err
 	}
 
-	return asynq.NewTask(TypeEmailDelivery, body), nil
+	return asynq.NewTask(TypeEmailDelivery, body, asynq.MaxRetry(maxRetryFromEnv("EMAIL_MAX_RETRY", defaultEmailMaxRetry))), nil
+}
+
+// NewTemplateEmailTask builds an Asynq task payload for sending a template email.
+// It shares EMAIL_MAX_RETRY with plain emails.
+func NewTemplateEmailTask(payload TemplateEmailTaskPayload) (*asynq.Task, error) {
+	if payload.To == "" {
+		return nil, errors.New("email recipient is required")
+	}
+	if payload.TemplateAlias == "" {
+		return nil, errors.New("email template alias is required")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypeTemplateEmail, body, asynq.MaxRetry(maxRetryFromEnv("EMAIL_MAX_RETRY", defaultEmailMaxRetry))), nil
+}
+
+// NewPreviewTask builds an Asynq task payload for generating attachment previews.
+func NewPreviewTask(payload PreviewTaskPayload) (*asynq.Task, error) {
+	if payload.MessageID == 0 {
+		return nil, errors.New("message id is required")
+	}
+	if len(payload.AttachmentIDs) == 0 {
+		return nil, errors.New("attachment ids are required")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypePreviewGeneration, body, asynq.MaxRetry(maxRetryFromEnv("PREVIEW_MAX_RETRY", defaultPreviewMaxRetry))), nil
+}
+
+// NewPushTask builds an Asynq task payload for delivering a push notification.
+func NewPushTask(payload PushTaskPayload) (*asynq.Task, error) {
+	if payload.SubscriptionID == 0 {
+		return nil, errors.New("push subscription id is required")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypePushDelivery, body, asynq.MaxRetry(maxRetryFromEnv("PUSH_MAX_RETRY", defaultPushMaxRetry))), nil
+}
+
+// NewMentionEmailTask builds an Asynq task that runs after the grace delay, so a
+// user who comes back online in the meantime is not emailed.
+func NewMentionEmailTask(payload MentionEmailTaskPayload, delay time.Duration) (*asynq.Task, error) {
+	if payload.MessageID == 0 {
+		return nil, errors.New("message id is required")
+	}
+	if payload.RecipientID == 0 {
+		return nil, errors.New("recipient id is required")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypeMentionEmail, body,
+		asynq.ProcessIn(delay),
+		asynq.MaxRetry(maxRetryFromEnv("EMAIL_MAX_RETRY", defaultEmailMaxRetry)),
+	), nil
+}
+
+// NewLinkPreviewTask builds an Asynq task payload for unfurling a link in a message.
+func NewLinkPreviewTask(payload LinkPreviewTaskPayload) (*asynq.Task, error) {
+	if payload.MessageID == 0 {
+		return nil, errors.New("message id is required")
+	}
+	if payload.URL == "" {
+		return nil, errors.New("link url is required")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypeLinkPreview, body, asynq.MaxRetry(maxRetryFromEnv("LINK_PREVIEW_MAX_RETRY", defaultLinkMaxRetry))), nil
+}
+
+// NewDataExportTask builds an Asynq task payload for building a data export.
+func NewDataExportTask(payload DataExportTaskPayload) (*asynq.Task, error) {
+	if payload.ExportID == 0 {
+		return nil, errors.New("export id is required")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return asynq.NewTask(TypeDataExport, body,
+		asynq.MaxRetry(maxRetryFromEnv("DATA_EXPORT_MAX_RETRY", defaultExportMaxRetry)),
+		asynq.Timeout(30*time.Minute),
+	), nil
+}
+
+func handleDataExport(ctx context.Context, task *asynq.Task, exports DataExportProcessor) error {
+	var payload DataExportTaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode data export payload: %w: %w", err, asynq.SkipRetry)
+	}
+
+	if payload.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, payload.RequestID)
+	}
+
+	if err := exports(ctx, payload); err != nil {
+		return fmt.Errorf("failed to build data export: %w", err)
+	}
+
+	return nil
+}
+
+func handleLinkPreview(ctx context.Context, task *asynq.Task, links LinkPreviewProcessor) error {
+	var payload LinkPreviewTaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode link preview payload: %w: %w", err, asynq.SkipRetry)
+	}
+
+	if payload.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, payload.RequestID)
+	}
+
+	if err := links(ctx, payload); err != nil {
+		if errors.Is(err, unfurl.ErrBlocked) || errors.Is(err, unfurl.ErrNoPreview) {
+			return fmt.Errorf("failed to build link preview: %w: %w", err, asynq.SkipRetry)
+		}
+		return fmt.Errorf("failed to build link preview: %w", err)
+	}
+
+	return nil
+}
+
+func handleMentionEmail(ctx context.Context, task *asynq.Task, mentions MentionEmailProcessor) error {
+	var payload MentionEmailTaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode mention email payload: %w: %w", err, asynq.SkipRetry)
+	}
+
+	if payload.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, payload.RequestID)
+	}
+
+	return mentions(ctx, payload)
+}
+
+func handlePushDelivery(ctx context.Context, task *asynq.Task, pushes PushProcessor) error {
+	var payload PushTaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode push payload: %w: %w", err, asynq.SkipRetry)
+	}
+
+	if payload.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, payload.RequestID)
+	}
+
+	if err := pushes(ctx, payload); err != nil {
+		if errors.Is(err, push.ErrPermanent) || errors.Is(err, push.ErrUnsupportedPlatform) {
+			return fmt.Errorf("failed to deliver push notification: %w: %w", err, asynq.SkipRetry)
+		}
+		return fmt.Errorf("failed to deliver push notification: %w", err)
+	}
+
+	return nil
+}
+
+func handlePreviewGeneration(ctx context.Context, task *asynq.Task, previews PreviewProcessor) error {
+	var payload PreviewTaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode preview payload: %w", err)
+	}
+
+	if payload.RequestID != "" {
+		ctx = logging.WithRequestID(ctx, payload.RequestID)
+	}
+
+	return previews(ctx, payload)
 }
 
 func handleEmailDelivery(ctx context.Context, task *asynq.Task, emailService *email.Service) error {
 	var payload EmailTaskPayload
 	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
-		return fmt.Errorf("unable to decode email payload: %w", err)
+		return fmt.Errorf("unable to decode email payload: %w: %w", err, asynq.SkipRetry)
 	}
 
 	if emailService == nil {
@@ -168,11 +490,80 @@ func handleEmailDelivery(ctx context.Context, task *asynq.Task, emailService *em
 		Metadata: payload.Meta,
 	}
 
-	if err := emailService.SendEmail(ctx, sendInput); err != nil {
-		return fmt.Errorf("failed to send email via postmark: %w", err)
+	return deliveryError(emailService.SendEmail(ctx, sendInput))
+}
+
+func handleTemplateEmail(ctx context.Context, task *asynq.Task, emailService *email.Service) error {
+	var payload TemplateEmailTaskPayload
+	if err := json.Unmarshal(task.Payload(), &payload); err != nil {
+		return fmt.Errorf("unable to decode template email payload: %w: %w", err, asynq.SkipRetry)
 	}
 
-	return nil
+	if emailService == nil {
+		return errors.New("email service not configured")
+	}
+
+	return deliveryError(emailService.SendTemplateEmail(ctx, payload.SendInput()))
+}
+
+// deliveryError wraps a Postmark send error, marking permanent failures so
+// Asynq archives them immediately; a hard bounce or invalid address will not
+// recover on retry.
+func deliveryError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if email.IsPermanent(err) {
+		return fmt.Errorf("failed to send email via postmark: %w: %w", err, asynq.SkipRetry)
+	}
+	return fmt.Errorf("failed to send email via postmark: %w", err)
+}
+
+// reportTaskFailure logs failed task attempts. Tasks that will not be retried,
+// because they exhausted MaxRetry or were rejected permanently, are archived by
+// Asynq, which serves as the dead-letter queue; failed emails are logged with
+// their recipient so they can be followed up or retried from the admin API.
+func reportTaskFailure(ctx context.Context, task *asynq.Task, err error) {
+	retried, _ := asynq.GetRetryCount(ctx)
+	maxRetry, _ := asynq.GetMaxRetry(ctx)
+	archived := retried >= maxRetry || errors.Is(err, asynq.SkipRetry)
+
+	logger := logging.FromContext(ctx).With("task_type", task.Type(), "retried", retried, "max_retry", maxRetry, "error", err)
+	switch task.Type() {
+	case TypeEmailDelivery:
+		var payload EmailTaskPayload
+		if json.Unmarshal(task.Payload(), &payload) == nil {
+			logger = logger.With("to", payload.To, "subject", payload.Subject, "tag", payload.Tag)
+		}
+	case TypeTemplateEmail:
+		var payload TemplateEmailTaskPayload
+		if json.Unmarshal(task.Payload(), &payload) == nil {
+			logger = logger.With("to", payload.To, "template", payload.TemplateAlias, "tag", payload.Tag)
+		}
+	}
+
+	if !archived {
+		logger.Warn("queue task failed, will retry")
+		return
+	}
+
+	logger.Error("queue task failed permanently and was archived")
+}
+
+// maxRetryFromEnv reads a task type's retry limit, falling back to the default
+// when unset or invalid.
+func maxRetryFromEnv(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 0 {
+		return fallback
+	}
+
+	return parsed
 }
 
 func parseRedisURL(raw string) (addr, password string, db int, ok bool) {
@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"bafachat/internal/email"
+
+	"github.com/hibiken/asynq"
+)
+
+func TestDeliveryError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantNil   bool
+		wantSkip  bool
+		wantCause bool
+	}{
+		{name: "success", err: nil, wantNil: true},
+		{name: "network error retries", err: errors.New("connection reset"), wantCause: true},
+		{name: "rate limit retries", err: &email.APIError{StatusCode: http.StatusTooManyRequests}, wantCause: true},
+		{name: "hard bounce skips retry", err: &email.APIError{StatusCode: http.StatusUnprocessableEntity, ErrorCode: 406}, wantSkip: true, wantCause: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := deliveryError(tt.err)
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("deliveryError(nil) = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatal("deliveryError = nil, want error")
+			}
+			if skip := errors.Is(got, asynq.SkipRetry); skip != tt.wantSkip {
+				t.Fatalf("errors.Is(SkipRetry) = %v, want %v", skip, tt.wantSkip)
+			}
+			if tt.wantCause && !errors.Is(got, tt.err) {
+				t.Fatalf("deliveryError = %v, want it to wrap %v", got, tt.err)
+			}
+		})
+	}
+}
+
+func TestNewTemplateEmailTask(t *testing.T) {
+	t.Setenv("EMAIL_MAX_RETRY", "")
+
+	if _, err := NewTemplateEmailTask(TemplateEmailTaskPayload{TemplateAlias: email.TemplateServerInvite}); err == nil {
+		t.Fatal("NewTemplateEmailTask without a recipient succeeded, want error")
+	}
+	if _, err := NewTemplateEmailTask(TemplateEmailTaskPayload{To: "jane@example.com"}); err == nil {
+		t.Fatal("NewTemplateEmailTask without a template succeeded, want error")
+	}
+
+	payload := TemplateEmailTaskPayload{
+		To:            "jane@example.com",
+		TemplateAlias: email.TemplateServerInvite,
+		Model:         map[string]any{"server_name": "Gophers"},
+		Tag:           "invite",
+	}
+	task, err := NewTemplateEmailTask(payload)
+	if err != nil {
+		t.Fatalf("NewTemplateEmailTask: %v", err)
+	}
+	if task.Type() != TypeTemplateEmail {
+		t.Fatalf("Type() = %q, want %q", task.Type(), TypeTemplateEmail)
+	}
+
+	var decoded TemplateEmailTaskPayload
+	if err := json.Unmarshal(task.Payload(), &decoded); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	input := decoded.SendInput()
+	if input.To != payload.To || input.TemplateAlias != payload.TemplateAlias || input.Tag != payload.Tag {
+		t.Fatalf("SendInput() = %+v, want fields from %+v", input, payload)
+	}
+	if input.TemplateID != 0 {
+		t.Fatalf("SendInput().TemplateID = %d, want 0", input.TemplateID)
+	}
+}
+
+func TestNewEmailTaskValidates(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload EmailTaskPayload
+	}{
+		{name: "missing recipient", payload: EmailTaskPayload{Subject: "Hi", TextBody: "Hello"}},
+		{name: "missing subject", payload: EmailTaskPayload{To: "jane@example.com", TextBody: "Hello"}},
+		{name: "missing body", payload: EmailTaskPayload{To: "jane@example.com", Subject: "Hi"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEmailTask(tt.payload); err == nil {
+				t.Fatal("NewEmailTask succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestMaxRetryFromEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		want int
+	}{
+		{name: "unset", raw: "", want: 7},
+		{name: "valid", raw: " 3 ", want: 3},
+		{name: "zero", raw: "0", want: 0},
+		{name: "negative", raw: "-1", want: 7},
+		{name: "not a number", raw: "many", want: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_MAX_RETRY", tt.raw)
+			if got := maxRetryFromEnv("TEST_MAX_RETRY", 7); got != tt.want {
+				t.Fatalf("maxRetryFromEnv(%q) = %d, want %d", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRedisURL(t *testing.T) {
+	tests := []struct {
+		name         string
+		raw          string
+		wantAddr     string
+		wantPassword string
+		wantDB       int
+		wantOK       bool
+	}{
+		{name: "empty", raw: "", wantOK: false},
+		{name: "default port", raw: "redis://cache", wantAddr: "cache:6379", wantOK: true},
+		{name: "password and path db", raw: "redis://:secret@cache:6380/2", wantAddr: "cache:6380", wantPassword: "secret", wantDB: 2, wantOK: true},
+		{name: "query db wins", raw: "redis://cache:6379/1?db=4", wantAddr: "cache:6379", wantDB: 4, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, password, db, ok := parseRedisURL(tt.raw)
+			if ok != tt.wantOK || addr != tt.wantAddr || password != tt.wantPassword || db != tt.wantDB {
+				t.Fatalf("parseRedisURL(%q) = (%q, %q, %d, %v), want (%q, %q, %d, %v)",
+					tt.raw, addr, password, db, ok, tt.wantAddr, tt.wantPassword, tt.wantDB, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFailedEmailFromTask(t *testing.T) {
+	failedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	templateBody, _ := json.Marshal(TemplateEmailTaskPayload{To: "jane@example.com", TemplateAlias: email.TemplateEmailVerification, Tag: "verification"})
+	got := failedEmailFromTask(&asynq.TaskInfo{
+		ID:           "task-1",
+		Type:         TypeTemplateEmail,
+		Payload:      templateBody,
+		LastErr:      "postmark error (406): Inactive recipient",
+		Retried:      2,
+		LastFailedAt: failedAt,
+	})
+	if got.TaskID != "task-1" || got.To != "jane@example.com" || got.Template != email.TemplateEmailVerification || got.Tag != "verification" {
+		t.Fatalf("failedEmailFromTask(template) = %+v", got)
+	}
+	if got.Retried != 2 || !got.FailedAt.Equal(failedAt) || got.Error == "" {
+		t.Fatalf("failedEmailFromTask(template) = %+v, want retry count, time and error copied", got)
+	}
+
+	plainBody, _ := json.Marshal(EmailTaskPayload{To: "bob@example.com", Subject: "Welcome", TextBody: "Hi"})
+	got = failedEmailFromTask(&asynq.TaskInfo{ID: "task-2", Type: TypeEmailDelivery, Payload: plainBody})
+	if got.To != "bob@example.com" || got.Subject != "Welcome" || got.Template != "" {
+		t.Fatalf("failedEmailFromTask(plain) = %+v", got)
+	}
+}
+
+func TestIsEmailTask(t *testing.T) {
+	for taskType, want := range map[string]bool{
+		TypeEmailDelivery:     true,
+		TypeTemplateEmail:     true,
+		TypePushDelivery:      false,
+		TypePreviewGeneration: false,
+	} {
+		if got := isEmailTask(taskType); got != want {
+			t.Fatalf("isEmailTask(%q) = %v, want %v", taskType, got, want)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package safefetch makes outbound HTTP requests to URLs that users control,
+// such as links posted in chat or push subscription endpoints. Requests never
+// connect to private, loopback or link-local addresses, including after
+// redirects and DNS lookups, so they cannot be used to reach the server's
+// internal network or cloud metadata endpoints.
+package safefetch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultTimeout      = 10 * time.Second
+	defaultMaxBytes     = 1024 * 1024
+	defaultMaxRedirects = 5
+)
+
+var (
+	// ErrBlocked means the URL, or a redirect it led to, uses a scheme that is
+	// not allowed, points at a denied host or resolves to a non-public address.
+	ErrBlocked = errors.New("outbound request target is not allowed")
+
+	// ErrTooManyRedirects means the request was redirected more than MaxRedirects times.
+	ErrTooManyRedirects = errors.New("outbound request redirected too many times")
+
+	// ErrTooLarge is returned while reading a response body past MaxBytes.
+	ErrTooLarge = errors.New("outbound response exceeds the size limit")
+)
+
+// supportedSchemes are the only schemes AllowedSchemes may contain.
+var supportedSchemes = []string{"http", "https"}
+
+// blockedPrefixes are special-purpose ranges that netip does not already classify
+// as private, loopback or link-local.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// Config controls outbound requests.
+type Config struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	MaxRedirects int
+	// AllowedSchemes lists the URL schemes that may be fetched, from http and https.
+	AllowedSchemes []string
+	// Denylist holds hosts that are never fetched. An entry also matches its subdomains.
+	Denylist []string
+}
+
+// ConfigFromEnv reads OUTBOUND_FETCH_TIMEOUT, OUTBOUND_FETCH_MAX_BYTES and
+// OUTBOUND_FETCH_ALLOWED_SCHEMES, a comma-separated subset of http and https.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Timeout:        defaultTimeout,
+		MaxBytes:       defaultMaxBytes,
+		MaxRedirects:   defaultMaxRedirects,
+		AllowedSchemes: supportedSchemes,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("OUTBOUND_FETCH_TIMEOUT")); raw != "" {
+		if timeout, err := time.ParseDuration(raw); err == nil && timeout > 0 {
+			cfg.Timeout = timeout
+		} else {
+			slog.Warn("invalid OUTBOUND_FETCH_TIMEOUT value", "value", raw)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("OUTBOUND_FETCH_MAX_BYTES")); raw != "" {
+		if maxBytes, err := strconv.ParseInt(raw, 10, 64); err == nil && maxBytes > 0 {
+			cfg.MaxBytes = maxBytes
+		} else {
+			slog.Warn("invalid OUTBOUND_FETCH_MAX_BYTES value", "value", raw)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("OUTBOUND_FETCH_ALLOWED_SCHEMES")); raw != "" {
+		var schemes []string
+		for _, scheme := range strings.Split(raw, ",") {
+			scheme = strings.ToLower(strings.TrimSpace(scheme))
+			if !slices.Contains(supportedSchemes, scheme) {
+				slog.Warn("ignoring unsupported OUTBOUND_FETCH_ALLOWED_SCHEMES entry", "scheme", scheme)
+				continue
+			}
+			schemes = append(schemes, scheme)
+		}
+		if len(schemes) > 0 {
+			cfg.AllowedSchemes = schemes
+		}
+	}
+
+	return cfg
+}
+
+// Client sends requests that are restricted to public addresses, time out, and
+// have their redirects and response size capped.
+type Client struct {
+	cfg    Config
+	client *http.Client
+}
+
+// New returns a Client for cfg. Zero values fall back to the defaults, and
+// schemes other than http and https are dropped.
+func New(cfg Config) *Client {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+	if cfg.MaxRedirects < 0 {
+		cfg.MaxRedirects = 0
+	}
+
+	schemes := make([]string, 0, len(cfg.AllowedSchemes))
+	for _, scheme := range cfg.AllowedSchemes {
+		if scheme = strings.ToLower(scheme); slices.Contains(supportedSchemes, scheme) {
+			schemes = append(schemes, scheme)
+		}
+	}
+	if len(schemes) == 0 {
+		schemes = supportedSchemes
+	}
+	cfg.AllowedSchemes = schemes
+
+	c := &Client{cfg: cfg}
+
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+		// Control runs after DNS resolution, so it sees the address actually dialed.
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return ErrBlocked
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !IsPublicAddr(addr) {
+				return ErrBlocked
+			}
+			return nil
+		},
+	}
+
+	c.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return ErrTooManyRedirects
+			}
+			return c.CheckURL(req.URL)
+		},
+	}
+
+	return c
+}
+
+// Do checks the request URL and sends the request. Reading the response body
+// past MaxBytes fails with ErrTooLarge.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if err := c.CheckURL(req.URL); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &limitedBody{ReadCloser: resp.Body, remaining: c.cfg.MaxBytes}
+	return resp, nil
+}
+
+// CheckURL rejects schemes that are not allowed, denylisted hosts and literal
+// non-public addresses. Hostnames are checked again once resolved.
+func (c *Client) CheckURL(target *url.URL) error {
+	if !slices.Contains(c.cfg.AllowedSchemes, strings.ToLower(target.Scheme)) {
+		return fmt.Errorf("%w: unsupported scheme", ErrBlocked)
+	}
+
+	host := strings.Trim(strings.ToLower(target.Hostname()), ".")
+	if host == "" {
+		return fmt.Errorf("%w: missing host", ErrBlocked)
+	}
+
+	for _, denied := range c.cfg.Denylist {
+		if host == denied || strings.HasSuffix(host, "."+denied) {
+			return fmt.Errorf("%w: %s is denylisted", ErrBlocked, host)
+		}
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil && !IsPublicAddr(addr) {
+		return fmt.Errorf("%w: %s is not a public address", ErrBlocked, host)
+	}
+
+	return nil
+}
+
+// IsPublicAddr reports whether addr is a globally routable unicast address.
+func IsPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// limitedBody fails with ErrTooLarge once more than remaining bytes are read.
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Report the limit only if the body really has more to give.
+		var probe [1]byte
+		if n, err := b.ReadCloser.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		return 0, ErrTooLarge
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
@@ -0,0 +1,194 @@
+package safefetch
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.216.34", want: true},
+		{addr: "2606:4700::1111", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "10.1.2.3", want: false},
+		{addr: "172.16.0.1", want: false},
+		{addr: "192.168.1.1", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "0.0.0.0", want: false},
+		{addr: "198.18.0.1", want: false},
+		{addr: "::1", want: false},
+		{addr: "fd00::1", want: false},
+		{addr: "fe80::1", want: false},
+		{addr: "::ffff:127.0.0.1", want: false},
+		{addr: "64:ff9b::7f00:1", want: false},
+		{addr: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := IsPublicAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+				t.Fatalf("IsPublicAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	client := New(Config{AllowedSchemes: []string{"https"}, Denylist: []string{"internal.example"}})
+
+	tests := []struct {
+		name    string
+		rawURL  string
+		blocked bool
+	}{
+		{name: "public host", rawURL: "https://example.com/page"},
+		{name: "scheme not allowed", rawURL: "http://example.com/", blocked: true},
+		{name: "unsupported scheme", rawURL: "file:///etc/passwd", blocked: true},
+		{name: "missing host", rawURL: "https:///path", blocked: true},
+		{name: "denylisted host", rawURL: "https://internal.example/", blocked: true},
+		{name: "denylisted subdomain", rawURL: "https://api.Internal.Example./", blocked: true},
+		{name: "lookalike of denylisted host", rawURL: "https://notinternal.example/"},
+		{name: "loopback literal", rawURL: "https://127.0.0.1/", blocked: true},
+		{name: "metadata literal", rawURL: "https://169.254.169.254/latest/meta-data", blocked: true},
+		{name: "ipv6 loopback literal", rawURL: "https://[::1]:8443/", blocked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := url.Parse(tt.rawURL)
+			if err != nil {
+				t.Fatalf("parse %q: %v", tt.rawURL, err)
+			}
+
+			err = client.CheckURL(target)
+			if got := errors.Is(err, ErrBlocked); got != tt.blocked {
+				t.Fatalf("CheckURL(%q) = %v, want blocked %v", tt.rawURL, err, tt.blocked)
+			}
+		})
+	}
+}
+
+func TestDoBlocksLoopbackServers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the loopback server")
+	}))
+	t.Cleanup(server.Close)
+
+	client := New(Config{Timeout: time.Second})
+
+	// The literal address is refused up front; localhost is refused at dial time
+	// once it has resolved to a loopback address.
+	for _, target := range []string{server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)} {
+		req, err := http.NewRequest(http.MethodGet, target, nil)
+		if err != nil {
+			t.Fatalf("new request: %v", err)
+		}
+
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			t.Fatalf("Do(%s) succeeded", target)
+		}
+		if !errors.Is(err, ErrBlocked) {
+			t.Fatalf("Do(%s) = %v, want ErrBlocked", target, err)
+		}
+	}
+}
+
+func TestLimitedBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		limit   int64
+		wantErr error
+	}{
+		{name: "under the limit", body: "hello", limit: 10},
+		{name: "exactly the limit", body: "hello", limit: 5},
+		{name: "over the limit", body: "hello world", limit: 5, wantErr: ErrTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &limitedBody{ReadCloser: io.NopCloser(strings.NewReader(tt.body)), remaining: tt.limit}
+
+			data, err := io.ReadAll(body)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ReadAll error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && string(data) != tt.body {
+				t.Fatalf("ReadAll = %q, want %q", data, tt.body)
+			}
+			if int64(len(data)) > tt.limit {
+				t.Fatalf("read %d bytes past the %d byte limit", len(data), tt.limit)
+			}
+		})
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		t.Setenv("OUTBOUND_FETCH_TIMEOUT", "")
+		t.Setenv("OUTBOUND_FETCH_MAX_BYTES", "")
+		t.Setenv("OUTBOUND_FETCH_ALLOWED_SCHEMES", "")
+
+		cfg := ConfigFromEnv()
+		if cfg.Timeout != defaultTimeout || cfg.MaxBytes != defaultMaxBytes || cfg.MaxRedirects != defaultMaxRedirects {
+			t.Fatalf("ConfigFromEnv() = %+v, want the defaults", cfg)
+		}
+		if !slices.Equal(cfg.AllowedSchemes, []string{"http", "https"}) {
+			t.Fatalf("AllowedSchemes = %v, want [http https]", cfg.AllowedSchemes)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		t.Setenv("OUTBOUND_FETCH_TIMEOUT", "3s")
+		t.Setenv("OUTBOUND_FETCH_MAX_BYTES", "2048")
+		t.Setenv("OUTBOUND_FETCH_ALLOWED_SCHEMES", " HTTPS , ftp")
+
+		cfg := ConfigFromEnv()
+		if cfg.Timeout != 3*time.Second || cfg.MaxBytes != 2048 {
+			t.Fatalf("ConfigFromEnv() = %+v, want a 3s timeout and 2048 bytes", cfg)
+		}
+		if !slices.Equal(cfg.AllowedSchemes, []string{"https"}) {
+			t.Fatalf("AllowedSchemes = %v, want [https]", cfg.AllowedSchemes)
+		}
+	})
+
+	t.Run("invalid values keep defaults", func(t *testing.T) {
+		t.Setenv("OUTBOUND_FETCH_TIMEOUT", "-1s")
+		t.Setenv("OUTBOUND_FETCH_MAX_BYTES", "lots")
+		t.Setenv("OUTBOUND_FETCH_ALLOWED_SCHEMES", "gopher")
+
+		cfg := ConfigFromEnv()
+		if cfg.Timeout != defaultTimeout || cfg.MaxBytes != defaultMaxBytes {
+			t.Fatalf("ConfigFromEnv() = %+v, want the defaults", cfg)
+		}
+		if !slices.Equal(cfg.AllowedSchemes, []string{"http", "https"}) {
+			t.Fatalf("AllowedSchemes = %v, want [http https]", cfg.AllowedSchemes)
+		}
+	})
+}
+
+func TestNewDropsUnsupportedSchemes(t *testing.T) {
+	client := New(Config{AllowedSchemes: []string{"FTP", "HTTPS"}})
+	if !slices.Equal(client.cfg.AllowedSchemes, []string{"https"}) {
+		t.Fatalf("AllowedSchemes = %v, want [https]", client.cfg.AllowedSchemes)
+	}
+
+	client = New(Config{AllowedSchemes: []string{"ftp"}})
+	if !slices.Equal(client.cfg.AllowedSchemes, supportedSchemes) {
+		t.Fatalf("AllowedSchemes = %v, want %v", client.cfg.AllowedSchemes, supportedSchemes)
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"mime"
+	"strings"
+)
+
+const (
+	// DispositionInline lets browsers render the object directly.
+	DispositionInline = "inline"
+	// DispositionAttachment forces browsers to download the object.
+	DispositionAttachment = "attachment"
+)
+
+// defaultInlineContentTypes lists the types considered safe to render inline.
+// Anything not matched here is served as a download. SVG and HTML are
+// deliberately absent because they can execute script in the page origin.
+var defaultInlineContentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"video/mp4",
+	"video/webm",
+	"audio/mpeg",
+	"audio/ogg",
+	"audio/wav",
+	"audio/webm",
+	"application/pdf",
+	"text/plain",
+}
+
+// DispositionPolicy maps content types to a Content-Disposition of inline or
+// attachment. Entries may be exact media types ("image/png") or category
+// wildcards ("image/*").
+type DispositionPolicy struct {
+	exact      map[string]struct{}
+	categories map[string]struct{}
+}
+
+// NewDispositionPolicy builds a policy from the provided inline types. When
+// the list is empty the default safe list is used.
+func NewDispositionPolicy(inlineTypes []string) DispositionPolicy {
+	if len(inlineTypes) == 0 {
+		inlineTypes = defaultInlineContentTypes
+	}
+
+	policy := DispositionPolicy{
+		exact:      make(map[string]struct{}),
+		categories: make(map[string]struct{}),
+	}
+
+	for _, raw := range inlineTypes {
+		value := strings.ToLower(strings.TrimSpace(raw))
+		if value == "" {
+			continue
+		}
+
+		if strings.HasSuffix(value, "/*") {
+			policy.categories[strings.TrimSuffix(value, "/*")] = struct{}{}
+			continue
+		}
+
+		policy.exact[value] = struct{}{}
+	}
+
+	return policy
+}
+
+// Disposition returns DispositionInline when the content type is explicitly
+// allowed to render in the browser and DispositionAttachment otherwise.
+func (p DispositionPolicy) Disposition(contentType string) string {
+	mediaType := normalizeMediaType(contentType)
+	if mediaType == "" {
+		return DispositionAttachment
+	}
+
+	if _, ok := p.exact[mediaType]; ok {
+		return DispositionInline
+	}
+
+	if slash := strings.Index(mediaType, "/"); slash > 0 {
+		if _, ok := p.categories[mediaType[:slash]]; ok {
+			return DispositionInline
+		}
+	}
+
+	return DispositionAttachment
+}
+
+// ContentDisposition builds a Content-Disposition header value for the given
+// content type and file name.
+func (p DispositionPolicy) ContentDisposition(contentType, fileName string) string {
+	disposition := p.Disposition(contentType)
+
+	fileName = strings.TrimSpace(fileName)
+	if fileName == "" {
+		return disposition
+	}
+
+	formatted := mime.FormatMediaType(disposition, map[string]string{"filename": fileName})
+	if formatted == "" {
+		return disposition
+	}
+
+	return formatted
+}
+
+func normalizeMediaType(contentType string) string {
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		return ""
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(mediaType)
+}
+
+func parseContentTypeList(raw string) []string {
+	var values []string
+	for _, part := range strings.Split(raw, ",") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			values = append(values, trimmed)
+		}
+	}
+	return values
+}
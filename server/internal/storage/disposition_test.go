@@ -0,0 +1,75 @@
+package storage
+
+import "testing"
+
+func TestDispositionPolicyDefaults(t *testing.T) {
+	policy := NewDispositionPolicy(nil)
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{contentType: "image/png", want: DispositionInline},
+		{contentType: "IMAGE/JPEG", want: DispositionInline},
+		{contentType: "text/plain; charset=utf-8", want: DispositionInline},
+		{contentType: "application/pdf", want: DispositionInline},
+		{contentType: "image/svg+xml", want: DispositionAttachment},
+		{contentType: "text/html", want: DispositionAttachment},
+		{contentType: "application/zip", want: DispositionAttachment},
+		{contentType: "", want: DispositionAttachment},
+		{contentType: "not a type;;", want: DispositionAttachment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := policy.Disposition(tt.contentType); got != tt.want {
+				t.Fatalf("Disposition(%q) = %q, want %q", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispositionPolicyCategories(t *testing.T) {
+	policy := NewDispositionPolicy(parseContentTypeList(" video/* , application/json,,"))
+
+	tests := []struct {
+		contentType string
+		want        string
+	}{
+		{contentType: "video/quicktime", want: DispositionInline},
+		{contentType: "application/json", want: DispositionInline},
+		{contentType: "image/png", want: DispositionAttachment},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			if got := policy.Disposition(tt.contentType); got != tt.want {
+				t.Fatalf("Disposition(%q) = %q, want %q", tt.contentType, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	policy := NewDispositionPolicy(nil)
+
+	tests := []struct {
+		name        string
+		contentType string
+		fileName    string
+		want        string
+	}{
+		{name: "inline with name", contentType: "image/png", fileName: "cat.png", want: "inline; filename=cat.png"},
+		{name: "download with quoted name", contentType: "application/zip", fileName: "my files.zip", want: `attachment; filename="my files.zip"`},
+		{name: "blank name", contentType: "image/png", fileName: "  ", want: "inline"},
+		{name: "non-ascii name", contentType: "application/zip", fileName: "résumé.zip", want: "attachment; filename*=utf-8''r%C3%A9sum%C3%A9.zip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.ContentDisposition(tt.contentType, tt.fileName); got != tt.want {
+				t.Fatalf("ContentDisposition(%q, %q) = %q, want %q", tt.contentType, tt.fileName, got, tt.want)
+			}
+		})
+	}
+}
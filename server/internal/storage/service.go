@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -13,6 +14,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -24,11 +26,23 @@ const (
 	defaultUploadPrefix = "uploads"
 	defaultPresignTTL   = 15 * time.Minute
 	maxFileNameLength   = 200
+	maxDeleteBatchSize  = 1000
+
+	// S3 rejects multipart parts smaller than 5MB (except the last one).
+	minMultipartPartSize        = 5 * 1024 * 1024
+	defaultMultipartPartSize    = 8 * 1024 * 1024
+	defaultMultipartThresholdMB = 32
 )
 
 // ErrServiceDisabled is returned when the storage service cannot be initialised from the environment.
 var ErrServiceDisabled = errors.New("storage service disabled")
 
+// ErrObjectNotFound is returned when the requested object does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrInvalidRange is returned when a byte range cannot be satisfied for the object.
+var ErrInvalidRange = errors.New("requested range not satisfiable")
+
 // Service exposes helpers for working with S3-compatible object storage such as DigitalOcean Spaces.
 type Service struct {
 	client        *s3.Client
@@ -37,6 +51,10 @@ type Service struct {
 	originBase    string
 	uploadPrefix  string
 	maxUploadSize int64
+	disposition   DispositionPolicy
+	// multipartThreshold is the size above which uploads should use UploadLargeObject.
+	multipartThreshold int64
+	multipartPartSize  int64
 }
 
 // Config describes the required configuration for the storage service.
@@ -49,6 +67,12 @@ type Config struct {
 	SecretKey  string
 	Prefix     string
 	MaxSizeMB  int64
+	// MultipartThresholdMB and MultipartPartMB tune multipart uploads for large files.
+	MultipartThresholdMB int64
+	MultipartPartMB      int64
+	// InlineContentTypes lists content types (or "type/*" categories) that
+	// may be rendered inline. Everything else is served as a download.
+	InlineContentTypes []string
 }
 
 // UploadSignature describes the data the client needs to upload a file directly to object storage.
@@ -61,6 +85,24 @@ type UploadSignature struct {
 	ExpiresAt time.Time         `json:"expires_at"`
 }
 
+// ObjectInfo describes a stored object without fetching its body.
+type ObjectInfo struct {
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// ObjectStream is an open object body, optionally limited to a byte range.
+type ObjectStream struct {
+	Body          io.ReadCloser
+	ContentLength int64
+	ContentType   string
+	// ContentRange is set when a range was requested, e.g. "bytes 0-99/1000".
+	ContentRange string
+	ETag         string
+}
+
 // UploadResult captures metadata after directly uploading a file through the storage service.
 type UploadResult struct {
 	ObjectKey string `json:"object_key"`
@@ -111,6 +153,19 @@ func NewService(ctx context.Context, cfg Config) (*Service, error) {
 		maxUploadSize = 100 // default to 100MB
 	}
 
+	multipartThreshold := cfg.MultipartThresholdMB
+	if multipartThreshold <= 0 {
+		multipartThreshold = defaultMultipartThresholdMB
+	}
+
+	partSize := cfg.MultipartPartMB * 1024 * 1024
+	if partSize <= 0 {
+		partSize = defaultMultipartPartSize
+	}
+	if partSize < minMultipartPartSize {
+		partSize = minMultipartPartSize
+	}
+
 	return &Service{
 		client:        client,
 		presignClient: presign,
@@ -118,6 +173,10 @@ func NewService(ctx context.Context, cfg Config) (*Service, error) {
 		originBase:    strings.TrimRight(cfg.OriginBase, "/"),
 		uploadPrefix:  prefix,
 		maxUploadSize: maxUploadSize * 1024 * 1024,
+		disposition:   NewDispositionPolicy(cfg.InlineContentTypes),
+
+		multipartThreshold: multipartThreshold * 1024 * 1024,
+		multipartPartSize:  partSize,
 	}, nil
 }
 
@@ -139,6 +198,22 @@ func NewServiceFromEnv(ctx context.Context) (*Service, error) {
 		}
 	}
 
+	if threshold := strings.TrimSpace(os.Getenv("SPACES_MULTIPART_THRESHOLD_MB")); threshold != "" {
+		if parsed, err := parseInt64(threshold); err == nil {
+			cfg.MultipartThresholdMB = parsed
+		}
+	}
+
+	if partSize := strings.TrimSpace(os.Getenv("SPACES_MULTIPART_PART_MB")); partSize != "" {
+		if parsed, err := parseInt64(partSize); err == nil {
+			cfg.MultipartPartMB = parsed
+		}
+	}
+
+	if inlineTypes := strings.TrimSpace(os.Getenv("SPACES_INLINE_CONTENT_TYPES")); inlineTypes != "" {
+		cfg.InlineContentTypes = parseContentTypeList(inlineTypes)
+	}
+
 	service, err := NewService(ctx, cfg)
 	if errors.Is(err, ErrServiceDisabled) {
 		return nil, ErrServiceDisabled
@@ -178,11 +253,14 @@ func (s *Service) PresignUpload(ctx context.Context, fileName, contentType strin
 	ext := filepath.Ext(safeName)
 	key := path.Join(s.uploadPrefix, time.Now().UTC().Format("2006/01/02"), uuid.NewString()+strings.ToLower(ext))
 
+	contentDisposition := s.ContentDisposition(contentType, fileName)
+
 	input := &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(key),
-		ContentType: aws.String(contentType),
-		ACL:         types.ObjectCannedACLPublicRead,
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(key),
+		ContentType:        aws.String(contentType),
+		ContentDisposition: aws.String(contentDisposition),
+		ACL:                types.ObjectCannedACLPublicRead,
 	}
 
 	presignCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
@@ -204,6 +282,7 @@ func (s *Service) PresignUpload(ctx context.Context, fileName, contentType strin
 	if contentType != "" {
 		headers["Content-Type"] = contentType
 	}
+	headers["Content-Disposition"] = contentDisposition
 
 	fileURL := s.assetURL(key)
 
@@ -244,17 +323,180 @@ func (s *Service) UploadObject(ctx context.Context, fileName, contentType string
 	ext := filepath.Ext(safeName)
 	key := path.Join(s.uploadPrefix, time.Now().UTC().Format("2006/01/02"), uuid.NewString()+strings.ToLower(ext))
 
+	input := &s3.PutObjectInput{
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(key),
+		Body:               body,
+		ContentType:        aws.String(contentType),
+		ContentDisposition: aws.String(s.ContentDisposition(contentType, fileName)),
+		ContentLength:      aws.Int64(fileSize),
+		ACL:                types.ObjectCannedACLPublicRead,
+	}
+
+	if _, err := s.client.PutObject(ctx, input); err != nil {
+		return nil, fmt.Errorf("put object: %w", err)
+	}
+
+	return &UploadResult{
+		ObjectKey: key,
+		FileURL:   s.assetURL(key),
+	}, nil
+}
+
+// ReplaceObject overwrites an existing public object in place, such as a
+// presigned upload the server has re-encoded. An empty contentDisposition leaves
+// the header unset.
+func (s *Service) ReplaceObject(ctx context.Context, objectKey, contentType, contentDisposition string, fileSize int64, body io.Reader) error {
+	if s == nil {
+		return ErrServiceDisabled
+	}
+
+	objectKey = strings.TrimLeft(objectKey, "/")
+	if objectKey == "" {
+		return fmt.Errorf("object key is required")
+	}
+
+	if fileSize <= 0 {
+		return fmt.Errorf("file_size must be greater than zero")
+	}
+
 	input := &s3.PutObjectInput{
 		Bucket:        aws.String(s.bucket),
-		Key:           aws.String(key),
+		Key:           aws.String(objectKey),
 		Body:          body,
 		ContentType:   aws.String(contentType),
 		ContentLength: aws.Int64(fileSize),
 		ACL:           types.ObjectCannedACLPublicRead,
 	}
+	if contentDisposition != "" {
+		input.ContentDisposition = aws.String(contentDisposition)
+	}
 
 	if _, err := s.client.PutObject(ctx, input); err != nil {
-		return nil, fmt.Errorf("put object: %w", err)
+		return fmt.Errorf("put object: %w", err)
+	}
+
+	return nil
+}
+
+// MaxUploadSize returns the largest file, in bytes, that uploads accept.
+func (s *Service) MaxUploadSize() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.maxUploadSize
+}
+
+// MultipartThreshold returns the file size above which callers should prefer UploadLargeObject.
+func (s *Service) MultipartThreshold() int64 {
+	if s == nil {
+		return 0
+	}
+
+	return s.multipartThreshold
+}
+
+// UploadLargeObject streams the reader to object storage using a multipart
+// upload, holding at most one part in memory. The upload is aborted on error
+// so no partial parts are left behind.
+func (s *Service) UploadLargeObject(ctx context.Context, fileName, contentType string, fileSize int64, body io.Reader) (*UploadResult, error) {
+	if s == nil {
+		return nil, ErrServiceDisabled
+	}
+
+	if fileSize <= 0 {
+		return nil, fmt.Errorf("file_size must be greater than zero")
+	}
+
+	if s.maxUploadSize > 0 && fileSize > s.maxUploadSize {
+		return nil, fmt.Errorf("file exceeds max upload size of %d bytes", s.maxUploadSize)
+	}
+
+	contentType = strings.TrimSpace(contentType)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	safeName := sanitizeFileName(fileName)
+	if safeName == "" {
+		safeName = "file"
+	}
+
+	ext := filepath.Ext(safeName)
+	key := path.Join(s.uploadPrefix, time.Now().UTC().Format("2006/01/02"), uuid.NewString()+strings.ToLower(ext))
+
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             aws.String(s.bucket),
+		Key:                aws.String(key),
+		ContentType:        aws.String(contentType),
+		ContentDisposition: aws.String(s.ContentDisposition(contentType, fileName)),
+		ACL:                types.ObjectCannedACLPublicRead,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create multipart upload: %w", err)
+	}
+
+	abort := func(cause error) error {
+		// Use a fresh context so the abort still runs when ctx was cancelled.
+		abortCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if _, abortErr := s.client.AbortMultipartUpload(abortCtx, &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(key),
+			UploadId: created.UploadId,
+		}); abortErr != nil {
+			return fmt.Errorf("%w (abort multipart upload: %v)", cause, abortErr)
+		}
+		return cause
+	}
+
+	buffer := make([]byte, s.multipartPartSize)
+	var completed []types.CompletedPart
+	var uploaded int64
+
+	for partNumber := int32(1); ; partNumber++ {
+		n, readErr := io.ReadFull(body, buffer)
+		if n > 0 {
+			part, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:        aws.String(s.bucket),
+				Key:           aws.String(key),
+				UploadId:      created.UploadId,
+				PartNumber:    aws.Int32(partNumber),
+				Body:          bytes.NewReader(buffer[:n]),
+				ContentLength: aws.Int64(int64(n)),
+			})
+			if err != nil {
+				return nil, abort(fmt.Errorf("upload part %d: %w", partNumber, err))
+			}
+
+			completed = append(completed, types.CompletedPart{
+				ETag:       part.ETag,
+				PartNumber: aws.Int32(partNumber),
+			})
+			uploaded += int64(n)
+		}
+
+		if errors.Is(readErr, io.EOF) || errors.Is(readErr, io.ErrUnexpectedEOF) {
+			break
+		}
+		if readErr != nil {
+			return nil, abort(fmt.Errorf("read upload body: %w", readErr))
+		}
+	}
+
+	if uploaded != fileSize {
+		return nil, abort(fmt.Errorf("upload body was %d bytes, expected %d", uploaded, fileSize))
+	}
+
+	if _, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.bucket),
+		Key:             aws.String(key),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	}); err != nil {
+		return nil, abort(fmt.Errorf("complete multipart upload: %w", err))
 	}
 
 	return &UploadResult{
@@ -295,6 +537,183 @@ func (s *Service) GetObject(ctx context.Context, objectKey string) (io.ReadClose
 	return output.Body, contentLength, contentType, nil
 }
 
+// Ping verifies that the bucket is reachable with the configured credentials.
+func (s *Service) Ping(ctx context.Context) error {
+	if s == nil {
+		return ErrServiceDisabled
+	}
+
+	if _, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	}); err != nil {
+		return fmt.Errorf("head bucket %q: %w", s.bucket, err)
+	}
+
+	return nil
+}
+
+// DeleteObject removes an object from storage. Deleting a key that does not exist is not an error.
+func (s *Service) DeleteObject(ctx context.Context, objectKey string) error {
+	if s == nil {
+		return ErrServiceDisabled
+	}
+
+	objectKey = strings.TrimLeft(objectKey, "/")
+	if objectKey == "" {
+		return fmt.Errorf("object key is required")
+	}
+
+	if _, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	}); err != nil {
+		return fmt.Errorf("delete object %q: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// DeleteObjects removes several objects, batching requests to stay within the
+// S3 limit of 1000 keys per call. Empty keys are skipped.
+func (s *Service) DeleteObjects(ctx context.Context, objectKeys []string) error {
+	if s == nil {
+		return ErrServiceDisabled
+	}
+
+	identifiers := make([]types.ObjectIdentifier, 0, len(objectKeys))
+	for _, key := range objectKeys {
+		key = strings.TrimLeft(key, "/")
+		if key == "" {
+			continue
+		}
+		identifiers = append(identifiers, types.ObjectIdentifier{Key: aws.String(key)})
+	}
+
+	for start := 0; start < len(identifiers); start += maxDeleteBatchSize {
+		end := start + maxDeleteBatchSize
+		if end > len(identifiers) {
+			end = len(identifiers)
+		}
+
+		output, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.bucket),
+			Delete: &types.Delete{
+				Objects: identifiers[start:end],
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("delete %d objects: %w", end-start, err)
+		}
+
+		if len(output.Errors) > 0 {
+			first := output.Errors[0]
+			return fmt.Errorf("delete objects: %d of %d failed, first %q: %s", len(output.Errors), end-start, aws.ToString(first.Key), aws.ToString(first.Message))
+		}
+	}
+
+	return nil
+}
+
+// ObjectKeyFromURL recovers the object key from a URL produced by this service.
+// It reports false for URLs that point somewhere else.
+func (s *Service) ObjectKeyFromURL(fileURL string) (string, bool) {
+	if s == nil || fileURL == "" {
+		return "", false
+	}
+
+	if s.originBase == "" {
+		return strings.TrimLeft(fileURL, "/"), true
+	}
+
+	key, found := strings.CutPrefix(fileURL, s.originBase+"/")
+	if !found || key == "" {
+		return "", false
+	}
+
+	return key, true
+}
+
+// StatObject returns an object's size, type, and ETag.
+func (s *Service) StatObject(ctx context.Context, objectKey string) (*ObjectInfo, error) {
+	if s == nil {
+		return nil, ErrServiceDisabled
+	}
+
+	objectKey = strings.TrimLeft(objectKey, "/")
+	if objectKey == "" {
+		return nil, fmt.Errorf("object key is required")
+	}
+
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	})
+	if err != nil {
+		return nil, translateObjectError(fmt.Sprintf("head object %q", objectKey), err)
+	}
+
+	info := &ObjectInfo{
+		Size:        aws.ToInt64(output.ContentLength),
+		ContentType: aws.ToString(output.ContentType),
+		ETag:        aws.ToString(output.ETag),
+	}
+	if output.LastModified != nil {
+		info.LastModified = *output.LastModified
+	}
+
+	return info, nil
+}
+
+// OpenObject streams an object, limited to byteRange when it is a non-empty
+// HTTP Range value such as "bytes=0-1023".
+func (s *Service) OpenObject(ctx context.Context, objectKey, byteRange string) (*ObjectStream, error) {
+	if s == nil {
+		return nil, ErrServiceDisabled
+	}
+
+	objectKey = strings.TrimLeft(objectKey, "/")
+	if objectKey == "" {
+		return nil, fmt.Errorf("object key is required")
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+	}
+	if byteRange != "" {
+		input.Range = aws.String(byteRange)
+	}
+
+	output, err := s.client.GetObject(ctx, input)
+	if err != nil {
+		return nil, translateObjectError(fmt.Sprintf("get object %q", objectKey), err)
+	}
+
+	return &ObjectStream{
+		Body:          output.Body,
+		ContentLength: aws.ToInt64(output.ContentLength),
+		ContentType:   aws.ToString(output.ContentType),
+		ContentRange:  aws.ToString(output.ContentRange),
+		ETag:          aws.ToString(output.ETag),
+	}, nil
+}
+
+// translateObjectError maps S3 status codes onto the package's sentinel errors.
+func translateObjectError(action string, err error) error {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		switch responseErr.HTTPStatusCode() {
+		case 404:
+			return fmt.Errorf("%s: %w", action, ErrObjectNotFound)
+		case 416:
+			return fmt.Errorf("%s: %w", action, ErrInvalidRange)
+		}
+	}
+
+	return fmt.Errorf("%s: %w", action, err)
+}
+
 // PresignAvatarUpload generates a pre-signed PUT URL for avatar uploads with a specific prefix.
 func (s *Service) PresignAvatarUpload(ctx context.Context, fileName, contentType string, fileSize int64, avatarType string) (*UploadSignature, error) {
 	if s == nil {
@@ -364,6 +783,47 @@ func (s *Service) PresignAvatarUpload(ctx context.Context, fileName, contentType
 
 // UploadAvatarObject uploads an avatar to object storage with a specific prefix.
 func (s *Service) UploadAvatarObject(ctx context.Context, fileName, contentType string, fileSize int64, body io.Reader, avatarType string) (*UploadResult, error) {
+	return s.uploadPublicObject(ctx, fmt.Sprintf("avatars/%s", avatarType), "avatar", fileName, contentType, fileSize, body)
+}
+
+// UploadEmojiObject uploads a server's custom emoji image as a public object.
+func (s *Service) UploadEmojiObject(ctx context.Context, serverID uint, fileName, contentType string, fileSize int64, body io.Reader) (*UploadResult, error) {
+	return s.uploadPublicObject(ctx, fmt.Sprintf("emojis/%d", serverID), "emoji", fileName, contentType, fileSize, body)
+}
+
+// UploadExportObject stores a user's data export as a private zip object. It is
+// only readable through the API, never from the public asset origin, and is not
+// subject to the upload size limit.
+func (s *Service) UploadExportObject(ctx context.Context, userID uint, fileSize int64, body io.Reader) (string, error) {
+	if s == nil {
+		return "", ErrServiceDisabled
+	}
+
+	if fileSize <= 0 {
+		return "", fmt.Errorf("file_size must be greater than zero")
+	}
+
+	key := path.Join("exports", fmt.Sprint(userID), uuid.NewString()+".zip")
+
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          body,
+		ContentType:   aws.String("application/zip"),
+		ContentLength: aws.Int64(fileSize),
+		ACL:           types.ObjectCannedACLPrivate,
+	}
+
+	if _, err := s.client.PutObject(ctx, input); err != nil {
+		return "", fmt.Errorf("put object: %w", err)
+	}
+
+	return key, nil
+}
+
+// uploadPublicObject stores a publicly readable object under prefix with a random name
+// that keeps the file's extension.
+func (s *Service) uploadPublicObject(ctx context.Context, prefix, fallbackName, fileName, contentType string, fileSize int64, body io.Reader) (*UploadResult, error) {
 	if s == nil {
 		return nil, ErrServiceDisabled
 	}
@@ -383,11 +843,10 @@ func (s *Service) UploadAvatarObject(ctx context.Context, fileName, contentType
 
 	safeName := sanitizeFileName(fileName)
 	if safeName == "" {
-		safeName = "avatar"
+		safeName = fallbackName
 	}
 
 	ext := filepath.Ext(safeName)
-	prefix := fmt.Sprintf("avatars/%s", avatarType)
 	key := path.Join(prefix, time.Now().UTC().Format("2006/01/02"), uuid.NewString()+strings.ToLower(ext))
 
 	input := &s3.PutObjectInput{
@@ -409,6 +868,16 @@ func (s *Service) UploadAvatarObject(ctx context.Context, fileName, contentType
 	}, nil
 }
 
+// ContentDisposition returns the Content-Disposition header value the
+// configured policy assigns to an object of the given type and name.
+func (s *Service) ContentDisposition(contentType, fileName string) string {
+	if s == nil {
+		return NewDispositionPolicy(nil).ContentDisposition(contentType, fileName)
+	}
+
+	return s.disposition.ContentDisposition(contentType, fileName)
+}
+
 func (s *Service) assetURL(key string) string {
 	if s.originBase == "" {
 		return key
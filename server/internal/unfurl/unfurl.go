@@ -0,0 +1,282 @@
+// Package unfurl builds link preview cards from a page's OpenGraph and meta tags.
+// Pages are fetched through safefetch, so links posted in chat cannot be used to
+// reach the server's internal network.
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"bafachat/internal/safefetch"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultTimeout       = 5 * time.Second
+	defaultMaxBytes      = 512 * 1024
+	maxRedirects         = 5
+	userAgent            = "BafaChatBot/1.0 (+link previews)"
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+	maxSiteNameLength    = 100
+)
+
+var (
+	// ErrBlocked means the URL, or a redirect it led to, points at a denied host
+	// or a non-public address. It is safefetch.ErrBlocked.
+	ErrBlocked = safefetch.ErrBlocked
+
+	// ErrNoPreview means the page was fetched but has nothing worth showing,
+	// such as a non-HTML response or a page without a title or description.
+	ErrNoPreview = errors.New("page has no preview metadata")
+)
+
+var urlPattern = regexp.MustCompile(`(?i)https?://[^\s<>"'` + "`" + `]+`)
+
+// Preview is the card shown under a message.
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	SiteName    string
+}
+
+// Config controls link preview fetching.
+type Config struct {
+	Enabled  bool
+	Timeout  time.Duration
+	MaxBytes int64
+	// Denylist holds hosts that are never fetched. An entry also matches its subdomains.
+	Denylist []string
+	// AllowedSchemes lists the URL schemes that may be fetched; see safefetch.Config.
+	AllowedSchemes []string
+}
+
+// ConfigFromEnv reads LINK_PREVIEWS_ENABLED, LINK_PREVIEW_TIMEOUT,
+// LINK_PREVIEW_MAX_BYTES and LINK_PREVIEW_DENYLIST. Allowed schemes come from
+// the shared outbound fetch settings.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Enabled:        true,
+		Timeout:        defaultTimeout,
+		MaxBytes:       defaultMaxBytes,
+		AllowedSchemes: safefetch.ConfigFromEnv().AllowedSchemes,
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("LINK_PREVIEWS_ENABLED")); raw != "" {
+		if enabled, err := strconv.ParseBool(raw); err == nil {
+			cfg.Enabled = enabled
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("LINK_PREVIEW_TIMEOUT")); raw != "" {
+		if timeout, err := time.ParseDuration(raw); err == nil && timeout > 0 {
+			cfg.Timeout = timeout
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("LINK_PREVIEW_MAX_BYTES")); raw != "" {
+		if maxBytes, err := strconv.ParseInt(raw, 10, 64); err == nil && maxBytes > 0 {
+			cfg.MaxBytes = maxBytes
+		}
+	}
+
+	for _, entry := range strings.Split(os.Getenv("LINK_PREVIEW_DENYLIST"), ",") {
+		entry = strings.Trim(strings.ToLower(strings.TrimSpace(entry)), ".")
+		if entry != "" {
+			cfg.Denylist = append(cfg.Denylist, entry)
+		}
+	}
+
+	return cfg
+}
+
+// Fetcher downloads pages and extracts their preview metadata.
+type Fetcher struct {
+	client *safefetch.Client
+}
+
+// NewFetcher returns a Fetcher whose connections are restricted to public addresses.
+func NewFetcher(cfg Config) *Fetcher {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+
+	return &Fetcher{
+		client: safefetch.New(safefetch.Config{
+			Timeout:        cfg.Timeout,
+			MaxBytes:       cfg.MaxBytes,
+			MaxRedirects:   maxRedirects,
+			AllowedSchemes: cfg.AllowedSchemes,
+			Denylist:       cfg.Denylist,
+		}),
+	}
+}
+
+// Fetch downloads rawURL and returns its preview. Errors wrapping ErrBlocked or
+// ErrNoPreview will not succeed on retry.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, fmt.Errorf("%w: invalid url", ErrBlocked)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return Preview{}, fmt.Errorf("%w: invalid url", ErrBlocked)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrBlocked) {
+			return Preview{}, err
+		}
+		if errors.Is(err, safefetch.ErrTooManyRedirects) {
+			return Preview{}, fmt.Errorf("%w: too many redirects", ErrNoPreview)
+		}
+		return Preview{}, fmt.Errorf("fetch link preview: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return Preview{}, fmt.Errorf("%w: status %d", ErrNoPreview, resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return Preview{}, fmt.Errorf("fetch link preview: status %d", resp.StatusCode)
+	}
+
+	contentType := strings.ToLower(resp.Header.Get("Content-Type"))
+	if !strings.Contains(contentType, "text/html") && !strings.Contains(contentType, "application/xhtml") {
+		return Preview{}, fmt.Errorf("%w: content type %q", ErrNoPreview, contentType)
+	}
+
+	// The body stops at MaxBytes; metadata found before then is still used.
+	meta := parseMetadata(resp.Body)
+
+	preview := Preview{
+		URL:         rawURL,
+		Title:       truncate(firstNonEmpty(meta["og:title"], meta["twitter:title"], meta["title"]), maxTitleLength),
+		Description: truncate(firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescriptionLength),
+		SiteName:    truncate(meta["og:site_name"], maxSiteNameLength),
+	}
+
+	if preview.Title == "" && preview.Description == "" {
+		return Preview{}, ErrNoPreview
+	}
+
+	image := firstNonEmpty(meta["og:image:secure_url"], meta["og:image"], meta["og:image:url"], meta["twitter:image"], meta["twitter:image:src"])
+	if image != "" {
+		if imageURL, err := resp.Request.URL.Parse(image); err == nil && (imageURL.Scheme == "http" || imageURL.Scheme == "https") {
+			preview.ImageURL = imageURL.String()
+		}
+	}
+
+	return preview, nil
+}
+
+// FirstURL returns the first http or https URL in content, or "" if there is none.
+// Trailing punctuation is dropped, keeping a closing parenthesis that the URL opened.
+func FirstURL(content string) string {
+	match := urlPattern.FindString(content)
+	for match != "" {
+		trimmed := strings.TrimRight(match, ".,;:!?]}*_~")
+		if strings.HasSuffix(trimmed, ")") && strings.Count(trimmed, "(") < strings.Count(trimmed, ")") {
+			trimmed = strings.TrimSuffix(trimmed, ")")
+		}
+		if trimmed == match {
+			break
+		}
+		match = trimmed
+	}
+
+	return match
+}
+
+// parseMetadata collects <meta> values keyed by lowercased property or name, plus
+// the document title under "title". It stops at the end of <head>.
+func parseMetadata(r io.Reader) map[string]string {
+	meta := make(map[string]string)
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			return meta
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+			switch string(name) {
+			case "meta":
+				var key, content string
+				for hasAttr {
+					var attrKey, attrValue []byte
+					attrKey, attrValue, hasAttr = tokenizer.TagAttr()
+					switch string(attrKey) {
+					case "property", "name":
+						if key == "" {
+							key = strings.ToLower(strings.TrimSpace(string(attrValue)))
+						}
+					case "content":
+						content = strings.TrimSpace(string(attrValue))
+					}
+				}
+				if _, seen := meta[key]; key != "" && key != "title" && content != "" && !seen {
+					meta[key] = content
+				}
+			case "title":
+				inTitle = tokenType == html.StartTagToken
+			case "body":
+				return meta
+			}
+		case html.TextToken:
+			if inTitle && meta["title"] == "" {
+				meta["title"] = strings.TrimSpace(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return meta
+			}
+		}
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func truncate(value string, limit int) string {
+	value = strings.Join(strings.Fields(value), " ")
+	if utf8.RuneCountInString(value) <= limit {
+		return value
+	}
+
+	runes := []rune(value)
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
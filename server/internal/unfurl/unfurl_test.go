@@ -0,0 +1,124 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFirstURL(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "no link", content: "nothing to see here", want: ""},
+		{name: "plain", content: "see https://example.com/a?b=c for more", want: "https://example.com/a?b=c"},
+		{name: "first of several", content: "http://one.example and https://two.example", want: "http://one.example"},
+		{name: "trailing punctuation", content: "read https://example.com/post.", want: "https://example.com/post"},
+		{name: "inside parentheses", content: "(see https://example.com/page)", want: "https://example.com/page"},
+		{name: "keeps balanced parenthesis", content: "https://en.wikipedia.org/wiki/Go_(programming_language)", want: "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		{name: "markdown emphasis", content: "**https://example.com/bold**", want: "https://example.com/bold"},
+		{name: "stops at angle bracket", content: "<https://example.com/x>", want: "https://example.com/x"},
+		{name: "other schemes ignored", content: "ftp://example.com/file", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FirstURL(tt.content); got != tt.want {
+				t.Fatalf("FirstURL(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	page := `<!doctype html>
+<html><head>
+<title> Page title </title>
+<meta property="og:title" content="OpenGraph title">
+<meta property="og:title" content="Second title">
+<meta name="Description" content=" A description ">
+<meta property="og:image" content="/cover.png" />
+<meta name="title" content="ignored">
+</head>
+<body><meta property="og:site_name" content="too late"></body></html>`
+
+	meta := parseMetadata(strings.NewReader(page))
+
+	want := map[string]string{
+		"title":       "Page title",
+		"og:title":    "OpenGraph title",
+		"description": "A description",
+		"og:image":    "/cover.png",
+	}
+	for key, value := range want {
+		if meta[key] != value {
+			t.Errorf("meta[%q] = %q, want %q", key, meta[key], value)
+		}
+	}
+	if _, ok := meta["og:site_name"]; ok {
+		t.Error("metadata after <head> was collected")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		value string
+		limit int
+		want  string
+	}{
+		{value: "short", limit: 10, want: "short"},
+		{value: "  collapses \n\t spaces ", limit: 20, want: "collapses spaces"},
+		{value: "exactly ten", limit: 11, want: "exactly ten"},
+		{value: "this is too long", limit: 8, want: "this is…"},
+		{value: "héllo wörld", limit: 6, want: "héllo…"},
+	}
+
+	for _, tt := range tests {
+		if got := truncate(tt.value, tt.limit); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.value, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRefusesLoopbackPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the loopback server")
+	}))
+	t.Cleanup(server.Close)
+
+	_, err := NewFetcher(Config{}).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlocked) {
+		t.Fatalf("Fetch(%s) = %v, want ErrBlocked", server.URL, err)
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("LINK_PREVIEWS_ENABLED", "false")
+	t.Setenv("LINK_PREVIEW_TIMEOUT", "bogus")
+	t.Setenv("LINK_PREVIEW_MAX_BYTES", "4096")
+	t.Setenv("LINK_PREVIEW_DENYLIST", " Example.COM. , ,internal.test")
+	t.Setenv("OUTBOUND_FETCH_ALLOWED_SCHEMES", "https")
+
+	cfg := ConfigFromEnv()
+	if cfg.Enabled {
+		t.Error("Enabled = true, want false")
+	}
+	if cfg.Timeout != defaultTimeout {
+		t.Errorf("Timeout = %v, want the default %v", cfg.Timeout, defaultTimeout)
+	}
+	if cfg.MaxBytes != 4096 {
+		t.Errorf("MaxBytes = %d, want 4096", cfg.MaxBytes)
+	}
+	if !slices.Equal(cfg.Denylist, []string{"example.com", "internal.test"}) {
+		t.Errorf("Denylist = %v, want [example.com internal.test]", cfg.Denylist)
+	}
+	if !slices.Equal(cfg.AllowedSchemes, []string{"https"}) {
+		t.Errorf("AllowedSchemes = %v, want [https]", cfg.AllowedSchemes)
+	}
+}
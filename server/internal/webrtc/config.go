@@ -2,8 +2,9 @@ package webrtc
 
 import (
     "encoding/json"
-    "log"
+    "log/slog"
     "os"
+    "strconv"
     "strings"
 )
 
@@ -17,6 +18,13 @@ type ICEServer struct {
 // Config contains WebRTC signaling configuration to share with clients.
 type Config struct {
     ICEServers []ICEServer
+    TURN       TURNConfig
+    // MaxParticipants caps concurrent participants per audio channel; 0 means unlimited.
+    MaxParticipants int
+    // AudioOnly stops participants from turning their camera or screen share on.
+    AudioOnly bool
+    // SingleScreenShare allows only one participant per channel to share their screen.
+    SingleScreenShare bool
 }
 
 // ConfigFromEnv loads configuration from environment variables.
@@ -24,8 +32,43 @@ type Config struct {
 // Supported env vars:
 //   WEBRTC_ICE_SERVERS  - JSON array of RTCIceServer objects.
 //                         Example: [{"urls":["stun:stun.l.google.com:19302"]}]
+//   WEBRTC_MAX_PARTICIPANTS - default participant cap for audio channels (0 = unlimited).
+//   WEBRTC_AUDIO_ONLY       - when true, camera and screen sharing stay off.
+//   WEBRTC_SINGLE_SCREEN_SHARE - when true, one screen share per channel at a time.
 // If unset, a default Google STUN server is provided for development.
+// TURN REST API settings are loaded by TURNConfigFromEnv.
 func ConfigFromEnv() Config {
+    cfg := iceConfigFromEnv()
+    cfg.TURN = TURNConfigFromEnv()
+
+    if raw := strings.TrimSpace(os.Getenv("WEBRTC_MAX_PARTICIPANTS")); raw != "" {
+        if value, err := strconv.Atoi(raw); err == nil && value >= 0 {
+            cfg.MaxParticipants = value
+        } else {
+            slog.Warn("invalid WEBRTC_MAX_PARTICIPANTS value", "value", raw)
+        }
+    }
+
+    if raw := strings.TrimSpace(os.Getenv("WEBRTC_AUDIO_ONLY")); raw != "" {
+        if value, err := strconv.ParseBool(raw); err == nil {
+            cfg.AudioOnly = value
+        } else {
+            slog.Warn("invalid WEBRTC_AUDIO_ONLY value", "value", raw)
+        }
+    }
+
+    if raw := strings.TrimSpace(os.Getenv("WEBRTC_SINGLE_SCREEN_SHARE")); raw != "" {
+        if value, err := strconv.ParseBool(raw); err == nil {
+            cfg.SingleScreenShare = value
+        } else {
+            slog.Warn("invalid WEBRTC_SINGLE_SCREEN_SHARE value", "value", raw)
+        }
+    }
+
+    return cfg
+}
+
+func iceConfigFromEnv() Config {
     raw := strings.TrimSpace(os.Getenv("WEBRTC_ICE_SERVERS"))
     if raw == "" {
         return Config{
@@ -37,7 +80,7 @@ func ConfigFromEnv() Config {
 
     var servers []ICEServer
     if err := json.Unmarshal([]byte(raw), &servers); err != nil {
-        log.Printf("Invalid WEBRTC_ICE_SERVERS value: %v", err)
+        slog.Warn("invalid WEBRTC_ICE_SERVERS value", "error", err)
         return Config{
             ICEServers: []ICEServer{{
                 URLs: []string{"stun:stun.l.google.com:19302"},
@@ -40,6 +40,8 @@ func (s *redisTokenStore) key(token string) string {
 	return s.prefix + token
 }
 
+// Save writes the session with a key TTL matching its expiry, so saving a renewed
+// session also extends how long Redis keeps it.
 func (s *redisTokenStore) Save(session SessionToken) error {
 	payload, err := json.Marshal(session)
 	if err != nil {
@@ -92,6 +92,9 @@ var (
 	// ErrTokenMismatch signals the token exists but is not valid for the
 	// provided user/channel pair (user or channel mismatch).
 	ErrTokenMismatch = errors.New("webrtc session token mismatch")
+	// ErrNotMember signals the token holder is no longer a member of the
+	// channel's server, so the token cannot be renewed.
+	ErrNotMember = errors.New("webrtc session holder is no longer a server member")
 )
 
 // NewManager constructs a Manager with the provided TTL for issued tokens
@@ -115,6 +118,11 @@ func NewManagerWithStore(ttl time.Duration, store TokenStore) *Manager {
 	}
 }
 
+// TTL returns how long issued tokens remain valid.
+func (m *Manager) TTL() time.Duration {
+	return m.ttl
+}
+
 // Issue creates and stores a new session token for the given user/channel pair.
 func (m *Manager) Issue(userID, channelID uint, displayName, role string) (SessionToken, error) {
 	token, err := generateToken(24)
@@ -163,6 +171,37 @@ func (m *Manager) Validate(token string, expectedUserID, expectedChannelID uint)
 	return session, nil
 }
 
+// Renew extends a valid token's expiry by the manager's TTL so calls can outlast
+// the original lifetime. role is the holder's current server role, looked up
+// again by the caller; the token takes it over, and an empty role removes the
+// token and returns ErrNotMember. Expired tokens are removed and return
+// ErrTokenExpired.
+func (m *Manager) Renew(token, role string) (SessionToken, error) {
+	session, err := m.store.Get(token)
+	if err != nil {
+		return SessionToken{}, err
+	}
+
+	now := time.Now()
+	if now.After(session.ExpiresAt) {
+		_ = m.store.Delete(token)
+		return SessionToken{}, ErrTokenExpired
+	}
+
+	if role == "" {
+		_ = m.store.Delete(token)
+		return SessionToken{}, ErrNotMember
+	}
+
+	session.Role = role
+	session.ExpiresAt = now.Add(m.ttl)
+	if err := m.store.Save(session); err != nil {
+		return SessionToken{}, err
+	}
+
+	return session, nil
+}
+
 // Revoke removes a session token.
 func (m *Manager) Revoke(token string) {
 	_ = m.store.Delete(token)
@@ -0,0 +1,114 @@
+package webrtc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	manager := NewManager(time.Minute)
+
+	session, err := manager.Issue(7, 3, "Ada", "member")
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if _, err := manager.Validate(session.Token, 7, 3); err != nil {
+		t.Fatalf("Validate: %v", err)
+	}
+	if _, err := manager.Validate(session.Token, 8, 3); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("Validate for another user = %v, want ErrTokenMismatch", err)
+	}
+	if _, err := manager.Validate(session.Token, 7, 4); !errors.Is(err, ErrTokenMismatch) {
+		t.Fatalf("Validate for another channel = %v, want ErrTokenMismatch", err)
+	}
+	if _, err := manager.Validate("missing", 7, 3); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Validate for an unknown token = %v, want ErrTokenNotFound", err)
+	}
+
+	manager.Revoke(session.Token)
+	if _, err := manager.Validate(session.Token, 7, 3); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("Validate after Revoke = %v, want ErrTokenNotFound", err)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	store := newMemoryTokenStore()
+	manager := NewManagerWithStore(time.Minute, store)
+
+	t.Run("extends expiry and takes the current role", func(t *testing.T) {
+		session := saveSession(t, store, "live", time.Now().Add(5*time.Second), "moderator")
+
+		renewed, err := manager.Renew(session.Token, "member")
+		if err != nil {
+			t.Fatalf("Renew: %v", err)
+		}
+		if !renewed.ExpiresAt.After(session.ExpiresAt.Add(50 * time.Second)) {
+			t.Fatalf("ExpiresAt = %v, want about a minute from now", renewed.ExpiresAt)
+		}
+		if renewed.Role != "member" {
+			t.Fatalf("Role = %q, want %q", renewed.Role, "member")
+		}
+
+		stored, err := store.Get(session.Token)
+		if err != nil || stored.Role != "member" || !stored.ExpiresAt.Equal(renewed.ExpiresAt) {
+			t.Fatalf("stored session = %+v, %v; want the renewed session", stored, err)
+		}
+	})
+
+	t.Run("former member", func(t *testing.T) {
+		session := saveSession(t, store, "left", time.Now().Add(time.Minute), "member")
+
+		if _, err := manager.Renew(session.Token, ""); !errors.Is(err, ErrNotMember) {
+			t.Fatalf("Renew = %v, want ErrNotMember", err)
+		}
+		if _, err := store.Get(session.Token); !errors.Is(err, ErrTokenNotFound) {
+			t.Fatalf("token was kept after membership ended: %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		session := saveSession(t, store, "stale", time.Now().Add(-time.Second), "member")
+
+		if _, err := manager.Renew(session.Token, "member"); !errors.Is(err, ErrTokenExpired) {
+			t.Fatalf("Renew = %v, want ErrTokenExpired", err)
+		}
+		if _, err := store.Get(session.Token); !errors.Is(err, ErrTokenNotFound) {
+			t.Fatalf("expired token was kept: %v", err)
+		}
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		if _, err := manager.Renew("missing", "member"); !errors.Is(err, ErrTokenNotFound) {
+			t.Fatalf("Renew = %v, want ErrTokenNotFound", err)
+		}
+	})
+}
+
+func TestCleanupRemovesExpiredTokens(t *testing.T) {
+	store := newMemoryTokenStore()
+	manager := NewManagerWithStore(time.Minute, store)
+
+	saveSession(t, store, "stale", time.Now().Add(-time.Second), "member")
+	saveSession(t, store, "live", time.Now().Add(time.Minute), "member")
+
+	manager.Cleanup()
+
+	if _, err := store.Get("stale"); !errors.Is(err, ErrTokenNotFound) {
+		t.Fatalf("expired token survived Cleanup: %v", err)
+	}
+	if _, err := store.Get("live"); err != nil {
+		t.Fatalf("live token was removed: %v", err)
+	}
+}
+
+func saveSession(t *testing.T, store TokenStore, token string, expiresAt time.Time, role string) SessionToken {
+	t.Helper()
+
+	session := SessionToken{Token: token, ChannelID: 3, UserID: 7, Role: role, SessionID: token + "-session", ExpiresAt: expiresAt}
+	if err := store.Save(session); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	return session
+}
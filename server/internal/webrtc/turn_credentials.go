@@ -0,0 +1,104 @@
+package webrtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultTURNCredentialTTL = 5 * time.Minute
+
+// TURNConfig holds the shared secret used to mint ephemeral TURN credentials
+// following the TURN REST API convention (coturn's use-auth-secret).
+type TURNConfig struct {
+	URLs   []string
+	Secret string
+	TTL    time.Duration
+}
+
+// TURNCredentials is a short-lived username/credential pair for a TURN server.
+type TURNCredentials struct {
+	URLs       []string
+	Username   string
+	Credential string
+	TTL        time.Duration
+	ExpiresAt  time.Time
+}
+
+// TURNConfigFromEnv loads TURN REST API settings.
+//
+// Supported env vars:
+//
+//	TURN_URLS            - comma separated turn:/turns: URLs handed to clients.
+//	TURN_SECRET          - shared secret configured on the TURN server.
+//	TURN_CREDENTIAL_TTL  - credential lifetime as a Go duration (default 5m).
+func TURNConfigFromEnv() TURNConfig {
+	cfg := TURNConfig{
+		Secret: strings.TrimSpace(os.Getenv("TURN_SECRET")),
+		TTL:    defaultTURNCredentialTTL,
+	}
+
+	for _, url := range strings.Split(os.Getenv("TURN_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.URLs = append(cfg.URLs, url)
+		}
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("TURN_CREDENTIAL_TTL")); raw != "" {
+		if ttl, err := time.ParseDuration(raw); err == nil && ttl > 0 {
+			cfg.TTL = ttl
+		}
+	}
+
+	return cfg
+}
+
+// Enabled reports whether ephemeral TURN credentials can be issued.
+func (c TURNConfig) Enabled() bool {
+	return c.Secret != "" && len(c.URLs) > 0
+}
+
+// Credentials issues a credential pair for the user that expires after the configured TTL.
+// The username is "<expiry unix>:<user id>" and the credential is base64(HMAC-SHA1(secret, username)).
+func (c TURNConfig) Credentials(userID uint, now time.Time) TURNCredentials {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = defaultTURNCredentialTTL
+	}
+
+	expiresAt := now.Add(ttl)
+	username := fmt.Sprintf("%d:%d", expiresAt.Unix(), userID)
+
+	mac := hmac.New(sha1.New, []byte(c.Secret))
+	mac.Write([]byte(username))
+
+	return TURNCredentials{
+		URLs:       c.URLs,
+		Username:   username,
+		Credential: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		TTL:        ttl,
+		ExpiresAt:  expiresAt,
+	}
+}
+
+// ICEServersFor returns the static ICE servers plus, when configured, a TURN
+// entry carrying fresh credentials for the user.
+func (c Config) ICEServersFor(userID uint, now time.Time) []ICEServer {
+	servers := make([]ICEServer, 0, len(c.ICEServers)+1)
+	servers = append(servers, c.ICEServers...)
+
+	if c.TURN.Enabled() {
+		creds := c.TURN.Credentials(userID, now)
+		servers = append(servers, ICEServer{
+			URLs:       creds.URLs,
+			Username:   creds.Username,
+			Credential: creds.Credential,
+		})
+	}
+
+	return servers
+}
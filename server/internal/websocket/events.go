@@ -0,0 +1,146 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Event types sent to clients. Every event is a JSON envelope of the form
+// {"type": <event type>, "data": {...}}; events published through the hub also
+// carry a "seq" used for resuming.
+const (
+	// Messages. message.deleted carries a reason, such as "expired".
+	EventMessageCreated = "message.created"
+	EventMessageUpdated = "message.updated"
+	EventMessageDeleted = "message.deleted"
+	// EventMentionCreated goes only to the mentioned user.
+	EventMentionCreated = "mention.created"
+	// EventReceiptUpdated tells the other members of a small channel how far a
+	// user has read.
+	EventReceiptUpdated = "receipt.updated"
+
+	// Channels and categories.
+	EventChannelCreated         = "channel.created"
+	EventChannelSettingsUpdated = "channel.settings_updated"
+	EventChannelArchived        = "channel.archived"
+	EventChannelUnarchived      = "channel.unarchived"
+	EventChannelMemberAdded     = "channel.member_added"
+	EventChannelMemberRemoved   = "channel.member_removed"
+	EventChannelTyping          = "channel.typing"
+	EventCategoryCreated        = "category.created"
+	EventCategoryUpdated        = "category.updated"
+	EventCategoryDeleted        = "category.deleted"
+
+	// Server membership and settings.
+	EventMemberRoleUpdated          = "member.role_updated"
+	EventMemberNicknameUpdated      = "member.nickname_updated"
+	EventMemberKicked               = "member.kicked"
+	EventMemberBanned               = "member.banned"
+	EventMemberDeleted              = "member.deleted"
+	EventServerOwnershipTransferred = "server.ownership_transferred"
+	EventEmojiCreated               = "emoji.created"
+	EventEmojiDeleted               = "emoji.deleted"
+
+	// Presence of users who share a server with the recipient.
+	EventPresenceOnline  = "presence.online"
+	EventPresenceOffline = "presence.offline"
+	// EventPresenceUpdated follows a presence.update from the user. Others see
+	// invisible users as offline.
+	EventPresenceUpdated = "presence.updated"
+
+	// Voice sessions.
+	EventSessionReady       = "session.ready"
+	EventSessionError       = "session.error"
+	EventSessionTerminated  = "session.terminated"
+	EventSessionAlive       = "session.alive"
+	EventSessionExpired     = "session.expired"
+	EventSessionRenewed     = "session.renewed"
+	EventParticipantJoined  = "participant.joined"
+	EventParticipantLeft    = "participant.left"
+	EventParticipantUpdated = "participant.updated"
+	EventScreenShareStarted = "screenshare.started"
+	EventScreenShareStopped = "screenshare.stopped"
+
+	// Connection resume; see resume.go.
+	EventResumed        = "resumed"
+	EventResyncRequired = "resync_required"
+)
+
+var errInvalidEventData = errors.New("event data must encode to a JSON object")
+
+// Event is an envelope sent to clients. Build one with NewEvent or one of the
+// typed constructors below; a failure while building is kept on the event and
+// returned by whichever Publish method sends it.
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+	err  error
+}
+
+// NewEvent marshals data, which must encode to a JSON object, into an event of
+// the given type. It lets callers with ad hoc gin.H payloads publish events
+// that do not have a typed constructor yet.
+func NewEvent(eventType string, data any) Event {
+	if eventType == "" {
+		return Event{err: errors.New("event type is required")}
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{Type: eventType, err: fmt.Errorf("marshal %s event: %w", eventType, err)}
+	}
+	if len(raw) == 0 || raw[0] != '{' {
+		return Event{Type: eventType, err: fmt.Errorf("%s: %w", eventType, errInvalidEventData)}
+	}
+
+	return Event{Type: eventType, Data: raw}
+}
+
+// Err reports why the event could not be built, if it could not.
+func (e Event) Err() error {
+	return e.err
+}
+
+// encode returns the event's wire form.
+func (e Event) encode() ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	return json.Marshal(e)
+}
+
+type messageEventData struct {
+	Message   any  `json:"message"`
+	ChannelID uint `json:"channel_id"`
+	ServerID  uint `json:"server_id"`
+}
+
+type messageDeletedEventData struct {
+	MessageID uint   `json:"message_id"`
+	ChannelID uint   `json:"channel_id"`
+	ServerID  uint   `json:"server_id"`
+	Reason    string `json:"reason"`
+}
+
+// MessageCreated announces a new message; message is its serialized form.
+func MessageCreated(message any, channelID, serverID uint) Event {
+	return NewEvent(EventMessageCreated, messageEventData{Message: message, ChannelID: channelID, ServerID: serverID})
+}
+
+// MessageUpdated carries the full serialized message after a change, such as
+// previews becoming ready.
+func MessageUpdated(message any, channelID, serverID uint) Event {
+	return NewEvent(EventMessageUpdated, messageEventData{Message: message, ChannelID: channelID, ServerID: serverID})
+}
+
+// MessageDeleted tells clients to drop a message, giving the reason it went.
+func MessageDeleted(messageID, channelID, serverID uint, reason string) Event {
+	return NewEvent(EventMessageDeleted, messageDeletedEventData{MessageID: messageID, ChannelID: channelID, ServerID: serverID, Reason: reason})
+}
+
+// MentionCreated tells a user they were mentioned in the serialized message.
+func MentionCreated(message any, channelID, serverID uint) Event {
+	return NewEvent(EventMentionCreated, messageEventData{Message: message, ChannelID: channelID, ServerID: serverID})
+}
@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestTypedEventsEncode(t *testing.T) {
+	message := map[string]any{"id": 7, "content": "hi"}
+
+	tests := []struct {
+		name     string
+		event    Event
+		wantType string
+		wantData map[string]any
+	}{
+		{
+			name:     "message created",
+			event:    MessageCreated(message, 11, 1),
+			wantType: "message.created",
+			wantData: map[string]any{"message": map[string]any{"id": 7.0, "content": "hi"}, "channel_id": 11.0, "server_id": 1.0},
+		},
+		{
+			name:     "message updated",
+			event:    MessageUpdated(message, 11, 1),
+			wantType: "message.updated",
+			wantData: map[string]any{"message": map[string]any{"id": 7.0, "content": "hi"}, "channel_id": 11.0, "server_id": 1.0},
+		},
+		{
+			name:     "message deleted",
+			event:    MessageDeleted(7, 11, 1, "expired"),
+			wantType: "message.deleted",
+			wantData: map[string]any{"message_id": 7.0, "channel_id": 11.0, "server_id": 1.0, "reason": "expired"},
+		},
+		{
+			name:     "mention created",
+			event:    MentionCreated(message, 11, 1),
+			wantType: "mention.created",
+			wantData: map[string]any{"message": map[string]any{"id": 7.0, "content": "hi"}, "channel_id": 11.0, "server_id": 1.0},
+		},
+		{
+			name:     "ad hoc event",
+			event:    NewEvent(EventChannelArchived, map[string]any{"channel_id": 11, "server_id": 1}),
+			wantType: "channel.archived",
+			wantData: map[string]any{"channel_id": 11.0, "server_id": 1.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := tt.event.encode()
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			var envelope map[string]any
+			if err := json.Unmarshal(raw, &envelope); err != nil {
+				t.Fatalf("unmarshal %s: %v", raw, err)
+			}
+			if keys := slices.Sorted(maps.Keys(envelope)); !slices.Equal(keys, []string{"data", "type"}) {
+				t.Fatalf("envelope keys = %v, want [data type]", keys)
+			}
+			if envelope["type"] != tt.wantType {
+				t.Fatalf("type = %v, want %q", envelope["type"], tt.wantType)
+			}
+
+			data, ok := envelope["data"].(map[string]any)
+			if !ok {
+				t.Fatalf("data = %#v, want an object", envelope["data"])
+			}
+			assertJSONEqual(t, data, tt.wantData)
+		})
+	}
+}
+
+func TestNewEventRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		eventType string
+		data      any
+		wantErr   error
+	}{
+		{name: "missing type", eventType: "", data: map[string]any{}},
+		{name: "array data", eventType: EventChannelCreated, data: []int{1}, wantErr: errInvalidEventData},
+		{name: "string data", eventType: EventChannelCreated, data: "hello", wantErr: errInvalidEventData},
+		{name: "nil data", eventType: EventChannelCreated, data: nil, wantErr: errInvalidEventData},
+		{name: "unmarshalable data", eventType: EventChannelCreated, data: map[string]any{"bad": make(chan int)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := NewEvent(tt.eventType, tt.data)
+			if event.Err() == nil {
+				t.Fatal("NewEvent succeeded, want an error")
+			}
+			if tt.wantErr != nil && !errors.Is(event.Err(), tt.wantErr) {
+				t.Fatalf("err = %v, want %v", event.Err(), tt.wantErr)
+			}
+			if _, err := event.encode(); !errors.Is(err, event.Err()) {
+				t.Fatalf("encode err = %v, want the build error", err)
+			}
+		})
+	}
+}
+
+func assertJSONEqual(t *testing.T, got, want map[string]any) {
+	t.Helper()
+
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Fatalf("data = %s, want %s", gotJSON, wantJSON)
+	}
+}
@@ -0,0 +1,44 @@
+package websocket
+
+import "time"
+
+// handleHandSignal raises or lowers the caller's hand in their voice session so
+// others can see they would like to speak. It is signaling state only and does
+// not touch media.
+func (c *Client) handleHandSignal(raised bool) {
+	if !c.webrtcActive {
+		c.sendError("session.required", "webrtc session not active")
+		return
+	}
+
+	participant := c.hub.setHandRaised(c.webrtcChannelID, c.userID, raised)
+	if participant == nil {
+		c.sendError("participant.missing", "participant not registered")
+		return
+	}
+
+	c.hub.broadcastToChannel(c.webrtcChannelID, NewEvent(EventParticipantUpdated, map[string]interface{}{
+		"user_id":     participant.UserID,
+		"channel_id":  participant.ChannelID,
+		"media_state": participant.MediaState,
+		"hand_raised": participant.HandRaised,
+		"session_id":  participant.SessionID,
+	}), 0)
+}
+
+// setHandRaised updates a participant's raised hand and returns a copy of them,
+// or nil if they are not in the channel's session.
+func (h *Hub) setHandRaised(channelID, userID uint, raised bool) *Participant {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	participant, ok := h.participants[channelID][userID]
+	if !ok {
+		return nil
+	}
+
+	participant.HandRaised = raised
+	participant.LastSeen = time.Now()
+	clone := *participant
+	return &clone
+}
@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestHandSignalBroadcastsRaisedHand(t *testing.T) {
+	hub, _, moderator, member := newCallHub(t)
+
+	for _, raised := range []bool{true, false} {
+		member.handleHandSignal(raised)
+
+		_, participant := hub.channelParticipantPair(testChannelID, 0, 2)
+		if participant == nil || participant.HandRaised != raised {
+			t.Fatalf("participant = %+v, want hand raised %v", participant, raised)
+		}
+
+		events := drainEvents(t, moderator)
+		if len(events) != 1 || events[0].Type != EventParticipantUpdated {
+			t.Fatalf("events = %+v, want one %s", events, EventParticipantUpdated)
+		}
+		var data struct {
+			UserID     uint       `json:"user_id"`
+			HandRaised bool       `json:"hand_raised"`
+			MediaState MediaState `json:"media_state"`
+		}
+		if err := json.Unmarshal(events[0].Data, &data); err != nil {
+			t.Fatal(err)
+		}
+		if data.UserID != 2 || data.HandRaised != raised || data.MediaState.Mic != MediaOn {
+			t.Fatalf("participant.updated = %+v, want user 2 with hand raised %v and media untouched", data, raised)
+		}
+		drainEvents(t, member)
+	}
+}
+
+func TestHandSignalRequiresSession(t *testing.T) {
+	hub, _, _, member := newCallHub(t)
+
+	member.webrtcActive = false
+	member.handleHandSignal(true)
+	if codes := sessionErrorCodes(t, drainEvents(t, member)); !slices.Equal(codes, []string{"session.required"}) {
+		t.Fatalf("error codes = %v, want [session.required]", codes)
+	}
+
+	member.webrtcActive = true
+	hub.removeParticipant(testChannelID, 2)
+	member.handleHandSignal(true)
+	if codes := sessionErrorCodes(t, drainEvents(t, member)); !slices.Equal(codes, []string{"participant.missing"}) {
+		t.Fatalf("error codes = %v, want [participant.missing]", codes)
+	}
+}
@@ -0,0 +1,158 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeResolver is an in-memory MembershipResolver.
+type fakeResolver struct {
+	mu             sync.Mutex
+	userServers    map[uint][]uint
+	channelServers map[uint]uint
+	// roles maps a server ID and user ID to the user's role.
+	roles map[[2]uint]string
+	err   error
+}
+
+func newFakeResolver() *fakeResolver {
+	return &fakeResolver{
+		userServers:    map[uint][]uint{},
+		channelServers: map[uint]uint{},
+		roles:          map[[2]uint]string{},
+	}
+}
+
+func (r *fakeResolver) setRole(serverID, userID uint, role string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roles[[2]uint{serverID, userID}] = role
+}
+
+func (r *fakeResolver) ServerIDsForUser(userID uint) ([]uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.userServers[userID], r.err
+}
+
+func (r *fakeResolver) ServerIDForChannel(channelID uint) (uint, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	serverID, ok := r.channelServers[channelID]
+	if !ok {
+		return 0, errors.New("channel not found")
+	}
+	return serverID, r.err
+}
+
+func (r *fakeResolver) ChannelMemberRole(channelID, userID uint) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return "", r.err
+	}
+	return r.roles[[2]uint{r.channelServers[channelID], userID}], nil
+}
+
+// newTestClient registers a client for userID on the hub without a connection.
+// Events sent to it are buffered on its send channel.
+func newTestClient(h *Hub, userID uint, serverIDs ...uint) *Client {
+	client := &Client{
+		hub:     h,
+		send:    make(chan []byte, 64),
+		userID:  userID,
+		servers: map[uint]bool{},
+	}
+	for _, serverID := range serverIDs {
+		client.servers[serverID] = true
+	}
+
+	h.mu.Lock()
+	h.clients[client] = true
+	h.mu.Unlock()
+
+	return client
+}
+
+// drainEvents returns the events queued for the client so far.
+func drainEvents(t *testing.T, c *Client) []Event {
+	t.Helper()
+
+	var events []Event
+	for {
+		select {
+		case raw, ok := <-c.send:
+			if !ok {
+				return events
+			}
+			var event Event
+			if err := json.Unmarshal(raw, &event); err != nil {
+				t.Fatalf("decode event: %v", err)
+			}
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// sessionErrorCodes returns the codes of the session.error events in events.
+func sessionErrorCodes(t *testing.T, events []Event) []string {
+	t.Helper()
+
+	var codes []string
+	for _, event := range events {
+		if event.Type != EventSessionError {
+			continue
+		}
+		var data struct {
+			Code string `json:"code"`
+		}
+		if err := json.Unmarshal(event.Data, &data); err != nil {
+			t.Fatalf("decode session.error: %v", err)
+		}
+		codes = append(codes, data.Code)
+	}
+	return codes
+}
+
+// startHub runs the hub until the test ends. Test clients have no connection,
+// so they are dropped before shutdown.
+func startHub(t *testing.T, h *Hub) {
+	t.Helper()
+
+	go h.Run()
+	t.Cleanup(func() {
+		h.mu.Lock()
+		for client := range h.clients {
+			delete(h.clients, client)
+		}
+		h.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = h.Shutdown(ctx)
+	})
+}
+
+// waitForEvent returns the next event queued for the client, failing the test
+// if none arrives in time.
+func waitForEvent(t *testing.T, c *Client) Event {
+	t.Helper()
+
+	select {
+	case raw := <-c.send:
+		var event Event
+		if err := json.Unmarshal(raw, &event); err != nil {
+			t.Fatalf("decode event: %v", err)
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatalf("user %d received no event", c.userID)
+		return Event{}
+	}
+}
@@ -1,19 +1,26 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"bafachat/internal/apierror"
 	"bafachat/internal/auth"
+	"bafachat/internal/logging"
+	"bafachat/internal/models"
 	"bafachat/internal/webrtc"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
 )
 
 // MediaState describes the mute/published status of a participant's tracks.
@@ -31,22 +38,67 @@ type Participant struct {
 	ChannelID   uint       `json:"channel_id"`
 	SessionID   string     `json:"session_id"`
 	MediaState  MediaState `json:"media_state"`
+	HandRaised  bool       `json:"hand_raised"`
 	LastSeen    time.Time  `json:"last_seen"`
+	// SessionToken is the signaling token backing this participant. It is
+	// never serialized so it cannot leak to other clients.
+	SessionToken string `json:"-"`
 }
 
-type outboundEnvelope struct {
-	Type string      `json:"type"`
-	Data interface{} `json:"data"`
+// hubMessage is a marshalled event queued for fan-out. A nil recipient list
+// means every connected client. The audience lists the users whose event logs
+// record the message, including users inside the resume retention window who
+// have no open connection; everyone records it in every log.
+type hubMessage struct {
+	payload    []byte
+	recipients []*Client
+	audience   []uint
+	everyone   bool
 }
 
 // Hub coordinates websocket clients and relays channel or WebRTC updates.
 type Hub struct {
-	mu           sync.RWMutex
-	clients      map[*Client]bool
-	broadcast    chan []byte
-	register     chan *Client
-	unregister   chan *Client
-	participants map[uint]map[uint]*Participant
+	mu             sync.RWMutex
+	clients        map[*Client]bool
+	broadcast      chan hubMessage
+	register       chan *Client
+	unregister     chan *Client
+	participants   map[uint]map[uint]*Participant
+	resolver       MembershipResolver
+	originAllowed  func(origin string) bool
+	channelServers map[uint]uint
+	// presence counts open connections per user; offlineTimers holds the
+	// debounce timers for users whose last connection just closed.
+	presence      map[uint]int
+	offlineTimers map[uint]*time.Timer
+	// lastSeen persists presence; lastSeenPending holds the disconnect times
+	// of users who left since the last flush. See last_seen.go.
+	lastSeen        LastSeenRecorder
+	lastSeenPending map[uint]time.Time
+	// statuses holds the presence status chosen by each connected user;
+	// statusStore persists it. See presence_status.go.
+	statuses    map[uint]string
+	statusStore PresenceStatusStore
+	// participantTimeout is how long a WebRTC participant may go without
+	// activity before the sweeper removes them.
+	participantTimeout time.Duration
+	// audioOnly rejects participant updates that turn a camera or screen on.
+	audioOnly bool
+	// singleScreenShare allows at most one screen share per channel at a time.
+	singleScreenShare bool
+	// reservations holds voice seats granted at join time that have not yet
+	// been claimed by session.authenticate, keyed by channel then user.
+	reservations map[uint]map[uint]time.Time
+	// eventLogs buffers each user's recent events so reconnecting clients can
+	// resume; see resume.go.
+	logMu            sync.Mutex
+	eventLogs        map[uint]*eventLog
+	resumeBufferSize int
+	resume           chan resumeRequest
+	// done is closed by Shutdown; stopped is closed once Run has disconnected every client.
+	done         chan struct{}
+	stopped      chan struct{}
+	shutdownOnce sync.Once
 }
 
 // Client represents a websocket client connection.
@@ -56,12 +108,21 @@ type Client struct {
 	send            chan []byte
 	userID          uint
 	username        string
+	servers         map[uint]bool
 	activeChannelID uint
 	webrtcManager   *webrtc.Manager
 	webrtcToken     string
 	webrtcChannelID uint
 	webrtcSessionID string
 	webrtcActive    bool
+	// startStatus is the saved presence status loaded when the connection
+	// opened, applied if it is the user's first open connection.
+	startStatus string
+	// requestID is the ID of the upgrade request, carried into the connection's log lines.
+	requestID string
+	// firstLiveSeq is the sequence number of the first event delivered on this
+	// connection. It is only touched by Run.
+	firstLiveSeq uint64
 }
 
 // Message represents a websocket message.
@@ -87,12 +148,21 @@ const (
 
 	// Maximum message size allowed from peer
 	maxMessageSize = 512 * 1024 // 512KB
+
+	// Outbound messages queued per connection before it is considered stuck
+	clientSendBuffer = 256
+
+	// Grace period before announcing a user offline so quick reconnects don't flap
+	presenceOfflineDelay = 5 * time.Second
+
+	// Default inactivity window before a WebRTC participant is considered stale
+	defaultParticipantTimeout = 2 * pongWait
 )
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
-		// Allow connections from any origin for development.
-		// In production we should implement strict origin validation.
+		// HandleWebSocket validates the origin before upgrading so it can
+		// answer with a 403 instead of the upgrader's bare error.
 		return true
 	},
 }
@@ -100,54 +170,236 @@ var upgrader = websocket.Upgrader{
 // NewHub creates a new Hub instance.
 func NewHub() *Hub {
 	return &Hub{
-		broadcast:    make(chan []byte),
-		register:     make(chan *Client),
-		unregister:   make(chan *Client),
-		clients:      make(map[*Client]bool),
-		participants: make(map[uint]map[uint]*Participant),
+		broadcast:      make(chan hubMessage),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		clients:        make(map[*Client]bool),
+		participants:   make(map[uint]map[uint]*Participant),
+		channelServers: make(map[uint]uint),
+		presence:       make(map[uint]int),
+		offlineTimers:  make(map[uint]*time.Timer),
+
+		lastSeenPending: make(map[uint]time.Time),
+		statuses:        make(map[uint]string),
+
+		participantTimeout: defaultParticipantTimeout,
+		reservations:       make(map[uint]map[uint]time.Time),
+
+		eventLogs:        make(map[uint]*eventLog),
+		resumeBufferSize: defaultResumeBufferSize,
+		resume:           make(chan resumeRequest),
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// ParticipantTimeoutFromEnv reads WEBRTC_PARTICIPANT_TIMEOUT as a Go duration,
+// falling back to the default when unset or invalid.
+func ParticipantTimeoutFromEnv() time.Duration {
+	raw := strings.TrimSpace(os.Getenv("WEBRTC_PARTICIPANT_TIMEOUT"))
+	if raw == "" {
+		return defaultParticipantTimeout
 	}
+
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		slog.Warn("invalid WEBRTC_PARTICIPANT_TIMEOUT value", "value", raw)
+		return defaultParticipantTimeout
+	}
+
+	return timeout
+}
+
+// SetParticipantTimeout changes how long a WebRTC participant may stay silent
+// before being removed. It must be called before Run.
+func (h *Hub) SetParticipantTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+
+	h.mu.Lock()
+	h.participantTimeout = timeout
+	h.mu.Unlock()
+}
+
+// SetMembershipResolver enables server-scoped delivery. Without a resolver
+// every event is delivered to every connected client.
+func (h *Hub) SetMembershipResolver(resolver MembershipResolver) {
+	h.mu.Lock()
+	h.resolver = resolver
+	h.mu.Unlock()
+}
+
+// SetOriginValidator sets the check applied to the Origin header of websocket
+// upgrade requests. Without one only pages served from the host the upgrade
+// request was sent to may connect.
+func (h *Hub) SetOriginValidator(allowed func(origin string) bool) {
+	h.mu.Lock()
+	h.originAllowed = allowed
+	h.mu.Unlock()
+}
+
+// checkOrigin reports whether an upgrade request may proceed. Requests without
+// an Origin header come from non-browser clients, which are not exposed to
+// cross-site hijacking and still need a valid token.
+func (h *Hub) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	h.mu.RLock()
+	allowed := h.originAllowed
+	h.mu.RUnlock()
+
+	if allowed == nil {
+		return sameOrigin(origin, r.Host)
+	}
+	return allowed(origin)
+}
+
+// sameOrigin reports whether origin names host, the host a request was sent to.
+func sameOrigin(origin, host string) bool {
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return parsed.Host != "" && strings.EqualFold(parsed.Host, host)
 }
 
 // Run processes client registration and message fan-out.
 func (h *Hub) Run() {
+	go h.sweepStaleParticipants()
+	go h.pruneEventLogs()
+	go h.recordLastSeen()
+
 	for {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
-			log.Printf("Client connected (user=%d). Total clients: %d", client.userID, len(h.clients))
+			h.openEventLog(client)
+			h.markOnline(client)
+			client.logger().Info("websocket client connected", "total_clients", len(h.clients))
 
 		case client := <-h.unregister:
 			h.mu.Lock()
-			if _, ok := h.clients[client]; ok {
+			_, registered := h.clients[client]
+			if registered {
 				delete(h.clients, client)
 				close(client.send)
 			}
 			h.mu.Unlock()
-			log.Printf("Client disconnected (user=%d). Total clients: %d", client.userID, len(h.clients))
+			if registered {
+				h.markOffline(client)
+			}
+			client.logger().Info("websocket client disconnected", "total_clients", len(h.clients))
 
 		case message := <-h.broadcast:
 			h.mu.RLock()
-			clients := make([]*Client, 0, len(h.clients))
-			for client := range h.clients {
-				clients = append(clients, client)
+			var clients []*Client
+			if message.recipients == nil {
+				clients = make([]*Client, 0, len(h.clients))
+				for client := range h.clients {
+					clients = append(clients, client)
+				}
+			} else {
+				// Recipients were captured at publish time; skip any that have since disconnected.
+				clients = make([]*Client, 0, len(message.recipients))
+				for _, client := range message.recipients {
+					if h.clients[client] {
+						clients = append(clients, client)
+					}
+				}
 			}
 			h.mu.RUnlock()
 
+			stamped := h.recordEvent(message)
 			for _, client := range clients {
+				payload := message.payload
+				if event, ok := stamped[client.userID]; ok {
+					payload = event.payload
+					if client.firstLiveSeq == 0 {
+						client.firstLiveSeq = event.seq
+					}
+				}
+
 				select {
-				case client.send <- message:
+				case client.send <- payload:
 				default:
 					h.forceDisconnect(client)
 				}
 			}
+
+		case request := <-h.resume:
+			h.handleResume(request)
+
+		case <-h.done:
+			h.flushLastSeen()
+			h.closeAllClients()
+			close(h.stopped)
+			return
 		}
 	}
 }
 
+// Shutdown stops the hub and closes every websocket connection with a going-away
+// close frame so clients reconnect to another instance. It returns once the
+// connections are closed or ctx expires.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.shutdownOnce.Do(func() {
+		close(h.done)
+	})
+
+	select {
+	case <-h.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeAllClients sends each client a close frame and ends its write pump.
+func (h *Hub) closeAllClients() {
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	deadline := time.Now().Add(writeWait)
+
+	h.mu.Lock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		delete(h.clients, client)
+		close(client.send)
+		clients = append(clients, client)
+	}
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		_ = client.conn.WriteControl(websocket.CloseMessage, closeMessage, deadline)
+		client.conn.Close()
+	}
+}
+
+// enqueue hands a message to Run without blocking the publisher. Messages
+// published after Shutdown are dropped.
+func (h *Hub) enqueue(message hubMessage) {
+	go func() {
+		select {
+		case h.broadcast <- message:
+		case <-h.done:
+		}
+	}()
+}
+
 // HandleWebSocket upgrades HTTP requests into websocket connections.
 func HandleWebSocket(hub *Hub, manager *webrtc.Manager, c *gin.Context) {
+	if !hub.checkOrigin(c.Request) {
+		logging.FromContext(c.Request.Context()).Warn("rejected websocket connection from disallowed origin", "origin", c.GetHeader("Origin"))
+		apierror.Abort(c, http.StatusForbidden, apierror.CodeOriginNotAllowed, "origin not allowed")
+		return
+	}
+
 	authHeader := c.GetHeader("Authorization")
 	token := ""
 	if authHeader != "" {
@@ -162,32 +414,49 @@ func HandleWebSocket(hub *Hub, manager *webrtc.Manager, c *gin.Context) {
 	}
 
 	if token == "" {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeAuthorizationRequired, "missing token")
 		return
 	}
 
 	claims, err := auth.ParseJWT(token)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "invalid or expired token")
 		return
 	}
 
+	if value, ok := c.Get("db"); ok {
+		if db, ok := value.(*gorm.DB); ok {
+			if err := auth.ValidateSession(db.WithContext(c), claims); err != nil {
+				apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "invalid or expired token")
+				return
+			}
+		}
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("Failed to upgrade connection: %v", err)
+		logging.FromContext(c.Request.Context()).Warn("failed to upgrade websocket connection", "error", err)
 		return
 	}
 
 	client := &Client{
 		hub:           hub,
 		conn:          conn,
-		send:          make(chan []byte, 256),
+		send:          make(chan []byte, clientSendBuffer),
 		userID:        claims.UserID,
 		username:      claims.Username,
+		servers:       hub.loadUserServers(claims.UserID),
+		startStatus:   hub.loadPresenceStatus(claims.UserID),
 		webrtcManager: manager,
+		requestID:     logging.RequestID(c.Request.Context()),
 	}
 
-	client.hub.register <- client
+	select {
+	case client.hub.register <- client:
+	case <-hub.done:
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -196,13 +465,19 @@ func HandleWebSocket(hub *Hub, manager *webrtc.Manager, c *gin.Context) {
 func (c *Client) readPump() {
 	defer func() {
 		c.handleSessionLeave("disconnect")
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		c.conn.Close()
 	}()
 
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		if c.webrtcActive {
+			c.hub.touchParticipant(c.webrtcChannelID, c.userID)
+		}
 		return nil
 	})
 
@@ -210,7 +485,7 @@ func (c *Client) readPump() {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				c.logger().Warn("websocket read error", "error", err)
 			}
 			break
 		}
@@ -232,6 +507,17 @@ func (c *Client) readPump() {
 				c.activeChannelID = payload.ChannelID
 			}
 
+		case "resume":
+			var payload struct {
+				LastSeq uint64 `json:"last_seq"`
+			}
+			if err := json.Unmarshal(envelope.Data, &payload); err == nil {
+				select {
+				case c.hub.resume <- resumeRequest{client: c, lastSeq: payload.LastSeq}:
+				case <-c.hub.done:
+				}
+			}
+
 		case "channel.leave":
 			var payload struct {
 				ChannelID uint `json:"channel_id"`
@@ -245,12 +531,33 @@ func (c *Client) readPump() {
 		case "session.authenticate":
 			c.handleSessionAuthenticate(envelope.Data)
 
+		case "session.heartbeat":
+			c.handleSessionHeartbeat()
+
+		case "session.renew":
+			c.handleSessionRenew()
+
 		case "session.leave", "webrtc.end_session":
 			c.handleSessionLeave("client")
 
 		case "participant.update":
 			c.handleParticipantUpdate(envelope.Data)
 
+		case "participant.raise_hand":
+			c.handleHandSignal(true)
+
+		case "participant.lower_hand":
+			c.handleHandSignal(false)
+
+		case "presence.update":
+			c.handlePresenceUpdate(envelope.Data)
+
+		case "webrtc.force_mute":
+			c.handleForceMute(envelope.Data)
+
+		case "webrtc.force_disconnect":
+			c.handleForceDisconnect(envelope.Data)
+
 		case "webrtc.offer":
 			c.handleWebRTCSignal("webrtc.offer", envelope.Data)
 
@@ -280,34 +587,181 @@ func (c *Client) writePump() {
 			}
 
 			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				log.Printf("WebSocket write error: %v", err)
+				c.logger().Warn("websocket write error", "error", err)
 				return
 			}
 
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("WebSocket ping error: %v", err)
+				c.logger().Warn("websocket ping error", "error", err)
 				return
 			}
 		}
 	}
 }
 
-// Publish sends a payload to all connected clients.
-func (h *Hub) Publish(payload interface{}) error {
-	message, err := json.Marshal(payload)
+// Publish sends an event to all connected clients. Prefer PublishToServer
+// for anything tied to a server so outsiders never receive it.
+func (h *Hub) Publish(event Event) error {
+	message, err := event.encode()
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		h.broadcast <- message
-	}()
+	h.enqueue(hubMessage{payload: message, everyone: true})
 
 	return nil
 }
 
+// PublishToServer sends an event to the connected members of a server.
+// Recipients are resolved immediately, so a member removed right after the
+// call still receives the event.
+func (h *Hub) PublishToServer(serverID uint, event Event) error {
+	message, err := event.encode()
+	if err != nil {
+		return err
+	}
+
+	recipients := h.serverClients(serverID)
+	audience := h.serverAudience(serverID)
+	if len(recipients) == 0 && len(audience) == 0 {
+		return nil
+	}
+
+	h.enqueue(hubMessage{payload: message, recipients: recipients, audience: audience})
+
+	return nil
+}
+
+// PublishToUser sends an event to every open connection of a single user.
+func (h *Hub) PublishToUser(userID uint, event Event) error {
+	message, err := event.encode()
+	if err != nil {
+		return err
+	}
+
+	recipients := h.userClients(userID)
+	audience := h.logAudience(func(logUserID uint, _ *eventLog) bool {
+		return logUserID == userID
+	})
+	if len(recipients) == 0 && len(audience) == 0 {
+		return nil
+	}
+
+	h.enqueue(hubMessage{payload: message, recipients: recipients, audience: audience})
+
+	return nil
+}
+
+// AddServerMember starts delivering a server's events to the user's open connections.
+func (h *Hub) AddServerMember(serverID, userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if client.userID == userID {
+			client.servers[serverID] = true
+		}
+	}
+
+	h.setEventLogServer(userID, serverID, true)
+}
+
+// RemoveServerMember stops delivering a server's events to the user's open connections.
+func (h *Hub) RemoveServerMember(serverID, userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients {
+		if client.userID == userID {
+			delete(client.servers, serverID)
+		}
+	}
+
+	h.setEventLogServer(userID, serverID, false)
+}
+
+func (h *Hub) loadUserServers(userID uint) map[uint]bool {
+	servers := make(map[uint]bool)
+
+	h.mu.RLock()
+	resolver := h.resolver
+	h.mu.RUnlock()
+	if resolver == nil {
+		return servers
+	}
+
+	serverIDs, err := resolver.ServerIDsForUser(userID)
+	if err != nil {
+		slog.Error("failed to load server memberships", "user_id", userID, "error", err)
+		return servers
+	}
+
+	for _, serverID := range serverIDs {
+		servers[serverID] = true
+	}
+
+	return servers
+}
+
+// serverClients returns the connected clients that belong to the server. When
+// no resolver is configured it falls back to every client.
+func (h *Hub) serverClients(serverID uint) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		if h.resolver == nil || client.servers[serverID] {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients
+}
+
+func (h *Hub) userClients(userID uint) []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, 1)
+	for client := range h.clients {
+		if client.userID == userID {
+			clients = append(clients, client)
+		}
+	}
+
+	return clients
+}
+
+// channelServerID resolves and caches the server owning a channel.
+func (h *Hub) channelServerID(channelID uint) (uint, bool) {
+	h.mu.RLock()
+	serverID, cached := h.channelServers[channelID]
+	resolver := h.resolver
+	h.mu.RUnlock()
+
+	if cached {
+		return serverID, true
+	}
+	if resolver == nil {
+		return 0, false
+	}
+
+	serverID, err := resolver.ServerIDForChannel(channelID)
+	if err != nil {
+		slog.Error("failed to resolve server for channel", "channel_id", channelID, "error", err)
+		return 0, false
+	}
+
+	h.mu.Lock()
+	h.channelServers[channelID] = serverID
+	h.mu.Unlock()
+
+	return serverID, true
+}
+
 func (c *Client) handleSessionAuthenticate(raw json.RawMessage) {
 	if c.webrtcManager == nil {
 		c.sendError("session.unavailable", "signaling service unavailable")
@@ -354,11 +808,12 @@ func (c *Client) handleSessionAuthenticate(raw json.RawMessage) {
 		ChannelID:   session.ChannelID,
 		SessionID:   session.SessionID,
 		MediaState: MediaState{
-			Mic:    "off",
-			Camera: "off",
-			Screen: "off",
+			Mic:    MediaOff,
+			Camera: MediaOff,
+			Screen: MediaOff,
 		},
-		LastSeen: time.Now(),
+		LastSeen:     time.Now(),
+		SessionToken: payload.SessionToken,
 	}
 
 	c.webrtcToken = payload.SessionToken
@@ -368,17 +823,11 @@ func (c *Client) handleSessionAuthenticate(raw json.RawMessage) {
 
 	c.hub.addParticipant(&participant)
 
-	c.sendJSON(outboundEnvelope{
-		Type: "session.ready",
-		Data: map[string]interface{}{
-			"channel_id": session.ChannelID,
-		},
-	})
+	c.sendJSON(NewEvent(EventSessionReady, map[string]interface{}{
+		"channel_id": session.ChannelID,
+	}))
 
-	c.hub.broadcastToChannel(session.ChannelID, outboundEnvelope{
-		Type: "participant.joined",
-		Data: participant,
-	}, c.userID)
+	c.hub.broadcastToChannel(session.ChannelID, NewEvent(EventParticipantJoined, participant), c.userID)
 }
 
 func (c *Client) handleSessionLeave(reason string) {
@@ -388,14 +837,13 @@ func (c *Client) handleSessionLeave(reason string) {
 
 	removed := c.hub.removeParticipant(c.webrtcChannelID, c.userID)
 	if removed != nil {
-		c.hub.broadcastToChannel(c.webrtcChannelID, outboundEnvelope{
-			Type: "participant.left",
-			Data: map[string]interface{}{
-				"user_id":    removed.UserID,
-				"channel_id": removed.ChannelID,
-				"reason":     reason,
-			},
-		}, c.userID)
+		c.hub.broadcastToChannel(c.webrtcChannelID, NewEvent(EventParticipantLeft, map[string]interface{}{
+			"user_id":    removed.UserID,
+			"channel_id": removed.ChannelID,
+			"reason":     reason,
+		}), c.userID)
+
+		c.hub.publishScreenShareEnded(*removed)
 	}
 
 	if c.webrtcManager != nil && c.webrtcToken != "" {
@@ -423,21 +871,29 @@ func (c *Client) handleParticipantUpdate(raw json.RawMessage) {
 		return
 	}
 
-	participant := c.hub.updateParticipantState(c.webrtcChannelID, c.userID, payload.MediaState)
-	if participant == nil {
+	if err := c.hub.validateMediaState(payload.MediaState); err != nil {
+		c.sendError("participant.invalid", err.Error())
+		return
+	}
+
+	participant, previous, err := c.hub.applyParticipantMedia(c.webrtcChannelID, c.userID, payload.MediaState)
+	if err != nil {
+		if errors.Is(err, errScreenUnavailable) {
+			c.sendError("screen.unavailable", err.Error())
+			return
+		}
 		c.sendError("participant.missing", "participant not registered")
 		return
 	}
 
-	c.hub.broadcastToChannel(c.webrtcChannelID, outboundEnvelope{
-		Type: "participant.updated",
-		Data: map[string]interface{}{
-			"user_id":     participant.UserID,
-			"channel_id":  participant.ChannelID,
-			"media_state": participant.MediaState,
-			"session_id":  participant.SessionID,
-		},
-	}, 0)
+	c.hub.broadcastToChannel(c.webrtcChannelID, NewEvent(EventParticipantUpdated, map[string]interface{}{
+		"user_id":     participant.UserID,
+		"channel_id":  participant.ChannelID,
+		"media_state": participant.MediaState,
+		"session_id":  participant.SessionID,
+	}), 0)
+
+	c.hub.publishScreenShareChange(*participant, previous.Screen)
 }
 
 func (c *Client) handleWebRTCSignal(eventType string, raw json.RawMessage) {
@@ -468,14 +924,24 @@ func (c *Client) handleWebRTCSignal(eventType string, raw json.RawMessage) {
 	payload["channel_id"] = c.webrtcChannelID
 	payload["session_id"] = c.webrtcSessionID
 
-	if !c.hub.sendToUser(targetUserID, outboundEnvelope{Type: eventType, Data: payload}) {
-		log.Printf("WebRTC signal delivery failed: channel=%d from=%d to=%d (target unavailable)", c.webrtcChannelID, c.userID, targetUserID)
+	if !c.hub.sendToUser(targetUserID, NewEvent(eventType, payload)) {
+		c.logger().Info("webrtc signal delivery failed: target unavailable", "channel_id", c.webrtcChannelID, "target_user_id", targetUserID)
 	}
 }
 
-func (c *Client) sendJSON(payload interface{}) {
-	bytes, err := json.Marshal(payload)
+// logger returns the structured logger tagged with the connection's user and request ID.
+func (c *Client) logger() *slog.Logger {
+	logger := slog.Default().With("user_id", c.userID)
+	if c.requestID != "" {
+		logger = logger.With("request_id", c.requestID)
+	}
+	return logger
+}
+
+func (c *Client) sendJSON(event Event) {
+	bytes, err := event.encode()
 	if err != nil {
+		c.logger().Warn("failed to encode websocket event", "type", event.Type, "error", err)
 		return
 	}
 
@@ -487,22 +953,198 @@ func (c *Client) sendJSON(payload interface{}) {
 }
 
 func (c *Client) sendError(code, message string) {
-	c.sendJSON(outboundEnvelope{
-		Type: "session.error",
-		Data: map[string]interface{}{
-			"code":    code,
-			"message": message,
-		},
-	})
+	c.sendJSON(NewEvent(EventSessionError, map[string]interface{}{
+		"code":    code,
+		"message": message,
+	}))
 }
 
 func (h *Hub) forceDisconnect(client *Client) {
 	h.mu.Lock()
-	if _, ok := h.clients[client]; ok {
+	_, registered := h.clients[client]
+	if registered {
 		delete(h.clients, client)
 		close(client.send)
 	}
 	h.mu.Unlock()
+
+	if registered {
+		h.markOffline(client)
+	}
+}
+
+// DisconnectUser closes every open connection of the user, such as after their
+// account is deleted.
+func (h *Hub) DisconnectUser(userID uint) {
+	for _, client := range h.userClients(userID) {
+		h.forceDisconnect(client)
+	}
+}
+
+// OnlineServerMemberCounts returns how many distinct users with an open connection,
+// other than invisible ones, belong to each of the given servers. It walks the connected clients once, so the
+// cost does not grow with the servers' member counts.
+func (h *Hub) OnlineServerMemberCounts(serverIDs []uint) map[uint]int {
+	online := make(map[uint]map[uint]bool, len(serverIDs))
+	for _, serverID := range serverIDs {
+		online[serverID] = make(map[uint]bool)
+	}
+
+	h.mu.RLock()
+	for client := range h.clients {
+		if h.statuses[client.userID] == models.PresenceStatusInvisible {
+			continue
+		}
+		for serverID, users := range online {
+			if client.servers[serverID] {
+				users[client.userID] = true
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	counts := make(map[uint]int, len(online))
+	for serverID, users := range online {
+		counts[serverID] = len(users)
+	}
+
+	return counts
+}
+
+// IsOnline reports whether the user has an open connection. Users inside the
+// offline grace period still count as online.
+func (h *Hub) IsOnline(userID uint) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.presence[userID] > 0 || h.offlineTimers[userID] != nil
+}
+
+// markOnline records a new connection and announces the user once their
+// first connection opens. Reconnecting inside the offline grace period
+// cancels the pending offline event instead.
+func (h *Hub) markOnline(client *Client) {
+	h.mu.Lock()
+	h.presence[client.userID]++
+	first := h.presence[client.userID] == 1
+	if timer, pending := h.offlineTimers[client.userID]; pending {
+		timer.Stop()
+		delete(h.offlineTimers, client.userID)
+		first = false
+	}
+	if first {
+		h.statuses[client.userID] = client.startStatus
+	}
+	status := h.statuses[client.userID]
+	h.mu.Unlock()
+
+	if first && status != models.PresenceStatusInvisible {
+		h.publishPresence(client.userID, client.serverIDs(), EventPresenceOnline, status)
+	}
+}
+
+// markOffline records a closed connection and schedules the offline event
+// once the user's last connection is gone.
+func (h *Hub) markOffline(client *Client) {
+	serverIDs := client.serverIDs()
+	h.closeEventLog(client.userID)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.presence[client.userID] > 1 {
+		h.presence[client.userID]--
+		return
+	}
+
+	delete(h.presence, client.userID)
+	h.noteDisconnected(client.userID)
+	userID := client.userID
+	h.offlineTimers[userID] = time.AfterFunc(presenceOfflineDelay, func() {
+		h.mu.Lock()
+		if h.presence[userID] > 0 {
+			h.mu.Unlock()
+			return
+		}
+		delete(h.offlineTimers, userID)
+		status := h.statuses[userID]
+		delete(h.statuses, userID)
+		h.mu.Unlock()
+
+		if status != models.PresenceStatusInvisible {
+			h.publishPresence(userID, serverIDs, EventPresenceOffline, models.PresenceStatusOffline)
+		}
+	})
+}
+
+// publishPresence notifies connected clients that share a server with the user.
+// status is the one other users should see.
+func (h *Hub) publishPresence(userID uint, serverIDs []uint, eventType, status string) {
+	message, err := NewEvent(eventType, map[string]interface{}{
+		"user_id":    userID,
+		"server_ids": serverIDs,
+		"status":     status,
+		"at":         time.Now().UTC().Format(time.RFC3339),
+	}).encode()
+	if err != nil {
+		return
+	}
+
+	h.mu.RLock()
+	recipients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		if client.userID == userID {
+			continue
+		}
+		if h.resolver == nil || client.sharesServer(serverIDs) {
+			recipients = append(recipients, client)
+		}
+	}
+	scoped := h.resolver != nil
+	h.mu.RUnlock()
+
+	audience := h.logAudience(func(logUserID uint, userLog *eventLog) bool {
+		if logUserID == userID {
+			return false
+		}
+		if !scoped {
+			return true
+		}
+		for _, serverID := range serverIDs {
+			if userLog.servers[serverID] {
+				return true
+			}
+		}
+		return false
+	})
+
+	if len(recipients) == 0 && len(audience) == 0 {
+		return
+	}
+
+	h.enqueue(hubMessage{payload: message, recipients: recipients, audience: audience})
+}
+
+// serverIDs returns a snapshot of the servers the client receives events for.
+func (c *Client) serverIDs() []uint {
+	c.hub.mu.RLock()
+	defer c.hub.mu.RUnlock()
+
+	ids := make([]uint, 0, len(c.servers))
+	for serverID := range c.servers {
+		ids = append(ids, serverID)
+	}
+	return ids
+}
+
+// sharesServer reports whether the client belongs to any of the servers. Callers must hold the hub lock.
+func (c *Client) sharesServer(serverIDs []uint) bool {
+	for _, serverID := range serverIDs {
+		if c.servers[serverID] {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *Hub) addParticipant(p *Participant) {
@@ -515,6 +1157,64 @@ func (h *Hub) addParticipant(p *Participant) {
 
 	clone := *p
 	h.participants[p.ChannelID][p.UserID] = &clone
+	h.releaseReservationLocked(p.ChannelID, p.UserID)
+}
+
+// ReserveParticipantSlot holds a seat in the channel for the user until the
+// reservation expires or the user authenticates their session. It reports
+// false when the channel already has limit participants and reservations.
+// A limit of zero or less means unlimited.
+func (h *Hub) ReserveParticipantSlot(channelID, userID uint, limit int, ttl time.Duration) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	occupied := 0
+	for participantUserID := range h.participants[channelID] {
+		if participantUserID != userID {
+			occupied++
+		}
+	}
+	for reservedUserID, expiresAt := range h.reservations[channelID] {
+		if now.After(expiresAt) {
+			delete(h.reservations[channelID], reservedUserID)
+			continue
+		}
+		if reservedUserID != userID {
+			occupied++
+		}
+	}
+
+	if limit > 0 && occupied >= limit {
+		return false
+	}
+
+	if _, ok := h.reservations[channelID]; !ok {
+		h.reservations[channelID] = make(map[uint]time.Time)
+	}
+	h.reservations[channelID][userID] = now.Add(ttl)
+
+	return true
+}
+
+// ReleaseParticipantSlot drops an unclaimed reservation.
+func (h *Hub) ReleaseParticipantSlot(channelID, userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.releaseReservationLocked(channelID, userID)
+}
+
+func (h *Hub) releaseReservationLocked(channelID, userID uint) {
+	channelReservations, ok := h.reservations[channelID]
+	if !ok {
+		return
+	}
+
+	delete(channelReservations, userID)
+	if len(channelReservations) == 0 {
+		delete(h.reservations, channelID)
+	}
 }
 
 func (h *Hub) removeParticipant(channelID, userID uint) *Participant {
@@ -560,6 +1260,85 @@ func (h *Hub) updateParticipantState(channelID, userID uint, state MediaState) *
 	return &clone
 }
 
+// touchParticipant refreshes a participant's LastSeen so the sweeper keeps them.
+func (h *Hub) touchParticipant(channelID, userID uint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if participant, ok := h.participants[channelID][userID]; ok {
+		participant.LastSeen = time.Now()
+	}
+}
+
+// sweepStaleParticipants periodically evicts participants whose connection
+// stopped reporting activity without a clean leave, such as half-open sockets.
+func (h *Hub) sweepStaleParticipants() {
+	h.mu.RLock()
+	timeout := h.participantTimeout
+	h.mu.RUnlock()
+
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+
+		cutoff := time.Now().Add(-timeout)
+
+		type staleParticipant struct {
+			channelID uint
+			userID    uint
+		}
+
+		h.mu.RLock()
+		var stale []staleParticipant
+		for channelID, channelParticipants := range h.participants {
+			for userID, participant := range channelParticipants {
+				if participant.LastSeen.Before(cutoff) {
+					stale = append(stale, staleParticipant{channelID: channelID, userID: userID})
+				}
+			}
+		}
+		h.mu.RUnlock()
+
+		for _, participant := range stale {
+			if removed := h.EvictParticipant(participant.channelID, participant.userID, "timeout"); removed != nil {
+				slog.Info("removed stale webrtc participant", "channel_id", removed.ChannelID, "user_id", removed.UserID, "last_seen", removed.LastSeen.Format(time.RFC3339))
+			}
+		}
+	}
+}
+
+// EvictParticipant removes a user from a channel's WebRTC session, notifies the
+// remaining participants, and tells the evicted user's connections their
+// session was terminated. It returns the removed participant, or nil if the
+// user was not in the channel.
+func (h *Hub) EvictParticipant(channelID, userID uint, reason string) *Participant {
+	removed := h.removeParticipant(channelID, userID)
+	if removed == nil {
+		return nil
+	}
+
+	h.broadcastToChannel(channelID, NewEvent(EventParticipantLeft, map[string]interface{}{
+		"user_id":    removed.UserID,
+		"channel_id": removed.ChannelID,
+		"reason":     reason,
+	}), userID)
+
+	h.publishScreenShareEnded(*removed)
+
+	h.sendToUser(userID, NewEvent(EventSessionTerminated, map[string]interface{}{
+		"channel_id": channelID,
+		"reason":     reason,
+	}))
+
+	return removed
+}
+
 // WebRTCParticipants returns the active participants for a specific channel.
 func (h *Hub) WebRTCParticipants(channelID uint) []Participant {
 	h.mu.RLock()
@@ -579,18 +1358,29 @@ func (h *Hub) WebRTCParticipants(channelID uint) []Participant {
 	return list
 }
 
-func (h *Hub) broadcastToChannel(channelID uint, payload interface{}, excludeUserID uint) {
-	message, err := json.Marshal(payload)
+// broadcastToChannel delivers a channel event to the connected members of the
+// server that owns the channel. If the server cannot be resolved while a
+// resolver is configured, the event is dropped rather than leaked.
+func (h *Hub) broadcastToChannel(channelID uint, event Event, excludeUserID uint) {
+	message, err := event.encode()
 	if err != nil {
+		slog.Warn("failed to encode websocket event", "type", event.Type, "error", err)
 		return
 	}
 
-	h.mu.RLock()
-	clients := make([]*Client, 0, len(h.clients))
-	for client := range h.clients {
-		clients = append(clients, client)
+	var clients []*Client
+	if serverID, ok := h.channelServerID(channelID); ok {
+		clients = h.serverClients(serverID)
+	} else {
+		h.mu.RLock()
+		if h.resolver == nil {
+			clients = make([]*Client, 0, len(h.clients))
+			for client := range h.clients {
+				clients = append(clients, client)
+			}
+		}
+		h.mu.RUnlock()
 	}
-	h.mu.RUnlock()
 
 	for _, client := range clients {
 		if excludeUserID != 0 && client.userID == excludeUserID {
@@ -605,9 +1395,10 @@ func (h *Hub) broadcastToChannel(channelID uint, payload interface{}, excludeUse
 	}
 }
 
-func (h *Hub) sendToUser(userID uint, payload interface{}) bool {
-	message, err := json.Marshal(payload)
+func (h *Hub) sendToUser(userID uint, event Event) bool {
+	message, err := event.encode()
 	if err != nil {
+		slog.Warn("failed to encode websocket event", "type", event.Type, "error", err)
 		return false
 	}
 
@@ -0,0 +1,149 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	serverA  = 1
+	serverB  = 2
+	channelA = 11
+)
+
+// newScopedHub returns a running hub with a member of server A (user 1), a
+// member of server B (user 2) and a user in neither (user 3).
+func newScopedHub(t *testing.T) (*Hub, *Client, *Client, *Client) {
+	t.Helper()
+
+	resolver := newFakeResolver()
+	resolver.channelServers[channelA] = serverA
+
+	hub := NewHub()
+	hub.SetMembershipResolver(resolver)
+	startHub(t, hub)
+
+	return hub, newTestClient(hub, 1, serverA), newTestClient(hub, 2, serverB), newTestClient(hub, 3)
+}
+
+func TestPublishToServerSkipsOutsiders(t *testing.T) {
+	hub, memberA, memberB, outsider := newScopedHub(t)
+
+	if err := hub.PublishToServer(serverA, NewEvent(EventEmojiCreated, map[string]any{"server_id": serverA})); err != nil {
+		t.Fatal(err)
+	}
+
+	// Run writes an event to all of its recipients at once, so by the time the
+	// member has it the others would have theirs too.
+	if event := waitForEvent(t, memberA); event.Type != EventEmojiCreated {
+		t.Fatalf("member of server A got %q, want %q", event.Type, EventEmojiCreated)
+	}
+	for _, client := range []*Client{memberB, outsider} {
+		if events := drainEvents(t, client); len(events) != 0 {
+			t.Fatalf("user %d outside server A received %+v", client.userID, events)
+		}
+	}
+}
+
+func TestBroadcastToChannelSkipsOutsiders(t *testing.T) {
+	hub, memberA, memberB, outsider := newScopedHub(t)
+
+	hub.broadcastToChannel(channelA, NewEvent(EventParticipantJoined, map[string]any{"channel_id": channelA}), 0)
+
+	if events := drainEvents(t, memberA); len(events) != 1 || events[0].Type != EventParticipantJoined {
+		t.Fatalf("member of server A got %+v, want one %s", events, EventParticipantJoined)
+	}
+	for _, client := range []*Client{memberB, outsider} {
+		if events := drainEvents(t, client); len(events) != 0 {
+			t.Fatalf("user %d outside server A received %+v", client.userID, events)
+		}
+	}
+}
+
+func TestBroadcastToUnknownChannelReachesNobody(t *testing.T) {
+	hub, memberA, memberB, outsider := newScopedHub(t)
+
+	hub.broadcastToChannel(999, NewEvent(EventParticipantJoined, map[string]any{"channel_id": 999}), 0)
+
+	for _, client := range []*Client{memberA, memberB, outsider} {
+		if events := drainEvents(t, client); len(events) != 0 {
+			t.Fatalf("user %d received %+v for a channel of no known server", client.userID, events)
+		}
+	}
+}
+
+func TestRemoveServerMemberStopsDelivery(t *testing.T) {
+	hub, memberA, _, outsider := newScopedHub(t)
+
+	hub.RemoveServerMember(serverA, memberA.userID)
+	hub.AddServerMember(serverA, outsider.userID)
+
+	if err := hub.PublishToServer(serverA, NewEvent(EventEmojiDeleted, map[string]any{"server_id": serverA})); err != nil {
+		t.Fatal(err)
+	}
+
+	if event := waitForEvent(t, outsider); event.Type != EventEmojiDeleted {
+		t.Fatalf("new member got %q, want %q", event.Type, EventEmojiDeleted)
+	}
+	if events := drainEvents(t, memberA); len(events) != 0 {
+		t.Fatalf("removed member received %+v", events)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	allowed := func(origin string) bool { return origin == "https://chat.example.com" }
+
+	tests := []struct {
+		name      string
+		validator func(string) bool
+		origin    string
+		want      bool
+	}{
+		{name: "allowed", validator: allowed, origin: "https://chat.example.com", want: true},
+		{name: "disallowed", validator: allowed, origin: "https://evil.example.com", want: false},
+		{name: "missing origin from a non-browser client", validator: allowed, origin: "", want: true},
+		{name: "no validator, other origin", validator: nil, origin: "https://evil.example.com", want: false},
+		{name: "no validator, same origin", validator: nil, origin: "https://Example.com", want: true},
+		{name: "no validator, same host on another port", validator: nil, origin: "https://example.com:8443", want: false},
+		{name: "no validator, malformed origin", validator: nil, origin: "null", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub()
+			if tt.validator != nil {
+				hub.SetOriginValidator(tt.validator)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+
+			if got := hub.checkOrigin(req); got != tt.want {
+				t.Fatalf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocketRejectsDisallowedOriginBeforeUpgrade(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hub := NewHub()
+	hub.SetOriginValidator(func(origin string) bool { return origin == "https://chat.example.com" })
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/ws", nil)
+	c.Request.Header.Set("Origin", "https://evil.example.com")
+
+	HandleWebSocket(hub, nil, c)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"log/slog"
+	"time"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// lastSeenFlushInterval is how often connected users' last-seen times are
+	// written, so each user is written at most once per interval.
+	lastSeenFlushInterval = time.Minute
+
+	lastSeenBatchSize = 500
+)
+
+// LastSeenRecorder persists when users were last connected.
+type LastSeenRecorder interface {
+	// RecordLastSeen stores the given last-seen time for each user.
+	RecordLastSeen(seen map[uint]time.Time) error
+}
+
+type dbLastSeenRecorder struct {
+	db *gorm.DB
+}
+
+// NewDBLastSeenRecorder writes last-seen times to users.last_seen_at.
+func NewDBLastSeenRecorder(db *gorm.DB) LastSeenRecorder {
+	return &dbLastSeenRecorder{db: db}
+}
+
+// RecordLastSeen groups users by timestamp so every user still connected at a
+// flush is written in one statement per batch.
+func (r *dbLastSeenRecorder) RecordLastSeen(seen map[uint]time.Time) error {
+	byTime := make(map[time.Time][]uint)
+	for userID, at := range seen {
+		byTime[at] = append(byTime[at], userID)
+	}
+
+	for at, userIDs := range byTime {
+		for start := 0; start < len(userIDs); start += lastSeenBatchSize {
+			end := min(start+lastSeenBatchSize, len(userIDs))
+			if err := r.db.Model(&models.User{}).
+				Where("id IN ?", userIDs[start:end]).
+				UpdateColumn("last_seen_at", at).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetLastSeenRecorder enables persisting last-seen times. Without a recorder
+// presence is only tracked in memory. It must be called before Run.
+func (h *Hub) SetLastSeenRecorder(recorder LastSeenRecorder) {
+	h.mu.Lock()
+	h.lastSeen = recorder
+	h.mu.Unlock()
+}
+
+// noteDisconnected remembers when a user's last connection closed so the next
+// flush records it, unless they were invisible. The caller must hold h.mu.
+func (h *Hub) noteDisconnected(userID uint) {
+	if h.lastSeen == nil || h.statuses[userID] == models.PresenceStatusInvisible {
+		return
+	}
+
+	h.lastSeenPending[userID] = time.Now()
+}
+
+// recordLastSeen periodically flushes last-seen times until the hub stops.
+func (h *Hub) recordLastSeen() {
+	ticker := time.NewTicker(lastSeenFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+
+		h.flushLastSeen()
+	}
+}
+
+// flushLastSeen writes the current time for every connected user who is not
+// invisible and the disconnect time for users who left since the last flush.
+func (h *Hub) flushLastSeen() {
+	now := time.Now()
+
+	h.mu.Lock()
+	recorder := h.lastSeen
+	seen := h.lastSeenPending
+	h.lastSeenPending = make(map[uint]time.Time)
+	if recorder != nil {
+		for userID := range h.presence {
+			// Invisible users must not reveal they are active.
+			if h.statuses[userID] != models.PresenceStatusInvisible {
+				seen[userID] = now
+			}
+		}
+	}
+	h.mu.Unlock()
+
+	if recorder == nil || len(seen) == 0 {
+		return
+	}
+
+	if err := recorder.RecordLastSeen(seen); err != nil {
+		slog.Warn("failed to record last seen times", "users", len(seen), "error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Media track states a participant may report.
+const (
+	MediaOn    = "on"
+	MediaOff   = "off"
+	MediaMuted = "muted"
+)
+
+var (
+	errVideoDisabled      = errors.New("camera and screen sharing are disabled on this server")
+	errScreenUnavailable  = errors.New("someone is already sharing their screen in this channel")
+	errParticipantMissing = errors.New("participant not registered")
+)
+
+// SetAudioOnly makes the hub reject participant updates that turn a camera or
+// screen share on.
+func (h *Hub) SetAudioOnly(audioOnly bool) {
+	h.mu.Lock()
+	h.audioOnly = audioOnly
+	h.mu.Unlock()
+}
+
+// validateMediaState checks that every track reports a known state and that
+// video stays off when the deployment is audio only.
+func (h *Hub) validateMediaState(state MediaState) error {
+	tracks := []struct {
+		name  string
+		value string
+	}{
+		{"mic", state.Mic},
+		{"camera", state.Camera},
+		{"screen", state.Screen},
+	}
+	for _, track := range tracks {
+		switch track.value {
+		case MediaOn, MediaOff, MediaMuted:
+		default:
+			return fmt.Errorf("%s must be one of %q, %q or %q", track.name, MediaOn, MediaOff, MediaMuted)
+		}
+	}
+
+	h.mu.RLock()
+	audioOnly := h.audioOnly
+	h.mu.RUnlock()
+
+	if audioOnly && (state.Camera == MediaOn || state.Screen == MediaOn) {
+		return errVideoDisabled
+	}
+
+	return nil
+}
+
+// SetSingleScreenShare limits each channel to one active screen share.
+func (h *Hub) SetSingleScreenShare(single bool) {
+	h.mu.Lock()
+	h.singleScreenShare = single
+	h.mu.Unlock()
+}
+
+// ScreenSharers returns the IDs of the users sharing their screen in a channel,
+// in ascending order.
+func (h *Hub) ScreenSharers(channelID uint) []uint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	sharers := make([]uint, 0)
+	for userID, participant := range h.participants[channelID] {
+		if participant.MediaState.Screen == MediaOn {
+			sharers = append(sharers, userID)
+		}
+	}
+	slices.Sort(sharers)
+
+	return sharers
+}
+
+// applyParticipantMedia stores a participant's new media state and returns the
+// updated participant with the state it replaced. When only one screen share is
+// allowed, turning the screen on while someone else shares fails with
+// errScreenUnavailable.
+func (h *Hub) applyParticipantMedia(channelID, userID uint, state MediaState) (*Participant, MediaState, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	channelParticipants := h.participants[channelID]
+	participant, ok := channelParticipants[userID]
+	if !ok {
+		return nil, MediaState{}, errParticipantMissing
+	}
+
+	previous := participant.MediaState
+	if h.singleScreenShare && state.Screen == MediaOn && previous.Screen != MediaOn {
+		for otherID, other := range channelParticipants {
+			if otherID != userID && other.MediaState.Screen == MediaOn {
+				return nil, previous, errScreenUnavailable
+			}
+		}
+	}
+
+	participant.MediaState = state
+	participant.LastSeen = time.Now()
+	clone := *participant
+	return &clone, previous, nil
+}
+
+// publishScreenShareChange tells the channel when a participant starts or stops
+// sharing their screen, so clients can pin or unpin the shared view.
+func (h *Hub) publishScreenShareChange(participant Participant, previousScreen string) {
+	sharing := participant.MediaState.Screen == MediaOn
+	if sharing == (previousScreen == MediaOn) {
+		return
+	}
+
+	eventType := EventScreenShareStopped
+	if sharing {
+		eventType = EventScreenShareStarted
+	}
+
+	h.broadcastToChannel(participant.ChannelID, NewEvent(eventType, map[string]interface{}{
+		"user_id":        participant.UserID,
+		"channel_id":     participant.ChannelID,
+		"session_id":     participant.SessionID,
+		"screen_sharers": h.ScreenSharers(participant.ChannelID),
+	}), 0)
+}
+
+// publishScreenShareEnded sends screenshare.stopped for a participant who left
+// the channel while sharing.
+func (h *Hub) publishScreenShareEnded(removed Participant) {
+	previous := removed.MediaState.Screen
+	removed.MediaState.Screen = MediaOff
+	h.publishScreenShareChange(removed, previous)
+}
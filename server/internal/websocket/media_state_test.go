@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestValidateMediaState(t *testing.T) {
+	tests := []struct {
+		name      string
+		audioOnly bool
+		state     MediaState
+		wantErr   bool
+	}{
+		{name: "all off", state: MediaState{Mic: MediaOff, Camera: MediaOff, Screen: MediaOff}},
+		{name: "muted mic with camera", state: MediaState{Mic: MediaMuted, Camera: MediaOn, Screen: MediaOff}},
+		{name: "unknown state", state: MediaState{Mic: "loud", Camera: MediaOff, Screen: MediaOff}, wantErr: true},
+		{name: "missing track", state: MediaState{Mic: MediaOn, Camera: MediaOff}, wantErr: true},
+		{name: "audio only allows the mic", audioOnly: true, state: MediaState{Mic: MediaOn, Camera: MediaOff, Screen: MediaMuted}},
+		{name: "audio only rejects the camera", audioOnly: true, state: MediaState{Mic: MediaOn, Camera: MediaOn, Screen: MediaOff}, wantErr: true},
+		{name: "audio only rejects screen sharing", audioOnly: true, state: MediaState{Mic: MediaOff, Camera: MediaOff, Screen: MediaOn}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub()
+			hub.SetAudioOnly(tt.audioOnly)
+
+			err := hub.validateMediaState(tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validateMediaState(%+v) = %v, want error %v", tt.state, err, tt.wantErr)
+			}
+			if tt.audioOnly && tt.wantErr && !errors.Is(err, errVideoDisabled) {
+				t.Fatalf("validateMediaState(%+v) = %v, want errVideoDisabled", tt.state, err)
+			}
+		})
+	}
+}
+
+func TestParticipantUpdateRejectsInvalidMediaState(t *testing.T) {
+	hub, _, _, member := newCallHub(t)
+
+	member.handleParticipantUpdate(mediaPayload(t, MediaState{Mic: "sideways", Camera: MediaOff, Screen: MediaOff}))
+
+	if codes := sessionErrorCodes(t, drainEvents(t, member)); !slices.Equal(codes, []string{"participant.invalid"}) {
+		t.Fatalf("error codes = %v, want [participant.invalid]", codes)
+	}
+	if mic := participantMic(hub, 2); mic != MediaOn {
+		t.Fatalf("mic = %q after a rejected update, want %q", mic, MediaOn)
+	}
+}
+
+func TestParticipantUpdateBroadcastsNewState(t *testing.T) {
+	hub, _, moderator, member := newCallHub(t)
+
+	member.handleParticipantUpdate(mediaPayload(t, MediaState{Mic: MediaMuted, Camera: MediaOff, Screen: MediaOff}))
+
+	if mic := participantMic(hub, 2); mic != MediaMuted {
+		t.Fatalf("mic = %q, want %q", mic, MediaMuted)
+	}
+
+	events := drainEvents(t, moderator)
+	if len(events) != 1 || events[0].Type != EventParticipantUpdated {
+		t.Fatalf("events = %+v, want one %s", events, EventParticipantUpdated)
+	}
+	var data struct {
+		UserID     uint       `json:"user_id"`
+		MediaState MediaState `json:"media_state"`
+	}
+	if err := json.Unmarshal(events[0].Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.UserID != 2 || data.MediaState.Mic != MediaMuted {
+		t.Fatalf("participant.updated = %+v, want user 2 muted", data)
+	}
+}
+
+func TestSingleScreenShare(t *testing.T) {
+	hub, _, moderator, member := newCallHub(t)
+	hub.SetSingleScreenShare(true)
+
+	sharing := MediaState{Mic: MediaOn, Camera: MediaOff, Screen: MediaOn}
+	stopped := MediaState{Mic: MediaOn, Camera: MediaOff, Screen: MediaOff}
+
+	moderator.handleParticipantUpdate(mediaPayload(t, sharing))
+	if got := hub.ScreenSharers(testChannelID); !slices.Equal(got, []uint{1}) {
+		t.Fatalf("ScreenSharers = %v, want [1]", got)
+	}
+	started := eventsOfType(drainEvents(t, member), EventScreenShareStarted)
+	if len(started) != 1 || !slices.Equal(screenSharers(t, started[0]), []uint{1}) {
+		t.Fatalf("screenshare.started events = %+v, want one listing user 1", started)
+	}
+	drainEvents(t, moderator)
+
+	// A second sharer is turned away while the first is still sharing.
+	member.handleParticipantUpdate(mediaPayload(t, sharing))
+	if codes := sessionErrorCodes(t, drainEvents(t, member)); !slices.Equal(codes, []string{"screen.unavailable"}) {
+		t.Fatalf("error codes = %v, want [screen.unavailable]", codes)
+	}
+	if got := hub.ScreenSharers(testChannelID); !slices.Equal(got, []uint{1}) {
+		t.Fatalf("ScreenSharers = %v after a rejected share, want [1]", got)
+	}
+
+	moderator.handleParticipantUpdate(mediaPayload(t, stopped))
+	stoppedEvents := eventsOfType(drainEvents(t, member), EventScreenShareStopped)
+	if len(stoppedEvents) != 1 || len(screenSharers(t, stoppedEvents[0])) != 0 {
+		t.Fatalf("screenshare.stopped events = %+v, want one with no sharers left", stoppedEvents)
+	}
+
+	member.handleParticipantUpdate(mediaPayload(t, sharing))
+	if got := hub.ScreenSharers(testChannelID); !slices.Equal(got, []uint{2}) {
+		t.Fatalf("ScreenSharers = %v, want [2]", got)
+	}
+}
+
+func TestMultipleScreenSharesWhenAllowed(t *testing.T) {
+	hub, _, moderator, member := newCallHub(t)
+
+	sharing := MediaState{Mic: MediaOn, Camera: MediaOff, Screen: MediaOn}
+	moderator.handleParticipantUpdate(mediaPayload(t, sharing))
+	member.handleParticipantUpdate(mediaPayload(t, sharing))
+
+	if got := hub.ScreenSharers(testChannelID); !slices.Equal(got, []uint{1, 2}) {
+		t.Fatalf("ScreenSharers = %v, want [1 2]", got)
+	}
+}
+
+func TestLeavingWhileSharingStopsScreenShare(t *testing.T) {
+	hub, _, _, member := newCallHub(t)
+
+	removed := Participant{UserID: 1, ChannelID: testChannelID, MediaState: MediaState{Mic: MediaOn, Camera: MediaOff, Screen: MediaOn}}
+	hub.publishScreenShareEnded(removed)
+
+	stopped := eventsOfType(drainEvents(t, member), EventScreenShareStopped)
+	if len(stopped) != 1 {
+		t.Fatalf("screenshare.stopped events = %+v, want one", stopped)
+	}
+
+	// Someone who was not sharing leaves quietly.
+	removed.MediaState.Screen = MediaOff
+	hub.publishScreenShareEnded(removed)
+	if events := drainEvents(t, member); len(events) != 0 {
+		t.Fatalf("events = %+v, want none", events)
+	}
+}
+
+func eventsOfType(events []Event, eventType string) []Event {
+	var matched []Event
+	for _, event := range events {
+		if event.Type == eventType {
+			matched = append(matched, event)
+		}
+	}
+	return matched
+}
+
+func screenSharers(t *testing.T, event Event) []uint {
+	t.Helper()
+	var data struct {
+		ScreenSharers []uint `json:"screen_sharers"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	return data.ScreenSharers
+}
+
+func mediaPayload(t *testing.T, state MediaState) json.RawMessage {
+	t.Helper()
+	raw, err := json.Marshal(map[string]MediaState{"media_state": state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MembershipResolver supplies the server membership data the hub uses to
+// scope events to the clients allowed to see them.
+type MembershipResolver interface {
+	// ServerIDsForUser returns the servers the user is an active member of.
+	ServerIDsForUser(userID uint) ([]uint, error)
+	// ServerIDForChannel returns the server that owns the channel.
+	ServerIDForChannel(channelID uint) (uint, error)
+	// ChannelMemberRole returns the user's current role in the server that owns
+	// the channel, or "" if they are not an active member.
+	ChannelMemberRole(channelID, userID uint) (string, error)
+}
+
+type dbMembershipResolver struct {
+	db *gorm.DB
+}
+
+// NewDBMembershipResolver resolves membership from the server_members and channels tables.
+func NewDBMembershipResolver(db *gorm.DB) MembershipResolver {
+	return &dbMembershipResolver{db: db}
+}
+
+func (r *dbMembershipResolver) ServerIDsForUser(userID uint) ([]uint, error) {
+	var serverIDs []uint
+	err := r.db.Model(&models.ServerMember{}).
+		Where("user_id = ? AND role <> ?", userID, models.ServerRolePending).
+		Pluck("server_id", &serverIDs).Error
+	return serverIDs, err
+}
+
+func (r *dbMembershipResolver) ChannelMemberRole(channelID, userID uint) (string, error) {
+	var roles []string
+	err := r.db.Model(&models.ServerMember{}).
+		Joins("JOIN channels ON channels.server_id = server_members.server_id").
+		Where("channels.id = ? AND server_members.user_id = ? AND server_members.role <> ?", channelID, userID, models.ServerRolePending).
+		Limit(1).
+		Pluck("server_members.role", &roles).Error
+	if err != nil || len(roles) == 0 {
+		return "", err
+	}
+	return roles[0], nil
+}
+
+func (r *dbMembershipResolver) ServerIDForChannel(channelID uint) (uint, error) {
+	var channel models.Channel
+	if err := r.db.Select("id", "server_id").First(&channel, channelID).Error; err != nil {
+		return 0, err
+	}
+	return channel.ServerID, nil
+}
@@ -0,0 +1,163 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log/slog"
+
+	"bafachat/internal/models"
+)
+
+// canModerateParticipant mirrors the server moderation rules for voice
+// sessions: owners and admins may act on members, only owners may act on
+// admins, and nobody may act on the owner.
+func canModerateParticipant(actorRole, targetRole string) bool {
+	switch actorRole {
+	case models.ServerRoleOwner, models.ServerRoleAdmin:
+	default:
+		return false
+	}
+
+	switch targetRole {
+	case models.ServerRoleOwner:
+		return false
+	case models.ServerRoleAdmin:
+		return actorRole == models.ServerRoleOwner
+	default:
+		return true
+	}
+}
+
+// moderationTarget validates a moderator command and returns the target
+// participant in the sender's channel. Both roles are looked up again for every
+// command, so someone demoted mid-call loses their moderation rights at once.
+func (c *Client) moderationTarget(raw json.RawMessage) (*Participant, bool) {
+	if !c.webrtcActive {
+		c.sendError("session.required", "webrtc session not active")
+		return nil, false
+	}
+
+	var payload struct {
+		TargetUserID uint `json:"target_user_id"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil || payload.TargetUserID == 0 {
+		c.sendError("moderation.invalid", "invalid target user")
+		return nil, false
+	}
+
+	if payload.TargetUserID == c.userID {
+		c.sendError("moderation.invalid", "you cannot moderate yourself")
+		return nil, false
+	}
+
+	sender, target := c.hub.channelParticipantPair(c.webrtcChannelID, c.userID, payload.TargetUserID)
+	if sender == nil {
+		c.sendError("participant.missing", "participant not registered")
+		return nil, false
+	}
+	if target == nil {
+		c.sendError("moderation.target_missing", "target is not in this channel")
+		return nil, false
+	}
+
+	senderRole, err := c.hub.currentParticipantRole(*sender)
+	if err != nil {
+		slog.Warn("moderation role lookup failed", "user_id", c.userID, "channel_id", c.webrtcChannelID, "error", err)
+		c.sendError("moderation.unavailable", "could not verify your role, try again")
+		return nil, false
+	}
+	targetRole, err := c.hub.currentParticipantRole(*target)
+	if err != nil {
+		slog.Warn("moderation role lookup failed", "user_id", target.UserID, "channel_id", target.ChannelID, "error", err)
+		c.sendError("moderation.unavailable", "could not verify the target's role, try again")
+		return nil, false
+	}
+
+	if !canModerateParticipant(senderRole, targetRole) {
+		c.sendError("moderation.forbidden", "you do not have permission to moderate this participant")
+		return nil, false
+	}
+
+	return target, true
+}
+
+func (c *Client) handleForceMute(raw json.RawMessage) {
+	target, ok := c.moderationTarget(raw)
+	if !ok {
+		return
+	}
+
+	state := target.MediaState
+	state.Mic = MediaOff
+
+	participant := c.hub.updateParticipantState(target.ChannelID, target.UserID, state)
+	if participant == nil {
+		c.sendError("moderation.target_missing", "target is not in this channel")
+		return
+	}
+
+	c.hub.broadcastToChannel(participant.ChannelID, NewEvent(EventParticipantUpdated, map[string]interface{}{
+		"user_id":     participant.UserID,
+		"channel_id":  participant.ChannelID,
+		"media_state": participant.MediaState,
+		"session_id":  participant.SessionID,
+		"forced_by":   c.userID,
+	}), 0)
+}
+
+func (c *Client) handleForceDisconnect(raw json.RawMessage) {
+	target, ok := c.moderationTarget(raw)
+	if !ok {
+		return
+	}
+
+	removed := c.hub.EvictParticipant(target.ChannelID, target.UserID, "kicked")
+	if removed != nil && c.webrtcManager != nil && removed.SessionToken != "" {
+		c.webrtcManager.Revoke(removed.SessionToken)
+	}
+}
+
+// currentParticipantRole returns the participant's role in the channel's server
+// as it is now, storing it on the participant. Without a membership resolver the
+// role from their session token is used.
+func (h *Hub) currentParticipantRole(participant Participant) (string, error) {
+	h.mu.RLock()
+	resolver := h.resolver
+	h.mu.RUnlock()
+
+	if resolver == nil {
+		return participant.Role, nil
+	}
+
+	role, err := resolver.ChannelMemberRole(participant.ChannelID, participant.UserID)
+	if err != nil {
+		return "", err
+	}
+
+	if role != participant.Role {
+		h.mu.Lock()
+		if stored, ok := h.participants[participant.ChannelID][participant.UserID]; ok {
+			stored.Role = role
+		}
+		h.mu.Unlock()
+	}
+
+	return role, nil
+}
+
+// channelParticipantPair returns copies of two participants in the same channel.
+func (h *Hub) channelParticipantPair(channelID, firstUserID, secondUserID uint) (*Participant, *Participant) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var first, second *Participant
+	if participant, ok := h.participants[channelID][firstUserID]; ok {
+		clone := *participant
+		first = &clone
+	}
+	if participant, ok := h.participants[channelID][secondUserID]; ok {
+		clone := *participant
+		second = &clone
+	}
+
+	return first, second
+}
@@ -0,0 +1,199 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"bafachat/internal/models"
+	"bafachat/internal/webrtc"
+)
+
+const (
+	testServerID  = 10
+	testChannelID = 100
+)
+
+// newCallHub returns a hub with a moderator (user 1) and a member (user 2) in a
+// voice call, both joined while user 1 was an admin.
+func newCallHub(t *testing.T) (*Hub, *fakeResolver, *Client, *Client) {
+	t.Helper()
+
+	resolver := newFakeResolver()
+	resolver.channelServers[testChannelID] = testServerID
+	resolver.setRole(testServerID, 1, models.ServerRoleAdmin)
+	resolver.setRole(testServerID, 2, models.ServerRoleMember)
+
+	hub := NewHub()
+	hub.SetMembershipResolver(resolver)
+
+	moderator := newTestClient(hub, 1, testServerID)
+	member := newTestClient(hub, 2, testServerID)
+	for _, client := range []*Client{moderator, member} {
+		client.webrtcActive = true
+		client.webrtcChannelID = testChannelID
+	}
+
+	hub.addParticipant(&Participant{UserID: 1, ChannelID: testChannelID, Role: models.ServerRoleAdmin, MediaState: MediaState{Mic: MediaOn}})
+	hub.addParticipant(&Participant{UserID: 2, ChannelID: testChannelID, Role: models.ServerRoleMember, MediaState: MediaState{Mic: MediaOn}})
+
+	return hub, resolver, moderator, member
+}
+
+func targetPayload(t *testing.T, userID uint) json.RawMessage {
+	t.Helper()
+	raw, err := json.Marshal(map[string]uint{"target_user_id": userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func participantMic(hub *Hub, userID uint) string {
+	_, participant := hub.channelParticipantPair(testChannelID, 0, userID)
+	if participant == nil {
+		return ""
+	}
+	return participant.MediaState.Mic
+}
+
+func TestForceMuteUsesCurrentRole(t *testing.T) {
+	hub, _, moderator, _ := newCallHub(t)
+
+	moderator.handleForceMute(targetPayload(t, 2))
+
+	if codes := sessionErrorCodes(t, drainEvents(t, moderator)); len(codes) != 0 {
+		t.Fatalf("admin got errors %v", codes)
+	}
+	if mic := participantMic(hub, 2); mic != MediaOff {
+		t.Fatalf("target mic = %q, want %q", mic, MediaOff)
+	}
+}
+
+func TestForceMuteRejectedAfterDemotion(t *testing.T) {
+	hub, resolver, moderator, _ := newCallHub(t)
+	resolver.setRole(testServerID, 1, models.ServerRoleMember)
+
+	moderator.handleForceMute(targetPayload(t, 2))
+
+	if codes := sessionErrorCodes(t, drainEvents(t, moderator)); !slices.Equal(codes, []string{"moderation.forbidden"}) {
+		t.Fatalf("error codes = %v, want [moderation.forbidden]", codes)
+	}
+	if mic := participantMic(hub, 2); mic != MediaOn {
+		t.Fatalf("target mic = %q, want it left %q", mic, MediaOn)
+	}
+
+	sender, _ := hub.channelParticipantPair(testChannelID, 1, 0)
+	if sender.Role != models.ServerRoleMember {
+		t.Fatalf("stored sender role = %q, want it refreshed to %q", sender.Role, models.ServerRoleMember)
+	}
+}
+
+func TestForceDisconnectRejectedAfterDemotion(t *testing.T) {
+	hub, resolver, moderator, _ := newCallHub(t)
+	resolver.setRole(testServerID, 1, models.ServerRoleMember)
+
+	moderator.handleForceDisconnect(targetPayload(t, 2))
+
+	if codes := sessionErrorCodes(t, drainEvents(t, moderator)); !slices.Equal(codes, []string{"moderation.forbidden"}) {
+		t.Fatalf("error codes = %v, want [moderation.forbidden]", codes)
+	}
+	if _, target := hub.channelParticipantPair(testChannelID, 0, 2); target == nil {
+		t.Fatal("target was disconnected by a demoted moderator")
+	}
+}
+
+func TestModerationRefusedWhenRoleLookupFails(t *testing.T) {
+	hub, resolver, moderator, _ := newCallHub(t)
+	resolver.err = errors.New("database down")
+
+	moderator.handleForceMute(targetPayload(t, 2))
+
+	if codes := sessionErrorCodes(t, drainEvents(t, moderator)); !slices.Equal(codes, []string{"moderation.unavailable"}) {
+		t.Fatalf("error codes = %v, want [moderation.unavailable]", codes)
+	}
+	if mic := participantMic(hub, 2); mic != MediaOn {
+		t.Fatalf("target mic = %q, want it left %q", mic, MediaOn)
+	}
+}
+
+func TestSessionRenewRefreshesRole(t *testing.T) {
+	hub, resolver, moderator, _ := newCallHub(t)
+
+	manager := webrtc.NewManager(time.Minute)
+	session, err := manager.Issue(1, testChannelID, "mod", models.ServerRoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator.webrtcManager = manager
+	moderator.webrtcToken = session.Token
+
+	resolver.setRole(testServerID, 1, models.ServerRoleMember)
+	moderator.handleSessionRenew()
+
+	events := drainEvents(t, moderator)
+	if len(events) != 1 || events[0].Type != EventSessionRenewed {
+		t.Fatalf("events = %+v, want one %s", events, EventSessionRenewed)
+	}
+
+	renewed, err := manager.Validate(session.Token, 1, testChannelID)
+	if err != nil {
+		t.Fatalf("Validate after renew: %v", err)
+	}
+	if renewed.Role != models.ServerRoleMember {
+		t.Fatalf("renewed token role = %q, want %q", renewed.Role, models.ServerRoleMember)
+	}
+	if sender, _ := hub.channelParticipantPair(testChannelID, 1, 0); sender.Role != models.ServerRoleMember {
+		t.Fatalf("participant role = %q, want %q", sender.Role, models.ServerRoleMember)
+	}
+}
+
+func TestSessionRenewEvictsFormerMember(t *testing.T) {
+	hub, resolver, moderator, _ := newCallHub(t)
+
+	manager := webrtc.NewManager(time.Minute)
+	session, err := manager.Issue(1, testChannelID, "mod", models.ServerRoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	moderator.webrtcManager = manager
+	moderator.webrtcToken = session.Token
+
+	resolver.setRole(testServerID, 1, "")
+	moderator.handleSessionRenew()
+
+	if _, err := manager.Validate(session.Token, 1, testChannelID); !errors.Is(err, webrtc.ErrTokenNotFound) {
+		t.Fatalf("Validate after renew = %v, want ErrTokenNotFound", err)
+	}
+	if sender, _ := hub.channelParticipantPair(testChannelID, 1, 0); sender != nil {
+		t.Fatal("former member is still in the call")
+	}
+
+	events := drainEvents(t, moderator)
+	if !slices.ContainsFunc(events, func(e Event) bool { return e.Type == EventSessionTerminated }) {
+		t.Fatalf("events = %+v, want %s", events, EventSessionTerminated)
+	}
+}
+
+func TestCanModerateParticipant(t *testing.T) {
+	tests := []struct {
+		actor, target string
+		want          bool
+	}{
+		{models.ServerRoleOwner, models.ServerRoleAdmin, true},
+		{models.ServerRoleOwner, models.ServerRoleMember, true},
+		{models.ServerRoleAdmin, models.ServerRoleMember, true},
+		{models.ServerRoleAdmin, models.ServerRoleAdmin, false},
+		{models.ServerRoleAdmin, models.ServerRoleOwner, false},
+		{models.ServerRoleMember, models.ServerRoleMember, false},
+		{"", models.ServerRoleMember, false},
+	}
+
+	for _, tt := range tests {
+		if got := canModerateParticipant(tt.actor, tt.target); got != tt.want {
+			t.Errorf("canModerateParticipant(%q, %q) = %v, want %v", tt.actor, tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"bafachat/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PresenceStatusStore persists the status each user last chose so it can be
+// restored when they reconnect.
+type PresenceStatusStore interface {
+	// LoadPresenceStatus returns the user's saved status, or "" if none.
+	LoadPresenceStatus(userID uint) (string, error)
+	// SavePresenceStatus stores the status the user chose.
+	SavePresenceStatus(userID uint, status string) error
+}
+
+type dbPresenceStatusStore struct {
+	db *gorm.DB
+}
+
+// NewDBPresenceStatusStore keeps presence statuses in users.presence_status.
+func NewDBPresenceStatusStore(db *gorm.DB) PresenceStatusStore {
+	return &dbPresenceStatusStore{db: db}
+}
+
+func (s *dbPresenceStatusStore) LoadPresenceStatus(userID uint) (string, error) {
+	var user models.User
+	if err := s.db.Select("id", "presence_status").First(&user, userID).Error; err != nil {
+		return "", err
+	}
+	return user.PresenceStatus, nil
+}
+
+func (s *dbPresenceStatusStore) SavePresenceStatus(userID uint, status string) error {
+	return s.db.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("presence_status", status).Error
+}
+
+// SetPresenceStatusStore enables saving and restoring chosen statuses. Without
+// a store every connection starts online. It must be called before Run.
+func (h *Hub) SetPresenceStatusStore(store PresenceStatusStore) {
+	h.mu.Lock()
+	h.statusStore = store
+	h.mu.Unlock()
+}
+
+// isPresenceStatus reports whether status is one a user may choose.
+func isPresenceStatus(status string) bool {
+	switch status {
+	case models.PresenceStatusOnline, models.PresenceStatusAway, models.PresenceStatusDND, models.PresenceStatusInvisible:
+		return true
+	}
+	return false
+}
+
+// visibleStatus is the status other users are shown for a chosen status.
+func visibleStatus(status string) string {
+	if status == models.PresenceStatusInvisible {
+		return models.PresenceStatusOffline
+	}
+	return status
+}
+
+// loadPresenceStatus returns the status a new connection starts with.
+func (h *Hub) loadPresenceStatus(userID uint) string {
+	h.mu.RLock()
+	store := h.statusStore
+	h.mu.RUnlock()
+
+	if store == nil {
+		return models.PresenceStatusOnline
+	}
+
+	status, err := store.LoadPresenceStatus(userID)
+	if err != nil || !isPresenceStatus(status) {
+		return models.PresenceStatusOnline
+	}
+
+	return status
+}
+
+// PresenceStatus returns the status other users should see for the user:
+// offline when they have no open connection or have chosen to be invisible.
+func (h *Hub) PresenceStatus(userID uint) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.presence[userID] == 0 && h.offlineTimers[userID] == nil {
+		return models.PresenceStatusOffline
+	}
+
+	return visibleStatus(h.statuses[userID])
+}
+
+// handlePresenceUpdate applies a presence.update message. Other users in the
+// user's servers get presence.updated with the visible status; the user's own
+// connections get the chosen one.
+func (c *Client) handlePresenceUpdate(raw json.RawMessage) {
+	var payload struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		c.sendError("presence.invalid", "invalid presence payload")
+		return
+	}
+
+	status := strings.ToLower(strings.TrimSpace(payload.Status))
+	if !isPresenceStatus(status) {
+		c.sendError("presence.invalid", "status must be online, away, dnd or invisible")
+		return
+	}
+
+	h := c.hub
+	h.mu.Lock()
+	previous := h.statuses[c.userID]
+	h.statuses[c.userID] = status
+	store := h.statusStore
+	h.mu.Unlock()
+
+	if store != nil {
+		if err := store.SavePresenceStatus(c.userID, status); err != nil {
+			c.logger().Warn("failed to save presence status", "status", status, "error", err)
+		}
+	}
+
+	if previous == status {
+		return
+	}
+
+	serverIDs := c.serverIDs()
+	if visibleStatus(previous) != visibleStatus(status) {
+		h.publishPresence(c.userID, serverIDs, EventPresenceUpdated, visibleStatus(status))
+	}
+
+	_ = h.PublishToUser(c.userID, NewEvent(EventPresenceUpdated, map[string]interface{}{
+		"user_id":    c.userID,
+		"server_ids": serverIDs,
+		"status":     status,
+		"at":         time.Now().UTC().Format(time.RFC3339),
+	}))
+}
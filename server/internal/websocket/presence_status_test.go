@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"bafachat/internal/models"
+)
+
+// fakeStatusStore is an in-memory PresenceStatusStore.
+type fakeStatusStore struct {
+	mu       sync.Mutex
+	statuses map[uint]string
+	err      error
+}
+
+func (s *fakeStatusStore) LoadPresenceStatus(userID uint) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.statuses[userID], s.err
+}
+
+func (s *fakeStatusStore) SavePresenceStatus(userID uint, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[userID] = status
+	return s.err
+}
+
+func presencePayload(t *testing.T, status string) json.RawMessage {
+	t.Helper()
+	raw, err := json.Marshal(map[string]string{"status": status})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func presenceStatusOf(t *testing.T, event Event) string {
+	t.Helper()
+	if event.Type != EventPresenceUpdated {
+		t.Fatalf("event type = %q, want %q", event.Type, EventPresenceUpdated)
+	}
+	var data struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(event.Data, &data); err != nil {
+		t.Fatalf("decode presence.updated: %v", err)
+	}
+	return data.Status
+}
+
+func TestPresenceUpdateRejectsUnknownStatus(t *testing.T) {
+	hub := NewHub()
+	client := newTestClient(hub, 1, serverA)
+
+	for _, raw := range []json.RawMessage{presencePayload(t, "busy"), presencePayload(t, "offline"), json.RawMessage(`"away"`)} {
+		client.handlePresenceUpdate(raw)
+		if codes := sessionErrorCodes(t, drainEvents(t, client)); len(codes) != 1 || codes[0] != "presence.invalid" {
+			t.Fatalf("presence.update %s errors = %v, want [presence.invalid]", raw, codes)
+		}
+	}
+}
+
+func TestPresenceUpdateInvisibleAppearsOffline(t *testing.T) {
+	hub, memberA, memberB, _ := newScopedHub(t)
+	store := &fakeStatusStore{statuses: map[uint]string{}}
+	hub.SetPresenceStatusStore(store)
+	peer := newTestClient(hub, 4, serverA)
+
+	memberA.handlePresenceUpdate(presencePayload(t, " Invisible "))
+
+	if got := presenceStatusOf(t, waitForEvent(t, peer)); got != models.PresenceStatusOffline {
+		t.Fatalf("peer saw status %q, want %q", got, models.PresenceStatusOffline)
+	}
+	if got := presenceStatusOf(t, waitForEvent(t, memberA)); got != models.PresenceStatusInvisible {
+		t.Fatalf("own connection saw status %q, want %q", got, models.PresenceStatusInvisible)
+	}
+	if events := drainEvents(t, memberB); len(events) != 0 {
+		t.Fatalf("user outside server A received %+v", events)
+	}
+
+	store.mu.Lock()
+	saved := store.statuses[memberA.userID]
+	store.mu.Unlock()
+	if saved != models.PresenceStatusInvisible {
+		t.Fatalf("saved status = %q, want %q", saved, models.PresenceStatusInvisible)
+	}
+}
+
+func TestPresenceUpdateSameStatusIsQuiet(t *testing.T) {
+	hub, memberA, _, _ := newScopedHub(t)
+	peer := newTestClient(hub, 4, serverA)
+
+	memberA.handlePresenceUpdate(presencePayload(t, models.PresenceStatusAway))
+	waitForEvent(t, peer)
+	waitForEvent(t, memberA)
+
+	memberA.handlePresenceUpdate(presencePayload(t, models.PresenceStatusAway))
+	hub.broadcastToChannel(channelA, NewEvent(EventParticipantJoined, map[string]any{"channel_id": channelA}), 0)
+
+	// The channel broadcast is queued after anything the repeated update sent.
+	if event := waitForEvent(t, peer); event.Type != EventParticipantJoined {
+		t.Fatalf("peer got %q after repeating the same status, want only %q", event.Type, EventParticipantJoined)
+	}
+}
+
+func TestLoadPresenceStatus(t *testing.T) {
+	tests := []struct {
+		name  string
+		store PresenceStatusStore
+		want  string
+	}{
+		{name: "no store", store: nil, want: models.PresenceStatusOnline},
+		{name: "saved status", store: &fakeStatusStore{statuses: map[uint]string{1: models.PresenceStatusDND}}, want: models.PresenceStatusDND},
+		{name: "nothing saved", store: &fakeStatusStore{statuses: map[uint]string{}}, want: models.PresenceStatusOnline},
+		{name: "unknown saved status", store: &fakeStatusStore{statuses: map[uint]string{1: "offline"}}, want: models.PresenceStatusOnline},
+		{name: "store error", store: &fakeStatusStore{statuses: map[uint]string{1: models.PresenceStatusAway}, err: errors.New("db down")}, want: models.PresenceStatusOnline},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub := NewHub()
+			if tt.store != nil {
+				hub.SetPresenceStatusStore(tt.store)
+			}
+			if got := hub.loadPresenceStatus(1); got != tt.want {
+				t.Fatalf("loadPresenceStatus = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPresenceStatusHidesInvisibleUsers(t *testing.T) {
+	hub := NewHub()
+
+	if got := hub.PresenceStatus(1); got != models.PresenceStatusOffline {
+		t.Fatalf("PresenceStatus without a connection = %q, want %q", got, models.PresenceStatusOffline)
+	}
+
+	hub.mu.Lock()
+	hub.presence[1] = 1
+	hub.statuses[1] = models.PresenceStatusInvisible
+	hub.presence[2] = 2
+	hub.statuses[2] = models.PresenceStatusAway
+	hub.mu.Unlock()
+
+	if got := hub.PresenceStatus(1); got != models.PresenceStatusOffline {
+		t.Fatalf("PresenceStatus(invisible) = %q, want %q", got, models.PresenceStatusOffline)
+	}
+	if got := hub.PresenceStatus(2); got != models.PresenceStatusAway {
+		t.Fatalf("PresenceStatus(away) = %q, want %q", got, models.PresenceStatusAway)
+	}
+}
@@ -0,0 +1,357 @@
+package websocket
+
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultResumeBufferSize is how many recent events are kept per user for replay.
+	defaultResumeBufferSize = 100
+
+	// maxResumeBufferSize caps the buffer below clientSendBuffer, because a replay is
+	// queued onto the connection's send channel in one go and overflowing it drops
+	// the connection.
+	maxResumeBufferSize = 200
+
+	// resumeRetention is how long a user's event log is kept, and still recorded
+	// into, after their last connection closes.
+	resumeRetention = 2 * time.Minute
+)
+
+// sequencedEvent is an outbound event stamped with its position in a user's stream.
+type sequencedEvent struct {
+	seq     uint64
+	payload []byte
+}
+
+// eventLog is a user's event stream: a sequence counter plus a ring buffer of
+// the most recent events, used to replay what a reconnecting client missed.
+type eventLog struct {
+	servers     map[uint]bool
+	nextSeq     uint64
+	ring        []sequencedEvent
+	head        int
+	count       int
+	connections int
+	idleSince   time.Time
+}
+
+// resumeRequest asks Run to replay a client's missed events.
+type resumeRequest struct {
+	client  *Client
+	lastSeq uint64
+}
+
+// ResumeBufferSizeFromEnv reads WS_RESUME_BUFFER_SIZE, falling back to the
+// default when unset or invalid.
+func ResumeBufferSizeFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("WS_RESUME_BUFFER_SIZE"))
+	if raw == "" {
+		return defaultResumeBufferSize
+	}
+
+	size, err := strconv.Atoi(raw)
+	if err != nil || size <= 0 {
+		slog.Warn("invalid WS_RESUME_BUFFER_SIZE value", "value", raw)
+		return defaultResumeBufferSize
+	}
+
+	return size
+}
+
+// SetResumeBufferSize changes how many events are kept per user for replay,
+// clamped to maxResumeBufferSize. It must be called before Run.
+func (h *Hub) SetResumeBufferSize(size int) {
+	if size <= 0 {
+		return
+	}
+	if size > maxResumeBufferSize {
+		slog.Warn("WS_RESUME_BUFFER_SIZE exceeds the maximum", "value", size, "using", maxResumeBufferSize)
+		size = maxResumeBufferSize
+	}
+
+	h.logMu.Lock()
+	h.resumeBufferSize = size
+	h.logMu.Unlock()
+}
+
+// openEventLog attaches a new connection to its user's event log, creating the
+// log if needed. Sequence numbers start at the creation time in microseconds, so
+// a client holding numbers from an expired log or an earlier server process is
+// always told to resync rather than replayed a misleading tail.
+func (h *Hub) openEventLog(client *Client) {
+	servers := make(map[uint]bool)
+	for _, serverID := range client.serverIDs() {
+		servers[serverID] = true
+	}
+
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	userLog, ok := h.eventLogs[client.userID]
+	if !ok {
+		userLog = &eventLog{
+			nextSeq: uint64(time.Now().UnixMicro()),
+			ring:    make([]sequencedEvent, h.resumeBufferSize),
+		}
+		h.eventLogs[client.userID] = userLog
+	}
+
+	userLog.servers = servers
+	userLog.connections++
+	userLog.idleSince = time.Time{}
+}
+
+// closeEventLog detaches a closed connection. The log keeps recording for
+// resumeRetention so a quick reconnect can catch up.
+func (h *Hub) closeEventLog(userID uint) {
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	userLog, ok := h.eventLogs[userID]
+	if !ok {
+		return
+	}
+
+	userLog.connections--
+	if userLog.connections <= 0 {
+		userLog.connections = 0
+		userLog.idleSince = time.Now()
+	}
+}
+
+// pruneEventLogs periodically drops the logs of users who have been
+// disconnected for longer than resumeRetention.
+func (h *Hub) pruneEventLogs() {
+	ticker := time.NewTicker(resumeRetention / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-h.done:
+			return
+		}
+
+		cutoff := time.Now().Add(-resumeRetention)
+
+		h.logMu.Lock()
+		for userID, userLog := range h.eventLogs {
+			if userLog.connections == 0 && userLog.idleSince.Before(cutoff) {
+				delete(h.eventLogs, userID)
+			}
+		}
+		h.logMu.Unlock()
+	}
+}
+
+// setEventLogServer keeps a user's log in step with AddServerMember and
+// RemoveServerMember so events are still recorded while they are disconnected.
+func (h *Hub) setEventLogServer(userID, serverID uint, member bool) {
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	userLog, ok := h.eventLogs[userID]
+	if !ok {
+		return
+	}
+
+	if member {
+		userLog.servers[serverID] = true
+	} else {
+		delete(userLog.servers, serverID)
+	}
+}
+
+// logAudience returns the users with an event log that match the filter.
+func (h *Hub) logAudience(match func(userID uint, userLog *eventLog) bool) []uint {
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	audience := make([]uint, 0, len(h.eventLogs))
+	for userID, userLog := range h.eventLogs {
+		if match(userID, userLog) {
+			audience = append(audience, userID)
+		}
+	}
+
+	return audience
+}
+
+// serverAudience returns the users whose logs should record an event for the server.
+func (h *Hub) serverAudience(serverID uint) []uint {
+	h.mu.RLock()
+	scoped := h.resolver != nil
+	h.mu.RUnlock()
+
+	return h.logAudience(func(_ uint, userLog *eventLog) bool {
+		return !scoped || userLog.servers[serverID]
+	})
+}
+
+// recordEvent stamps a hub message with the next sequence number for each user
+// in its audience and appends it to their logs. It is only called from Run, so
+// events are numbered in the order they are written to connections.
+func (h *Hub) recordEvent(message hubMessage) map[uint]sequencedEvent {
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	audience := message.audience
+	if message.everyone {
+		audience = make([]uint, 0, len(h.eventLogs))
+		for userID := range h.eventLogs {
+			audience = append(audience, userID)
+		}
+	}
+
+	stamped := make(map[uint]sequencedEvent, len(audience))
+	for _, userID := range audience {
+		userLog, ok := h.eventLogs[userID]
+		if !ok {
+			continue
+		}
+		if _, seen := stamped[userID]; seen {
+			continue
+		}
+
+		event := sequencedEvent{
+			seq:     userLog.nextSeq,
+			payload: withSequence(message.payload, userLog.nextSeq),
+		}
+		userLog.nextSeq++
+		userLog.append(event)
+		stamped[userID] = event
+	}
+
+	return stamped
+}
+
+// eventsSince returns the events after lastSeq and before beforeSeq (0 for no
+// upper bound). It reports false when the client cannot be caught up because the
+// events it missed have already left the buffer.
+func (h *Hub) eventsSince(userID uint, lastSeq, beforeSeq uint64) ([]sequencedEvent, uint64, bool) {
+	h.logMu.Lock()
+	defer h.logMu.Unlock()
+
+	userLog, ok := h.eventLogs[userID]
+	if !ok {
+		return nil, 0, false
+	}
+
+	latest := userLog.nextSeq - 1
+	if lastSeq > latest || lastSeq+1 < userLog.oldestSeq() {
+		return nil, latest, false
+	}
+
+	events := make([]sequencedEvent, 0, userLog.count)
+	for i := 0; i < userLog.count; i++ {
+		event := userLog.ring[(userLog.head+i)%len(userLog.ring)]
+		if event.seq <= lastSeq {
+			continue
+		}
+		if beforeSeq != 0 && event.seq >= beforeSeq {
+			break
+		}
+		events = append(events, event)
+	}
+
+	return events, latest, true
+}
+
+// handleResume replays the events a reconnecting client missed, or tells it to
+// refetch everything over REST when the gap is larger than the buffer. Only
+// events delivered through Publish, PublishToServer and PublishToUser are
+// sequenced; voice signaling and replies to a single connection are not replayed.
+func (h *Hub) handleResume(request resumeRequest) {
+	client := request.client
+
+	h.mu.RLock()
+	registered := h.clients[client]
+	h.mu.RUnlock()
+	if !registered {
+		return
+	}
+
+	events, latest, ok := h.eventsSince(client.userID, request.lastSeq, client.firstLiveSeq)
+	if !ok {
+		h.sendToClient(client, NewEvent(EventResyncRequired, map[string]interface{}{
+			"last_seq": latest,
+		}))
+		return
+	}
+
+	for _, event := range events {
+		if !h.writeToClient(client, event.payload) {
+			return
+		}
+	}
+
+	h.sendToClient(client, NewEvent(EventResumed, map[string]interface{}{
+		"replayed": len(events),
+		"last_seq": latest,
+	}))
+}
+
+func (h *Hub) sendToClient(client *Client, event Event) {
+	message, err := event.encode()
+	if err != nil {
+		return
+	}
+	h.writeToClient(client, message)
+}
+
+// writeToClient queues a message without blocking, dropping the connection if
+// its send buffer is full.
+func (h *Hub) writeToClient(client *Client, message []byte) bool {
+	select {
+	case client.send <- message:
+		return true
+	default:
+		h.forceDisconnect(client)
+		return false
+	}
+}
+
+func (l *eventLog) append(event sequencedEvent) {
+	if len(l.ring) == 0 {
+		return
+	}
+
+	if l.count < len(l.ring) {
+		l.ring[(l.head+l.count)%len(l.ring)] = event
+		l.count++
+		return
+	}
+
+	l.ring[l.head] = event
+	l.head = (l.head + 1) % len(l.ring)
+}
+
+// oldestSeq returns the sequence number of the oldest buffered event, or the
+// next sequence number when the buffer is empty.
+func (l *eventLog) oldestSeq() uint64 {
+	if l.count == 0 {
+		return l.nextSeq
+	}
+	return l.ring[l.head].seq
+}
+
+// withSequence adds a top-level "seq" field to a marshalled JSON object.
+func withSequence(payload []byte, seq uint64) []byte {
+	if len(payload) < 2 || payload[0] != '{' {
+		return payload
+	}
+
+	body := payload[1:]
+	stamped := make([]byte, 0, len(payload)+24)
+	stamped = append(stamped, `{"seq":`...)
+	stamped = strconv.AppendUint(stamped, seq, 10)
+	if body[0] != '}' {
+		stamped = append(stamped, ',')
+	}
+	return append(stamped, body...)
+}
@@ -0,0 +1,244 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWithSequence(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    string
+	}{
+		{name: "object", payload: `{"type":"message.created","data":{}}`, want: `{"seq":42,"type":"message.created","data":{}}`},
+		{name: "empty object", payload: `{}`, want: `{"seq":42}`},
+		{name: "not an object", payload: `[1,2]`, want: `[1,2]`},
+		{name: "too short", payload: `{`, want: `{`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(withSequence([]byte(tt.payload), 42)); got != tt.want {
+				t.Fatalf("withSequence(%s) = %s, want %s", tt.payload, got, tt.want)
+			}
+		})
+	}
+}
+
+// newResumeHub returns a hub keeping size events per user, with user 1
+// connected and its event log open. It also returns the log's first sequence number.
+func newResumeHub(t *testing.T, size int) (*Hub, *Client, uint64) {
+	t.Helper()
+
+	hub := NewHub()
+	hub.SetResumeBufferSize(size)
+	client := newTestClient(hub, 1, serverA)
+	hub.openEventLog(client)
+
+	hub.logMu.Lock()
+	first := hub.eventLogs[client.userID].nextSeq
+	hub.logMu.Unlock()
+
+	return hub, client, first
+}
+
+// recordEvents logs count events for user 1 as Run would.
+func recordEvents(t *testing.T, hub *Hub, count int) {
+	t.Helper()
+
+	for i := 0; i < count; i++ {
+		payload, err := NewEvent(EventEmojiCreated, map[string]any{"n": i}).encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		hub.recordEvent(hubMessage{payload: payload, audience: []uint{1, 1}})
+	}
+}
+
+func eventSeqs(events []sequencedEvent) []uint64 {
+	seqs := make([]uint64, len(events))
+	for i, event := range events {
+		seqs[i] = event.seq
+	}
+	return seqs
+}
+
+func TestEventsSince(t *testing.T) {
+	hub, _, first := newResumeHub(t, 3)
+	// Five events through a three-event buffer leaves first+2 to first+4.
+	recordEvents(t, hub, 5)
+
+	tests := []struct {
+		name      string
+		lastSeq   uint64
+		beforeSeq uint64
+		want      []uint64
+		wantOK    bool
+	}{
+		{name: "caught up from oldest", lastSeq: first + 1, want: []uint64{first + 2, first + 3, first + 4}, wantOK: true},
+		{name: "already current", lastSeq: first + 4, want: []uint64{}, wantOK: true},
+		{name: "bounded by first live event", lastSeq: first + 1, beforeSeq: first + 4, want: []uint64{first + 2, first + 3}, wantOK: true},
+		{name: "gap left the buffer", lastSeq: first, wantOK: false},
+		{name: "sequence from the future", lastSeq: first + 5, wantOK: false},
+		{name: "sequence from an older log", lastSeq: 7, wantOK: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, latest, ok := hub.eventsSince(1, tt.lastSeq, tt.beforeSeq)
+			if ok != tt.wantOK {
+				t.Fatalf("eventsSince(%d) ok = %v, want %v", tt.lastSeq, ok, tt.wantOK)
+			}
+			if latest != first+4 {
+				t.Fatalf("latest = %d, want %d", latest, first+4)
+			}
+			if !tt.wantOK {
+				return
+			}
+			got := eventSeqs(events)
+			if len(got) != len(tt.want) {
+				t.Fatalf("eventsSince(%d) = %v, want %v", tt.lastSeq, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("eventsSince(%d) = %v, want %v", tt.lastSeq, got, tt.want)
+				}
+			}
+		})
+	}
+
+	if _, _, ok := hub.eventsSince(99, first, 0); ok {
+		t.Fatal("eventsSince for a user without a log succeeded")
+	}
+}
+
+func TestHandleResumeReplaysMissedEvents(t *testing.T) {
+	hub, client, first := newResumeHub(t, 10)
+	recordEvents(t, hub, 2)
+
+	hub.handleResume(resumeRequest{client: client, lastSeq: first - 1})
+
+	events := drainEvents(t, client)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 2 replayed and %s", len(events), EventResumed)
+	}
+	for _, event := range events[:2] {
+		if event.Type != EventEmojiCreated {
+			t.Fatalf("replayed %q, want %q", event.Type, EventEmojiCreated)
+		}
+	}
+
+	var resumed struct {
+		Replayed int    `json:"replayed"`
+		LastSeq  uint64 `json:"last_seq"`
+	}
+	if events[2].Type != EventResumed {
+		t.Fatalf("final event = %q, want %q", events[2].Type, EventResumed)
+	}
+	if err := json.Unmarshal(events[2].Data, &resumed); err != nil {
+		t.Fatal(err)
+	}
+	if resumed.Replayed != 2 || resumed.LastSeq != first+1 {
+		t.Fatalf("resumed = %+v, want 2 replayed up to %d", resumed, first+1)
+	}
+}
+
+func TestHandleResumeRequestsResync(t *testing.T) {
+	hub, client, _ := newResumeHub(t, 10)
+	recordEvents(t, hub, 2)
+
+	hub.handleResume(resumeRequest{client: client, lastSeq: 3})
+
+	events := drainEvents(t, client)
+	if len(events) != 1 || events[0].Type != EventResyncRequired {
+		t.Fatalf("got %+v, want one %s", events, EventResyncRequired)
+	}
+}
+
+func TestReplayedEventsCarrySequence(t *testing.T) {
+	hub, _, first := newResumeHub(t, 10)
+	recordEvents(t, hub, 1)
+
+	events, _, _ := hub.eventsSince(1, first-1, 0)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+
+	var decoded struct {
+		Seq uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(events[0].payload, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Seq != first {
+		t.Fatalf("payload seq = %d, want %d", decoded.Seq, first)
+	}
+}
+
+func TestServerAudienceFollowsMembership(t *testing.T) {
+	hub, _, _ := newResumeHub(t, 10)
+	hub.SetMembershipResolver(newFakeResolver())
+
+	if audience := hub.serverAudience(serverB); len(audience) != 0 {
+		t.Fatalf("serverAudience(B) = %v, want none", audience)
+	}
+
+	hub.setEventLogServer(1, serverB, true)
+	if audience := hub.serverAudience(serverB); len(audience) != 1 || audience[0] != 1 {
+		t.Fatalf("serverAudience(B) after joining = %v, want [1]", audience)
+	}
+
+	hub.setEventLogServer(1, serverA, false)
+	if audience := hub.serverAudience(serverA); len(audience) != 0 {
+		t.Fatalf("serverAudience(A) after leaving = %v, want none", audience)
+	}
+}
+
+func TestCloseEventLogKeepsRecording(t *testing.T) {
+	hub, client, first := newResumeHub(t, 10)
+
+	hub.closeEventLog(client.userID)
+	recordEvents(t, hub, 1)
+
+	events, _, ok := hub.eventsSince(client.userID, first-1, 0)
+	if !ok || len(events) != 1 {
+		t.Fatalf("eventsSince after disconnect = %v, %v, want 1 event", eventSeqs(events), ok)
+	}
+
+	hub.logMu.Lock()
+	idle := hub.eventLogs[client.userID].idleSince
+	hub.logMu.Unlock()
+	if idle.IsZero() {
+		t.Fatal("idleSince not set after the last connection closed")
+	}
+}
+
+func TestResumeBufferSize(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want int
+	}{
+		{raw: "", want: defaultResumeBufferSize},
+		{raw: "50", want: 50},
+		{raw: "0", want: defaultResumeBufferSize},
+		{raw: "many", want: defaultResumeBufferSize},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("WS_RESUME_BUFFER_SIZE", tt.raw)
+		if got := ResumeBufferSizeFromEnv(); got != tt.want {
+			t.Fatalf("ResumeBufferSizeFromEnv(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+
+	hub := NewHub()
+	hub.SetResumeBufferSize(maxResumeBufferSize + 1)
+	if hub.resumeBufferSize != maxResumeBufferSize {
+		t.Fatalf("resumeBufferSize = %d, want it clamped to %d", hub.resumeBufferSize, maxResumeBufferSize)
+	}
+	hub.SetResumeBufferSize(-1)
+	if hub.resumeBufferSize != maxResumeBufferSize {
+		t.Fatalf("resumeBufferSize after a negative size = %d, want it unchanged", hub.resumeBufferSize)
+	}
+}
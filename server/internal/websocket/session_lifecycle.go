@@ -0,0 +1,124 @@
+package websocket
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"bafachat/internal/webrtc"
+)
+
+// handleSessionHeartbeat answers a client's periodic session.heartbeat. While
+// the session token is still valid it refreshes the participant and replies
+// session.alive with the media state the server holds, so the client can spot
+// drift. Once the token has expired or been removed it replies session.expired
+// and the client joins again over REST.
+func (c *Client) handleSessionHeartbeat() {
+	if c.webrtcManager == nil {
+		c.sendError("session.unavailable", "signaling service unavailable")
+		return
+	}
+
+	if !c.webrtcActive {
+		c.sendError("session.required", "webrtc session not active")
+		return
+	}
+
+	if _, err := c.webrtcManager.Validate(c.webrtcToken, c.userID, c.webrtcChannelID); err != nil {
+		if errors.Is(err, webrtc.ErrTokenExpired) || errors.Is(err, webrtc.ErrTokenNotFound) {
+			c.sendSessionExpired()
+			return
+		}
+
+		c.sendError("session.invalid", "failed to validate session token")
+		return
+	}
+
+	participant := c.hub.heartbeatParticipant(c.webrtcChannelID, c.userID)
+	if participant == nil {
+		c.sendError("participant.missing", "participant not registered")
+		return
+	}
+
+	c.sendJSON(NewEvent(EventSessionAlive, map[string]interface{}{
+		"channel_id":  participant.ChannelID,
+		"session_id":  participant.SessionID,
+		"media_state": participant.MediaState,
+		"last_seen":   participant.LastSeen.Format(time.RFC3339),
+	}))
+}
+
+// heartbeatParticipant refreshes a participant's LastSeen and returns a copy of
+// it, or nil if the user is no longer in the channel's session.
+func (h *Hub) heartbeatParticipant(channelID, userID uint) *Participant {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	participant, ok := h.participants[channelID][userID]
+	if !ok {
+		return nil
+	}
+
+	participant.LastSeen = time.Now()
+	clone := *participant
+	return &clone
+}
+
+// handleSessionRenew extends the session token of the caller's active call so it
+// does not lapse mid-call, replying session.renewed with the new expiry. A token
+// that has already expired gets session.expired and the client joins again. The
+// caller's role is looked up again first; someone who has left or been removed
+// from the server is taken out of the call instead.
+func (c *Client) handleSessionRenew() {
+	if c.webrtcManager == nil {
+		c.sendError("session.unavailable", "signaling service unavailable")
+		return
+	}
+
+	if !c.webrtcActive {
+		c.sendError("session.required", "webrtc session not active")
+		return
+	}
+
+	participant := c.hub.heartbeatParticipant(c.webrtcChannelID, c.userID)
+	if participant == nil {
+		c.sendError("participant.missing", "participant not registered")
+		return
+	}
+
+	role, err := c.hub.currentParticipantRole(*participant)
+	if err != nil {
+		slog.Warn("session renew role lookup failed", "user_id", c.userID, "channel_id", c.webrtcChannelID, "error", err)
+		c.sendError("session.unavailable", "could not verify membership, try again")
+		return
+	}
+
+	session, err := c.webrtcManager.Renew(c.webrtcToken, role)
+	if err != nil {
+		if errors.Is(err, webrtc.ErrNotMember) {
+			c.hub.EvictParticipant(c.webrtcChannelID, c.userID, "removed")
+			return
+		}
+		if errors.Is(err, webrtc.ErrTokenExpired) || errors.Is(err, webrtc.ErrTokenNotFound) {
+			c.sendSessionExpired()
+			return
+		}
+
+		c.sendError("session.invalid", "failed to renew session token")
+		return
+	}
+
+	c.sendJSON(NewEvent(EventSessionRenewed, map[string]interface{}{
+		"channel_id": session.ChannelID,
+		"session_id": session.SessionID,
+		"expires_at": session.ExpiresAt.Format(time.RFC3339),
+	}))
+}
+
+// sendSessionExpired tells the client its session token is no longer valid.
+func (c *Client) sendSessionExpired() {
+	c.sendJSON(NewEvent(EventSessionExpired, map[string]interface{}{
+		"channel_id": c.webrtcChannelID,
+		"session_id": c.webrtcSessionID,
+	}))
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"bafachat/internal/models"
+	"bafachat/internal/webrtc"
+)
+
+func TestSessionHeartbeat(t *testing.T) {
+	hub, _, _, member := newCallHub(t)
+
+	manager := webrtc.NewManager(time.Minute)
+	session, err := manager.Issue(2, testChannelID, "member", models.ServerRoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+	member.webrtcManager = manager
+	member.webrtcToken = session.Token
+
+	_, before := hub.channelParticipantPair(testChannelID, 0, 2)
+	hub.mu.Lock()
+	hub.participants[testChannelID][2].LastSeen = time.Now().Add(-time.Minute)
+	hub.mu.Unlock()
+
+	member.handleSessionHeartbeat()
+
+	events := drainEvents(t, member)
+	if len(events) != 1 || events[0].Type != EventSessionAlive {
+		t.Fatalf("events = %+v, want one %s", events, EventSessionAlive)
+	}
+	var data struct {
+		ChannelID  uint       `json:"channel_id"`
+		MediaState MediaState `json:"media_state"`
+	}
+	if err := json.Unmarshal(events[0].Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	if data.ChannelID != testChannelID || data.MediaState != before.MediaState {
+		t.Fatalf("session.alive = %+v, want channel %d and the stored media state", data, testChannelID)
+	}
+
+	_, after := hub.channelParticipantPair(testChannelID, 0, 2)
+	if time.Since(after.LastSeen) > time.Second {
+		t.Fatalf("LastSeen = %v, want it refreshed", after.LastSeen)
+	}
+}
+
+func TestSessionHeartbeatReportsExpiredToken(t *testing.T) {
+	_, _, _, member := newCallHub(t)
+
+	manager := webrtc.NewManager(time.Minute)
+	session, err := manager.Issue(2, testChannelID, "member", models.ServerRoleMember)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.Revoke(session.Token)
+	member.webrtcManager = manager
+	member.webrtcToken = session.Token
+
+	member.handleSessionHeartbeat()
+
+	events := drainEvents(t, member)
+	if len(events) != 1 || events[0].Type != EventSessionExpired {
+		t.Fatalf("events = %+v, want one %s", events, EventSessionExpired)
+	}
+}
+
+func TestSessionHeartbeatErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(hub *Hub, c *Client)
+		want  string
+	}{
+		{
+			name:  "no signaling service",
+			setup: func(hub *Hub, c *Client) { c.webrtcManager = nil },
+			want:  "session.unavailable",
+		},
+		{
+			name:  "no active session",
+			setup: func(hub *Hub, c *Client) { c.webrtcActive = false },
+			want:  "session.required",
+		},
+		{
+			name:  "token for another channel",
+			setup: func(hub *Hub, c *Client) { c.webrtcChannelID = testChannelID + 1 },
+			want:  "session.invalid",
+		},
+		{
+			name:  "participant gone",
+			setup: func(hub *Hub, c *Client) { hub.removeParticipant(testChannelID, 2) },
+			want:  "participant.missing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hub, _, _, member := newCallHub(t)
+
+			manager := webrtc.NewManager(time.Minute)
+			session, err := manager.Issue(2, testChannelID, "member", models.ServerRoleMember)
+			if err != nil {
+				t.Fatal(err)
+			}
+			member.webrtcManager = manager
+			member.webrtcToken = session.Token
+			tt.setup(hub, member)
+
+			member.handleSessionHeartbeat()
+
+			if codes := sessionErrorCodes(t, drainEvents(t, member)); !slices.Equal(codes, []string{tt.want}) {
+				t.Fatalf("error codes = %v, want [%s]", codes, tt.want)
+			}
+		})
+	}
+}
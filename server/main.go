@@ -3,29 +3,39 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"bafachat/internal/auth"
 	"bafachat/internal/database"
 	"bafachat/internal/email"
 	"bafachat/internal/handlers"
+	"bafachat/internal/logging"
 	"bafachat/internal/middleware"
+	"bafachat/internal/push"
 	"bafachat/internal/queue"
 	"bafachat/internal/storage"
+	"bafachat/internal/unfurl"
 	"bafachat/internal/webrtc"
 	"bafachat/internal/websocket"
 
 	"github.com/gin-gonic/gin"
+	"github.com/hibiken/asynq"
 	"github.com/joho/godotenv"
 	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found")
+	envErr := godotenv.Load()
+	logging.Setup()
+	if envErr != nil {
+		slog.Info("no .env file found")
 	}
 
 	// Get port from environment or default to 8080
@@ -34,43 +44,73 @@ func main() {
 		port = "8080"
 	}
 
+	if hashing, err := auth.PasswordHashingFromEnv(); err != nil {
+		slog.Warn("invalid password hashing configuration, using defaults for bad values", "error", err)
+	} else {
+		slog.Info("password hashing configured", "algorithm", hashing.Algorithm)
+	}
+
 	// Initialize database connection
 	db := database.GetDB()
-	log.Println("Database connection established")
+	slog.Info("database connection established")
 
 	// Initialize email service
 	emailService, err := email.NewServiceFromEnv()
 	if err != nil {
-		log.Printf("Email service disabled: %v", err)
+		slog.Warn("email service disabled", "error", err)
 	} else {
-		log.Println("Email service ready")
+		slog.Info("email service ready")
 	}
 
 	// Initialize queue (Redis + Asynq)
 	queueCfg := queue.ConfigFromEnv()
 	queueClient, err := queue.NewClient(queueCfg)
 	if err != nil {
-		log.Printf("Queue client disabled: %v", err)
+		slog.Warn("queue client disabled", "error", err)
 	}
 
-	if queueClient != nil {
-		server, serr := queue.NewServer(queueCfg)
-		if serr != nil {
-			log.Printf("Queue worker disabled: %v", serr)
-		} else {
-			mux := queue.NewMux(emailService)
-			go func() {
-				log.Println("Queue worker starting")
-				if err := server.Run(mux); err != nil {
-					log.Printf("Queue worker stopped: %v", err)
-				}
-			}()
-			log.Println("Queue client ready")
+	// Rate limiting and channel slowmode share the queue's Redis instance
+	authRateLimits := middleware.AuthRateLimitsFromEnv()
+	webhookRateLimit := middleware.WebhookRateLimitFromEnv()
+	messageRateLimit := middleware.MessageRateLimitFromEnv()
+	var rateLimiter *middleware.RateLimiter
+	limiterRedis := redis.NewClient(&redis.Options{
+		Addr:     queueCfg.Addr,
+		Password: queueCfg.Password,
+		DB:       queueCfg.DB,
+	})
+	if err := limiterRedis.Ping(context.Background()).Err(); err != nil {
+		slog.Warn("rate limiting disabled", "error", err)
+		if closeErr := limiterRedis.Close(); closeErr != nil {
+			slog.Warn("failed to close redis client", "error", closeErr)
 		}
+	} else {
+		rateLimiter = middleware.NewRateLimiter(limiterRedis)
+		defer func() {
+			if err := limiterRedis.Close(); err != nil {
+				slog.Warn("failed to close redis client", "error", err)
+			}
+		}()
+		slog.Info("rate limiting enabled")
+	}
+
+	allowedOrigins := middleware.AllowedOriginsFromEnv()
+	if allowedOrigins.AllowsAll() {
+		slog.Warn("CORS_ALLOWED_ORIGINS allows every origin; set it to the client's origin in production")
 	}
 
 	// Initialize WebSocket hub
 	hub := websocket.NewHub()
+	if allowedOrigins.Configured() {
+		hub.SetOriginValidator(allowedOrigins.Allows)
+	} else {
+		slog.Warn("CORS_ALLOWED_ORIGINS is not set; websocket connections are limited to pages served by this host")
+	}
+	hub.SetMembershipResolver(websocket.NewDBMembershipResolver(db))
+	hub.SetLastSeenRecorder(websocket.NewDBLastSeenRecorder(db))
+	hub.SetPresenceStatusStore(websocket.NewDBPresenceStatusStore(db))
+	hub.SetParticipantTimeout(websocket.ParticipantTimeoutFromEnv())
+	hub.SetResumeBufferSize(websocket.ResumeBufferSizeFromEnv())
 	go hub.Run()
 
 	// Initialize WebRTC signaling manager and config
@@ -88,22 +128,22 @@ func main() {
 		})
 
 		if err := rtcRedisClient.Ping(context.Background()).Err(); err != nil {
-			log.Printf("WebRTC Redis store disabled: %v", err)
+			slog.Warn("webrtc redis store disabled", "error", err)
 			if closeErr := rtcRedisClient.Close(); closeErr != nil {
-				log.Printf("Failed to close Redis client: %v", closeErr)
+				slog.Warn("failed to close redis client", "error", closeErr)
 			}
 			rtcRedisClient = nil
 		} else {
 			store, storeErr := webrtc.NewRedisTokenStore(rtcRedisClient, rtcStoreCfg.Prefix)
 			if storeErr != nil {
-				log.Printf("WebRTC Redis store unavailable: %v", storeErr)
+				slog.Warn("webrtc redis store unavailable", "error", storeErr)
 				if closeErr := rtcRedisClient.Close(); closeErr != nil {
-					log.Printf("Failed to close Redis client: %v", closeErr)
+					slog.Warn("failed to close redis client", "error", closeErr)
 				}
 				rtcRedisClient = nil
 			} else {
 				rtcStore = store
-				log.Println("WebRTC session tokens stored in Redis")
+				slog.Info("webrtc session tokens stored in redis")
 			}
 		}
 	}
@@ -111,13 +151,15 @@ func main() {
 	if rtcRedisClient != nil {
 		defer func() {
 			if err := rtcRedisClient.Close(); err != nil {
-				log.Printf("Failed to close Redis client: %v", err)
+				slog.Warn("failed to close redis client", "error", err)
 			}
 		}()
 	}
 
 	rtcManager := webrtc.NewManagerWithStore(2*time.Minute, rtcStore)
 	rtcConfig := webrtc.ConfigFromEnv()
+	hub.SetAudioOnly(rtcConfig.AudioOnly)
+	hub.SetSingleScreenShare(rtcConfig.SingleScreenShare)
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
 		defer ticker.Stop()
@@ -130,21 +172,145 @@ func main() {
 	storageService, storageErr := storage.NewServiceFromEnv(context.Background())
 	if storageErr != nil {
 		if errors.Is(storageErr, storage.ErrServiceDisabled) {
-			log.Println("Storage service disabled (missing configuration)")
+			slog.Info("storage service disabled (missing configuration)")
 		} else {
-			log.Printf("Storage service unavailable: %v", storageErr)
+			slog.Error("storage service unavailable", "error", storageErr)
+		}
+	} else {
+		slog.Info("storage service ready")
+	}
+
+	// Sweep ephemeral messages once they expire
+	expiredMessageStorage := storageService
+	if storageErr != nil {
+		expiredMessageStorage = nil
+	}
+	go func() {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			deleted, err := handlers.SweepExpiredMessages(context.Background(), db, expiredMessageStorage, hub)
+			if err != nil {
+				slog.Error("failed to sweep expired messages", "error", err)
+			}
+			if deleted > 0 {
+				slog.Info("deleted expired messages", "count", deleted)
+			}
+		}
+	}()
+
+	// Remove data exports once their download window closes
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, err := handlers.SweepExpiredDataExports(context.Background(), db, expiredMessageStorage)
+			if err != nil {
+				slog.Error("failed to sweep expired data exports", "error", err)
+			}
+			if removed > 0 {
+				slog.Info("removed expired data exports", "count", removed)
+			}
 		}
+	}()
+
+	// Delete presigned uploads that were never attached to a message
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			removed, reclaimed, err := handlers.SweepOrphanedUploads(context.Background(), db, expiredMessageStorage)
+			if err != nil {
+				slog.Error("failed to sweep orphaned uploads", "error", err)
+			}
+			if removed > 0 {
+				slog.Info("removed orphaned uploads", "count", removed, "bytes", reclaimed)
+			}
+		}
+	}()
+
+	// Initialize push notifications
+	var pushSenders []push.Sender
+	webPushCfg := push.WebPushConfigFromEnv()
+	if webPushCfg.PublicKey == "" && webPushCfg.PrivateKey == "" {
+		slog.Info("web push disabled (missing VAPID keys)")
+	} else if webPushSender, err := push.NewWebPushSender(webPushCfg); err != nil {
+		slog.Error("web push unavailable", "error", err)
 	} else {
-		log.Println("Storage service ready")
+		pushSenders = append(pushSenders, webPushSender)
+		slog.Info("web push ready")
+	}
+	pushDispatcher := push.NewDispatcher(pushSenders...)
+
+	// Initialize link previews
+	var linkFetcher *unfurl.Fetcher
+	if linkCfg := unfurl.ConfigFromEnv(); linkCfg.Enabled {
+		linkFetcher = unfurl.NewFetcher(linkCfg)
+		slog.Info("link previews ready")
+	} else {
+		slog.Info("link previews disabled")
+	}
+
+	var queueServer *asynq.Server
+	if queueClient != nil {
+		server, serr := queue.NewServer(queueCfg)
+		if serr != nil {
+			slog.Warn("queue worker disabled", "error", serr)
+		} else {
+			var previews queue.PreviewProcessor
+			if storageErr == nil && storageService != nil {
+				previews = handlers.NewAttachmentPreviewProcessor(db, storageService, hub)
+			}
+
+			var exports queue.DataExportProcessor
+			if storageErr == nil && storageService != nil {
+				exports = handlers.NewDataExportProcessor(db, storageService, queueClient)
+			}
+
+			var pushes queue.PushProcessor
+			if pushDispatcher.Enabled() {
+				pushes = handlers.NewPushProcessor(db, pushDispatcher)
+			}
+
+			mentions := handlers.NewMentionEmailProcessor(db, hub, queueClient)
+
+			var links queue.LinkPreviewProcessor
+			if linkFetcher != nil {
+				links = handlers.NewLinkPreviewProcessor(db, hub, linkFetcher)
+			}
+
+			mux := queue.NewMux(emailService, previews, pushes, mentions, links, exports)
+			slog.Info("queue worker starting")
+			if err := server.Start(mux); err != nil {
+				slog.Error("queue worker stopped", "error", err)
+			} else {
+				queueServer = server
+			}
+			slog.Info("queue client ready")
+		}
+	}
+
+	var queueInspector *asynq.Inspector
+	if queueClient != nil {
+		if inspector, ierr := queue.NewInspector(queueCfg); ierr != nil {
+			slog.Warn("queue inspector disabled", "error", ierr)
+		} else {
+			queueInspector = inspector
+		}
 	}
 
 	// Initialize Gin router
-	r := gin.Default()
+	r := gin.New()
+	if err := r.SetTrustedProxies(middleware.TrustedProxiesFromEnv()); err != nil {
+		slog.Error("invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
 
 	// Apply middleware
-	r.Use(middleware.CORSMiddleware())
-	r.Use(gin.Logger())
+	r.Use(middleware.RequestIDMiddleware())
+	r.Use(middleware.RequestLogger())
 	r.Use(gin.Recovery())
+	r.Use(middleware.CORSMiddleware(allowedOrigins))
 	r.Use(func(c *gin.Context) {
 		c.Set("db", db)
 		if emailService != nil {
@@ -153,9 +319,21 @@ func main() {
 		if queueClient != nil {
 			c.Set("queue", queueClient)
 		}
+		if queueInspector != nil {
+			c.Set("queueInspector", queueInspector)
+		}
 		if storageErr == nil && storageService != nil {
 			c.Set("storage", storageService)
 		}
+		if rateLimiter != nil {
+			c.Set("redis", limiterRedis)
+			c.Set("rateLimiter", rateLimiter)
+			c.Set("messageRateLimit", messageRateLimit)
+		}
+		c.Set("pushDispatcher", pushDispatcher)
+		if linkFetcher != nil {
+			c.Set("linkPreviewFetcher", linkFetcher)
+		}
 		c.Set("wsHub", hub)
 		c.Set("webrtcManager", rtcManager)
 		c.Set("webrtcConfig", rtcConfig)
@@ -163,26 +341,40 @@ func main() {
 	})
 
 	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":  "healthy",
-			"service": "bafachat-server",
-		})
-	})
+	r.GET("/health", handlers.HealthLive)
+	r.GET("/health/live", handlers.HealthLive)
+	r.GET("/health/ready", handlers.HealthReady)
 
 	// API routes
 	api := r.Group("/api/v1")
 	{
 		// User authentication routes
 		auth := api.Group("/auth")
+		auth.Use(middleware.RateLimitMiddleware(rateLimiter, "auth", authRateLimits.PerIP, middleware.ClientIPKey))
 		{
 			auth.POST("/register", handlers.Register)
-			auth.POST("/login", handlers.Login)
+			auth.POST("/login",
+				middleware.RateLimitMiddleware(rateLimiter, "auth", authRateLimits.PerIdentifier, middleware.LoginIdentifierKey),
+				handlers.Login,
+			)
+			auth.POST("/2fa", handlers.CompleteTwoFactorLogin)
 			auth.POST("/logout", handlers.Logout)
 			auth.GET("/verify-email", handlers.VerifyEmail)
+			auth.GET("/confirm-email", handlers.ConfirmEmailChange)
+			auth.GET("/oauth/:provider", handlers.StartOAuth)
+			auth.GET("/oauth/:provider/callback", handlers.OAuthCallback)
 		}
 
 		api.GET("/invites/:code", handlers.GetInvite)
+		api.GET("/invites/:code/qr", handlers.GetInviteQRCode)
+		api.GET("/exports/:token", handlers.DownloadDataExport)
+		api.POST("/webhooks/:token",
+			middleware.RateLimitMiddleware(rateLimiter, "webhook", webhookRateLimit, middleware.HashedParamKey("token")),
+			handlers.ExecuteWebhook,
+		)
+		api.GET("/time", handlers.GetServerTime)
+		api.GET("/users/:id/default-avatar", handlers.GetDefaultAvatar)
+		api.GET("/config", handlers.GetClientConfig)
 
 		// Protected routes (require authentication)
 		protected := api.Group("/")
@@ -190,35 +382,107 @@ func main() {
 		{
 			// User routes
 			protected.GET("/users/me", handlers.GetCurrentUser)
+			protected.GET("/bootstrap", handlers.GetBootstrap)
 			protected.POST("/users/lookup", handlers.LookupUsers)
 			protected.PUT("/users/me", handlers.UpdateCurrentUser)
+			protected.DELETE("/users/me", handlers.DeleteCurrentUser)
+			protected.GET("/users/me/export", handlers.ExportCurrentUser)
+			protected.POST("/users/me/email", handlers.RequestEmailChange)
+			protected.GET("/users/me/sessions", handlers.GetSessions)
+			protected.DELETE("/users/me/sessions/:id", handlers.RevokeSession)
+			protected.POST("/users/me/2fa/setup", handlers.SetupTwoFactor)
+			protected.POST("/users/me/2fa/verify", handlers.VerifyTwoFactor)
+			protected.DELETE("/users/me/2fa", handlers.DisableTwoFactor)
+			protected.GET("/users/me/tokens", handlers.GetAPITokens)
+			protected.POST("/users/me/tokens", handlers.CreateAPIToken)
+			protected.DELETE("/users/me/tokens/:id", handlers.RevokeAPIToken)
 			protected.POST("/users/me/avatar/presign", handlers.PresignUserAvatarUpload)
 			protected.POST("/users/me/avatar", handlers.SetUserAvatar)
 			protected.DELETE("/users/me/avatar", handlers.DeleteUserAvatar)
+			protected.POST("/users/me/push-subscriptions", handlers.CreatePushSubscription)
+			protected.DELETE("/users/me/push-subscriptions", handlers.DeletePushSubscription)
+			protected.GET("/users/me/notification-preferences", handlers.GetNotificationPreferences)
+			protected.PUT("/users/me/notification-preferences", handlers.UpdateNotificationPreferences)
+			protected.GET("/users/me/dnd-schedule", handlers.GetDNDSchedule)
+			protected.PUT("/users/me/dnd-schedule", handlers.UpdateDNDSchedule)
+			protected.PUT("/users/me/dnd-schedule/override", handlers.SetDNDOverride)
+			protected.DELETE("/users/me/dnd-schedule/override", handlers.ClearDNDOverride)
+			protected.GET("/users/me/privacy", handlers.GetPrivacySettings)
+			protected.PUT("/users/me/privacy", handlers.UpdatePrivacySettings)
 
 			// Server/Guild routes
+			protected.GET("/discover", handlers.DiscoverServers)
 			protected.GET("/servers", handlers.GetServers)
 			protected.POST("/servers", handlers.CreateServer)
 			protected.GET("/servers/:serverID", handlers.GetServer)
+			protected.POST("/servers/:serverID/join", handlers.JoinPublicServer)
+			protected.PUT("/servers/:serverID/discovery", handlers.UpdateServerDiscovery)
 			protected.GET("/servers/:serverID/participants", handlers.GetServerChannelParticipants)
+			protected.GET("/servers/:serverID/presence", handlers.GetServerPresence)
+			protected.GET("/servers/:serverID/members", handlers.GetServerMembers)
+			protected.DELETE("/servers/:serverID/members/:userID", handlers.KickServerMember)
+			protected.PATCH("/servers/:serverID/members/:userID/role", handlers.UpdateServerMemberRole)
+			protected.PATCH("/servers/:serverID/members/:userID/nickname", handlers.UpdateServerMemberNickname)
+			protected.POST("/servers/:serverID/members/:userID/approve", handlers.ApproveServerMember)
+			protected.POST("/servers/:serverID/transfer", handlers.TransferServerOwnership)
+			protected.POST("/servers/:serverID/membership/accept-rules", handlers.AcceptServerRules)
+			protected.PUT("/servers/:serverID/join-gate", handlers.UpdateServerJoinGate)
+			protected.PUT("/servers/:serverID/welcome", handlers.UpdateServerWelcome)
+			protected.GET("/servers/:serverID/word-filter", handlers.GetServerWordFilter)
+			protected.PUT("/servers/:serverID/word-filter", handlers.UpdateServerWordFilter)
+			protected.GET("/servers/:serverID/emojis", handlers.GetServerEmojis)
+			protected.POST("/servers/:serverID/emojis", handlers.CreateServerEmoji)
+			protected.DELETE("/servers/:serverID/emojis/:emojiID", handlers.DeleteServerEmoji)
+			protected.GET("/servers/:serverID/storage", handlers.GetServerStorage)
+			protected.GET("/servers/:serverID/bans", handlers.GetServerBans)
+			protected.POST("/servers/:serverID/bans", handlers.CreateServerBan)
+			protected.DELETE("/servers/:serverID/bans/:userID", handlers.DeleteServerBan)
+			protected.GET("/servers/:serverID/invites", handlers.GetServerInvites)
 			protected.POST("/servers/:serverID/invites", handlers.CreateServerInvite)
+			protected.DELETE("/servers/:serverID/invites/:code", handlers.RevokeServerInvite)
 			protected.POST("/servers/:serverID/avatar/presign", handlers.PresignServerAvatarUpload)
 			protected.POST("/servers/:serverID/avatar", handlers.SetServerAvatar)
 			protected.DELETE("/servers/:serverID/avatar", handlers.DeleteServerAvatar)
 
 			// Channel routes
 			protected.GET("/servers/:serverID/channels", handlers.GetChannels)
+			protected.POST("/servers/:serverID/channels/:id/webhooks", handlers.CreateChannelWebhook)
+			protected.GET("/servers/:serverID/unreads", handlers.GetServerUnreads)
+			protected.POST("/servers/:serverID/read", handlers.MarkServerRead)
+			protected.POST("/servers/:serverID/categories", handlers.CreateChannelCategory)
+			protected.PATCH("/servers/:serverID/categories/:categoryID", handlers.UpdateChannelCategory)
+			protected.DELETE("/servers/:serverID/categories/:categoryID", handlers.DeleteChannelCategory)
 			protected.POST("/channels", handlers.CreateChannel)
+			protected.PATCH("/channels/:id", handlers.UpdateChannel)
 			protected.GET("/channels/:id/messages", handlers.GetMessages)
 			protected.POST("/channels/:id/messages", handlers.CreateMessage)
 			protected.POST("/channels/:id/messages/attachments", handlers.UploadAttachmentMessage)
+			protected.DELETE("/channels/:id/messages/:messageID/attachments/:attachmentID", handlers.DeleteMessageAttachment)
+			protected.GET("/channels/:id/attachments/:attachmentID", handlers.StreamAttachment)
 			protected.POST("/channels/:id/attachments/presign", handlers.CreateAttachmentUpload)
+			protected.POST("/channels/:id/attachments/presign-batch", handlers.CreateAttachmentUploadBatch)
 			protected.POST("/channels/:id/typing", handlers.SendTypingIndicator)
+			protected.POST("/channels/:id/read", handlers.MarkChannelRead)
+			protected.GET("/channels/:id/receipts", handlers.GetChannelReceipts)
+			protected.POST("/channels/:id/acknowledge-nsfw", handlers.AcknowledgeNSFWChannel)
+			protected.POST("/channels/:id/archive", handlers.ArchiveChannel)
+			protected.POST("/channels/:id/unarchive", handlers.UnarchiveChannel)
+			protected.POST("/channels/:id/members/:userID", handlers.AddChannelMember)
+			protected.DELETE("/channels/:id/members/:userID", handlers.RemoveChannelMember)
 			protected.POST("/channels/:id/webrtc/join", handlers.JoinWebRTCChannel)
 			protected.POST("/channels/:id/webrtc/leave", handlers.LeaveWebRTCChannel)
+			protected.GET("/webrtc/turn-credentials", handlers.GetTURNCredentials)
 
 			protected.POST("/invites/:code/accept", handlers.AcceptInvite)
 		}
+
+		// Operator routes (require ADMIN_API_TOKEN)
+		admin := api.Group("/admin")
+		admin.Use(middleware.AdminTokenMiddleware())
+		{
+			admin.GET("/emails/failed", handlers.GetFailedEmails)
+			admin.POST("/emails/failed/:taskID/retry", handlers.RetryFailedEmail)
+		}
 	}
 
 	// WebSocket endpoint
@@ -226,9 +490,71 @@ func main() {
 		websocket.HandleWebSocket(hub, rtcManager, c)
 	})
 
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: r,
+	}
+
 	// Start server
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	go func() {
+		slog.Info("server starting", "port", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-quit
+
+	gracePeriod := shutdownTimeoutFromEnv()
+	slog.Info("shutting down", "signal", sig.String(), "grace_period", gracePeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	// Stop accepting requests and let in-flight ones, such as uploads, finish.
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("http server shutdown incomplete", "error", err)
+	}
+
+	// Hijacked websocket connections are not tracked by the HTTP server.
+	if err := hub.Shutdown(ctx); err != nil {
+		slog.Warn("websocket hub shutdown incomplete", "error", err)
+	}
+
+	if queueServer != nil {
+		queueServer.Shutdown()
 	}
+	if queueClient != nil {
+		if err := queueClient.Close(); err != nil {
+			slog.Warn("failed to close queue client", "error", err)
+		}
+	}
+	if queueInspector != nil {
+		if err := queueInspector.Close(); err != nil {
+			slog.Warn("failed to close queue inspector", "error", err)
+		}
+	}
+
+	slog.Info("server stopped")
+}
+
+// shutdownTimeoutFromEnv reads SHUTDOWN_TIMEOUT as a Go duration, defaulting to 25s.
+func shutdownTimeoutFromEnv() time.Duration {
+	const defaultTimeout = 25 * time.Second
+
+	raw := strings.TrimSpace(os.Getenv("SHUTDOWN_TIMEOUT"))
+	if raw == "" {
+		return defaultTimeout
+	}
+
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		slog.Warn("invalid SHUTDOWN_TIMEOUT value", "value", raw)
+		return defaultTimeout
+	}
+
+	return timeout
 }